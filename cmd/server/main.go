@@ -12,14 +12,20 @@ import (
 	"os"
 	"runtime/debug"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/Frimurare/WulfVault/internal/auth"
 	"github.com/Frimurare/WulfVault/internal/cleanup"
 	"github.com/Frimurare/WulfVault/internal/config"
 	"github.com/Frimurare/WulfVault/internal/database"
+	"github.com/Frimurare/WulfVault/internal/directory"
+	"github.com/Frimurare/WulfVault/internal/integrity"
+	"github.com/Frimurare/WulfVault/internal/mfa"
 	"github.com/Frimurare/WulfVault/internal/models"
 	"github.com/Frimurare/WulfVault/internal/server"
+	"github.com/Frimurare/WulfVault/internal/sessionpolicy"
+	"github.com/Frimurare/WulfVault/internal/storage"
 )
 
 const (
@@ -79,6 +85,15 @@ func main() {
 			if err := auth.CleanupExpiredSessions(); err != nil {
 				log.Printf("Error cleaning up sessions: %v", err)
 			}
+			if err := auth.CleanupLoginThrottles(); err != nil {
+				log.Printf("Error cleaning up login throttles: %v", err)
+			}
+			if err := database.DB.CleanupExpiredVerifications(); err != nil {
+				log.Printf("Error cleaning up email verifications: %v", err)
+			}
+			if err := database.DB.CleanupExpiredMagicLinks(); err != nil {
+				log.Printf("Error cleaning up sign-in links: %v", err)
+			}
 		}
 	})
 
@@ -115,8 +130,15 @@ func main() {
 		cfg.Port = *port
 	}
 
-	// Always override uploads dir if provided
+	// Always override uploads and data dirs if provided
 	cfg.UploadsDir = *uploadsDir
+	cfg.DataDir = *dataDir
+
+	// Forwarding headers are only trusted for brute-force lockouts on requests
+	// from these proxies
+	if proxies := getEnv("TRUSTED_PROXIES", ""); proxies != "" {
+		cfg.TrustedProxies = strings.Split(proxies, ",")
+	}
 
 	// Load trash retention setting from database if available
 	if trashRetentionStr, err := database.DB.GetConfigValue("trash_retention_days"); err == nil && trashRetentionStr != "" {
@@ -147,13 +169,41 @@ func main() {
 		cfg.AuditLogMaxSizeMB = 100 // default fallback
 	}
 
+	// The session timeout of config.json becomes the global session lifetime,
+	// unless one has been set in the admin settings
+	if err := sessionpolicy.AdoptConfigLifetime(cfg.SessionTimeoutHours); err != nil {
+		log.Printf("Warning: failed to apply session timeout from configuration: %v", err)
+	}
+
+	// Move blobs from the flat uploads directory into the sharded layout.
+	// Runs in the background; files are resolved in either location meanwhile.
+	safeGo("uploads-layout-migration", func() {
+		if err := storage.MigrateToSharded(*uploadsDir); err != nil {
+			log.Printf("Error migrating uploads to sharded layout: %v", err)
+		}
+	})
+
+	// Start disk space monitor (checks uploads and data volumes every 5 minutes)
+	storage.StartDiskSpaceMonitor(*uploadsDir, *dataDir, 5*time.Minute)
+
 	// Start file expiration cleanup scheduler (runs every 6 hours)
-	cleanup.StartCleanupScheduler(*uploadsDir, 6*time.Hour, cfg.TrashRetentionDays)
+	// Also warns, disables and deletes dormant download accounts per the lifecycle policy
+	cleanup.StartCleanupScheduler(*uploadsDir, cfg.ServerURL, 6*time.Hour, cfg.TrashRetentionDays)
 
 	// Start audit log cleanup scheduler (runs every 24 hours)
 	// Deletes logs older than AuditLogRetentionDays and maintains max size
 	cleanup.StartAuditLogCleanupScheduler(cfg.AuditLogRetentionDays, cfg.AuditLogMaxSizeMB)
 
+	// Start integrity scrubber (re-hashes a throttled batch of files every 15 minutes)
+	// Rate and re-verification interval are read from settings on each pass
+	integrity.StartScrubScheduler(*uploadsDir, 15*time.Minute)
+
+	// Start LDAP directory sync (checks every 5 minutes whether the configured sync interval has passed)
+	directory.StartSyncScheduler(cfg.DefaultQuotaMB, 5*time.Minute)
+
+	// Remind users whose role requires two-factor authentication to set it up (checks hourly)
+	mfa.StartReminderScheduler(cfg.ServerURL, 1*time.Hour)
+
 	// Cleanup expired file requests periodically (runs every 24 hours)
 	// File requests expire after 24 hours, then show "expired" message for 10 days, then are deleted
 	safeGo("file-request-cleanup", func() {
@@ -0,0 +1,86 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"github.com/Frimurare/WulfVault/internal/database"
+	"github.com/Frimurare/WulfVault/internal/models"
+)
+
+// APIKeyPrefix marks WulfVault API tokens so they are easy to recognise in scripts and secret scanners
+const APIKeyPrefix = "wv_"
+
+// CreateAPIKey creates a new API key for a user and returns it together with the
+// secret token. The token is only returned here; the database stores its hash.
+func CreateAPIKey(userId int, name string, permissions models.ApiPermission, expiry int64) (*models.ApiKey, string, error) {
+	idBytes := make([]byte, 8)
+	if _, err := rand.Read(idBytes); err != nil {
+		return nil, "", err
+	}
+	secretBytes := make([]byte, 32)
+	if _, err := rand.Read(secretBytes); err != nil {
+		return nil, "", err
+	}
+
+	id := hex.EncodeToString(idBytes)
+	token := APIKeyPrefix + id + "_" + hex.EncodeToString(secretBytes)
+
+	key := &models.ApiKey{
+		Id:           id,
+		PublicId:     id,
+		FriendlyName: name,
+		Permissions:  permissions,
+		Expiry:       expiry,
+		UserId:       userId,
+	}
+
+	if err := database.DB.CreateApiKey(key, HashAPIKey(token)); err != nil {
+		return nil, "", err
+	}
+
+	return key, token, nil
+}
+
+// HashAPIKey returns the stored representation of an API token
+func HashAPIKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// AuthenticateAPIKey resolves a bearer token to its key and owning user.
+// Expired keys and keys of disabled users are rejected.
+func AuthenticateAPIKey(token string) (*models.User, *models.ApiKey, error) {
+	if !strings.HasPrefix(token, APIKeyPrefix) {
+		return nil, nil, errors.New("invalid API key")
+	}
+
+	key, err := database.DB.GetApiKeyByHash(HashAPIKey(token))
+	if err != nil {
+		return nil, nil, errors.New("invalid API key")
+	}
+
+	if key.IsExpired() {
+		return nil, nil, errors.New("API key expired")
+	}
+
+	user, err := database.DB.GetUserByID(key.UserId)
+	if err != nil {
+		return nil, nil, errors.New("invalid API key")
+	}
+	if !user.IsActive {
+		return nil, nil, errors.New("account is disabled")
+	}
+
+	database.DB.UpdateApiKeyLastUsed(key.Id)
+
+	return user, key, nil
+}
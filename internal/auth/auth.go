@@ -7,6 +7,7 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"time"
@@ -15,12 +16,11 @@ import (
 
 	"github.com/Frimurare/WulfVault/internal/database"
 	"github.com/Frimurare/WulfVault/internal/models"
+	"github.com/Frimurare/WulfVault/internal/sessionpolicy"
 )
 
 const (
-	SessionDuration      = 24 * time.Hour
-	InactivityTimeout    = 10 * time.Minute
-	BcryptCost           = 12
+	BcryptCost = 12
 )
 
 // HashPassword hashes a password using bcrypt
@@ -44,19 +44,70 @@ func GenerateSessionID() (string, error) {
 	return hex.EncodeToString(bytes), nil
 }
 
-// CreateSession creates a new session for a user
-func CreateSession(userId int) (string, error) {
+// CreateSession creates a new session for a user, recording the client it was created from
+func CreateSession(userId int, ipAddress, userAgent string) (string, error) {
+	return createSession(userId, ipAddress, userAgent, false)
+}
+
+// CreateRememberedSession creates a session for a user who asked to have their
+// device remembered. It lasts as long as the session policy allows remembering
+// a device and doesn't expire when idle. Users who can't have their device
+// remembered get a regular session.
+func CreateRememberedSession(userId int, ipAddress, userAgent string) (string, error) {
+	return createSession(userId, ipAddress, userAgent, true)
+}
+
+func createSession(userId int, ipAddress, userAgent string, remember bool) (string, error) {
+	user, err := database.DB.GetUserByID(userId)
+	if err != nil {
+		return "", err
+	}
+
 	sessionId, err := GenerateSessionID()
 	if err != nil {
 		return "", err
 	}
 
-	validUntil := time.Now().Add(SessionDuration).Unix()
+	policy := sessionpolicy.LoadPolicy()
+	lifetime := policy.For(user).Lifetime
+	if remember {
+		if remembered := policy.RememberFor(user); remembered > 0 {
+			lifetime = remembered
+		} else {
+			remember = false
+		}
+	}
+
+	now := time.Now()
+	validUntil := now.Add(lifetime).Unix()
+
+	_, err = database.DB.Exec(`
+		INSERT INTO Sessions (Id, UserId, ValidUntil, CreatedAt, LastSeen, IPAddress, UserAgent, Device, Remembered)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		sessionId, userId, validUntil, now.Unix(), now.Unix(), ipAddress, userAgent, ParseDevice(userAgent), remember,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	return sessionId, nil
+}
+
+// CreateImpersonationSession creates a session of a user for a super admin who
+// views the app as that user. It ends after the given duration.
+func CreateImpersonationSession(adminId, userId int, duration time.Duration, writable bool, ipAddress, userAgent string) (string, error) {
+	sessionId, err := GenerateSessionID()
+	if err != nil {
+		return "", err
+	}
 
+	now := time.Now()
 	_, err = database.DB.Exec(`
-		INSERT INTO Sessions (Id, UserId, ValidUntil)
-		VALUES (?, ?, ?)`,
-		sessionId, userId, validUntil,
+		INSERT INTO Sessions (Id, UserId, ValidUntil, CreatedAt, LastSeen, IPAddress, UserAgent, Device,
+			ImpersonatorId, ImpersonationWritable)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		sessionId, userId, now.Add(duration).Unix(), now.Unix(), now.Unix(), ipAddress, userAgent, ParseDevice(userAgent),
+		adminId, writable,
 	)
 	if err != nil {
 		return "", err
@@ -67,13 +118,13 @@ func CreateSession(userId int) (string, error) {
 
 // GetUserBySession retrieves a user by session ID
 func GetUserBySession(sessionId string) (*models.User, error) {
-	var userId int
+	var userId, impersonatorId int
 	var validUntil int64
 
 	err := database.DB.QueryRow(`
-		SELECT UserId, ValidUntil FROM Sessions WHERE Id = ?`,
+		SELECT UserId, ValidUntil, COALESCE(ImpersonatorId, 0) FROM Sessions WHERE Id = ?`,
 		sessionId,
-	).Scan(&userId, &validUntil)
+	).Scan(&userId, &validUntil, &impersonatorId)
 
 	if err != nil {
 		return nil, errors.New("invalid session")
@@ -92,8 +143,11 @@ func GetUserBySession(sessionId string) (*models.User, error) {
 		return nil, err
 	}
 
-	// Update last online
-	database.DB.UpdateUserLastOnline(userId)
+	// Update last online. An admin viewing the app as the user is not the user being online.
+	if impersonatorId == 0 {
+		database.DB.UpdateUserLastOnline(userId)
+	}
+	database.DB.TouchSession(sessionId)
 
 	return user, nil
 }
@@ -104,12 +158,32 @@ func DeleteSession(sessionId string) error {
 	return err
 }
 
-// CleanupExpiredSessions removes all expired sessions
-func CleanupExpiredSessions() error {
-	_, err := database.DB.Exec("DELETE FROM Sessions WHERE ValidUntil < ?", time.Now().Unix())
+// DeleteUserSessions logs a user out everywhere
+func DeleteUserSessions(userId int) error {
+	_, err := database.DB.Exec("DELETE FROM Sessions WHERE UserId = ?", userId)
 	return err
 }
 
+// SessionHandle returns a stable identifier for a session that can be shown to
+// the browser. The session ID itself is the cookie secret and is never exposed.
+func SessionHandle(sessionId string) string {
+	sum := sha256.Sum256([]byte(sessionId))
+	return hex.EncodeToString(sum[:8])
+}
+
+// CleanupExpiredSessions removes all expired sessions, and download account
+// sessions that have gone idle
+func CleanupExpiredSessions() error {
+	if _, err := database.DB.Exec("DELETE FROM Sessions WHERE ValidUntil < ?", time.Now().Unix()); err != nil {
+		return err
+	}
+	var idleBefore int64
+	if idle := sessionpolicy.LoadPolicy().Global().IdleTimeout; idle > 0 {
+		idleBefore = time.Now().Add(-idle).Unix()
+	}
+	return database.DB.CleanupExpiredDownloadSessions(idleBefore)
+}
+
 // AuthenticateUser authenticates a user by email/username and password
 // Returns User or nil. For download accounts, use AuthenticateDownloadAccount directly.
 func AuthenticateUser(emailOrUsername, password string) (*models.User, error) {
@@ -232,33 +306,95 @@ func CreateDownloadAccount(email, password string) (*models.DownloadAccount, err
 	return account, nil
 }
 
-// CreateDownloadAccountSession creates a session token for a download account
-// Returns the email (used as session identifier)
-func CreateDownloadAccountSession(accountId int) (string, error) {
-	account, err := database.DB.GetDownloadAccountByID(accountId)
+// ErrSessionIdle is returned for a download account session that was not used
+// within the idle timeout of the session policy. The session is deleted.
+var ErrSessionIdle = errors.New("session expired due to inactivity")
+
+// CreateDownloadAccountSession creates a session for a download account, recording
+// the client it was created from and how it signed in (database.DownloadAuthPassword
+// or database.DownloadAuthMagicLink), and returns its ID
+func CreateDownloadAccountSession(accountId int, ipAddress, userAgent, authMethod string) (string, error) {
+	sessionId, err := GenerateSessionID()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now().Unix()
+	err = database.DB.CreateDownloadSession(&database.DownloadSession{
+		Id:         sessionId,
+		AccountId:  accountId,
+		ValidUntil: time.Now().Add(sessionpolicy.LoadPolicy().Global().Lifetime).Unix(),
+		CreatedAt:  now,
+		LastSeen:   now,
+		IPAddress:  ipAddress,
+		UserAgent:  userAgent,
+		Device:     ParseDevice(userAgent),
+		AuthMethod: authMethod,
+	})
 	if err != nil {
 		return "", err
 	}
 
-	// For download accounts, we use their email as the session identifier
-	// This is simpler than creating a separate session table
-	return account.Email, nil
+	// Signing in counts as using the account for the dormant account lifecycle
+	database.DB.TouchDownloadAccount(accountId)
+	return sessionId, nil
+}
+
+// DownloadSessionAuthMethod returns how a download account session signed in
+func DownloadSessionAuthMethod(sessionId string) string {
+	session, err := database.DB.GetDownloadSession(sessionId)
+	if err != nil {
+		return ""
+	}
+	return session.AuthMethod
 }
 
-// GetDownloadAccountBySession retrieves a download account by session (email)
-func GetDownloadAccountBySession(sessionEmail string) (*models.DownloadAccount, error) {
-	account, err := database.DB.GetDownloadAccountByEmail(sessionEmail)
+// GetDownloadAccountBySession retrieves a download account by session ID. Expired
+// and idle sessions, and sessions of disabled or deleted accounts, are deleted.
+func GetDownloadAccountBySession(sessionId string) (*models.DownloadAccount, error) {
+	session, err := database.DB.GetDownloadSession(sessionId)
+	if err != nil {
+		return nil, errors.New("invalid session")
+	}
+
+	now := time.Now()
+	if now.Unix() > session.ValidUntil {
+		database.DB.DeleteDownloadSession(sessionId)
+		return nil, errors.New("session expired")
+	}
+	if sessionpolicy.LoadPolicy().Global().Idle(session.LastSeen, now) {
+		database.DB.DeleteDownloadSession(sessionId)
+		return nil, ErrSessionIdle
+	}
+
+	account, err := database.DB.GetDownloadAccountByID(session.AccountId)
 	if err != nil {
 		return nil, errors.New("invalid session")
 	}
 
 	// Check if account is active
-	if !account.IsActive {
+	if !account.IsActive || account.DeletedAt > 0 {
+		database.DB.DeleteDownloadSessionsByAccount(account.Id)
 		return nil, errors.New("account is disabled")
 	}
 
-	// Update last used
-	database.DB.UpdateDownloadAccountLastUsed(account.Id)
+	database.DB.TouchDownloadSession(sessionId)
 
 	return account, nil
 }
+
+// TouchDownloadAccountSession keeps a download account session from going idle,
+// e.g. while a transfer is running
+func TouchDownloadAccountSession(sessionId string) {
+	database.DB.TouchDownloadSession(sessionId)
+}
+
+// DeleteDownloadAccountSession deletes a download account session (logout)
+func DeleteDownloadAccountSession(sessionId string) error {
+	return database.DB.DeleteDownloadSession(sessionId)
+}
+
+// DeleteDownloadAccountSessions logs a download account out everywhere
+func DeleteDownloadAccountSessions(accountId int) (int64, error) {
+	return database.DB.DeleteDownloadSessionsByAccount(accountId)
+}
@@ -0,0 +1,211 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package auth
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Frimurare/WulfVault/internal/database"
+)
+
+func initTestDB(t *testing.T) {
+	if err := database.Initialize(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.DB.Close() })
+}
+
+func TestLockoutDuration(t *testing.T) {
+	tests := []struct {
+		excess int
+		want   time.Duration
+	}{
+		{0, LockoutBase},
+		{1, 2 * LockoutBase},
+		{2, 4 * LockoutBase},
+		{5, 32 * LockoutBase},
+		{6, LockoutMax},
+		{100, LockoutMax},
+	}
+	for _, tt := range tests {
+		if got := LockoutDuration(tt.excess); got != tt.want {
+			t.Errorf("LockoutDuration(%d) = %v, want %v", tt.excess, got, tt.want)
+		}
+	}
+}
+
+func TestRecordFailure(t *testing.T) {
+	initTestDB(t)
+
+	account := AccountLockKey(" Anna@Example.com ")
+	if account != AccountLockKey("anna@example.com") {
+		t.Error("account keys are not normalized")
+	}
+
+	// Below the threshold nothing is locked
+	for i := 1; i < LockoutAccountThreshold; i++ {
+		if lockouts := RecordFailure(account); len(lockouts) != 0 {
+			t.Fatalf("failure %d locked the account", i)
+		}
+	}
+	if !LockedUntil(account).IsZero() {
+		t.Fatal("account locked below the threshold")
+	}
+
+	// Reaching the threshold locks for the base duration and is reported once as first
+	start := time.Now()
+	lockouts := RecordFailure(account)
+	if len(lockouts) != 1 || !lockouts[0].First || lockouts[0].Failures != LockoutAccountThreshold {
+		t.Fatalf("threshold failure: got %+v", lockouts)
+	}
+	first := lockouts[0].Until
+	if d := first.Sub(start); d < LockoutBase-time.Second || d > LockoutBase+time.Second {
+		t.Errorf("first lockout lasts %v, want %v", d, LockoutBase)
+	}
+
+	// Each further failure doubles the lock
+	lockouts = RecordFailure(account)
+	if len(lockouts) != 1 || lockouts[0].First {
+		t.Fatalf("failure beyond threshold: got %+v", lockouts)
+	}
+	if d := lockouts[0].Until.Sub(start); d < 2*LockoutBase-time.Second || d > 2*LockoutBase+time.Second {
+		t.Errorf("second lockout lasts %v, want %v", d, 2*LockoutBase)
+	}
+
+	// IP keys have a higher threshold
+	ip := IPLockKey("198.51.100.7")
+	for i := 1; i < LockoutIPThreshold; i++ {
+		if lockouts := RecordFailure(ip); len(lockouts) != 0 {
+			t.Fatalf("IP failure %d locked the address", i)
+		}
+	}
+
+	// LockedUntil returns the latest lock of the given keys and ignores unlocked ones
+	other := AccountLockKey("bert@example.com")
+	RecordFailure(other)
+	until := LockedUntil(other, account, ip)
+	if until.Unix() != lockouts[0].Until.Unix() {
+		t.Errorf("LockedUntil = %v, want %v", until, lockouts[0].Until)
+	}
+	lockouts = RecordFailure(ip)
+	if len(lockouts) != 1 || !lockouts[0].First {
+		t.Fatalf("IP threshold failure: got %+v", lockouts)
+	}
+	if got := LockedUntil(account, ip); got.Unix() != until.Unix() {
+		t.Errorf("LockedUntil picked the earlier lock: %v", got)
+	}
+
+	// Clearing a key unlocks it and restarts its count; other keys stay locked
+	ClearFailures(account)
+	if !LockedUntil(account).IsZero() {
+		t.Error("account still locked after ClearFailures")
+	}
+	if LockedUntil(ip).IsZero() {
+		t.Error("ClearFailures of the account unlocked the IP")
+	}
+	if lockouts := RecordFailure(account); len(lockouts) != 0 {
+		t.Error("failure count was not reset by ClearFailures")
+	}
+}
+
+func TestLockoutClientIP(t *testing.T) {
+	trusted := []string{"10.0.0.0/8", "192.0.2.1"}
+
+	tests := []struct {
+		name      string
+		remote    string
+		forwarded string
+		realIP    string
+		trusted   []string
+		want      string
+	}{
+		{"direct", "203.0.113.4:5123", "", "", nil, "203.0.113.4"},
+		{"spoofed headers without proxy", "203.0.113.4:5123", "198.51.100.1", "198.51.100.2", nil, "203.0.113.4"},
+		{"untrusted remote", "203.0.113.4:5123", "198.51.100.1", "", trusted, "203.0.113.4"},
+		{"trusted proxy", "10.1.2.3:443", "198.51.100.1", "", trusted, "198.51.100.1"},
+		{"prepended entry ignored", "10.1.2.3:443", "1.2.3.4, 198.51.100.1", "", trusted, "198.51.100.1"},
+		{"proxy chain", "192.0.2.1:443", "198.51.100.1, 10.9.9.9", "", trusted, "198.51.100.1"},
+		{"real ip from proxy", "10.1.2.3:443", "", "198.51.100.3", trusted, "198.51.100.3"},
+		{"ipv6", "[2001:db8::1]:443", "198.51.100.1", "", trusted, "2001:db8::1"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("POST", "/login", nil)
+		r.RemoteAddr = tt.remote
+		if tt.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", tt.forwarded)
+		}
+		if tt.realIP != "" {
+			r.Header.Set("X-Real-IP", tt.realIP)
+		}
+		if got := LockoutClientIP(r, tt.trusted); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPasswordResetEndsDownloadSessions(t *testing.T) {
+	initTestDB(t)
+
+	account, err := CreateDownloadAccount("recipient@example.com", "Recipient123!")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessionId, err := CreateDownloadAccountSession(account.Id, "198.51.100.7", "test", database.DownloadAuthPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := database.DB.CreatePasswordResetToken(account.Email, database.AccountTypeDownloadAccount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := HashPassword("NewPassword123!")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.DB.ResetPasswordWithToken(token, hash); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := GetDownloadAccountBySession(sessionId); err == nil {
+		t.Error("download session survived the password reset")
+	}
+}
+
+func TestResolveExternalUserRequiresVerifiedEmail(t *testing.T) {
+	initTestDB(t)
+
+	existing, err := NewProvisionedUser("Local Admin", "admin@example.com", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.DB.CreateUser(existing); err != nil {
+		t.Fatal(err)
+	}
+
+	// An unverified email must not link to the existing account
+	id := &ExternalIdentity{Source: database.AuthSourceOIDC, Subject: "attacker", Email: "Admin@Example.com"}
+	if _, _, err := ResolveExternalUser(id, true, 0); err != ErrEmailNotVerified {
+		t.Fatalf("unverified email: got %v, want ErrEmailNotVerified", err)
+	}
+	if source, _, _ := database.DB.GetUserAuthSource(existing.Id); source != "" {
+		t.Error("account was linked by an unverified email")
+	}
+
+	// New accounts are still provisioned
+	id = &ExternalIdentity{Source: database.AuthSourceOIDC, Subject: "newcomer", Email: "new@example.com"}
+	if _, created, err := ResolveExternalUser(id, true, 0); err != nil || !created {
+		t.Fatalf("provisioning: created %v, err %v", created, err)
+	}
+
+	id = &ExternalIdentity{Source: database.AuthSourceOIDC, Subject: "owner", Email: "admin@example.com", EmailVerified: true}
+	user, created, err := ResolveExternalUser(id, true, 0)
+	if err != nil || created || user.Id != existing.Id {
+		t.Fatalf("verified email: user %+v, created %v, err %v", user, created, err)
+	}
+}
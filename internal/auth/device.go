@@ -0,0 +1,77 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package auth
+
+import "strings"
+
+// userAgentMatch maps a User-Agent substring to a readable name.
+// Order matters: the first match wins.
+type userAgentMatch struct {
+	token string
+	name  string
+}
+
+var browserMatches = []userAgentMatch{
+	{"Edg/", "Edge"},
+	{"EdgA/", "Edge"},
+	{"OPR/", "Opera"},
+	{"SamsungBrowser/", "Samsung Internet"},
+	{"Vivaldi/", "Vivaldi"},
+	{"Firefox/", "Firefox"},
+	{"FxiOS/", "Firefox"},
+	{"CriOS/", "Chrome"},
+	{"Chrome/", "Chrome"},
+	{"Safari/", "Safari"},
+	{"curl/", "curl"},
+	{"Wget/", "Wget"},
+	{"python-requests/", "Python"},
+	{"Go-http-client/", "Go client"},
+}
+
+var platformMatches = []userAgentMatch{
+	{"iPhone", "iPhone"},
+	{"iPad", "iPad"},
+	{"Android", "Android"},
+	{"CrOS", "ChromeOS"},
+	{"Windows", "Windows"},
+	{"Macintosh", "macOS"},
+	{"Mac OS X", "macOS"},
+	{"Linux", "Linux"},
+}
+
+// ParseDevice returns a short description of the browser and platform of a
+// User-Agent, such as "Firefox on Windows"
+func ParseDevice(userAgent string) string {
+	if userAgent == "" {
+		return "Unknown device"
+	}
+
+	browser := ""
+	for _, m := range browserMatches {
+		if strings.Contains(userAgent, m.token) {
+			browser = m.name
+			break
+		}
+	}
+
+	platform := ""
+	for _, m := range platformMatches {
+		if strings.Contains(userAgent, m.token) {
+			platform = m.name
+			break
+		}
+	}
+
+	switch {
+	case browser != "" && platform != "":
+		return browser + " on " + platform
+	case browser != "":
+		return browser
+	case platform != "":
+		return "Browser on " + platform
+	}
+	return "Unknown device"
+}
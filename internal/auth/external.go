@@ -0,0 +1,170 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Frimurare/WulfVault/internal/database"
+	"github.com/Frimurare/WulfVault/internal/models"
+)
+
+// ExternalIdentity is a user as asserted by an external identity provider
+type ExternalIdentity struct {
+	Source  string // database.AuthSource* value
+	Subject string // Stable ID at the provider
+	Email   string
+	Name    string
+	// EmailVerified is true when the provider vouches for the email address.
+	// Existing accounts are only linked by a verified email.
+	EmailVerified bool
+	// IsAdmin is nil when the provider does not manage roles
+	IsAdmin *bool
+}
+
+// ErrNoLocalAccount is returned when an identity has no account and provisioning is off
+var ErrNoLocalAccount = errors.New("no account exists for this identity")
+
+// ErrEmailNotVerified is returned when an identity would be linked to an existing
+// account by an email address the provider has not verified
+var ErrEmailNotVerified = errors.New("the identity provider has not verified this email address, so it cannot be linked to an existing account")
+
+// ErrAccountDisabled is returned when the linked account has been deactivated
+var ErrAccountDisabled = errors.New("account is disabled")
+
+// ResolveExternalUser finds the user for an external identity, linking an existing
+// account with the same verified email or provisioning a new one. Roles are synced on every
+// login when the provider manages them. The super admin is never linked or changed,
+// so it always remains available as a local break-glass account.
+func ResolveExternalUser(id *ExternalIdentity, autoProvision bool, defaultQuotaMB int64) (user *models.User, created bool, err error) {
+	id.Email = strings.ToLower(strings.TrimSpace(id.Email))
+	if id.Subject == "" || id.Email == "" {
+		return nil, false, errors.New("identity has no subject or email")
+	}
+
+	user, err = database.DB.GetUserByExternalID(id.Source, id.Subject)
+	if err != nil {
+		user, err = database.DB.GetUserByEmail(id.Email)
+		if err == nil {
+			if user.UserLevel == models.UserLevelSuperAdmin {
+				return nil, false, errors.New("the super admin must sign in with the local password")
+			}
+			source, externalId, err := database.DB.GetUserAuthSource(user.Id)
+			if err != nil {
+				return nil, false, err
+			}
+			if source != "" && (source != id.Source || externalId != id.Subject) {
+				return nil, false, errors.New("account is linked to a different identity")
+			}
+			// Otherwise anyone who can set that email at the provider takes over the account
+			if !id.EmailVerified {
+				return nil, false, ErrEmailNotVerified
+			}
+			if err := database.DB.SetUserExternalIdentity(user.Id, id.Source, id.Subject); err != nil {
+				return nil, false, err
+			}
+		} else {
+			if !autoProvision {
+				return nil, false, ErrNoLocalAccount
+			}
+			user, err = provisionExternalUser(id, defaultQuotaMB)
+			if err != nil {
+				return nil, false, err
+			}
+			created = true
+		}
+	}
+
+	if !user.IsActive {
+		return nil, false, ErrAccountDisabled
+	}
+
+	// Custom roles are kept as long as they agree with the provider on admin access
+	if user.UserLevel != models.UserLevelSuperAdmin && id.IsAdmin != nil && user.IsAdmin() != *id.IsAdmin {
+		roleId := models.RoleIdUser
+		if *id.IsAdmin {
+			roleId = models.RoleIdAdministrator
+		}
+		role, err := database.DB.GetRole(roleId)
+		if err != nil {
+			return nil, false, err
+		}
+		if err := database.DB.SetUserRole(user, role); err != nil {
+			return nil, false, err
+		}
+	}
+
+	return user, created, nil
+}
+
+// provisionExternalUser creates an account for a first-time external login
+func provisionExternalUser(id *ExternalIdentity, defaultQuotaMB int64) (*models.User, error) {
+	user, err := NewProvisionedUser(id.Name, id.Email, defaultQuotaMB)
+	if err != nil {
+		return nil, err
+	}
+	if id.IsAdmin != nil && *id.IsAdmin {
+		user.UserLevel = models.UserLevelAdmin
+		user.Permissions = models.UserPermissionAll
+	}
+
+	if err := database.DB.CreateUser(user); err != nil {
+		return nil, err
+	}
+	if err := database.DB.SetUserExternalIdentity(user.Id, id.Source, id.Subject); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// NewProvisionedUser prepares a regular user account that an identity provider
+// manages. Such users never log in with a local password, so an unusable one is
+// stored. The name is made unique; the caller creates the user.
+func NewProvisionedUser(name, email string, defaultQuotaMB int64) (*models.User, error) {
+	secret, err := GenerateSessionID()
+	if err != nil {
+		return nil, err
+	}
+	password, err := HashPassword(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	name, err = UniqueUserName(name, email)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.User{
+		Name:           name,
+		Email:          email,
+		Password:       password,
+		UserLevel:      models.UserLevelUser,
+		Permissions:    models.UserPermissionNone,
+		StorageQuotaMB: defaultQuotaMB,
+		IsActive:       true,
+	}, nil
+}
+
+// UniqueUserName picks a display name that is not yet taken (Name is unique)
+func UniqueUserName(name, email string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = strings.SplitN(email, "@", 2)[0]
+	}
+
+	candidate := name
+	for i := 2; i < 100; i++ {
+		if _, err := database.DB.GetUserByName(candidate); err != nil {
+			return candidate, nil
+		}
+		candidate = fmt.Sprintf("%s (%d)", name, i)
+	}
+	return "", errors.New("could not find a free user name")
+}
@@ -0,0 +1,202 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package auth
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Frimurare/WulfVault/internal/database"
+)
+
+// Brute-force protection. Failed attempts are counted per key: the account (by
+// email), the second factor of a user, a password-protected file and the client
+// IP. Once a key reaches its threshold every further failure locks it, for
+// LockoutBase doubling with each failure up to LockoutMax. A successful attempt
+// clears the account key; IP keys only expire, so one valid account cannot be
+// used to reset an IP that is guessing other accounts.
+const (
+	LockoutAccountThreshold = 5
+	LockoutIPThreshold      = 20
+	LockoutBase             = 1 * time.Minute
+	LockoutMax              = 1 * time.Hour
+	LockoutResetAfter       = 24 * time.Hour
+)
+
+// Lock key prefixes
+const (
+	LockKeyAccount = "account:"
+	LockKeyTOTP    = "totp:"
+	LockKeyFile    = "file:"
+	LockKeyIP      = "ip:"
+)
+
+// AccountLockKey is the key for password attempts on an account
+func AccountLockKey(email string) string {
+	return LockKeyAccount + strings.ToLower(strings.TrimSpace(email))
+}
+
+// TOTPLockKey is the key for TOTP and backup code attempts for a user
+func TOTPLockKey(userId int) string {
+	return fmt.Sprintf("%s%d", LockKeyTOTP, userId)
+}
+
+// FileLockKey is the key for password attempts on a protected file
+func FileLockKey(fileId string) string {
+	return LockKeyFile + fileId
+}
+
+// IPLockKey is the key for all attempts from one client address
+func IPLockKey(ip string) string {
+	return LockKeyIP + ip
+}
+
+// LockoutClientIP returns the client address used for IP lock keys. Forwarding
+// headers can be set by anyone, so they are only believed when the connection
+// comes from one of the trusted proxies (IP addresses or CIDR ranges). The
+// X-Forwarded-For list is then read from the right, skipping trusted proxies,
+// so a client cannot pick its own address by prepending entries.
+func LockoutClientIP(r *http.Request, trustedProxies []string) string {
+	remote := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		remote = host
+	}
+	if !isTrustedProxy(remote, trustedProxies) {
+		return remote
+	}
+
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		hops := strings.Split(forwarded, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if net.ParseIP(hop) == nil {
+				break
+			}
+			if !isTrustedProxy(hop, trustedProxies) {
+				return hop
+			}
+		}
+	}
+	if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(realIP) != nil {
+		return realIP
+	}
+	return remote
+}
+
+// isTrustedProxy reports whether an address matches one of the trusted proxies
+func isTrustedProxy(addr string, trustedProxies []string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, proxy := range trustedProxies {
+		proxy = strings.TrimSpace(proxy)
+		if _, network, err := net.ParseCIDR(proxy); err == nil {
+			if network.Contains(ip) {
+				return true
+			}
+		} else if proxyIP := net.ParseIP(proxy); proxyIP != nil && proxyIP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// LockedUntil returns the latest time any of the keys is locked until, or the
+// zero time if none of them is locked
+func LockedUntil(keys ...string) time.Time {
+	var until time.Time
+	now := time.Now()
+	for _, key := range keys {
+		t, err := database.DB.GetLoginThrottle(key)
+		if err != nil || t == nil {
+			continue
+		}
+		if locked := time.Unix(t.LockedUntil, 0); locked.After(now) && locked.After(until) {
+			until = locked
+		}
+	}
+	return until
+}
+
+// Lockout describes a key that was locked by a failed attempt
+type Lockout struct {
+	Key      string
+	Failures int
+	Until    time.Time
+	// First is true when the threshold was just reached; notifications are only
+	// sent then so an ongoing attack does not flood the owner's inbox
+	First bool
+}
+
+// RecordFailure counts a failed attempt against each key and returns the keys
+// that are now locked
+func RecordFailure(keys ...string) []*Lockout {
+	now := time.Now()
+	var lockouts []*Lockout
+
+	for _, key := range keys {
+		failures, err := database.DB.IncrementLoginFailures(key, now.Unix(), now.Add(-LockoutResetAfter).Unix())
+		if err != nil {
+			continue
+		}
+
+		threshold := LockoutAccountThreshold
+		if strings.HasPrefix(key, LockKeyIP) {
+			threshold = LockoutIPThreshold
+		}
+		if failures < threshold {
+			continue
+		}
+
+		until := now.Add(LockoutDuration(failures - threshold))
+		if err := database.DB.SetLoginLockedUntil(key, until.Unix()); err != nil {
+			continue
+		}
+		lockouts = append(lockouts, &Lockout{Key: key, Failures: failures, Until: until, First: failures == threshold})
+	}
+
+	return lockouts
+}
+
+// LockoutDuration returns the lock time after the given number of failures
+// beyond the threshold
+func LockoutDuration(excess int) time.Duration {
+	d := LockoutBase
+	for i := 0; i < excess && d < LockoutMax; i++ {
+		d *= 2
+	}
+	if d > LockoutMax {
+		d = LockoutMax
+	}
+	return d
+}
+
+// ClearFailures resets the given keys after a successful attempt
+func ClearFailures(keys ...string) {
+	for _, key := range keys {
+		database.DB.DeleteLoginThrottle(key)
+	}
+}
+
+// CleanupLoginThrottles removes failure counts that have expired
+func CleanupLoginThrottles() error {
+	now := time.Now()
+	_, err := database.DB.DeleteStaleLoginThrottles(now.Add(-LockoutResetAfter).Unix(), now.Unix())
+	return err
+}
+
+// LockoutMessage is the user-facing error for a locked key
+func LockoutMessage(until time.Time) string {
+	minutes := int(time.Until(until).Minutes()) + 1
+	if minutes == 1 {
+		return "Too many failed attempts. Try again in 1 minute."
+	}
+	return fmt.Sprintf("Too many failed attempts. Try again in %d minutes.", minutes)
+}
@@ -7,11 +7,10 @@ package cleanup
 
 import (
 	"log"
-	"os"
-	"path/filepath"
 	"time"
 
 	"github.com/Frimurare/WulfVault/internal/database"
+	"github.com/Frimurare/WulfVault/internal/storage"
 )
 
 // CleanupExpiredFiles moves expired files to trash (soft delete)
@@ -66,13 +65,18 @@ func CleanupTrash(uploadsDir string, retentionDays int) error {
 
 	deleted := 0
 	for _, file := range files {
-		// Delete from disk
-		filePath := filepath.Join(uploadsDir, file.Id)
-		if err := os.Remove(filePath); err != nil {
-			if !os.IsNotExist(err) {
-				log.Printf("Warning: Could not delete file %s from disk: %v", file.Name, err)
+		// Delete from disk (overwritten first when secure deletion is enabled)
+		cert, err := storage.RemoveBlob(uploadsDir, file, "system")
+		if err != nil {
+			log.Printf("Warning: Could not delete file %s from disk: %v", file.Name, err)
+			if storage.SecureDeleteEnabled() {
+				// Keep the database record so destruction is retried on the next run
+				continue
 			}
 		}
+		if cert != nil {
+			storage.AuditDestruction(cert, 0, "system", "", "")
+		}
 
 		// Permanently delete from database
 		if err := database.DB.PermanentDeleteFile(file.Id); err != nil {
@@ -88,8 +92,9 @@ func CleanupTrash(uploadsDir string, retentionDays int) error {
 	return nil
 }
 
-// StartCleanupScheduler starts a background cleanup scheduler
-func StartCleanupScheduler(uploadsDir string, interval time.Duration, trashRetentionDays int) {
+// StartCleanupScheduler starts a background cleanup scheduler. It also applies the
+// dormant download account lifecycle; serverURL is used in the warning emails.
+func StartCleanupScheduler(uploadsDir, serverURL string, interval time.Duration, trashRetentionDays int) {
 	if trashRetentionDays <= 0 {
 		trashRetentionDays = 5 // default fallback
 	}
@@ -105,6 +110,9 @@ func StartCleanupScheduler(uploadsDir string, interval time.Duration, trashReten
 		if err := CleanupTrash(uploadsDir, trashRetentionDays); err != nil {
 			log.Printf("Error during trash cleanup: %v", err)
 		}
+		if _, err := CleanupDormantDownloadAccounts(serverURL); err != nil {
+			log.Printf("Error during dormant download account cleanup: %v", err)
+		}
 
 		// Then run on schedule
 		for range ticker.C {
@@ -114,6 +122,9 @@ func StartCleanupScheduler(uploadsDir string, interval time.Duration, trashReten
 			if err := CleanupTrash(uploadsDir, trashRetentionDays); err != nil {
 				log.Printf("Error during trash cleanup: %v", err)
 			}
+			if _, err := CleanupDormantDownloadAccounts(serverURL); err != nil {
+				log.Printf("Error during dormant download account cleanup: %v", err)
+			}
 		}
 	}()
 
@@ -0,0 +1,99 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package cleanup
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Frimurare/WulfVault/internal/database"
+	"github.com/Frimurare/WulfVault/internal/models"
+)
+
+func TestPlanDormantAccounts(t *testing.T) {
+	if err := database.Initialize(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.DB.Close() })
+
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	daysAgo := func(days int) int64 { return now.AddDate(0, 0, -days).Unix() }
+
+	accounts := []struct {
+		name     string
+		idleDays int
+		active   bool
+		warnedAt int64
+		deleted  bool
+		want     string // step planned with warn 30, disable 60, delete 90 days
+	}{
+		{"recently used", 29, true, 0, false, ""},
+		{"warn boundary", 30, true, 0, false, DormantWarn},
+		{"already warned", 45, true, daysAgo(10), false, ""},
+		{"warned before last use", 45, true, daysAgo(50), false, DormantWarn},
+		{"just before disable", 59, true, 0, false, DormantWarn},
+		{"disable boundary", 60, true, daysAgo(25), false, DormantDisable},
+		{"disable without warning", 75, true, 0, false, DormantDisable},
+		{"already disabled", 75, false, daysAgo(40), false, ""},
+		{"delete boundary", 90, false, daysAgo(55), false, DormantDelete},
+		{"delete skips earlier steps", 120, true, 0, false, DormantDelete},
+		{"already deleted", 200, false, 0, true, ""},
+	}
+	ids := map[int]string{}
+	for i, a := range accounts {
+		account := &models.DownloadAccount{
+			Name:      a.name,
+			Email:     fmt.Sprintf("account%d@example.com", i),
+			CreatedAt: daysAgo(a.idleDays),
+			IsActive:  a.active,
+		}
+		if err := database.DB.CreateDownloadAccount(account); err != nil {
+			t.Fatal(err)
+		}
+		var deletedAt int64
+		if a.deleted {
+			deletedAt = daysAgo(1)
+		}
+		if _, err := database.DB.Exec("UPDATE DownloadAccounts SET LastUsed = 0, DormancyWarnedAt = ?, DeletedAt = ? WHERE Id = ?",
+			a.warnedAt, deletedAt, account.Id); err != nil {
+			t.Fatal(err)
+		}
+		ids[account.Id] = a.name
+	}
+
+	plan := func(policy *DormancyPolicy) map[string]string {
+		actions, err := PlanDormantAccounts(policy, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		steps := map[string]string{}
+		for _, action := range actions {
+			name := ids[action.Account.Id]
+			if _, ok := steps[name]; ok {
+				t.Errorf("%s: planned more than one step", name)
+			}
+			steps[name] = action.Step
+		}
+		return steps
+	}
+
+	steps := plan(&DormancyPolicy{WarnDays: 30, DisableDays: 60, DeleteDays: 90})
+	for _, a := range accounts {
+		if steps[a.name] != a.want {
+			t.Errorf("%s (%d days idle): got step %q, want %q", a.name, a.idleDays, steps[a.name], a.want)
+		}
+	}
+
+	// Steps that are turned off are never planned
+	steps = plan(&DormancyPolicy{DisableDays: 60})
+	if steps["just before disable"] != "" || steps["disable boundary"] != DormantDisable || steps["delete skips earlier steps"] != DormantDisable {
+		t.Errorf("disable-only policy: got %v", steps)
+	}
+	if steps := plan(&DormancyPolicy{}); len(steps) != 0 {
+		t.Errorf("disabled policy planned %v", steps)
+	}
+}
@@ -0,0 +1,252 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package cleanup
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Frimurare/WulfVault/internal/database"
+	"github.com/Frimurare/WulfVault/internal/email"
+)
+
+// Configuration keys of the dormant download account lifecycle
+const (
+	ConfigDormantWarnDays    = "download_account_warn_days"
+	ConfigDormantDisableDays = "download_account_disable_days"
+	ConfigDormantDeleteDays  = "download_account_delete_days"
+)
+
+// Lifecycle steps for a dormant download account
+const (
+	DormantWarn    = "warn"
+	DormantDisable = "disable"
+	DormantDelete  = "delete"
+)
+
+// DormancyPolicy decides what happens to download accounts that are not used.
+// Each step is the number of days without use after which it is taken; 0 turns
+// the step off.
+type DormancyPolicy struct {
+	WarnDays    int
+	DisableDays int
+	DeleteDays  int
+}
+
+// LoadDormancyPolicy reads the dormant account lifecycle policy. All steps are off by default.
+func LoadDormancyPolicy() *DormancyPolicy {
+	get := func(key string) int {
+		value, err := database.DB.GetConfigValue(key)
+		if err != nil || value == "" {
+			return 0
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return 0
+		}
+		return n
+	}
+	return &DormancyPolicy{
+		WarnDays:    get(ConfigDormantWarnDays),
+		DisableDays: get(ConfigDormantDisableDays),
+		DeleteDays:  get(ConfigDormantDeleteDays),
+	}
+}
+
+// Validate checks that the enabled steps come one after the other
+func (p *DormancyPolicy) Validate() error {
+	if p.WarnDays < 0 || p.DisableDays < 0 || p.DeleteDays < 0 {
+		return errors.New("lifecycle days cannot be negative")
+	}
+	last := 0
+	for _, days := range []int{p.WarnDays, p.DisableDays, p.DeleteDays} {
+		if days == 0 {
+			continue
+		}
+		if days <= last {
+			return errors.New("warning, disabling and deleting must happen after increasing numbers of days")
+		}
+		last = days
+	}
+	return nil
+}
+
+// Save validates and stores the policy
+func (p *DormancyPolicy) Save() error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	for key, days := range map[string]int{
+		ConfigDormantWarnDays:    p.WarnDays,
+		ConfigDormantDisableDays: p.DisableDays,
+		ConfigDormantDeleteDays:  p.DeleteDays,
+	} {
+		if err := database.DB.SetConfigValue(key, strconv.Itoa(days)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Enabled reports whether any lifecycle step is turned on
+func (p *DormancyPolicy) Enabled() bool {
+	return p.WarnDays > 0 || p.DisableDays > 0 || p.DeleteDays > 0
+}
+
+// firstStepDays is the number of idle days before the first enabled step
+func (p *DormancyPolicy) firstStepDays() int {
+	for _, days := range []int{p.WarnDays, p.DisableDays, p.DeleteDays} {
+		if days > 0 {
+			return days
+		}
+	}
+	return 0
+}
+
+// DormantAction is a lifecycle step due for a download account
+type DormantAction struct {
+	Account  *database.DormantDownloadAccount
+	Step     string // DormantWarn, DormantDisable or DormantDelete
+	IdleDays int
+}
+
+// PlanDormantAccounts returns the lifecycle steps due at the given time without
+// taking them. Each account gets at most its furthest due step; accounts that were
+// already warned or disabled are not listed again for that step.
+func PlanDormantAccounts(policy *DormancyPolicy, now time.Time) ([]*DormantAction, error) {
+	if !policy.Enabled() {
+		return nil, nil
+	}
+
+	accounts, err := database.DB.GetDormantDownloadAccounts(now.AddDate(0, 0, -policy.firstStepDays()))
+	if err != nil {
+		return nil, err
+	}
+
+	var actions []*DormantAction
+	for _, account := range accounts {
+		idleDays := int(now.Sub(time.Unix(account.LastActivity, 0)).Hours() / 24)
+
+		step := ""
+		switch {
+		case policy.DeleteDays > 0 && idleDays >= policy.DeleteDays:
+			step = DormantDelete
+		case policy.DisableDays > 0 && idleDays >= policy.DisableDays:
+			if account.IsActive {
+				step = DormantDisable
+			}
+		case policy.WarnDays > 0 && idleDays >= policy.WarnDays:
+			if account.IsActive && !account.Warned() {
+				step = DormantWarn
+			}
+		}
+		if step != "" {
+			actions = append(actions, &DormantAction{Account: account, Step: step, IdleDays: idleDays})
+		}
+	}
+	return actions, nil
+}
+
+// CleanupDormantDownloadAccounts takes the lifecycle steps that are due: dormant
+// accounts are emailed a warning, then disabled, then soft-deleted and anonymized.
+// It returns the steps taken.
+func CleanupDormantDownloadAccounts(serverURL string) ([]*DormantAction, error) {
+	policy := LoadDormancyPolicy()
+	now := time.Now()
+	actions, err := PlanDormantAccounts(policy, now)
+	if err != nil {
+		return nil, err
+	}
+
+	var taken []*DormantAction
+	for _, action := range actions {
+		account := action.Account
+		var err error
+		switch action.Step {
+		case DormantWarn:
+			err = sendDormancyWarning(account, policy, now, serverURL)
+			if err == nil {
+				err = database.DB.SetDownloadAccountDormancyWarned(account.Id)
+			}
+		case DormantDisable:
+			err = database.DB.DisableDormantDownloadAccount(account.Id)
+		case DormantDelete:
+			err = database.DB.SoftDeleteDownloadAccount(account.Id, "system")
+		}
+		if err != nil {
+			log.Printf("Dormant account lifecycle: could not %s download account %s: %v", action.Step, account.Email, err)
+			continue
+		}
+
+		logDormantAction(action, policy)
+		taken = append(taken, action)
+	}
+
+	if len(taken) > 0 {
+		log.Printf("Dormant account lifecycle: %d download account(s) processed", len(taken))
+	}
+	return taken, nil
+}
+
+// logDormantAction writes an audit entry for a lifecycle step
+func logDormantAction(action *DormantAction, policy *DormancyPolicy) {
+	auditAction := database.ActionDownloadAccountDormancyWarned
+	switch action.Step {
+	case DormantDisable:
+		auditAction = database.ActionDownloadAccountDeactivated
+	case DormantDelete:
+		auditAction = database.ActionDownloadAccountDeleted
+	}
+
+	database.DB.LogAction(&database.AuditLogEntry{
+		UserID:     0,
+		UserEmail:  "system",
+		Action:     auditAction,
+		EntityType: database.EntityDownloadAccount,
+		EntityID:   strconv.Itoa(action.Account.Id),
+		Details: database.CreateAuditDetails(map[string]interface{}{
+			"email":         action.Account.Email,
+			"reason":        "dormant",
+			"step":          action.Step,
+			"idle_days":     action.IdleDays,
+			"last_activity": time.Unix(action.Account.LastActivity, 0).Format("2006-01-02"),
+			"warn_days":     policy.WarnDays,
+			"disable_days":  policy.DisableDays,
+			"delete_days":   policy.DeleteDays,
+		}),
+		Success: true,
+	})
+}
+
+// sendDormancyWarning emails a download account that it will be disabled or
+// deleted unless it is used
+func sendDormancyWarning(account *database.DormantDownloadAccount, policy *DormancyPolicy, now time.Time, serverURL string) error {
+	lastActivity := time.Unix(account.LastActivity, 0)
+
+	var consequences []string
+	if policy.DisableDays > 0 {
+		consequences = append(consequences, "disabled on "+lastActivity.AddDate(0, 0, policy.DisableDays).Format("2006-01-02"))
+	}
+	if policy.DeleteDays > 0 {
+		consequences = append(consequences, "deleted on "+lastActivity.AddDate(0, 0, policy.DeleteDays).Format("2006-01-02"))
+	}
+	if len(consequences) == 0 {
+		return nil
+	}
+
+	message := fmt.Sprintf("Your download account has not been used for %d days. Unless you sign in, it will be %s.",
+		int(now.Sub(lastActivity).Hours()/24), strings.Join(consequences, " and "))
+
+	return email.SendSecurityAlert(account.Email, "Your download account will be removed", "Unused Download Account", message, []string{
+		"Account: " + account.Email,
+		"Last used: " + lastActivity.Format("2006-01-02"),
+		"Sign in to keep it: " + strings.TrimRight(serverURL, "/") + "/login",
+	})
+}
@@ -27,6 +27,7 @@ type Config struct {
 	AuditLogRetentionDays   int    `json:"auditLogRetentionDays"`   // Days to keep audit logs (default: 90)
 	AuditLogMaxSizeMB       int    `json:"auditLogMaxSizeMB"`       // Auto-cleanup if log exceeds this size (default: 100MB)
 	SaveIP                  bool   `json:"saveIp"`
+	TrustedProxies          []string `json:"trustedProxies"` // Proxies whose X-Forwarded-For is used for brute-force lockouts
 	Version                 string `json:"-"` // Runtime version, not persisted
 	models.Branding     `json:"branding"`
 }
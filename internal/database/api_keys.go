@@ -0,0 +1,109 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/Frimurare/WulfVault/internal/models"
+)
+
+// CreateApiKey stores a new API key. Only the hash of the secret token is stored.
+func (d *Database) CreateApiKey(key *models.ApiKey, keyHash string) error {
+	if key.CreatedAt == 0 {
+		key.CreatedAt = time.Now().Unix()
+	}
+
+	_, err := d.db.Exec(`
+		INSERT INTO ApiKeys (Id, FriendlyName, LastUsed, Permissions, UserId, KeyHash, Expiry, CreatedAt)
+		VALUES (?, ?, 0, ?, ?, ?, ?, ?)`,
+		key.Id, key.FriendlyName, key.Permissions, key.UserId, keyHash, key.Expiry, key.CreatedAt,
+	)
+	return err
+}
+
+// GetApiKeyByHash retrieves an API key by the hash of its secret token
+func (d *Database) GetApiKeyByHash(keyHash string) (*models.ApiKey, error) {
+	if keyHash == "" {
+		return nil, errors.New("API key not found")
+	}
+
+	key := &models.ApiKey{}
+	err := d.db.QueryRow(`
+		SELECT Id, FriendlyName, COALESCE(LastUsed, 0), Permissions, UserId,
+		       COALESCE(Expiry, 0), COALESCE(CreatedAt, 0)
+		FROM ApiKeys WHERE KeyHash = ?`, keyHash).Scan(
+		&key.Id, &key.FriendlyName, &key.LastUsed, &key.Permissions, &key.UserId,
+		&key.Expiry, &key.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.New("API key not found")
+		}
+		return nil, err
+	}
+
+	key.PublicId = key.Id
+	return key, nil
+}
+
+// GetApiKeysByUser returns all API keys belonging to a user, newest first
+func (d *Database) GetApiKeysByUser(userId int) ([]*models.ApiKey, error) {
+	rows, err := d.db.Query(`
+		SELECT Id, FriendlyName, COALESCE(LastUsed, 0), Permissions, UserId,
+		       COALESCE(Expiry, 0), COALESCE(CreatedAt, 0)
+		FROM ApiKeys WHERE UserId = ? ORDER BY CreatedAt DESC`, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []*models.ApiKey
+	for rows.Next() {
+		key := &models.ApiKey{}
+		if err := rows.Scan(
+			&key.Id, &key.FriendlyName, &key.LastUsed, &key.Permissions, &key.UserId,
+			&key.Expiry, &key.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		key.PublicId = key.Id
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// DeleteApiKey revokes an API key owned by the given user
+func (d *Database) DeleteApiKey(id string, userId int) error {
+	result, err := d.db.Exec(`DELETE FROM ApiKeys WHERE Id = ? AND UserId = ?`, id, userId)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return errors.New("API key not found")
+	}
+	return nil
+}
+
+// DeleteApiKeysByUser revokes all API keys of a user
+func (d *Database) DeleteApiKeysByUser(userId int) error {
+	_, err := d.db.Exec(`DELETE FROM ApiKeys WHERE UserId = ?`, userId)
+	return err
+}
+
+// UpdateApiKeyLastUsed records the time an API key was last used
+func (d *Database) UpdateApiKeyLastUsed(id string) error {
+	_, err := d.db.Exec(`UPDATE ApiKeys SET LastUsed = ? WHERE Id = ?`, time.Now().Unix(), id)
+	return err
+}
@@ -6,6 +6,7 @@ package database
 
 import (
 	"encoding/json"
+	"strings"
 	"time"
 )
 
@@ -23,6 +24,10 @@ type AuditLogEntry struct {
 	UserAgent   string `json:"user_agent"`   // Browser/client info
 	Success     bool   `json:"success"`      // Whether action succeeded
 	ErrorMsg    string `json:"error_msg"`    // Error message if failed
+
+	// Set when a super admin acted while viewing the app as the user
+	ImpersonatorID    int64  `json:"impersonator_id,omitempty"`
+	ImpersonatorEmail string `json:"impersonator_email,omitempty"`
 }
 
 // AuditLogFilter for querying audit logs
@@ -30,11 +35,19 @@ type AuditLogFilter struct {
 	UserID      int64
 	Action      string
 	EntityType  string
+	EntityID    string
 	StartDate   int64
 	EndDate     int64
 	SearchTerm  string
 	Limit       int
 	Offset      int
+
+	// Actions limits the logs to any of these actions
+	Actions []string
+	// AccountEmail, with UserID, also matches logs without a user ID for the
+	// account's email address, such as failed logins. Logs of download accounts
+	// are left out, as their IDs can equal the user's.
+	AccountEmail string
 }
 
 // InitAuditLogTable creates the audit_logs table
@@ -52,7 +65,9 @@ func (db *Database) InitAuditLogTable() error {
 		ip_address TEXT,
 		user_agent TEXT,
 		success INTEGER DEFAULT 1,
-		error_msg TEXT
+		error_msg TEXT,
+		impersonator_id INTEGER DEFAULT 0,
+		impersonator_email TEXT DEFAULT ''
 	);
 
 	CREATE INDEX IF NOT EXISTS idx_audit_timestamp ON audit_logs(timestamp);
@@ -75,8 +90,9 @@ func (db *Database) LogAction(entry *AuditLogEntry) error {
 	query := `
 	INSERT INTO audit_logs (
 		timestamp, user_id, user_email, action, entity_type, entity_id,
-		details, ip_address, user_agent, success, error_msg
-	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		details, ip_address, user_agent, success, error_msg,
+		impersonator_id, impersonator_email
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
 	_, err := db.db.Exec(
@@ -92,6 +108,8 @@ func (db *Database) LogAction(entry *AuditLogEntry) error {
 		entry.UserAgent,
 		entry.Success,
 		entry.ErrorMsg,
+		entry.ImpersonatorID,
+		entry.ImpersonatorEmail,
 	)
 
 	return err
@@ -100,13 +118,19 @@ func (db *Database) LogAction(entry *AuditLogEntry) error {
 // GetAuditLogs retrieves audit logs with optional filtering
 func (db *Database) GetAuditLogs(filter *AuditLogFilter) ([]*AuditLogEntry, error) {
 	query := `SELECT id, timestamp, user_id, user_email, action, entity_type, entity_id,
-	          details, ip_address, user_agent, success, error_msg
+	          details, ip_address, user_agent, success, error_msg,
+	          COALESCE(impersonator_id, 0), COALESCE(impersonator_email, '')
 	          FROM audit_logs WHERE 1=1`
 	args := []interface{}{}
 
-	if filter.UserID > 0 {
-		query += " AND user_id = ?"
-		args = append(args, filter.UserID)
+	// Requests made while impersonating belong to the admin as well as the user
+	if filter.UserID > 0 && filter.AccountEmail != "" {
+		query += " AND (user_id = ? OR impersonator_id = ? OR (user_id = 0 AND LOWER(user_email) = LOWER(?)))" +
+			" AND COALESCE(entity_type, '') NOT IN (?, ?)"
+		args = append(args, filter.UserID, filter.UserID, filter.AccountEmail, EntityDownloadAccount, EntityDownloadSession)
+	} else if filter.UserID > 0 {
+		query += " AND (user_id = ? OR impersonator_id = ?)"
+		args = append(args, filter.UserID, filter.UserID)
 	}
 
 	if filter.Action != "" {
@@ -114,11 +138,23 @@ func (db *Database) GetAuditLogs(filter *AuditLogFilter) ([]*AuditLogEntry, erro
 		args = append(args, filter.Action)
 	}
 
+	if len(filter.Actions) > 0 {
+		query += " AND action IN (?" + strings.Repeat(", ?", len(filter.Actions)-1) + ")"
+		for _, action := range filter.Actions {
+			args = append(args, action)
+		}
+	}
+
 	if filter.EntityType != "" {
 		query += " AND entity_type = ?"
 		args = append(args, filter.EntityType)
 	}
 
+	if filter.EntityID != "" {
+		query += " AND entity_id = ?"
+		args = append(args, filter.EntityID)
+	}
+
 	if filter.StartDate > 0 {
 		query += " AND timestamp >= ?"
 		args = append(args, filter.StartDate)
@@ -130,9 +166,9 @@ func (db *Database) GetAuditLogs(filter *AuditLogFilter) ([]*AuditLogEntry, erro
 	}
 
 	if filter.SearchTerm != "" {
-		query += " AND (user_email LIKE ? OR action LIKE ? OR details LIKE ? OR entity_id LIKE ?)"
+		query += " AND (user_email LIKE ? OR impersonator_email LIKE ? OR action LIKE ? OR details LIKE ? OR entity_id LIKE ?)"
 		searchPattern := "%" + filter.SearchTerm + "%"
-		args = append(args, searchPattern, searchPattern, searchPattern, searchPattern)
+		args = append(args, searchPattern, searchPattern, searchPattern, searchPattern, searchPattern)
 	}
 
 	query += " ORDER BY timestamp DESC"
@@ -170,6 +206,8 @@ func (db *Database) GetAuditLogs(filter *AuditLogFilter) ([]*AuditLogEntry, erro
 			&log.UserAgent,
 			&success,
 			&log.ErrorMsg,
+			&log.ImpersonatorID,
+			&log.ImpersonatorEmail,
 		)
 		if err != nil {
 			return nil, err
@@ -186,9 +224,14 @@ func (db *Database) GetAuditLogCount(filter *AuditLogFilter) (int, error) {
 	query := "SELECT COUNT(*) FROM audit_logs WHERE 1=1"
 	args := []interface{}{}
 
-	if filter.UserID > 0 {
-		query += " AND user_id = ?"
-		args = append(args, filter.UserID)
+	// Requests made while impersonating belong to the admin as well as the user
+	if filter.UserID > 0 && filter.AccountEmail != "" {
+		query += " AND (user_id = ? OR impersonator_id = ? OR (user_id = 0 AND LOWER(user_email) = LOWER(?)))" +
+			" AND COALESCE(entity_type, '') NOT IN (?, ?)"
+		args = append(args, filter.UserID, filter.UserID, filter.AccountEmail, EntityDownloadAccount, EntityDownloadSession)
+	} else if filter.UserID > 0 {
+		query += " AND (user_id = ? OR impersonator_id = ?)"
+		args = append(args, filter.UserID, filter.UserID)
 	}
 
 	if filter.Action != "" {
@@ -196,11 +239,23 @@ func (db *Database) GetAuditLogCount(filter *AuditLogFilter) (int, error) {
 		args = append(args, filter.Action)
 	}
 
+	if len(filter.Actions) > 0 {
+		query += " AND action IN (?" + strings.Repeat(", ?", len(filter.Actions)-1) + ")"
+		for _, action := range filter.Actions {
+			args = append(args, action)
+		}
+	}
+
 	if filter.EntityType != "" {
 		query += " AND entity_type = ?"
 		args = append(args, filter.EntityType)
 	}
 
+	if filter.EntityID != "" {
+		query += " AND entity_id = ?"
+		args = append(args, filter.EntityID)
+	}
+
 	if filter.StartDate > 0 {
 		query += " AND timestamp >= ?"
 		args = append(args, filter.StartDate)
@@ -212,9 +267,9 @@ func (db *Database) GetAuditLogCount(filter *AuditLogFilter) (int, error) {
 	}
 
 	if filter.SearchTerm != "" {
-		query += " AND (user_email LIKE ? OR action LIKE ? OR details LIKE ? OR entity_id LIKE ?)"
+		query += " AND (user_email LIKE ? OR impersonator_email LIKE ? OR action LIKE ? OR details LIKE ? OR entity_id LIKE ?)"
 		searchPattern := "%" + filter.SearchTerm + "%"
-		args = append(args, searchPattern, searchPattern, searchPattern, searchPattern)
+		args = append(args, searchPattern, searchPattern, searchPattern, searchPattern, searchPattern)
 	}
 
 	var count int
@@ -371,6 +426,21 @@ const (
 	ActionPasswordChanged     = "PASSWORD_CHANGED"
 	ActionPasswordResetRequested = "PASSWORD_RESET_REQUESTED"
 	ActionPasswordResetCompleted = "PASSWORD_RESET_COMPLETED"
+	ActionAPIKeyCreated       = "API_KEY_CREATED"
+	ActionAPIKeyRevoked       = "API_KEY_REVOKED"
+	ActionLoginLocked         = "LOGIN_LOCKED"
+	ActionLoginUnlocked       = "LOGIN_UNLOCKED"
+	ActionPasskeyRegistered   = "PASSKEY_REGISTERED"
+	ActionPasskeyRenamed      = "PASSKEY_RENAMED"
+	ActionPasskeyRemoved      = "PASSKEY_REMOVED"
+	ActionSessionRevoked      = "SESSION_REVOKED"
+	ActionImpersonationStarted = "IMPERSONATION_STARTED"
+	ActionImpersonationEnded   = "IMPERSONATION_ENDED"
+	ActionImpersonatedRequest  = "IMPERSONATED_REQUEST"
+	ActionSudoGranted         = "SUDO_GRANTED"
+	ActionSudoFailed          = "SUDO_FAILED"
+	ActionNewDeviceLogin      = "NEW_DEVICE_LOGIN"
+	ActionAPIKeyUsed          = "API_KEY_USED"
 
 	// File actions
 	ActionFileUploaded       = "FILE_UPLOADED"
@@ -379,7 +449,11 @@ const (
 	ActionFilePermanentlyDeleted = "FILE_PERMANENTLY_DELETED"
 	ActionFileShared         = "FILE_SHARED"
 	ActionFileDownloaded     = "FILE_DOWNLOADED"
+	ActionFileDownloadRejected = "FILE_DOWNLOAD_REJECTED"
 	ActionFileExpired        = "FILE_EXPIRED"
+	ActionFileIntegrityFailed = "FILE_INTEGRITY_FAILED"
+	ActionFileIntegrityRestored = "FILE_INTEGRITY_RESTORED"
+	ActionFileDestroyed      = "FILE_DESTROYED"
 	ActionEmailSent          = "EMAIL_SENT"
 
 	// Team actions
@@ -392,6 +466,11 @@ const (
 	ActionFileSharedWithTeam = "FILE_SHARED_WITH_TEAM"
 	ActionFileUnsharedFromTeam = "FILE_UNSHARED_FROM_TEAM"
 
+	// Role actions
+	ActionRoleCreated = "ROLE_CREATED"
+	ActionRoleUpdated = "ROLE_UPDATED"
+	ActionRoleDeleted = "ROLE_DELETED"
+
 	// Settings actions
 	ActionSettingsUpdated = "SETTINGS_UPDATED"
 	ActionBrandingUpdated = "BRANDING_UPDATED"
@@ -405,6 +484,11 @@ const (
 	ActionDownloadAccountDeleted   = "DOWNLOAD_ACCOUNT_DELETED"
 	ActionDownloadAccountActivated = "DOWNLOAD_ACCOUNT_ACTIVATED"
 	ActionDownloadAccountDeactivated = "DOWNLOAD_ACCOUNT_DEACTIVATED"
+	ActionDownloadAccountVerificationSent = "DOWNLOAD_ACCOUNT_VERIFICATION_SENT"
+	ActionDownloadAccountEmailVerified = "DOWNLOAD_ACCOUNT_EMAIL_VERIFIED"
+	ActionDownloadMagicLinkRequested = "DOWNLOAD_MAGIC_LINK_REQUESTED"
+	ActionDownloadMagicLinkUsed = "DOWNLOAD_MAGIC_LINK_USED"
+	ActionDownloadAccountDormancyWarned = "DOWNLOAD_ACCOUNT_DORMANCY_WARNED"
 
 	// File request actions
 	ActionFileRequestCreated = "FILE_REQUEST_CREATED"
@@ -416,6 +500,8 @@ const (
 	ActionSystemRestarted = "SYSTEM_RESTARTED"
 	ActionDatabaseBackup = "DATABASE_BACKUP"
 	ActionAuditLogCleanup = "AUDIT_LOG_CLEANUP"
+	ActionDiskSpaceLow = "DISK_SPACE_LOW"
+	ActionDirectorySync = "DIRECTORY_SYNC"
 )
 
 // Entity type constants
@@ -425,7 +511,11 @@ const (
 	EntityTeam            = "Team"
 	EntitySettings        = "Settings"
 	EntityDownloadAccount = "DownloadAccount"
+	EntityDownloadSession = "DownloadSession"
 	EntityFileRequest     = "FileRequest"
 	EntitySession         = "Session"
+	EntityAPIKey          = "ApiKey"
+	EntityPasskey         = "Passkey"
+	EntityRole            = "Role"
 	EntitySystem          = "System"
 )
@@ -230,6 +230,14 @@ func (d *Database) runMigrations() error {
 		}
 	}
 
+	// Migration 10: Record the super admin behind requests made while viewing the app as a user
+	if err := d.addColumnIfNotExists("audit_logs", "impersonator_id", "INTEGER DEFAULT 0"); err != nil {
+		log.Printf("Migration error for audit_logs impersonator_id: %v", err)
+	}
+	if err := d.addColumnIfNotExists("audit_logs", "impersonator_email", "TEXT DEFAULT ''"); err != nil {
+		log.Printf("Migration error for audit_logs impersonator_email: %v", err)
+	}
+
 	return nil
 }
 
@@ -0,0 +1,43 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package database
+
+import "testing"
+
+func TestRecipientAllowed(t *testing.T) {
+	tests := []struct {
+		name       string
+		recipients string // as entered by the uploader
+		email      string
+		want       bool
+	}{
+		{"empty list allows anyone", "", "anyone@example.org", true},
+		{"exact address", "anna@example.com", "anna@example.com", true},
+		{"other address", "anna@example.com", "bert@example.com", false},
+		{"mixed case entry", "Anna@Example.COM", "anna@example.com", true},
+		{"mixed case email", "anna@example.com", " ANNA@example.Com ", true},
+		{"domain entry", "@example.com", "bert@example.com", true},
+		{"bare domain entry", "Example.com", "Bert@EXAMPLE.com", true},
+		{"subdomain not covered by domain", "@example.com", "bert@mail.example.com", false},
+		{"subdomain entry", "@mail.example.com", "bert@mail.example.com", true},
+		{"parent domain not covered by subdomain", "@mail.example.com", "bert@example.com", false},
+		{"lookalike domain", "@example.com", "bert@evilexample.com", false},
+		{"domain as address suffix", "@example.com", "bert@example.com.evil.org", false},
+		{"exact address does not allow its domain", "anna@example.com", "bert@example.com", false},
+		{"address and domain", "anna@example.com, @example.org", "carl@example.org", true},
+		{"empty email", "@example.com", "", false},
+	}
+	for _, tt := range tests {
+		recipients, err := NormalizeAllowedRecipients(tt.recipients)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		file := &FileInfo{AllowedRecipients: recipients}
+		if got := file.RecipientAllowed(tt.email); got != tt.want {
+			t.Errorf("%s: RecipientAllowed(%q) with %q = %v, want %v", tt.name, tt.email, recipients, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package database
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// DestructionCertificate records the secure destruction of a file's content
+type DestructionCertificate struct {
+	Id               string `json:"certificate_id"`
+	FileId           string `json:"file_id"`
+	FileName         string `json:"file_name"`
+	FileSHA1         string `json:"file_sha1"`
+	SizeBytes        int64  `json:"size_bytes"`
+	OwnerId          int    `json:"owner_id"`
+	Method           string `json:"method"`
+	Passes           int    `json:"passes"`
+	BytesOverwritten int64  `json:"bytes_overwritten"`
+	DestroyedAt      int64  `json:"destroyed_at"`
+	DestroyedBy      string `json:"destroyed_by"`
+	Signature        string `json:"signature"`
+}
+
+// SaveDestructionCertificate stores a signed destruction certificate
+func (d *Database) SaveDestructionCertificate(c *DestructionCertificate) error {
+	_, err := d.db.Exec(`
+		INSERT INTO DestructionCertificates (
+			Id, FileId, FileName, FileSHA1, SizeBytes, OwnerId, Method, Passes,
+			BytesOverwritten, DestroyedAt, DestroyedBy, Signature
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		c.Id, c.FileId, c.FileName, c.FileSHA1, c.SizeBytes, c.OwnerId, c.Method, c.Passes,
+		c.BytesOverwritten, c.DestroyedAt, c.DestroyedBy, c.Signature,
+	)
+	return err
+}
+
+// GetDestructionCertificate retrieves a certificate by its ID
+func (d *Database) GetDestructionCertificate(id string) (*DestructionCertificate, error) {
+	c := &DestructionCertificate{}
+	err := d.db.QueryRow(`
+		SELECT Id, FileId, FileName, FileSHA1, SizeBytes, OwnerId, Method, Passes,
+		       BytesOverwritten, DestroyedAt, DestroyedBy, Signature
+		FROM DestructionCertificates WHERE Id = ?`, id).Scan(
+		&c.Id, &c.FileId, &c.FileName, &c.FileSHA1, &c.SizeBytes, &c.OwnerId, &c.Method, &c.Passes,
+		&c.BytesOverwritten, &c.DestroyedAt, &c.DestroyedBy, &c.Signature,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.New("certificate not found")
+		}
+		return nil, err
+	}
+	return c, nil
+}
+
+// GetDestructionCertificates returns the most recent destruction certificates
+func (d *Database) GetDestructionCertificates(limit int) ([]*DestructionCertificate, error) {
+	if limit <= 0 {
+		limit = 500
+	}
+
+	rows, err := d.db.Query(`
+		SELECT Id, FileId, FileName, FileSHA1, SizeBytes, OwnerId, Method, Passes,
+		       BytesOverwritten, DestroyedAt, DestroyedBy, Signature
+		FROM DestructionCertificates ORDER BY DestroyedAt DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var certs []*DestructionCertificate
+	for rows.Next() {
+		c := &DestructionCertificate{}
+		if err := rows.Scan(
+			&c.Id, &c.FileId, &c.FileName, &c.FileSHA1, &c.SizeBytes, &c.OwnerId, &c.Method, &c.Passes,
+			&c.BytesOverwritten, &c.DestroyedAt, &c.DestroyedBy, &c.Signature,
+		); err != nil {
+			return nil, err
+		}
+		certs = append(certs, c)
+	}
+
+	return certs, rows.Err()
+}
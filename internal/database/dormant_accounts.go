@@ -0,0 +1,81 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package database
+
+import "time"
+
+// DormantDownloadAccount is a download account that has not been used for a while,
+// with where it stands in the dormant account lifecycle
+type DormantDownloadAccount struct {
+	Id            int
+	Name          string
+	Email         string
+	IsActive      bool
+	LastActivity  int64 // Latest of creation, last download and admin reactivation
+	WarnedAt      int64 // When the account was last warned, 0 = never
+	DisabledAt    int64 // When the lifecycle policy disabled the account, 0 = not disabled by it
+	DownloadCount int
+}
+
+// Warned reports whether the account was warned since it was last used
+func (a *DormantDownloadAccount) Warned() bool {
+	return a.WarnedAt > a.LastActivity
+}
+
+// GetDormantDownloadAccounts returns the download accounts, excluding deleted ones,
+// that have not been used since the given time, least recently used first
+func (d *Database) GetDormantDownloadAccounts(idleSince time.Time) ([]*DormantDownloadAccount, error) {
+	rows, err := d.db.Query(`
+		SELECT Id, Name, Email, IsActive, DownloadCount, COALESCE(DormancyWarnedAt, 0), COALESCE(DormancyDisabledAt, 0),
+			MAX(CreatedAt, COALESCE(LastUsed, 0), COALESCE(DormancyResetAt, 0)) AS LastActivity
+		FROM DownloadAccounts
+		WHERE (DeletedAt = 0 OR DeletedAt IS NULL) AND LastActivity <= ?
+		ORDER BY LastActivity ASC`, idleSince.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var accounts []*DormantDownloadAccount
+	for rows.Next() {
+		account := &DormantDownloadAccount{}
+		var isActive int
+		if err := rows.Scan(&account.Id, &account.Name, &account.Email, &isActive, &account.DownloadCount,
+			&account.WarnedAt, &account.DisabledAt, &account.LastActivity); err != nil {
+			return nil, err
+		}
+		account.IsActive = isActive == 1
+		accounts = append(accounts, account)
+	}
+	return accounts, rows.Err()
+}
+
+// SetDownloadAccountDormancyWarned records that a dormant download account was warned
+func (d *Database) SetDownloadAccountDormancyWarned(accountId int) error {
+	_, err := d.db.Exec("UPDATE DownloadAccounts SET DormancyWarnedAt = ? WHERE Id = ?", currentTimestamp(), accountId)
+	return err
+}
+
+// DisableDormantDownloadAccount deactivates a download account that has not been
+// used for too long and signs it out everywhere
+func (d *Database) DisableDormantDownloadAccount(accountId int) error {
+	if _, err := d.db.Exec("UPDATE DownloadAccounts SET IsActive = 0, DormancyDisabledAt = ? WHERE Id = ?",
+		currentTimestamp(), accountId); err != nil {
+		return err
+	}
+	_, err := d.DeleteDownloadSessionsByAccount(accountId)
+	return err
+}
+
+// resetDownloadAccountDormancy restarts the idle time of a download account that
+// is being reactivated, so it isn't disabled again on the next lifecycle run
+func (d *Database) resetDownloadAccountDormancy(accountId int) error {
+	_, err := d.db.Exec(`
+		UPDATE DownloadAccounts SET DormancyResetAt = ?, DormancyWarnedAt = 0, DormancyDisabledAt = 0
+		WHERE Id = ? AND IsActive = 0`,
+		currentTimestamp(), accountId)
+	return err
+}
@@ -0,0 +1,97 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package database
+
+import (
+	"time"
+)
+
+// DownloadSession is a signed-in browser of a download account
+type DownloadSession struct {
+	Id         string // secret, also the value of the download_session cookie
+	AccountId  int
+	ValidUntil int64
+	CreatedAt  int64
+	LastSeen   int64
+	IPAddress  string
+	UserAgent  string
+	Device     string // e.g. "Firefox on Windows"
+	AuthMethod string // DownloadAuthPassword or DownloadAuthMagicLink
+}
+
+// How a download session was signed in
+const (
+	DownloadAuthPassword  = "password"
+	DownloadAuthMagicLink = "magic_link"
+)
+
+// CreateDownloadSession stores a new download account session
+func (d *Database) CreateDownloadSession(s *DownloadSession) error {
+	_, err := d.db.Exec(`
+		INSERT INTO DownloadSessions (Id, AccountId, ValidUntil, CreatedAt, LastSeen, IPAddress, UserAgent, Device, AuthMethod)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		s.Id, s.AccountId, s.ValidUntil, s.CreatedAt, s.LastSeen, s.IPAddress, s.UserAgent, s.Device, s.AuthMethod)
+	return err
+}
+
+// GetDownloadSession returns a download account session by its ID
+func (d *Database) GetDownloadSession(sessionId string) (*DownloadSession, error) {
+	s := &DownloadSession{}
+	err := d.db.QueryRow(`
+		SELECT Id, AccountId, ValidUntil, CreatedAt, LastSeen, COALESCE(IPAddress, ''),
+			COALESCE(UserAgent, ''), COALESCE(Device, ''), COALESCE(AuthMethod, 'password')
+		FROM DownloadSessions WHERE Id = ?`, sessionId).Scan(
+		&s.Id, &s.AccountId, &s.ValidUntil, &s.CreatedAt, &s.LastSeen, &s.IPAddress, &s.UserAgent, &s.Device, &s.AuthMethod)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// CountDownloadSessionsByAccount returns the number of unexpired sessions of a download account
+func (d *Database) CountDownloadSessionsByAccount(accountId int) (int, error) {
+	var count int
+	err := d.db.QueryRow("SELECT COUNT(*) FROM DownloadSessions WHERE AccountId = ? AND ValidUntil >= ?",
+		accountId, time.Now().Unix()).Scan(&count)
+	return count, err
+}
+
+// TouchDownloadSession records that a download account session was just used
+func (d *Database) TouchDownloadSession(sessionId string) error {
+	_, err := d.db.Exec("UPDATE DownloadSessions SET LastSeen = ? WHERE Id = ?", time.Now().Unix(), sessionId)
+	return err
+}
+
+// DeleteDownloadSession removes a download account session (logout)
+func (d *Database) DeleteDownloadSession(sessionId string) error {
+	_, err := d.db.Exec("DELETE FROM DownloadSessions WHERE Id = ?", sessionId)
+	return err
+}
+
+// DeleteDownloadSessionsByAccount removes all sessions of a download account
+func (d *Database) DeleteDownloadSessionsByAccount(accountId int) (int64, error) {
+	result, err := d.db.Exec("DELETE FROM DownloadSessions WHERE AccountId = ?", accountId)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// DeleteOtherDownloadSessions removes all sessions of a download account except the given one
+func (d *Database) DeleteOtherDownloadSessions(accountId int, keepSessionId string) (int64, error) {
+	result, err := d.db.Exec("DELETE FROM DownloadSessions WHERE AccountId = ? AND Id != ?", accountId, keepSessionId)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// CleanupExpiredDownloadSessions removes download account sessions that have
+// expired or have not been used since idleBefore (0 keeps idle sessions)
+func (d *Database) CleanupExpiredDownloadSessions(idleBefore int64) error {
+	_, err := d.db.Exec("DELETE FROM DownloadSessions WHERE ValidUntil < ? OR LastSeen < ?", time.Now().Unix(), idleBefore)
+	return err
+}
@@ -60,12 +60,13 @@ func (d *Database) GetDownloadAccountByEmail(email string) (*models.DownloadAcco
 
 	err := d.db.QueryRow(`
 		SELECT Id, Name, Email, Password, CreatedAt, LastUsed, DownloadCount, IsActive,
-		       COALESCE(DeletedAt, 0), COALESCE(DeletedBy, ''), COALESCE(OriginalEmail, '')
+		       COALESCE(DeletedAt, 0), COALESCE(DeletedBy, ''), COALESCE(OriginalEmail, ''),
+		       COALESCE(EmailVerifiedAt, 0)
 		FROM DownloadAccounts
 		WHERE Email = ? AND (DeletedAt = 0 OR DeletedAt IS NULL)`, email).Scan(
 		&account.Id, &account.Name, &account.Email, &account.Password, &account.CreatedAt,
 		&account.LastUsed, &account.DownloadCount, &isActive,
-		&deletedAt, &deletedBy, &originalEmail,
+		&deletedAt, &deletedBy, &originalEmail, &account.EmailVerifiedAt,
 	)
 
 	if err != nil {
@@ -91,11 +92,12 @@ func (d *Database) GetDownloadAccountByID(id int) (*models.DownloadAccount, erro
 
 	err := d.db.QueryRow(`
 		SELECT Id, Name, Email, Password, CreatedAt, LastUsed, DownloadCount, IsActive,
-		       COALESCE(DeletedAt, 0), COALESCE(DeletedBy, ''), COALESCE(OriginalEmail, '')
+		       COALESCE(DeletedAt, 0), COALESCE(DeletedBy, ''), COALESCE(OriginalEmail, ''),
+		       COALESCE(EmailVerifiedAt, 0)
 		FROM DownloadAccounts WHERE Id = ?`, id).Scan(
 		&account.Id, &account.Name, &account.Email, &account.Password, &account.CreatedAt,
 		&account.LastUsed, &account.DownloadCount, &isActive,
-		&deletedAt, &deletedBy, &originalEmail,
+		&deletedAt, &deletedBy, &originalEmail, &account.EmailVerifiedAt,
 	)
 
 	if err != nil {
@@ -117,6 +119,8 @@ func (d *Database) UpdateDownloadAccount(account *models.DownloadAccount) error
 	isActive := 1
 	if !account.IsActive {
 		isActive = 0
+	} else if err := d.resetDownloadAccountDormancy(account.Id); err != nil {
+		return err
 	}
 
 	_, err := d.db.Exec(`
@@ -124,6 +128,10 @@ func (d *Database) UpdateDownloadAccount(account *models.DownloadAccount) error
 		WHERE Id = ?`,
 		account.Email, account.Password, account.LastUsed, account.DownloadCount, isActive, account.Id,
 	)
+	if err == nil && !account.IsActive {
+		// Disabled accounts are signed out everywhere
+		_, err = d.DeleteDownloadSessionsByAccount(account.Id)
+	}
 	return err
 }
 
@@ -138,6 +146,12 @@ func (d *Database) UpdateDownloadAccountLastUsed(id int) error {
 	return err
 }
 
+// TouchDownloadAccount records that a download account signed in, without counting a download
+func (d *Database) TouchDownloadAccount(id int) error {
+	_, err := d.db.Exec("UPDATE DownloadAccounts SET LastUsed = ? WHERE Id = ?", time.Now().Unix(), id)
+	return err
+}
+
 // GetAllDownloadAccounts returns all download accounts (excluding soft-deleted)
 func (d *Database) GetAllDownloadAccounts() ([]*models.DownloadAccount, error) {
 	rows, err := d.db.Query(`
@@ -305,10 +319,10 @@ func (d *Database) CreateDownloadLog(log *models.DownloadLog) error {
 
 	result, err := d.db.Exec(`
 		INSERT INTO DownloadLogs (FileId, DownloadAccountId, Email, IpAddress, UserAgent,
-		                          DownloadedAt, FileSize, FileName, IsAuthenticated)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		                          DownloadedAt, FileSize, FileName, IsAuthenticated, EmailVerifiedAt)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		log.FileId, downloadAccountId, log.Email, log.IpAddress, log.UserAgent,
-		log.DownloadedAt, log.FileSize, log.FileName, isAuth,
+		log.DownloadedAt, log.FileSize, log.FileName, isAuth, log.EmailVerifiedAt,
 	)
 	if err != nil {
 		return err
@@ -326,7 +340,7 @@ func (d *Database) CreateDownloadLog(log *models.DownloadLog) error {
 func (d *Database) GetDownloadLogsByFileID(fileId string) ([]*models.DownloadLog, error) {
 	rows, err := d.db.Query(`
 		SELECT Id, FileId, DownloadAccountId, Email, IpAddress, UserAgent,
-		       DownloadedAt, FileSize, FileName, IsAuthenticated
+		       DownloadedAt, FileSize, FileName, IsAuthenticated, COALESCE(EmailVerifiedAt, 0)
 		FROM DownloadLogs WHERE FileId = ? ORDER BY DownloadedAt DESC`, fileId)
 	if err != nil {
 		return nil, err
@@ -340,7 +354,7 @@ func (d *Database) GetDownloadLogsByFileID(fileId string) ([]*models.DownloadLog
 func (d *Database) GetDownloadLogsByAccountID(accountId int) ([]*models.DownloadLog, error) {
 	rows, err := d.db.Query(`
 		SELECT Id, FileId, DownloadAccountId, Email, IpAddress, UserAgent,
-		       DownloadedAt, FileSize, FileName, IsAuthenticated
+		       DownloadedAt, FileSize, FileName, IsAuthenticated, COALESCE(EmailVerifiedAt, 0)
 		FROM DownloadLogs WHERE DownloadAccountId = ? ORDER BY DownloadedAt DESC`, accountId)
 	if err != nil {
 		return nil, err
@@ -357,7 +371,8 @@ func (d *Database) GetAccessibleFilesByDownloadAccount(accountId int) ([]*FileIn
 		SELECT DISTINCT f.Id, f.Name, f.Size, f.SizeBytes, f.ContentType,
 		       f.UploadDate, f.ExpireAt, f.UnlimitedTime, f.DownloadCount,
 		       f.DownloadsRemaining, f.UnlimitedDownloads, f.RequireAuth,
-		       f.FilePasswordPlain, f.UserId, f.Comment, f.DeletedAt, f.DeletedBy
+		       COALESCE(f.PasswordHash, ''), f.UserId, f.Comment, f.DeletedAt, f.DeletedBy,
+		       COALESCE(f.AllowMagicLink, 1)
 		FROM Files f
 		INNER JOIN DownloadLogs dl ON f.Id = dl.FileId
 		WHERE dl.DownloadAccountId = ?
@@ -378,22 +393,20 @@ func (d *Database) GetAccessibleFilesByDownloadAccount(accountId int) ([]*FileIn
 		var requireAuth int
 		var unlimitedTime int
 		var unlimitedDownloads int
-		var filePassword sql.NullString
+		var allowMagicLink int
 		var comment sql.NullString
 
 		err := rows.Scan(
 			&f.Id, &f.Name, &f.Size, &f.SizeBytes, &f.ContentType,
 			&f.UploadDate, &f.ExpireAt, &unlimitedTime, &f.DownloadCount,
 			&f.DownloadsRemaining, &unlimitedDownloads, &requireAuth,
-			&filePassword, &f.UserId, &comment, &f.DeletedAt, &f.DeletedBy,
+			&f.PasswordHash, &f.UserId, &comment, &f.DeletedAt, &f.DeletedBy,
+			&allowMagicLink,
 		)
 		if err != nil {
 			return nil, err
 		}
 
-		if filePassword.Valid {
-			f.FilePasswordPlain = filePassword.String
-		}
 		if comment.Valid {
 			f.Comment = comment.String
 		}
@@ -401,6 +414,7 @@ func (d *Database) GetAccessibleFilesByDownloadAccount(accountId int) ([]*FileIn
 		f.RequireAuth = requireAuth == 1
 		f.UnlimitedTime = unlimitedTime == 1
 		f.UnlimitedDownloads = unlimitedDownloads == 1
+		f.AllowMagicLink = allowMagicLink == 1
 
 		files = append(files, f)
 	}
@@ -412,7 +426,7 @@ func (d *Database) GetAccessibleFilesByDownloadAccount(accountId int) ([]*FileIn
 func (d *Database) GetAllDownloadLogs(limit int) ([]*models.DownloadLog, error) {
 	query := `
 		SELECT Id, FileId, DownloadAccountId, Email, IpAddress, UserAgent,
-		       DownloadedAt, FileSize, FileName, IsAuthenticated
+		       DownloadedAt, FileSize, FileName, IsAuthenticated, COALESCE(EmailVerifiedAt, 0)
 		FROM DownloadLogs ORDER BY DownloadedAt DESC`
 
 	if limit > 0 {
@@ -443,7 +457,7 @@ func scanDownloadLogs(rows *sql.Rows) ([]*models.DownloadLog, error) {
 		var isAuth int
 
 		err := rows.Scan(&log.Id, &log.FileId, &accountId, &log.Email, &log.IpAddress,
-			&log.UserAgent, &log.DownloadedAt, &log.FileSize, &log.FileName, &isAuth)
+			&log.UserAgent, &log.DownloadedAt, &log.FileSize, &log.FileName, &isAuth, &log.EmailVerifiedAt)
 		if err != nil {
 			return nil, err
 		}
@@ -491,6 +505,10 @@ func (d *Database) DeleteDownloadAccount(id int) error {
 		return err
 	}
 
+	if _, err := d.DeleteDownloadSessionsByAccount(id); err != nil {
+		return err
+	}
+
 	// Then delete the account
 	_, err = d.db.Exec("DELETE FROM DownloadAccounts WHERE Id = ?", id)
 	return err
@@ -0,0 +1,140 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package database
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+const (
+	// VerificationDuration is how long an email verification code and link stay valid
+	VerificationDuration = 30 * time.Minute
+	// MaxVerificationAttempts is how many wrong codes are accepted before a new code is needed
+	MaxVerificationAttempts = 5
+)
+
+// Errors returned when checking an email verification
+var (
+	ErrVerificationNotFound = errors.New("no pending verification")
+	ErrVerificationExpired  = errors.New("verification expired")
+	ErrVerificationInvalid  = errors.New("incorrect verification code")
+	ErrVerificationLocked   = errors.New("too many incorrect verification codes")
+)
+
+// hashVerificationSecret hashes a verification code. Codes are short, so they
+// are bound to their account.
+func hashVerificationSecret(accountId int, secret string) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d:%s", accountId, secret)))
+	return hex.EncodeToString(sum[:])
+}
+
+// hashVerificationToken hashes a link token, which is looked up without knowing the account
+func hashVerificationToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateDownloadAccountVerification replaces any pending verification of a
+// download account with a new one and returns its 6-digit code and link token.
+// fileId is the file the account wanted to download, so the link can return to it.
+func (d *Database) CreateDownloadAccountVerification(accountId int, fileId string) (code, token string, err error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", "", err
+	}
+	code = fmt.Sprintf("%06d", n.Int64())
+
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return "", "", err
+	}
+	token = hex.EncodeToString(tokenBytes)
+
+	now := time.Now()
+	if _, err := d.db.Exec("DELETE FROM DownloadAccountVerifications WHERE AccountId = ?", accountId); err != nil {
+		return "", "", err
+	}
+	_, err = d.db.Exec(`
+		INSERT INTO DownloadAccountVerifications (AccountId, FileId, CodeHash, TokenHash, ExpiresAt, CreatedAt)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		accountId, fileId, hashVerificationSecret(accountId, code), hashVerificationToken(token),
+		now.Add(VerificationDuration).Unix(), now.Unix())
+	if err != nil {
+		return "", "", err
+	}
+	return code, token, nil
+}
+
+// CheckDownloadAccountCode checks a verification code entered by a download
+// account. A correct code marks the email address as verified.
+func (d *Database) CheckDownloadAccountCode(accountId int, code string) error {
+	var id, attempts int
+	var codeHash string
+	var expiresAt int64
+	err := d.db.QueryRow(`
+		SELECT Id, CodeHash, Attempts, ExpiresAt FROM DownloadAccountVerifications WHERE AccountId = ?`,
+		accountId).Scan(&id, &codeHash, &attempts, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrVerificationNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if time.Now().Unix() > expiresAt {
+		return ErrVerificationExpired
+	}
+	if attempts >= MaxVerificationAttempts {
+		return ErrVerificationLocked
+	}
+
+	if hashVerificationSecret(accountId, code) != codeHash {
+		d.db.Exec("UPDATE DownloadAccountVerifications SET Attempts = Attempts + 1 WHERE Id = ?", id)
+		return ErrVerificationInvalid
+	}
+	return d.MarkDownloadAccountEmailVerified(accountId)
+}
+
+// CheckDownloadAccountToken checks a verification link. It marks the email
+// address of the account as verified and returns the account and file IDs.
+func (d *Database) CheckDownloadAccountToken(token string) (accountId int, fileId string, err error) {
+	var expiresAt int64
+	err = d.db.QueryRow(`
+		SELECT AccountId, FileId, ExpiresAt FROM DownloadAccountVerifications WHERE TokenHash = ?`,
+		hashVerificationToken(token)).Scan(&accountId, &fileId, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, "", ErrVerificationNotFound
+	}
+	if err != nil {
+		return 0, "", err
+	}
+	if time.Now().Unix() > expiresAt {
+		return 0, "", ErrVerificationExpired
+	}
+	return accountId, fileId, d.MarkDownloadAccountEmailVerified(accountId)
+}
+
+// MarkDownloadAccountEmailVerified records that the owner of a download account
+// has proven access to its email address, and removes pending verifications
+func (d *Database) MarkDownloadAccountEmailVerified(accountId int) error {
+	if _, err := d.db.Exec("UPDATE DownloadAccounts SET EmailVerifiedAt = ? WHERE Id = ?", time.Now().Unix(), accountId); err != nil {
+		return err
+	}
+	_, err := d.db.Exec("DELETE FROM DownloadAccountVerifications WHERE AccountId = ?", accountId)
+	return err
+}
+
+// CleanupExpiredVerifications removes verifications that can no longer be used
+func (d *Database) CleanupExpiredVerifications() error {
+	_, err := d.db.Exec("DELETE FROM DownloadAccountVerifications WHERE ExpiresAt < ?", time.Now().Unix())
+	return err
+}
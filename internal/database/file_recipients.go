@@ -0,0 +1,103 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package database
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+)
+
+// NormalizeAllowedRecipients parses a list of recipient email addresses and
+// domains separated by commas, semicolons or whitespace. Domains are written as
+// "example.com" or "@example.com". It returns the entries lowercased, without
+// duplicates, joined by commas; "" means anyone may download.
+func NormalizeAllowedRecipients(input string) (string, error) {
+	fields := strings.FieldsFunc(input, func(r rune) bool {
+		return r == ',' || r == ';' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+	})
+
+	seen := make(map[string]bool)
+	var entries []string
+	for _, field := range fields {
+		entry := strings.ToLower(strings.TrimSpace(field))
+		if entry == "" {
+			continue
+		}
+
+		if strings.HasPrefix(entry, "@") || !strings.Contains(entry, "@") {
+			domain := strings.TrimPrefix(entry, "@")
+			if !validRecipientDomain(domain) {
+				return "", fmt.Errorf("invalid recipient domain: %s", field)
+			}
+			entry = "@" + domain
+		} else {
+			addr, err := mail.ParseAddress(entry)
+			if err != nil || addr.Address != entry || !validRecipientDomain(entry[strings.LastIndex(entry, "@")+1:]) {
+				return "", fmt.Errorf("invalid recipient email: %s", field)
+			}
+		}
+
+		if !seen[entry] {
+			seen[entry] = true
+			entries = append(entries, entry)
+		}
+	}
+	return strings.Join(entries, ","), nil
+}
+
+// validRecipientDomain reports whether s looks like a domain name
+func validRecipientDomain(s string) bool {
+	if !strings.Contains(s, ".") || strings.HasPrefix(s, ".") || strings.HasSuffix(s, ".") {
+		return false
+	}
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// RecipientList returns the allowed recipients of the file, or nil if anyone may download it
+func (f *FileInfo) RecipientList() []string {
+	if f.AllowedRecipients == "" {
+		return nil
+	}
+	return strings.Split(f.AllowedRecipients, ",")
+}
+
+// RecipientAllowed reports whether the given email address may download the file
+func (f *FileInfo) RecipientAllowed(email string) bool {
+	if f.AllowedRecipients == "" {
+		return true
+	}
+
+	email = strings.ToLower(strings.TrimSpace(email))
+	for _, entry := range f.RecipientList() {
+		if strings.HasPrefix(entry, "@") {
+			if strings.HasSuffix(email, entry) {
+				return true
+			}
+		} else if email == entry {
+			return true
+		}
+	}
+	return false
+}
+
+// UpdateFileRecipients sets the recipients allowed to download a file (as returned
+// by NormalizeAllowedRecipients) and whether the owner is emailed about others
+func (d *Database) UpdateFileRecipients(fileId, allowedRecipients string, notifyOwner bool) error {
+	notifyInt := 0
+	if notifyOwner {
+		notifyInt = 1
+	}
+
+	_, err := d.db.Exec("UPDATE Files SET AllowedRecipients = ?, NotifyRejectedRecipients = ? WHERE Id = ?",
+		allowedRecipients, notifyInt, fileId)
+	return err
+}
@@ -14,6 +14,8 @@ import (
 	"io"
 	"os"
 	"time"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
 // FileInfo represents a file in the database
@@ -22,8 +24,7 @@ type FileInfo struct {
 	Name               string
 	Size               string
 	SHA1               string
-	PasswordHash       string
-	FilePasswordPlain  string
+	PasswordHash       string `json:"-"` // bcrypt hash of the file password, "" = none
 	HotlinkId          string
 	ContentType        string
 	AwsBucket          string
@@ -41,8 +42,30 @@ type FileInfo struct {
 	RequireAuth        bool
 	DeletedAt          int64
 	DeletedBy          int
+	LastVerifiedAt     int64  // Unix timestamp of last integrity check, 0 = never verified
+	IntegrityStatus    string // "", "ok", "mismatch" or "missing"
+	Compression        string // "" = stored as-is, "gzip" = compressed at rest
+	StoredSizeBytes    int64  // Physical size on disk, 0 = same as SizeBytes
+	AllowMagicLink     bool   // Whether an emailed sign-in link alone satisfies RequireAuth
+	AllowedRecipients  string // Comma-separated emails and @domains that may download, "" = anyone
+	NotifyRejections   bool   // Email the owner when someone else tries to download
+}
+
+// PhysicalSize returns the number of bytes the file occupies on disk
+func (f *FileInfo) PhysicalSize() int64 {
+	if f.StoredSizeBytes > 0 {
+		return f.StoredSizeBytes
+	}
+	return f.SizeBytes
 }
 
+// Integrity status values recorded by the background scrubber
+const (
+	IntegrityStatusOK       = "ok"
+	IntegrityStatusMismatch = "mismatch"
+	IntegrityStatusMissing  = "missing"
+)
+
 // SaveFile saves file metadata to the database
 func (d *Database) SaveFile(file *FileInfo) error {
 	unlimitedDownloads := 0
@@ -57,26 +80,29 @@ func (d *Database) SaveFile(file *FileInfo) error {
 	if file.RequireAuth {
 		requireAuth = 1
 	}
-
-	// Convert empty password to NULL for database storage
-	var filePassword interface{}
-	if file.FilePasswordPlain == "" {
-		filePassword = nil
-	} else {
-		filePassword = file.FilePasswordPlain
+	allowMagicLink := 0
+	if file.AllowMagicLink {
+		allowMagicLink = 1
+	}
+	notifyRejected := 0
+	if file.NotifyRejections {
+		notifyRejected = 1
 	}
 
 	_, err := d.db.Exec(`
 		INSERT INTO Files (
-			Id, Name, Size, SHA1, PasswordHash, FilePasswordPlain, HotlinkId, ContentType,
+			Id, Name, Size, SHA1, PasswordHash, HotlinkId, ContentType,
 			AwsBucket, ExpireAtString, ExpireAt, PendingDeletion, SizeBytes,
 			UploadDate, DownloadsRemaining, DownloadCount, UserId, Comment,
-			UnlimitedDownloads, UnlimitedTime, RequireAuth
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		file.Id, file.Name, file.Size, file.SHA1, file.PasswordHash, filePassword, file.HotlinkId,
+			UnlimitedDownloads, UnlimitedTime, RequireAuth, Compression, StoredSizeBytes, AllowMagicLink,
+			AllowedRecipients, NotifyRejectedRecipients
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		file.Id, file.Name, file.Size, file.SHA1, file.PasswordHash, file.HotlinkId,
 		file.ContentType, file.AwsBucket, file.ExpireAtString, file.ExpireAt,
 		file.PendingDeletion, file.SizeBytes, file.UploadDate, file.DownloadsRemaining,
 		file.DownloadCount, file.UserId, file.Comment, unlimitedDownloads, unlimitedTime, requireAuth,
+		file.Compression, file.StoredSizeBytes, allowMagicLink,
+		file.AllowedRecipients, notifyRejected,
 	)
 	return err
 }
@@ -84,21 +110,25 @@ func (d *Database) SaveFile(file *FileInfo) error {
 // GetFileByID retrieves a file by its ID (only non-deleted files)
 func (d *Database) GetFileByID(id string) (*FileInfo, error) {
 	file := &FileInfo{}
-	var unlimitedDownloads, unlimitedTime, requireAuth int
-	var filePassword sql.NullString
+	var unlimitedDownloads, unlimitedTime, requireAuth, allowMagicLink, notifyRejected int
 	var comment sql.NullString
 
 	err := d.db.QueryRow(`
-		SELECT Id, Name, Size, SHA1, PasswordHash, FilePasswordPlain, HotlinkId, ContentType,
+		SELECT Id, Name, Size, SHA1, PasswordHash, HotlinkId, ContentType,
 		       AwsBucket, ExpireAtString, ExpireAt, PendingDeletion, SizeBytes,
 		       UploadDate, DownloadsRemaining, DownloadCount, UserId, Comment,
-		       UnlimitedDownloads, UnlimitedTime, RequireAuth, DeletedAt, DeletedBy
+		       UnlimitedDownloads, UnlimitedTime, RequireAuth, DeletedAt, DeletedBy,
+		       COALESCE(LastVerifiedAt, 0), COALESCE(IntegrityStatus, ''),
+		       COALESCE(Compression, ''), COALESCE(StoredSizeBytes, 0), COALESCE(AllowMagicLink, 1),
+		       COALESCE(AllowedRecipients, ''), COALESCE(NotifyRejectedRecipients, 0)
 		FROM Files WHERE Id = ? AND DeletedAt = 0`, id).Scan(
-		&file.Id, &file.Name, &file.Size, &file.SHA1, &file.PasswordHash, &filePassword,
+		&file.Id, &file.Name, &file.Size, &file.SHA1, &file.PasswordHash,
 		&file.HotlinkId, &file.ContentType, &file.AwsBucket, &file.ExpireAtString,
 		&file.ExpireAt, &file.PendingDeletion, &file.SizeBytes, &file.UploadDate,
 		&file.DownloadsRemaining, &file.DownloadCount, &file.UserId, &comment,
 		&unlimitedDownloads, &unlimitedTime, &requireAuth, &file.DeletedAt, &file.DeletedBy,
+		&file.LastVerifiedAt, &file.IntegrityStatus, &file.Compression, &file.StoredSizeBytes, &allowMagicLink,
+		&file.AllowedRecipients, &notifyRejected,
 	)
 
 	if err != nil {
@@ -108,11 +138,6 @@ func (d *Database) GetFileByID(id string) (*FileInfo, error) {
 		return nil, err
 	}
 
-	// Handle NULL password
-	if filePassword.Valid {
-		file.FilePasswordPlain = filePassword.String
-	}
-
 	// Handle NULL comment
 	if comment.Valid {
 		file.Comment = comment.String
@@ -121,6 +146,8 @@ func (d *Database) GetFileByID(id string) (*FileInfo, error) {
 	file.UnlimitedDownloads = unlimitedDownloads == 1
 	file.UnlimitedTime = unlimitedTime == 1
 	file.RequireAuth = requireAuth == 1
+	file.AllowMagicLink = allowMagicLink == 1
+	file.NotifyRejections = notifyRejected == 1
 
 	return file, nil
 }
@@ -128,10 +155,13 @@ func (d *Database) GetFileByID(id string) (*FileInfo, error) {
 // GetFilesByUser returns all non-deleted files for a user
 func (d *Database) GetFilesByUser(userId int) ([]*FileInfo, error) {
 	rows, err := d.db.Query(`
-		SELECT Id, Name, Size, SHA1, PasswordHash, FilePasswordPlain, HotlinkId, ContentType,
+		SELECT Id, Name, Size, SHA1, PasswordHash, HotlinkId, ContentType,
 		       AwsBucket, ExpireAtString, ExpireAt, PendingDeletion, SizeBytes,
 		       UploadDate, DownloadsRemaining, DownloadCount, UserId, Comment,
-		       UnlimitedDownloads, UnlimitedTime, RequireAuth, DeletedAt, DeletedBy
+		       UnlimitedDownloads, UnlimitedTime, RequireAuth, DeletedAt, DeletedBy,
+		       COALESCE(LastVerifiedAt, 0), COALESCE(IntegrityStatus, ''),
+		       COALESCE(Compression, ''), COALESCE(StoredSizeBytes, 0), COALESCE(AllowMagicLink, 1),
+		       COALESCE(AllowedRecipients, ''), COALESCE(NotifyRejectedRecipients, 0)
 		FROM Files WHERE UserId = ? AND DeletedAt = 0 ORDER BY UploadDate DESC`, userId)
 	if err != nil {
 		return nil, err
@@ -144,10 +174,13 @@ func (d *Database) GetFilesByUser(userId int) ([]*FileInfo, error) {
 // GetAllFiles returns all non-deleted files
 func (d *Database) GetAllFiles() ([]*FileInfo, error) {
 	rows, err := d.db.Query(`
-		SELECT Id, Name, Size, SHA1, PasswordHash, FilePasswordPlain, HotlinkId, ContentType,
+		SELECT Id, Name, Size, SHA1, PasswordHash, HotlinkId, ContentType,
 		       AwsBucket, ExpireAtString, ExpireAt, PendingDeletion, SizeBytes,
 		       UploadDate, DownloadsRemaining, DownloadCount, UserId, Comment,
-		       UnlimitedDownloads, UnlimitedTime, RequireAuth, DeletedAt, DeletedBy
+		       UnlimitedDownloads, UnlimitedTime, RequireAuth, DeletedAt, DeletedBy,
+		       COALESCE(LastVerifiedAt, 0), COALESCE(IntegrityStatus, ''),
+		       COALESCE(Compression, ''), COALESCE(StoredSizeBytes, 0), COALESCE(AllowMagicLink, 1),
+		       COALESCE(AllowedRecipients, ''), COALESCE(NotifyRejectedRecipients, 0)
 		FROM Files WHERE DeletedAt = 0 ORDER BY UploadDate DESC`)
 	if err != nil {
 		return nil, err
@@ -193,20 +226,37 @@ func (d *Database) UpdateFileSettings(fileId string, downloadsRemaining int, exp
 	return err
 }
 
-// UpdateFilePassword updates a file's password
+// UpdateFilePassword sets a file's password, or removes it if password is empty.
+// Only a bcrypt hash is stored. Password grants are bound to the hash, so
+// changing the password invalidates all outstanding grants.
 func (d *Database) UpdateFilePassword(fileId string, password string) error {
-	// Convert empty password to NULL for database storage
-	var filePassword interface{}
-	if password == "" {
-		filePassword = nil
-	} else {
-		filePassword = password
+	passwordHash, err := HashFilePassword(password)
+	if err != nil {
+		return err
 	}
 
-	_, err := d.db.Exec("UPDATE Files SET FilePasswordPlain = ? WHERE Id = ?", filePassword, fileId)
+	_, err = d.db.Exec("UPDATE Files SET PasswordHash = ?, FilePasswordPlain = NULL WHERE Id = ?", passwordHash, fileId)
 	return err
 }
 
+// HashFilePassword returns the bcrypt hash of a file password, or "" if it is empty
+func HashFilePassword(password string) (string, error) {
+	if password == "" {
+		return "", nil
+	}
+	// Same cost as account passwords (auth.BcryptCost)
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), 12)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// HasPassword reports whether the file is password protected
+func (f *FileInfo) HasPassword() bool {
+	return f.PasswordHash != ""
+}
+
 // UpdateFileComment updates a file's comment/description
 func (d *Database) UpdateFileComment(fileId string, comment string) error {
 	// Convert empty comment to NULL for database storage
@@ -232,6 +282,18 @@ func (d *Database) UpdateFileRequireAuth(fileId string, requireAuth bool) error
 	return err
 }
 
+// UpdateFileAllowMagicLink sets whether an emailed sign-in link alone is enough
+// to download a file that requires authentication
+func (d *Database) UpdateFileAllowMagicLink(fileId string, allow bool) error {
+	allowInt := 0
+	if allow {
+		allowInt = 1
+	}
+
+	_, err := d.db.Exec("UPDATE Files SET AllowMagicLink = ? WHERE Id = ?", allowInt, fileId)
+	return err
+}
+
 // DeleteFile soft-deletes a file (moves to trash for 5 days)
 func (d *Database) DeleteFile(fileId string, userId int) error {
 	now := time.Now().Unix()
@@ -263,10 +325,13 @@ func (d *Database) PermanentDeleteFile(fileId string) error {
 // GetDeletedFiles returns all files in trash (admin only)
 func (d *Database) GetDeletedFiles() ([]*FileInfo, error) {
 	rows, err := d.db.Query(`
-		SELECT Id, Name, Size, SHA1, PasswordHash, FilePasswordPlain, HotlinkId, ContentType,
+		SELECT Id, Name, Size, SHA1, PasswordHash, HotlinkId, ContentType,
 		       AwsBucket, ExpireAtString, ExpireAt, PendingDeletion, SizeBytes,
 		       UploadDate, DownloadsRemaining, DownloadCount, UserId, Comment,
-		       UnlimitedDownloads, UnlimitedTime, RequireAuth, DeletedAt, DeletedBy
+		       UnlimitedDownloads, UnlimitedTime, RequireAuth, DeletedAt, DeletedBy,
+		       COALESCE(LastVerifiedAt, 0), COALESCE(IntegrityStatus, ''),
+		       COALESCE(Compression, ''), COALESCE(StoredSizeBytes, 0), COALESCE(AllowMagicLink, 1),
+		       COALESCE(AllowedRecipients, ''), COALESCE(NotifyRejectedRecipients, 0)
 		FROM Files WHERE DeletedAt > 0 ORDER BY DeletedAt DESC`)
 	if err != nil {
 		return nil, err
@@ -284,10 +349,13 @@ func (d *Database) GetOldDeletedFiles(retentionDays int) ([]*FileInfo, error) {
 	cutoffTime := time.Now().Add(-time.Duration(retentionDays) * 24 * time.Hour).Unix()
 
 	rows, err := d.db.Query(`
-		SELECT Id, Name, Size, SHA1, PasswordHash, FilePasswordPlain, HotlinkId, ContentType,
+		SELECT Id, Name, Size, SHA1, PasswordHash, HotlinkId, ContentType,
 		       AwsBucket, ExpireAtString, ExpireAt, PendingDeletion, SizeBytes,
 		       UploadDate, DownloadsRemaining, DownloadCount, UserId, Comment,
-		       UnlimitedDownloads, UnlimitedTime, RequireAuth, DeletedAt, DeletedBy
+		       UnlimitedDownloads, UnlimitedTime, RequireAuth, DeletedAt, DeletedBy,
+		       COALESCE(LastVerifiedAt, 0), COALESCE(IntegrityStatus, ''),
+		       COALESCE(Compression, ''), COALESCE(StoredSizeBytes, 0), COALESCE(AllowMagicLink, 1),
+		       COALESCE(AllowedRecipients, ''), COALESCE(NotifyRejectedRecipients, 0)
 		FROM Files WHERE DeletedAt > 0 AND DeletedAt < ?`, cutoffTime)
 	if err != nil {
 		return nil, err
@@ -308,10 +376,13 @@ func (d *Database) GetExpiredFiles() ([]*FileInfo, error) {
 	now := time.Now().Unix()
 
 	rows, err := d.db.Query(`
-		SELECT Id, Name, Size, SHA1, PasswordHash, FilePasswordPlain, HotlinkId, ContentType,
+		SELECT Id, Name, Size, SHA1, PasswordHash, HotlinkId, ContentType,
 		       AwsBucket, ExpireAtString, ExpireAt, PendingDeletion, SizeBytes,
 		       UploadDate, DownloadsRemaining, DownloadCount, UserId, Comment,
-		       UnlimitedDownloads, UnlimitedTime, RequireAuth, DeletedAt, DeletedBy
+		       UnlimitedDownloads, UnlimitedTime, RequireAuth, DeletedAt, DeletedBy,
+		       COALESCE(LastVerifiedAt, 0), COALESCE(IntegrityStatus, ''),
+		       COALESCE(Compression, ''), COALESCE(StoredSizeBytes, 0), COALESCE(AllowMagicLink, 1),
+		       COALESCE(AllowedRecipients, ''), COALESCE(NotifyRejectedRecipients, 0)
 		FROM Files
 		WHERE DeletedAt = 0 AND ((ExpireAt > 0 AND ExpireAt < ? AND UnlimitedTime = 0)
 		   OR (DownloadsRemaining <= 0 AND UnlimitedDownloads = 0))`, now)
@@ -362,6 +433,40 @@ func (d *Database) GetActiveFiles() (int, error) {
 	return count, err
 }
 
+// GetFilesDueForVerification returns non-deleted files with a known SHA1 whose last
+// integrity check is older than verifiedBefore, least recently verified first
+func (d *Database) GetFilesDueForVerification(verifiedBefore int64, limit int) ([]*FileInfo, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+
+	rows, err := d.db.Query(`
+		SELECT Id, Name, Size, SHA1, PasswordHash, HotlinkId, ContentType,
+		       AwsBucket, ExpireAtString, ExpireAt, PendingDeletion, SizeBytes,
+		       UploadDate, DownloadsRemaining, DownloadCount, UserId, Comment,
+		       UnlimitedDownloads, UnlimitedTime, RequireAuth, DeletedAt, DeletedBy,
+		       COALESCE(LastVerifiedAt, 0), COALESCE(IntegrityStatus, ''),
+		       COALESCE(Compression, ''), COALESCE(StoredSizeBytes, 0), COALESCE(AllowMagicLink, 1),
+		       COALESCE(AllowedRecipients, ''), COALESCE(NotifyRejectedRecipients, 0)
+		FROM Files
+		WHERE DeletedAt = 0 AND SHA1 != '' AND COALESCE(LastVerifiedAt, 0) < ?
+		ORDER BY COALESCE(LastVerifiedAt, 0) ASC, UploadDate ASC
+		LIMIT ?`, verifiedBefore, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanFiles(rows)
+}
+
+// UpdateFileIntegrity records the result of an integrity check for a file
+func (d *Database) UpdateFileIntegrity(fileId string, status string, verifiedAt int64) error {
+	_, err := d.db.Exec("UPDATE Files SET IntegrityStatus = ?, LastVerifiedAt = ? WHERE Id = ?",
+		status, verifiedAt, fileId)
+	return err
+}
+
 // CalculateFileSHA1 calculates SHA1 hash of a file
 func CalculateFileSHA1(filePath string) (string, error) {
 	file, err := os.Open(filePath)
@@ -400,25 +505,22 @@ func scanFiles(rows *sql.Rows) ([]*FileInfo, error) {
 
 	for rows.Next() {
 		file := &FileInfo{}
-		var unlimitedDownloads, unlimitedTime, requireAuth int
-		var filePassword, comment sql.NullString
+		var unlimitedDownloads, unlimitedTime, requireAuth, allowMagicLink, notifyRejected int
+		var comment sql.NullString
 
 		err := rows.Scan(
-			&file.Id, &file.Name, &file.Size, &file.SHA1, &file.PasswordHash, &filePassword,
+			&file.Id, &file.Name, &file.Size, &file.SHA1, &file.PasswordHash,
 			&file.HotlinkId, &file.ContentType, &file.AwsBucket, &file.ExpireAtString,
 			&file.ExpireAt, &file.PendingDeletion, &file.SizeBytes, &file.UploadDate,
 			&file.DownloadsRemaining, &file.DownloadCount, &file.UserId, &comment,
 			&unlimitedDownloads, &unlimitedTime, &requireAuth, &file.DeletedAt, &file.DeletedBy,
+			&file.LastVerifiedAt, &file.IntegrityStatus, &file.Compression, &file.StoredSizeBytes, &allowMagicLink,
+			&file.AllowedRecipients, &notifyRejected,
 		)
 		if err != nil {
 			return nil, err
 		}
 
-		// Handle NULL password
-		if filePassword.Valid {
-			file.FilePasswordPlain = filePassword.String
-		}
-
 		// Handle NULL comment
 		if comment.Valid {
 			file.Comment = comment.String
@@ -427,6 +529,8 @@ func scanFiles(rows *sql.Rows) ([]*FileInfo, error) {
 		file.UnlimitedDownloads = unlimitedDownloads == 1
 		file.UnlimitedTime = unlimitedTime == 1
 		file.RequireAuth = requireAuth == 1
+		file.AllowMagicLink = allowMagicLink == 1
+		file.NotifyRejections = notifyRejected == 1
 
 		files = append(files, file)
 	}
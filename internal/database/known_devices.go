@@ -0,0 +1,53 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package database
+
+// KnownDevice is a device a user has signed in from. Devices are identified by a
+// fingerprint of the browser, platform and IP range.
+type KnownDevice struct {
+	UserId      int
+	Fingerprint string
+	Device      string
+	IPRange     string
+	Country     string // ISO country code, "" if unknown
+	FirstSeen   int64
+	LastSeen    int64
+}
+
+// CountKnownDevices returns how many devices a user has signed in from
+func (d *Database) CountKnownDevices(userId int) (int, error) {
+	var count int
+	err := d.db.QueryRow("SELECT COUNT(*) FROM KnownDevices WHERE UserId = ?", userId).Scan(&count)
+	return count, err
+}
+
+// IsKnownDevice reports whether a user has signed in from a device before
+func (d *Database) IsKnownDevice(userId int, fingerprint string) (bool, error) {
+	var count int
+	err := d.db.QueryRow("SELECT COUNT(*) FROM KnownDevices WHERE UserId = ? AND Fingerprint = ?",
+		userId, fingerprint).Scan(&count)
+	return count > 0, err
+}
+
+// IsKnownCountry reports whether a user has signed in from a country before
+func (d *Database) IsKnownCountry(userId int, country string) (bool, error) {
+	var count int
+	err := d.db.QueryRow("SELECT COUNT(*) FROM KnownDevices WHERE UserId = ? AND Country = ?",
+		userId, country).Scan(&count)
+	return count > 0, err
+}
+
+// SaveKnownDevice records a sign-in from a device, adding the device if it is new
+func (d *Database) SaveKnownDevice(device *KnownDevice) error {
+	_, err := d.db.Exec(`
+		INSERT INTO KnownDevices (UserId, Fingerprint, Device, IPRange, Country, FirstSeen, LastSeen)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (UserId, Fingerprint) DO UPDATE SET
+			LastSeen = excluded.LastSeen,
+			Country = CASE WHEN excluded.Country != '' THEN excluded.Country ELSE KnownDevices.Country END`,
+		device.UserId, device.Fingerprint, device.Device, device.IPRange, device.Country, device.FirstSeen, device.LastSeen)
+	return err
+}
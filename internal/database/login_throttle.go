@@ -0,0 +1,92 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package database
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// LoginThrottle tracks failed attempts for one key (an account, a file or an IP)
+type LoginThrottle struct {
+	Key           string
+	Failures      int
+	LastFailureAt int64
+	LockedUntil   int64
+}
+
+// GetLoginThrottle returns the throttle state for a key, or nil if there is none
+func (d *Database) GetLoginThrottle(key string) (*LoginThrottle, error) {
+	t := &LoginThrottle{}
+	err := d.db.QueryRow(`
+		SELECT Key, Failures, LastFailureAt, LockedUntil FROM LoginThrottle WHERE Key = ?`, key).Scan(
+		&t.Key, &t.Failures, &t.LastFailureAt, &t.LockedUntil)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return t, nil
+}
+
+// IncrementLoginFailures atomically counts a failed attempt and returns the new
+// count. Counts whose last failure is older than resetBefore start again at one.
+func (d *Database) IncrementLoginFailures(key string, now, resetBefore int64) (int, error) {
+	var failures int
+	err := d.db.QueryRow(`
+		INSERT INTO LoginThrottle (Key, Failures, LastFailureAt, LockedUntil)
+		VALUES (?, 1, ?, 0)
+		ON CONFLICT(Key) DO UPDATE SET
+			Failures = CASE WHEN LastFailureAt < ? THEN 1 ELSE Failures + 1 END,
+			LastFailureAt = excluded.LastFailureAt
+		RETURNING Failures`, key, now, resetBefore).Scan(&failures)
+	return failures, err
+}
+
+// SetLoginLockedUntil locks a key until the given time
+func (d *Database) SetLoginLockedUntil(key string, lockedUntil int64) error {
+	_, err := d.db.Exec("UPDATE LoginThrottle SET LockedUntil = ? WHERE Key = ?", lockedUntil, key)
+	return err
+}
+
+// DeleteLoginThrottle clears failures and any lock for a key
+func (d *Database) DeleteLoginThrottle(key string) error {
+	_, err := d.db.Exec("DELETE FROM LoginThrottle WHERE Key = ?", key)
+	return err
+}
+
+// GetLockedLoginThrottles returns all keys that are locked at the given time
+func (d *Database) GetLockedLoginThrottles(now int64) ([]*LoginThrottle, error) {
+	rows, err := d.db.Query(`
+		SELECT Key, Failures, LastFailureAt, LockedUntil FROM LoginThrottle
+		WHERE LockedUntil > ?
+		ORDER BY LockedUntil DESC`, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var throttles []*LoginThrottle
+	for rows.Next() {
+		t := &LoginThrottle{}
+		if err := rows.Scan(&t.Key, &t.Failures, &t.LastFailureAt, &t.LockedUntil); err != nil {
+			return nil, err
+		}
+		throttles = append(throttles, t)
+	}
+	return throttles, rows.Err()
+}
+
+// DeleteStaleLoginThrottles removes unlocked entries whose last failure is older than before
+func (d *Database) DeleteStaleLoginThrottles(before, now int64) (int64, error) {
+	result, err := d.db.Exec(`
+		DELETE FROM LoginThrottle WHERE LastFailureAt < ? AND LockedUntil <= ?`, before, now)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,98 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package database
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+const (
+	// MagicLinkDuration is how long an emailed sign-in link stays valid
+	MagicLinkDuration = 15 * time.Minute
+	// MaxMagicLinksPerHour is how many sign-in links an account can request per hour
+	MaxMagicLinksPerHour = 5
+)
+
+// ErrMagicLinkInvalid is returned for sign-in links that are unknown, used or expired
+var ErrMagicLinkInvalid = errors.New("sign-in link is invalid or has expired")
+
+// CreateDownloadMagicLink creates a single-use sign-in link for a download account
+// and returns its token. Earlier unused links of the account stop working.
+// fileId is the file the link leads to, or "" for the download portal.
+func (d *Database) CreateDownloadMagicLink(accountId int, fileId, ipAddress string) (string, error) {
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(tokenBytes)
+
+	now := time.Now().Unix()
+	if _, err := d.db.Exec("UPDATE DownloadMagicLinks SET ExpiresAt = ? WHERE AccountId = ? AND UsedAt = 0 AND ExpiresAt > ?",
+		now, accountId, now); err != nil {
+		return "", err
+	}
+	_, err := d.db.Exec(`
+		INSERT INTO DownloadMagicLinks (AccountId, FileId, TokenHash, ExpiresAt, CreatedAt, IPAddress)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		accountId, fileId, hashVerificationToken(token), now+int64(MagicLinkDuration.Seconds()), now, ipAddress)
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// CountRecentDownloadMagicLinks returns how many sign-in links a download account
+// requested since the given time
+func (d *Database) CountRecentDownloadMagicLinks(accountId int, since time.Time) (int, error) {
+	var count int
+	err := d.db.QueryRow("SELECT COUNT(*) FROM DownloadMagicLinks WHERE AccountId = ? AND CreatedAt >= ?",
+		accountId, since.Unix()).Scan(&count)
+	return count, err
+}
+
+// CheckDownloadMagicLink returns the account and file of a usable sign-in link
+// without using it up
+func (d *Database) CheckDownloadMagicLink(token string) (accountId int, fileId string, err error) {
+	err = d.db.QueryRow(`
+		SELECT AccountId, COALESCE(FileId, '') FROM DownloadMagicLinks
+		WHERE TokenHash = ? AND UsedAt = 0 AND ExpiresAt >= ?`,
+		hashVerificationToken(token), time.Now().Unix()).Scan(&accountId, &fileId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, "", ErrMagicLinkInvalid
+	}
+	return accountId, fileId, err
+}
+
+// UseDownloadMagicLink marks a sign-in link as used and returns its account and
+// file. A link can only be used once.
+func (d *Database) UseDownloadMagicLink(token string) (accountId int, fileId string, err error) {
+	accountId, fileId, err = d.CheckDownloadMagicLink(token)
+	if err != nil {
+		return 0, "", err
+	}
+
+	now := time.Now().Unix()
+	result, err := d.db.Exec("UPDATE DownloadMagicLinks SET UsedAt = ? WHERE TokenHash = ? AND UsedAt = 0 AND ExpiresAt >= ?",
+		now, hashVerificationToken(token), now)
+	if err != nil {
+		return 0, "", err
+	}
+	if n, _ := result.RowsAffected(); n != 1 {
+		return 0, "", ErrMagicLinkInvalid
+	}
+	return accountId, fileId, nil
+}
+
+// CleanupExpiredMagicLinks removes sign-in links that expired more than a day ago.
+// Recent ones are kept for the request limit.
+func (d *Database) CleanupExpiredMagicLinks() error {
+	_, err := d.db.Exec("DELETE FROM DownloadMagicLinks WHERE ExpiresAt < ?", time.Now().Add(-24*time.Hour).Unix())
+	return err
+}
@@ -0,0 +1,104 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package database
+
+import (
+	"github.com/Frimurare/WulfVault/internal/models"
+)
+
+// MFAUserState is the two-factor enrollment state of an active user whose role
+// requires two-factor authentication
+type MFAUserState struct {
+	UserId         int
+	Name           string
+	Email          string
+	RoleName       string
+	AuthSource     string
+	TOTPEnabled    bool
+	PasskeyCount   int
+	RequiredSince  int64 // start of the grace period, 0 = not started yet
+	ReminderSentAt int64
+}
+
+// Enrolled reports whether the user has a second factor
+func (s *MFAUserState) Enrolled() bool {
+	return s.TOTPEnabled || s.PasskeyCount > 0
+}
+
+// GetMFARequiredUsers returns all active users whose role requires two-factor
+// authentication, including the super admin when the Administrator role does
+func (d *Database) GetMFARequiredUsers() ([]*MFAUserState, error) {
+	rows, err := d.db.Query(`
+		SELECT u.Id, u.Name, u.Email, r.Name, COALESCE(u.AuthSource, ''), COALESCE(u.TOTPEnabled, 0),
+		       (SELECT COUNT(*) FROM WebAuthnCredentials w WHERE w.UserId = u.Id),
+		       COALESCE(u.MFARequiredSince, 0), COALESCE(u.MFAReminderSentAt, 0)
+		FROM Users u
+		JOIN Roles r ON r.Id = CASE
+			WHEN COALESCE(u.RoleId, 0) != 0 THEN u.RoleId
+			WHEN u.Userlevel = ? THEN ?
+			ELSE ? END
+		WHERE COALESCE(r.Require2FA, 0) = 1 AND u.IsActive = 1 AND COALESCE(u.DeletedAt, 0) = 0
+		ORDER BY u.Name`,
+		models.UserLevelUser, models.RoleIdUser, models.RoleIdAdministrator)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var states []*MFAUserState
+	for rows.Next() {
+		state := &MFAUserState{}
+		var totpEnabled int
+		if err := rows.Scan(&state.UserId, &state.Name, &state.Email, &state.RoleName, &state.AuthSource,
+			&totpEnabled, &state.PasskeyCount, &state.RequiredSince, &state.ReminderSentAt); err != nil {
+			return nil, err
+		}
+		state.TOTPEnabled = totpEnabled == 1
+		states = append(states, state)
+	}
+	return states, rows.Err()
+}
+
+// GetMFARequiredSince returns when the two-factor grace period of a user started, 0 if it hasn't
+func (d *Database) GetMFARequiredSince(userId int) (int64, error) {
+	var since int64
+	err := d.db.QueryRow("SELECT COALESCE(MFARequiredSince, 0) FROM Users WHERE Id = ?", userId).Scan(&since)
+	return since, err
+}
+
+// SetMFARequiredSince starts (or with 0, clears) the two-factor grace period of a user.
+// Clearing it also resets the reminders.
+func (d *Database) SetMFARequiredSince(userId int, since int64) error {
+	if since == 0 {
+		_, err := d.db.Exec("UPDATE Users SET MFARequiredSince = 0, MFAReminderSentAt = 0 WHERE Id = ?", userId)
+		return err
+	}
+	_, err := d.db.Exec("UPDATE Users SET MFARequiredSince = ? WHERE Id = ?", since, userId)
+	return err
+}
+
+// SetMFAReminderSentAt records when a two-factor reminder was last emailed to a user
+func (d *Database) SetMFAReminderSentAt(userId int, sentAt int64) error {
+	_, err := d.db.Exec("UPDATE Users SET MFAReminderSentAt = ? WHERE Id = ?", sentAt, userId)
+	return err
+}
+
+// ClearMFAGracePeriods resets the grace period of users whose role no longer
+// requires two-factor authentication, so they get a full grace period again if
+// it is required later
+func (d *Database) ClearMFAGracePeriods() error {
+	_, err := d.db.Exec(`
+		UPDATE Users SET MFARequiredSince = 0, MFAReminderSentAt = 0
+		WHERE COALESCE(MFARequiredSince, 0) != 0 AND Id NOT IN (
+			SELECT u.Id FROM Users u
+			JOIN Roles r ON r.Id = CASE
+				WHEN COALESCE(u.RoleId, 0) != 0 THEN u.RoleId
+				WHEN u.Userlevel = ? THEN ?
+				ELSE ? END
+			WHERE COALESCE(r.Require2FA, 0) = 1)`,
+		models.UserLevelUser, models.RoleIdUser, models.RoleIdAdministrator)
+	return err
+}
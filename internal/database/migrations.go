@@ -6,8 +6,11 @@
 package database
 
 import (
+	"fmt"
 	"log"
 	"time"
+
+	"github.com/Frimurare/WulfVault/internal/models"
 )
 
 // RunMigrations applies any pending database migrations
@@ -45,10 +48,215 @@ func (d *Database) RunMigrations() error {
 		return err
 	}
 
+	// WebAuthn user handle (random, never the user ID); credentials live in WebAuthnCredentials
+	if err := d.addColumnIfNotExists("Users", "WebAuthnHandle", "TEXT DEFAULT ''"); err != nil {
+		return err
+	}
+
+	// Add integrity scrubbing columns to Files table
+	if err := d.addColumnIfNotExists("Files", "LastVerifiedAt", "INTEGER DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := d.addColumnIfNotExists("Files", "IntegrityStatus", "TEXT DEFAULT ''"); err != nil {
+		return err
+	}
+
+	// Add compression-at-rest columns to Files table
+	if err := d.addColumnIfNotExists("Files", "Compression", "TEXT DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := d.addColumnIfNotExists("Files", "StoredSizeBytes", "INTEGER DEFAULT 0"); err != nil {
+		return err
+	}
+
+	// Add hashed API key columns to ApiKeys table
+	if err := d.addColumnIfNotExists("ApiKeys", "KeyHash", "TEXT DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := d.addColumnIfNotExists("ApiKeys", "Expiry", "INTEGER DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := d.addColumnIfNotExists("ApiKeys", "CreatedAt", "INTEGER DEFAULT 0"); err != nil {
+		return err
+	}
+	if _, err := d.db.Exec("CREATE INDEX IF NOT EXISTS idx_apikeys_keyhash ON ApiKeys(KeyHash)"); err != nil {
+		return err
+	}
+
+	// Add external identity columns to Users table (single sign-on / directory accounts)
+	if err := d.addColumnIfNotExists("Users", "AuthSource", "TEXT DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := d.addColumnIfNotExists("Users", "ExternalId", "TEXT DEFAULT ''"); err != nil {
+		return err
+	}
+	if _, err := d.db.Exec("CREATE INDEX IF NOT EXISTS idx_users_external ON Users(AuthSource, ExternalId)"); err != nil {
+		return err
+	}
+
+	// Add device metadata columns to Sessions table
+	if err := d.addColumnIfNotExists("Sessions", "CreatedAt", "INTEGER DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := d.addColumnIfNotExists("Sessions", "LastSeen", "INTEGER DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := d.addColumnIfNotExists("Sessions", "IPAddress", "TEXT DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := d.addColumnIfNotExists("Sessions", "UserAgent", "TEXT DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := d.addColumnIfNotExists("Sessions", "Device", "TEXT DEFAULT ''"); err != nil {
+		return err
+	}
+
+	// Track when passwords were last changed, for the maximum password age
+	if err := d.addColumnIfNotExists("Users", "PasswordChangedAt", "INTEGER DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := d.addColumnIfNotExists("DownloadAccounts", "PasswordChangedAt", "INTEGER DEFAULT 0"); err != nil {
+		return err
+	}
+
+	// Assign every user a role; existing users get the built-in role of their user level
+	if err := d.addColumnIfNotExists("Users", "RoleId", "INTEGER DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := d.ensureBuiltinRoles(); err != nil {
+		return err
+	}
+	if _, err := d.db.Exec(`
+		UPDATE Users SET RoleId = CASE WHEN Userlevel = ? THEN ? ELSE ? END
+		WHERE COALESCE(RoleId, 0) = 0`,
+		models.UserLevelUser, models.RoleIdUser, models.RoleIdAdministrator); err != nil {
+		return err
+	}
+
+	// Mandatory two-factor authentication per role, with a grace period per user
+	if err := d.addColumnIfNotExists("Roles", "Require2FA", "INTEGER DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := d.addColumnIfNotExists("Users", "MFARequiredSince", "INTEGER DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := d.addColumnIfNotExists("Users", "MFAReminderSentAt", "INTEGER DEFAULT 0"); err != nil {
+		return err
+	}
+
+	// Download accounts must verify their email address before downloading; download
+	// logs keep the verification time the download was made with
+	if err := d.addColumnIfNotExists("DownloadAccounts", "EmailVerifiedAt", "INTEGER DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := d.addColumnIfNotExists("DownloadLogs", "EmailVerifiedAt", "INTEGER DEFAULT 0"); err != nil {
+		return err
+	}
+
+	// Users and teams provisioned over SCIM keep the identity provider's ID for them
+	if err := d.addColumnIfNotExists("Users", "ScimExternalId", "TEXT DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := d.addColumnIfNotExists("Teams", "ScimExternalId", "TEXT DEFAULT ''"); err != nil {
+		return err
+	}
+
+	// Dormant download accounts are warned, disabled and deleted by the lifecycle
+	// policy. An admin reactivating a disabled account restarts its idle time.
+	if err := d.addColumnIfNotExists("DownloadAccounts", "DormancyWarnedAt", "INTEGER DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := d.addColumnIfNotExists("DownloadAccounts", "DormancyDisabledAt", "INTEGER DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := d.addColumnIfNotExists("DownloadAccounts", "DormancyResetAt", "INTEGER DEFAULT 0"); err != nil {
+		return err
+	}
+
+	// Download accounts can sign in with emailed links; each file decides whether
+	// such a session is enough for it, so sessions record how they signed in
+	if err := d.addColumnIfNotExists("Files", "AllowMagicLink", "INTEGER DEFAULT 1"); err != nil {
+		return err
+	}
+	if err := d.addColumnIfNotExists("DownloadSessions", "AuthMethod", "TEXT DEFAULT 'password'"); err != nil {
+		return err
+	}
+
+	// Files can be restricted to named recipient emails and domains
+	if err := d.addColumnIfNotExists("Files", "AllowedRecipients", "TEXT DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := d.addColumnIfNotExists("Files", "NotifyRejectedRecipients", "INTEGER DEFAULT 0"); err != nil {
+		return err
+	}
+
+	// Super admins can view the app as a user through a time-limited session of
+	// that user. The session records who started it and whether it may make changes.
+	if err := d.addColumnIfNotExists("Sessions", "ImpersonatorId", "INTEGER DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := d.addColumnIfNotExists("Sessions", "ImpersonationWritable", "INTEGER DEFAULT 0"); err != nil {
+		return err
+	}
+
+	// Sensitive actions need a recent authentication; a session records when
+	// its user last confirmed their identity in it
+	if err := d.addColumnIfNotExists("Sessions", "SudoAt", "INTEGER DEFAULT 0"); err != nil {
+		return err
+	}
+
+	// Session limits can be set per role, and a remembered device keeps its
+	// session for longer without an idle timeout
+	if err := d.addColumnIfNotExists("Roles", "SessionLifetimeHours", "INTEGER DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := d.addColumnIfNotExists("Roles", "SessionIdleMinutes", "INTEGER DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := d.addColumnIfNotExists("Sessions", "Remembered", "INTEGER DEFAULT 0"); err != nil {
+		return err
+	}
+
+	// File passwords are only stored as hashes
+	if err := d.hashPlainFilePasswords(); err != nil {
+		return err
+	}
+
 	log.Println("Database migrations completed successfully")
 	return nil
 }
 
+// hashPlainFilePasswords replaces file passwords stored in plain text with bcrypt hashes
+func (d *Database) hashPlainFilePasswords() error {
+	rows, err := d.db.Query("SELECT Id, FilePasswordPlain FROM Files WHERE COALESCE(FilePasswordPlain, '') != ''")
+	if err != nil {
+		return err
+	}
+	plain := make(map[string]string)
+	for rows.Next() {
+		var id, password string
+		if err := rows.Scan(&id, &password); err != nil {
+			rows.Close()
+			return err
+		}
+		plain[id] = password
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, password := range plain {
+		if err := d.UpdateFilePassword(id, password); err != nil {
+			return fmt.Errorf("failed to hash password of file %s: %w", id, err)
+		}
+	}
+	if len(plain) > 0 {
+		log.Printf("Migration completed: hashed %d plain text file passwords", len(plain))
+	}
+	return nil
+}
+
 // addColumnIfNotExists adds a column to a table if it doesn't already exist
 func (d *Database) addColumnIfNotExists(tableName, columnName, columnDef string) error {
 	// Check if column exists
@@ -93,8 +301,15 @@ func (d *Database) SoftDeleteUser(userId int, deletedBy string) error {
 		SET Email = ?, OriginalEmail = ?, DeletedAt = ?, DeletedBy = ?, IsActive = 0
 		WHERE Id = ?`,
 		anonymizedEmail, user.Email, currentTimestamp(), deletedBy, userId)
+	if err != nil {
+		return err
+	}
 
-	return err
+	// Deleted users are signed out and can no longer use their API keys
+	if _, err := d.DeleteSessionsByUser(userId); err != nil {
+		return err
+	}
+	return d.DeleteApiKeysByUser(userId)
 }
 
 // SoftDeleteDownloadAccount marks a download account as deleted (GDPR-compliant soft delete)
@@ -119,6 +334,9 @@ func (d *Database) SoftDeleteDownloadAccount(accountId int, deletedBy string) er
 		WHERE Id = ?`,
 		anonymizedEmail, account.Email, currentTimestamp(), deletedBy, accountId)
 
+	// Sign the account out everywhere
+	_, _ = d.DeleteDownloadSessionsByAccount(accountId)
+
 	// Also anonymize download logs
 	_, _ = d.db.Exec(`
 		UPDATE DownloadLogs
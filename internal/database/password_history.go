@@ -0,0 +1,96 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package database
+
+import (
+	"errors"
+	"time"
+)
+
+// MaxPasswordHistory is how many previous passwords are kept per account
+const MaxPasswordHistory = 24
+
+// accountTable returns the table holding accounts of the given type
+func accountTable(accountType string) (string, error) {
+	switch accountType {
+	case AccountTypeUser:
+		return "Users", nil
+	case AccountTypeDownloadAccount:
+		return "DownloadAccounts", nil
+	}
+	return "", errors.New("invalid account type")
+}
+
+// AddPasswordHistory records a new password hash of an account and forgets the
+// oldest ones beyond MaxPasswordHistory
+func (d *Database) AddPasswordHistory(accountType string, accountId int, passwordHash string) error {
+	_, err := d.db.Exec(`
+		INSERT INTO PasswordHistory (AccountType, AccountId, PasswordHash, CreatedAt)
+		VALUES (?, ?, ?, ?)`,
+		accountType, accountId, passwordHash, time.Now().Unix())
+	if err != nil {
+		return err
+	}
+
+	_, err = d.db.Exec(`
+		DELETE FROM PasswordHistory
+		WHERE AccountType = ? AND AccountId = ? AND Id NOT IN (
+			SELECT Id FROM PasswordHistory WHERE AccountType = ? AND AccountId = ?
+			ORDER BY Id DESC LIMIT ?
+		)`,
+		accountType, accountId, accountType, accountId, MaxPasswordHistory)
+	return err
+}
+
+// GetPasswordHistory returns the most recent password hashes of an account, newest first
+func (d *Database) GetPasswordHistory(accountType string, accountId, limit int) ([]string, error) {
+	rows, err := d.db.Query(`
+		SELECT PasswordHash FROM PasswordHistory
+		WHERE AccountType = ? AND AccountId = ?
+		ORDER BY Id DESC LIMIT ?`,
+		accountType, accountId, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hashes []string
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, hash)
+	}
+	return hashes, rows.Err()
+}
+
+// DeletePasswordHistory forgets the previous passwords of an account
+func (d *Database) DeletePasswordHistory(accountType string, accountId int) error {
+	_, err := d.db.Exec("DELETE FROM PasswordHistory WHERE AccountType = ? AND AccountId = ?", accountType, accountId)
+	return err
+}
+
+// GetPasswordChangedAt returns when the password of an account was last changed, or 0 if unknown
+func (d *Database) GetPasswordChangedAt(accountType string, accountId int) (int64, error) {
+	table, err := accountTable(accountType)
+	if err != nil {
+		return 0, err
+	}
+	var changedAt int64
+	err = d.db.QueryRow("SELECT COALESCE(PasswordChangedAt, 0) FROM "+table+" WHERE Id = ?", accountId).Scan(&changedAt)
+	return changedAt, err
+}
+
+// SetPasswordChangedAt records when the password of an account was last changed
+func (d *Database) SetPasswordChangedAt(accountType string, accountId int, changedAt int64) error {
+	table, err := accountTable(accountType)
+	if err != nil {
+		return err
+	}
+	_, err = d.db.Exec("UPDATE "+table+" SET PasswordChangedAt = ? WHERE Id = ?", changedAt, accountId)
+	return err
+}
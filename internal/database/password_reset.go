@@ -139,6 +139,22 @@ func (db *Database) ResetPasswordWithToken(token, newPassword string) error {
 		return err
 	}
 
+	// Sign the user out everywhere; whoever knew the old password may still have a session
+	if resetToken.AccountType == AccountTypeUser {
+		if _, err := db.Exec(`
+			DELETE FROM Sessions
+			WHERE UserId IN (SELECT Id FROM Users WHERE Email = ?)`,
+			resetToken.Email,
+		); err != nil {
+			return err
+		}
+	} else if account, err := db.GetDownloadAccountByEmail(resetToken.Email); err == nil {
+		// Download accounts have sessions of their own
+		if _, err := db.DeleteDownloadSessionsByAccount(account.Id); err != nil {
+			return err
+		}
+	}
+
 	// Mark token as used
 	return db.MarkPasswordResetTokenUsed(token)
 }
@@ -0,0 +1,297 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Frimurare/WulfVault/internal/models"
+)
+
+// ErrRoleInUse is returned when deleting a role that is still assigned to users
+var ErrRoleInUse = errors.New("role is still assigned to users")
+
+// ensureBuiltinRoles creates the Administrator and User roles if they don't exist.
+// The Administrator role always keeps all permissions.
+func (d *Database) ensureBuiltinRoles() error {
+	now := time.Now().Unix()
+	_, err := d.db.Exec(`
+		INSERT OR IGNORE INTO Roles (Id, Name, Description, Permissions, MaxExpiryDays, IsBuiltin, CreatedAt)
+		VALUES (?, 'Administrator', 'Full access to all administration features', ?, 0, 1, ?),
+		       (?, 'User', 'Upload and share files', ?, 0, 1, ?)`,
+		models.RoleIdAdministrator, models.RolePermAll, now,
+		models.RoleIdUser, models.RolePermBasic, now)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.db.Exec("UPDATE Roles SET Permissions = ?, MaxExpiryDays = 0 WHERE Id = ?",
+		models.RolePermAll, models.RoleIdAdministrator)
+	return err
+}
+
+// scanRole reads a role from a row
+func scanRole(scanner interface{ Scan(...interface{}) error }) (*models.Role, error) {
+	role := &models.Role{}
+	var isBuiltin, require2FA int
+	err := scanner.Scan(&role.Id, &role.Name, &role.Description, &role.Permissions,
+		&role.MaxExpiryDays, &isBuiltin, &require2FA, &role.CreatedAt,
+		&role.SessionLifetimeHours, &role.SessionIdleMinutes)
+	if err != nil {
+		return nil, err
+	}
+	role.IsBuiltin = isBuiltin == 1
+	role.Require2FA = require2FA == 1
+	return role, nil
+}
+
+const roleColumns = "Id, Name, Description, Permissions, MaxExpiryDays, IsBuiltin, COALESCE(Require2FA, 0), CreatedAt, " +
+	"COALESCE(SessionLifetimeHours, 0), COALESCE(SessionIdleMinutes, 0)"
+
+// GetRole retrieves a role by ID
+func (d *Database) GetRole(id int) (*models.Role, error) {
+	role, err := scanRole(d.db.QueryRow("SELECT "+roleColumns+" FROM Roles WHERE Id = ?", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errors.New("role not found")
+	}
+	return role, err
+}
+
+// GetRoleByName retrieves a role by name (case-insensitive)
+func (d *Database) GetRoleByName(name string) (*models.Role, error) {
+	role, err := scanRole(d.db.QueryRow("SELECT "+roleColumns+" FROM Roles WHERE Name = ? COLLATE NOCASE", name))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errors.New("role not found")
+	}
+	return role, err
+}
+
+// GetAllRoles returns all roles, built-in roles first
+func (d *Database) GetAllRoles() ([]*models.Role, error) {
+	rows, err := d.db.Query("SELECT " + roleColumns + " FROM Roles ORDER BY IsBuiltin DESC, Name ASC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roles []*models.Role
+	for rows.Next() {
+		role, err := scanRole(rows)
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	return roles, rows.Err()
+}
+
+// CreateRole inserts a new custom role
+func (d *Database) CreateRole(role *models.Role) error {
+	if role.CreatedAt == 0 {
+		role.CreatedAt = time.Now().Unix()
+	}
+
+	result, err := d.db.Exec(`
+		INSERT INTO Roles (Name, Description, Permissions, MaxExpiryDays, IsBuiltin, CreatedAt)
+		VALUES (?, ?, ?, ?, 0, ?)`,
+		role.Name, role.Description, role.Permissions, role.MaxExpiryDays, role.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	role.Id = int(id)
+	role.IsBuiltin = false
+	return nil
+}
+
+// UpdateRole updates a role. Members of the role have their admin status updated
+// to match its permissions. The Administrator role cannot be changed.
+func (d *Database) UpdateRole(role *models.Role) error {
+	if role.Id == models.RoleIdAdministrator {
+		return errors.New("the Administrator role cannot be changed")
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE Roles SET Name = ?, Description = ?, Permissions = ?, MaxExpiryDays = ?
+		WHERE Id = ?`,
+		role.Name, role.Description, role.Permissions, role.MaxExpiryDays, role.Id)
+	if err != nil {
+		return err
+	}
+
+	level := models.UserLevelUser
+	if role.IsAdministrative() {
+		level = models.UserLevelAdmin
+	}
+	_, err = tx.Exec("UPDATE Users SET Userlevel = ? WHERE RoleId = ? AND Userlevel != ?",
+		level, role.Id, models.UserLevelSuperAdmin)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteRole deletes a custom role that is not assigned to any user
+func (d *Database) DeleteRole(id int) error {
+	role, err := d.GetRole(id)
+	if err != nil {
+		return err
+	}
+	if role.IsBuiltin {
+		return fmt.Errorf("the %s role is built in and cannot be deleted", role.Name)
+	}
+
+	var count int
+	if err := d.db.QueryRow("SELECT COUNT(*) FROM Users WHERE RoleId = ? AND COALESCE(DeletedAt, 0) = 0", id).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrRoleInUse
+	}
+
+	// Deleted users fall back to the default role of their user level
+	if _, err := d.db.Exec("UPDATE Users SET RoleId = 0 WHERE RoleId = ?", id); err != nil {
+		return err
+	}
+	_, err = d.db.Exec("DELETE FROM Roles WHERE Id = ?", id)
+	return err
+}
+
+// SetRoleRequire2FA sets whether members of a role must use two-factor authentication.
+// Unlike UpdateRole it also applies to the built-in roles.
+func (d *Database) SetRoleRequire2FA(id int, required bool) error {
+	value := 0
+	if required {
+		value = 1
+	}
+	_, err := d.db.Exec("UPDATE Roles SET Require2FA = ? WHERE Id = ?", value, id)
+	return err
+}
+
+// SetRoleSessionLimits sets the session lifetime and idle timeout of members
+// of a role (0 = the global setting). It also applies to the built-in roles.
+func (d *Database) SetRoleSessionLimits(id, lifetimeHours, idleMinutes int) error {
+	_, err := d.db.Exec("UPDATE Roles SET SessionLifetimeHours = ?, SessionIdleMinutes = ? WHERE Id = ?",
+		lifetimeHours, idleMinutes, id)
+	return err
+}
+
+// defaultRoleId returns the built-in role matching a user level. New users start
+// with it, and it is used for users that somehow have no role assigned.
+func defaultRoleId(level models.UserRank) int {
+	if level == models.UserLevelUser {
+		return models.RoleIdUser
+	}
+	return models.RoleIdAdministrator
+}
+
+// GetUserRoleId returns the ID of the role assigned to a user
+func (d *Database) GetUserRoleId(user *models.User) (int, error) {
+	var roleId int
+	err := d.db.QueryRow("SELECT COALESCE(RoleId, 0) FROM Users WHERE Id = ?", user.Id).Scan(&roleId)
+	if err != nil {
+		return 0, err
+	}
+	if roleId == 0 {
+		roleId = defaultRoleId(user.UserLevel)
+	}
+	return roleId, nil
+}
+
+// GetUserRole returns the role assigned to a user. The super admin always has
+// all permissions, whatever role is assigned.
+func (d *Database) GetUserRole(user *models.User) (*models.Role, error) {
+	roleId, err := d.GetUserRoleId(user)
+	if err != nil {
+		return nil, err
+	}
+	role, err := d.GetRole(roleId)
+	if err != nil {
+		return nil, err
+	}
+	if user.IsSuperAdmin() {
+		role.Permissions = models.RolePermAll
+		role.MaxExpiryDays = 0
+	}
+	return role, nil
+}
+
+// SetUserRole assigns a role to a user and updates the user level to match:
+// users whose role has administrative permissions are admins.
+// The user level of the super admin is never changed.
+func (d *Database) SetUserRole(user *models.User, role *models.Role) error {
+	if !user.IsSuperAdmin() {
+		user.UserLevel = models.UserLevelUser
+		if role.IsAdministrative() {
+			user.UserLevel = models.UserLevelAdmin
+		}
+	}
+	_, err := d.db.Exec("UPDATE Users SET RoleId = ?, Userlevel = ? WHERE Id = ?", role.Id, user.UserLevel, user.Id)
+	return err
+}
+
+// CountUsersByRole returns the number of active (not deleted) users per role ID
+func (d *Database) CountUsersByRole() (map[int]int, error) {
+	rows, err := d.db.Query(`
+		SELECT COALESCE(RoleId, 0), Userlevel, COUNT(*) FROM Users
+		WHERE COALESCE(DeletedAt, 0) = 0
+		GROUP BY COALESCE(RoleId, 0), Userlevel`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[int]int{}
+	for rows.Next() {
+		var roleId, count int
+		var level models.UserRank
+		if err := rows.Scan(&roleId, &level, &count); err != nil {
+			return nil, err
+		}
+		if roleId == 0 {
+			roleId = defaultRoleId(level)
+		}
+		counts[roleId] += count
+	}
+	return counts, rows.Err()
+}
+
+// GetUserRoleIds returns the role ID of every user, keyed by user ID
+func (d *Database) GetUserRoleIds() (map[int]int, error) {
+	rows, err := d.db.Query("SELECT Id, COALESCE(RoleId, 0), Userlevel FROM Users")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roleIds := map[int]int{}
+	for rows.Next() {
+		var userId, roleId int
+		var level models.UserRank
+		if err := rows.Scan(&userId, &roleId, &level); err != nil {
+			return nil, err
+		}
+		if roleId == 0 {
+			roleId = defaultRoleId(level)
+		}
+		roleIds[userId] = roleId
+	}
+	return roleIds, rows.Err()
+}
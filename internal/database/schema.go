@@ -202,6 +202,121 @@ CREATE TABLE IF NOT EXISTS TeamFiles (
 	UNIQUE(FileId, TeamId)
 );
 
+CREATE TABLE IF NOT EXISTS DestructionCertificates (
+	Id TEXT PRIMARY KEY,
+	FileId TEXT NOT NULL,
+	FileName TEXT NOT NULL,
+	FileSHA1 TEXT DEFAULT '',
+	SizeBytes INTEGER DEFAULT 0,
+	OwnerId INTEGER DEFAULT 0,
+	Method TEXT NOT NULL,
+	Passes INTEGER DEFAULT 0,
+	BytesOverwritten INTEGER DEFAULT 0,
+	DestroyedAt INTEGER NOT NULL,
+	DestroyedBy TEXT NOT NULL,
+	Signature TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS LoginThrottle (
+	Key TEXT PRIMARY KEY,
+	Failures INTEGER NOT NULL DEFAULT 0,
+	LastFailureAt INTEGER NOT NULL DEFAULT 0,
+	LockedUntil INTEGER NOT NULL DEFAULT 0
+);
+
+-- WebAuthn credentials (passkeys and security keys), several per user
+CREATE TABLE IF NOT EXISTS WebAuthnCredentials (
+	Id INTEGER PRIMARY KEY AUTOINCREMENT,
+	UserId INTEGER NOT NULL,
+	Name TEXT NOT NULL,
+	CredentialId BLOB NOT NULL UNIQUE,
+	PublicKey BLOB NOT NULL,
+	AttestationType TEXT DEFAULT '',
+	Transports TEXT DEFAULT '',
+	AAGUID BLOB,
+	SignCount INTEGER DEFAULT 0,
+	BackupEligible INTEGER DEFAULT 0,
+	BackupState INTEGER DEFAULT 0,
+	CreatedAt INTEGER NOT NULL,
+	LastUsedAt INTEGER DEFAULT 0,
+	FOREIGN KEY (UserId) REFERENCES Users(Id) ON DELETE CASCADE
+);
+
+-- Previous password hashes of users and download accounts, for the reuse check
+CREATE TABLE IF NOT EXISTS PasswordHistory (
+	Id INTEGER PRIMARY KEY AUTOINCREMENT,
+	AccountType TEXT NOT NULL,
+	AccountId INTEGER NOT NULL,
+	PasswordHash TEXT NOT NULL,
+	CreatedAt INTEGER NOT NULL
+);
+
+-- Named sets of permissions assigned to users
+CREATE TABLE IF NOT EXISTS Roles (
+	Id INTEGER PRIMARY KEY AUTOINCREMENT,
+	Name TEXT NOT NULL UNIQUE COLLATE NOCASE,
+	Description TEXT DEFAULT '',
+	Permissions INTEGER NOT NULL DEFAULT 0,
+	MaxExpiryDays INTEGER DEFAULT 0,
+	IsBuiltin INTEGER DEFAULT 0,
+	Require2FA INTEGER DEFAULT 0,
+	CreatedAt INTEGER NOT NULL,
+	SessionLifetimeHours INTEGER DEFAULT 0,
+	SessionIdleMinutes INTEGER DEFAULT 0
+);
+
+-- Pending email verifications of download accounts (code and link are stored hashed)
+CREATE TABLE IF NOT EXISTS DownloadAccountVerifications (
+	Id INTEGER PRIMARY KEY AUTOINCREMENT,
+	AccountId INTEGER NOT NULL,
+	FileId TEXT DEFAULT '',
+	CodeHash TEXT NOT NULL,
+	TokenHash TEXT NOT NULL UNIQUE,
+	Attempts INTEGER DEFAULT 0,
+	ExpiresAt INTEGER NOT NULL,
+	CreatedAt INTEGER NOT NULL,
+	FOREIGN KEY (AccountId) REFERENCES DownloadAccounts(Id) ON DELETE CASCADE
+);
+
+-- Signed-in browsers of download accounts
+CREATE TABLE IF NOT EXISTS DownloadSessions (
+	Id TEXT PRIMARY KEY,
+	AccountId INTEGER NOT NULL,
+	ValidUntil INTEGER NOT NULL,
+	CreatedAt INTEGER NOT NULL,
+	LastSeen INTEGER NOT NULL,
+	IPAddress TEXT DEFAULT '',
+	UserAgent TEXT DEFAULT '',
+	Device TEXT DEFAULT '',
+	FOREIGN KEY (AccountId) REFERENCES DownloadAccounts(Id) ON DELETE CASCADE
+);
+
+-- Single-use sign-in links emailed to download accounts (stored hashed)
+CREATE TABLE IF NOT EXISTS DownloadMagicLinks (
+	Id INTEGER PRIMARY KEY AUTOINCREMENT,
+	AccountId INTEGER NOT NULL,
+	FileId TEXT DEFAULT '',
+	TokenHash TEXT NOT NULL UNIQUE,
+	ExpiresAt INTEGER NOT NULL,
+	UsedAt INTEGER DEFAULT 0,
+	CreatedAt INTEGER NOT NULL,
+	IPAddress TEXT DEFAULT '',
+	FOREIGN KEY (AccountId) REFERENCES DownloadAccounts(Id) ON DELETE CASCADE
+);
+
+-- Devices users signed in from, to notice sign-ins from new devices and countries
+CREATE TABLE IF NOT EXISTS KnownDevices (
+	UserId INTEGER NOT NULL,
+	Fingerprint TEXT NOT NULL,
+	Device TEXT DEFAULT '',
+	IPRange TEXT DEFAULT '',
+	Country TEXT DEFAULT '',
+	FirstSeen INTEGER NOT NULL,
+	LastSeen INTEGER NOT NULL,
+	PRIMARY KEY (UserId, Fingerprint),
+	FOREIGN KEY (UserId) REFERENCES Users(Id) ON DELETE CASCADE
+);
+
 -- Indices for performance
 CREATE INDEX IF NOT EXISTS idx_files_userid ON Files(UserId);
 CREATE INDEX IF NOT EXISTS idx_files_sha1 ON Files(SHA1);
@@ -220,4 +335,10 @@ CREATE INDEX IF NOT EXISTS idx_team_members_team ON TeamMembers(TeamId);
 CREATE INDEX IF NOT EXISTS idx_team_members_user ON TeamMembers(UserId);
 CREATE INDEX IF NOT EXISTS idx_team_files_team ON TeamFiles(TeamId);
 CREATE INDEX IF NOT EXISTS idx_team_files_file ON TeamFiles(FileId);
+CREATE INDEX IF NOT EXISTS idx_destruction_certificates_file ON DestructionCertificates(FileId);
+CREATE INDEX IF NOT EXISTS idx_webauthn_credentials_user ON WebAuthnCredentials(UserId);
+CREATE INDEX IF NOT EXISTS idx_password_history_account ON PasswordHistory(AccountType, AccountId);
+CREATE INDEX IF NOT EXISTS idx_download_account_verifications_account ON DownloadAccountVerifications(AccountId);
+CREATE INDEX IF NOT EXISTS idx_download_sessions_account ON DownloadSessions(AccountId);
+CREATE INDEX IF NOT EXISTS idx_download_magic_links_account ON DownloadMagicLinks(AccountId);
 `
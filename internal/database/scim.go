@@ -0,0 +1,141 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package database
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/Frimurare/WulfVault/internal/models"
+)
+
+// ScimUser is a user together with the ID the SCIM client knows it by
+type ScimUser struct {
+	*models.User
+	ExternalId string
+}
+
+// ScimTeam is a team together with the ID the SCIM client knows it by
+type ScimTeam struct {
+	*models.Team
+	ExternalId string
+}
+
+// GetScimUsers returns all users that are not deleted, in ID order
+func (d *Database) GetScimUsers() ([]*ScimUser, error) {
+	rows, err := d.db.Query(`
+		SELECT Id, Name, Email, Userlevel, CreatedAt, IsActive, COALESCE(ScimExternalId, '')
+		FROM Users WHERE COALESCE(DeletedAt, 0) = 0 ORDER BY Id ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []*ScimUser
+	for rows.Next() {
+		user := &ScimUser{User: &models.User{}}
+		var isActive int
+		if err := rows.Scan(&user.Id, &user.Name, &user.Email, &user.UserLevel, &user.CreatedAt,
+			&isActive, &user.ExternalId); err != nil {
+			return nil, err
+		}
+		user.IsActive = isActive == 1
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// GetScimUser returns a user that is not deleted
+func (d *Database) GetScimUser(id int) (*ScimUser, error) {
+	var externalId string
+	var deletedAt int64
+	err := d.db.QueryRow("SELECT COALESCE(ScimExternalId, ''), COALESCE(DeletedAt, 0) FROM Users WHERE Id = ?", id).
+		Scan(&externalId, &deletedAt)
+	if errors.Is(err, sql.ErrNoRows) || deletedAt > 0 {
+		return nil, errors.New("user not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := d.GetUserByID(id)
+	if err != nil {
+		return nil, err
+	}
+	return &ScimUser{User: user, ExternalId: externalId}, nil
+}
+
+// SetUserScimExternalId stores the ID a SCIM client uses for a user
+func (d *Database) SetUserScimExternalId(id int, externalId string) error {
+	_, err := d.db.Exec("UPDATE Users SET ScimExternalId = ? WHERE Id = ?", externalId, id)
+	return err
+}
+
+// GetScimTeams returns all active teams, in ID order
+func (d *Database) GetScimTeams() ([]*ScimTeam, error) {
+	rows, err := d.db.Query(`
+		SELECT Id, Name, Description, CreatedBy, CreatedAt, StorageQuotaMB, StorageUsedMB, COALESCE(ScimExternalId, '')
+		FROM Teams WHERE IsActive = 1 ORDER BY Id ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var teams []*ScimTeam
+	for rows.Next() {
+		team := &ScimTeam{Team: &models.Team{IsActive: true}}
+		if err := rows.Scan(&team.Id, &team.Name, &team.Description, &team.CreatedBy, &team.CreatedAt,
+			&team.StorageQuotaMB, &team.StorageUsedMB, &team.ExternalId); err != nil {
+			return nil, err
+		}
+		teams = append(teams, team)
+	}
+	return teams, rows.Err()
+}
+
+// GetScimTeam returns an active team
+func (d *Database) GetScimTeam(id int) (*ScimTeam, error) {
+	team, err := d.GetTeamByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if !team.IsActive {
+		return nil, errors.New("team not found")
+	}
+
+	var externalId string
+	if err := d.db.QueryRow("SELECT COALESCE(ScimExternalId, '') FROM Teams WHERE Id = ?", id).Scan(&externalId); err != nil {
+		return nil, err
+	}
+	return &ScimTeam{Team: team, ExternalId: externalId}, nil
+}
+
+// SetTeamScimExternalId stores the ID a SCIM client uses for a team
+func (d *Database) SetTeamScimExternalId(id int, externalId string) error {
+	_, err := d.db.Exec("UPDATE Teams SET ScimExternalId = ? WHERE Id = ?", externalId, id)
+	return err
+}
+
+// TransferUserFiles gives the files and open file requests of one user to another
+// and returns the number of files moved. Files in the trash stay with their owner.
+func (d *Database) TransferUserFiles(fromUserId, toUserId int) (int, error) {
+	result, err := d.db.Exec("UPDATE Files SET UserId = ? WHERE UserId = ? AND DeletedAt = 0", toUserId, fromUserId)
+	if err != nil {
+		return 0, err
+	}
+	moved, _ := result.RowsAffected()
+
+	if _, err := d.db.Exec("UPDATE FileRequests SET UserId = ? WHERE UserId = ? AND IsActive = 1", toUserId, fromUserId); err != nil {
+		return int(moved), err
+	}
+
+	for _, userId := range []int{fromUserId, toUserId} {
+		if storage, err := d.CalculateUserStorage(userId); err == nil {
+			d.UpdateUserStorage(userId, storage)
+		}
+	}
+	return int(moved), nil
+}
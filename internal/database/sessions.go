@@ -0,0 +1,170 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Session is a signed-in browser of a user
+type Session struct {
+	Id         string // secret, also the value of the session cookie
+	UserId     int
+	ValidUntil int64
+	CreatedAt  int64
+	LastSeen   int64
+	IPAddress  string
+	UserAgent  string
+	Device     string // e.g. "Firefox on Windows"
+
+	// ImpersonatorId is the super admin viewing the app as the user, 0 for the user's own sessions
+	ImpersonatorId int
+
+	// Remembered sessions were started with "Remember this device". They last
+	// longer and don't expire when idle.
+	Remembered bool
+}
+
+// Impersonation describes a session a super admin started to view the app as a user
+type Impersonation struct {
+	UserId     int
+	AdminId    int
+	Writable   bool // whether the admin may make changes as the user
+	ValidUntil int64
+}
+
+const sessionColumns = `Id, UserId, ValidUntil, COALESCE(CreatedAt, 0), COALESCE(LastSeen, 0),
+	COALESCE(IPAddress, ''), COALESCE(UserAgent, ''), COALESCE(Device, ''),
+	COALESCE(ImpersonatorId, 0), COALESCE(Remembered, 0)`
+
+// scanSession reads a session from a row
+func scanSession(scanner interface{ Scan(...interface{}) error }) (*Session, error) {
+	s := &Session{}
+	var remembered int
+	if err := scanner.Scan(&s.Id, &s.UserId, &s.ValidUntil, &s.CreatedAt, &s.LastSeen,
+		&s.IPAddress, &s.UserAgent, &s.Device, &s.ImpersonatorId, &remembered); err != nil {
+		return nil, err
+	}
+	s.Remembered = remembered == 1
+	return s, nil
+}
+
+// GetSession retrieves a session by ID
+func (d *Database) GetSession(sessionId string) (*Session, error) {
+	return scanSession(d.db.QueryRow("SELECT "+sessionColumns+" FROM Sessions WHERE Id = ?", sessionId))
+}
+
+// GetSessionsByUser returns the unexpired sessions of a user, most recently used first
+func (d *Database) GetSessionsByUser(userId int) ([]*Session, error) {
+	rows, err := d.db.Query(`
+		SELECT `+sessionColumns+`
+		FROM Sessions
+		WHERE UserId = ? AND ValidUntil >= ?
+		ORDER BY LastSeen DESC, CreatedAt DESC`,
+		userId, time.Now().Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []*Session
+	for rows.Next() {
+		s, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+// CountActiveSessions returns the number of unexpired sessions per user, for users that have any
+func (d *Database) CountActiveSessions() (map[int]int, error) {
+	rows, err := d.db.Query("SELECT UserId, COUNT(*) FROM Sessions WHERE ValidUntil >= ? GROUP BY UserId", time.Now().Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[int]int{}
+	for rows.Next() {
+		var userId, count int
+		if err := rows.Scan(&userId, &count); err != nil {
+			return nil, err
+		}
+		counts[userId] = count
+	}
+	return counts, rows.Err()
+}
+
+// GetSessionImpersonation returns the impersonation a session belongs to, or nil
+// for a user's own session
+func (d *Database) GetSessionImpersonation(sessionId string) (*Impersonation, error) {
+	imp := &Impersonation{}
+	var writable int
+	err := d.db.QueryRow(`
+		SELECT UserId, COALESCE(ImpersonatorId, 0), COALESCE(ImpersonationWritable, 0), ValidUntil
+		FROM Sessions WHERE Id = ?`, sessionId).Scan(&imp.UserId, &imp.AdminId, &writable, &imp.ValidUntil)
+	if err != nil {
+		return nil, err
+	}
+	if imp.AdminId == 0 {
+		return nil, nil
+	}
+	imp.Writable = writable == 1
+	return imp, nil
+}
+
+// GetSessionAuthTimes returns when a session was signed in to and when its
+// user last confirmed their identity in it (0 if never)
+func (d *Database) GetSessionAuthTimes(sessionId string) (createdAt, sudoAt int64, err error) {
+	err = d.db.QueryRow("SELECT COALESCE(CreatedAt, 0), COALESCE(SudoAt, 0) FROM Sessions WHERE Id = ?",
+		sessionId).Scan(&createdAt, &sudoAt)
+	return createdAt, sudoAt, err
+}
+
+// SetSessionSudo records that the user of a session just confirmed their identity
+func (d *Database) SetSessionSudo(sessionId string) error {
+	_, err := d.db.Exec("UPDATE Sessions SET SudoAt = ? WHERE Id = ?", time.Now().Unix(), sessionId)
+	return err
+}
+
+// TouchSession records that a session was just used
+func (d *Database) TouchSession(sessionId string) error {
+	_, err := d.db.Exec("UPDATE Sessions SET LastSeen = ? WHERE Id = ?", time.Now().Unix(), sessionId)
+	return err
+}
+
+// DeleteUserSession removes one session of a user
+func (d *Database) DeleteUserSession(userId int, sessionId string) error {
+	result, err := d.db.Exec("DELETE FROM Sessions WHERE Id = ? AND UserId = ?", sessionId, userId)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DeleteSessionsByUser removes all sessions of a user
+func (d *Database) DeleteSessionsByUser(userId int) (int64, error) {
+	result, err := d.db.Exec("DELETE FROM Sessions WHERE UserId = ?", userId)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// DeleteOtherSessions removes all sessions of a user except the given one
+func (d *Database) DeleteOtherSessions(userId int, keepSessionId string) (int64, error) {
+	result, err := d.db.Exec("DELETE FROM Sessions WHERE UserId = ? AND Id != ?", userId, keepSessionId)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
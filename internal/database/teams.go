@@ -75,6 +75,19 @@ func (d *Database) GetTeamByID(id int) (*models.Team, error) {
 	return team, nil
 }
 
+// GetTeamByName retrieves an active team by name (case-insensitive)
+func (d *Database) GetTeamByName(name string) (*models.Team, error) {
+	var id int
+	err := d.db.QueryRow(`SELECT Id FROM Teams WHERE Name = ? COLLATE NOCASE AND IsActive = 1`, name).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.New("team not found")
+		}
+		return nil, err
+	}
+	return d.GetTeamByID(id)
+}
+
 // GetAllTeams returns all active teams
 func (d *Database) GetAllTeams() ([]*models.Team, error) {
 	rows, err := d.db.Query(`
@@ -408,10 +421,13 @@ func (d *Database) GetFileTeamNames(fileIds []string) (map[string][]string, erro
 // GetFilesByUserWithTeams returns all files the user can access (own files + team files)
 func (d *Database) GetFilesByUserWithTeams(userId int) ([]*FileInfo, error) {
 	rows, err := d.db.Query(`
-		SELECT DISTINCT f.Id, f.Name, f.Size, f.SHA1, f.PasswordHash, f.FilePasswordPlain, f.HotlinkId,
+		SELECT DISTINCT f.Id, f.Name, f.Size, f.SHA1, f.PasswordHash, f.HotlinkId,
 		       f.ContentType, f.AwsBucket, f.ExpireAtString, f.ExpireAt, f.PendingDeletion,
 		       f.SizeBytes, f.UploadDate, f.DownloadsRemaining, f.DownloadCount, f.UserId, f.Comment,
-		       f.UnlimitedDownloads, f.UnlimitedTime, f.RequireAuth, f.DeletedAt, f.DeletedBy
+		       f.UnlimitedDownloads, f.UnlimitedTime, f.RequireAuth, f.DeletedAt, f.DeletedBy,
+		       COALESCE(f.LastVerifiedAt, 0), COALESCE(f.IntegrityStatus, ''),
+		       COALESCE(f.Compression, ''), COALESCE(f.StoredSizeBytes, 0), COALESCE(f.AllowMagicLink, 1),
+		       COALESCE(f.AllowedRecipients, ''), COALESCE(f.NotifyRejectedRecipients, 0)
 		FROM Files f
 		LEFT JOIN TeamFiles tf ON f.Id = tf.FileId
 		LEFT JOIN TeamMembers tm ON tf.TeamId = tm.TeamId
@@ -425,23 +441,24 @@ func (d *Database) GetFilesByUserWithTeams(userId int) ([]*FileInfo, error) {
 	var files []*FileInfo
 	for rows.Next() {
 		file := &FileInfo{}
-		var passwordHash, filePasswordPlain, hotlinkId, awsBucket, expireAtString, comment sql.NullString
+		var passwordHash, hotlinkId, awsBucket, expireAtString, comment sql.NullString
 		var pendingDeletion, expireAt, deletedAt, deletedBy sql.NullInt64
-		var unlimitedDownloads, unlimitedTime, requireAuth int
+		var unlimitedDownloads, unlimitedTime, requireAuth, allowMagicLink, notifyRejected int
 
 		err := rows.Scan(
-			&file.Id, &file.Name, &file.Size, &file.SHA1, &passwordHash, &filePasswordPlain,
+			&file.Id, &file.Name, &file.Size, &file.SHA1, &passwordHash,
 			&hotlinkId, &file.ContentType, &awsBucket, &expireAtString,
 			&expireAt, &pendingDeletion, &file.SizeBytes, &file.UploadDate,
 			&file.DownloadsRemaining, &file.DownloadCount, &file.UserId, &comment,
 			&unlimitedDownloads, &unlimitedTime, &requireAuth, &deletedAt, &deletedBy,
+			&file.LastVerifiedAt, &file.IntegrityStatus, &file.Compression, &file.StoredSizeBytes, &allowMagicLink,
+			&file.AllowedRecipients, &notifyRejected,
 		)
 		if err != nil {
 			return nil, err
 		}
 
 		file.PasswordHash = passwordHash.String
-		file.FilePasswordPlain = filePasswordPlain.String
 		file.HotlinkId = hotlinkId.String
 		file.AwsBucket = awsBucket.String
 		file.ExpireAtString = expireAtString.String
@@ -451,6 +468,8 @@ func (d *Database) GetFilesByUserWithTeams(userId int) ([]*FileInfo, error) {
 		file.UnlimitedDownloads = unlimitedDownloads == 1
 		file.UnlimitedTime = unlimitedTime == 1
 		file.RequireAuth = requireAuth == 1
+		file.AllowMagicLink = allowMagicLink == 1
+		file.NotifyRejections = notifyRejected == 1
 		file.DeletedAt = deletedAt.Int64
 		file.DeletedBy = int(deletedBy.Int64)
 
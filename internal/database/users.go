@@ -42,10 +42,11 @@ func (d *Database) CreateUser(user *models.User) error {
 
 	result, err := d.db.Exec(`
 		INSERT INTO Users (Name, Email, Password, Permissions, Userlevel, LastOnline, ResetPassword,
-		                   StorageQuotaMB, StorageUsedMB, CreatedAt, IsActive)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		                   StorageQuotaMB, StorageUsedMB, CreatedAt, IsActive, RoleId)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		user.Name, user.Email, user.Password, user.Permissions, user.UserLevel, user.LastOnline,
 		resetPw, user.StorageQuotaMB, user.StorageUsedMB, user.CreatedAt, isActive,
+		defaultRoleId(user.UserLevel),
 	)
 	if err != nil {
 		return err
@@ -326,6 +327,70 @@ func (d *Database) UpdateUserPassword(id int, hashedPassword string) error {
 	return err
 }
 
+// Authentication sources for users managed by an external identity provider.
+// Local accounts have an empty source.
+const (
+	AuthSourceLocal = ""
+	AuthSourceOIDC  = "oidc"
+	AuthSourceLDAP  = "ldap"
+)
+
+// GetUserByExternalID retrieves a user linked to an external identity
+func (d *Database) GetUserByExternalID(source, externalId string) (*models.User, error) {
+	if source == "" || externalId == "" {
+		return nil, errors.New("user not found")
+	}
+
+	var id int
+	err := d.db.QueryRow(`
+		SELECT Id FROM Users WHERE AuthSource = ? AND ExternalId = ? AND COALESCE(DeletedAt, 0) = 0`,
+		source, externalId).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors.New("user not found")
+		}
+		return nil, err
+	}
+
+	return d.GetUserByID(id)
+}
+
+// GetUserAuthSource returns where a user authenticates and their external ID
+func (d *Database) GetUserAuthSource(id int) (source string, externalId string, err error) {
+	err = d.db.QueryRow(`
+		SELECT COALESCE(AuthSource, ''), COALESCE(ExternalId, '') FROM Users WHERE Id = ?`, id).Scan(&source, &externalId)
+	return source, externalId, err
+}
+
+// GetExternalUserIDs returns the IDs of all non-deleted users linked to a source,
+// keyed by their external ID
+func (d *Database) GetExternalUserIDs(source string) (map[string]int, error) {
+	rows, err := d.db.Query(`
+		SELECT Id, ExternalId FROM Users
+		WHERE AuthSource = ? AND ExternalId != '' AND COALESCE(DeletedAt, 0) = 0`, source)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := map[string]int{}
+	for rows.Next() {
+		var id int
+		var externalId string
+		if err := rows.Scan(&id, &externalId); err != nil {
+			return nil, err
+		}
+		ids[externalId] = id
+	}
+	return ids, rows.Err()
+}
+
+// SetUserExternalIdentity links a user to an external identity
+func (d *Database) SetUserExternalIdentity(id int, source, externalId string) error {
+	_, err := d.db.Exec("UPDATE Users SET AuthSource = ?, ExternalId = ? WHERE Id = ?", source, externalId, id)
+	return err
+}
+
 // UpdateUserStorage updates a user's storage usage
 func (d *Database) UpdateUserStorage(id int, storageUsedMB int64) error {
 	_, err := d.db.Exec("UPDATE Users SET StorageUsedMB = ? WHERE Id = ?", storageUsedMB, id)
@@ -340,6 +405,11 @@ func (d *Database) DeleteUser(id int, deletedBy int) error {
 		return fmt.Errorf("failed to soft-delete user files: %w", err)
 	}
 
+	// Revoke the user's API keys
+	if err := d.DeleteApiKeysByUser(id); err != nil {
+		return fmt.Errorf("failed to revoke API keys: %w", err)
+	}
+
 	// Then delete the user
 	_, err := d.db.Exec("DELETE FROM Users WHERE Id = ?", id)
 	return err
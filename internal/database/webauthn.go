@@ -0,0 +1,177 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// WebAuthnCredential is a passkey or security key registered by a user
+type WebAuthnCredential struct {
+	Id              int
+	UserId          int
+	Name            string
+	CredentialId    []byte
+	PublicKey       []byte
+	AttestationType string
+	Transports      string // comma separated, as reported by the browser
+	AAGUID          []byte
+	SignCount       uint32
+	BackupEligible  bool
+	BackupState     bool
+	CreatedAt       int64
+	LastUsedAt      int64
+}
+
+const webAuthnCredentialColumns = `Id, UserId, Name, CredentialId, PublicKey, AttestationType, Transports,
+	AAGUID, SignCount, BackupEligible, BackupState, CreatedAt, LastUsedAt`
+
+func scanWebAuthnCredential(row interface{ Scan(...interface{}) error }) (*WebAuthnCredential, error) {
+	c := &WebAuthnCredential{}
+	var backupEligible, backupState int
+	err := row.Scan(&c.Id, &c.UserId, &c.Name, &c.CredentialId, &c.PublicKey, &c.AttestationType, &c.Transports,
+		&c.AAGUID, &c.SignCount, &backupEligible, &backupState, &c.CreatedAt, &c.LastUsedAt)
+	if err != nil {
+		return nil, err
+	}
+	c.BackupEligible = backupEligible == 1
+	c.BackupState = backupState == 1
+	return c, nil
+}
+
+// CreateWebAuthnCredential stores a newly registered credential
+func (d *Database) CreateWebAuthnCredential(c *WebAuthnCredential) error {
+	result, err := d.db.Exec(`
+		INSERT INTO WebAuthnCredentials (UserId, Name, CredentialId, PublicKey, AttestationType, Transports,
+			AAGUID, SignCount, BackupEligible, BackupState, CreatedAt, LastUsedAt)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		c.UserId, c.Name, c.CredentialId, c.PublicKey, c.AttestationType, c.Transports,
+		c.AAGUID, c.SignCount, boolToInt(c.BackupEligible), boolToInt(c.BackupState), c.CreatedAt, c.LastUsedAt)
+	if err != nil {
+		return fmt.Errorf("failed to store WebAuthn credential: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	c.Id = int(id)
+	return nil
+}
+
+// GetWebAuthnCredentials returns all credentials of a user, oldest first
+func (d *Database) GetWebAuthnCredentials(userId int) ([]*WebAuthnCredential, error) {
+	rows, err := d.db.Query(`SELECT `+webAuthnCredentialColumns+` FROM WebAuthnCredentials
+		WHERE UserId = ? ORDER BY CreatedAt, Id`, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var creds []*WebAuthnCredential
+	for rows.Next() {
+		c, err := scanWebAuthnCredential(rows)
+		if err != nil {
+			return nil, err
+		}
+		creds = append(creds, c)
+	}
+	return creds, rows.Err()
+}
+
+// CountWebAuthnCredentials returns how many credentials a user has registered
+func (d *Database) CountWebAuthnCredentials(userId int) (int, error) {
+	var count int
+	err := d.db.QueryRow("SELECT COUNT(*) FROM WebAuthnCredentials WHERE UserId = ?", userId).Scan(&count)
+	return count, err
+}
+
+// GetWebAuthnCredentialCounts returns the number of credentials per user, for users that have any
+func (d *Database) GetWebAuthnCredentialCounts() (map[int]int, error) {
+	rows, err := d.db.Query("SELECT UserId, COUNT(*) FROM WebAuthnCredentials GROUP BY UserId")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[int]int{}
+	for rows.Next() {
+		var userId, count int
+		if err := rows.Scan(&userId, &count); err != nil {
+			return nil, err
+		}
+		counts[userId] = count
+	}
+	return counts, rows.Err()
+}
+
+// RenameWebAuthnCredential changes the name of one of a user's credentials
+func (d *Database) RenameWebAuthnCredential(id, userId int, name string) error {
+	result, err := d.db.Exec("UPDATE WebAuthnCredentials SET Name = ? WHERE Id = ? AND UserId = ?", name, id, userId)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DeleteWebAuthnCredential removes one of a user's credentials
+func (d *Database) DeleteWebAuthnCredential(id, userId int) error {
+	result, err := d.db.Exec("DELETE FROM WebAuthnCredentials WHERE Id = ? AND UserId = ?", id, userId)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DeleteWebAuthnCredentials removes all credentials of a user
+func (d *Database) DeleteWebAuthnCredentials(userId int) (int64, error) {
+	result, err := d.db.Exec("DELETE FROM WebAuthnCredentials WHERE UserId = ?", userId)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// UpdateWebAuthnCredentialUse records a successful assertion
+func (d *Database) UpdateWebAuthnCredentialUse(id int, signCount uint32, backupState bool, usedAt int64) error {
+	_, err := d.db.Exec(`
+		UPDATE WebAuthnCredentials SET SignCount = ?, BackupState = ?, LastUsedAt = ? WHERE Id = ?`,
+		signCount, boolToInt(backupState), usedAt, id)
+	return err
+}
+
+// GetWebAuthnHandle returns the WebAuthn user handle of a user, or "" if none was assigned yet
+func (d *Database) GetWebAuthnHandle(userId int) (string, error) {
+	var handle sql.NullString
+	err := d.db.QueryRow("SELECT WebAuthnHandle FROM Users WHERE Id = ?", userId).Scan(&handle)
+	return handle.String, err
+}
+
+// SetWebAuthnHandle assigns a WebAuthn user handle, unless the user already has one
+func (d *Database) SetWebAuthnHandle(userId int, handle string) error {
+	_, err := d.db.Exec(`
+		UPDATE Users SET WebAuthnHandle = ?
+		WHERE Id = ? AND (WebAuthnHandle IS NULL OR WebAuthnHandle = '')`, handle, userId)
+	return err
+}
+
+// GetUserIDByWebAuthnHandle resolves the user handle returned by a discoverable credential
+func (d *Database) GetUserIDByWebAuthnHandle(handle string) (int, error) {
+	if handle == "" {
+		return 0, errors.New("empty user handle")
+	}
+	var id int
+	err := d.db.QueryRow("SELECT Id FROM Users WHERE WebAuthnHandle = ?", handle).Scan(&id)
+	return id, err
+}
@@ -0,0 +1,77 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+// Package directory authenticates staff users against an LDAP or Active Directory
+// server and keeps accounts and team memberships in sync with directory groups.
+package directory
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/Frimurare/WulfVault/internal/auth"
+	"github.com/Frimurare/WulfVault/internal/database"
+)
+
+// ErrInvalidCredentials is returned when the directory rejects a login
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// Entry is a user as found in the directory
+type Entry struct {
+	ID       string // Stable unique ID (e.g. objectGUID)
+	DN       string
+	Username string
+	Email    string
+	Name     string
+	Groups   []string // Group DNs the user belongs to
+}
+
+// Directory is a source of users. The LDAP implementation is returned by Connect;
+// tests use an in-memory stand-in.
+type Directory interface {
+	// Authenticate verifies a user's password and returns their entry
+	Authenticate(username, password string) (*Entry, error)
+	// ListUsers returns every user matching the configured filter
+	ListUsers() ([]*Entry, error)
+}
+
+// InGroup reports whether the entry belongs to a group, given either as a full
+// DN or as the group's CN
+func (e *Entry) InGroup(group string) bool {
+	for _, g := range e.Groups {
+		if strings.EqualFold(g, group) || strings.EqualFold(groupCN(g), group) {
+			return true
+		}
+	}
+	return false
+}
+
+// groupCN returns the value of the first RDN of a DN, e.g. "Staff" for
+// "CN=Staff,OU=Groups,DC=example,DC=com"
+func groupCN(dn string) string {
+	first := strings.SplitN(dn, ",", 2)[0]
+	if eq := strings.Index(first, "="); eq >= 0 {
+		return strings.TrimSpace(first[eq+1:])
+	}
+	return dn
+}
+
+// Identity converts a directory entry to an external identity. Roles are only
+// managed by the directory when an admin group is configured.
+func (s *Settings) Identity(e *Entry) *auth.ExternalIdentity {
+	id := &auth.ExternalIdentity{
+		Source:  database.AuthSourceLDAP,
+		Subject: e.ID,
+		Email:   e.Email,
+		Name:    e.Name,
+		// Directory entries are maintained by the organization's admins
+		EmailVerified: true,
+	}
+	if s.AdminGroup != "" {
+		isAdmin := e.InGroup(s.AdminGroup)
+		id.IsAdmin = &isAdmin
+	}
+	return id
+}
@@ -0,0 +1,184 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package directory
+
+import (
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+const (
+	ldapTimeout  = 10 * time.Second
+	ldapPageSize = 500
+)
+
+// ldapDirectory is a Directory backed by an LDAP or Active Directory server
+type ldapDirectory struct {
+	settings *Settings
+}
+
+// Connect returns the LDAP directory for the given settings
+func Connect(settings *Settings) Directory {
+	return &ldapDirectory{settings: settings}
+}
+
+// dial opens a connection, upgrading it with StartTLS when configured
+func (d *ldapDirectory) dial() (*ldap.Conn, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: d.settings.InsecureSkipVerify}
+	if host, _, err := net.SplitHostPort(strings.TrimPrefix(strings.TrimPrefix(d.settings.URL, "ldaps://"), "ldap://")); err == nil {
+		tlsConfig.ServerName = host
+	}
+
+	conn, err := ldap.DialURL(d.settings.URL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: ldapTimeout}),
+		ldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, fmt.Errorf("connect to %s: %w", d.settings.URL, err)
+	}
+	conn.SetTimeout(ldapTimeout)
+
+	if d.settings.StartTLS && strings.HasPrefix(strings.ToLower(d.settings.URL), "ldap://") {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("StartTLS: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+// serviceBind dials and binds with the service account, or anonymously if none is set
+func (d *ldapDirectory) serviceBind() (*ldap.Conn, error) {
+	conn, err := d.dial()
+	if err != nil {
+		return nil, err
+	}
+
+	if d.settings.BindDN != "" {
+		err = conn.Bind(d.settings.BindDN, d.settings.BindPassword)
+	} else {
+		err = conn.UnauthenticatedBind("")
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("service account bind: %w", err)
+	}
+	return conn, nil
+}
+
+// attributes lists the attributes read for every user
+func (d *ldapDirectory) attributes() []string {
+	s := d.settings
+	return []string{s.IDAttribute, s.LoginAttribute, s.EmailAttribute, s.NameAttribute, s.GroupAttribute}
+}
+
+// search runs a paged search below the base DN
+func (d *ldapDirectory) search(conn *ldap.Conn, filter string, sizeLimit int) ([]*ldap.Entry, error) {
+	req := ldap.NewSearchRequest(
+		d.settings.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		sizeLimit, int(ldapTimeout.Seconds()), false,
+		filter, d.attributes(), nil)
+
+	result, err := conn.SearchWithPaging(req, ldapPageSize)
+	if err != nil {
+		return nil, err
+	}
+	return result.Entries, nil
+}
+
+// Authenticate finds the user with the service account, then binds as the user
+// to verify the password
+func (d *ldapDirectory) Authenticate(username, password string) (*Entry, error) {
+	// An empty password would be an unauthenticated bind, which servers accept
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := d.serviceBind()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	// Users may type either their login name or their email address
+	escaped := ldap.EscapeFilter(username)
+	filter := fmt.Sprintf("(&%s(|(%s=%s)(%s=%s)))", d.settings.UserFilter,
+		d.settings.LoginAttribute, escaped, d.settings.EmailAttribute, escaped)
+
+	entries, err := d.search(conn, filter, 2)
+	if err != nil {
+		return nil, fmt.Errorf("user search: %w", err)
+	}
+	if len(entries) != 1 {
+		return nil, ErrInvalidCredentials
+	}
+
+	if err := conn.Bind(entries[0].DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("user bind: %w", err)
+	}
+
+	entry := d.toEntry(entries[0])
+	if entry.ID == "" || entry.Email == "" {
+		return nil, errors.New("directory entry has no unique ID or email address")
+	}
+	return entry, nil
+}
+
+// ListUsers returns all users matching the user filter
+func (d *ldapDirectory) ListUsers() ([]*Entry, error) {
+	conn, err := d.serviceBind()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	results, err := d.search(conn, d.settings.UserFilter, 0)
+	if err != nil {
+		return nil, fmt.Errorf("user search: %w", err)
+	}
+
+	entries := make([]*Entry, 0, len(results))
+	for _, r := range results {
+		if e := d.toEntry(r); e.ID != "" && e.Email != "" {
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+// toEntry converts an LDAP search result using the configured attribute names
+func (d *ldapDirectory) toEntry(e *ldap.Entry) *Entry {
+	s := d.settings
+	return &Entry{
+		ID:       idValue(s.IDAttribute, e.GetRawAttributeValue(s.IDAttribute)),
+		DN:       e.DN,
+		Username: e.GetAttributeValue(s.LoginAttribute),
+		Email:    strings.TrimSpace(e.GetAttributeValue(s.EmailAttribute)),
+		Name:     strings.TrimSpace(e.GetAttributeValue(s.NameAttribute)),
+		Groups:   e.GetAttributeValues(s.GroupAttribute),
+	}
+}
+
+// idValue returns a unique ID as text; binary IDs such as objectGUID are hex encoded
+func idValue(attribute string, raw []byte) string {
+	if len(raw) == 0 {
+		return ""
+	}
+	if strings.EqualFold(attribute, "objectGUID") || !utf8.Valid(raw) {
+		return hex.EncodeToString(raw)
+	}
+	return string(raw)
+}
@@ -0,0 +1,173 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package directory
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/Frimurare/WulfVault/internal/database"
+	"github.com/Frimurare/WulfVault/internal/email"
+	"github.com/Frimurare/WulfVault/internal/models"
+)
+
+// Defaults suitable for Active Directory
+const (
+	DefaultUserFilter          = "(&(objectClass=user)(!(userAccountControl:1.2.840.113556.1.4.803:=2)))"
+	DefaultLoginAttribute      = "sAMAccountName"
+	DefaultEmailAttribute      = "mail"
+	DefaultNameAttribute       = "displayName"
+	DefaultIDAttribute         = "objectGUID"
+	DefaultGroupAttribute      = "memberOf"
+	DefaultSyncIntervalMinutes = 60
+)
+
+// Settings is the LDAP configuration stored in the Configuration table
+type Settings struct {
+	Enabled             bool
+	URL                 string // ldap://host:389 or ldaps://host:636
+	StartTLS            bool
+	InsecureSkipVerify  bool
+	BindDN              string
+	BindPassword        string
+	BaseDN              string
+	UserFilter          string
+	LoginAttribute      string
+	EmailAttribute      string
+	NameAttribute       string
+	IDAttribute         string
+	GroupAttribute      string
+	AdminGroup          string
+	GroupMappings       string // One "group = Team Name : role" per line
+	SyncIntervalMinutes int
+	AutoProvision       bool
+}
+
+// GroupMapping maps a directory group to a team role
+type GroupMapping struct {
+	Group    string
+	TeamName string
+	Role     models.TeamRole
+}
+
+// LoadSettings reads the LDAP settings, applying defaults for unset values
+func LoadSettings() *Settings {
+	get := func(key, fallback string) string {
+		value, err := database.DB.GetConfigValue(key)
+		if err != nil || value == "" {
+			return fallback
+		}
+		return value
+	}
+
+	interval, err := strconv.Atoi(get("ldap_sync_interval_minutes", ""))
+	if err != nil || interval < 0 {
+		interval = DefaultSyncIntervalMinutes
+	}
+
+	s := &Settings{
+		Enabled:             get("ldap_enabled", "false") == "true",
+		URL:                 get("ldap_url", ""),
+		StartTLS:            get("ldap_start_tls", "false") == "true",
+		InsecureSkipVerify:  get("ldap_insecure_skip_verify", "false") == "true",
+		BindDN:              get("ldap_bind_dn", ""),
+		BaseDN:              get("ldap_base_dn", ""),
+		UserFilter:          get("ldap_user_filter", DefaultUserFilter),
+		LoginAttribute:      get("ldap_login_attribute", DefaultLoginAttribute),
+		EmailAttribute:      get("ldap_email_attribute", DefaultEmailAttribute),
+		NameAttribute:       get("ldap_name_attribute", DefaultNameAttribute),
+		IDAttribute:         get("ldap_id_attribute", DefaultIDAttribute),
+		GroupAttribute:      get("ldap_group_attribute", DefaultGroupAttribute),
+		AdminGroup:          get("ldap_admin_group", ""),
+		GroupMappings:       get("ldap_group_mappings", ""),
+		SyncIntervalMinutes: interval,
+		AutoProvision:       get("ldap_auto_provision", "true") == "true",
+	}
+
+	if encrypted := get("ldap_bind_password", ""); encrypted != "" {
+		masterKey, err := email.GetOrCreateMasterKey(database.DB)
+		if err == nil {
+			s.BindPassword, err = email.DecryptAPIKey(encrypted, masterKey)
+		}
+		if err != nil {
+			log.Printf("Warning: Could not decrypt LDAP bind password: %v", err)
+		}
+	}
+
+	return s
+}
+
+// Configured reports whether LDAP is enabled and has the minimum required settings
+func (s *Settings) Configured() bool {
+	return s.Enabled && s.URL != "" && s.BaseDN != ""
+}
+
+// Mappings parses the group mapping lines. Lines have the form
+// "group = Team Name : role" where role is owner, admin or member (default).
+func (s *Settings) Mappings() ([]GroupMapping, error) {
+	var mappings []GroupMapping
+	for i, line := range strings.Split(s.GroupMappings, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// Group DNs contain '=' themselves, so split on the last " = "
+		sep := strings.LastIndex(line, " = ")
+		if sep < 0 {
+			return nil, fmt.Errorf("line %d: expected \"group = Team Name : role\"", i+1)
+		}
+		group := strings.TrimSpace(line[:sep])
+		target := strings.TrimSpace(line[sep+3:])
+
+		role := models.TeamRoleMember
+		if colon := strings.LastIndex(target, ":"); colon >= 0 {
+			var err error
+			role, err = parseRole(target[colon+1:])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", i+1, err)
+			}
+			target = strings.TrimSpace(target[:colon])
+		}
+
+		if group == "" || target == "" {
+			return nil, fmt.Errorf("line %d: group and team name are required", i+1)
+		}
+		mappings = append(mappings, GroupMapping{Group: group, TeamName: target, Role: role})
+	}
+	return mappings, nil
+}
+
+func parseRole(s string) (models.TeamRole, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "owner":
+		return models.TeamRoleOwner, nil
+	case "admin":
+		return models.TeamRoleAdmin, nil
+	case "member", "":
+		return models.TeamRoleMember, nil
+	}
+	return 0, fmt.Errorf("unknown role %q (use owner, admin or member)", strings.TrimSpace(s))
+}
+
+// SaveBindPassword stores the bind password encrypted with the server master key
+func SaveBindPassword(password string) error {
+	if password == "" {
+		return database.DB.SetConfigValue("ldap_bind_password", "")
+	}
+
+	masterKey, err := email.GetOrCreateMasterKey(database.DB)
+	if err != nil {
+		return err
+	}
+	encrypted, err := email.EncryptAPIKey(password, masterKey)
+	if err != nil {
+		return err
+	}
+	return database.DB.SetConfigValue("ldap_bind_password", encrypted)
+}
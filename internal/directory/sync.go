@@ -0,0 +1,331 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package directory
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Frimurare/WulfVault/internal/auth"
+	"github.com/Frimurare/WulfVault/internal/database"
+	"github.com/Frimurare/WulfVault/internal/models"
+)
+
+// Report summarises a directory sync
+type Report struct {
+	StartedAt      time.Time
+	DirectoryUsers int
+	Provisioned    int
+	Deactivated    int
+	Skipped        int // Directory users without an account (provisioning off) or disabled locally
+	MembersAdded   int
+	RolesChanged   int
+	MembersRemoved int
+	Errors         []string
+}
+
+func (r *Report) errorf(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	log.Printf("LDAP sync: %s", msg)
+	r.Errors = append(r.Errors, msg)
+}
+
+// String returns a one-line summary
+func (r *Report) String() string {
+	return fmt.Sprintf("%d directory users, %d provisioned, %d deactivated, %d skipped, team members: %d added, %d role changes, %d removed, %d errors",
+		r.DirectoryUsers, r.Provisioned, r.Deactivated, r.Skipped,
+		r.MembersAdded, r.RolesChanged, r.MembersRemoved, len(r.Errors))
+}
+
+// Sync reconciles accounts and team memberships with the directory:
+//   - directory users are linked to (or provisioned as) local accounts
+//   - LDAP-linked accounts no longer in the directory are deactivated
+//   - members of mapped groups are added to the team with the mapped role; the
+//     highest role wins when several groups map to the same team
+//   - LDAP-linked team members no longer in any mapped group are removed
+//
+// Locally managed accounts and memberships are never touched. Every change is
+// written to the audit log as the system user.
+func Sync(dir Directory, settings *Settings, defaultQuotaMB int64) (*Report, error) {
+	report := &Report{StartedAt: time.Now()}
+
+	mappings, err := settings.Mappings()
+	if err != nil {
+		return nil, fmt.Errorf("invalid group mappings: %w", err)
+	}
+
+	entries, err := dir.ListUsers()
+	if err != nil {
+		return nil, err
+	}
+	// An empty result is far more likely a wrong filter or base DN than an empty
+	// directory; do not deactivate every LDAP account because of it
+	if len(entries) == 0 {
+		return nil, errors.New("directory returned no users; check the base DN and user filter")
+	}
+	report.DirectoryUsers = len(entries)
+
+	linked, err := database.DB.GetExternalUserIDs(database.AuthSourceLDAP)
+	if err != nil {
+		return nil, err
+	}
+
+	// Link or provision every directory user
+	present := map[string]bool{}
+	active := map[int]*Entry{}
+	for _, entry := range entries {
+		present[entry.ID] = true
+
+		user, created, err := auth.ResolveExternalUser(settings.Identity(entry), settings.AutoProvision, defaultQuotaMB)
+		if err != nil {
+			if !errors.Is(err, auth.ErrNoLocalAccount) && !errors.Is(err, auth.ErrAccountDisabled) {
+				report.errorf("%s: %v", entry.Email, err)
+			}
+			report.Skipped++
+			continue
+		}
+		active[user.Id] = entry
+
+		if created {
+			report.Provisioned++
+			logSystemAction(database.ActionUserCreated, database.EntityUser, user.Id, map[string]interface{}{
+				"email":       user.Email,
+				"name":        user.Name,
+				"user_level":  int(user.UserLevel),
+				"quota_mb":    user.StorageQuotaMB,
+				"provisioned": "ldap",
+			})
+		}
+	}
+
+	// Deactivate accounts that have left the directory
+	for externalId, userId := range linked {
+		if present[externalId] {
+			continue
+		}
+		user, err := database.DB.GetUserByID(userId)
+		if err != nil || !user.IsActive || user.UserLevel == models.UserLevelSuperAdmin {
+			continue
+		}
+
+		user.IsActive = false
+		if err := database.DB.UpdateUser(user); err != nil {
+			report.errorf("deactivate %s: %v", user.Email, err)
+			continue
+		}
+		auth.DeleteUserSessions(user.Id)
+		report.Deactivated++
+		logSystemAction(database.ActionUserDeactivated, database.EntityUser, user.Id, map[string]interface{}{
+			"email":  user.Email,
+			"reason": "removed from directory",
+		})
+	}
+
+	// Reconcile mapped teams. Re-read the links so newly provisioned users count.
+	linked, err = database.DB.GetExternalUserIDs(database.AuthSourceLDAP)
+	if err != nil {
+		return nil, err
+	}
+	ldapUsers := map[int]bool{}
+	for _, userId := range linked {
+		ldapUsers[userId] = true
+	}
+
+	for _, teamName := range mappedTeams(mappings) {
+		team, err := database.DB.GetTeamByName(teamName)
+		if err != nil {
+			report.errorf("team %q: %v", teamName, err)
+			continue
+		}
+		syncTeam(team, desiredRoles(team.Name, mappings, active), ldapUsers, report)
+	}
+
+	logSystemAction(database.ActionDirectorySync, database.EntitySystem, 0, map[string]interface{}{
+		"directory_users": report.DirectoryUsers,
+		"provisioned":     report.Provisioned,
+		"deactivated":     report.Deactivated,
+		"skipped":         report.Skipped,
+		"members_added":   report.MembersAdded,
+		"roles_changed":   report.RolesChanged,
+		"members_removed": report.MembersRemoved,
+		"errors":          len(report.Errors),
+	})
+
+	database.DB.SetConfigValue("ldap_last_sync", strconv.FormatInt(report.StartedAt.Unix(), 10))
+	database.DB.SetConfigValue("ldap_last_sync_result", report.String())
+
+	return report, nil
+}
+
+// mappedTeams returns the distinct team names in the mappings
+func mappedTeams(mappings []GroupMapping) []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, m := range mappings {
+		key := strings.ToLower(m.TeamName)
+		if !seen[key] {
+			seen[key] = true
+			names = append(names, m.TeamName)
+		}
+	}
+	return names
+}
+
+// desiredRoles returns the role each directory user should have in a team
+func desiredRoles(teamName string, mappings []GroupMapping, active map[int]*Entry) map[int]models.TeamRole {
+	desired := map[int]models.TeamRole{}
+	for userId, entry := range active {
+		for _, m := range mappings {
+			if !strings.EqualFold(m.TeamName, teamName) || !entry.InGroup(m.Group) {
+				continue
+			}
+			// Lower values are higher roles (Owner = 0)
+			if role, ok := desired[userId]; !ok || m.Role < role {
+				desired[userId] = m.Role
+			}
+		}
+	}
+	return desired
+}
+
+// syncTeam applies the desired memberships to one team
+func syncTeam(team *models.Team, desired map[int]models.TeamRole, ldapUsers map[int]bool, report *Report) {
+	members, err := database.DB.GetTeamMembers(team.Id)
+	if err != nil {
+		report.errorf("team %q: %v", team.Name, err)
+		return
+	}
+
+	current := map[int]*models.TeamMember{}
+	for _, member := range members {
+		current[member.UserId] = member
+	}
+
+	for _, member := range members {
+		role, wanted := desired[member.UserId]
+		switch {
+		case wanted && role != member.Role:
+			if err := database.DB.UpdateTeamMemberRole(team.Id, member.UserId, role); err != nil {
+				report.errorf("team %q: change role of %s: %v", team.Name, member.UserEmail, err)
+				continue
+			}
+			report.RolesChanged++
+			logSystemAction(database.ActionTeamMemberRoleChanged, database.EntityTeam, team.Id, map[string]interface{}{
+				"team_name":    team.Name,
+				"member_id":    member.UserId,
+				"member_email": member.UserEmail,
+				"old_role":     int(member.Role),
+				"new_role":     int(role),
+				"source":       "ldap",
+			})
+		case !wanted && ldapUsers[member.UserId]:
+			if err := database.DB.RemoveTeamMember(team.Id, member.UserId); err != nil {
+				report.errorf("team %q: remove %s: %v", team.Name, member.UserEmail, err)
+				continue
+			}
+			report.MembersRemoved++
+			logSystemAction(database.ActionTeamMemberRemoved, database.EntityTeam, team.Id, map[string]interface{}{
+				"team_name":    team.Name,
+				"member_id":    member.UserId,
+				"member_email": member.UserEmail,
+				"source":       "ldap",
+			})
+		}
+	}
+
+	for userId, role := range desired {
+		if current[userId] != nil {
+			continue
+		}
+
+		// Members of deactivated accounts are hidden from GetTeamMembers but still stored
+		if existing, err := database.DB.GetTeamMember(team.Id, userId); err == nil {
+			if existing.Role != role {
+				database.DB.UpdateTeamMemberRole(team.Id, userId, role)
+			}
+			continue
+		}
+
+		// AddedBy must reference a user; the audit entry records the sync as the actor
+		member := &models.TeamMember{TeamId: team.Id, UserId: userId, Role: role, AddedBy: team.CreatedBy}
+		if err := database.DB.AddTeamMember(member); err != nil {
+			report.errorf("team %q: add user %d: %v", team.Name, userId, err)
+			continue
+		}
+		report.MembersAdded++
+
+		email := ""
+		if user, err := database.DB.GetUserByID(userId); err == nil {
+			email = user.Email
+		}
+		logSystemAction(database.ActionTeamMemberAdded, database.EntityTeam, team.Id, map[string]interface{}{
+			"team_name":    team.Name,
+			"member_id":    userId,
+			"member_email": email,
+			"role":         int(role),
+			"source":       "ldap",
+		})
+	}
+}
+
+// logSystemAction writes an audit entry attributed to the system user
+func logSystemAction(action, entityType string, entityId int, details map[string]interface{}) {
+	database.DB.LogAction(&database.AuditLogEntry{
+		UserID:     0,
+		UserEmail:  "system",
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   strconv.Itoa(entityId),
+		Details:    database.CreateAuditDetails(details),
+		Success:    true,
+	})
+}
+
+// StartSyncScheduler checks every interval whether a sync is due according to the
+// configured sync interval, so changes to the settings apply without a restart.
+// New users get the default_quota_mb setting, or defaultQuotaMB if it is unset.
+func StartSyncScheduler(defaultQuotaMB int64, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			settings := LoadSettings()
+			if !settings.Configured() || settings.SyncIntervalMinutes == 0 {
+				continue
+			}
+
+			last, _ := database.DB.GetConfigValue("ldap_last_sync")
+			lastUnix, _ := strconv.ParseInt(last, 10, 64)
+			if time.Since(time.Unix(lastUnix, 0)) < time.Duration(settings.SyncIntervalMinutes)*time.Minute {
+				continue
+			}
+
+			quotaMB := defaultQuotaMB
+			if v, err := database.DB.GetConfigValue("default_quota_mb"); err == nil && v != "" {
+				if mb, err := strconv.ParseInt(v, 10, 64); err == nil && mb > 0 {
+					quotaMB = mb
+				}
+			}
+
+			report, err := Sync(Connect(settings), settings, quotaMB)
+			if err != nil {
+				log.Printf("LDAP sync failed: %v", err)
+				// Record the attempt so a broken server is not retried every tick
+				database.DB.SetConfigValue("ldap_last_sync", strconv.FormatInt(time.Now().Unix(), 10))
+				database.DB.SetConfigValue("ldap_last_sync_result", "Failed: "+err.Error())
+				continue
+			}
+			log.Printf("LDAP sync complete: %s", report)
+		}
+	}()
+
+	log.Printf("LDAP sync scheduler started (check interval: %v)", interval)
+}
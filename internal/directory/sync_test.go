@@ -0,0 +1,220 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package directory
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Frimurare/WulfVault/internal/database"
+	"github.com/Frimurare/WulfVault/internal/models"
+)
+
+// memoryDirectory is an in-process stand-in for an LDAP server
+type memoryDirectory struct {
+	users     []*Entry
+	passwords map[string]string
+}
+
+func (m *memoryDirectory) Authenticate(username, password string) (*Entry, error) {
+	for _, e := range m.users {
+		if (strings.EqualFold(e.Username, username) || strings.EqualFold(e.Email, username)) &&
+			password != "" && m.passwords[e.Username] == password {
+			return e, nil
+		}
+	}
+	return nil, ErrInvalidCredentials
+}
+
+func (m *memoryDirectory) ListUsers() ([]*Entry, error) {
+	return m.users, nil
+}
+
+const (
+	financeGroup = "CN=Finance,OU=Groups,DC=example,DC=com"
+	leadsGroup   = "CN=Finance Leads,OU=Groups,DC=example,DC=com"
+	adminsGroup  = "CN=WulfVault Admins,OU=Groups,DC=example,DC=com"
+)
+
+func setupDatabase(t *testing.T) {
+	t.Helper()
+	if err := database.Initialize(t.TempDir()); err != nil {
+		t.Fatalf("initialize database: %v", err)
+	}
+	t.Cleanup(func() { database.DB.Close() })
+}
+
+func createLocalUser(t *testing.T, name, email string) *models.User {
+	t.Helper()
+	user := &models.User{Name: name, Email: email, Password: "x", UserLevel: models.UserLevelUser, IsActive: true}
+	if err := database.DB.CreateUser(user); err != nil {
+		t.Fatalf("create user %s: %v", email, err)
+	}
+	return user
+}
+
+func countActions(t *testing.T, action string) int {
+	t.Helper()
+	n, err := database.DB.GetAuditLogCount(&database.AuditLogFilter{Action: action})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestSync(t *testing.T) {
+	setupDatabase(t)
+
+	carol := createLocalUser(t, "Carol", "carol@example.com")
+	bob := createLocalUser(t, "Bob", "bob@example.com")
+
+	team := &models.Team{Name: "Finance", CreatedBy: carol.Id, IsActive: true}
+	if err := database.DB.CreateTeam(team); err != nil {
+		t.Fatal(err)
+	}
+
+	alice := &Entry{ID: "guid-alice", Username: "alice", Email: "alice@example.com", Name: "Alice", Groups: []string{financeGroup, leadsGroup}}
+	bobEntry := &Entry{ID: "guid-bob", Username: "bob", Email: "Bob@Example.com", Name: "Bob", Groups: []string{financeGroup}}
+	dave := &Entry{ID: "guid-dave", Username: "dave", Email: "dave@example.com", Name: "Dave", Groups: []string{adminsGroup}}
+	dir := &memoryDirectory{users: []*Entry{alice, bobEntry, dave}}
+
+	settings := &Settings{
+		AdminGroup:    "WulfVault Admins",
+		GroupMappings: financeGroup + " = Finance : member\nFinance Leads = Finance : owner",
+		AutoProvision: true,
+	}
+
+	report, err := Sync(dir, settings, 500)
+	if err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if len(report.Errors) > 0 {
+		t.Fatalf("sync errors: %v", report.Errors)
+	}
+	if report.Provisioned != 2 || report.MembersAdded != 2 {
+		t.Errorf("unexpected report: %s", report)
+	}
+
+	aliceUser, err := database.DB.GetUserByEmail("alice@example.com")
+	if err != nil {
+		t.Fatalf("alice not provisioned: %v", err)
+	}
+	if aliceUser.StorageQuotaMB != 500 {
+		t.Errorf("alice quota = %d, want 500", aliceUser.StorageQuotaMB)
+	}
+	daveUser, _ := database.DB.GetUserByEmail("dave@example.com")
+	if daveUser == nil || daveUser.UserLevel != models.UserLevelAdmin {
+		t.Error("admin group member not provisioned as admin")
+	}
+	if source, externalId, _ := database.DB.GetUserAuthSource(bob.Id); source != database.AuthSourceLDAP || externalId != "guid-bob" {
+		t.Errorf("existing user not linked: %q %q", source, externalId)
+	}
+
+	roles := teamRoles(t, team.Id)
+	if roles[aliceUser.Id] != models.TeamRoleOwner {
+		t.Errorf("alice role = %v, want owner (highest mapped role)", roles[aliceUser.Id])
+	}
+	if roles[bob.Id] != models.TeamRoleMember {
+		t.Errorf("bob role = %v, want member", roles[bob.Id])
+	}
+	if _, ok := roles[carol.Id]; !ok {
+		t.Error("local team owner was removed")
+	}
+
+	// Alice leaves the company, Bob leaves the finance group and Dave is demoted
+	bobEntry.Groups = nil
+	dave.Groups = nil
+	dir.users = []*Entry{bobEntry, dave}
+
+	report, err = Sync(dir, settings, 500)
+	if err != nil {
+		t.Fatalf("second sync: %v", err)
+	}
+	if report.Deactivated != 1 || report.MembersRemoved != 1 {
+		t.Errorf("unexpected report: %s", report)
+	}
+
+	aliceUser, _ = database.DB.GetUserByID(aliceUser.Id)
+	if aliceUser.IsActive {
+		t.Error("user removed from directory is still active")
+	}
+	daveUser, _ = database.DB.GetUserByID(daveUser.Id)
+	if daveUser.UserLevel != models.UserLevelUser {
+		t.Error("admin role not removed")
+	}
+
+	roles = teamRoles(t, team.Id)
+	if _, ok := roles[bob.Id]; ok {
+		t.Error("bob still in team after leaving the mapped group")
+	}
+	if _, ok := roles[carol.Id]; !ok {
+		t.Error("local team owner was removed")
+	}
+
+	if n := countActions(t, database.ActionTeamMemberAdded); n != 2 {
+		t.Errorf("TEAM_MEMBER_ADDED audit entries = %d, want 2", n)
+	}
+	if n := countActions(t, database.ActionTeamMemberRemoved); n != 1 {
+		t.Errorf("TEAM_MEMBER_REMOVED audit entries = %d, want 1", n)
+	}
+	if n := countActions(t, database.ActionUserDeactivated); n != 1 {
+		t.Errorf("USER_DEACTIVATED audit entries = %d, want 1", n)
+	}
+	if n := countActions(t, database.ActionDirectorySync); n != 2 {
+		t.Errorf("DIRECTORY_SYNC audit entries = %d, want 2", n)
+	}
+
+	// An empty result must not deactivate everyone
+	if _, err := Sync(&memoryDirectory{}, settings, 500); err == nil {
+		t.Error("sync accepted an empty directory")
+	}
+	if bobUser, _ := database.DB.GetUserByID(bob.Id); !bobUser.IsActive {
+		t.Error("user deactivated by an empty sync")
+	}
+}
+
+func teamRoles(t *testing.T, teamId int) map[int]models.TeamRole {
+	t.Helper()
+	members, err := database.DB.GetTeamMembers(teamId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roles := map[int]models.TeamRole{}
+	for _, m := range members {
+		roles[m.UserId] = m.Role
+	}
+	return roles
+}
+
+func TestMappings(t *testing.T) {
+	s := &Settings{GroupMappings: "# comment\n" + financeGroup + " = Finance : Admin\nStaff = All Staff\n"}
+	mappings, err := s.Mappings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mappings) != 2 {
+		t.Fatalf("got %d mappings, want 2", len(mappings))
+	}
+	if mappings[0].Group != financeGroup || mappings[0].TeamName != "Finance" || mappings[0].Role != models.TeamRoleAdmin {
+		t.Errorf("unexpected mapping: %+v", mappings[0])
+	}
+	if mappings[1].TeamName != "All Staff" || mappings[1].Role != models.TeamRoleMember {
+		t.Errorf("unexpected mapping: %+v", mappings[1])
+	}
+
+	for _, bad := range []string{"no separator", "Staff = Team : superuser"} {
+		if _, err := (&Settings{GroupMappings: bad}).Mappings(); err == nil {
+			t.Errorf("mapping %q accepted", bad)
+		}
+	}
+}
+
+func TestAuthenticateRejectsEmptyPassword(t *testing.T) {
+	d := Connect(&Settings{URL: "ldap://127.0.0.1:1", BaseDN: "DC=example,DC=com"})
+	if _, err := d.Authenticate("alice", ""); err != ErrInvalidCredentials {
+		t.Errorf("empty password: got %v, want ErrInvalidCredentials", err)
+	}
+}
@@ -0,0 +1,127 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package email
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Frimurare/WulfVault/internal/database"
+)
+
+// GenerateAdminAlertHTML creates the HTML body for an administrative alert
+func GenerateAdminAlertHTML(title, message string, details []string) string {
+	return generateAlertHTML(title, "Administrator Alert", message, details)
+}
+
+// GenerateSecurityAlertHTML creates the HTML body for a security notice to an account owner
+func GenerateSecurityAlertHTML(title, message string, details []string) string {
+	return generateAlertHTML(title, "Security Alert", message, details)
+}
+
+func generateAlertHTML(title, subtitle, message string, details []string) string {
+	var detailRows strings.Builder
+	for _, d := range details {
+		detailRows.WriteString(fmt.Sprintf(`<li style="margin-bottom: 6px;">%s</li>`, html.EscapeString(d)))
+	}
+
+	return fmt.Sprintf(`
+<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="UTF-8">
+</head>
+<body style="margin: 0; padding: 0; font-family: Arial, Helvetica, sans-serif;">
+	<table width="100%%" cellpadding="0" cellspacing="0" style="background-color: #f0f0f0; padding: 20px 0;">
+		<tr>
+			<td align="center">
+				<table width="600" cellpadding="0" cellspacing="0" style="background-color: #ffffff; border-radius: 8px; overflow: hidden; box-shadow: 0 4px 6px rgba(0,0,0,0.1);">
+					<tr>
+						<td style="background-color: #7f1d1d; padding: 30px; text-align: center;">
+							<h1 style="color: #ffffff; margin: 0; font-size: 24px;">⚠️ %s</h1>
+							<p style="color: #fecaca; margin: 10px 0 0 0; font-size: 14px;">%s</p>
+						</td>
+					</tr>
+					<tr>
+						<td style="padding: 40px 30px;">
+							<div style="background-color: #fee2e2; border-left: 4px solid #dc2626; padding: 15px; margin-bottom: 25px;">
+								<p style="margin: 0; color: #7f1d1d; font-size: 16px;">%s</p>
+							</div>
+							<ul style="color: #333; font-size: 14px; padding-left: 20px;">%s</ul>
+							<p style="color: #666; font-size: 13px; margin-top: 25px;">Detected at %s</p>
+						</td>
+					</tr>
+					<tr>
+						<td style="background-color: #f8f9fa; padding: 20px; text-align: center; border-top: 1px solid #e0e0e0;">
+							<p style="margin: 0; color: #999; font-size: 12px;">This is an automated message from WulfVault.</p>
+						</td>
+					</tr>
+				</table>
+			</td>
+		</tr>
+	</table>
+</body>
+</html>`, html.EscapeString(title), html.EscapeString(subtitle), html.EscapeString(message), detailRows.String(), time.Now().Format("2006-01-02 15:04:05"))
+}
+
+// GenerateAdminAlertText creates the plain text body for an administrative alert
+func GenerateAdminAlertText(title, message string, details []string) string {
+	var b strings.Builder
+	b.WriteString(title + "\n\n" + message + "\n\n")
+	for _, d := range details {
+		b.WriteString("- " + d + "\n")
+	}
+	b.WriteString("\nDetected at " + time.Now().Format("2006-01-02 15:04:05") + "\n")
+	b.WriteString("\n---\nThis is an automated message from WulfVault.")
+	return b.String()
+}
+
+// SendAdminAlert emails an alert to every active administrator
+func SendAdminAlert(subject, title, message string, details []string) error {
+	provider, err := GetActiveProvider(database.DB)
+	if err != nil {
+		return err
+	}
+
+	users, err := database.DB.GetAllUsers()
+	if err != nil {
+		return err
+	}
+
+	htmlBody := GenerateAdminAlertHTML(title, message, details)
+	textBody := GenerateAdminAlertText(title, message, details)
+
+	sent := 0
+	for _, u := range users {
+		if !u.IsActive || !u.IsAdmin() || u.Email == "" {
+			continue
+		}
+		if err := provider.SendEmail(u.Email, subject, htmlBody, textBody); err != nil {
+			log.Printf("Failed to send admin alert to %s: %v", u.Email, err)
+			continue
+		}
+		sent++
+	}
+
+	if sent == 0 {
+		return errors.New("no administrator could be notified")
+	}
+	return nil
+}
+
+// SendSecurityAlert emails a security notice, such as a lockout, to one account owner
+func SendSecurityAlert(to, subject, title, message string, details []string) error {
+	provider, err := GetActiveProvider(database.DB)
+	if err != nil {
+		return err
+	}
+
+	return provider.SendEmail(to, subject, GenerateSecurityAlertHTML(title, message, details), GenerateAdminAlertText(title, message, details))
+}
@@ -7,6 +7,7 @@ package email
 
 import (
 	"fmt"
+	"html"
 	"time"
 
 	"github.com/Frimurare/WulfVault/internal/database"
@@ -867,3 +868,211 @@ Svara inte på detta mail.`, resetLink)
 
 	return provider.SendEmail(email, subject, htmlBody, textBody)
 }
+
+// SendDownloadVerificationEmail sends the one-time code and link a download account
+// uses to verify its email address before its first download
+func SendDownloadVerificationEmail(email, name, code, verifyLink, fileName, companyName string, validMinutes int) error {
+	subject := fmt.Sprintf("%s is your %s verification code", code, companyName)
+
+	htmlBody := fmt.Sprintf(`
+<!DOCTYPE html>
+<html lang="en">
+<head>
+	<meta charset="UTF-8">
+	<style>
+		body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; margin: 0; padding: 0; }
+		.container { max-width: 600px; margin: 0 auto; padding: 20px; }
+		.header {
+			background: #2563eb;
+			color: white;
+			padding: 30px;
+			border-radius: 10px 10px 0 0;
+			text-align: center;
+		}
+		.header h1 { margin: 0; font-size: 28px; }
+		.content {
+			background: #f9f9f9;
+			padding: 30px;
+			border-radius: 0 0 10px 10px;
+		}
+		.code-box {
+			background: white;
+			padding: 25px;
+			margin: 25px 0;
+			border-radius: 8px;
+			border: 2px solid #2563eb;
+			text-align: center;
+		}
+		.code {
+			font-size: 36px;
+			font-weight: bold;
+			letter-spacing: 8px;
+			color: #1e293b;
+			font-family: monospace;
+		}
+		.button {
+			display: inline-block;
+			padding: 15px 40px;
+			background: #2563eb;
+			color: white !important;
+			text-decoration: none;
+			border-radius: 8px;
+			margin: 10px 0;
+			font-weight: bold;
+		}
+		.footer {
+			margin-top: 30px;
+			padding-top: 20px;
+			border-top: 2px solid #ddd;
+			font-size: 12px;
+			color: #666;
+			text-align: center;
+		}
+	</style>
+</head>
+<body>
+	<div class="container">
+		<div class="header">
+			<h1>Verify Your Email</h1>
+		</div>
+
+		<div class="content">
+			<p>Hi %s,</p>
+			<p>Someone created a download account with this email address to download <strong>%s</strong>. Enter the code below on the download page, or click the button, to confirm it was you.</p>
+
+			<div class="code-box">
+				<div class="code">%s</div>
+				<p style="font-size: 13px; color: #999; margin-bottom: 0;">The code and link are valid for %d minutes</p>
+			</div>
+
+			<p style="text-align: center;"><a href="%s" class="button">VERIFY &amp; DOWNLOAD</a></p>
+
+			<p style="font-size: 13px; color: #666;">If you didn't request this, you can ignore this email. Nobody can download files with your email address until it is verified.</p>
+		</div>
+
+		<div class="footer">
+			<p>This is an automated message from %s.</p>
+			<p>Do not reply to this email.</p>
+		</div>
+	</div>
+</body>
+</html>`, html.EscapeString(name), html.EscapeString(fileName), code, validMinutes, verifyLink, html.EscapeString(companyName))
+
+	textBody := fmt.Sprintf(`Hi %s,
+
+Someone created a download account with this email address to download %s.
+
+Your verification code: %s
+
+Enter the code on the download page, or verify by visiting this link:
+%s
+
+The code and link are valid for %d minutes. If you didn't request this, you can ignore this email.
+
+---
+This is an automated message from %s.
+Do not reply to this email.`, name, fileName, code, verifyLink, validMinutes, companyName)
+
+	provider, err := GetActiveProvider(database.DB)
+	if err != nil {
+		return err
+	}
+
+	return provider.SendEmail(email, subject, htmlBody, textBody)
+}
+
+// SendDownloadMagicLinkEmail sends a download account a single-use sign-in link.
+// fileName is the file the link leads to, or "" for the download portal.
+func SendDownloadMagicLinkEmail(email, name, signInLink, fileName, companyName string, validMinutes int) error {
+	subject := fmt.Sprintf("Sign in to %s", companyName)
+
+	purposeHTML := "Click the button below to sign in to your download account."
+	purposeText := "Visit this link to sign in to your download account:"
+	if fileName != "" {
+		purposeHTML = fmt.Sprintf("Click the button below to sign in and download <strong>%s</strong>.", html.EscapeString(fileName))
+		purposeText = fmt.Sprintf("Visit this link to sign in and download %s:", fileName)
+	}
+
+	htmlBody := fmt.Sprintf(`
+<!DOCTYPE html>
+<html lang="en">
+<head>
+	<meta charset="UTF-8">
+	<style>
+		body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; margin: 0; padding: 0; }
+		.container { max-width: 600px; margin: 0 auto; padding: 20px; }
+		.header {
+			background: #2563eb;
+			color: white;
+			padding: 30px;
+			border-radius: 10px 10px 0 0;
+			text-align: center;
+		}
+		.header h1 { margin: 0; font-size: 28px; }
+		.content {
+			background: #f9f9f9;
+			padding: 30px;
+			border-radius: 0 0 10px 10px;
+		}
+		.button {
+			display: inline-block;
+			padding: 15px 40px;
+			background: #2563eb;
+			color: white !important;
+			text-decoration: none;
+			border-radius: 8px;
+			margin: 10px 0;
+			font-weight: bold;
+		}
+		.footer {
+			margin-top: 30px;
+			padding-top: 20px;
+			border-top: 2px solid #ddd;
+			font-size: 12px;
+			color: #666;
+			text-align: center;
+		}
+	</style>
+</head>
+<body>
+	<div class="container">
+		<div class="header">
+			<h1>Sign In</h1>
+		</div>
+
+		<div class="content">
+			<p>Hi %s,</p>
+			<p>%s No password is needed.</p>
+
+			<p style="text-align: center;"><a href="%s" class="button">SIGN IN</a></p>
+			<p style="font-size: 13px; color: #999; text-align: center;">The link can be used once and is valid for %d minutes</p>
+
+			<p style="font-size: 13px; color: #666;">If you didn't request this, you can ignore this email. Nobody can sign in without the link.</p>
+		</div>
+
+		<div class="footer">
+			<p>This is an automated message from %s.</p>
+			<p>Do not reply to this email.</p>
+		</div>
+	</div>
+</body>
+</html>`, html.EscapeString(name), purposeHTML, signInLink, validMinutes, html.EscapeString(companyName))
+
+	textBody := fmt.Sprintf(`Hi %s,
+
+%s
+%s
+
+No password is needed. The link can be used once and is valid for %d minutes. If you didn't request this, you can ignore this email.
+
+---
+This is an automated message from %s.
+Do not reply to this email.`, name, purposeText, signInLink, validMinutes, companyName)
+
+	provider, err := GetActiveProvider(database.DB)
+	if err != nil {
+		return err
+	}
+
+	return provider.SendEmail(email, subject, htmlBody, textBody)
+}
@@ -0,0 +1,257 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package integrity
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Frimurare/WulfVault/internal/database"
+	"github.com/Frimurare/WulfVault/internal/email"
+	"github.com/Frimurare/WulfVault/internal/storage"
+)
+
+const (
+	// DefaultRateMB is the default read budget of the scrubber in MB per second
+	DefaultRateMB = 10
+	// DefaultReverifyDays is how often each file is re-hashed by default
+	DefaultReverifyDays = 30
+	// batchSize is the number of files picked up per scrub pass
+	batchSize = 50
+	// chunkSize is the size of each throttled read
+	chunkSize = 1024 * 1024
+)
+
+// scrubMutex prevents overlapping scrub passes
+var scrubMutex sync.Mutex
+
+// Settings holds the scrubber configuration stored in the Configuration table
+type Settings struct {
+	Enabled      bool
+	RateMB       int
+	ReverifyDays int
+}
+
+// LoadSettings reads the scrubber configuration, falling back to defaults
+func LoadSettings() Settings {
+	settings := Settings{
+		Enabled:      true,
+		RateMB:       DefaultRateMB,
+		ReverifyDays: DefaultReverifyDays,
+	}
+
+	if v, err := database.DB.GetConfigValue("integrity_scrub_enabled"); err == nil && v == "false" {
+		settings.Enabled = false
+	}
+	if v, err := database.DB.GetConfigValue("integrity_scrub_rate_mb"); err == nil && v != "" {
+		if rate, err := strconv.Atoi(v); err == nil && rate > 0 {
+			settings.RateMB = rate
+		}
+	}
+	if v, err := database.DB.GetConfigValue("integrity_reverify_days"); err == nil && v != "" {
+		if days, err := strconv.Atoi(v); err == nil && days > 0 {
+			settings.ReverifyDays = days
+		}
+	}
+
+	return settings
+}
+
+// ScrubOnce verifies the next batch of files that are due for re-hashing.
+// Progress is stored per file, so an interrupted pass resumes with the least
+// recently verified files on the next run.
+func ScrubOnce(uploadsDir string) error {
+	if !scrubMutex.TryLock() {
+		return nil
+	}
+	defer scrubMutex.Unlock()
+
+	settings := LoadSettings()
+	if !settings.Enabled {
+		return nil
+	}
+
+	cutoff := time.Now().Add(-time.Duration(settings.ReverifyDays) * 24 * time.Hour).Unix()
+	files, err := database.DB.GetFilesDueForVerification(cutoff, batchSize)
+	if err != nil {
+		return err
+	}
+
+	if len(files) == 0 {
+		return nil
+	}
+
+	log.Printf("Integrity scrub: verifying %d files (budget: %d MB/s)", len(files), settings.RateMB)
+
+	verified, failed := 0, 0
+	for _, file := range files {
+		status := verifyFile(uploadsDir, file.Id, file.Compression, file.SHA1, settings.RateMB)
+
+		if err := database.DB.UpdateFileIntegrity(file.Id, status, time.Now().Unix()); err != nil {
+			log.Printf("Warning: Could not record integrity status for %s: %v", file.Id, err)
+			continue
+		}
+
+		if status != database.IntegrityStatusOK {
+			failed++
+			// Only alert on a status change to avoid repeating the alert every pass
+			if file.IntegrityStatus != status {
+				reportFailure(file, status)
+			}
+		} else {
+			if file.IntegrityStatus == database.IntegrityStatusMismatch || file.IntegrityStatus == database.IntegrityStatusMissing {
+				logRestored(file)
+			}
+			verified++
+		}
+	}
+
+	log.Printf("Integrity scrub complete: %d ok, %d failed", verified, failed)
+	return nil
+}
+
+// verifyFile re-hashes a file within the given read budget and compares it
+// with the expected SHA1. Compressed blobs are hashed on their original content.
+func verifyFile(uploadsDir, fileID, compression, expectedSHA1 string, rateMB int) string {
+	path := storage.FilePath(uploadsDir, fileID)
+	f, err := storage.OpenBlob(uploadsDir, fileID, compression)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return database.IntegrityStatusMissing
+		}
+		log.Printf("Integrity scrub: could not open %s: %v", path, err)
+		if _, statErr := os.Stat(path); statErr == nil {
+			// The file exists but its content cannot be decoded
+			return database.IntegrityStatusMismatch
+		}
+		return database.IntegrityStatusMissing
+	}
+	defer f.Close()
+
+	hash := sha1.New()
+	if err := throttledCopy(hash, f, rateMB); err != nil {
+		log.Printf("Integrity scrub: read error on %s: %v", path, err)
+		return database.IntegrityStatusMismatch
+	}
+
+	if hex.EncodeToString(hash.Sum(nil)) != expectedSHA1 {
+		return database.IntegrityStatusMismatch
+	}
+	return database.IntegrityStatusOK
+}
+
+// throttledCopy copies src to dst while keeping the read rate below rateMB per second
+func throttledCopy(dst io.Writer, src io.Reader, rateMB int) error {
+	bytesPerSecond := float64(rateMB) * 1024 * 1024
+	buf := make([]byte, chunkSize)
+	start := time.Now()
+	var total int64
+
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			if _, werr := dst.Write(buf[:n]); werr != nil {
+				return werr
+			}
+			total += int64(n)
+
+			// Sleep until the elapsed time matches the budget for bytes read so far
+			expected := time.Duration(float64(total) / bytesPerSecond * float64(time.Second))
+			if elapsed := time.Since(start); elapsed < expected {
+				time.Sleep(expected - elapsed)
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// reportFailure writes an audit entry and alerts administrators about a failed check
+func reportFailure(file *database.FileInfo, status string) {
+	log.Printf("⚠️  Integrity check failed for %s (ID: %s): %s", file.Name, file.Id, status)
+
+	database.DB.LogAction(&database.AuditLogEntry{
+		UserID:     0,
+		UserEmail:  "system",
+		Action:     database.ActionFileIntegrityFailed,
+		EntityType: database.EntityFile,
+		EntityID:   file.Id,
+		Details: database.CreateAuditDetails(map[string]interface{}{
+			"file_name":     file.Name,
+			"owner_id":      file.UserId,
+			"status":        status,
+			"expected_sha1": file.SHA1,
+		}),
+		Success:  false,
+		ErrorMsg: "stored file does not match recorded SHA1",
+	})
+
+	reason := "The stored content no longer matches the SHA1 recorded at upload (possible bit rot or tampering)."
+	if status == database.IntegrityStatusMissing {
+		reason = "The stored file could not be found or read from the uploads directory."
+	}
+
+	details := []string{
+		"File: " + file.Name,
+		"File ID: " + file.Id,
+		fmt.Sprintf("Owner user ID: %d", file.UserId),
+		"Expected SHA1: " + file.SHA1,
+		"Status: " + status,
+	}
+
+	if err := email.SendAdminAlert("Integrity alert: "+file.Name, "File Integrity Check Failed", reason, details); err != nil {
+		log.Printf("Could not send integrity alert email: %v", err)
+	}
+}
+
+// logRestored records that a previously failing file verifies again
+func logRestored(file *database.FileInfo) {
+	database.DB.LogAction(&database.AuditLogEntry{
+		UserID:     0,
+		UserEmail:  "system",
+		Action:     database.ActionFileIntegrityRestored,
+		EntityType: database.EntityFile,
+		EntityID:   file.Id,
+		Details: database.CreateAuditDetails(map[string]interface{}{
+			"file_name":       file.Name,
+			"previous_status": file.IntegrityStatus,
+		}),
+		Success: true,
+	})
+}
+
+// StartScrubScheduler starts the background integrity scrubber
+func StartScrubScheduler(uploadsDir string, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		// Run immediately on start
+		if err := ScrubOnce(uploadsDir); err != nil {
+			log.Printf("Error during integrity scrub: %v", err)
+		}
+
+		// Then run on schedule
+		for range ticker.C {
+			if err := ScrubOnce(uploadsDir); err != nil {
+				log.Printf("Error during integrity scrub: %v", err)
+			}
+		}
+	}()
+
+	log.Printf("Integrity scrub scheduler started (interval: %v)", interval)
+}
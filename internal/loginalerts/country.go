@@ -0,0 +1,150 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package loginalerts
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/netip"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The country database is a local CSV file of IP ranges with one
+// "start,end,country" line per range, as in the free DB-IP "IP to Country Lite"
+// and IP2Location LITE DB1 downloads. Addresses are written out or, for IPv4,
+// given as decimal numbers; further columns are ignored. Lookups never touch
+// the network.
+
+type countryRange struct {
+	start, end netip.Addr
+	country    string
+}
+
+// countryDB caches the ranges of the configured file until it changes
+var countryDB struct {
+	sync.Mutex
+	path    string
+	modTime time.Time
+	ranges  []countryRange
+}
+
+// LookupCountry returns the ISO country code of an IP address from the country
+// database at path, "" if there is none or the address isn't in it
+func LookupCountry(path, ip string) string {
+	if path == "" {
+		return ""
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ""
+	}
+	addr = addr.Unmap()
+
+	ranges, err := loadCountryRanges(path)
+	if err != nil {
+		log.Printf("Warning: failed to load country database %s: %v", path, err)
+		return ""
+	}
+
+	// The last range starting at or before the address
+	i := sort.Search(len(ranges), func(i int) bool { return ranges[i].start.Compare(addr) > 0 }) - 1
+	if i < 0 || ranges[i].end.Compare(addr) < 0 {
+		return ""
+	}
+	return ranges[i].country
+}
+
+// CountryDBStatus describes the configured country database for the admin settings page
+func CountryDBStatus(path string) string {
+	if path == "" {
+		return "Disabled"
+	}
+	ranges, err := loadCountryRanges(path)
+	if err != nil {
+		return "Not usable: " + err.Error()
+	}
+	return fmt.Sprintf("%d ranges", len(ranges))
+}
+
+func loadCountryRanges(path string) ([]countryRange, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	countryDB.Lock()
+	defer countryDB.Unlock()
+	if countryDB.path == path && countryDB.modTime.Equal(info.ModTime()) {
+		return countryDB.ranges, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	ranges, err := parseCountryRanges(f)
+	if err != nil {
+		return nil, err
+	}
+
+	countryDB.path, countryDB.modTime, countryDB.ranges = path, info.ModTime(), ranges
+	return ranges, nil
+}
+
+func parseCountryRanges(r io.Reader) ([]countryRange, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+
+	var ranges []countryRange
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) < 3 {
+			continue
+		}
+		start, okStart := parseRangeAddr(record[0])
+		end, okEnd := parseRangeAddr(record[1])
+		country := strings.ToUpper(strings.TrimSpace(record[2]))
+		// Header lines, IPv6 ranges given as numbers and unassigned ranges are skipped
+		if !okStart || !okEnd || len(country) != 2 || country == "ZZ" {
+			continue
+		}
+		ranges = append(ranges, countryRange{start: start, end: end, country: country})
+	}
+	if len(ranges) == 0 {
+		return nil, errors.New("no IP ranges found")
+	}
+
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].start.Less(ranges[j].start) })
+	return ranges, nil
+}
+
+func parseRangeAddr(value string) (netip.Addr, bool) {
+	value = strings.TrimSpace(value)
+	if addr, err := netip.ParseAddr(value); err == nil {
+		return addr.Unmap(), true
+	}
+	n, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return netip.AddrFrom4([4]byte{byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n)}), true
+}
@@ -0,0 +1,162 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+// Package loginalerts notices sign-ins from a device or country a user hasn't
+// signed in from before and emails the user about them. Devices are told apart
+// by the browser and platform of their user agent and by their IP range, so a
+// browser update or a new address from the same provider doesn't count as new.
+package loginalerts
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/netip"
+	"time"
+
+	"github.com/Frimurare/WulfVault/internal/auth"
+	"github.com/Frimurare/WulfVault/internal/database"
+	"github.com/Frimurare/WulfVault/internal/email"
+	"github.com/Frimurare/WulfVault/internal/models"
+)
+
+// Configuration keys of the policy
+const (
+	ConfigEnabled   = "login_alerts_enabled"
+	ConfigCountryDB = "login_alerts_country_db"
+)
+
+// Policy says whether users are emailed about sign-ins from new devices, and
+// where to look up the country of an IP address
+type Policy struct {
+	Enabled   bool
+	CountryDB string // path of an IP-to-country CSV file, "" = countries aren't checked
+}
+
+// LoadPolicy reads the policy from the Configuration table. Alerts are on until
+// they are turned off.
+func LoadPolicy() *Policy {
+	p := &Policy{Enabled: true}
+	if value, err := database.DB.GetConfigValue(ConfigEnabled); err == nil && value != "" {
+		p.Enabled = value == "true"
+	}
+	if value, err := database.DB.GetConfigValue(ConfigCountryDB); err == nil {
+		p.CountryDB = value
+	}
+	return p
+}
+
+// Save stores the policy
+func (p *Policy) Save() error {
+	enabled := "false"
+	if p.Enabled {
+		enabled = "true"
+	}
+	if err := database.DB.SetConfigValue(ConfigEnabled, enabled); err != nil {
+		return err
+	}
+	return database.DB.SetConfigValue(ConfigCountryDB, p.CountryDB)
+}
+
+// IPRange returns the network of an IP address that counts as the same place:
+// the /24 of an IPv4 address and the /48 of an IPv6 address
+func IPRange(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ip
+	}
+	addr = addr.Unmap()
+	bits := 48
+	if addr.Is4() {
+		bits = 24
+	}
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return ip
+	}
+	return prefix.String()
+}
+
+// Fingerprint identifies a device by the browser and platform of its user agent and its IP range
+func Fingerprint(userAgent, ip string) string {
+	sum := sha256.Sum256([]byte(auth.ParseDevice(userAgent) + "|" + IPRange(ip)))
+	return hex.EncodeToString(sum[:16])
+}
+
+// Login describes a sign-in and what was new about it
+type Login struct {
+	Device     string
+	IPAddress  string
+	Country    string
+	NewDevice  bool
+	NewCountry bool
+}
+
+// New reports whether the sign-in came from a new device or country
+func (l *Login) New() bool {
+	return l.NewDevice || l.NewCountry
+}
+
+// Check records a sign-in of a user and reports what was new about it. Nothing
+// is new about the first sign-in of a user; it only starts the list of devices.
+func (p *Policy) Check(userId int, ipAddress, userAgent string, now time.Time) (*Login, error) {
+	login := &Login{
+		Device:    auth.ParseDevice(userAgent),
+		IPAddress: ipAddress,
+		Country:   LookupCountry(p.CountryDB, ipAddress),
+	}
+
+	count, err := database.DB.CountKnownDevices(userId)
+	if err != nil {
+		return nil, err
+	}
+	fingerprint := Fingerprint(userAgent, ipAddress)
+	if count > 0 {
+		known, err := database.DB.IsKnownDevice(userId, fingerprint)
+		if err != nil {
+			return nil, err
+		}
+		login.NewDevice = !known
+		if login.Country != "" {
+			known, err := database.DB.IsKnownCountry(userId, login.Country)
+			if err != nil {
+				return nil, err
+			}
+			login.NewCountry = !known
+		}
+	}
+
+	err = database.DB.SaveKnownDevice(&database.KnownDevice{
+		UserId:      userId,
+		Fingerprint: fingerprint,
+		Device:      login.Device,
+		IPRange:     IPRange(ipAddress),
+		Country:     login.Country,
+		FirstSeen:   now.Unix(),
+		LastSeen:    now.Unix(),
+	})
+	return login, err
+}
+
+// Notify emails a user about a sign-in from a new device or country
+func Notify(user *models.User, login *Login, at time.Time) error {
+	what := "a new device"
+	if login.NewCountry {
+		what = "a new country"
+	}
+	details := []string{
+		"Device: " + login.Device,
+		"IP address: " + login.IPAddress,
+	}
+	if login.Country != "" {
+		details = append(details, "Country: "+login.Country)
+	}
+	details = append(details,
+		"Time: "+at.Format("2006-01-02 15:04:05"),
+		"If this wasn't you, change your password and sign out your other sessions in Settings.",
+	)
+	return email.SendSecurityAlert(user.Email, "New sign-in to your account", "New Sign-In",
+		fmt.Sprintf("Hi %s, your account was just signed in to from %s.", user.Name, what), details)
+}
@@ -0,0 +1,123 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package loginalerts
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Frimurare/WulfVault/internal/database"
+	"github.com/Frimurare/WulfVault/internal/models"
+)
+
+const (
+	firefoxWindows = "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:128.0) Gecko/20100101 Firefox/128.0"
+	firefoxNewer   = "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:131.0) Gecko/20100101 Firefox/131.0"
+	safariIPhone   = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Mobile/15E148 Safari/604.1"
+)
+
+func TestIPRange(t *testing.T) {
+	tests := map[string]string{
+		"203.0.113.45":          "203.0.113.0/24",
+		"::ffff:203.0.113.45":   "203.0.113.0/24",
+		"2001:db8:1234:5678::1": "2001:db8:1234::/48",
+		"not an address":        "not an address",
+	}
+	for ip, want := range tests {
+		if got := IPRange(ip); got != want {
+			t.Errorf("IPRange(%q) = %q, want %q", ip, got, want)
+		}
+	}
+
+	if Fingerprint(firefoxWindows, "203.0.113.45") != Fingerprint(firefoxNewer, "203.0.113.99") {
+		t.Error("browser update in the same range changed the fingerprint")
+	}
+	if Fingerprint(firefoxWindows, "203.0.113.45") == Fingerprint(safariIPhone, "203.0.113.45") {
+		t.Error("different browsers have the same fingerprint")
+	}
+	if Fingerprint(firefoxWindows, "203.0.113.45") == Fingerprint(firefoxWindows, "198.51.100.7") {
+		t.Error("different ranges have the same fingerprint")
+	}
+}
+
+func writeCountryDB(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "countries.csv")
+	data := `ip_start,ip_end,country
+198.51.100.0,198.51.100.255,SE
+"3405803776","3405804031","US"
+2001:db8::,2001:db8:ffff:ffff:ffff:ffff:ffff:ffff,DE
+192.0.2.0,192.0.2.255,ZZ
+`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLookupCountry(t *testing.T) {
+	path := writeCountryDB(t)
+	tests := map[string]string{
+		"198.51.100.7":        "SE",
+		"203.0.113.45":        "US", // 3405803776 = 203.0.113.0
+		"::ffff:198.51.100.1": "SE",
+		"2001:db8:1::1":       "DE",
+		"192.0.2.1":           "",
+		"8.8.8.8":             "",
+	}
+	for ip, want := range tests {
+		if got := LookupCountry(path, ip); got != want {
+			t.Errorf("LookupCountry(%q) = %q, want %q", ip, got, want)
+		}
+	}
+	if got := LookupCountry("", "198.51.100.7"); got != "" {
+		t.Errorf("lookup without a database: got %q", got)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	if err := database.Initialize(t.TempDir()); err != nil {
+		t.Fatalf("initialize database: %v", err)
+	}
+	t.Cleanup(func() { database.DB.Close() })
+
+	user := &models.User{Name: "Alice", Email: "alice@example.com", Password: "x", UserLevel: models.UserLevelUser, IsActive: true}
+	if err := database.DB.CreateUser(user); err != nil {
+		t.Fatal(err)
+	}
+	if policy := LoadPolicy(); !policy.Enabled || policy.CountryDB != "" {
+		t.Errorf("default policy: got %+v", policy)
+	}
+
+	policy := &Policy{Enabled: true, CountryDB: writeCountryDB(t)}
+	now := time.Now()
+	check := func(ip, userAgent string) *Login {
+		t.Helper()
+		login, err := policy.Check(user.Id, ip, userAgent, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return login
+	}
+
+	if login := check("198.51.100.7", firefoxWindows); login.New() {
+		t.Errorf("first sign-in reported as new: %+v", login)
+	}
+	if login := check("198.51.100.8", firefoxNewer); login.New() {
+		t.Errorf("same device reported as new: %+v", login)
+	}
+	if login := check("198.51.100.9", safariIPhone); !login.NewDevice || login.NewCountry {
+		t.Errorf("new device in a known country: %+v", login)
+	}
+	if login := check("203.0.113.45", firefoxWindows); !login.NewDevice || !login.NewCountry || login.Country != "US" {
+		t.Errorf("sign-in from a new country: %+v", login)
+	}
+	if login := check("203.0.113.46", firefoxWindows); login.New() {
+		t.Errorf("second sign-in from the new country reported as new: %+v", login)
+	}
+}
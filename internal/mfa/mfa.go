@@ -0,0 +1,233 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+// Package mfa enforces mandatory two-factor authentication for the roles that
+// require it. Affected users get a grace period during which they are asked to
+// set up a second factor at every sign-in; after it they can only enroll.
+package mfa
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/Frimurare/WulfVault/internal/database"
+	"github.com/Frimurare/WulfVault/internal/models"
+)
+
+// Configuration keys of the enforcement policy. Which roles require two-factor
+// authentication is stored on the roles themselves.
+const (
+	ConfigGracePeriodDays      = "mfa_grace_period_days"
+	ConfigReminderIntervalDays = "mfa_reminder_interval_days"
+)
+
+// Defaults for unset values
+const (
+	DefaultGracePeriodDays      = 14
+	DefaultReminderIntervalDays = 3
+)
+
+// Policy says how long users have to set up two-factor authentication once their
+// role requires it, and how often they are reminded by email
+type Policy struct {
+	GracePeriodDays      int // 0 = blocked until enrolled right away
+	ReminderIntervalDays int // 0 = no reminder emails
+}
+
+// LoadPolicy reads the policy from the Configuration table, applying defaults for unset values
+func LoadPolicy() *Policy {
+	get := func(key string, fallback int) int {
+		value, err := database.DB.GetConfigValue(key)
+		if err != nil || value == "" {
+			return fallback
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return fallback
+		}
+		return n
+	}
+	return &Policy{
+		GracePeriodDays:      get(ConfigGracePeriodDays, DefaultGracePeriodDays),
+		ReminderIntervalDays: get(ConfigReminderIntervalDays, DefaultReminderIntervalDays),
+	}
+}
+
+// Save stores the policy
+func (p *Policy) Save() error {
+	if err := database.DB.SetConfigValue(ConfigGracePeriodDays, strconv.Itoa(p.GracePeriodDays)); err != nil {
+		return err
+	}
+	return database.DB.SetConfigValue(ConfigReminderIntervalDays, strconv.Itoa(p.ReminderIntervalDays))
+}
+
+// Deadline returns the end of a grace period that started at since
+func (p *Policy) Deadline(since int64) time.Time {
+	return time.Unix(since, 0).AddDate(0, 0, p.GracePeriodDays)
+}
+
+// Status is where a user stands with the two-factor requirement
+type Status int
+
+const (
+	// StatusNotRequired means the role of the user doesn't require two-factor authentication
+	StatusNotRequired Status = iota
+	// StatusEnrolled means the user has a second factor
+	StatusEnrolled
+	// StatusGracePeriod means the user still has time to set up a second factor
+	StatusGracePeriod
+	// StatusOverdue means the grace period is over; the user can only enroll
+	StatusOverdue
+)
+
+// String returns a short label for the compliance report
+func (s Status) String() string {
+	switch s {
+	case StatusEnrolled:
+		return "Enrolled"
+	case StatusGracePeriod:
+		return "Grace period"
+	case StatusOverdue:
+		return "Blocked"
+	}
+	return "Not required"
+}
+
+// Enforcement is the two-factor status of a user and, for users who still have
+// to enroll, the end of their grace period
+type Enforcement struct {
+	Status   Status
+	Deadline time.Time
+}
+
+// DaysLeft returns the number of started days until the deadline, 0 once it has passed
+func (e *Enforcement) DaysLeft() int {
+	left := time.Until(e.Deadline)
+	if left <= 0 {
+		return 0
+	}
+	return int((left + 24*time.Hour - 1) / (24 * time.Hour))
+}
+
+// MustEnroll reports whether the user still has to set up a second factor
+func (e *Enforcement) MustEnroll() bool {
+	return e.Status == StatusGracePeriod || e.Status == StatusOverdue
+}
+
+// exempt reports whether users of an authentication source are exempt. Users who
+// sign in through OIDC are: their identity provider enforces its own second factor.
+func exempt(authSource string) bool {
+	return authSource == database.AuthSourceOIDC
+}
+
+// evaluate works out the status of a user whose role requires two-factor
+// authentication. since is the start of the grace period, 0 if it hasn't started.
+func (p *Policy) evaluate(enrolled bool, since int64, now time.Time) *Enforcement {
+	if enrolled {
+		return &Enforcement{Status: StatusEnrolled}
+	}
+	if since == 0 {
+		since = now.Unix()
+	}
+	deadline := p.Deadline(since)
+	if now.Before(deadline) {
+		return &Enforcement{Status: StatusGracePeriod, Deadline: deadline}
+	}
+	return &Enforcement{Status: StatusOverdue, Deadline: deadline}
+}
+
+// Check returns the two-factor status of a user. The grace period starts the
+// first time a user is found without a second factor.
+func Check(user *models.User) *Enforcement {
+	role, err := database.DB.GetUserRole(user)
+	if err != nil {
+		log.Printf("Warning: failed to load role of user %d: %v", user.Id, err)
+		return &Enforcement{Status: StatusNotRequired}
+	}
+	if !role.Require2FA {
+		return &Enforcement{Status: StatusNotRequired}
+	}
+	source, _, err := database.DB.GetUserAuthSource(user.Id)
+	if err == nil && exempt(source) {
+		return &Enforcement{Status: StatusNotRequired}
+	}
+
+	enrolled := user.TOTPEnabled
+	if !enrolled {
+		count, err := database.DB.CountWebAuthnCredentials(user.Id)
+		enrolled = err == nil && count > 0
+	}
+
+	since, err := database.DB.GetMFARequiredSince(user.Id)
+	if err != nil {
+		log.Printf("Warning: failed to read the 2FA grace period of user %d: %v", user.Id, err)
+	}
+	now := time.Now()
+	if !enrolled && since == 0 {
+		since = now.Unix()
+		if err := database.DB.SetMFARequiredSince(user.Id, since); err != nil {
+			log.Printf("Warning: failed to start the 2FA grace period of user %d: %v", user.Id, err)
+		}
+	}
+	return LoadPolicy().evaluate(enrolled, since, now)
+}
+
+// UserCompliance is a row of the compliance report
+type UserCompliance struct {
+	*database.MFAUserState
+	Enforcement
+}
+
+// Report summarizes how many users comply with the two-factor requirement
+type Report struct {
+	Required    int // users whose role requires two-factor authentication
+	Enrolled    int
+	GracePeriod int
+	Overdue     int
+	Exempt      int // OIDC users, whose identity provider handles the second factor
+	Pending     []*UserCompliance
+}
+
+// Compliance returns the percentage of users who must use two-factor authentication and do
+func (r *Report) Compliance() float64 {
+	if r.Required == r.Exempt {
+		return 100
+	}
+	return float64(r.Enrolled) / float64(r.Required-r.Exempt) * 100
+}
+
+// BuildReport reports the two-factor compliance of all users whose role requires it.
+// Pending lists the users who still have to enroll, overdue users first.
+func BuildReport() (*Report, error) {
+	states, err := database.DB.GetMFARequiredUsers()
+	if err != nil {
+		return nil, err
+	}
+
+	policy := LoadPolicy()
+	now := time.Now()
+	report := &Report{Required: len(states)}
+	var grace []*UserCompliance
+	for _, state := range states {
+		if exempt(state.AuthSource) {
+			report.Exempt++
+			continue
+		}
+		e := policy.evaluate(state.Enrolled(), state.RequiredSince, now)
+		switch e.Status {
+		case StatusEnrolled:
+			report.Enrolled++
+		case StatusGracePeriod:
+			report.GracePeriod++
+			grace = append(grace, &UserCompliance{MFAUserState: state, Enforcement: *e})
+		case StatusOverdue:
+			report.Overdue++
+			report.Pending = append(report.Pending, &UserCompliance{MFAUserState: state, Enforcement: *e})
+		}
+	}
+	report.Pending = append(report.Pending, grace...)
+	return report, nil
+}
@@ -0,0 +1,110 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package mfa
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Frimurare/WulfVault/internal/database"
+	"github.com/Frimurare/WulfVault/internal/models"
+)
+
+func TestEvaluate(t *testing.T) {
+	policy := &Policy{GracePeriodDays: 7}
+	now := time.Now()
+
+	if e := policy.evaluate(true, now.AddDate(0, 0, -30).Unix(), now); e.Status != StatusEnrolled {
+		t.Errorf("enrolled user: got %v", e.Status)
+	}
+	if e := policy.evaluate(false, 0, now); e.Status != StatusGracePeriod || e.DaysLeft() != 7 {
+		t.Errorf("new requirement: got %v with %d days left, want grace period with 7", e.Status, e.DaysLeft())
+	}
+	if e := policy.evaluate(false, now.AddDate(0, 0, -5).Unix(), now); e.Status != StatusGracePeriod || e.DaysLeft() != 2 {
+		t.Errorf("5 days in: got %v with %d days left, want grace period with 2", e.Status, e.DaysLeft())
+	}
+	if e := policy.evaluate(false, now.AddDate(0, 0, -8).Unix(), now); e.Status != StatusOverdue || e.DaysLeft() != 0 {
+		t.Errorf("8 days in: got %v, want overdue", e.Status)
+	}
+
+	noGrace := &Policy{GracePeriodDays: 0}
+	if e := noGrace.evaluate(false, 0, now); e.Status != StatusOverdue {
+		t.Errorf("no grace period: got %v, want overdue", e.Status)
+	}
+}
+
+func TestCheckAndReport(t *testing.T) {
+	if err := database.Initialize(t.TempDir()); err != nil {
+		t.Fatalf("initialize database: %v", err)
+	}
+	t.Cleanup(func() { database.DB.Close() })
+
+	alice := &models.User{Name: "Alice", Email: "alice@example.com", Password: "x", UserLevel: models.UserLevelUser, IsActive: true}
+	bob := &models.User{Name: "Bob", Email: "bob@example.com", Password: "x", UserLevel: models.UserLevelAdmin, IsActive: true}
+	for _, u := range []*models.User{alice, bob} {
+		if err := database.DB.CreateUser(u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if e := Check(alice); e.Status != StatusNotRequired {
+		t.Fatalf("no role requires 2FA: got %v", e.Status)
+	}
+
+	if err := database.DB.SetRoleRequire2FA(models.RoleIdUser, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&Policy{GracePeriodDays: 10, ReminderIntervalDays: 1}).Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	e := Check(alice)
+	if e.Status != StatusGracePeriod {
+		t.Fatalf("User role requires 2FA: got %v, want grace period", e.Status)
+	}
+	since, _ := database.DB.GetMFARequiredSince(alice.Id)
+	if since == 0 {
+		t.Fatal("grace period was not started")
+	}
+	if e := Check(bob); e.Status != StatusNotRequired {
+		t.Errorf("Administrator role does not require 2FA: got %v", e.Status)
+	}
+
+	// The grace period keeps its original start
+	database.DB.SetMFARequiredSince(alice.Id, time.Now().AddDate(0, 0, -11).Unix())
+	if e := Check(alice); e.Status != StatusOverdue {
+		t.Errorf("grace period over: got %v, want overdue", e.Status)
+	}
+
+	report, err := BuildReport()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Required != 1 || report.Overdue != 1 || len(report.Pending) != 1 || report.Compliance() != 0 {
+		t.Errorf("report: %+v", report)
+	}
+
+	if err := database.DB.EnableTOTP(alice.Id, "SECRET", []string{"code"}); err != nil {
+		t.Fatal(err)
+	}
+	alice, _ = database.DB.GetUserByID(alice.Id)
+	if e := Check(alice); e.Status != StatusEnrolled {
+		t.Errorf("after enabling 2FA: got %v, want enrolled", e.Status)
+	}
+	report, _ = BuildReport()
+	if report.Enrolled != 1 || len(report.Pending) != 0 || report.Compliance() != 100 {
+		t.Errorf("report after enrolling: %+v", report)
+	}
+
+	// Lifting the requirement resets the grace period
+	database.DB.SetRoleRequire2FA(models.RoleIdUser, false)
+	if err := database.DB.ClearMFAGracePeriods(); err != nil {
+		t.Fatal(err)
+	}
+	if since, _ := database.DB.GetMFARequiredSince(alice.Id); since != 0 {
+		t.Errorf("grace period not cleared: %d", since)
+	}
+}
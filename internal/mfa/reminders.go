@@ -0,0 +1,101 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package mfa
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Frimurare/WulfVault/internal/database"
+	"github.com/Frimurare/WulfVault/internal/email"
+)
+
+// SendReminders starts the grace period of users who must set up two-factor
+// authentication and emails those who are due a reminder. It returns the
+// number of reminders sent.
+func SendReminders(serverURL string) (int, error) {
+	if err := database.DB.ClearMFAGracePeriods(); err != nil {
+		return 0, err
+	}
+
+	states, err := database.DB.GetMFARequiredUsers()
+	if err != nil {
+		return 0, err
+	}
+
+	policy := LoadPolicy()
+	now := time.Now()
+	sent := 0
+	for _, state := range states {
+		if exempt(state.AuthSource) || state.Enrolled() {
+			continue
+		}
+		if state.RequiredSince == 0 {
+			state.RequiredSince = now.Unix()
+			if err := database.DB.SetMFARequiredSince(state.UserId, state.RequiredSince); err != nil {
+				log.Printf("Failed to start the 2FA grace period of %s: %v", state.Email, err)
+				continue
+			}
+		}
+
+		if policy.ReminderIntervalDays == 0 ||
+			now.Sub(time.Unix(state.ReminderSentAt, 0)) < time.Duration(policy.ReminderIntervalDays)*24*time.Hour {
+			continue
+		}
+
+		e := policy.evaluate(false, state.RequiredSince, now)
+		if err := sendReminder(state, e, serverURL); err != nil {
+			log.Printf("Failed to send 2FA reminder to %s: %v", state.Email, err)
+			continue
+		}
+		database.DB.SetMFAReminderSentAt(state.UserId, now.Unix())
+		sent++
+	}
+	return sent, nil
+}
+
+// sendReminder emails a user who still has to set up two-factor authentication
+func sendReminder(state *database.MFAUserState, e *Enforcement, serverURL string) error {
+	settingsURL := strings.TrimRight(serverURL, "/") + "/settings"
+
+	subject := "Action required: set up two-factor authentication"
+	message := fmt.Sprintf("Your role (%s) requires two-factor authentication. Set up an authenticator app or a passkey before %s to keep access to your account.",
+		state.RoleName, e.Deadline.Format("2006-01-02 15:04"))
+	if e.Status == StatusOverdue {
+		subject = "Your account is blocked until you set up two-factor authentication"
+		message = fmt.Sprintf("Your role (%s) requires two-factor authentication and the grace period ended on %s. Sign in and set up an authenticator app or a passkey to use your account again.",
+			state.RoleName, e.Deadline.Format("2006-01-02"))
+	}
+
+	return email.SendSecurityAlert(state.Email, subject, "Two-Factor Authentication Required", message, []string{
+		"Account: " + state.Email,
+		"Set it up under Settings: " + settingsURL,
+	})
+}
+
+// StartReminderScheduler sends two-factor reminders every interval. Reminders are
+// only sent as often as the configured reminder interval allows.
+func StartReminderScheduler(serverURL string, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			sent, err := SendReminders(serverURL)
+			if err != nil {
+				log.Printf("Error sending 2FA reminders: %v", err)
+				continue
+			}
+			if sent > 0 {
+				log.Printf("Sent %d two-factor authentication reminder(s)", sent)
+			}
+		}
+	}()
+
+	log.Printf("2FA reminder scheduler started (check interval: %v)", interval)
+}
@@ -48,6 +48,7 @@ type ApiKey struct {
 	Expiry       int64         `json:"Expiry" redis:"Expiry"` // Does not expire if 0
 	IsSystemKey  bool          `json:"IsSystemKey" redis:"IsSystemKey"`
 	UserId       int           `json:"UserId" redis:"UserId"`
+	CreatedAt    int64         `json:"CreatedAt" redis:"CreatedAt"`
 }
 
 // ApiPermission contains zero or more permissions as an uint8 format
@@ -61,6 +62,11 @@ func (key *ApiKey) GetReadableDate() string {
 	return time.Unix(key.LastUsed, 0).Format("2006-01-02 15:04:05")
 }
 
+// IsExpired returns true if the key has an expiry that lies in the past
+func (key *ApiKey) IsExpired() bool {
+	return key.Expiry != 0 && time.Now().Unix() > key.Expiry
+}
+
 // GetRedactedId returns a redacted version of the API key
 func (key *ApiKey) GetRedactedId() string {
 	return key.Id[0:2] + "**************************" + key.Id[len(key.Id)-2:]
@@ -12,17 +12,18 @@ import (
 
 // DownloadAccount represents a temporary account created when someone downloads a file with authentication
 type DownloadAccount struct {
-	Id            int    `json:"id" redis:"id"`
-	Name          string `json:"name" redis:"Name"`
-	Email         string `json:"email" redis:"Email"`
-	Password      string `json:"-" redis:"Password"` // Hashed password
-	CreatedAt     int64  `json:"createdAt" redis:"CreatedAt"`
-	LastUsed      int64  `json:"lastUsed" redis:"LastUsed"`
-	DownloadCount int    `json:"downloadCount" redis:"DownloadCount"`
-	IsActive      bool   `json:"isActive" redis:"IsActive"`
-	DeletedAt     int64  `json:"deletedAt" redis:"DeletedAt"`         // Unix timestamp, 0 = not deleted
-	DeletedBy     string `json:"deletedBy" redis:"DeletedBy"`         // "user", "admin", or "system"
-	OriginalEmail string `json:"originalEmail" redis:"OriginalEmail"` // Store original email before deletion
+	Id              int    `json:"id" redis:"id"`
+	Name            string `json:"name" redis:"Name"`
+	Email           string `json:"email" redis:"Email"`
+	Password        string `json:"-" redis:"Password"` // Hashed password
+	CreatedAt       int64  `json:"createdAt" redis:"CreatedAt"`
+	LastUsed        int64  `json:"lastUsed" redis:"LastUsed"`
+	DownloadCount   int    `json:"downloadCount" redis:"DownloadCount"`
+	IsActive        bool   `json:"isActive" redis:"IsActive"`
+	DeletedAt       int64  `json:"deletedAt" redis:"DeletedAt"`             // Unix timestamp, 0 = not deleted
+	DeletedBy       string `json:"deletedBy" redis:"DeletedBy"`             // "user", "admin", or "system"
+	OriginalEmail   string `json:"originalEmail" redis:"OriginalEmail"`     // Store original email before deletion
+	EmailVerifiedAt int64  `json:"emailVerifiedAt" redis:"EmailVerifiedAt"` // Unix timestamp, 0 = email not verified
 }
 
 // DownloadLog tracks individual download events
@@ -37,6 +38,7 @@ type DownloadLog struct {
 	FileSize          int64  `json:"fileSize"`          // Size in bytes
 	FileName          string `json:"fileName"`          // Name of file downloaded
 	IsAuthenticated   bool   `json:"isAuthenticated"`   // True if download required authentication
+	EmailVerifiedAt   int64  `json:"emailVerifiedAt"`   // When the download account verified its email, 0 = not verified
 }
 
 // EmailLog tracks when files are shared via email
@@ -112,3 +114,16 @@ func (e *EmailLog) ToJson() string {
 	}
 	return string(result)
 }
+
+// IsEmailVerified returns true if the owner of the account has verified its email address
+func (d *DownloadAccount) IsEmailVerified() bool {
+	return d.EmailVerifiedAt != 0
+}
+
+// GetEmailVerifiedDate returns the time the email was verified as YYYY-MM-DD HH:MM
+func (d *DownloadLog) GetEmailVerifiedDate() string {
+	if d.EmailVerifiedAt == 0 {
+		return "Not verified"
+	}
+	return time.Unix(d.EmailVerifiedAt, 0).Format("2006-01-02 15:04")
+}
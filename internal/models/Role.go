@@ -0,0 +1,150 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package models
+
+// RolePermission contains zero or more permissions of a role as uint32
+type RolePermission uint32
+
+const (
+	// RolePermUpload allows uploading files
+	RolePermUpload RolePermission = 1 << iota
+	// RolePermShareExternally allows emailing download links to recipients outside WulfVault
+	RolePermShareExternally
+	// RolePermCreateFileRequests allows creating upload request portals
+	RolePermCreateFileRequests
+	// RolePermViewDashboard allows viewing the admin dashboard and server statistics
+	RolePermViewDashboard
+	// RolePermViewAllFiles allows viewing files and download history of all users
+	RolePermViewAllFiles
+	// RolePermManageAllFiles allows editing and deleting files of all users, and managing the trash
+	RolePermManageAllFiles
+	// RolePermManageUsers allows creating, editing and deleting users and download accounts
+	RolePermManageUsers
+	// RolePermManageTeams allows creating, editing and deleting teams and their members
+	RolePermManageTeams
+	// RolePermManageRoles allows creating and editing roles and assigning them to users
+	RolePermManageRoles
+	// RolePermViewAuditLogs allows viewing and exporting the audit log
+	RolePermViewAuditLogs
+	// RolePermManageBranding allows changing the branding
+	RolePermManageBranding
+	// RolePermManageEmail allows configuring the email provider
+	RolePermManageEmail
+	// RolePermManageSettings allows changing server settings and single sign-on
+	RolePermManageSettings
+)
+
+// RolePermNone means no permission granted
+const RolePermNone RolePermission = 0
+
+// RolePermAll means all permissions granted
+const RolePermAll RolePermission = RolePermManageSettings<<1 - 1
+
+// RolePermBasic are the permissions of the built-in User role
+const RolePermBasic = RolePermUpload | RolePermShareExternally | RolePermCreateFileRequests
+
+// RolePermAdministrative are the permissions that give access to the admin area.
+// Users whose role has any of them are admins.
+const RolePermAdministrative = RolePermAll &^ RolePermBasic
+
+// IDs of the built-in roles. They cannot be deleted, and the Administrator role cannot be changed.
+const (
+	RoleIdAdministrator = 1
+	RoleIdUser          = 2
+)
+
+// RolePermissionInfo describes a permission for the admin UI and the REST API
+type RolePermissionInfo struct {
+	Permission  RolePermission
+	Name        string
+	Description string
+}
+
+// RolePermissions lists all permissions in display order
+var RolePermissions = []RolePermissionInfo{
+	{RolePermUpload, "upload", "Upload files"},
+	{RolePermShareExternally, "share_externally", "Email download links to external recipients"},
+	{RolePermCreateFileRequests, "create_file_requests", "Create upload requests"},
+	{RolePermViewDashboard, "view_dashboard", "View admin dashboard and statistics"},
+	{RolePermViewAllFiles, "view_all_files", "View files of all users"},
+	{RolePermManageAllFiles, "manage_all_files", "Edit and delete files of all users, manage trash"},
+	{RolePermManageUsers, "manage_users", "Manage users and download accounts"},
+	{RolePermManageTeams, "manage_teams", "Manage teams"},
+	{RolePermManageRoles, "manage_roles", "Manage roles and assign them"},
+	{RolePermViewAuditLogs, "view_audit_logs", "View and export audit logs"},
+	{RolePermManageBranding, "manage_branding", "Change branding"},
+	{RolePermManageEmail, "manage_email", "Configure email"},
+	{RolePermManageSettings, "manage_settings", "Change server settings and single sign-on"},
+}
+
+// Role is a named set of permissions assigned to users
+type Role struct {
+	Id            int            `json:"id"`
+	Name          string         `json:"name"`
+	Description   string         `json:"description"`
+	Permissions   RolePermission `json:"-"`
+	MaxExpiryDays int            `json:"maxExpiryDays"` // longest file expiry members may choose, 0 = unlimited
+	IsBuiltin     bool           `json:"isBuiltin"`
+	Require2FA    bool           `json:"require2fa"` // members must set up two-factor authentication
+	CreatedAt     int64          `json:"createdAt"`
+
+	// Session limits of members, 0 = the global setting
+	SessionLifetimeHours int `json:"sessionLifetimeHours"`
+	SessionIdleMinutes   int `json:"sessionIdleMinutes"`
+}
+
+// HasPermission returns true if the role has the permission(s)
+func (r *Role) HasPermission(permission RolePermission) bool {
+	return (r.Permissions & permission) == permission
+}
+
+// IsAdministrative returns true if members of the role have access to the admin area
+func (r *Role) IsAdministrative() bool {
+	return r.Permissions&RolePermAdministrative != 0
+}
+
+// PermissionNames returns the names of the granted permissions
+func (r *Role) PermissionNames() []string {
+	names := []string{}
+	for _, p := range RolePermissions {
+		if r.HasPermission(p.Permission) {
+			names = append(names, p.Name)
+		}
+	}
+	return names
+}
+
+// ParseRolePermissions converts permission names to a permission set.
+// It returns false if a name is unknown.
+func ParseRolePermissions(names []string) (RolePermission, bool) {
+	var permissions RolePermission
+	for _, name := range names {
+		found := false
+		for _, p := range RolePermissions {
+			if p.Name == name {
+				permissions |= p.Permission
+				found = true
+				break
+			}
+		}
+		if !found {
+			return RolePermNone, false
+		}
+	}
+	return permissions, true
+}
+
+// LimitExpiryDays applies the role's maximum expiry to the requested number of days.
+// 0 days means the file never expires.
+func (r *Role) LimitExpiryDays(days int) int {
+	if r.MaxExpiryDays <= 0 {
+		return days
+	}
+	if days <= 0 || days > r.MaxExpiryDays {
+		return r.MaxExpiryDays
+	}
+	return days
+}
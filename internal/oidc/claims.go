@@ -0,0 +1,113 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package oidc
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Frimurare/WulfVault/internal/auth"
+	"github.com/Frimurare/WulfVault/internal/database"
+)
+
+// MapClaims turns ID token (and userinfo) claims into an external identity using
+// the configured claim mapping. Claim names may use dots to reach nested claims,
+// e.g. "realm_access.roles".
+func MapClaims(settings *Settings, claims map[string]interface{}) (*auth.ExternalIdentity, error) {
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		return nil, errors.New("missing sub claim")
+	}
+
+	if verified, ok := claims["email_verified"].(bool); ok && !verified {
+		return nil, errors.New("email address is not verified by the identity provider")
+	}
+
+	email := claimString(claims, settings.EmailClaim)
+	if email == "" {
+		return nil, fmt.Errorf("missing %s claim", settings.EmailClaim)
+	}
+
+	// Providers that don't send email_verified can be trusted explicitly
+	verified, _ := claims["email_verified"].(bool)
+
+	id := &auth.ExternalIdentity{
+		Source:        database.AuthSourceOIDC,
+		Subject:       subject,
+		Email:         email,
+		Name:          claimString(claims, settings.NameClaim),
+		EmailVerified: verified || settings.TrustEmails,
+	}
+
+	// Roles are only managed by the IdP when an admin group is configured
+	if settings.AdminGroup != "" {
+		isAdmin := false
+		for _, g := range claimStrings(claims, settings.GroupsClaim) {
+			if g == settings.AdminGroup {
+				isAdmin = true
+				break
+			}
+		}
+		id.IsAdmin = &isAdmin
+	}
+
+	return id, nil
+}
+
+// lookupClaim resolves a possibly dotted claim path
+func lookupClaim(claims map[string]interface{}, path string) interface{} {
+	if v, ok := claims[path]; ok {
+		return v
+	}
+
+	var current interface{} = claims
+	for _, part := range strings.Split(path, ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		current = m[part]
+	}
+	return current
+}
+
+// claimString returns a string claim
+func claimString(claims map[string]interface{}, path string) string {
+	if path == "" {
+		return ""
+	}
+	s, _ := lookupClaim(claims, path).(string)
+	return strings.TrimSpace(s)
+}
+
+// claimStrings returns a claim that is a string array, or a single or
+// comma-separated string
+func claimStrings(claims map[string]interface{}, path string) []string {
+	if path == "" {
+		return nil
+	}
+
+	switch v := lookupClaim(claims, path).(type) {
+	case []interface{}:
+		var out []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	case string:
+		var out []string
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
@@ -0,0 +1,221 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+)
+
+// clockSkew is the tolerance applied to exp, iat and nbf
+const clockSkew = 2 * time.Minute
+
+// jwk is a single key from the IdP's JSON Web Key Set
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type keySet struct {
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+}
+
+var (
+	keysMutex sync.Mutex
+	keySets   = map[string]*keySet{}
+)
+
+// signatureHashes lists the supported ID token signature algorithms
+var signatureHashes = map[string]crypto.Hash{
+	"RS256": crypto.SHA256,
+	"RS384": crypto.SHA384,
+	"RS512": crypto.SHA512,
+}
+
+// VerifyIDToken checks the signature and standard claims of an ID token and
+// returns its claims
+func VerifyIDToken(ctx context.Context, p *Provider, settings *Settings, rawToken, nonce string) (map[string]interface{}, error) {
+	parts := strings.Split(rawToken, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed ID token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("invalid ID token header: %w", err)
+	}
+
+	hash, ok := signatureHashes[header.Alg]
+	if !ok {
+		return nil, fmt.Errorf("unsupported ID token algorithm %q", header.Alg)
+	}
+
+	key, err := signingKey(ctx, p, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("invalid ID token signature encoding")
+	}
+
+	h := hash.New()
+	h.Write([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, hash, h.Sum(nil), signature); err != nil {
+		return nil, errors.New("invalid ID token signature")
+	}
+
+	claims := map[string]interface{}{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("invalid ID token payload: %w", err)
+	}
+
+	if iss, _ := claims["iss"].(string); strings.TrimSuffix(iss, "/") != strings.TrimSuffix(p.Issuer, "/") {
+		return nil, errors.New("ID token issuer mismatch")
+	}
+	if !audienceContains(claims["aud"], settings.ClientID) {
+		return nil, errors.New("ID token audience mismatch")
+	}
+	if azp, ok := claims["azp"].(string); ok && azp != settings.ClientID {
+		return nil, errors.New("ID token authorized party mismatch")
+	}
+
+	now := time.Now()
+	exp, ok := numericClaim(claims, "exp")
+	if !ok || now.After(time.Unix(exp, 0).Add(clockSkew)) {
+		return nil, errors.New("ID token expired")
+	}
+	if nbf, ok := numericClaim(claims, "nbf"); ok && now.Add(clockSkew).Before(time.Unix(nbf, 0)) {
+		return nil, errors.New("ID token not yet valid")
+	}
+
+	tokenNonce, _ := claims["nonce"].(string)
+	if subtle.ConstantTimeCompare([]byte(tokenNonce), []byte(nonce)) != 1 {
+		return nil, errors.New("ID token nonce mismatch")
+	}
+
+	if sub, _ := claims["sub"].(string); sub == "" {
+		return nil, errors.New("ID token has no subject")
+	}
+
+	return claims, nil
+}
+
+// signingKey returns the IdP key with the given ID, refreshing the key set once
+// if the key is unknown (the IdP may have rotated its keys)
+func signingKey(ctx context.Context, p *Provider, kid string) (*rsa.PublicKey, error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		keysMutex.Lock()
+		set, ok := keySets[p.JWKSURI]
+		keysMutex.Unlock()
+
+		if !ok || attempt > 0 || time.Since(set.fetchedAt) > discoveryTTL {
+			var err error
+			set, err = fetchKeySet(ctx, p.JWKSURI)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if kid == "" && len(set.keys) == 1 {
+			for _, k := range set.keys {
+				return k, nil
+			}
+		}
+		if k, ok := set.keys[kid]; ok {
+			return k, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown ID token signing key %q", kid)
+}
+
+// fetchKeySet downloads and caches the IdP's RSA signing keys
+func fetchKeySet(ctx context.Context, jwksURI string) (*keySet, error) {
+	var doc struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := getJSON(ctx, jwksURI, &doc); err != nil {
+		return nil, fmt.Errorf("failed to fetch signing keys: %w", err)
+	}
+
+	set := &keySet{keys: map[string]*rsa.PublicKey{}, fetchedAt: time.Now()}
+	for _, k := range doc.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			continue
+		}
+		set.keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	keysMutex.Lock()
+	keySets[jwksURI] = set
+	keysMutex.Unlock()
+
+	return set, nil
+}
+
+// decodeSegment decodes a base64url JWT segment into v
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(segment, "="))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// audienceContains reports whether the aud claim (string or array) contains clientID
+func audienceContains(aud interface{}, clientID string) bool {
+	switch v := aud.(type) {
+	case string:
+		return v == clientID
+	case []interface{}:
+		for _, a := range v {
+			if s, ok := a.(string); ok && s == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// numericClaim reads a NumericDate claim
+func numericClaim(claims map[string]interface{}, name string) (int64, bool) {
+	v, ok := claims[name].(float64)
+	if !ok {
+		return 0, false
+	}
+	return int64(v), true
+}
@@ -0,0 +1,281 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+// Package oidc implements OpenID Connect single sign-on using the
+// authorization code flow with PKCE and provider discovery.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// AuthRequestTTL is how long a user has to complete the login at the IdP
+	AuthRequestTTL = 10 * time.Minute
+	// discoveryTTL is how long discovery documents and keys are cached
+	discoveryTTL = 1 * time.Hour
+)
+
+var httpClient = &http.Client{Timeout: 15 * time.Second}
+
+// Provider holds the endpoints published in the IdP's discovery document
+type Provider struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+
+	fetchedAt time.Time
+}
+
+// AuthRequest is the state kept between redirecting to the IdP and the callback
+type AuthRequest struct {
+	State        string
+	Nonce        string
+	CodeVerifier string
+	Redirect     string
+	CreatedAt    time.Time
+}
+
+var (
+	providerMutex sync.Mutex
+	providers     = map[string]*Provider{}
+
+	pendingMutex sync.Mutex
+	pending      = map[string]*AuthRequest{}
+)
+
+// Discover fetches (or returns the cached) discovery document for an issuer
+func Discover(ctx context.Context, issuer string) (*Provider, error) {
+	issuer = strings.TrimSuffix(issuer, "/")
+	if issuer == "" {
+		return nil, errors.New("OIDC issuer not configured")
+	}
+
+	providerMutex.Lock()
+	cached, ok := providers[issuer]
+	providerMutex.Unlock()
+	if ok && time.Since(cached.fetchedAt) < discoveryTTL {
+		return cached, nil
+	}
+
+	var p Provider
+	if err := getJSON(ctx, issuer+"/.well-known/openid-configuration", &p); err != nil {
+		return nil, fmt.Errorf("discovery failed: %w", err)
+	}
+
+	if strings.TrimSuffix(p.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("discovery issuer mismatch: expected %s, got %s", issuer, p.Issuer)
+	}
+	if p.AuthorizationEndpoint == "" || p.TokenEndpoint == "" || p.JWKSURI == "" {
+		return nil, errors.New("discovery document is missing required endpoints")
+	}
+
+	p.fetchedAt = time.Now()
+	providerMutex.Lock()
+	providers[issuer] = &p
+	providerMutex.Unlock()
+
+	return &p, nil
+}
+
+// NewAuthRequest creates and remembers the state, nonce and PKCE verifier for a login
+func NewAuthRequest(redirect string) (*AuthRequest, error) {
+	state, err := randomString(24)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := randomString(24)
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := randomString(48)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &AuthRequest{
+		State:        state,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		Redirect:     redirect,
+		CreatedAt:    time.Now(),
+	}
+
+	pendingMutex.Lock()
+	defer pendingMutex.Unlock()
+
+	// Drop abandoned logins
+	for k, v := range pending {
+		if time.Since(v.CreatedAt) > AuthRequestTTL {
+			delete(pending, k)
+		}
+	}
+	pending[state] = req
+
+	return req, nil
+}
+
+// TakeAuthRequest returns and forgets the pending login for a state value.
+// Each state can only be used once.
+func TakeAuthRequest(state string) (*AuthRequest, error) {
+	pendingMutex.Lock()
+	defer pendingMutex.Unlock()
+
+	req, ok := pending[state]
+	if !ok {
+		return nil, errors.New("unknown or already used login state")
+	}
+	delete(pending, state)
+
+	if time.Since(req.CreatedAt) > AuthRequestTTL {
+		return nil, errors.New("login request expired")
+	}
+	return req, nil
+}
+
+// AuthCodeURL builds the authorization endpoint URL for a login request
+func AuthCodeURL(p *Provider, settings *Settings, redirectURI string, req *AuthRequest) string {
+	challenge := sha256.Sum256([]byte(req.CodeVerifier))
+
+	v := url.Values{}
+	v.Set("response_type", "code")
+	v.Set("client_id", settings.ClientID)
+	v.Set("redirect_uri", redirectURI)
+	v.Set("scope", settings.Scopes)
+	v.Set("state", req.State)
+	v.Set("nonce", req.Nonce)
+	v.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	v.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(p.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return p.AuthorizationEndpoint + sep + v.Encode()
+}
+
+// TokenResponse is the token endpoint's response
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	IDToken     string `json:"id_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// Exchange redeems an authorization code at the token endpoint
+func Exchange(ctx context.Context, p *Provider, settings *Settings, redirectURI, code, codeVerifier string) (*TokenResponse, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", redirectURI)
+	form.Set("client_id", settings.ClientID)
+	form.Set("code_verifier", codeVerifier)
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	httpReq.Header.Set("Accept", "application/json")
+	if settings.ClientSecret != "" {
+		httpReq.SetBasicAuth(url.QueryEscape(settings.ClientID), url.QueryEscape(settings.ClientSecret))
+	}
+
+	resp, err := httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint returned %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var tokens TokenResponse
+	if err := json.Unmarshal(body, &tokens); err != nil {
+		return nil, fmt.Errorf("invalid token response: %w", err)
+	}
+	if tokens.IDToken == "" {
+		return nil, errors.New("token response contains no id_token")
+	}
+	return &tokens, nil
+}
+
+// Userinfo fetches claims from the userinfo endpoint
+func Userinfo(ctx context.Context, p *Provider, accessToken string) (map[string]interface{}, error) {
+	if p.UserinfoEndpoint == "" || accessToken == "" {
+		return nil, errors.New("userinfo not available")
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, p.UserinfoEndpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+accessToken)
+	httpReq.Header.Set("Accept", "application/json")
+
+	resp, err := httpClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("userinfo endpoint returned %d", resp.StatusCode)
+	}
+
+	claims := map[string]interface{}{}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// getJSON fetches a URL and decodes the JSON response
+func getJSON(ctx context.Context, u string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %d", u, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+// randomString returns a URL-safe random string of n random bytes
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,270 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mockIdP is a minimal OpenID provider supporting discovery, the authorization
+// code flow with PKCE and RS256-signed ID tokens
+type mockIdP struct {
+	server   *httptest.Server
+	key      *rsa.PrivateKey
+	clientID string
+	claims   map[string]interface{}
+
+	mu    sync.Mutex
+	codes map[string]mockCode
+}
+
+type mockCode struct {
+	challenge   string
+	nonce       string
+	redirectURI string
+}
+
+func newMockIdP(t *testing.T, clientID string, claims map[string]interface{}) *mockIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idp := &mockIdP{key: key, clientID: clientID, claims: claims, codes: map[string]mockCode{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.server.URL,
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"jwks_uri":               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("client_id") != clientID || q.Get("code_challenge_method") != "S256" || q.Get("response_type") != "code" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		code := "code-" + q.Get("state")
+		idp.mu.Lock()
+		idp.codes[code] = mockCode{challenge: q.Get("code_challenge"), nonce: q.Get("nonce"), redirectURI: q.Get("redirect_uri")}
+		idp.mu.Unlock()
+		http.Redirect(w, r, q.Get("redirect_uri")+"?code="+code+"&state="+url.QueryEscape(q.Get("state")), http.StatusFound)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		idp.mu.Lock()
+		c, ok := idp.codes[r.FormValue("code")]
+		delete(idp.codes, r.FormValue("code"))
+		idp.mu.Unlock()
+
+		sum := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+		if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != c.challenge || r.FormValue("redirect_uri") != c.redirectURI {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"id_token":     idp.sign(t, c.nonce),
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test-key",
+				"use": "sig",
+				"alg": "RS256",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+// sign issues an ID token carrying the IdP's claims
+func (idp *mockIdP) sign(t *testing.T, nonce string) string {
+	claims := map[string]interface{}{
+		"iss":   idp.server.URL,
+		"aud":   idp.clientID,
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"iat":   time.Now().Unix(),
+		"nonce": nonce,
+	}
+	for k, v := range idp.claims {
+		claims[k] = v
+	}
+
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test-key", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	h := sha256.Sum256([]byte(signingInput))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, idp.key, crypto.SHA256, h[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// login runs the browser part of the flow and returns the code and state from the callback
+func login(t *testing.T, authURL string) (string, string) {
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	loc, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || loc.Query().Get("code") == "" {
+		t.Fatalf("no code in callback redirect (status %d)", resp.StatusCode)
+	}
+	return loc.Query().Get("code"), loc.Query().Get("state")
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	idp := newMockIdP(t, "wulfvault", map[string]interface{}{
+		"sub":            "user-123",
+		"email":          "Staff@Example.com",
+		"email_verified": true,
+		"name":           "Staff Member",
+		"realm_access":   map[string]interface{}{"roles": []interface{}{"staff", "wulfvault-admins"}},
+	})
+
+	settings := &Settings{
+		Issuer:      idp.server.URL,
+		ClientID:    "wulfvault",
+		Scopes:      DefaultScopes,
+		EmailClaim:  DefaultEmailClaim,
+		NameClaim:   DefaultNameClaim,
+		GroupsClaim: "realm_access.roles",
+		AdminGroup:  "wulfvault-admins",
+	}
+	redirectURI := "http://wulfvault.test/auth/oidc/callback"
+	ctx := context.Background()
+
+	provider, err := Discover(ctx, settings.Issuer)
+	if err != nil {
+		t.Fatalf("discovery: %v", err)
+	}
+
+	authReq, err := NewAuthRequest("/dashboard")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, state := login(t, AuthCodeURL(provider, settings, redirectURI, authReq))
+
+	pending, err := TakeAuthRequest(state)
+	if err != nil {
+		t.Fatalf("take auth request: %v", err)
+	}
+	if _, err := TakeAuthRequest(state); err == nil {
+		t.Error("state could be used twice")
+	}
+
+	if _, err := Exchange(ctx, provider, settings, redirectURI, code, "wrong-verifier"); err == nil {
+		t.Error("token exchange succeeded with a wrong PKCE verifier")
+	}
+
+	code, _ = login(t, AuthCodeURL(provider, settings, redirectURI, pending))
+	tokens, err := Exchange(ctx, provider, settings, redirectURI, code, pending.CodeVerifier)
+	if err != nil {
+		t.Fatalf("exchange: %v", err)
+	}
+
+	if _, err := VerifyIDToken(ctx, provider, settings, tokens.IDToken, "other-nonce"); err == nil {
+		t.Error("ID token accepted with wrong nonce")
+	}
+
+	parts := strings.Split(tokens.IDToken, ".")
+	tampered := parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"admin"}`)) + "." + parts[2]
+	if _, err := VerifyIDToken(ctx, provider, settings, tampered, pending.Nonce); err == nil {
+		t.Error("tampered ID token accepted")
+	}
+
+	claims, err := VerifyIDToken(ctx, provider, settings, tokens.IDToken, pending.Nonce)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+
+	identity, err := MapClaims(settings, claims)
+	if err != nil {
+		t.Fatalf("map claims: %v", err)
+	}
+	if identity.Subject != "user-123" || identity.Email != "Staff@Example.com" || identity.Name != "Staff Member" {
+		t.Errorf("unexpected identity: %+v", identity)
+	}
+	if identity.IsAdmin == nil || !*identity.IsAdmin {
+		t.Error("admin group membership not mapped")
+	}
+
+	settings.AdminGroup = "other-group"
+	identity, _ = MapClaims(settings, claims)
+	if identity.IsAdmin == nil || *identity.IsAdmin {
+		t.Error("user outside the admin group mapped as admin")
+	}
+}
+
+func TestMapClaimsRejectsUnverifiedEmail(t *testing.T) {
+	settings := &Settings{EmailClaim: DefaultEmailClaim}
+	_, err := MapClaims(settings, map[string]interface{}{
+		"sub":            "x",
+		"email":          "a@example.com",
+		"email_verified": false,
+	})
+	if err == nil {
+		t.Error("unverified email accepted")
+	}
+}
+
+func TestMapClaimsEmailVerified(t *testing.T) {
+	settings := &Settings{EmailClaim: DefaultEmailClaim}
+	claims := map[string]interface{}{"sub": "x", "email": "a@example.com"}
+
+	// A missing claim is not a verified email
+	identity, err := MapClaims(settings, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.EmailVerified {
+		t.Error("email without email_verified treated as verified")
+	}
+
+	settings.TrustEmails = true
+	if identity, _ = MapClaims(settings, claims); !identity.EmailVerified {
+		t.Error("trusted provider email not treated as verified")
+	}
+
+	settings.TrustEmails = false
+	claims["email_verified"] = true
+	if identity, _ = MapClaims(settings, claims); !identity.EmailVerified {
+		t.Error("email_verified claim ignored")
+	}
+}
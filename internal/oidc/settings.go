@@ -0,0 +1,100 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package oidc
+
+import (
+	"log"
+
+	"github.com/Frimurare/WulfVault/internal/database"
+	"github.com/Frimurare/WulfVault/internal/email"
+)
+
+// Default claim mapping and scopes
+const (
+	DefaultScopes      = "openid email profile"
+	DefaultEmailClaim  = "email"
+	DefaultNameClaim   = "name"
+	DefaultGroupsClaim = "groups"
+	DefaultButtonLabel = "Sign in with SSO"
+)
+
+// Settings is the OIDC configuration stored in the Configuration table
+type Settings struct {
+	Enabled               bool
+	Issuer                string
+	ClientID              string
+	ClientSecret          string
+	Scopes                string
+	EmailClaim            string
+	NameClaim             string
+	GroupsClaim           string
+	AdminGroup            string
+	ButtonLabel           string
+	AutoProvision         bool
+	DisableLocalPasswords bool
+	// TrustEmails links existing accounts by email even without email_verified
+	TrustEmails bool
+}
+
+// LoadSettings reads the OIDC settings, applying defaults for unset values
+func LoadSettings() *Settings {
+	get := func(key, fallback string) string {
+		value, err := database.DB.GetConfigValue(key)
+		if err != nil || value == "" {
+			return fallback
+		}
+		return value
+	}
+
+	s := &Settings{
+		Enabled:               get("oidc_enabled", "false") == "true",
+		Issuer:                get("oidc_issuer", ""),
+		ClientID:              get("oidc_client_id", ""),
+		Scopes:                get("oidc_scopes", DefaultScopes),
+		EmailClaim:            get("oidc_email_claim", DefaultEmailClaim),
+		NameClaim:             get("oidc_name_claim", DefaultNameClaim),
+		GroupsClaim:           get("oidc_groups_claim", DefaultGroupsClaim),
+		AdminGroup:            get("oidc_admin_group", ""),
+		ButtonLabel:           get("oidc_button_label", DefaultButtonLabel),
+		AutoProvision:         get("oidc_auto_provision", "true") == "true",
+		DisableLocalPasswords: get("oidc_disable_local_passwords", "false") == "true",
+		TrustEmails:           get("oidc_trust_emails", "false") == "true",
+	}
+
+	if encrypted := get("oidc_client_secret", ""); encrypted != "" {
+		masterKey, err := email.GetOrCreateMasterKey(database.DB)
+		if err == nil {
+			s.ClientSecret, err = email.DecryptAPIKey(encrypted, masterKey)
+		}
+		if err != nil {
+			log.Printf("Warning: Could not decrypt OIDC client secret: %v", err)
+		}
+	}
+
+	return s
+}
+
+// Configured reports whether SSO is enabled and has the minimum required settings
+func (s *Settings) Configured() bool {
+	return s.Enabled && s.Issuer != "" && s.ClientID != ""
+}
+
+// SaveClientSecret stores the client secret encrypted with the server master key
+func SaveClientSecret(secret string) error {
+	if secret == "" {
+		return database.DB.SetConfigValue("oidc_client_secret", "")
+	}
+
+	masterKey, err := email.GetOrCreateMasterKey(database.DB)
+	if err != nil {
+		return err
+	}
+	encrypted, err := email.EncryptAPIKey(secret, masterKey)
+	if err != nil {
+		return err
+	}
+	return database.DB.SetConfigValue("oidc_client_secret", encrypted)
+}
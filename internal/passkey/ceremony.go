@@ -0,0 +1,81 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package passkey
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+// ceremonyTTL is how long the browser has to answer a WebAuthn challenge
+const ceremonyTTL = 5 * time.Minute
+
+const (
+	ceremonyRegistration = "registration"
+	ceremonyLogin        = "login"
+	ceremonyDiscoverable = "discoverable"
+)
+
+// ceremony is the server side state of a registration or login in progress
+type ceremony struct {
+	kind      string
+	userId    int
+	session   *webauthn.SessionData
+	createdAt time.Time
+}
+
+var (
+	ceremonyMutex sync.Mutex
+	ceremonies    = map[string]*ceremony{}
+)
+
+// startCeremony remembers the session data of a new ceremony and returns its ID
+func startCeremony(kind string, userId int, session *webauthn.SessionData) (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	id := base64.RawURLEncoding.EncodeToString(b)
+
+	ceremonyMutex.Lock()
+	defer ceremonyMutex.Unlock()
+
+	// Drop abandoned ceremonies
+	for k, c := range ceremonies {
+		if time.Since(c.createdAt) > ceremonyTTL {
+			delete(ceremonies, k)
+		}
+	}
+	ceremonies[id] = &ceremony{kind: kind, userId: userId, session: session, createdAt: time.Now()}
+
+	return id, nil
+}
+
+// takeCeremony returns and forgets a pending ceremony. Each challenge can only
+// be answered once, and only by the user it was issued for.
+func takeCeremony(id, kind string, userId int) (*webauthn.SessionData, error) {
+	ceremonyMutex.Lock()
+	defer ceremonyMutex.Unlock()
+
+	c, ok := ceremonies[id]
+	if !ok {
+		return nil, errors.New("unknown or already used passkey challenge")
+	}
+	delete(ceremonies, id)
+
+	if c.kind != kind || c.userId != userId {
+		return nil, errors.New("passkey challenge does not match this request")
+	}
+	if time.Since(c.createdAt) > ceremonyTTL {
+		return nil, errors.New("passkey challenge expired")
+	}
+	return c.session, nil
+}
@@ -0,0 +1,372 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+// Package passkey implements WebAuthn registration and sign-in with passkeys
+// and security keys, as a second factor or for passwordless login.
+package passkey
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Frimurare/WulfVault/internal/database"
+	"github.com/Frimurare/WulfVault/internal/models"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+var (
+	// ErrNoCredentials is returned when a user has no passkeys to sign in with
+	ErrNoCredentials = errors.New("no passkeys registered")
+	// ErrCloneWarning is returned when an authenticator's signature counter went backwards
+	ErrCloneWarning = errors.New("passkey signature counter did not increase; the authenticator may have been cloned")
+)
+
+// RelyingParty performs WebAuthn ceremonies for one public origin
+type RelyingParty struct {
+	webAuthn *webauthn.WebAuthn
+}
+
+// New creates a relying party for the given public URLs. The relying party ID is
+// the host of the first URL; every URL is accepted as an origin.
+func New(displayName string, publicURLs ...string) (*RelyingParty, error) {
+	var rpID string
+	var origins []string
+	for _, raw := range publicURLs {
+		u, err := url.Parse(strings.TrimSpace(raw))
+		if err != nil || u.Host == "" {
+			continue
+		}
+		if rpID == "" {
+			rpID = u.Hostname()
+		}
+		origin := u.Scheme + "://" + u.Host
+		if !contains(origins, origin) {
+			origins = append(origins, origin)
+		}
+	}
+	if rpID == "" {
+		return nil, errors.New("server URL is not configured")
+	}
+
+	w, err := webauthn.New(&webauthn.Config{
+		RPID:          rpID,
+		RPDisplayName: displayName,
+		RPOrigins:     origins,
+		Timeouts: webauthn.TimeoutsConfig{
+			Login:        webauthn.TimeoutConfig{Enforce: true, Timeout: ceremonyTTL, TimeoutUVD: ceremonyTTL},
+			Registration: webauthn.TimeoutConfig{Enforce: true, Timeout: ceremonyTTL, TimeoutUVD: ceremonyTTL},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &RelyingParty{webAuthn: w}, nil
+}
+
+// BeginRegistration starts adding a passkey for a user. The options are passed
+// to navigator.credentials.create(); the ceremony ID identifies the pending
+// registration in FinishRegistration.
+func (rp *RelyingParty) BeginRegistration(user *models.User) (*protocol.CredentialCreation, string, error) {
+	wu, err := loadUser(user, true)
+	if err != nil {
+		return nil, "", err
+	}
+
+	exclude := make([]protocol.CredentialDescriptor, 0, len(wu.credentials))
+	for _, c := range wu.credentials {
+		exclude = append(exclude, c.Descriptor())
+	}
+
+	// Resident keys are preferred so the same credential also works for passwordless login
+	creation, session, err := rp.webAuthn.BeginRegistration(wu,
+		webauthn.WithExclusions(exclude),
+		webauthn.WithAuthenticatorSelection(protocol.AuthenticatorSelection{
+			ResidentKey:        protocol.ResidentKeyRequirementPreferred,
+			RequireResidentKey: protocol.ResidentKeyNotRequired(),
+			UserVerification:   protocol.VerificationPreferred,
+		}))
+	if err != nil {
+		return nil, "", err
+	}
+
+	id, err := startCeremony(ceremonyRegistration, user.Id, session)
+	if err != nil {
+		return nil, "", err
+	}
+	return creation, id, nil
+}
+
+// FinishRegistration verifies the authenticator's response and stores the new credential
+func (rp *RelyingParty) FinishRegistration(user *models.User, ceremonyID, name string, body io.Reader) (*database.WebAuthnCredential, error) {
+	session, err := takeCeremony(ceremonyID, ceremonyRegistration, user.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBody(body)
+	if err != nil {
+		return nil, describe(err)
+	}
+
+	wu, err := loadUser(user, false)
+	if err != nil {
+		return nil, err
+	}
+
+	credential, err := rp.webAuthn.CreateCredential(wu, *session, parsed)
+	if err != nil {
+		return nil, describe(err)
+	}
+
+	transports := make([]string, 0, len(credential.Transport))
+	for _, t := range credential.Transport {
+		transports = append(transports, string(t))
+	}
+
+	now := time.Now().Unix()
+	stored := &database.WebAuthnCredential{
+		UserId:          user.Id,
+		Name:            name,
+		CredentialId:    credential.ID,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		Transports:      strings.Join(transports, ","),
+		AAGUID:          credential.Authenticator.AAGUID,
+		SignCount:       credential.Authenticator.SignCount,
+		BackupEligible:  credential.Flags.BackupEligible,
+		BackupState:     credential.Flags.BackupState,
+		CreatedAt:       now,
+	}
+	if err := database.DB.CreateWebAuthnCredential(stored); err != nil {
+		return nil, err
+	}
+	return stored, nil
+}
+
+// BeginLogin starts a second factor check for a user who already entered a password
+func (rp *RelyingParty) BeginLogin(user *models.User) (*protocol.CredentialAssertion, string, error) {
+	wu, err := loadUser(user, false)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(wu.credentials) == 0 {
+		return nil, "", ErrNoCredentials
+	}
+
+	assertion, session, err := rp.webAuthn.BeginLogin(wu, webauthn.WithUserVerification(protocol.VerificationPreferred))
+	if err != nil {
+		return nil, "", err
+	}
+
+	id, err := startCeremony(ceremonyLogin, user.Id, session)
+	if err != nil {
+		return nil, "", err
+	}
+	return assertion, id, nil
+}
+
+// FinishLogin verifies a second factor assertion for the user
+func (rp *RelyingParty) FinishLogin(user *models.User, ceremonyID string, body io.Reader) (*database.WebAuthnCredential, error) {
+	session, err := takeCeremony(ceremonyID, ceremonyLogin, user.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBody(body)
+	if err != nil {
+		return nil, describe(err)
+	}
+
+	wu, err := loadUser(user, false)
+	if err != nil {
+		return nil, err
+	}
+
+	credential, err := rp.webAuthn.ValidateLogin(wu, *session, parsed)
+	if err != nil {
+		return nil, describe(err)
+	}
+	return wu.recordUse(credential)
+}
+
+// BeginDiscoverableLogin starts a passwordless login. The browser offers every
+// passkey the user has for this site; user verification is required because
+// the passkey replaces both the password and the second factor.
+func (rp *RelyingParty) BeginDiscoverableLogin() (*protocol.CredentialAssertion, string, error) {
+	assertion, session, err := rp.webAuthn.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+	if err != nil {
+		return nil, "", err
+	}
+
+	id, err := startCeremony(ceremonyDiscoverable, 0, session)
+	if err != nil {
+		return nil, "", err
+	}
+	return assertion, id, nil
+}
+
+// FinishDiscoverableLogin verifies a passwordless assertion and returns the user it belongs to
+func (rp *RelyingParty) FinishDiscoverableLogin(ceremonyID string, body io.Reader) (*models.User, *database.WebAuthnCredential, error) {
+	session, err := takeCeremony(ceremonyID, ceremonyDiscoverable, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBody(body)
+	if err != nil {
+		return nil, nil, describe(err)
+	}
+
+	var wu *user
+	handler := func(rawID, userHandle []byte) (webauthn.User, error) {
+		userId, err := database.DB.GetUserIDByWebAuthnHandle(encodeHandle(userHandle))
+		if err != nil {
+			return nil, errors.New("unknown passkey")
+		}
+		u, err := database.DB.GetUserByID(userId)
+		if err != nil {
+			return nil, errors.New("unknown passkey")
+		}
+		if wu, err = loadUser(u, false); err != nil {
+			return nil, err
+		}
+		return wu, nil
+	}
+
+	_, credential, err := rp.webAuthn.ValidatePasskeyLogin(handler, *session, parsed)
+	if err != nil {
+		return nil, nil, describe(err)
+	}
+
+	stored, err := wu.recordUse(credential)
+	if err != nil {
+		return nil, nil, err
+	}
+	return wu.account, stored, nil
+}
+
+// user adapts a WulfVault user and its stored credentials to webauthn.User
+type user struct {
+	account     *models.User
+	handle      []byte
+	credentials []webauthn.Credential
+	stored      []*database.WebAuthnCredential
+}
+
+func (u *user) WebAuthnID() []byte          { return u.handle }
+func (u *user) WebAuthnName() string        { return u.account.Email }
+func (u *user) WebAuthnDisplayName() string { return u.account.Name }
+
+func (u *user) WebAuthnCredentials() []webauthn.Credential { return u.credentials }
+
+// recordUse stores the new signature counter of the credential used to sign in
+func (u *user) recordUse(credential *webauthn.Credential) (*database.WebAuthnCredential, error) {
+	if credential.Authenticator.CloneWarning {
+		return nil, ErrCloneWarning
+	}
+
+	for _, c := range u.stored {
+		if bytes.Equal(c.CredentialId, credential.ID) {
+			c.SignCount = credential.Authenticator.SignCount
+			c.BackupState = credential.Flags.BackupState
+			c.LastUsedAt = time.Now().Unix()
+			if err := database.DB.UpdateWebAuthnCredentialUse(c.Id, c.SignCount, c.BackupState, c.LastUsedAt); err != nil {
+				return nil, err
+			}
+			return c, nil
+		}
+	}
+	return nil, errors.New("credential not found")
+}
+
+// loadUser reads the handle and credentials of a user. With create set, a
+// handle is assigned if the user does not have one yet.
+func loadUser(account *models.User, create bool) (*user, error) {
+	encoded, err := database.DB.GetWebAuthnHandle(account.Id)
+	if err != nil {
+		return nil, err
+	}
+	if encoded == "" {
+		if !create {
+			return &user{account: account}, nil
+		}
+		raw := make([]byte, 32)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		if err := database.DB.SetWebAuthnHandle(account.Id, encodeHandle(raw)); err != nil {
+			return nil, err
+		}
+		// Re-read in case a concurrent request assigned one first
+		if encoded, err = database.DB.GetWebAuthnHandle(account.Id); err != nil {
+			return nil, err
+		}
+	}
+
+	handle, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid WebAuthn handle for user %d: %w", account.Id, err)
+	}
+
+	stored, err := database.DB.GetWebAuthnCredentials(account.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	u := &user{account: account, handle: handle, stored: stored}
+	for _, c := range stored {
+		var transports []protocol.AuthenticatorTransport
+		for _, t := range strings.Split(c.Transports, ",") {
+			if t != "" {
+				transports = append(transports, protocol.AuthenticatorTransport(t))
+			}
+		}
+		u.credentials = append(u.credentials, webauthn.Credential{
+			ID:              c.CredentialId,
+			PublicKey:       c.PublicKey,
+			AttestationType: c.AttestationType,
+			Transport:       transports,
+			Flags: webauthn.CredentialFlags{
+				BackupEligible: c.BackupEligible,
+				BackupState:    c.BackupState,
+			},
+			Authenticator: webauthn.Authenticator{
+				AAGUID:    c.AAGUID,
+				SignCount: c.SignCount,
+			},
+		})
+	}
+	return u, nil
+}
+
+func encodeHandle(handle []byte) string {
+	return base64.RawURLEncoding.EncodeToString(handle)
+}
+
+// describe adds the library's details to protocol errors, which otherwise only say "bad request"
+func describe(err error) error {
+	var perr *protocol.Error
+	if errors.As(err, &perr) && perr.Details != "" {
+		return fmt.Errorf("%s: %s", perr.Type, perr.Details)
+	}
+	return err
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,278 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package passkey
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/Frimurare/WulfVault/internal/database"
+	"github.com/Frimurare/WulfVault/internal/models"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/go-webauthn/webauthn/protocol"
+)
+
+const (
+	testOrigin = "https://files.example.com"
+	testRPID   = "files.example.com"
+)
+
+// Authenticator data flags
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttested     = 0x40
+)
+
+// softAuthenticator is a software passkey with a P-256 key and "none" attestation
+type softAuthenticator struct {
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   []byte
+	signCount    uint32
+	origin       string
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+	return &softAuthenticator{key: key, credentialID: id, origin: testOrigin}
+}
+
+func b64(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+
+func (a *softAuthenticator) clientData(kind string, challenge protocol.URLEncodedBase64) []byte {
+	data, _ := json.Marshal(map[string]string{
+		"type":      kind,
+		"challenge": challenge.String(),
+		"origin":    a.origin,
+	})
+	return data
+}
+
+func (a *softAuthenticator) authData(flags byte) []byte {
+	rpHash := sha256.Sum256([]byte(testRPID))
+	a.signCount++
+	data := append(rpHash[:], flags)
+	return binary.BigEndian.AppendUint32(data, a.signCount)
+}
+
+// create answers navigator.credentials.create()
+func (a *softAuthenticator) create(t *testing.T, options *protocol.CredentialCreation) []byte {
+	t.Helper()
+	handle, ok := options.Response.User.ID.(protocol.URLEncodedBase64)
+	if !ok {
+		t.Fatalf("unexpected user ID type %T", options.Response.User.ID)
+	}
+	a.userHandle = handle
+
+	coseKey, err := cbor.Marshal(map[int]interface{}{
+		1:  2,  // kty: EC2
+		3:  -7, // alg: ES256
+		-1: 1,  // crv: P-256
+		-2: a.key.X.FillBytes(make([]byte, 32)),
+		-3: a.key.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authData := a.authData(flagUserPresent | flagUserVerified | flagAttested)
+	authData = append(authData, make([]byte, 16)...) // AAGUID
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(a.credentialID)))
+	authData = append(authData, a.credentialID...)
+	authData = append(authData, coseKey...)
+
+	attestation, err := cbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": authData,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"id":    b64(a.credentialID),
+		"rawId": b64(a.credentialID),
+		"type":  "public-key",
+		"response": map[string]interface{}{
+			"clientDataJSON":    b64(a.clientData("webauthn.create", options.Response.Challenge)),
+			"attestationObject": b64(attestation),
+			"transports":        []string{"internal"},
+		},
+	})
+	return body
+}
+
+// get answers navigator.credentials.get()
+func (a *softAuthenticator) get(t *testing.T, options *protocol.CredentialAssertion, flags byte) []byte {
+	t.Helper()
+	clientData := a.clientData("webauthn.get", options.Response.Challenge)
+	authData := a.authData(flags)
+
+	hash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), hash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"id":    b64(a.credentialID),
+		"rawId": b64(a.credentialID),
+		"type":  "public-key",
+		"response": map[string]interface{}{
+			"clientDataJSON":    b64(clientData),
+			"authenticatorData": b64(authData),
+			"signature":         b64(signature),
+			"userHandle":        b64(a.userHandle),
+		},
+	})
+	return body
+}
+
+func setup(t *testing.T) (*RelyingParty, *models.User) {
+	t.Helper()
+	if err := database.Initialize(t.TempDir()); err != nil {
+		t.Fatalf("initialize database: %v", err)
+	}
+	t.Cleanup(func() { database.DB.Close() })
+
+	user := &models.User{Name: "Alice", Email: "alice@example.com", Password: "x", UserLevel: models.UserLevelUser, IsActive: true}
+	if err := database.DB.CreateUser(user); err != nil {
+		t.Fatal(err)
+	}
+
+	rp, err := New("WulfVault", testOrigin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rp, user
+}
+
+func register(t *testing.T, rp *RelyingParty, user *models.User, a *softAuthenticator) *database.WebAuthnCredential {
+	t.Helper()
+	options, ceremonyID, err := rp.BeginRegistration(user)
+	if err != nil {
+		t.Fatalf("begin registration: %v", err)
+	}
+	cred, err := rp.FinishRegistration(user, ceremonyID, "Laptop", bytes.NewReader(a.create(t, options)))
+	if err != nil {
+		t.Fatalf("finish registration: %v", err)
+	}
+	return cred
+}
+
+func TestRegistrationAndSecondFactor(t *testing.T) {
+	rp, user := setup(t)
+	a := newSoftAuthenticator(t)
+
+	if _, _, err := rp.BeginLogin(user); !errors.Is(err, ErrNoCredentials) {
+		t.Errorf("begin login without passkeys: got %v, want ErrNoCredentials", err)
+	}
+
+	cred := register(t, rp, user, a)
+	if cred.Name != "Laptop" || !bytes.Equal(cred.CredentialId, a.credentialID) || cred.Transports != "internal" {
+		t.Errorf("unexpected stored credential: %+v", cred)
+	}
+
+	// A second registration must exclude the existing credential
+	options, _, err := rp.BeginRegistration(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(options.Response.CredentialExcludeList) != 1 {
+		t.Errorf("exclude list has %d entries, want 1", len(options.Response.CredentialExcludeList))
+	}
+
+	assertion, ceremonyID, err := rp.BeginLogin(user)
+	if err != nil {
+		t.Fatalf("begin login: %v", err)
+	}
+	response := a.get(t, assertion, flagUserPresent)
+	used, err := rp.FinishLogin(user, ceremonyID, bytes.NewReader(response))
+	if err != nil {
+		t.Fatalf("finish login: %v", err)
+	}
+	if used.SignCount != a.signCount || used.LastUsedAt == 0 {
+		t.Errorf("use not recorded: %+v", used)
+	}
+
+	// Each challenge can only be answered once
+	if _, err := rp.FinishLogin(user, ceremonyID, bytes.NewReader(response)); err == nil {
+		t.Error("replayed assertion accepted")
+	}
+
+	// An assertion for another origin is rejected
+	assertion, ceremonyID, _ = rp.BeginLogin(user)
+	a.origin = "https://evil.example.net"
+	if _, err := rp.FinishLogin(user, ceremonyID, bytes.NewReader(a.get(t, assertion, flagUserPresent))); err == nil {
+		t.Error("assertion from a foreign origin accepted")
+	}
+	a.origin = testOrigin
+
+	// A signature counter that goes backwards indicates a cloned authenticator
+	assertion, ceremonyID, _ = rp.BeginLogin(user)
+	a.signCount = 0
+	if _, err := rp.FinishLogin(user, ceremonyID, bytes.NewReader(a.get(t, assertion, flagUserPresent))); !errors.Is(err, ErrCloneWarning) {
+		t.Errorf("counter regression: got %v, want ErrCloneWarning", err)
+	}
+
+	// A challenge issued to one user cannot be answered for another
+	other := &models.User{Name: "Bob", Email: "bob@example.com", Password: "x", UserLevel: models.UserLevelUser, IsActive: true}
+	database.DB.CreateUser(other)
+	_, ceremonyID, _ = rp.BeginLogin(user)
+	if _, err := rp.FinishLogin(other, ceremonyID, bytes.NewReader(response)); err == nil {
+		t.Error("challenge accepted for a different user")
+	}
+}
+
+func TestDiscoverableLogin(t *testing.T) {
+	rp, user := setup(t)
+	a := newSoftAuthenticator(t)
+	register(t, rp, user, a)
+
+	assertion, ceremonyID, err := rp.BeginDiscoverableLogin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signedIn, _, err := rp.FinishDiscoverableLogin(ceremonyID, bytes.NewReader(a.get(t, assertion, flagUserPresent|flagUserVerified)))
+	if err != nil {
+		t.Fatalf("finish discoverable login: %v", err)
+	}
+	if signedIn.Id != user.Id {
+		t.Errorf("signed in as user %d, want %d", signedIn.Id, user.Id)
+	}
+
+	// Passwordless login requires user verification (PIN or biometrics)
+	assertion, ceremonyID, _ = rp.BeginDiscoverableLogin()
+	if _, _, err := rp.FinishDiscoverableLogin(ceremonyID, bytes.NewReader(a.get(t, assertion, flagUserPresent))); err == nil {
+		t.Error("passwordless login accepted without user verification")
+	}
+
+	// A deleted passkey no longer signs in
+	if err := database.DB.DeleteWebAuthnCredential(1, user.Id); err != nil {
+		t.Fatal(err)
+	}
+	assertion, ceremonyID, _ = rp.BeginDiscoverableLogin()
+	if _, _, err := rp.FinishDiscoverableLogin(ceremonyID, bytes.NewReader(a.get(t, assertion, flagUserPresent|flagUserVerified))); err == nil {
+		t.Error("deleted passkey accepted")
+	}
+}
@@ -0,0 +1,65 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package passkey
+
+import (
+	"github.com/Frimurare/WulfVault/internal/database"
+	"github.com/Frimurare/WulfVault/internal/models"
+)
+
+// Configuration keys for the per-role passkey requirement
+const (
+	ConfigRequiredAdmin = "passkey_required_admin"
+	ConfigRequiredUser  = "passkey_required_user"
+)
+
+// Policy says which roles must sign in with a passkey
+type Policy struct {
+	RequiredAdmin bool // admins and the super admin
+	RequiredUser  bool
+}
+
+// LoadPolicy reads the passkey policy from the Configuration table
+func LoadPolicy() *Policy {
+	get := func(key string) bool {
+		value, err := database.DB.GetConfigValue(key)
+		return err == nil && value == "true"
+	}
+	return &Policy{
+		RequiredAdmin: get(ConfigRequiredAdmin),
+		RequiredUser:  get(ConfigRequiredUser),
+	}
+}
+
+// Save stores the policy
+func (p *Policy) Save() error {
+	value := func(b bool) string {
+		if b {
+			return "true"
+		}
+		return "false"
+	}
+	if err := database.DB.SetConfigValue(ConfigRequiredAdmin, value(p.RequiredAdmin)); err != nil {
+		return err
+	}
+	return database.DB.SetConfigValue(ConfigRequiredUser, value(p.RequiredUser))
+}
+
+// RequiredFor reports whether users of the given role must use a passkey as
+// their second factor. Users who sign in through OIDC are exempt: their
+// identity provider enforces its own second factor.
+func (p *Policy) RequiredFor(user *models.User) bool {
+	required := p.RequiredUser
+	if user.IsAdmin() {
+		required = p.RequiredAdmin
+	}
+	if !required {
+		return false
+	}
+
+	source, _, err := database.DB.GetUserAuthSource(user.Id)
+	return err != nil || source != database.AuthSourceOIDC
+}
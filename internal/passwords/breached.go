@@ -0,0 +1,168 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package passwords
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The breached-password list is a local copy of the Have I Been Pwned SHA-1
+// hashes, in either of the formats produced by the PwnedPasswordsDownloader:
+//
+//   - a directory of range files named after the first 5 hex digits of the
+//     hash (00000, 00000.txt, ...), each holding "SUFFIX:COUNT" lines
+//   - a single file of "HASH:COUNT" lines, sorted by hash
+//
+// Lookups never touch the network.
+
+const (
+	hashPrefixLength = 5
+	sha1HexLength    = 40
+)
+
+// IsBreached reports whether a password appears in the breached-password list at path
+func IsBreached(path, password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+	if info.IsDir() {
+		return searchRangeFile(path, hash)
+	}
+	return searchSortedFile(path, info.Size(), hash)
+}
+
+// BreachListStatus describes the configured list for the admin settings page
+func BreachListStatus(path string) string {
+	if path == "" {
+		return "Disabled"
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "Not found: " + err.Error()
+	}
+	if info.IsDir() {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return "Unreadable: " + err.Error()
+		}
+		return fmt.Sprintf("Range directory with %d files", len(entries))
+	}
+	return fmt.Sprintf("Sorted hash file, %.1f MB", float64(info.Size())/1024/1024)
+}
+
+// searchRangeFile looks up a hash in the range file of its prefix
+func searchRangeFile(dir, hash string) (bool, error) {
+	prefix, suffix := hash[:hashPrefixLength], hash[hashPrefixLength:]
+
+	var f *os.File
+	var err error
+	for _, name := range []string{prefix, prefix + ".txt", strings.ToLower(prefix), strings.ToLower(prefix) + ".txt"} {
+		f, err = os.Open(filepath.Join(dir, name))
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			// No range file means no breached hash with this prefix
+			return false, nil
+		}
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if len(line) >= len(suffix) && strings.EqualFold(line[:len(suffix)], suffix) {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+// searchSortedFile binary searches a file of sorted "HASH:COUNT" lines.
+// Lines have different lengths, so each probe seeks to a byte offset and
+// reads the first complete line starting at or after it.
+func searchSortedFile(path string, size int64, hash string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	// Candidate lines are those starting in [lo, hi)
+	lo, hi := int64(0), size
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		start, line, err := lineAt(f, size, mid)
+		if err != nil {
+			return false, err
+		}
+		if start >= hi {
+			hi = mid
+			continue
+		}
+
+		key := line
+		if i := strings.IndexByte(line, ':'); i >= 0 {
+			key = line[:i]
+		}
+		if len(key) != sha1HexLength {
+			return false, fmt.Errorf("unexpected line in breached-password list at offset %d", start)
+		}
+
+		switch strings.Compare(strings.ToUpper(key), hash) {
+		case 0:
+			return true, nil
+		case -1:
+			lo = start + int64(len(line)) + 1
+		default:
+			hi = mid
+		}
+	}
+	return false, nil
+}
+
+// lineAt returns the first line starting at or after offset, and where it starts.
+// At the end of the file it returns size as the start.
+func lineAt(f *os.File, size, offset int64) (int64, string, error) {
+	start := offset
+	if offset > 0 {
+		// Skip the rest of the line the byte before offset belongs to
+		r := bufio.NewReader(io.NewSectionReader(f, offset-1, size-offset+1))
+		skipped, err := r.ReadString('\n')
+		if err == io.EOF {
+			return size, "", nil
+		}
+		if err != nil {
+			return 0, "", err
+		}
+		start = offset - 1 + int64(len(skipped))
+	}
+	if start >= size {
+		return size, "", nil
+	}
+
+	r := bufio.NewReader(io.NewSectionReader(f, start, size-start))
+	line, err := r.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return 0, "", err
+	}
+	return start, strings.TrimRight(line, "\r\n"), nil
+}
@@ -0,0 +1,181 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package passwords
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/Frimurare/WulfVault/internal/auth"
+	"github.com/Frimurare/WulfVault/internal/database"
+	"github.com/Frimurare/WulfVault/internal/models"
+)
+
+func sha1Hex(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+var breachedPasswords = []string{"password", "123456", "qwerty", "letmein", "Summer2024!"}
+
+// writeSortedList writes a sorted "HASH:COUNT" file with some filler hashes
+func writeSortedList(t *testing.T, lineEnd string) string {
+	t.Helper()
+	var lines []string
+	for _, p := range breachedPasswords {
+		lines = append(lines, sha1Hex(p)+":42")
+	}
+	for i := 0; i < 500; i++ {
+		lines = append(lines, fmt.Sprintf("%s:%d", sha1Hex(fmt.Sprintf("filler-%d", i)), i))
+	}
+	sort.Strings(lines)
+
+	path := filepath.Join(t.TempDir(), "pwned-passwords-sha1-ordered-by-hash.txt")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, lineEnd)+lineEnd), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// writeRangeDir writes one range file per prefix
+func writeRangeDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	files := map[string][]string{}
+	for _, p := range breachedPasswords {
+		h := sha1Hex(p)
+		files[h[:5]] = append(files[h[:5]], h[5:]+":42")
+	}
+	for prefix, lines := range files {
+		if err := os.WriteFile(filepath.Join(dir, prefix+".txt"), []byte(strings.Join(lines, "\r\n")), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestIsBreached(t *testing.T) {
+	lists := map[string]string{
+		"sorted LF":   writeSortedList(t, "\n"),
+		"sorted CRLF": writeSortedList(t, "\r\n"),
+		"range dir":   writeRangeDir(t),
+	}
+
+	for name, path := range lists {
+		for _, p := range breachedPasswords {
+			breached, err := IsBreached(path, p)
+			if err != nil || !breached {
+				t.Errorf("%s: %q: got %v, %v, want breached", name, p, breached, err)
+			}
+		}
+		for _, p := range []string{"correct horse battery staple", "Tr0ub4dor&3", ""} {
+			breached, err := IsBreached(path, p)
+			if err != nil || breached {
+				t.Errorf("%s: %q: got %v, %v, want not breached", name, p, breached, err)
+			}
+		}
+	}
+
+	if _, err := IsBreached(filepath.Join(t.TempDir(), "missing"), "password"); err == nil {
+		t.Error("missing list did not return an error")
+	}
+}
+
+func TestCheck(t *testing.T) {
+	p := &Policy{MinLength: 10, RequireUpper: true, RequireDigit: true, RequireSymbol: true}
+
+	tests := []struct {
+		password string
+		problems int
+	}{
+		{"Sh0rt!", 1},
+		{"alllowercaseletters", 3},
+		{"Long-enough-but-no-digit", 1},
+		{"Valid-passw0rd", 0},
+		{strings.Repeat("Aa1!", 19), 1}, // longer than bcrypt accepts
+	}
+	for _, tt := range tests {
+		err := p.Check(tt.password, nil)
+		var pe *PolicyError
+		switch {
+		case tt.problems == 0 && err != nil:
+			t.Errorf("%q: unexpected error %v", tt.password, err)
+		case tt.problems > 0 && (!errors.As(err, &pe) || len(pe.Problems) != tt.problems):
+			t.Errorf("%q: got %v, want %d problems", tt.password, err, tt.problems)
+		}
+	}
+
+	if err := p.Check("Alice@Example.c0m", &Account{Email: "alice@example.c0m"}); err == nil {
+		t.Error("email address accepted as password")
+	}
+
+	p.BreachList = writeSortedList(t, "\n")
+	if err := p.Check("Summer2024!", nil); err == nil {
+		t.Error("breached password accepted")
+	}
+	if err := p.Check("Valid-passw0rd", nil); err != nil {
+		t.Errorf("password not in the breach list rejected: %v", err)
+	}
+}
+
+func TestHistoryAndExpiry(t *testing.T) {
+	if err := database.Initialize(t.TempDir()); err != nil {
+		t.Fatalf("initialize database: %v", err)
+	}
+	t.Cleanup(func() { database.DB.Close() })
+
+	user := &models.User{Name: "Alice", Email: "alice@example.com", Password: "x", UserLevel: models.UserLevelUser, IsActive: true}
+	if err := database.DB.CreateUser(user); err != nil {
+		t.Fatal(err)
+	}
+
+	p := &Policy{MinLength: 8, HistoryCount: 2, MaxAgeDays: 90}
+	var current string
+	for _, pw := range []string{"first-password", "second-password", "third-password"} {
+		hash, err := auth.HashPassword(pw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		Record(database.AccountTypeUser, user.Id, hash)
+		current = hash
+	}
+	account := &Account{Type: database.AccountTypeUser, Id: user.Id, CurrentHash: current}
+
+	if err := p.Check("third-password", account); err == nil {
+		t.Error("current password accepted")
+	}
+	if err := p.Check("second-password", account); err == nil {
+		t.Error("previous password accepted")
+	}
+	if err := p.Check("first-password", account); err != nil {
+		t.Errorf("password outside the history rejected: %v", err)
+	}
+
+	if p.Expired(database.AccountTypeUser, user.Id) {
+		t.Error("password expired right after it was set")
+	}
+	old := int64(1000)
+	database.DB.SetPasswordChangedAt(database.AccountTypeUser, user.Id, old)
+	if !p.Expired(database.AccountTypeUser, user.Id) {
+		t.Error("old password not expired")
+	}
+
+	// Unknown age starts the clock instead of expiring immediately
+	database.DB.SetPasswordChangedAt(database.AccountTypeUser, user.Id, 0)
+	if p.Expired(database.AccountTypeUser, user.Id) {
+		t.Error("password of unknown age expired")
+	}
+	if changedAt, _ := database.DB.GetPasswordChangedAt(database.AccountTypeUser, user.Id); changedAt == 0 {
+		t.Error("password age not initialised")
+	}
+}
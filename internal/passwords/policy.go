@@ -0,0 +1,289 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+// Package passwords implements the password policy for users and download
+// accounts: length, character classes, reuse history, maximum age and the
+// offline breached-password list.
+package passwords
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/Frimurare/WulfVault/internal/auth"
+	"github.com/Frimurare/WulfVault/internal/database"
+)
+
+// Configuration keys for the password policy
+const (
+	ConfigMinLength     = "password_min_length"
+	ConfigRequireUpper  = "password_require_upper"
+	ConfigRequireLower  = "password_require_lower"
+	ConfigRequireDigit  = "password_require_digit"
+	ConfigRequireSymbol = "password_require_symbol"
+	ConfigHistoryCount  = "password_history_count"
+	ConfigMaxAgeDays    = "password_max_age_days"
+	ConfigBreachList    = "password_breach_list"
+)
+
+// Limits for the password length. bcrypt only uses the first 72 bytes.
+const (
+	MinLengthFloor = 6
+	MaxLength      = 72
+)
+
+// Policy is the password policy. It applies to users and download accounts alike.
+type Policy struct {
+	MinLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	HistoryCount  int    // previous passwords that cannot be reused, 0 disables the check
+	MaxAgeDays    int    // days after which a password must be changed, 0 disables expiry
+	BreachList    string // path of the breached-password list, "" disables the check
+}
+
+// DefaultPolicy is used for values that are not configured
+func DefaultPolicy() *Policy {
+	return &Policy{MinLength: 8}
+}
+
+// LoadPolicy reads the password policy from the Configuration table
+func LoadPolicy() *Policy {
+	p := DefaultPolicy()
+	get := func(key string) string {
+		value, err := database.DB.GetConfigValue(key)
+		if err != nil {
+			return ""
+		}
+		return value
+	}
+	getInt := func(key string, def int) int {
+		n, err := strconv.Atoi(get(key))
+		if err != nil {
+			return def
+		}
+		return n
+	}
+
+	p.MinLength = getInt(ConfigMinLength, p.MinLength)
+	p.RequireUpper = get(ConfigRequireUpper) == "true"
+	p.RequireLower = get(ConfigRequireLower) == "true"
+	p.RequireDigit = get(ConfigRequireDigit) == "true"
+	p.RequireSymbol = get(ConfigRequireSymbol) == "true"
+	p.HistoryCount = getInt(ConfigHistoryCount, 0)
+	p.MaxAgeDays = getInt(ConfigMaxAgeDays, 0)
+	p.BreachList = get(ConfigBreachList)
+	p.normalize()
+	return p
+}
+
+// normalize clamps the values to their allowed ranges
+func (p *Policy) normalize() {
+	if p.MinLength < MinLengthFloor {
+		p.MinLength = MinLengthFloor
+	}
+	if p.MinLength > MaxLength {
+		p.MinLength = MaxLength
+	}
+	if p.HistoryCount < 0 {
+		p.HistoryCount = 0
+	}
+	if p.HistoryCount > database.MaxPasswordHistory {
+		p.HistoryCount = database.MaxPasswordHistory
+	}
+	if p.MaxAgeDays < 0 {
+		p.MaxAgeDays = 0
+	}
+	p.BreachList = strings.TrimSpace(p.BreachList)
+}
+
+// Save stores the policy
+func (p *Policy) Save() error {
+	p.normalize()
+	value := func(b bool) string {
+		if b {
+			return "true"
+		}
+		return "false"
+	}
+	values := map[string]string{
+		ConfigMinLength:     strconv.Itoa(p.MinLength),
+		ConfigRequireUpper:  value(p.RequireUpper),
+		ConfigRequireLower:  value(p.RequireLower),
+		ConfigRequireDigit:  value(p.RequireDigit),
+		ConfigRequireSymbol: value(p.RequireSymbol),
+		ConfigHistoryCount:  strconv.Itoa(p.HistoryCount),
+		ConfigMaxAgeDays:    strconv.Itoa(p.MaxAgeDays),
+		ConfigBreachList:    p.BreachList,
+	}
+	for key, v := range values {
+		if err := database.DB.SetConfigValue(key, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Requirements describes the policy for the people choosing a password
+func (p *Policy) Requirements() string {
+	parts := []string{fmt.Sprintf("at least %d characters", p.MinLength)}
+	if p.RequireUpper {
+		parts = append(parts, "an uppercase letter")
+	}
+	if p.RequireLower {
+		parts = append(parts, "a lowercase letter")
+	}
+	if p.RequireDigit {
+		parts = append(parts, "a digit")
+	}
+	if p.RequireSymbol {
+		parts = append(parts, "a symbol")
+	}
+	text := "Use " + strings.Join(parts, ", ")
+	if p.HistoryCount > 0 {
+		text += fmt.Sprintf(". Your last %d passwords cannot be reused", p.HistoryCount)
+	}
+	if p.BreachList != "" {
+		text += ". Passwords known from data breaches are rejected"
+	}
+	return text + "."
+}
+
+// Account identifies whose password is being set
+type Account struct {
+	Type        string // database.AccountTypeUser or database.AccountTypeDownloadAccount
+	Id          int    // 0 for an account that is being created
+	Email       string
+	CurrentHash string // hash of the password being replaced, if any
+}
+
+// PolicyError lists why a password was rejected
+type PolicyError struct {
+	Problems []string
+}
+
+func (e *PolicyError) Error() string {
+	return "Password " + strings.Join(e.Problems, "; ")
+}
+
+// Check validates a new password against the policy
+func (p *Policy) Check(password string, account *Account) error {
+	var problems []string
+
+	length := len([]rune(password))
+	if length < p.MinLength {
+		problems = append(problems, fmt.Sprintf("must be at least %d characters", p.MinLength))
+	}
+	if len(password) > MaxLength {
+		problems = append(problems, fmt.Sprintf("must be at most %d bytes", MaxLength))
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, c := range password {
+		switch {
+		case unicode.IsUpper(c):
+			upper = true
+		case unicode.IsLower(c):
+			lower = true
+		case unicode.IsDigit(c):
+			digit = true
+		case !unicode.IsSpace(c):
+			symbol = true
+		}
+	}
+	if p.RequireUpper && !upper {
+		problems = append(problems, "must contain an uppercase letter")
+	}
+	if p.RequireLower && !lower {
+		problems = append(problems, "must contain a lowercase letter")
+	}
+	if p.RequireDigit && !digit {
+		problems = append(problems, "must contain a digit")
+	}
+	if p.RequireSymbol && !symbol {
+		problems = append(problems, "must contain a symbol")
+	}
+
+	if account != nil && account.Email != "" && strings.EqualFold(password, account.Email) {
+		problems = append(problems, "must not be your email address")
+	}
+
+	if len(problems) == 0 && p.BreachList != "" {
+		breached, err := IsBreached(p.BreachList, password)
+		if err != nil {
+			// A missing or unreadable list must not lock everybody out
+			log.Printf("Warning: breached-password check skipped: %v", err)
+		} else if breached {
+			problems = append(problems, "has appeared in a data breach and cannot be used")
+		}
+	}
+
+	if len(problems) == 0 && p.HistoryCount > 0 && account != nil && p.reused(password, account) {
+		problems = append(problems, fmt.Sprintf("must not be one of your last %d passwords", p.HistoryCount))
+	}
+
+	if len(problems) > 0 {
+		return &PolicyError{Problems: problems}
+	}
+	return nil
+}
+
+// reused reports whether the password matches the current or a recent password of the account
+func (p *Policy) reused(password string, account *Account) bool {
+	if account.CurrentHash != "" && auth.CheckPasswordHash(password, account.CurrentHash) {
+		return true
+	}
+	if account.Id == 0 {
+		return false
+	}
+
+	hashes, err := database.DB.GetPasswordHistory(account.Type, account.Id, p.HistoryCount)
+	if err != nil {
+		log.Printf("Warning: failed to read password history of %s %d: %v", account.Type, account.Id, err)
+		return false
+	}
+	for _, hash := range hashes {
+		if auth.CheckPasswordHash(password, hash) {
+			return true
+		}
+	}
+	return false
+}
+
+// Record remembers a newly set password hash for the reuse check and restarts
+// the password age. Call it after the password was stored.
+func Record(accountType string, accountId int, passwordHash string) {
+	if err := database.DB.AddPasswordHistory(accountType, accountId, passwordHash); err != nil {
+		log.Printf("Warning: failed to record password history of %s %d: %v", accountType, accountId, err)
+	}
+	if err := database.DB.SetPasswordChangedAt(accountType, accountId, time.Now().Unix()); err != nil {
+		log.Printf("Warning: failed to record password change of %s %d: %v", accountType, accountId, err)
+	}
+}
+
+// Expired reports whether the password of an account is older than the maximum
+// age. Accounts whose password age is unknown (set before the policy existed)
+// start their clock now.
+func (p *Policy) Expired(accountType string, accountId int) bool {
+	if p.MaxAgeDays <= 0 {
+		return false
+	}
+
+	changedAt, err := database.DB.GetPasswordChangedAt(accountType, accountId)
+	if err != nil {
+		return false
+	}
+	if changedAt == 0 {
+		database.DB.SetPasswordChangedAt(accountType, accountId, time.Now().Unix())
+		return false
+	}
+	return time.Since(time.Unix(changedAt, 0)) > time.Duration(p.MaxAgeDays)*24*time.Hour
+}
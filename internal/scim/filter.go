@@ -0,0 +1,384 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Filter is a parsed SCIM filter expression (RFC 7644 section 3.4.2.2), e.g.
+// `userName eq "anna@example.com"` or `members[value eq "12"]`
+type Filter struct {
+	Op          string  // "and", "or", "not", "pr" or a comparison operator
+	Left, Right *Filter // Operands of and/or; Left is the operand of not
+	Attr        string  // Lowercased attribute path of comparisons and value filters
+	Value       interface{}
+	Sub         *Filter // Filter on the elements of a multi-valued attribute: attr[sub]
+}
+
+var comparisonOps = map[string]bool{
+	"eq": true, "ne": true, "co": true, "sw": true, "ew": true,
+	"gt": true, "ge": true, "lt": true, "le": true,
+}
+
+// ParseFilter parses a filter expression
+func ParseFilter(expr string) (*Filter, error) {
+	tokens, err := tokenize(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &filterParser{tokens: tokens}
+	f, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q in filter", p.tokens[p.pos].text)
+	}
+	return f, nil
+}
+
+type token struct {
+	text   string
+	quoted bool // A string literal; text is unquoted
+}
+
+func tokenize(expr string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(' || c == ')' || c == '[' || c == ']':
+			tokens = append(tokens, token{text: string(c)})
+			i++
+		case c == '"':
+			end := i + 1
+			for end < len(expr) && expr[end] != '"' {
+				if expr[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(expr) {
+				return nil, fmt.Errorf("unterminated string in filter")
+			}
+			var s string
+			if err := json.Unmarshal([]byte(expr[i:end+1]), &s); err != nil {
+				return nil, fmt.Errorf("invalid string in filter: %v", err)
+			}
+			tokens = append(tokens, token{text: s, quoted: true})
+			i = end + 1
+		default:
+			end := i
+			for end < len(expr) && !strings.ContainsRune(" \t\n\r()[]\"", rune(expr[end])) {
+				end++
+			}
+			tokens = append(tokens, token{text: expr[i:end]})
+			i = end
+		}
+	}
+	return tokens, nil
+}
+
+type filterParser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *filterParser) peek() (token, bool) {
+	if p.pos >= len(p.tokens) {
+		return token{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+// keyword reports whether the next token is the given unquoted keyword, and consumes it
+func (p *filterParser) keyword(word string) bool {
+	t, ok := p.peek()
+	if ok && !t.quoted && strings.EqualFold(t.text, word) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) expect(text string) error {
+	if !p.keyword(text) {
+		return fmt.Errorf("expected %q in filter", text)
+	}
+	return nil
+}
+
+func (p *filterParser) parseOr() (*Filter, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &Filter{Op: "or", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (*Filter, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("and") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &Filter{Op: "and", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseUnary() (*Filter, error) {
+	if p.keyword("not") {
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return &Filter{Op: "not", Left: inner}, nil
+	}
+	if p.keyword("(") {
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return inner, nil
+	}
+	return p.parseAttr()
+}
+
+func (p *filterParser) parseAttr() (*Filter, error) {
+	t, ok := p.peek()
+	if !ok || t.quoted || t.text == ")" || t.text == "]" {
+		return nil, fmt.Errorf("expected an attribute in filter")
+	}
+	p.pos++
+	attr := normalizePath(t.text)
+
+	if p.keyword("[") {
+		sub, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("]"); err != nil {
+			return nil, err
+		}
+		return &Filter{Op: "[]", Attr: attr, Sub: sub}, nil
+	}
+
+	if p.keyword("pr") {
+		return &Filter{Op: "pr", Attr: attr}, nil
+	}
+
+	opToken, ok := p.peek()
+	if !ok || opToken.quoted || !comparisonOps[strings.ToLower(opToken.text)] {
+		return nil, fmt.Errorf("expected an operator after %q in filter", t.text)
+	}
+	p.pos++
+
+	valueToken, ok := p.peek()
+	if !ok {
+		return nil, fmt.Errorf("expected a value after %q in filter", opToken.text)
+	}
+	p.pos++
+
+	var value interface{}
+	switch {
+	case valueToken.quoted:
+		value = valueToken.text
+	case strings.EqualFold(valueToken.text, "true"):
+		value = true
+	case strings.EqualFold(valueToken.text, "false"):
+		value = false
+	case strings.EqualFold(valueToken.text, "null"):
+		value = nil
+	default:
+		n, err := strconv.ParseFloat(valueToken.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %q in filter", valueToken.text)
+		}
+		value = n
+	}
+
+	return &Filter{Op: strings.ToLower(opToken.text), Attr: attr, Value: value}, nil
+}
+
+// normalizePath lowercases an attribute path and strips a schema URN prefix
+// such as "urn:ietf:params:scim:schemas:core:2.0:User:"
+func normalizePath(path string) string {
+	path = strings.ToLower(path)
+	if strings.HasPrefix(path, "urn:") {
+		if i := strings.LastIndex(path, ":"); i >= 0 {
+			path = path[i+1:]
+		}
+	}
+	return path
+}
+
+// Matches reports whether a resource matches the filter. The resource is its JSON
+// form with lowercased keys, as returned by toMap.
+func (f *Filter) Matches(resource map[string]interface{}) bool {
+	switch f.Op {
+	case "and":
+		return f.Left.Matches(resource) && f.Right.Matches(resource)
+	case "or":
+		return f.Left.Matches(resource) || f.Right.Matches(resource)
+	case "not":
+		return !f.Left.Matches(resource)
+	case "[]":
+		for _, element := range elements(resource[f.Attr]) {
+			if m, ok := element.(map[string]interface{}); ok && f.Sub.Matches(m) {
+				return true
+			}
+		}
+		return false
+	}
+
+	values := resolve(resource, f.Attr)
+	if f.Op == "pr" {
+		for _, v := range values {
+			if v != nil && v != "" {
+				return true
+			}
+		}
+		return false
+	}
+	if f.Op == "ne" {
+		for _, v := range values {
+			if compare("eq", v, f.Value) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, v := range values {
+		if compare(f.Op, v, f.Value) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolve returns the values of an attribute path like "userName", "name.givenName"
+// or "emails.value". Multi-valued attributes yield one value per element; a complex
+// multi-valued attribute without a sub-attribute yields the elements' "value".
+func resolve(resource map[string]interface{}, path string) []interface{} {
+	parts := strings.SplitN(path, ".", 2)
+	v, ok := resource[parts[0]]
+	if !ok {
+		return nil
+	}
+
+	var values []interface{}
+	for _, element := range elements(v) {
+		m, isMap := element.(map[string]interface{})
+		switch {
+		case len(parts) == 2 && isMap:
+			values = append(values, resolve(m, parts[1])...)
+		case len(parts) == 2:
+			// A sub-attribute of a simple value does not exist
+		case isMap:
+			if value, ok := m["value"]; ok {
+				values = append(values, value)
+			}
+		default:
+			values = append(values, element)
+		}
+	}
+	return values
+}
+
+// elements returns the elements of a multi-valued attribute, or the value itself
+func elements(v interface{}) []interface{} {
+	if list, ok := v.([]interface{}); ok {
+		return list
+	}
+	if v == nil {
+		return nil
+	}
+	return []interface{}{v}
+}
+
+// compare applies a comparison operator. Strings compare case-insensitively, as
+// all attributes this server exposes are caseExact false.
+func compare(op string, actual, expected interface{}) bool {
+	if expected == nil {
+		return op == "eq" && (actual == nil || actual == "")
+	}
+
+	switch e := expected.(type) {
+	case bool:
+		a, ok := actual.(bool)
+		return ok && op == "eq" && a == e
+	case float64:
+		a, ok := actual.(float64)
+		if !ok {
+			return false
+		}
+		switch op {
+		case "eq":
+			return a == e
+		case "gt":
+			return a > e
+		case "ge":
+			return a >= e
+		case "lt":
+			return a < e
+		case "le":
+			return a <= e
+		}
+		return false
+	}
+
+	a, ok := actual.(string)
+	if !ok {
+		return false
+	}
+	a, e := strings.ToLower(a), strings.ToLower(expected.(string))
+	switch op {
+	case "eq":
+		return a == e
+	case "co":
+		return strings.Contains(a, e)
+	case "sw":
+		return strings.HasPrefix(a, e)
+	case "ew":
+		return strings.HasSuffix(a, e)
+	case "gt":
+		return a > e
+	case "ge":
+		return a >= e
+	case "lt":
+		return a < e
+	case "le":
+		return a <= e
+	}
+	return false
+}
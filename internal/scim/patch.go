@@ -0,0 +1,351 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// PatchRequest is the body of a PATCH request (RFC 7644 section 3.5.2)
+type PatchRequest struct {
+	Schemas    []string         `json:"schemas"`
+	Operations []PatchOperation `json:"Operations"`
+}
+
+// PatchOperation is a single add, replace or remove
+type PatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// patchUser returns the user resource with the operations applied
+func patchUser(user *User, operations []PatchOperation) (*User, *Error) {
+	patched := &User{}
+	if err := patchResource(user, operations, patched); err != nil {
+		return nil, err
+	}
+	return patched, nil
+}
+
+// patchGroup returns the group resource with the operations applied
+func patchGroup(group *Group, operations []PatchOperation) (*Group, *Error) {
+	patched := &Group{}
+	if err := patchResource(group, operations, patched); err != nil {
+		return nil, err
+	}
+	return patched, nil
+}
+
+// patchResource applies the operations to the JSON document of a resource and
+// decodes the result into patched
+func patchResource(resource interface{}, operations []PatchOperation, patched interface{}) *Error {
+	data, err := json.Marshal(resource)
+	if err != nil {
+		return errorf(http.StatusInternalServerError, "", "%v", err)
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return errorf(http.StatusInternalServerError, "", "%v", err)
+	}
+
+	for _, operation := range operations {
+		var value interface{}
+		if len(operation.Value) > 0 {
+			if err := json.Unmarshal(operation.Value, &value); err != nil {
+				return invalidValue("invalid value: %v", err)
+			}
+		}
+		if err := applyOperation(doc, strings.ToLower(operation.Op), operation.Path, value); err != nil {
+			return err
+		}
+	}
+
+	// Azure AD sends "active" as the string "True" or "False"
+	if key := findKey(doc, "active"); key != "" {
+		if s, ok := doc[key].(string); ok {
+			doc[key] = strings.EqualFold(s, "true")
+		}
+	}
+
+	data, err = json.Marshal(doc)
+	if err != nil {
+		return errorf(http.StatusInternalServerError, "", "%v", err)
+	}
+	if err := json.Unmarshal(data, patched); err != nil {
+		return invalidValue("patched resource is invalid: %v", err)
+	}
+	return nil
+}
+
+// applyOperation applies one operation to a resource document
+func applyOperation(doc map[string]interface{}, op, path string, value interface{}) *Error {
+	if op != "add" && op != "replace" && op != "remove" {
+		return errorf(http.StatusBadRequest, "invalidSyntax", "unknown operation %q", op)
+	}
+
+	if path != "" {
+		return applyPath(doc, op, path, value)
+	}
+
+	// Without a path the value holds the attributes to add or replace
+	if op == "remove" {
+		return errorf(http.StatusBadRequest, "noTarget", "remove requires a path")
+	}
+	attributes, ok := value.(map[string]interface{})
+	if !ok {
+		return invalidValue("an operation without a path needs an object value")
+	}
+	for key, v := range attributes {
+		// Attributes of a schema may be nested under its URN
+		if nested, ok := v.(map[string]interface{}); ok && strings.HasPrefix(strings.ToLower(key), "urn:") {
+			if err := applyOperation(doc, op, "", nested); err != nil {
+				return err
+			}
+			continue
+		}
+		// Keys may be paths themselves, e.g. "name.givenName"
+		if err := applyPath(doc, op, key, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// attrPath is a parsed PATCH path: attr, attr.sub, attr[filter] or attr[filter].sub
+type attrPath struct {
+	attr   string
+	filter *Filter
+	sub    string
+}
+
+func parsePath(path string) (*attrPath, *Error) {
+	path = strings.TrimSpace(path)
+
+	// Strip a schema URN prefix, without looking into a value filter
+	head := path
+	if i := strings.Index(path, "["); i >= 0 {
+		head = path[:i]
+	}
+	if strings.HasPrefix(strings.ToLower(head), "urn:") {
+		i := strings.LastIndex(head, ":")
+		path = path[i+1:]
+	}
+
+	p := &attrPath{}
+	if open := strings.Index(path, "["); open >= 0 {
+		end := strings.LastIndex(path, "]")
+		if end < open {
+			return nil, errorf(http.StatusBadRequest, "invalidPath", "invalid path %q", path)
+		}
+		filter, err := ParseFilter(path[open+1 : end])
+		if err != nil {
+			return nil, errorf(http.StatusBadRequest, "invalidPath", "invalid path %q: %v", path, err)
+		}
+		p.attr, p.filter = path[:open], filter
+		rest := path[end+1:]
+		if rest != "" {
+			if !strings.HasPrefix(rest, ".") || len(rest) == 1 {
+				return nil, errorf(http.StatusBadRequest, "invalidPath", "invalid path %q", path)
+			}
+			p.sub = rest[1:]
+		}
+	} else if dot := strings.Index(path, "."); dot >= 0 {
+		p.attr, p.sub = path[:dot], path[dot+1:]
+	} else {
+		p.attr = path
+	}
+
+	if p.attr == "" {
+		return nil, errorf(http.StatusBadRequest, "invalidPath", "invalid path %q", path)
+	}
+	return p, nil
+}
+
+// applyPath applies an operation to the attribute a path points at
+func applyPath(doc map[string]interface{}, op, path string, value interface{}) *Error {
+	p, err := parsePath(path)
+	if err != nil {
+		return err
+	}
+
+	key := findKey(doc, p.attr)
+	if key == "" {
+		key = p.attr
+	}
+
+	if p.filter != nil {
+		return applyFiltered(doc, key, p, op, value)
+	}
+
+	if p.sub != "" {
+		switch current := doc[key].(type) {
+		case []interface{}:
+			for _, element := range current {
+				if m, ok := element.(map[string]interface{}); ok {
+					setAttribute(m, op, p.sub, value)
+				}
+			}
+		case map[string]interface{}:
+			setAttribute(current, op, p.sub, value)
+		default:
+			if op != "remove" {
+				doc[key] = map[string]interface{}{p.sub: value}
+			}
+		}
+		return nil
+	}
+
+	current, exists := doc[key]
+	switch op {
+	case "remove":
+		// Azure AD removes members by listing them in the value
+		if list, ok := current.([]interface{}); ok && value != nil {
+			doc[key] = without(list, elements(value))
+		} else {
+			delete(doc, key)
+		}
+	case "add":
+		if list, ok := current.([]interface{}); ok && exists {
+			for _, element := range elements(value) {
+				if !containsValue(list, element) {
+					list = append(list, element)
+				}
+			}
+			doc[key] = list
+			return nil
+		}
+		fallthrough
+	case "replace":
+		currentMap, isMap := current.(map[string]interface{})
+		valueMap, valueIsMap := value.(map[string]interface{})
+		if isMap && valueIsMap {
+			for k, v := range valueMap {
+				setAttribute(currentMap, "replace", k, v)
+			}
+		} else {
+			doc[key] = value
+		}
+	}
+	return nil
+}
+
+// applyFiltered applies an operation to the elements of a multi-valued attribute
+// that match the path's value filter
+func applyFiltered(doc map[string]interface{}, key string, p *attrPath, op string, value interface{}) *Error {
+	list, _ := doc[key].([]interface{})
+
+	var kept []interface{}
+	matched := false
+	for _, element := range list {
+		m, ok := element.(map[string]interface{})
+		if !ok || !p.filter.Matches(lowerKeys(m).(map[string]interface{})) {
+			kept = append(kept, element)
+			continue
+		}
+		matched = true
+
+		switch {
+		case op == "remove" && p.sub == "":
+			continue
+		case p.sub != "":
+			setAttribute(m, op, p.sub, value)
+		default:
+			if valueMap, ok := value.(map[string]interface{}); ok {
+				for k, v := range valueMap {
+					setAttribute(m, "replace", k, v)
+				}
+			}
+		}
+		kept = append(kept, m)
+	}
+
+	// Adding to an element that does not exist yet, such as emails[type eq "work"].value,
+	// creates it when the filter says what it looks like
+	if !matched && op != "remove" {
+		if p.filter.Op != "eq" || strings.Contains(p.filter.Attr, ".") {
+			return errorf(http.StatusBadRequest, "noTarget", "no value matches the filter of %s", key)
+		}
+		element := map[string]interface{}{p.filter.Attr: p.filter.Value}
+		if p.sub != "" {
+			element[p.sub] = value
+		} else if valueMap, ok := value.(map[string]interface{}); ok {
+			for k, v := range valueMap {
+				element[k] = v
+			}
+		}
+		kept = append(kept, element)
+	}
+
+	if kept == nil {
+		delete(doc, key)
+	} else {
+		doc[key] = kept
+	}
+	return nil
+}
+
+// setAttribute sets or removes a sub-attribute, matching its name case-insensitively
+func setAttribute(m map[string]interface{}, op, name string, value interface{}) {
+	key := findKey(m, name)
+	if op == "remove" {
+		if key != "" {
+			delete(m, key)
+		}
+		return
+	}
+	if key == "" {
+		key = name
+	}
+	m[key] = value
+}
+
+// findKey returns the key of m that equals name case-insensitively, or ""
+func findKey(m map[string]interface{}, name string) string {
+	if _, ok := m[name]; ok {
+		return name
+	}
+	for key := range m {
+		if strings.EqualFold(key, name) {
+			return key
+		}
+	}
+	return ""
+}
+
+// valueOf returns what identifies an element of a multi-valued attribute: its
+// "value" sub-attribute, or the element itself
+func valueOf(element interface{}) string {
+	if m, ok := element.(map[string]interface{}); ok {
+		if key := findKey(m, "value"); key != "" {
+			return fmt.Sprint(m[key])
+		}
+	}
+	return fmt.Sprint(element)
+}
+
+func containsValue(list []interface{}, element interface{}) bool {
+	for _, existing := range list {
+		if strings.EqualFold(valueOf(existing), valueOf(element)) {
+			return true
+		}
+	}
+	return false
+}
+
+// without returns the elements of list that are not in remove
+func without(list, remove []interface{}) []interface{} {
+	var kept []interface{}
+	for _, element := range list {
+		if !containsValue(remove, element) {
+			kept = append(kept, element)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,582 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package scim
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Frimurare/WulfVault/internal/auth"
+	"github.com/Frimurare/WulfVault/internal/database"
+	"github.com/Frimurare/WulfVault/internal/models"
+)
+
+// defaultTeamQuotaMB is the storage quota of teams created over SCIM, as for teams
+// created in the admin UI
+const defaultTeamQuotaMB = 10240
+
+// Service maps SCIM resources onto users and teams. Users are regular accounts
+// without a usable password; they sign in through SSO, which links them by email.
+// The super admin can be read but never changed.
+type Service struct {
+	Settings       *Settings
+	BaseURL        string // Absolute URL of the SCIM root, e.g. https://host/scim/v2
+	DefaultQuotaMB int64
+}
+
+// ListUsers answers GET /Users
+func (s *Service) ListUsers(filter string, startIndex, count int) (*ListResponse, *Error) {
+	f, serr := parseListFilter(filter)
+	if serr != nil {
+		return nil, serr
+	}
+	users, err := database.DB.GetScimUsers()
+	if err != nil {
+		return nil, internalError(err)
+	}
+
+	resources := make([]interface{}, 0, len(users))
+	for _, user := range users {
+		resources = append(resources, userResource(user, s.BaseURL))
+	}
+	return page(resources, f, startIndex, count), nil
+}
+
+// GetUser answers GET /Users/{id}
+func (s *Service) GetUser(id string) (*User, *Error) {
+	user, serr := s.loadUser(id)
+	if serr != nil {
+		return nil, serr
+	}
+	return userResource(user, s.BaseURL), nil
+}
+
+// CreateUser answers POST /Users
+func (s *Service) CreateUser(body []byte) (*User, *Error) {
+	var request User
+	if err := json.Unmarshal(body, &request); err != nil {
+		return nil, errorf(http.StatusBadRequest, "invalidSyntax", "invalid user: %v", err)
+	}
+
+	email := request.email()
+	if !strings.Contains(email, "@") {
+		return nil, invalidValue("userName or emails must hold an email address")
+	}
+	if _, err := database.DB.GetUserByEmail(email); err == nil {
+		return nil, errorf(http.StatusConflict, "uniqueness", "a user with email %s already exists", email)
+	}
+
+	user, err := auth.NewProvisionedUser(request.displayName(), email, s.DefaultQuotaMB)
+	if err != nil {
+		return nil, internalError(err)
+	}
+	user.IsActive = request.active()
+	if err := database.DB.CreateUser(user); err != nil {
+		return nil, internalError(err)
+	}
+	if request.ExternalId != "" {
+		if err := database.DB.SetUserScimExternalId(user.Id, request.ExternalId); err != nil {
+			return nil, internalError(err)
+		}
+	}
+
+	logAction(database.ActionUserCreated, database.EntityUser, user.Id, map[string]interface{}{
+		"email":       user.Email,
+		"name":        user.Name,
+		"user_level":  int(user.UserLevel),
+		"quota_mb":    user.StorageQuotaMB,
+		"active":      user.IsActive,
+		"provisioned": "scim",
+	})
+	return s.GetUser(strconv.Itoa(user.Id))
+}
+
+// ReplaceUser answers PUT /Users/{id}
+func (s *Service) ReplaceUser(id string, body []byte) (*User, *Error) {
+	user, serr := s.loadWritableUser(id)
+	if serr != nil {
+		return nil, serr
+	}
+	var request User
+	if err := json.Unmarshal(body, &request); err != nil {
+		return nil, errorf(http.StatusBadRequest, "invalidSyntax", "invalid user: %v", err)
+	}
+	if serr := s.updateUser(user, userResource(user, s.BaseURL), &request); serr != nil {
+		return nil, serr
+	}
+	return s.GetUser(id)
+}
+
+// PatchUser answers PATCH /Users/{id}
+func (s *Service) PatchUser(id string, body []byte) (*User, *Error) {
+	user, serr := s.loadWritableUser(id)
+	if serr != nil {
+		return nil, serr
+	}
+	var request PatchRequest
+	if err := json.Unmarshal(body, &request); err != nil {
+		return nil, errorf(http.StatusBadRequest, "invalidSyntax", "invalid patch: %v", err)
+	}
+
+	current := userResource(user, s.BaseURL)
+	patched, serr := patchUser(current, request.Operations)
+	if serr != nil {
+		return nil, serr
+	}
+	if serr := s.updateUser(user, current, patched); serr != nil {
+		return nil, serr
+	}
+	return s.GetUser(id)
+}
+
+// updateUser applies the differences between the current and the requested
+// representation of a user
+func (s *Service) updateUser(user *database.ScimUser, current, requested *User) *Error {
+	changes := map[string]interface{}{}
+
+	email := ""
+	if !strings.EqualFold(requested.UserName, current.UserName) {
+		email = requested.email()
+	} else if primary := requested.primaryEmail(); primary != "" && !strings.EqualFold(primary, current.primaryEmail()) {
+		email = strings.ToLower(strings.TrimSpace(primary))
+	}
+	if email != "" && email != user.Email {
+		if !strings.Contains(email, "@") {
+			return invalidValue("userName or emails must hold an email address")
+		}
+		if existing, err := database.DB.GetUserByEmail(email); err == nil && existing.Id != user.Id {
+			return errorf(http.StatusConflict, "uniqueness", "a user with email %s already exists", email)
+		}
+		changes["old_email"] = user.Email
+		changes["email"] = email
+		user.Email = email
+	}
+
+	if name := requestedName(current, requested); name != "" && name != user.Name {
+		if existing, err := database.DB.GetUserByName(name); err == nil && existing.Id != user.Id {
+			unique, err := auth.UniqueUserName(name, user.Email)
+			if err != nil {
+				return internalError(err)
+			}
+			name = unique
+		}
+		changes["old_name"] = user.Name
+		changes["name"] = name
+		user.Name = name
+	}
+
+	wasActive := user.IsActive
+	user.IsActive = requested.active()
+
+	if len(changes) > 0 || wasActive != user.IsActive {
+		if err := database.DB.UpdateUser(user.User); err != nil {
+			return internalError(err)
+		}
+	}
+	if requested.ExternalId != user.ExternalId {
+		if err := database.DB.SetUserScimExternalId(user.Id, requested.ExternalId); err != nil {
+			return internalError(err)
+		}
+	}
+
+	if len(changes) > 0 {
+		changes["email"] = user.Email
+		changes["source"] = "scim"
+		logAction(database.ActionUserUpdated, database.EntityUser, user.Id, changes)
+	}
+	if wasActive && !user.IsActive {
+		auth.DeleteUserSessions(user.Id)
+		logAction(database.ActionUserDeactivated, database.EntityUser, user.Id, map[string]interface{}{
+			"email":  user.Email,
+			"source": "scim",
+		})
+	} else if !wasActive && user.IsActive {
+		logAction(database.ActionUserActivated, database.EntityUser, user.Id, map[string]interface{}{
+			"email":  user.Email,
+			"source": "scim",
+		})
+	}
+	return nil
+}
+
+// requestedName returns the display name a request asks for, or "" when it does
+// not change it. A changed displayName wins over changes to the name attribute.
+func requestedName(current, requested *User) string {
+	if name := strings.TrimSpace(requested.DisplayName); name != "" && name != current.DisplayName {
+		return name
+	}
+	if requested.Name == nil {
+		return ""
+	}
+	old := current.Name
+	if old == nil {
+		old = &Name{}
+	}
+	if requested.Name.GivenName != old.GivenName || requested.Name.FamilyName != old.FamilyName {
+		if name := strings.TrimSpace(requested.Name.GivenName + " " + requested.Name.FamilyName); name != "" {
+			return name
+		}
+	}
+	if name := strings.TrimSpace(requested.Name.Formatted); name != "" && name != old.Formatted {
+		return name
+	}
+	return ""
+}
+
+// DeleteUser answers DELETE /Users/{id}. The user is soft-deleted and anonymized;
+// their files are held or transferred according to the settings.
+func (s *Service) DeleteUser(id string) *Error {
+	user, serr := s.loadWritableUser(id)
+	if serr != nil {
+		return serr
+	}
+
+	details := map[string]interface{}{
+		"email":        user.Email,
+		"name":         user.Name,
+		"deleted_by":   "scim",
+		"files_policy": FilesHold,
+	}
+
+	if s.Settings.FilePolicy == FilesTransfer {
+		target, err := database.DB.GetUserByEmail(s.Settings.TransferTo)
+		if err != nil || !target.IsActive || target.Id == user.Id {
+			// Holding is always safe; the files can still be dealt with by an admin
+			log.Printf("SCIM: cannot transfer files of %s to %q, holding them instead", user.Email, s.Settings.TransferTo)
+		} else {
+			moved, err := database.DB.TransferUserFiles(user.Id, target.Id)
+			if err != nil {
+				return internalError(err)
+			}
+			details["files_policy"] = FilesTransfer
+			details["files_transferred"] = moved
+			details["transferred_to"] = target.Email
+		}
+	}
+
+	if err := database.DB.SoftDeleteUser(user.Id, "scim"); err != nil {
+		return internalError(err)
+	}
+	logAction(database.ActionUserDeleted, database.EntityUser, user.Id, details)
+	return nil
+}
+
+// loadUser finds a user by SCIM id
+func (s *Service) loadUser(id string) (*database.ScimUser, *Error) {
+	userId, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, notFound("User", id)
+	}
+	user, err := database.DB.GetScimUser(userId)
+	if err != nil {
+		return nil, notFound("User", id)
+	}
+	return user, nil
+}
+
+// loadWritableUser finds a user that SCIM may change
+func (s *Service) loadWritableUser(id string) (*database.ScimUser, *Error) {
+	user, serr := s.loadUser(id)
+	if serr != nil {
+		return nil, serr
+	}
+	if user.UserLevel == models.UserLevelSuperAdmin {
+		return nil, errorf(http.StatusForbidden, "", "the super admin cannot be changed over SCIM")
+	}
+	return user, nil
+}
+
+// ListGroups answers GET /Groups
+func (s *Service) ListGroups(filter string, startIndex, count int) (*ListResponse, *Error) {
+	f, serr := parseListFilter(filter)
+	if serr != nil {
+		return nil, serr
+	}
+	teams, err := database.DB.GetScimTeams()
+	if err != nil {
+		return nil, internalError(err)
+	}
+
+	resources := make([]interface{}, 0, len(teams))
+	for _, team := range teams {
+		resources = append(resources, groupResource(team, s.BaseURL))
+	}
+	return page(resources, f, startIndex, count), nil
+}
+
+// GetGroup answers GET /Groups/{id}
+func (s *Service) GetGroup(id string) (*Group, *Error) {
+	team, serr := s.loadTeam(id)
+	if serr != nil {
+		return nil, serr
+	}
+	return groupResource(team, s.BaseURL), nil
+}
+
+// CreateGroup answers POST /Groups. The team is created by the admin who
+// generated the SCIM token; they are only a member if the group lists them.
+func (s *Service) CreateGroup(body []byte) (*Group, *Error) {
+	var request Group
+	if err := json.Unmarshal(body, &request); err != nil {
+		return nil, errorf(http.StatusBadRequest, "invalidSyntax", "invalid group: %v", err)
+	}
+	name := strings.TrimSpace(request.DisplayName)
+	if name == "" {
+		return nil, invalidValue("displayName is required")
+	}
+	if _, err := database.DB.GetTeamByName(name); err == nil {
+		return nil, errorf(http.StatusConflict, "uniqueness", "a team named %s already exists", name)
+	}
+	if _, err := database.DB.GetUserByID(s.Settings.TokenOwner); err != nil {
+		return nil, errorf(http.StatusInternalServerError, "", "the admin who generated the SCIM token no longer exists; generate a new token")
+	}
+	members, serr := memberIds(request.Members)
+	if serr != nil {
+		return nil, serr
+	}
+
+	team := &models.Team{
+		Name:           name,
+		Description:    "Provisioned over SCIM",
+		CreatedBy:      s.Settings.TokenOwner,
+		StorageQuotaMB: defaultTeamQuotaMB,
+		IsActive:       true,
+	}
+	if err := database.DB.CreateTeam(team); err != nil {
+		return nil, internalError(err)
+	}
+	if request.ExternalId != "" {
+		if err := database.DB.SetTeamScimExternalId(team.Id, request.ExternalId); err != nil {
+			return nil, internalError(err)
+		}
+	}
+
+	logAction(database.ActionTeamCreated, database.EntityTeam, team.Id, map[string]interface{}{
+		"name":             team.Name,
+		"storage_quota_mb": team.StorageQuotaMB,
+		"source":           "scim",
+	})
+
+	// CreateTeam made the token owner a member; keep them only if listed
+	if err := s.setMembers(team, members); err != nil {
+		return nil, err
+	}
+	return s.GetGroup(strconv.Itoa(team.Id))
+}
+
+// ReplaceGroup answers PUT /Groups/{id}
+func (s *Service) ReplaceGroup(id string, body []byte) (*Group, *Error) {
+	team, serr := s.loadTeam(id)
+	if serr != nil {
+		return nil, serr
+	}
+	var request Group
+	if err := json.Unmarshal(body, &request); err != nil {
+		return nil, errorf(http.StatusBadRequest, "invalidSyntax", "invalid group: %v", err)
+	}
+	if serr := s.updateGroup(team, &request); serr != nil {
+		return nil, serr
+	}
+	return s.GetGroup(id)
+}
+
+// PatchGroup answers PATCH /Groups/{id}
+func (s *Service) PatchGroup(id string, body []byte) (*Group, *Error) {
+	team, serr := s.loadTeam(id)
+	if serr != nil {
+		return nil, serr
+	}
+	var request PatchRequest
+	if err := json.Unmarshal(body, &request); err != nil {
+		return nil, errorf(http.StatusBadRequest, "invalidSyntax", "invalid patch: %v", err)
+	}
+
+	patched, serr := patchGroup(groupResource(team, s.BaseURL), request.Operations)
+	if serr != nil {
+		return nil, serr
+	}
+	if serr := s.updateGroup(team, patched); serr != nil {
+		return nil, serr
+	}
+	return s.GetGroup(id)
+}
+
+// updateGroup applies the requested representation of a group to its team
+func (s *Service) updateGroup(team *database.ScimTeam, requested *Group) *Error {
+	members, serr := memberIds(requested.Members)
+	if serr != nil {
+		return serr
+	}
+
+	name := strings.TrimSpace(requested.DisplayName)
+	if name == "" {
+		return invalidValue("displayName is required")
+	}
+	if name != team.Name {
+		if existing, err := database.DB.GetTeamByName(name); err == nil && existing.Id != team.Id {
+			return errorf(http.StatusConflict, "uniqueness", "a team named %s already exists", name)
+		}
+		oldName := team.Name
+		team.Name = name
+		if err := database.DB.UpdateTeam(team.Team); err != nil {
+			return internalError(err)
+		}
+		logAction(database.ActionTeamUpdated, database.EntityTeam, team.Id, map[string]interface{}{
+			"old_name": oldName,
+			"name":     name,
+			"source":   "scim",
+		})
+	}
+
+	if requested.ExternalId != team.ExternalId {
+		if err := database.DB.SetTeamScimExternalId(team.Id, requested.ExternalId); err != nil {
+			return internalError(err)
+		}
+	}
+
+	return s.setMembers(team.Team, members)
+}
+
+// setMembers makes the team's members exactly the given users. New members join
+// with the member role; existing members keep their role.
+func (s *Service) setMembers(team *models.Team, userIds []int) *Error {
+	current, err := database.DB.GetTeamMembers(team.Id)
+	if err != nil {
+		return internalError(err)
+	}
+
+	wanted := map[int]bool{}
+	for _, userId := range userIds {
+		wanted[userId] = true
+	}
+	present := map[int]bool{}
+
+	for _, member := range current {
+		present[member.UserId] = true
+		if wanted[member.UserId] {
+			continue
+		}
+		if err := database.DB.RemoveTeamMember(team.Id, member.UserId); err != nil {
+			return internalError(err)
+		}
+		logAction(database.ActionTeamMemberRemoved, database.EntityTeam, team.Id, map[string]interface{}{
+			"team_name":    team.Name,
+			"member_id":    member.UserId,
+			"member_email": member.UserEmail,
+			"source":       "scim",
+		})
+	}
+
+	for _, userId := range userIds {
+		if present[userId] {
+			continue
+		}
+		// Members of deactivated accounts are hidden from GetTeamMembers but still stored
+		if _, err := database.DB.GetTeamMember(team.Id, userId); err == nil {
+			continue
+		}
+
+		// AddedBy must reference a user; the audit entry records SCIM as the actor
+		member := &models.TeamMember{TeamId: team.Id, UserId: userId, Role: models.TeamRoleMember, AddedBy: team.CreatedBy}
+		if err := database.DB.AddTeamMember(member); err != nil {
+			return internalError(err)
+		}
+
+		email := ""
+		if user, err := database.DB.GetUserByID(userId); err == nil {
+			email = user.Email
+		}
+		logAction(database.ActionTeamMemberAdded, database.EntityTeam, team.Id, map[string]interface{}{
+			"team_name":    team.Name,
+			"member_id":    userId,
+			"member_email": email,
+			"role":         int(models.TeamRoleMember),
+			"source":       "scim",
+		})
+	}
+	return nil
+}
+
+// DeleteGroup answers DELETE /Groups/{id}. Teams are deactivated, like in the admin UI.
+func (s *Service) DeleteGroup(id string) *Error {
+	team, serr := s.loadTeam(id)
+	if serr != nil {
+		return serr
+	}
+	if err := database.DB.DeleteTeam(team.Id); err != nil {
+		return internalError(err)
+	}
+	logAction(database.ActionTeamDeleted, database.EntityTeam, team.Id, map[string]interface{}{
+		"name":   team.Name,
+		"source": "scim",
+	})
+	return nil
+}
+
+// loadTeam finds an active team by SCIM id
+func (s *Service) loadTeam(id string) (*database.ScimTeam, *Error) {
+	teamId, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, notFound("Group", id)
+	}
+	team, err := database.DB.GetScimTeam(teamId)
+	if err != nil {
+		return nil, notFound("Group", id)
+	}
+	return team, nil
+}
+
+// memberIds resolves group members to existing user IDs
+func memberIds(members []Value) ([]int, *Error) {
+	var ids []int
+	seen := map[int]bool{}
+	for _, member := range members {
+		userId, err := strconv.Atoi(member.Value)
+		if err != nil {
+			return nil, invalidValue("member %q is not a user id", member.Value)
+		}
+		if _, err := database.DB.GetScimUser(userId); err != nil {
+			return nil, invalidValue("member %q does not exist", member.Value)
+		}
+		if !seen[userId] {
+			seen[userId] = true
+			ids = append(ids, userId)
+		}
+	}
+	return ids, nil
+}
+
+func parseListFilter(filter string) (*Filter, *Error) {
+	if strings.TrimSpace(filter) == "" {
+		return nil, nil
+	}
+	f, err := ParseFilter(filter)
+	if err != nil {
+		return nil, errorf(http.StatusBadRequest, "invalidFilter", "%v", err)
+	}
+	return f, nil
+}
+
+func internalError(err error) *Error {
+	log.Printf("SCIM error: %v", err)
+	return errorf(http.StatusInternalServerError, "", "internal error")
+}
+
+// logAction writes an audit entry for a change made by the identity provider
+func logAction(action, entityType string, entityId int, details map[string]interface{}) {
+	database.DB.LogAction(&database.AuditLogEntry{
+		UserID:     0,
+		UserEmail:  "system",
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   strconv.Itoa(entityId),
+		Details:    database.CreateAuditDetails(details),
+		Success:    true,
+	})
+}
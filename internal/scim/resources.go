@@ -0,0 +1,241 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package scim
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Frimurare/WulfVault/internal/database"
+)
+
+// User is the SCIM representation of a user. userName is the email address.
+type User struct {
+	Schemas     []string `json:"schemas"`
+	Id          string   `json:"id,omitempty"`
+	ExternalId  string   `json:"externalId,omitempty"`
+	UserName    string   `json:"userName"`
+	Name        *Name    `json:"name,omitempty"`
+	DisplayName string   `json:"displayName,omitempty"`
+	Emails      []Value  `json:"emails,omitempty"`
+	Active      *bool    `json:"active,omitempty"`
+	Groups      []Value  `json:"groups,omitempty"`
+	Meta        *Meta    `json:"meta,omitempty"`
+}
+
+// Name is the complex name attribute of a user
+type Name struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+// Group is the SCIM representation of a team
+type Group struct {
+	Schemas     []string `json:"schemas"`
+	Id          string   `json:"id,omitempty"`
+	ExternalId  string   `json:"externalId,omitempty"`
+	DisplayName string   `json:"displayName"`
+	Members     []Value  `json:"members,omitempty"`
+	Meta        *Meta    `json:"meta,omitempty"`
+}
+
+// Value is an element of a multi-valued attribute such as emails or members
+type Value struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+// Meta is the resource metadata
+type Meta struct {
+	ResourceType string `json:"resourceType"`
+	Created      string `json:"created,omitempty"`
+	Location     string `json:"location,omitempty"`
+}
+
+// ListResponse is the result of a query
+type ListResponse struct {
+	Schemas      []string      `json:"schemas"`
+	TotalResults int           `json:"totalResults"`
+	StartIndex   int           `json:"startIndex"`
+	ItemsPerPage int           `json:"itemsPerPage"`
+	Resources    []interface{} `json:"Resources"`
+}
+
+// email returns the address a user resource asks for: userName when it is an
+// address, otherwise the primary email
+func (u *User) email() string {
+	if strings.Contains(u.UserName, "@") {
+		return strings.ToLower(strings.TrimSpace(u.UserName))
+	}
+	return u.primaryEmail()
+}
+
+// primaryEmail returns the primary email, or the first one if none is marked primary
+func (u *User) primaryEmail() string {
+	for _, e := range u.Emails {
+		if e.Primary {
+			return strings.ToLower(strings.TrimSpace(e.Value))
+		}
+	}
+	if len(u.Emails) > 0 {
+		return strings.ToLower(strings.TrimSpace(u.Emails[0].Value))
+	}
+	return ""
+}
+
+// displayName returns the name a user resource asks for: displayName, then the
+// formatted name, then given and family name
+func (u *User) displayName() string {
+	if name := strings.TrimSpace(u.DisplayName); name != "" {
+		return name
+	}
+	if u.Name == nil {
+		return ""
+	}
+	if name := strings.TrimSpace(u.Name.Formatted); name != "" {
+		return name
+	}
+	return strings.TrimSpace(u.Name.GivenName + " " + u.Name.FamilyName)
+}
+
+// active reports the requested active state; absent means active
+func (u *User) active() bool {
+	return u.Active == nil || *u.Active
+}
+
+func timestamp(unix int64) string {
+	if unix == 0 {
+		return ""
+	}
+	return time.Unix(unix, 0).UTC().Format(time.RFC3339)
+}
+
+// userResource builds the SCIM representation of a user
+func userResource(user *database.ScimUser, baseURL string) *User {
+	id := strconv.Itoa(user.Id)
+	active := user.IsActive
+	resource := &User{
+		Schemas:     []string{SchemaUser},
+		Id:          id,
+		ExternalId:  user.ExternalId,
+		UserName:    user.Email,
+		Name:        &Name{Formatted: user.Name},
+		DisplayName: user.Name,
+		Emails:      []Value{{Value: user.Email, Type: "work", Primary: true}},
+		Active:      &active,
+		Meta: &Meta{
+			ResourceType: "User",
+			Created:      timestamp(user.CreatedAt),
+			Location:     baseURL + "/Users/" + id,
+		},
+	}
+
+	if teams, err := database.DB.GetTeamsByUser(user.Id); err == nil {
+		for _, team := range teams {
+			teamId := strconv.Itoa(team.Id)
+			resource.Groups = append(resource.Groups, Value{
+				Value:   teamId,
+				Display: team.Name,
+				Ref:     baseURL + "/Groups/" + teamId,
+			})
+		}
+	}
+	return resource
+}
+
+// groupResource builds the SCIM representation of a team
+func groupResource(team *database.ScimTeam, baseURL string) *Group {
+	id := strconv.Itoa(team.Id)
+	resource := &Group{
+		Schemas:     []string{SchemaGroup},
+		Id:          id,
+		ExternalId:  team.ExternalId,
+		DisplayName: team.Name,
+		Meta: &Meta{
+			ResourceType: "Group",
+			Created:      timestamp(team.CreatedAt),
+			Location:     baseURL + "/Groups/" + id,
+		},
+	}
+
+	if members, err := database.DB.GetTeamMembers(team.Id); err == nil {
+		for _, member := range members {
+			userId := strconv.Itoa(member.UserId)
+			resource.Members = append(resource.Members, Value{
+				Value:   userId,
+				Display: member.UserEmail,
+				Ref:     baseURL + "/Users/" + userId,
+			})
+		}
+	}
+	return resource
+}
+
+// toMap converts a resource to its JSON form with lowercased keys, for filtering
+func toMap(resource interface{}) map[string]interface{} {
+	data, err := json.Marshal(resource)
+	if err != nil {
+		return nil
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil
+	}
+	return lowerKeys(m).(map[string]interface{})
+}
+
+func lowerKeys(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(value))
+		for k, element := range value {
+			m[strings.ToLower(k)] = lowerKeys(element)
+		}
+		return m
+	case []interface{}:
+		list := make([]interface{}, len(value))
+		for i, element := range value {
+			list[i] = lowerKeys(element)
+		}
+		return list
+	}
+	return v
+}
+
+// page applies a filter and startIndex/count pagination (1-based, RFC 7644 section 3.4.2.4)
+func page(resources []interface{}, filter *Filter, startIndex, count int) *ListResponse {
+	var matched []interface{}
+	for _, resource := range resources {
+		if filter == nil || filter.Matches(toMap(resource)) {
+			matched = append(matched, resource)
+		}
+	}
+
+	if startIndex < 1 {
+		startIndex = 1
+	}
+	list := &ListResponse{
+		Schemas:      []string{SchemaListResponse},
+		TotalResults: len(matched),
+		StartIndex:   startIndex,
+		Resources:    []interface{}{},
+	}
+	if startIndex <= len(matched) {
+		end := len(matched)
+		if count >= 0 && startIndex-1+count < end {
+			end = startIndex - 1 + count
+		}
+		list.Resources = matched[startIndex-1 : end]
+	}
+	list.ItemsPerPage = len(list.Resources)
+	return list
+}
@@ -0,0 +1,167 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+// Package scim implements a SCIM 2.0 service provider (RFC 7643, RFC 7644) so an
+// identity provider can provision users and teams
+package scim
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Frimurare/WulfVault/internal/auth"
+	"github.com/Frimurare/WulfVault/internal/database"
+)
+
+// Schema URNs
+const (
+	SchemaUser          = "urn:ietf:params:scim:schemas:core:2.0:User"
+	SchemaGroup         = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	SchemaListResponse  = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	SchemaPatchOp       = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	SchemaError         = "urn:ietf:params:scim:api:messages:2.0:Error"
+	SchemaServiceConfig = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	SchemaResourceType  = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
+)
+
+// TokenPrefix marks SCIM bearer tokens so they are not mistaken for API keys
+const TokenPrefix = "wvscim_"
+
+// What happens to the files of a deprovisioned user
+const (
+	FilesHold     = "hold"     // Files stay with the deleted user until an admin deals with them
+	FilesTransfer = "transfer" // Files are given to the configured user
+)
+
+// Settings is the SCIM configuration stored in the Configuration table
+type Settings struct {
+	Enabled bool
+	// FilePolicy is FilesHold or FilesTransfer
+	FilePolicy string
+	// TransferTo is the email of the user receiving transferred files
+	TransferTo string
+	// TokenHash is the SHA-256 of the bearer token; empty when no token was generated
+	TokenHash string
+	// TokenOwner is the admin who generated the token. Teams created over SCIM
+	// record this user as creator.
+	TokenOwner int
+}
+
+// LoadSettings reads the SCIM settings
+func LoadSettings() *Settings {
+	get := func(key, fallback string) string {
+		value, err := database.DB.GetConfigValue(key)
+		if err != nil || value == "" {
+			return fallback
+		}
+		return value
+	}
+
+	owner, _ := strconv.Atoi(get("scim_token_owner", "0"))
+	s := &Settings{
+		Enabled:    get("scim_enabled", "false") == "true",
+		FilePolicy: get("scim_deprovision_files", FilesHold),
+		TransferTo: get("scim_transfer_files_to", ""),
+		TokenHash:  get("scim_token_hash", ""),
+		TokenOwner: owner,
+	}
+	if s.FilePolicy != FilesTransfer {
+		s.FilePolicy = FilesHold
+	}
+	return s
+}
+
+// Save stores the settings, except the token which is set by GenerateToken
+func (s *Settings) Save() error {
+	if s.FilePolicy != FilesHold && s.FilePolicy != FilesTransfer {
+		return fmt.Errorf("unknown file policy %q", s.FilePolicy)
+	}
+	s.TransferTo = strings.ToLower(strings.TrimSpace(s.TransferTo))
+	if s.FilePolicy == FilesTransfer {
+		if s.TransferTo == "" {
+			return fmt.Errorf("a user to transfer files to is required")
+		}
+		user, err := database.DB.GetUserByEmail(s.TransferTo)
+		if err != nil || !user.IsActive {
+			return fmt.Errorf("no active user with email %s", s.TransferTo)
+		}
+	}
+
+	for key, value := range map[string]string{
+		"scim_enabled":           strconv.FormatBool(s.Enabled),
+		"scim_deprovision_files": s.FilePolicy,
+		"scim_transfer_files_to": s.TransferTo,
+	} {
+		if err := database.DB.SetConfigValue(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GenerateToken creates a new bearer token, replacing any previous one. Only its
+// hash is stored, so the token is returned this one time.
+func GenerateToken(ownerId int) (string, error) {
+	secret, err := auth.GenerateSessionID()
+	if err != nil {
+		return "", err
+	}
+	token := TokenPrefix + secret
+
+	if err := database.DB.SetConfigValue("scim_token_hash", auth.HashAPIKey(token)); err != nil {
+		return "", err
+	}
+	if err := database.DB.SetConfigValue("scim_token_owner", strconv.Itoa(ownerId)); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Authenticate checks a bearer token against the stored hash
+func (s *Settings) Authenticate(token string) bool {
+	if !s.Enabled || s.TokenHash == "" || !strings.HasPrefix(token, TokenPrefix) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(auth.HashAPIKey(token)), []byte(s.TokenHash)) == 1
+}
+
+// Error is a SCIM error response (RFC 7644 section 3.12)
+type Error struct {
+	Status   int
+	ScimType string // invalidFilter, invalidPath, invalidValue, uniqueness, mutability, ...
+	Detail   string
+}
+
+func (e *Error) Error() string {
+	return e.Detail
+}
+
+// Body returns the JSON body of the error
+func (e *Error) Body() map[string]interface{} {
+	body := map[string]interface{}{
+		"schemas": []string{SchemaError},
+		"status":  strconv.Itoa(e.Status),
+		"detail":  e.Detail,
+	}
+	if e.ScimType != "" {
+		body["scimType"] = e.ScimType
+	}
+	return body
+}
+
+func errorf(status int, scimType, format string, args ...interface{}) *Error {
+	return &Error{Status: status, ScimType: scimType, Detail: fmt.Sprintf(format, args...)}
+}
+
+func notFound(resource, id string) *Error {
+	return errorf(http.StatusNotFound, "", "%s %s not found", resource, id)
+}
+
+func invalidValue(format string, args ...interface{}) *Error {
+	return errorf(http.StatusBadRequest, "invalidValue", format, args...)
+}
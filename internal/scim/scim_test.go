@@ -0,0 +1,395 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package scim
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/Frimurare/WulfVault/internal/database"
+	"github.com/Frimurare/WulfVault/internal/models"
+)
+
+func testUser() map[string]interface{} {
+	active := true
+	return toMap(&User{
+		Schemas:     []string{SchemaUser},
+		Id:          "7",
+		ExternalId:  "ext-7",
+		UserName:    "Anna@Example.com",
+		DisplayName: "Anna Berg",
+		Emails:      []Value{{Value: "anna@example.com", Type: "work", Primary: true}},
+		Active:      &active,
+		Groups:      []Value{{Value: "3", Display: "Finance"}},
+	})
+}
+
+func TestFilter(t *testing.T) {
+	tests := []struct {
+		filter string
+		want   bool
+	}{
+		{`userName eq "anna@example.com"`, true},
+		{`USERNAME Eq "ANNA@EXAMPLE.COM"`, true},
+		{`urn:ietf:params:scim:schemas:core:2.0:User:userName eq "anna@example.com"`, true},
+		{`userName eq "bob@example.com"`, false},
+		{`userName ne "bob@example.com"`, true},
+		{`userName sw "anna"`, true},
+		{`userName ew "@example.com"`, true},
+		{`displayName co "berg"`, true},
+		{`externalId pr`, true},
+		{`name.givenName pr`, false},
+		{`active eq true`, true},
+		{`active eq false`, false},
+		{`emails.value eq "anna@example.com"`, true},
+		{`emails[type eq "work" and value co "anna"]`, true},
+		{`emails[type eq "home"]`, false},
+		{`groups eq "3"`, true},
+		{`userName eq "bob@example.com" or displayName sw "Anna"`, true},
+		{`userName eq "anna@example.com" and active eq false`, false},
+		{`not (active eq false)`, true},
+		{`(userName eq "x" or userName eq "y") and active eq true`, false},
+		{`userName eq "with \"quote\""`, false},
+	}
+
+	user := testUser()
+	for _, test := range tests {
+		f, err := ParseFilter(test.filter)
+		if err != nil {
+			t.Errorf("ParseFilter(%s): %v", test.filter, err)
+			continue
+		}
+		if got := f.Matches(user); got != test.want {
+			t.Errorf("%s: got %v, want %v", test.filter, got, test.want)
+		}
+	}
+}
+
+func TestFilterErrors(t *testing.T) {
+	for _, filter := range []string{
+		`userName`,
+		`userName eq`,
+		`userName xx "a"`,
+		`userName eq "unterminated`,
+		`(userName eq "a"`,
+		`userName eq "a" and`,
+		`emails[type eq "work"`,
+		`userName eq unquoted`,
+	} {
+		if _, err := ParseFilter(filter); err == nil {
+			t.Errorf("ParseFilter(%s) succeeded", filter)
+		}
+	}
+}
+
+func operations(t *testing.T, body string) []PatchOperation {
+	t.Helper()
+	var request PatchRequest
+	if err := json.Unmarshal([]byte(body), &request); err != nil {
+		t.Fatal(err)
+	}
+	return request.Operations
+}
+
+func TestPatchUser(t *testing.T) {
+	active := true
+	user := &User{
+		Schemas:     []string{SchemaUser},
+		Id:          "7",
+		UserName:    "anna@example.com",
+		Name:        &Name{Formatted: "Anna Berg"},
+		DisplayName: "Anna Berg",
+		Emails:      []Value{{Value: "anna@example.com", Type: "work", Primary: true}},
+		Active:      &active,
+	}
+
+	// Azure AD style: no path, string boolean, capitalised op
+	patched, serr := patchUser(user, operations(t, `{"Operations":[
+		{"op":"Replace","value":{"active":"False","name.givenName":"Anna","externalId":"a-1"}}]}`))
+	if serr != nil {
+		t.Fatal(serr)
+	}
+	if patched.Active == nil || *patched.Active {
+		t.Error("active was not set to false")
+	}
+	if patched.Name.GivenName != "Anna" || patched.Name.Formatted != "Anna Berg" {
+		t.Errorf("name = %+v", patched.Name)
+	}
+	if patched.ExternalId != "a-1" {
+		t.Errorf("externalId = %q", patched.ExternalId)
+	}
+
+	// Value filter with sub-attribute, and a URN-prefixed path
+	patched, serr = patchUser(user, operations(t, `{"Operations":[
+		{"op":"replace","path":"emails[type eq \"work\"].value","value":"anna.berg@example.com"},
+		{"op":"replace","path":"urn:ietf:params:scim:schemas:core:2.0:User:displayName","value":"Anna B"}]}`))
+	if serr != nil {
+		t.Fatal(serr)
+	}
+	if len(patched.Emails) != 1 || patched.Emails[0].Value != "anna.berg@example.com" || !patched.Emails[0].Primary {
+		t.Errorf("emails = %+v", patched.Emails)
+	}
+	if patched.DisplayName != "Anna B" {
+		t.Errorf("displayName = %q", patched.DisplayName)
+	}
+
+	// Filters without a match create the element
+	patched, serr = patchUser(user, operations(t, `{"Operations":[
+		{"op":"add","path":"emails[type eq \"home\"].value","value":"anna@home.example"}]}`))
+	if serr != nil {
+		t.Fatal(serr)
+	}
+	if len(patched.Emails) != 2 || patched.Emails[1].Type != "home" || patched.Emails[1].Value != "anna@home.example" {
+		t.Errorf("emails = %+v", patched.Emails)
+	}
+
+	// The original resource is not modified
+	if user.DisplayName != "Anna Berg" || len(user.Emails) != 1 {
+		t.Error("patch modified the original resource")
+	}
+
+	for _, body := range []string{
+		`{"Operations":[{"op":"move","path":"userName","value":"x"}]}`,
+		`{"Operations":[{"op":"remove"}]}`,
+		`{"Operations":[{"op":"replace","path":"emails[type eq"}]}`,
+		`{"Operations":[{"op":"add","value":"not an object"}]}`,
+	} {
+		if _, serr := patchUser(user, operations(t, body)); serr == nil || serr.Status != http.StatusBadRequest {
+			t.Errorf("%s: got %v, want a 400 error", body, serr)
+		}
+	}
+}
+
+func TestPatchGroupMembers(t *testing.T) {
+	group := &Group{
+		Schemas:     []string{SchemaGroup},
+		Id:          "3",
+		DisplayName: "Finance",
+		Members:     []Value{{Value: "1"}, {Value: "2"}},
+	}
+
+	patched, serr := patchGroup(group, operations(t, `{"Operations":[
+		{"op":"add","path":"members","value":[{"value":"2"},{"value":"3"}]},
+		{"op":"remove","path":"members[value eq \"1\"]"}]}`))
+	if serr != nil {
+		t.Fatal(serr)
+	}
+	if got := values(patched.Members); got != "2,3" {
+		t.Errorf("members = %s, want 2,3", got)
+	}
+
+	// Azure AD removes members by listing them in the value
+	patched, serr = patchGroup(group, operations(t, `{"Operations":[
+		{"op":"remove","path":"members","value":[{"value":"2"}]}]}`))
+	if serr != nil {
+		t.Fatal(serr)
+	}
+	if got := values(patched.Members); got != "1" {
+		t.Errorf("members = %s, want 1", got)
+	}
+
+	patched, serr = patchGroup(group, operations(t, `{"Operations":[
+		{"op":"replace","path":"members","value":[{"value":"9"}]},
+		{"op":"replace","value":{"displayName":"Finance EU"}}]}`))
+	if serr != nil {
+		t.Fatal(serr)
+	}
+	if got := values(patched.Members); got != "9" || patched.DisplayName != "Finance EU" {
+		t.Errorf("members = %s, displayName = %q", got, patched.DisplayName)
+	}
+
+	patched, serr = patchGroup(group, operations(t, `{"Operations":[{"op":"remove","path":"members"}]}`))
+	if serr != nil {
+		t.Fatal(serr)
+	}
+	if len(patched.Members) != 0 {
+		t.Errorf("members = %s, want none", values(patched.Members))
+	}
+}
+
+func values(list []Value) string {
+	s := ""
+	for i, v := range list {
+		if i > 0 {
+			s += ","
+		}
+		s += v.Value
+	}
+	return s
+}
+
+func TestPage(t *testing.T) {
+	var resources []interface{}
+	for i := 1; i <= 5; i++ {
+		resources = append(resources, &Group{DisplayName: "Team " + strconv.Itoa(i)})
+	}
+
+	list := page(resources, nil, 2, 2)
+	if list.TotalResults != 5 || list.StartIndex != 2 || list.ItemsPerPage != 2 {
+		t.Errorf("page = %+v", list)
+	}
+	if list.Resources[0].(*Group).DisplayName != "Team 2" {
+		t.Errorf("first resource = %+v", list.Resources[0])
+	}
+
+	if list := page(resources, nil, 9, 10); list.TotalResults != 5 || len(list.Resources) != 0 {
+		t.Errorf("page past the end = %+v", list)
+	}
+	if list := page(resources, nil, 1, 0); list.TotalResults != 5 || len(list.Resources) != 0 {
+		t.Errorf("count=0 = %+v", list)
+	}
+}
+
+func setupService(t *testing.T) (*Service, *models.User) {
+	t.Helper()
+	if err := database.Initialize(t.TempDir()); err != nil {
+		t.Fatalf("initialize database: %v", err)
+	}
+	t.Cleanup(func() { database.DB.Close() })
+
+	admin := &models.User{Name: "Admin", Email: "admin@example.com", Password: "x", UserLevel: models.UserLevelAdmin, IsActive: true}
+	if err := database.DB.CreateUser(admin); err != nil {
+		t.Fatal(err)
+	}
+	return &Service{
+		Settings:       &Settings{Enabled: true, FilePolicy: FilesHold, TokenOwner: admin.Id},
+		BaseURL:        "https://files.example.com/scim/v2",
+		DefaultQuotaMB: 5000,
+	}, admin
+}
+
+func TestProvisionUsers(t *testing.T) {
+	s, admin := setupService(t)
+
+	user, serr := s.CreateUser([]byte(`{"schemas":["` + SchemaUser + `"],"userName":"Anna@Example.com",
+		"externalId":"okta-1","name":{"givenName":"Anna","familyName":"Berg"}}`))
+	if serr != nil {
+		t.Fatal(serr)
+	}
+	if user.UserName != "anna@example.com" || user.DisplayName != "Anna Berg" || user.ExternalId != "okta-1" || !*user.Active {
+		t.Errorf("created user = %+v", user)
+	}
+	stored, err := database.DB.GetUserByEmail("anna@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.StorageQuotaMB != 5000 || stored.UserLevel != models.UserLevelUser {
+		t.Errorf("stored user = %+v", stored)
+	}
+
+	if _, serr := s.CreateUser([]byte(`{"userName":"anna@example.com"}`)); serr == nil || serr.Status != http.StatusConflict {
+		t.Errorf("duplicate create: got %v, want 409", serr)
+	}
+
+	list, serr := s.ListUsers(`externalId eq "okta-1"`, 1, 100)
+	if serr != nil {
+		t.Fatal(serr)
+	}
+	if list.TotalResults != 1 {
+		t.Errorf("filtered list has %d results, want 1", list.TotalResults)
+	}
+	if _, serr := s.ListUsers(`externalId eq`, 1, 100); serr == nil || serr.ScimType != "invalidFilter" {
+		t.Errorf("bad filter: got %v", serr)
+	}
+
+	user, serr = s.PatchUser(user.Id, []byte(`{"Operations":[{"op":"replace","value":{"active":false,"displayName":"Anna B"}}]}`))
+	if serr != nil {
+		t.Fatal(serr)
+	}
+	if *user.Active || user.DisplayName != "Anna B" {
+		t.Errorf("patched user = %+v", user)
+	}
+
+	// A file owned by the user is transferred on deprovisioning
+	if err := database.DB.SaveFile(&database.FileInfo{Id: "f1", Name: "report.pdf", UserId: stored.Id, SizeBytes: 10}); err != nil {
+		t.Fatal(err)
+	}
+	s.Settings.FilePolicy = FilesTransfer
+	s.Settings.TransferTo = admin.Email
+	if serr := s.DeleteUser(user.Id); serr != nil {
+		t.Fatal(serr)
+	}
+	if _, serr := s.GetUser(user.Id); serr == nil || serr.Status != http.StatusNotFound {
+		t.Errorf("deleted user is still returned: %v", serr)
+	}
+	file, err := database.DB.GetFileByID("f1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.UserId != admin.Id {
+		t.Errorf("file owner = %d, want %d", file.UserId, admin.Id)
+	}
+
+	superAdmin := &models.User{Name: "Root", Email: "root@example.com", Password: "x", UserLevel: models.UserLevelSuperAdmin, IsActive: true}
+	if err := database.DB.CreateUser(superAdmin); err != nil {
+		t.Fatal(err)
+	}
+	if serr := s.DeleteUser(strconv.Itoa(superAdmin.Id)); serr == nil || serr.Status != http.StatusForbidden {
+		t.Errorf("deleting the super admin: got %v, want 403", serr)
+	}
+}
+
+func TestProvisionGroups(t *testing.T) {
+	s, admin := setupService(t)
+
+	anna, serr := s.CreateUser([]byte(`{"userName":"anna@example.com","displayName":"Anna"}`))
+	if serr != nil {
+		t.Fatal(serr)
+	}
+	bo, serr := s.CreateUser([]byte(`{"userName":"bo@example.com","displayName":"Bo"}`))
+	if serr != nil {
+		t.Fatal(serr)
+	}
+
+	group, serr := s.CreateGroup([]byte(`{"displayName":"Finance","externalId":"g-1","members":[{"value":"` + anna.Id + `"}]}`))
+	if serr != nil {
+		t.Fatal(serr)
+	}
+	if values(group.Members) != anna.Id {
+		t.Errorf("members = %s, want only %s (the token owner is not listed)", values(group.Members), anna.Id)
+	}
+	team, err := database.DB.GetTeamByName("Finance")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if team.CreatedBy != admin.Id {
+		t.Errorf("team created by %d, want %d", team.CreatedBy, admin.Id)
+	}
+
+	if _, serr := s.CreateGroup([]byte(`{"displayName":"finance"}`)); serr == nil || serr.Status != http.StatusConflict {
+		t.Errorf("duplicate group: got %v, want 409", serr)
+	}
+	if _, serr := s.CreateGroup([]byte(`{"displayName":"Sales","members":[{"value":"999"}]}`)); serr == nil || serr.Status != http.StatusBadRequest {
+		t.Errorf("unknown member: got %v, want 400", serr)
+	}
+
+	group, serr = s.PatchGroup(group.Id, []byte(`{"Operations":[
+		{"op":"add","path":"members","value":[{"value":"`+bo.Id+`"}]},
+		{"op":"remove","path":"members[value eq \"`+anna.Id+`\"]"}]}`))
+	if serr != nil {
+		t.Fatal(serr)
+	}
+	if values(group.Members) != bo.Id {
+		t.Errorf("members = %s, want %s", values(group.Members), bo.Id)
+	}
+
+	bob, serr := s.GetUser(bo.Id)
+	if serr != nil {
+		t.Fatal(serr)
+	}
+	if len(bob.Groups) != 1 || bob.Groups[0].Display != "Finance" {
+		t.Errorf("groups of user = %+v", bob.Groups)
+	}
+
+	if serr := s.DeleteGroup(group.Id); serr != nil {
+		t.Fatal(serr)
+	}
+	if list, _ := s.ListGroups("", 1, 100); list.TotalResults != 0 {
+		t.Errorf("%d groups left after delete", list.TotalResults)
+	}
+}
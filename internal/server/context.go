@@ -16,6 +16,8 @@ type contextKey string
 const (
 	userContextKey            contextKey = "user"
 	downloadAccountContextKey contextKey = "download_account"
+	apiKeyContextKey          contextKey = "api_key"
+	impersonationContextKey   contextKey = "impersonation"
 )
 
 // contextWithUser adds a user to the context
@@ -39,3 +41,27 @@ func downloadAccountFromContext(ctx context.Context) (*models.DownloadAccount, b
 	account, ok := ctx.Value(downloadAccountContextKey).(*models.DownloadAccount)
 	return account, ok
 }
+
+// contextWithAPIKey adds the API key used to authenticate the request to the context
+func contextWithAPIKey(ctx context.Context, key *models.ApiKey) context.Context {
+	return context.WithValue(ctx, apiKeyContextKey, key)
+}
+
+// apiKeyFromContext retrieves the API key from the context.
+// It is only present for requests authenticated with a bearer token.
+func apiKeyFromContext(ctx context.Context) (*models.ApiKey, bool) {
+	key, ok := ctx.Value(apiKeyContextKey).(*models.ApiKey)
+	return key, ok
+}
+
+// contextWithImpersonation marks the request as made by a super admin viewing the app as the user
+func contextWithImpersonation(ctx context.Context, imp *impersonation) context.Context {
+	return context.WithValue(ctx, impersonationContextKey, imp)
+}
+
+// impersonationFromContext retrieves the impersonation the request was made in.
+// It is only present while a super admin views the app as another user.
+func impersonationFromContext(ctx context.Context) (*impersonation, bool) {
+	imp, ok := ctx.Value(impersonationContextKey).(*impersonation)
+	return imp, ok
+}
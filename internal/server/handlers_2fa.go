@@ -213,12 +213,25 @@ func (s *Server) handle2FADisable(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Users whose role requires 2FA must keep a second factor
+	if mfaRequired(user) && !hasPasskeys(user.Id) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"error":   "Your role requires two-factor authentication. Add a passkey before disabling 2FA.",
+		})
+		return
+	}
+
 	// Disable 2FA
 	if err := database.DB.DisableTOTP(user.Id); err != nil {
 		http.Error(w, "Failed to disable 2FA", http.StatusInternalServerError)
 		return
 	}
 
+	// Sign out everywhere else
+	revokeSessionsAfterCredentialChange(r, user, user, "2fa_disabled")
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success": true,
@@ -238,39 +251,22 @@ func (s *Server) handle2FAVerify(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get pending user ID from temporary cookie
-	cookie, err := r.Cookie("totp_pending")
-	if err != nil {
-		http.Redirect(w, r, "/login", http.StatusSeeOther)
+	// Get the user who passed the password step
+	user, err := pendingLoginUser(r)
+	if err == errPendingLoginExpired {
+		http.Redirect(w, r, "/login?error=Session expired", http.StatusSeeOther)
 		return
 	}
-
-	var pendingData struct {
-		UserID    int   `json:"user_id"`
-		CreatedAt int64 `json:"created_at"`
-	}
-
-	decodedData, err := base64.StdEncoding.DecodeString(cookie.Value)
 	if err != nil {
 		http.Redirect(w, r, "/login", http.StatusSeeOther)
 		return
 	}
-
-	if err := json.Unmarshal(decodedData, &pendingData); err != nil {
-		http.Redirect(w, r, "/login", http.StatusSeeOther)
-		return
-	}
-
-	// Check if cookie has expired (5 minutes)
-	if time.Now().Unix()-pendingData.CreatedAt > 300 {
-		http.Redirect(w, r, "/login?error=Session expired", http.StatusSeeOther)
+	if !user.TOTPEnabled {
+		s.render2FAVerifyPage(w, r, "Use your passkey to continue")
 		return
 	}
-
-	// Get user
-	user, err := database.DB.GetUserByID(pendingData.UserID)
-	if err != nil || !user.TOTPEnabled {
-		http.Redirect(w, r, "/login", http.StatusSeeOther)
+	if passkeyRequired(user) && hasPasskeys(user.Id) {
+		s.render2FAVerifyPage(w, r, "Your role requires signing in with a passkey")
 		return
 	}
 
@@ -283,6 +279,13 @@ func (s *Server) handle2FAVerify(w http.ResponseWriter, r *http.Request) {
 	code := r.FormValue("code")
 	useBackup := r.FormValue("use_backup") == "1"
 
+	lockKeys := []string{auth.TOTPLockKey(user.Id), s.ipLockKey(r)}
+	if until := auth.LockedUntil(lockKeys...); !until.IsZero() {
+		logLockedAttempt(r, user.Email, "totp", until)
+		s.render2FAVerifyPage(w, r, auth.LockoutMessage(until))
+		return
+	}
+
 	var valid bool
 
 	if useBackup {
@@ -298,47 +301,53 @@ func (s *Server) handle2FAVerify(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if !valid {
+		database.DB.LogAction(&database.AuditLogEntry{
+			UserID:     int64(user.Id),
+			UserEmail:  user.Email,
+			Action:     database.ActionLoginFailed,
+			EntityType: database.EntitySession,
+			Details: database.CreateAuditDetails(map[string]interface{}{
+				"email":  user.Email,
+				"reason": "invalid_2fa_code",
+				"backup": useBackup,
+			}),
+			IPAddress: getClientIP(r),
+			UserAgent: r.UserAgent(),
+			Success:   false,
+			ErrorMsg:  "Invalid verification code",
+		})
+		s.recordFailedAttempt(r, "totp", user.Email, lockKeys...)
 		s.render2FAVerifyPage(w, r, "Invalid verification code")
 		return
 	}
+	auth.ClearFailures(lockKeys[0])
 
-	// Clear pending cookie
-	http.SetCookie(w, &http.Cookie{
-		Name:     "totp_pending",
-		Value:    "",
-		Path:     "/",
-		MaxAge:   -1,
-		HttpOnly: true,
-	})
+	method := "totp"
+	if useBackup {
+		method = "backup_code"
+	}
 
-	// Create session
-	sessionID, err := auth.CreateSession(user.Id)
+	// Create session and redirect to the appropriate dashboard
+	redirect, err := s.completeLogin(w, r, user, method)
 	if err != nil {
 		s.render2FAVerifyPage(w, r, "Failed to create session")
 		return
 	}
 
-	// Set session cookie
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session",
-		Value:    sessionID,
-		Path:     "/",
-		Expires:  time.Now().Add(24 * time.Hour),
-		HttpOnly: true,
-		SameSite: http.SameSiteStrictMode,
-	})
-
-	// Redirect to appropriate dashboard
-	if user.IsAdmin() {
-		http.Redirect(w, r, "/admin", http.StatusSeeOther)
-	} else {
-		http.Redirect(w, r, "/dashboard", http.StatusSeeOther)
-	}
+	http.Redirect(w, r, redirect, http.StatusSeeOther)
 }
 
 // render2FAVerifyPage renders the 2FA verification page
 func (s *Server) render2FAVerifyPage(w http.ResponseWriter, r *http.Request, errorMsg string) {
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	// Offer the factors the pending user has; a required passkey rules out codes
+	showPasskey, showTOTP := false, true
+	if user, err := pendingLoginUser(r); err == nil {
+		showPasskey = hasPasskeys(user.Id)
+		showTOTP = user.TOTPEnabled && !(showPasskey && passkeyRequired(user))
+	}
+
 	html := `<!DOCTYPE html>
 <html lang="en">
 <head>
@@ -457,7 +466,33 @@ func (s *Server) render2FAVerifyPage(w http.ResponseWriter, r *http.Request, err
 		html += `<div class="error">` + errorMsg + `</div>`
 	}
 
-	html += `
+	if showPasskey {
+		html += `
+        <button type="button" class="btn" id="passkey-btn" onclick="verifyWithPasskey()">🔑 Use your passkey</button>
+        <div class="help-text">Use your security key, phone or this device's screen lock</div>
+        <script>` + passkeyScript() + `
+
+        async function verifyWithPasskey() {
+            const button = document.getElementById('passkey-btn');
+            button.disabled = true;
+            try {
+                const options = await passkeyRequest('/2fa/passkey/begin');
+                const result = await passkeyRequest('/2fa/passkey/finish', await passkeyGet(options));
+                window.location.href = result.redirect;
+            } catch (error) {
+                button.disabled = false;
+                if (error.name !== 'NotAllowedError') alert(error.message);
+            }
+        }
+        </script>`
+		if showTOTP {
+			html += `
+        <div class="help-text" style="margin: 20px 0;">or</div>`
+		}
+	}
+
+	if showTOTP {
+		html += `
         <form method="POST" action="/2fa/verify" id="totp-form">
             <div class="form-group">
                 <label for="code">Enter the 6-digit code from your authenticator app</label>
@@ -483,7 +518,6 @@ func (s *Server) render2FAVerifyPage(w http.ResponseWriter, r *http.Request, err
         <div class="backup-link">
             <a href="#" id="toggle-backup">Use a backup code instead</a>
         </div>
-    </div>
 
     <script>
         const totpForm = document.getElementById('totp-form');
@@ -512,7 +546,11 @@ func (s *Server) render2FAVerifyPage(w http.ResponseWriter, r *http.Request, err
                 setTimeout(() => totpForm.submit(), 100);
             }
         });
-    </script>
+    </script>`
+	}
+
+	html += `
+    </div>
 </body>
 </html>`
 
@@ -22,9 +22,18 @@ import (
 	"time"
 
 	"github.com/Frimurare/WulfVault/internal/auth"
+	"github.com/Frimurare/WulfVault/internal/cleanup"
 	"github.com/Frimurare/WulfVault/internal/database"
 	emailpkg "github.com/Frimurare/WulfVault/internal/email"
+	"github.com/Frimurare/WulfVault/internal/integrity"
+	"github.com/Frimurare/WulfVault/internal/loginalerts"
+	"github.com/Frimurare/WulfVault/internal/mfa"
 	"github.com/Frimurare/WulfVault/internal/models"
+	"github.com/Frimurare/WulfVault/internal/passkey"
+	"github.com/Frimurare/WulfVault/internal/passwords"
+	"github.com/Frimurare/WulfVault/internal/sessionpolicy"
+	"github.com/Frimurare/WulfVault/internal/storage"
+	"github.com/Frimurare/WulfVault/internal/sudo"
 )
 
 // handleAdminDashboard renders the admin dashboard
@@ -189,7 +198,8 @@ func (s *Server) handleAdminUsers(w http.ResponseWriter, r *http.Request) {
 		downloadCount = 0
 	}
 
-	s.renderAdminUsers(w, users, downloadAccounts, userFilter, userCount, downloadFilter, downloadCount)
+	admin, _ := userFromContext(r.Context())
+	s.renderAdminUsers(w, admin, users, downloadAccounts, userFilter, userCount, downloadFilter, downloadCount)
 }
 
 // handleAdminUserCreate creates a new user
@@ -214,7 +224,6 @@ func (s *Server) handleAdminUserCreate(w http.ResponseWriter, r *http.Request) {
 	email := r.FormValue("email")
 	password := r.FormValue("password")
 	quotaMB, _ := strconv.ParseInt(r.FormValue("quota_mb"), 10, 64)
-	userLevel, _ := strconv.Atoi(r.FormValue("user_level"))
 	sendWelcomeEmail := r.FormValue("send_welcome_email") == "1"
 
 	// Validate
@@ -223,6 +232,21 @@ func (s *Server) handleAdminUserCreate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	admin, _ := userFromContext(r.Context())
+	role, err := database.DB.GetRole(mustParseInt(r.FormValue("role_id")))
+	if err != nil {
+		s.renderAdminUserForm(w, nil, "Please choose a role")
+		return
+	}
+	if !canGrant(admin, role.Permissions) {
+		s.renderAdminUserForm(w, nil, "You cannot assign the "+role.Name+" role because it has permissions you don't have")
+		return
+	}
+	userLevel := models.UserLevelUser
+	if role.IsAdministrative() {
+		userLevel = models.UserLevelAdmin
+	}
+
 	// If not sending welcome email, password is required
 	if !sendWelcomeEmail && password == "" {
 		s.renderAdminUserForm(w, nil, "Password is required (or check 'Send welcome email')")
@@ -230,7 +254,6 @@ func (s *Server) handleAdminUserCreate(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Hash password (use temporary password if sending welcome email)
-	var err error
 	if sendWelcomeEmail {
 		// Generate temporary random password that will be replaced via email
 		tempBytes := make([]byte, 32)
@@ -245,6 +268,10 @@ func (s *Server) handleAdminUserCreate(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	} else {
+		if err := checkUserPassword(password, email, nil); err != nil {
+			s.renderAdminUserForm(w, nil, err.Error())
+			return
+		}
 		password, err = auth.HashPassword(password)
 		if err != nil {
 			s.renderAdminUserForm(w, nil, "Failed to hash password")
@@ -257,32 +284,32 @@ func (s *Server) handleAdminUserCreate(w http.ResponseWriter, r *http.Request) {
 		Name:           name,
 		Email:          email,
 		Password:       password,
-		UserLevel:      models.UserRank(userLevel),
+		UserLevel:      userLevel,
 		Permissions:    models.UserPermissionNone,
 		StorageQuotaMB: quotaMB,
 		StorageUsedMB:  0,
 		IsActive:       true,
 	}
 
-	// Set permissions based on user level
-	if newUser.UserLevel == models.UserLevelAdmin {
-		newUser.Permissions = models.UserPermissionAll
-	}
-
 	if err := database.DB.CreateUser(newUser); err != nil {
 		s.renderAdminUserForm(w, nil, "Failed to create user: "+err.Error())
 		return
 	}
+	if err := database.DB.SetUserRole(newUser, role); err != nil {
+		log.Printf("Failed to assign role %d to new user %d: %v", role.Id, newUser.Id, err)
+	}
+	if !sendWelcomeEmail {
+		passwords.Record(database.AccountTypeUser, newUser.Id, newUser.Password)
+	}
 
 	// Log the action
-	admin, _ := userFromContext(r.Context())
 	database.DB.LogAction(&database.AuditLogEntry{
 		UserID:     int64(admin.Id),
 		UserEmail:  admin.Email,
 		Action:     "USER_CREATED",
 		EntityType: "User",
 		EntityID:   fmt.Sprintf("%d", newUser.Id),
-		Details:    fmt.Sprintf("{\"email\":\"%s\",\"name\":\"%s\",\"user_level\":%d,\"quota_mb\":%d}", newUser.Email, newUser.Name, newUser.UserLevel, newUser.StorageQuotaMB),
+		Details:    fmt.Sprintf("{\"email\":\"%s\",\"name\":\"%s\",\"user_level\":%d,\"role_id\":%d,\"quota_mb\":%d}", newUser.Email, newUser.Name, newUser.UserLevel, role.Id, newUser.StorageQuotaMB),
 		IPAddress:  getClientIP(r),
 		UserAgent:  r.UserAgent(),
 		Success:    true,
@@ -341,6 +368,12 @@ func (s *Server) handleAdminUserEdit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	admin, _ := userFromContext(r.Context())
+	if !canManageUser(admin, existingUser) {
+		http.Error(w, "You cannot edit a user whose role has permissions you don't have", http.StatusForbidden)
+		return
+	}
+
 	if r.Method == http.MethodGet {
 		s.renderAdminUserForm(w, existingUser, "")
 		return
@@ -360,12 +393,30 @@ func (s *Server) handleAdminUserEdit(w http.ResponseWriter, r *http.Request) {
 	existingUser.Name = r.FormValue("name")
 	existingUser.Email = r.FormValue("email")
 	existingUser.StorageQuotaMB, _ = strconv.ParseInt(r.FormValue("quota_mb"), 10, 64)
-	existingUser.UserLevel = models.UserRank(mustParseInt(r.FormValue("user_level")))
 	existingUser.IsActive = r.FormValue("is_active") == "1"
 
+	// The super admin always has every permission, and nobody changes their own role
+	if roleId := mustParseInt(r.FormValue("role_id")); roleId != 0 && !existingUser.IsSuperAdmin() {
+		currentRoleId, _ := database.DB.GetUserRoleId(existingUser)
+		if roleId != currentRoleId {
+			if existingUser.Id == admin.Id {
+				s.renderAdminUserForm(w, existingUser, "You cannot change your own role")
+				return
+			}
+			if err := assignRole(r, admin, existingUser, roleId); err != nil {
+				s.renderAdminUserForm(w, existingUser, err.Error())
+				return
+			}
+		}
+	}
+
 	// Update password if provided
 	newPassword := r.FormValue("password")
 	if newPassword != "" {
+		if err := checkUserPassword(newPassword, existingUser.Email, existingUser); err != nil {
+			s.renderAdminUserForm(w, existingUser, err.Error())
+			return
+		}
 		hashedPassword, err := auth.HashPassword(newPassword)
 		if err != nil {
 			s.renderAdminUserForm(w, existingUser, "Failed to hash password")
@@ -378,9 +429,14 @@ func (s *Server) handleAdminUserEdit(w http.ResponseWriter, r *http.Request) {
 		s.renderAdminUserForm(w, existingUser, "Failed to update user: "+err.Error())
 		return
 	}
+	if newPassword != "" {
+		passwords.Record(database.AccountTypeUser, existingUser.Id, existingUser.Password)
+	}
 
 	// Log the action
-	admin, _ := userFromContext(r.Context())
+	if newPassword != "" {
+		revokeSessionsAfterCredentialChange(r, admin, existingUser, "password_changed")
+	}
 	database.DB.LogAction(&database.AuditLogEntry{
 		UserID:     int64(admin.Id),
 		UserEmail:  admin.Email,
@@ -422,6 +478,10 @@ func (s *Server) handleAdminUserDelete(w http.ResponseWriter, r *http.Request) {
 		s.sendError(w, http.StatusNotFound, "User not found")
 		return
 	}
+	if !canManageUser(admin, userToDelete) {
+		s.sendError(w, http.StatusForbidden, "You cannot delete a user whose role has permissions you don't have")
+		return
+	}
 
 	// Delete user (this will also soft-delete all their files to trash)
 	if err := database.DB.DeleteUser(userID, admin.Id); err != nil {
@@ -510,6 +570,11 @@ func (s *Server) handleAdminCreateDownloadAccount(w http.ResponseWriter, r *http
 		return
 	}
 
+	if err := checkDownloadAccountPassword(password, email, nil); err != nil {
+		s.renderAdminDownloadAccountForm(w, nil, err.Error())
+		return
+	}
+
 	// Hash password
 	hashedPassword, err := auth.HashPassword(password)
 	if err != nil {
@@ -529,6 +594,7 @@ func (s *Server) handleAdminCreateDownloadAccount(w http.ResponseWriter, r *http
 		s.renderAdminDownloadAccountForm(w, nil, "Failed to create account: "+err.Error())
 		return
 	}
+	passwords.Record(database.AccountTypeDownloadAccount, account.Id, account.Password)
 
 	log.Printf("Admin created download account: %s", email)
 
@@ -586,6 +652,10 @@ func (s *Server) handleAdminEditDownloadAccount(w http.ResponseWriter, r *http.R
 	// Update password if provided
 	newPassword := r.FormValue("password")
 	if newPassword != "" {
+		if err := checkDownloadAccountPassword(newPassword, existingAccount.Email, existingAccount); err != nil {
+			s.renderAdminDownloadAccountForm(w, existingAccount, err.Error())
+			return
+		}
 		hashedPassword, err := auth.HashPassword(newPassword)
 		if err != nil {
 			s.renderAdminDownloadAccountForm(w, existingAccount, "Failed to hash password")
@@ -598,6 +668,9 @@ func (s *Server) handleAdminEditDownloadAccount(w http.ResponseWriter, r *http.R
 		s.renderAdminDownloadAccountForm(w, existingAccount, "Failed to update account: "+err.Error())
 		return
 	}
+	if newPassword != "" {
+		passwords.Record(database.AccountTypeDownloadAccount, existingAccount.Id, existingAccount.Password)
+	}
 
 	log.Printf("Admin updated download account: ID=%d, Email=%s", accountID, existingAccount.Email)
 	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
@@ -924,6 +997,129 @@ func (s *Server) handleAdminSettings(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	diskReserveMB := r.FormValue("disk_reserve_mb")
+	if diskReserveMB != "" {
+		if mb, err := strconv.Atoi(diskReserveMB); err == nil && mb >= 0 {
+			database.DB.SetConfigValue("disk_reserve_mb", diskReserveMB)
+		}
+	}
+
+	diskAlertMB := r.FormValue("disk_alert_mb")
+	if diskAlertMB != "" {
+		if mb, err := strconv.Atoi(diskAlertMB); err == nil && mb >= 0 {
+			database.DB.SetConfigValue("disk_alert_mb", diskAlertMB)
+		}
+	}
+
+	if r.FormValue("secure_delete_enabled") == "on" {
+		database.DB.SetConfigValue("secure_delete_enabled", "true")
+	} else {
+		database.DB.SetConfigValue("secure_delete_enabled", "false")
+	}
+
+	// Compression at rest applies to new uploads only
+	if r.FormValue("compression_at_rest") == "on" {
+		database.DB.SetConfigValue("compression_at_rest", "true")
+	} else {
+		database.DB.SetConfigValue("compression_at_rest", "false")
+	}
+
+	// Integrity scrubber settings (read by the scrubber on each pass)
+	if r.FormValue("integrity_scrub_enabled") == "on" {
+		database.DB.SetConfigValue("integrity_scrub_enabled", "true")
+	} else {
+		database.DB.SetConfigValue("integrity_scrub_enabled", "false")
+	}
+
+	integrityScrubRateMB := r.FormValue("integrity_scrub_rate_mb")
+	if integrityScrubRateMB != "" {
+		if rate, err := strconv.Atoi(integrityScrubRateMB); err == nil && rate > 0 {
+			database.DB.SetConfigValue("integrity_scrub_rate_mb", integrityScrubRateMB)
+		}
+	}
+
+	integrityReverifyDays := r.FormValue("integrity_reverify_days")
+	if integrityReverifyDays != "" {
+		if days, err := strconv.Atoi(integrityReverifyDays); err == nil && days > 0 {
+			database.DB.SetConfigValue("integrity_reverify_days", integrityReverifyDays)
+		}
+	}
+
+	// Download accounts must prove they own their email address before downloading
+	if r.FormValue("download_email_verification") == "on" {
+		database.DB.SetConfigValue(configDownloadEmailVerification, "true")
+	} else {
+		database.DB.SetConfigValue(configDownloadEmailVerification, "false")
+	}
+
+	// Lifecycle of dormant download accounts (0 turns a step off)
+	dormancyPolicy := cleanup.LoadDormancyPolicy()
+	if n, err := strconv.Atoi(r.FormValue("download_account_warn_days")); err == nil {
+		dormancyPolicy.WarnDays = n
+	}
+	if n, err := strconv.Atoi(r.FormValue("download_account_disable_days")); err == nil {
+		dormancyPolicy.DisableDays = n
+	}
+	if n, err := strconv.Atoi(r.FormValue("download_account_delete_days")); err == nil {
+		dormancyPolicy.DeleteDays = n
+	}
+	dormancyErr := dormancyPolicy.Save()
+
+	// Roles that must sign in with a passkey
+	passkeyPolicy := &passkey.Policy{
+		RequiredAdmin: r.FormValue("passkey_required_admin") == "on",
+		RequiredUser:  r.FormValue("passkey_required_user") == "on",
+	}
+	if err := passkeyPolicy.Save(); err != nil {
+		log.Printf("Error saving passkey policy: %v", err)
+	}
+
+	// Roles that must use two-factor authentication, and how long their members have to set it up
+	mfaPolicy := mfa.LoadPolicy()
+	if n, err := strconv.Atoi(r.FormValue("mfa_grace_period_days")); err == nil && n >= 0 {
+		mfaPolicy.GracePeriodDays = n
+	}
+	if n, err := strconv.Atoi(r.FormValue("mfa_reminder_interval_days")); err == nil && n >= 0 {
+		mfaPolicy.ReminderIntervalDays = n
+	}
+	if err := mfaPolicy.Save(); err != nil {
+		log.Printf("Error saving 2FA policy: %v", err)
+	}
+	if admin, ok := userFromContext(r.Context()); ok {
+		saveMFARequiredRoles(r, admin)
+	}
+
+	// Password policy for users and download accounts
+	passwordPolicy := passwords.LoadPolicy()
+	if n, err := strconv.Atoi(r.FormValue("password_min_length")); err == nil {
+		passwordPolicy.MinLength = n
+	}
+	if n, err := strconv.Atoi(r.FormValue("password_history_count")); err == nil {
+		passwordPolicy.HistoryCount = n
+	}
+	if n, err := strconv.Atoi(r.FormValue("password_max_age_days")); err == nil {
+		passwordPolicy.MaxAgeDays = n
+	}
+	passwordPolicy.RequireUpper = r.FormValue("password_require_upper") == "on"
+	passwordPolicy.RequireLower = r.FormValue("password_require_lower") == "on"
+	passwordPolicy.RequireDigit = r.FormValue("password_require_digit") == "on"
+	passwordPolicy.RequireSymbol = r.FormValue("password_require_symbol") == "on"
+	passwordPolicy.BreachList = r.FormValue("password_breach_list")
+	if err := passwordPolicy.Save(); err != nil {
+		log.Printf("Error saving password policy: %v", err)
+	}
+
+	// Sensitive actions that need a recent authentication
+	saveSudoPolicy(r)
+
+	// Session lifetimes and idle timeouts, globally and per role
+	if admin, ok := userFromContext(r.Context()); ok {
+		saveSessionPolicy(r, admin)
+	}
+
+	// Emails about sign-ins from new devices and countries
+	saveLoginAlertPolicy(r)
+
 	// Handle dashboard style preference
 	dashboardStyle := r.FormValue("dashboard_style")
 	if dashboardStyle == "on" {
@@ -948,7 +1144,9 @@ func (s *Server) handleAdminSettings(w http.ResponseWriter, r *http.Request) {
 	})
 
 	// Show appropriate success message
-	if portChanged {
+	if dormancyErr != nil {
+		s.renderAdminSettings(w, "Error: Download account lifecycle not saved: "+dormancyErr.Error())
+	} else if portChanged {
 		s.renderAdminSettings(w, fmt.Sprintf("Port changed to %s. ⚠️ RESTART REQUIRED: Stop and start the server for changes to take effect.", port))
 	} else {
 		s.renderAdminSettings(w, "Settings updated successfully!")
@@ -1000,11 +1198,15 @@ func (s *Server) handleAdminPermanentDelete(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	// Delete from disk
-	filePath := filepath.Join(s.config.UploadsDir, fileID)
-	if err := os.Remove(filePath); err != nil {
-		if !os.IsNotExist(err) {
-			log.Printf("Warning: Could not delete file from disk: %v", err)
+	user, _ := userFromContext(r.Context())
+
+	// Delete from disk (overwritten first when secure deletion is enabled)
+	cert, err := storage.RemoveBlob(s.config.UploadsDir, fileInfo, user.Email)
+	if err != nil {
+		log.Printf("Warning: Could not delete file from disk: %v", err)
+		if storage.SecureDeleteEnabled() {
+			s.sendError(w, http.StatusInternalServerError, "Secure deletion failed, file kept in trash")
+			return
 		}
 	}
 
@@ -1016,8 +1218,11 @@ func (s *Server) handleAdminPermanentDelete(w http.ResponseWriter, r *http.Reque
 
 	log.Printf("File permanently deleted by admin: %s (ID: %s)", fileInfo.Name, fileID)
 
+	if cert != nil {
+		storage.AuditDestruction(cert, int64(user.Id), user.Email, getClientIP(r), r.UserAgent())
+	}
+
 	// Log the action
-	user, _ := userFromContext(r.Context())
 	database.DB.LogAction(&database.AuditLogEntry{
 		UserID:     int64(user.Id),
 		UserEmail:  user.Email,
@@ -1030,9 +1235,13 @@ func (s *Server) handleAdminPermanentDelete(w http.ResponseWriter, r *http.Reque
 		Success:    true,
 	})
 
-	s.sendJSON(w, http.StatusOK, map[string]string{
+	response := map[string]string{
 		"message": "File permanently deleted",
-	})
+	}
+	if cert != nil {
+		response["certificate_id"] = cert.Id
+	}
+	s.sendJSON(w, http.StatusOK, response)
 }
 
 // handleAdminRestoreFile restores a file from trash
@@ -1474,7 +1683,7 @@ func (s *Server) renderAdminDashboard(w http.ResponseWriter, user *models.User,
                 <div class="stat-number text-5xl font-extrabold mb-3">` + fmt.Sprintf("%.1f", avgBackupCodes) + `</div>
                 <p class="text-sm text-slate-600 font-medium">Average per user with 2FA enabled</p>
             </div>
-        </div>
+        </div>` + mfaComplianceHTML() + `
 
         <!-- File Statistics -->
         <h2 class="section-title text-3xl mb-8">📁 File Statistics</h2>
@@ -1552,7 +1761,7 @@ func (s *Server) renderAdminDashboard(w http.ResponseWriter, user *models.User,
 	w.Write([]byte(html))
 }
 
-func (s *Server) renderAdminUsers(w http.ResponseWriter, users []*models.User, downloadAccounts []*models.DownloadAccount,
+func (s *Server) renderAdminUsers(w http.ResponseWriter, admin *models.User, users []*models.User, downloadAccounts []*models.DownloadAccount,
 	userFilter *database.UserFilter, userCount int, dlFilter *database.DownloadAccountFilter, dlCount int) {
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 
@@ -1619,6 +1828,7 @@ func (s *Server) renderAdminUsers(w http.ResponseWriter, users []*models.User, d
         .badge-admin { background: #e3f2fd; color: #1976d2; }
         .badge-user { background: #f3e5f5; color: #7b1fa2; }
         .badge-download { background: #fff3e0; color: #e65100; }
+        .badge-locked { background: #ffebee; color: #c62828; }
         .action-links a {
             margin-right: 12px;
             color: ` + s.getPrimaryColor() + `;
@@ -1880,7 +2090,7 @@ func (s *Server) renderAdminUsers(w http.ResponseWriter, users []*models.User, d
                 <tr>
                     <th>Name</th>
                     <th>Email</th>
-                    <th>Level</th>
+                    <th>Role</th>
                     <th>Quota</th>
                     <th>Used</th>
                     <th>Status</th>
@@ -1889,32 +2099,78 @@ func (s *Server) renderAdminUsers(w http.ResponseWriter, users []*models.User, d
             </thead>
             <tbody>`
 
+	locks := activeLockouts()
+	passkeyCounts, err := database.DB.GetWebAuthnCredentialCounts()
+	if err != nil {
+		log.Printf("Warning: Failed to count passkeys: %v", err)
+	}
+	sessionCounts, err := database.DB.CountActiveSessions()
+	if err != nil {
+		log.Printf("Warning: Failed to count sessions: %v", err)
+	}
+
+	userRoleIds, err := database.DB.GetUserRoleIds()
+	if err != nil {
+		log.Printf("Warning: Failed to fetch user roles: %v", err)
+	}
+	roleNames := map[int]string{}
+	if roles, err := database.DB.GetAllRoles(); err == nil {
+		for _, role := range roles {
+			roleNames[role.Id] = role.Name
+		}
+	}
+
 	// Regular users
 	for _, u := range users {
-		levelBadge := `<span class="badge badge-user">User</span>`
-		if u.UserLevel == models.UserLevelAdmin || u.UserLevel == models.UserLevelSuperAdmin {
-			levelBadge = `<span class="badge badge-admin">Admin</span>`
+		badgeClass := "badge-user"
+		if u.IsAdmin() {
+			badgeClass = "badge-admin"
+		}
+		roleName := roleNames[userRoleIds[u.Id]]
+		if u.IsSuperAdmin() {
+			roleName = "Super Admin"
 		}
+		levelBadge := `<span class="badge ` + badgeClass + `">` + template.HTMLEscapeString(roleName) + `</span>`
 
 		status := "Active"
 		if !u.IsActive {
 			status = "Inactive"
 		}
 
+		unlockLink := ""
+		if locks[auth.AccountLockKey(u.Email)] != nil || locks[auth.TOTPLockKey(u.Id)] != nil {
+			status += ` <span class="badge badge-locked">🔒 Locked</span>`
+			unlockLink = fmt.Sprintf(`<a href="#" onclick="unlockLogin('user_id=%d'); return false;">Unlock</a>`, u.Id)
+		}
+		if n := passkeyCounts[u.Id]; n > 0 {
+			unlockLink += fmt.Sprintf(`
+                        <a href="#" onclick="resetPasskeys(%d, %d); return false;" title="Remove all passkeys of this user">Reset Passkeys</a>`, u.Id, n)
+		}
+		if n := sessionCounts[u.Id]; n > 0 {
+			unlockLink += fmt.Sprintf(`
+                        <a href="#" onclick="showSessions(%d); return false;" title="View and revoke signed-in sessions">Sessions (%d)</a>`, u.Id, n)
+		}
+		if admin.IsSuperAdmin() && u.IsActive && !u.IsSuperAdmin() && u.Id != admin.Id {
+			unlockLink += fmt.Sprintf(`
+                        <a href="#" onclick="showImpersonate(%d, '%s'); return false;" title="See the app exactly as this user sees it">View as User</a>`,
+				u.Id, template.JSEscapeString(u.Email))
+		}
+
 		html += fmt.Sprintf(`
                 <tr>
                     <td data-label="Name">%s</td>
                     <td data-label="Email">%s</td>
-                    <td data-label="Level">%s</td>
+                    <td data-label="Role">%s</td>
                     <td data-label="Quota">%d GB</td>
                     <td data-label="Used">%d MB</td>
                     <td data-label="Status">%s</td>
                     <td data-label="Actions" class="action-links">
                         <a href="/admin/users/edit?id=%d">Edit</a>
+                        %s
                         <a href="#" onclick="deleteUser(%d); return false;">Delete</a>
                     </td>
                 </tr>`,
-			u.Name, u.Email, levelBadge, u.StorageQuotaMB/1000, u.StorageUsedMB, status, u.Id, u.Id)
+			u.Name, u.Email, levelBadge, u.StorageQuotaMB/1000, u.StorageUsedMB, status, u.Id, unlockLink, u.Id)
 	}
 
 	html += `
@@ -2022,6 +2278,12 @@ func (s *Server) renderAdminUsers(w http.ResponseWriter, users []*models.User, d
 			lastUsed = time.Unix(da.LastUsed, 0).Format("2006-01-02 15:04")
 		}
 
+		unlockLink := ""
+		if lockKey := auth.AccountLockKey(da.Email); locks[lockKey] != nil {
+			status += ` <span class="badge badge-locked">🔒 Locked</span>`
+			unlockLink = `<a href="#" onclick="unlockLogin('key=` + url.QueryEscape(lockKey) + `'); return false;">Unlock</a>`
+		}
+
 		html += fmt.Sprintf(`
                 <tr>
                     <td data-label="Name">%s</td>
@@ -2033,6 +2295,7 @@ func (s *Server) renderAdminUsers(w http.ResponseWriter, users []*models.User, d
                     <td data-label="Actions" class="action-links">
                         <a href="/admin/download-accounts/edit?id=%d">Edit</a>
                         <a href="#" onclick="toggleDownloadAccount(%d, %t); return false;">%s</a>
+                        %s
                         <a href="#" onclick="deleteDownloadAccount(%d); return false;">Delete</a>
                     </td>
                 </tr>`,
@@ -2043,7 +2306,7 @@ func (s *Server) renderAdminUsers(w http.ResponseWriter, users []*models.User, d
 					return "Deactivate"
 				}
 				return "Activate"
-			}(), da.Id)
+			}(), unlockLink, da.Id)
 	}
 
 	html += `
@@ -2078,6 +2341,63 @@ func (s *Server) renderAdminUsers(w http.ResponseWriter, users []*models.User, d
 	}() + `>Next</button>
             </div>
         </div>
+` + renderLockoutsTable(locks) + `
+    </div>
+
+    <!-- Sessions Modal -->
+    <div id="sessionsModal" style="display: none; position: fixed; top: 0; left: 0; right: 0; bottom: 0; background: rgba(0,0,0,0.5); z-index: 1000; align-items: center; justify-content: center;">
+        <div style="background: white; padding: 40px; border-radius: 12px; max-width: 900px; width: 90%; max-height: 80vh; overflow-y: auto;">
+            <h2 style="margin-bottom: 24px; color: #333;">🖥️ Active Sessions</h2>
+            <p id="sessionsUser" style="color: #666; font-weight: 600;"></p>
+
+            <div id="sessionsContent" style="margin-top: 20px;">
+                <p style="text-align: center; color: #999;">Loading...</p>
+            </div>
+
+            <div style="display: flex; gap: 12px; margin-top: 24px;">
+                <button onclick="revokeSession(document.getElementById('sessionsModal').dataset.userId, '')" style="flex: 1; padding: 14px; background: #f44336; color: white; border: none; border-radius: 6px; font-weight: 600; cursor: pointer;">
+                    Revoke All Sessions
+                </button>
+                <button onclick="closeSessionsModal()" style="flex: 1; padding: 14px; background: #e0e0e0; color: #333; border: none; border-radius: 6px; font-weight: 600; cursor: pointer;">
+                    Close
+                </button>
+            </div>
+        </div>
+    </div>
+
+    <!-- View as User Modal -->
+    <div id="impersonateModal" style="display: none; position: fixed; top: 0; left: 0; right: 0; bottom: 0; background: rgba(0,0,0,0.5); z-index: 1000; align-items: center; justify-content: center;">
+        <div style="background: white; padding: 40px; border-radius: 12px; max-width: 560px; width: 90%;">
+            <h2 style="margin-bottom: 12px; color: #333;">👁️ View as User</h2>
+            <p id="impersonateUser" style="color: #666; font-weight: 600;"></p>
+            <p style="color: #666; margin-top: 12px; font-size: 14px;">You will see the app exactly as this user does until you stop or the time runs out. Every page you open is recorded in the audit log under your name and theirs, and the user can see that you viewed their account.</p>
+
+            <div class="form-group" style="margin-top: 20px;">
+                <label for="impersonateReason">Reason</label>
+                <textarea id="impersonateReason" rows="3" maxlength="500" placeholder="e.g. Ticket #1234: team files not showing" style="width: 100%; padding: 10px; border: 1px solid #ddd; border-radius: 6px;"></textarea>
+            </div>
+            <div class="form-group" style="margin-top: 12px;">
+                <label for="impersonateMinutes">Duration</label>
+                <select id="impersonateMinutes" style="width: 100%; padding: 10px; border: 1px solid #ddd; border-radius: 6px;">
+                    <option value="15">15 minutes</option>
+                    <option value="30" selected>30 minutes</option>
+                    <option value="60">60 minutes</option>
+                </select>
+            </div>
+            <label style="display: flex; align-items: center; gap: 8px; margin-top: 12px; color: #333;">
+                <input type="checkbox" id="impersonateAllowChanges">
+                Allow changes (uploads, deletions and edits as the user)
+            </label>
+
+            <div style="display: flex; gap: 12px; margin-top: 24px;">
+                <button onclick="startImpersonation()" style="flex: 1; padding: 14px; background: #b71c1c; color: white; border: none; border-radius: 6px; font-weight: 600; cursor: pointer;">
+                    Start Viewing
+                </button>
+                <button onclick="document.getElementById('impersonateModal').style.display = 'none'" style="flex: 1; padding: 14px; background: #e0e0e0; color: #333; border: none; border-radius: 6px; font-weight: 600; cursor: pointer;">
+                    Cancel
+                </button>
+            </div>
+        </div>
     </div>
 
     <script>
@@ -2133,6 +2453,145 @@ func (s *Server) renderAdminUsers(w http.ResponseWriter, users []*models.User, d
             }
         }
 
+        function unlockLogin(params) {
+            if (!confirm('Lift this lockout and reset its failed attempts?')) return;
+
+            fetch('/admin/users/unlock', {
+                method: 'POST',
+                headers: {'Content-Type': 'application/x-www-form-urlencoded'},
+                body: params
+            })
+            .then(() => window.location.reload())
+            .catch(err => alert('Error lifting lockout'));
+        }
+
+        function resetPasskeys(userId, count) {
+            if (!confirm('Remove all ' + count + ' passkey(s) of this user? Use this when a user has lost their authenticators.')) return;
+
+            fetch('/admin/users/passkeys/reset', {
+                method: 'POST',
+                headers: {'Content-Type': 'application/x-www-form-urlencoded'},
+                body: 'user_id=' + userId
+            })
+            .then(() => window.location.reload())
+            .catch(err => alert('Error resetting passkeys'));
+        }
+
+        function escapeHTML(text) {
+            const div = document.createElement('div');
+            div.textContent = text || '';
+            return div.innerHTML;
+        }
+
+        function showSessions(userId) {
+            document.getElementById('sessionsModal').style.display = 'flex';
+            document.getElementById('sessionsModal').dataset.userId = userId;
+            document.getElementById('sessionsUser').textContent = '';
+            document.getElementById('sessionsContent').innerHTML = '<p style="text-align: center; color: #999;">Loading...</p>';
+
+            fetch('/admin/users/sessions?user_id=' + userId)
+                .then(response => response.json())
+                .then(data => {
+                    if (data.error) {
+                        document.getElementById('sessionsContent').innerHTML = '<p style="text-align: center; color: #f44336;">' + escapeHTML(data.error) + '</p>';
+                        return;
+                    }
+                    document.getElementById('sessionsUser').textContent = data.user.name + ' (' + data.user.email + ')';
+
+                    if (!data.sessions || data.sessions.length === 0) {
+                        document.getElementById('sessionsContent').innerHTML = '<p style="text-align: center; color: #999;">No active sessions</p>';
+                        return;
+                    }
+
+                    let html = '<table style="width: 100%; border-collapse: collapse;">';
+                    html += '<thead><tr style="background: #f5f5f5; border-bottom: 2px solid #ddd;">';
+                    html += '<th style="padding: 12px; text-align: left;">Device</th>';
+                    html += '<th style="padding: 12px; text-align: left;">IP Address</th>';
+                    html += '<th style="padding: 12px; text-align: left;">Signed In</th>';
+                    html += '<th style="padding: 12px; text-align: left;">Last Active</th>';
+                    html += '<th style="padding: 12px;"></th>';
+                    html += '</tr></thead><tbody>';
+
+                    data.sessions.forEach(sess => {
+                        const action = sess.current
+                            ? '<span style="color: #4caf50; font-weight: 600;">Your session</span>'
+                            : '<a href="#" onclick="revokeSession(' + userId + ', \'' + sess.id + '\'); return false;" style="color: #f44336;">Revoke</a>';
+                        html += '<tr style="border-bottom: 1px solid #eee;">';
+                        const viewer = sess.impersonated_by
+                            ? '<br><span style="color: #b71c1c; font-size: 12px;">Administrator view by ' + escapeHTML(sess.impersonated_by) + '</span>'
+                            : sess.remembered
+                            ? '<br><span style="color: #666; font-size: 12px;">Remembered device until ' + new Date(sess.valid_until * 1000).toLocaleString('sv-SE') + '</span>'
+                            : '';
+                        html += '<td style="padding: 12px;" title="' + escapeHTML(sess.user_agent) + '">' + escapeHTML(sess.device || 'Unknown device') + viewer + '</td>';
+                        html += '<td style="padding: 12px; font-family: monospace; font-size: 12px;">' + escapeHTML(sess.ip_address || 'N/A') + '</td>';
+                        html += '<td style="padding: 12px;">' + new Date(sess.created_at * 1000).toLocaleString('sv-SE') + '</td>';
+                        html += '<td style="padding: 12px;">' + new Date(sess.last_seen * 1000).toLocaleString('sv-SE') + '</td>';
+                        html += '<td style="padding: 12px;">' + action + '</td>';
+                        html += '</tr>';
+                    });
+
+                    html += '</tbody></table>';
+                    document.getElementById('sessionsContent').innerHTML = html;
+                })
+                .catch(error => {
+                    document.getElementById('sessionsContent').innerHTML = '<p style="text-align: center; color: #f44336;">Error loading sessions</p>';
+                });
+        }
+
+        function revokeSession(userId, id) {
+            const all = id === '';
+            if (!confirm(all ? 'Sign this user out of all sessions?' : 'Revoke this session?')) return;
+
+            fetch('/admin/users/sessions/revoke', {
+                method: 'POST',
+                headers: {'Content-Type': 'application/x-www-form-urlencoded'},
+                body: 'user_id=' + userId + '&id=' + encodeURIComponent(id)
+            })
+            .then(() => all ? window.location.reload() : showSessions(userId))
+            .catch(err => alert('Error revoking session'));
+        }
+
+        function showImpersonate(userId, email) {
+            document.getElementById('impersonateModal').dataset.userId = userId;
+            document.getElementById('impersonateUser').textContent = email;
+            document.getElementById('impersonateReason').value = '';
+            document.getElementById('impersonateAllowChanges').checked = false;
+            document.getElementById('impersonateModal').style.display = 'flex';
+        }
+
+        function startImpersonation() {
+            const reason = document.getElementById('impersonateReason').value.trim();
+            if (!reason) {
+                alert('Enter why you need to view the app as this user');
+                return;
+            }
+
+            fetch('/admin/users/impersonate', {
+                method: 'POST',
+                headers: {'Content-Type': 'application/x-www-form-urlencoded'},
+                body: new URLSearchParams({
+                    user_id: document.getElementById('impersonateModal').dataset.userId,
+                    reason: reason,
+                    minutes: document.getElementById('impersonateMinutes').value,
+                    allow_changes: document.getElementById('impersonateAllowChanges').checked
+                })
+            })
+            .then(response => response.json())
+            .then(data => {
+                if (data.success) {
+                    window.location.href = data.redirect;
+                } else {
+                    alert(data.error || 'Failed to start viewing as user');
+                }
+            })
+            .catch(err => alert('Error starting to view as user'));
+        }
+
+        function closeSessionsModal() {
+            document.getElementById('sessionsModal').style.display = 'none';
+            window.location.reload();
+        }
+
         function toggleDownloadAccount(id, isActive) {
             const action = isActive ? 'deactivate' : 'activate';
             if (!confirm('Are you sure you want to ' + action + ' this download account?')) return;
@@ -2204,13 +2663,23 @@ func (s *Server) renderAdminUserForm(w http.ResponseWriter, user *models.User, e
 	}
 
 	nameVal, emailVal, quotaVal := "", "", "5000"
-	userLevelVal := "2"
+	roleId := models.RoleIdUser
 
 	if isEdit {
 		nameVal = user.Name
 		emailVal = user.Email
 		quotaVal = fmt.Sprintf("%d", user.StorageQuotaMB)
-		userLevelVal = fmt.Sprintf("%d", user.UserLevel)
+		if id, err := database.DB.GetUserRoleId(user); err == nil {
+			roleId = id
+		}
+	}
+
+	roleField := `
+        <select name="role_id">` + roleOptionsHTML(roleId) + `
+        </select>`
+	if isEdit && user.IsSuperAdmin() {
+		roleField = `
+        <p style="margin: 8px 0;">Super Admin (always has every permission)</p>`
 	}
 
 	html += `
@@ -2252,21 +2721,7 @@ func (s *Server) renderAdminUserForm(w http.ResponseWriter, user *models.User, e
         <label>Storage Quota (MB):</label>
         <input type="number" name="quota_mb" value="` + quotaVal + `" required>
 
-        <label>User Level:</label>
-        <select name="user_level">
-            <option value="2"` + func() string {
-		if userLevelVal == "2" {
-			return " selected"
-		}
-		return ""
-	}() + `>Regular User</option>
-            <option value="1"` + func() string {
-		if userLevelVal == "1" {
-			return " selected"
-		}
-		return ""
-	}() + `>Admin</option>
-        </select>
+        <label>Role:</label>` + roleField + `
 
         <br><br>
         <label style="display: flex; align-items: center; cursor: pointer;">
@@ -2339,6 +2794,7 @@ func (s *Server) renderAdminFiles(w http.ResponseWriter, files []*database.FileI
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 
 	totalStorageGB := fmt.Sprintf("%.2f GB", float64(totalStorage)/(1024*1024*1024))
+	physicalStorageGB := fmt.Sprintf("%.2f GB", float64(calculatePhysicalStorage(files))/(1024*1024*1024))
 
 	html := `<!DOCTYPE html>
 <html lang="en">
@@ -2707,10 +3163,18 @@ func (s *Server) renderAdminFiles(w http.ResponseWriter, files []*database.FileI
                 <h3>Total Storage</h3>
                 <div class="value">` + totalStorageGB + `</div>
             </div>
+            <div class="stat-item">
+                <h3>Physical on Disk</h3>
+                <div class="value">` + physicalStorageGB + `</div>
+            </div>
             <div class="stat-item">
                 <h3>Total Downloads</h3>
                 <div class="value">` + fmt.Sprintf("%d", calculateTotalDownloads(files)) + `</div>
             </div>
+            <div class="stat-item">
+                <h3>Integrity Issues</h3>
+                <div class="value">` + fmt.Sprintf("%d", calculateIntegrityFailures(files)) + `</div>
+            </div>
         </div>
 
         <!-- Search and Sort Controls -->
@@ -2761,6 +3225,7 @@ func (s *Server) renderAdminFiles(w http.ResponseWriter, files []*database.FileI
 		if f.RequireAuth {
 			authBadge = ` <span class="badge badge-auth">🔒 Auth</span>`
 		}
+		authBadge += integrityBadge(f)
 
 		// Expiration info
 		expiryInfo := "Never"
@@ -2882,7 +3347,8 @@ func (s *Server) renderAdminFiles(w http.ResponseWriter, files []*database.FileI
             fetch('/file/downloads?file_id=' + encodeURIComponent(fileId))
                 .then(response => response.json())
                 .then(data => {
-                    if (data.logs && data.logs.length > 0) {
+                    const logs = data.downloadLogs || [];
+                    if (logs.length > 0) {
                         let html = '<table style="width: 100%; border-collapse: collapse;">';
                         html += '<thead><tr style="background: #f5f5f5; border-bottom: 2px solid #ddd;">';
                         html += '<th style="padding: 12px; text-align: left;">Date & Time</th>';
@@ -2890,22 +3356,23 @@ func (s *Server) renderAdminFiles(w http.ResponseWriter, files []*database.FileI
                         html += '<th style="padding: 12px; text-align: left;">IP Address</th>';
                         html += '</tr></thead><tbody>';
 
-                        data.logs.forEach(log => {
+                        logs.forEach(log => {
                             const date = new Date(log.downloadedAt * 1000);
                             const dateStr = date.toLocaleString('sv-SE');
                             const downloader = log.email || 'Anonymous';
                             const ip = log.ipAddress || 'N/A';
                             const authBadge = log.isAuthenticated ? ' <span style="background: #2196f3; color: white; padding: 2px 6px; border-radius: 3px; font-size: 11px;">🔒 Auth</span>' : '';
+                            const verifiedBadge = log.emailVerifiedAt ? '<div style="color: #16a34a; font-size: 12px; margin-top: 4px;">✓ Email verified ' + new Date(log.emailVerifiedAt * 1000).toLocaleString('sv-SE') + '</div>' : '';
 
                             html += '<tr style="border-bottom: 1px solid #eee;">';
                             html += '<td style="padding: 12px;">' + dateStr + '</td>';
-                            html += '<td style="padding: 12px;">' + downloader + authBadge + '</td>';
+                            html += '<td style="padding: 12px;">' + downloader + authBadge + verifiedBadge + '</td>';
                             html += '<td style="padding: 12px; font-family: monospace; font-size: 12px;">' + ip + '</td>';
                             html += '</tr>';
                         });
 
                         html += '</tbody></table>';
-                        html += '<p style="margin-top: 16px; color: #666; font-size: 14px;">Total downloads: ' + data.logs.length + '</p>';
+                        html += '<p style="margin-top: 16px; color: #666; font-size: 14px;">Total downloads: ' + logs.length + '</p>';
                         document.getElementById('downloadHistoryContent').innerHTML = html;
                     } else {
                         document.getElementById('downloadHistoryContent').innerHTML = '<p style="text-align: center; color: #999;">No downloads yet</p>';
@@ -3246,6 +3713,48 @@ func (s *Server) renderAdminSettings(w http.ResponseWriter, message string) {
 		}
 	}
 
+	diskReserve, diskAlert := storage.DiskSettings()
+
+	secureDeleteChecked := ""
+	if storage.SecureDeleteEnabled() {
+		secureDeleteChecked = "checked"
+	}
+
+	compressionAtRestChecked := ""
+	if storage.CompressionEnabled() {
+		compressionAtRestChecked = "checked"
+	}
+
+	// Get integrity scrubber settings
+	integritySettings := integrity.LoadSettings()
+	integrityScrubChecked := ""
+	if integritySettings.Enabled {
+		integrityScrubChecked = "checked"
+	}
+
+	passkeyPolicy := passkey.LoadPolicy()
+	passkeyAdminChecked, passkeyUserChecked := "", ""
+	if passkeyPolicy.RequiredAdmin {
+		passkeyAdminChecked = "checked"
+	}
+	if passkeyPolicy.RequiredUser {
+		passkeyUserChecked = "checked"
+	}
+
+	mfaPolicy := mfa.LoadPolicy()
+
+	passwordPolicy := passwords.LoadPolicy()
+	sudoPolicy := sudo.LoadPolicy()
+	sessionPolicy := sessionpolicy.LoadPolicy()
+	loginAlertPolicy := loginalerts.LoadPolicy()
+	dormancyPolicy := cleanup.LoadDormancyPolicy()
+	checkedIf := func(b bool) string {
+		if b {
+			return "checked"
+		}
+		return ""
+	}
+
 	// Get dashboard style preference
 	dashboardStyle, _ := database.DB.GetConfigValue("dashboard_style")
 	if dashboardStyle == "" {
@@ -3430,6 +3939,212 @@ func (s *Server) renderAdminSettings(w http.ResponseWriter, message string) {
                     <p class="help-text">Maximum database size for audit logs before automatic cleanup of oldest entries (default: 100 MB)</p>
                 </div>
 
+                <div class="form-group">
+                    <label for="disk_reserve_mb">Disk Space Reserve (MB)</label>
+                    <input type="number" id="disk_reserve_mb" name="disk_reserve_mb" value="` + strconv.FormatUint(diskReserve/(1024*1024), 10) + `" min="0" required>
+                    <p class="help-text">Uploads are refused (HTTP 507) if they would leave less than this much free space on the uploads or data volume (default: 1024 MB)</p>
+                </div>
+
+                <div class="form-group">
+                    <label for="disk_alert_mb">Low Disk Space Alert (MB)</label>
+                    <input type="number" id="disk_alert_mb" name="disk_alert_mb" value="` + strconv.FormatUint(diskAlert/(1024*1024), 10) + `" min="0" required>
+                    <p class="help-text">Administrators are emailed and /health reports degraded when free space drops below this level (default: 5120 MB)</p>
+                </div>
+
+                <div class="form-group">
+                    <label style="display: flex; align-items: center; cursor: pointer;">
+                        <input type="checkbox" id="secure_delete_enabled" name="secure_delete_enabled" ` + secureDeleteChecked + ` style="margin-right: 10px; width: 20px; height: 20px; cursor: pointer;">
+                        <span>Secure deletion of permanently deleted files</span>
+                    </label>
+                    <p class="help-text">Overwrites file content before removing it from disk and issues a signed destruction certificate per file (see Trash → Destruction certificates). Note: overwriting cannot guarantee erasure on SSDs or copy-on-write filesystems.</p>
+                </div>
+
+                <div class="form-group">
+                    <label style="display: flex; align-items: center; cursor: pointer;">
+                        <input type="checkbox" id="compression_at_rest" name="compression_at_rest" ` + compressionAtRestChecked + ` style="margin-right: 10px; width: 20px; height: 20px; cursor: pointer;">
+                        <span>Compress compressible files at rest</span>
+                    </label>
+                    <p class="help-text">New text, CSV, log and similar uploads are stored gzip-compressed. Images, video and archives are never compressed. Quotas are always charged on the original file size.</p>
+                </div>
+
+                <div class="form-group">
+                    <label style="display: flex; align-items: center; cursor: pointer;">
+                        <input type="checkbox" id="integrity_scrub_enabled" name="integrity_scrub_enabled" ` + integrityScrubChecked + ` style="margin-right: 10px; width: 20px; height: 20px; cursor: pointer;">
+                        <span>Enable background integrity scrubbing</span>
+                    </label>
+                    <p class="help-text">Periodically re-hashes stored files and alerts administrators if a file no longer matches its SHA1</p>
+                </div>
+
+                <div class="form-group">
+                    <label for="integrity_scrub_rate_mb">Integrity Scrub Rate (MB/s)</label>
+                    <input type="number" id="integrity_scrub_rate_mb" name="integrity_scrub_rate_mb" value="` + strconv.Itoa(integritySettings.RateMB) + `" min="1" max="1000" required>
+                    <p class="help-text">Maximum disk read rate used by the scrubber, to avoid slowing down uploads and downloads (default: 10 MB/s)</p>
+                </div>
+
+                <div class="form-group">
+                    <label for="integrity_reverify_days">Integrity Re-verification Interval (Days)</label>
+                    <input type="number" id="integrity_reverify_days" name="integrity_reverify_days" value="` + strconv.Itoa(integritySettings.ReverifyDays) + `" min="1" max="3650" required>
+                    <p class="help-text">How often each file is re-hashed (default: 30 days)</p>
+                </div>
+
+                <div class="form-group">
+                    <label style="display: flex; align-items: center; cursor: pointer;">
+                        <input type="checkbox" id="passkey_required_admin" name="passkey_required_admin" ` + passkeyAdminChecked + ` style="margin-right: 10px; width: 20px; height: 20px; cursor: pointer;">
+                        <span>Require passkeys for administrators</span>
+                    </label>
+                    <label style="display: flex; align-items: center; cursor: pointer; margin-top: 10px;">
+                        <input type="checkbox" id="passkey_required_user" name="passkey_required_user" ` + passkeyUserChecked + ` style="margin-right: 10px; width: 20px; height: 20px; cursor: pointer;">
+                        <span>Require passkeys for users</span>
+                    </label>
+                    <p class="help-text">Members of these roles must use a passkey or security key as their second factor; authenticator app codes are no longer accepted once they have one. Users without a passkey are asked to register one at their next sign-in. Users who sign in through OIDC single sign-on are exempt.</p>
+                </div>
+
+                <h3 style="margin: 30px 0 15px 0;">Mandatory Two-Factor Authentication</h3>
+
+                <div class="form-group">
+                    <label>Require 2FA for these roles</label>` + mfaRoleCheckboxesHTML() + `
+                    <p class="help-text">Members must set up an authenticator app or a passkey. An overview of who has done so is shown on the admin dashboard. Users who sign in through OIDC single sign-on are exempt.</p>
+                </div>
+
+                <div class="form-group">
+                    <label for="mfa_grace_period_days">Grace Period (Days)</label>
+                    <input type="number" id="mfa_grace_period_days" name="mfa_grace_period_days" value="` + strconv.Itoa(mfaPolicy.GracePeriodDays) + `" min="0" max="365" required>
+                    <p class="help-text">During the grace period users are taken to the 2FA setup at every sign-in. Afterwards they can only sign in to set it up (0 = right away, default: ` + strconv.Itoa(mfa.DefaultGracePeriodDays) + ` days)</p>
+                </div>
+
+                <div class="form-group">
+                    <label for="mfa_reminder_interval_days">Reminder Email Interval (Days)</label>
+                    <input type="number" id="mfa_reminder_interval_days" name="mfa_reminder_interval_days" value="` + strconv.Itoa(mfaPolicy.ReminderIntervalDays) + `" min="0" max="365" required>
+                    <p class="help-text">How often users who haven't set up 2FA are reminded by email (0 = never, default: ` + strconv.Itoa(mfa.DefaultReminderIntervalDays) + ` days)</p>
+                </div>
+
+                <h3 style="margin: 30px 0 15px 0;">Password Policy</h3>
+
+                <div class="form-group">
+                    <label for="password_min_length">Minimum Password Length</label>
+                    <input type="number" id="password_min_length" name="password_min_length" value="` + strconv.Itoa(passwordPolicy.MinLength) + `" min="` + strconv.Itoa(passwords.MinLengthFloor) + `" max="` + strconv.Itoa(passwords.MaxLength) + `" required>
+                    <p class="help-text">Applies to users and download accounts (default: 8 characters)</p>
+                </div>
+
+                <div class="form-group">
+                    <label style="display: flex; align-items: center; cursor: pointer;">
+                        <input type="checkbox" id="password_require_upper" name="password_require_upper" ` + checkedIf(passwordPolicy.RequireUpper) + ` style="margin-right: 10px; width: 20px; height: 20px; cursor: pointer;">
+                        <span>Require an uppercase letter</span>
+                    </label>
+                    <label style="display: flex; align-items: center; cursor: pointer; margin-top: 10px;">
+                        <input type="checkbox" id="password_require_lower" name="password_require_lower" ` + checkedIf(passwordPolicy.RequireLower) + ` style="margin-right: 10px; width: 20px; height: 20px; cursor: pointer;">
+                        <span>Require a lowercase letter</span>
+                    </label>
+                    <label style="display: flex; align-items: center; cursor: pointer; margin-top: 10px;">
+                        <input type="checkbox" id="password_require_digit" name="password_require_digit" ` + checkedIf(passwordPolicy.RequireDigit) + ` style="margin-right: 10px; width: 20px; height: 20px; cursor: pointer;">
+                        <span>Require a digit</span>
+                    </label>
+                    <label style="display: flex; align-items: center; cursor: pointer; margin-top: 10px;">
+                        <input type="checkbox" id="password_require_symbol" name="password_require_symbol" ` + checkedIf(passwordPolicy.RequireSymbol) + ` style="margin-right: 10px; width: 20px; height: 20px; cursor: pointer;">
+                        <span>Require a symbol</span>
+                    </label>
+                </div>
+
+                <div class="form-group">
+                    <label for="password_history_count">Password History</label>
+                    <input type="number" id="password_history_count" name="password_history_count" value="` + strconv.Itoa(passwordPolicy.HistoryCount) + `" min="0" max="` + strconv.Itoa(database.MaxPasswordHistory) + `" required>
+                    <p class="help-text">Number of previous passwords that cannot be reused (0 = disabled)</p>
+                </div>
+
+                <div class="form-group">
+                    <label for="password_max_age_days">Maximum Password Age (Days)</label>
+                    <input type="number" id="password_max_age_days" name="password_max_age_days" value="` + strconv.Itoa(passwordPolicy.MaxAgeDays) + `" min="0" required>
+                    <p class="help-text">Users and download accounts must change their password after this many days (0 = never). Users who sign in through OIDC or LDAP are exempt.</p>
+                </div>
+
+                <div class="form-group">
+                    <label for="password_breach_list">Breached Password List</label>
+                    <input type="text" id="password_breach_list" name="password_breach_list" value="` + template.HTMLEscapeString(passwordPolicy.BreachList) + `" placeholder="/data/pwned-passwords">
+                    <p class="help-text">Path to a local copy of the Have I Been Pwned SHA-1 list: a sorted HASH:COUNT file or a directory of range files. Leave empty to disable. Status: ` + template.HTMLEscapeString(passwords.BreachListStatus(passwordPolicy.BreachList)) + `</p>
+                </div>
+
+                <h3 style="margin: 30px 0 15px 0;">Re-authentication for Sensitive Actions</h3>
+
+                <div class="form-group">
+                    <label>Ask for the password and second factor again before</label>` + sudoActionCheckboxesHTML(sudoPolicy) + `
+                    <p class="help-text">Users who signed in or confirmed their identity within the time below are not asked again. Users who sign in through OIDC single sign-on confirm with their second factor, or sign in again. Requests made with an API key are not affected.</p>
+                </div>
+
+                <div class="form-group">
+                    <label for="sudo_duration_minutes">Re-authentication Lasts (Minutes)</label>
+                    <input type="number" id="sudo_duration_minutes" name="sudo_duration_minutes" value="` + strconv.Itoa(sudoPolicy.DurationMinutes) + `" min="1" max="` + strconv.Itoa(sudo.MaxDurationMinutes) + `" required>
+                    <p class="help-text">How long a confirmation counts as recent (default: ` + strconv.Itoa(sudo.DefaultDurationMinutes) + ` minutes)</p>
+                </div>
+
+                <h3 style="margin: 30px 0 15px 0;">Sessions</h3>
+
+                <div class="form-group">
+                    <label for="session_lifetime_hours">Session Lifetime (Hours)</label>
+                    <input type="number" id="session_lifetime_hours" name="session_lifetime_hours" value="` + strconv.Itoa(sessionPolicy.LifetimeHours) + `" min="1" max="` + strconv.Itoa(sessionpolicy.MaxLifetimeHours) + `" required>
+                    <p class="help-text">Users and download accounts are signed out this long after signing in (default: ` + strconv.Itoa(sessionpolicy.DefaultLifetimeHours) + ` hours)</p>
+                </div>
+
+                <div class="form-group">
+                    <label for="session_idle_minutes">Idle Timeout (Minutes)</label>
+                    <input type="number" id="session_idle_minutes" name="session_idle_minutes" value="` + strconv.Itoa(sessionPolicy.IdleMinutes) + `" min="0" max="` + strconv.Itoa(sessionpolicy.MaxIdleMinutes) + `" required>
+                    <p class="help-text">Users and download accounts are signed out after this long without activity, unless a transfer is running (0 = never, default: ` + strconv.Itoa(sessionpolicy.DefaultIdleMinutes) + ` minutes)</p>
+                </div>
+
+                <div class="form-group">
+                    <label for="session_remember_days">Remember Devices For (Days)</label>
+                    <input type="number" id="session_remember_days" name="session_remember_days" value="` + strconv.Itoa(sessionPolicy.RememberDays) + `" min="0" max="` + strconv.Itoa(sessionpolicy.MaxRememberDays) + `" required>
+                    <p class="help-text">Offers "Remember this device" on the login page. A remembered session lasts this long and doesn't time out when idle. Not offered to members of roles with their own limits below (0 = off).</p>
+                </div>
+
+                <div class="form-group">
+                    <label>Limits per Role</label>` + sessionRoleLimitsHTML() + `
+                    <p class="help-text">Leave empty to use the global settings above, e.g. give administrators shorter sessions. Changes apply to new sign-ins; idle timeouts apply right away.</p>
+                </div>
+
+                <h3 style="margin: 30px 0 15px 0;">Sign-In Alerts</h3>
+
+                <div class="form-group">
+                    <label style="display: flex; align-items: center; cursor: pointer;">
+                        <input type="checkbox" id="login_alerts_enabled" name="login_alerts_enabled" ` + checkedIf(loginAlertPolicy.Enabled) + ` style="margin-right: 10px; width: 20px; height: 20px; cursor: pointer;">
+                        <span>Email users when they sign in from a new device or country</span>
+                    </label>
+                    <p class="help-text">A device is the browser and platform together with the IP range (/24 for IPv4, /48 for IPv6). New devices are recorded in the audit log and each user's Security Activity either way. Requires a configured email provider.</p>
+                </div>
+
+                <div class="form-group">
+                    <label for="login_alerts_country_db">IP to Country Database</label>
+                    <input type="text" id="login_alerts_country_db" name="login_alerts_country_db" value="` + template.HTMLEscapeString(loginAlertPolicy.CountryDB) + `" placeholder="/data/dbip-country-lite.csv">
+                    <p class="help-text">Path to a local CSV of IP ranges ("start,end,country"), such as the free DB-IP IP to Country Lite or IP2Location LITE DB1 download. Leave empty to only alert on new devices. Status: ` + template.HTMLEscapeString(loginalerts.CountryDBStatus(loginAlertPolicy.CountryDB)) + `</p>
+                </div>
+
+                <h3 style="margin: 30px 0 15px 0;">Download Accounts</h3>
+
+                <div class="form-group">
+                    <label style="display: flex; align-items: center; cursor: pointer;">
+                        <input type="checkbox" id="download_email_verification" name="download_email_verification" ` + checkedIf(downloadEmailVerificationEnabled()) + ` style="margin-right: 10px; width: 20px; height: 20px; cursor: pointer;">
+                        <span>Require download accounts to verify their email address</span>
+                    </label>
+                    <p class="help-text">Before downloading a file that requires authentication, a download account is emailed a one-time code and link to prove it owns its email address. Requires a configured email provider.</p>
+                </div>
+
+                <div class="form-group">
+                    <label for="download_account_warn_days">Warn Unused Accounts After (days)</label>
+                    <input type="number" id="download_account_warn_days" name="download_account_warn_days" value="` + strconv.Itoa(dormancyPolicy.WarnDays) + `" min="0" required>
+                    <p class="help-text">Email download accounts that have not signed in or downloaded for this many days that they will be disabled or deleted (0 = never).</p>
+                </div>
+
+                <div class="form-group">
+                    <label for="download_account_disable_days">Disable Unused Accounts After (days)</label>
+                    <input type="number" id="download_account_disable_days" name="download_account_disable_days" value="` + strconv.Itoa(dormancyPolicy.DisableDays) + `" min="0" required>
+                    <p class="help-text">Deactivate download accounts unused for this many days (0 = never). Reactivating an account restarts its idle time.</p>
+                </div>
+
+                <div class="form-group">
+                    <label for="download_account_delete_days">Delete Unused Accounts After (days)</label>
+                    <input type="number" id="download_account_delete_days" name="download_account_delete_days" value="` + strconv.Itoa(dormancyPolicy.DeleteDays) + `" min="0" required>
+                    <p class="help-text">Delete and anonymize download accounts unused for this many days (0 = never). Each enabled step must come after the previous one. The cleanup scheduler applies these every 6 hours; <a href="/admin/download-accounts/lifecycle">preview the next run</a>.</p>
+                </div>
+
                 <div class="form-group">
                     <label style="display: flex; align-items: center; cursor: pointer;">
                         <input type="checkbox" id="dashboard_style" name="dashboard_style" ` + dashboardStyleChecked + ` style="margin-right: 10px; width: 20px; height: 20px; cursor: pointer;">
@@ -3690,6 +4405,7 @@ func (s *Server) renderAdminTrash(w http.ResponseWriter, files []*database.FileI
 
         <div class="info-box">
             ⚠️ Files in trash will be automatically deleted after ` + fmt.Sprintf("%d", s.config.TrashRetentionDays) + ` days. You can restore or permanently delete them here.
+            <a href="/admin/destruction-certificates" style="margin-left: 8px; color: #856404; font-weight: 600;">📜 Destruction certificates</a>
         </div>
 
         <div class="file-list">`
@@ -3818,6 +4534,43 @@ func (s *Server) renderAdminTrash(w http.ResponseWriter, files []*database.FileI
 	w.Write([]byte(html))
 }
 
+// calculatePhysicalStorage returns the bytes used on disk, accounting for files compressed at rest
+func calculatePhysicalStorage(files []*database.FileInfo) int64 {
+	var total int64
+	for _, f := range files {
+		total += f.PhysicalSize()
+	}
+	return total
+}
+
+func calculateIntegrityFailures(files []*database.FileInfo) int {
+	total := 0
+	for _, f := range files {
+		if f.IntegrityStatus == database.IntegrityStatusMismatch || f.IntegrityStatus == database.IntegrityStatusMissing {
+			total++
+		}
+	}
+	return total
+}
+
+// integrityBadge renders the result of the last background integrity check for a file
+func integrityBadge(f *database.FileInfo) string {
+	lastVerified := "never"
+	if f.LastVerifiedAt > 0 {
+		lastVerified = time.Unix(f.LastVerifiedAt, 0).Format("2006-01-02 15:04")
+	}
+
+	switch f.IntegrityStatus {
+	case database.IntegrityStatusOK:
+		return fmt.Sprintf(` <span class="badge" style="background: #e8f5e9; color: #2e7d32;" title="SHA1 verified %s">✔ Verified</span>`, lastVerified)
+	case database.IntegrityStatusMismatch:
+		return fmt.Sprintf(` <span class="badge" style="background: #ffebee; color: #c62828;" title="SHA1 mismatch detected %s">⚠️ Corrupted</span>`, lastVerified)
+	case database.IntegrityStatusMissing:
+		return fmt.Sprintf(` <span class="badge" style="background: #ffebee; color: #c62828;" title="File missing on disk, checked %s">⚠️ Missing</span>`, lastVerified)
+	}
+	return ""
+}
+
 func calculateTotalDownloads(files []*database.FileInfo) int {
 	total := 0
 	for _, f := range files {
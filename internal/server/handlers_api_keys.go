@@ -0,0 +1,330 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package server
+
+import (
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Frimurare/WulfVault/internal/auth"
+	"github.com/Frimurare/WulfVault/internal/database"
+	"github.com/Frimurare/WulfVault/internal/mfa"
+	"github.com/Frimurare/WulfVault/internal/models"
+)
+
+// apiPermissionNames maps the permission names used by the settings UI to permission bits
+var apiPermissionNames = map[string]models.ApiPermission{
+	"view":         models.ApiPermView,
+	"upload":       models.ApiPermUpload,
+	"delete":       models.ApiPermDelete,
+	"edit":         models.ApiPermEdit,
+	"replace":      models.ApiPermReplace,
+	"manage_users": models.ApiPermManageUsers,
+	"manage_logs":  models.ApiPermManageLogs,
+	"api_mod":      models.ApiPermApiMod,
+}
+
+// apiKeyUseAuditInterval is how long an API key has to be unused before its next
+// use is audited again
+const apiKeyUseAuditInterval = time.Hour
+
+// bearerToken returns the token from an "Authorization: Bearer" header.
+// API keys are only accepted on the REST API.
+func bearerToken(r *http.Request) (string, bool) {
+	if !strings.HasPrefix(r.URL.Path, "/api/v1/") {
+		return "", false
+	}
+
+	header := r.Header.Get("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "bearer ") {
+		return "", false
+	}
+
+	token := strings.TrimSpace(header[7:])
+	return token, token != ""
+}
+
+// serveWithAPIKey authenticates a REST request with an API key and enforces the
+// key's permissions for the requested endpoint. The permissions of the key owner's
+// role are checked on top of that by requirePermission.
+func (s *Server) serveWithAPIKey(w http.ResponseWriter, r *http.Request, token string, next http.HandlerFunc) {
+	user, key, err := auth.AuthenticateAPIKey(token)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="WulfVault"`)
+		s.sendError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	if required := requiredAPIPermission(r); !key.HasPermission(required) {
+		log.Printf("API key %s (%s) denied %s %s: missing permission", key.Id, user.Email, r.Method, r.URL.Path)
+		s.sendError(w, http.StatusForbidden, "API key lacks the required permission")
+		return
+	}
+
+	if mfa.Check(user).Status == mfa.StatusOverdue {
+		s.sendError(w, http.StatusForbidden, "The key's owner must set up two-factor authentication first")
+		return
+	}
+
+	// Uses are audited once per period of use so the owner can see them under
+	// Security Activity without every request ending up in the audit log
+	if time.Since(time.Unix(key.LastUsed, 0)) > apiKeyUseAuditInterval {
+		database.DB.LogAction(&database.AuditLogEntry{
+			UserID:     int64(user.Id),
+			UserEmail:  user.Email,
+			Action:     database.ActionAPIKeyUsed,
+			EntityType: database.EntityAPIKey,
+			EntityID:   key.Id,
+			Details: database.CreateAuditDetails(map[string]interface{}{
+				"name":    key.FriendlyName,
+				"request": r.Method + " " + r.URL.Path,
+			}),
+			IPAddress: getClientIP(r),
+			UserAgent: r.UserAgent(),
+			Success:   true,
+		})
+	}
+
+	ctx := contextWithUser(r.Context(), user)
+	ctx = contextWithAPIKey(ctx, key)
+	next(w, r.WithContext(ctx))
+}
+
+// requiredAPIPermission returns the permission an API key needs for a REST endpoint.
+// Endpoints not listed here require every permission.
+func requiredAPIPermission(r *http.Request) models.ApiPermission {
+	path := strings.TrimSuffix(r.URL.Path, "/")
+	read := r.Method == http.MethodGet || r.Method == http.MethodHead
+
+	switch {
+	case path == "/api/v1/upload":
+		return models.ApiPermUpload
+
+	case path == "/api/v1/files", path == "/api/v1/user/export-data", path == "/api/v1/admin/stats":
+		return models.ApiPermView
+
+	case strings.HasPrefix(path, "/api/v1/files/"):
+		switch {
+		case read:
+			return models.ApiPermView
+		case r.Method == http.MethodDelete:
+			return models.ApiPermDelete
+		default:
+			return models.ApiPermEdit
+		}
+
+	case strings.HasPrefix(path, "/api/v1/file-requests"):
+		switch {
+		case read:
+			return models.ApiPermView
+		case r.Method == http.MethodDelete:
+			return models.ApiPermDelete
+		default:
+			return models.ApiPermEdit
+		}
+
+	case strings.HasPrefix(path, "/api/v1/trash"):
+		if strings.HasSuffix(path, "/restore") {
+			return models.ApiPermEdit
+		}
+		if read {
+			return models.ApiPermView
+		}
+		return models.ApiPermDelete
+
+	case strings.HasPrefix(path, "/api/v1/users"), strings.HasPrefix(path, "/api/v1/download-accounts"),
+		strings.HasPrefix(path, "/api/v1/roles"):
+		return models.ApiPermManageUsers
+
+	case strings.HasPrefix(path, "/api/v1/admin/audit-logs"):
+		return models.ApiPermManageLogs
+
+	case path == "/api/v1/admin/branding", path == "/api/v1/admin/settings":
+		if read {
+			return models.ApiPermView
+		}
+		return models.ApiPermApiMod
+	}
+
+	return models.ApiPermAll
+}
+
+// handleAPIKeysList returns the current user's API keys (without secrets)
+// GET /settings/api-keys
+func (s *Server) handleAPIKeysList(w http.ResponseWriter, r *http.Request) {
+	user, ok := userFromContext(r.Context())
+	if !ok {
+		s.sendError(w, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+
+	keys, err := database.DB.GetApiKeysByUser(user.Id)
+	if err != nil {
+		log.Printf("Error fetching API keys for user %d: %v", user.Id, err)
+		s.sendError(w, http.StatusInternalServerError, "Failed to fetch API keys")
+		return
+	}
+
+	var keyList []map[string]interface{}
+	for _, k := range keys {
+		keyList = append(keyList, apiKeyToJSON(k))
+	}
+
+	s.sendJSON(w, http.StatusOK, map[string]interface{}{
+		"keys":  keyList,
+		"total": len(keyList),
+	})
+}
+
+// handleAPIKeyCreate creates a new API key for the current user.
+// The token is returned once and cannot be retrieved again.
+// POST /settings/api-keys/create
+func (s *Server) handleAPIKeyCreate(w http.ResponseWriter, r *http.Request) {
+	user, ok := userFromContext(r.Context())
+	if !ok {
+		s.sendError(w, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		s.sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		s.sendError(w, http.StatusBadRequest, "Invalid form data")
+		return
+	}
+
+	name := strings.TrimSpace(r.FormValue("name"))
+	if name == "" {
+		s.sendError(w, http.StatusBadRequest, "Name is required")
+		return
+	}
+	if len(name) > 100 {
+		s.sendError(w, http.StatusBadRequest, "Name is too long")
+		return
+	}
+
+	var permissions models.ApiPermission
+	for _, p := range r.Form["permissions"] {
+		bit, ok := apiPermissionNames[p]
+		if !ok {
+			s.sendError(w, http.StatusBadRequest, "Unknown permission: "+p)
+			return
+		}
+		permissions |= bit
+	}
+	if permissions == models.ApiPermNone {
+		s.sendError(w, http.StatusBadRequest, "Select at least one permission")
+		return
+	}
+
+	var expiry int64
+	if days := r.FormValue("expiry_days"); days != "" && days != "0" {
+		d, err := strconv.Atoi(days)
+		if err != nil || d < 0 || d > 3650 {
+			s.sendError(w, http.StatusBadRequest, "Invalid expiry")
+			return
+		}
+		expiry = time.Now().AddDate(0, 0, d).Unix()
+	}
+
+	key, token, err := auth.CreateAPIKey(user.Id, name, permissions, expiry)
+	if err != nil {
+		log.Printf("Error creating API key for user %d: %v", user.Id, err)
+		s.sendError(w, http.StatusInternalServerError, "Failed to create API key")
+		return
+	}
+
+	database.DB.LogAction(&database.AuditLogEntry{
+		UserID:     int64(user.Id),
+		UserEmail:  user.Email,
+		Action:     database.ActionAPIKeyCreated,
+		EntityType: database.EntityAPIKey,
+		EntityID:   key.Id,
+		Details: database.CreateAuditDetails(map[string]interface{}{
+			"name":        key.FriendlyName,
+			"permissions": int(key.Permissions),
+			"expiry":      key.Expiry,
+		}),
+		IPAddress: getClientIP(r),
+		UserAgent: r.UserAgent(),
+		Success:   true,
+	})
+
+	result := apiKeyToJSON(key)
+	result["token"] = token
+	s.sendJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"key":     result,
+	})
+}
+
+// handleAPIKeyRevoke revokes one of the current user's API keys
+// POST /settings/api-keys/revoke
+func (s *Server) handleAPIKeyRevoke(w http.ResponseWriter, r *http.Request) {
+	user, ok := userFromContext(r.Context())
+	if !ok {
+		s.sendError(w, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		s.sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	keyId := r.FormValue("id")
+	if err := database.DB.DeleteApiKey(keyId, user.Id); err != nil {
+		s.sendError(w, http.StatusNotFound, "API key not found")
+		return
+	}
+
+	database.DB.LogAction(&database.AuditLogEntry{
+		UserID:     int64(user.Id),
+		UserEmail:  user.Email,
+		Action:     database.ActionAPIKeyRevoked,
+		EntityType: database.EntityAPIKey,
+		EntityID:   keyId,
+		Details: database.CreateAuditDetails(map[string]interface{}{
+			"prefix": auth.APIKeyPrefix + keyId,
+		}),
+		IPAddress: getClientIP(r),
+		UserAgent: r.UserAgent(),
+		Success:   true,
+	})
+
+	s.sendJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+	})
+}
+
+// apiKeyToJSON formats an API key for the settings page
+func apiKeyToJSON(k *models.ApiKey) map[string]interface{} {
+	var permissions []string
+	for name, bit := range apiPermissionNames {
+		if k.HasPermission(bit) {
+			permissions = append(permissions, name)
+		}
+	}
+	sort.Strings(permissions)
+
+	return map[string]interface{}{
+		"id":          k.Id,
+		"name":        k.FriendlyName,
+		"prefix":      auth.APIKeyPrefix + k.Id,
+		"permissions": permissions,
+		"created_at":  k.CreatedAt,
+		"last_used":   k.LastUsed,
+		"expiry":      k.Expiry,
+		"expired":     k.IsExpired(),
+	}
+}
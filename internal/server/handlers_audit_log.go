@@ -39,6 +39,7 @@ func (s *Server) handleAPIGetAuditLogs(w http.ResponseWriter, r *http.Request) {
 
 	filter.Action = r.URL.Query().Get("action")
 	filter.EntityType = r.URL.Query().Get("entity_type")
+	filter.EntityID = r.URL.Query().Get("entity_id")
 	filter.SearchTerm = r.URL.Query().Get("search")
 
 	if startDateStr := r.URL.Query().Get("start_date"); startDateStr != "" {
@@ -113,6 +114,7 @@ func (s *Server) handleAPIExportAuditLogs(w http.ResponseWriter, r *http.Request
 
 	filter.Action = r.URL.Query().Get("action")
 	filter.EntityType = r.URL.Query().Get("entity_type")
+	filter.EntityID = r.URL.Query().Get("entity_id")
 	filter.SearchTerm = r.URL.Query().Get("search")
 
 	if startDateStr := r.URL.Query().Get("start_date"); startDateStr != "" {
@@ -161,6 +163,8 @@ func (s *Server) handleAPIExportAuditLogs(w http.ResponseWriter, r *http.Request
 		"User Agent",
 		"Success",
 		"Error Message",
+		"Impersonator ID",
+		"Impersonator Email",
 	})
 
 	// Write data rows
@@ -185,6 +189,8 @@ func (s *Server) handleAPIExportAuditLogs(w http.ResponseWriter, r *http.Request
 			entry.UserAgent,
 			successStr,
 			entry.ErrorMsg,
+			fmt.Sprintf("%d", entry.ImpersonatorID),
+			entry.ImpersonatorEmail,
 		})
 	}
 }
@@ -509,6 +515,7 @@ func (s *Server) renderAdminAuditLogsPage(w http.ResponseWriter) {
                         <option value="LOGOUT">Logout</option>
                         <option value="FILE_UPLOADED">File Uploaded</option>
                         <option value="FILE_DOWNLOADED">File Downloaded</option>
+                        <option value="FILE_DOWNLOAD_REJECTED">File Download Rejected (Not a Recipient)</option>
                         <option value="FILE_DELETED">File Deleted</option>
                         <option value="FILE_RESTORED">File Restored</option>
                         <option value="FILE_PERMANENTLY_DELETED">File Permanently Deleted</option>
@@ -517,12 +524,31 @@ func (s *Server) renderAdminAuditLogsPage(w http.ResponseWriter) {
                         <option value="USER_DELETED">User Deleted</option>
                         <option value="USER_ACTIVATED">User Activated</option>
                         <option value="USER_DEACTIVATED">User Deactivated</option>
+                        <option value="USER_ROLE_CHANGED">User Role Changed</option>
+                        <option value="ROLE_CREATED">Role Created</option>
+                        <option value="ROLE_UPDATED">Role Updated</option>
+                        <option value="ROLE_DELETED">Role Deleted</option>
                         <option value="TEAM_CREATED">Team Created</option>
                         <option value="TEAM_MEMBER_ADDED">Team Member Added</option>
                         <option value="TEAM_MEMBER_REMOVED">Team Member Removed</option>
                         <option value="PASSWORD_CHANGED">Password Changed</option>
                         <option value="2FA_ENABLED">2FA Enabled</option>
                         <option value="2FA_DISABLED">2FA Disabled</option>
+                        <option value="PASSWORD_RESET_REQUESTED">Password Reset Requested</option>
+                        <option value="PASSWORD_RESET_COMPLETED">Password Reset Completed</option>
+                        <option value="NEW_DEVICE_LOGIN">Sign-In from New Device</option>
+                        <option value="API_KEY_USED">API Key Used</option>
+                        <option value="DOWNLOAD_ACCOUNT_CREATED">Download Account Created</option>
+                        <option value="DOWNLOAD_ACCOUNT_VERIFICATION_SENT">Download Account Verification Sent</option>
+                        <option value="DOWNLOAD_ACCOUNT_EMAIL_VERIFIED">Download Account Email Verified</option>
+                        <option value="DOWNLOAD_MAGIC_LINK_REQUESTED">Download Sign-In Link Requested</option>
+                        <option value="DOWNLOAD_MAGIC_LINK_USED">Download Sign-In Link Used</option>
+                        <option value="DOWNLOAD_ACCOUNT_DORMANCY_WARNED">Download Account Dormancy Warned</option>
+                        <option value="IMPERSONATION_STARTED">View as User Started</option>
+                        <option value="IMPERSONATION_ENDED">View as User Ended</option>
+                        <option value="IMPERSONATED_REQUEST">Request Made While Viewing as User</option>
+                        <option value="SUDO_GRANTED">Identity Confirmed for Sensitive Action</option>
+                        <option value="SUDO_FAILED">Identity Confirmation Failed</option>
                         <option value="SETTINGS_UPDATED">Settings Updated</option>
                     </select>
                 </div>
@@ -533,6 +559,7 @@ func (s *Server) renderAdminAuditLogsPage(w http.ResponseWriter) {
                         <option value="User">User</option>
                         <option value="File">File</option>
                         <option value="Team">Team</option>
+                        <option value="Role">Role</option>
                         <option value="Session">Session</option>
                         <option value="Settings">Settings</option>
                         <option value="System">System</option>
@@ -718,7 +745,7 @@ func (s *Server) renderAdminAuditLogsPage(w http.ResponseWriter) {
                 html += '<tr>' +
                     '<td>' + log.id + '</td>' +
                     '<td>' + formatTimestamp(log.timestamp) + '</td>' +
-                    '<td>' + log.user_email + '</td>' +
+                    '<td>' + log.user_email + (log.impersonator_email ? '<br><small>viewed by ' + log.impersonator_email + '</small>' : '') + '</td>' +
                     '<td><span class="badge ' + badgeClass + '">' + log.action + '</span></td>' +
                     '<td>' + log.entity_type + (log.entity_id ? ' #' + log.entity_id : '') + '</td>' +
                     '<td class="details-cell" title="' + log.details.replace(/"/g, '&quot;') + '" onclick="showDetails(\'' + log.details.replace(/'/g, "\\'") + '\')">' + log.details + '</td>' +
@@ -6,14 +6,14 @@
 package server
 
 import (
-	"encoding/base64"
-	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/Frimurare/WulfVault/internal/auth"
 	"github.com/Frimurare/WulfVault/internal/database"
+	"github.com/Frimurare/WulfVault/internal/sessionpolicy"
 )
 
 // handleLogin handles user and download account login
@@ -36,9 +36,22 @@ func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 
 	email := r.FormValue("email")
 	password := r.FormValue("password")
+	remember := r.FormValue("remember") == "1"
 
+	// Refuse locked accounts and addresses before checking the password
+	lockKeys := []string{loginAccountKey(email), s.ipLockKey(r)}
+	if until := auth.LockedUntil(lockKeys...); !until.IsZero() {
+		logLockedAttempt(r, email, "password", until)
+		s.renderLoginPage(w, r, auth.LockoutMessage(until))
+		return
+	}
+
+	// Directory users sign in with their LDAP password; everyone else is local.
 	// Try to authenticate as any account type (User or DownloadAccount)
-	authResult, err := auth.AuthenticateAnyAccount(email, password)
+	authResult, handled, err := s.authenticateDirectory(email, password, r)
+	if !handled {
+		authResult, err = auth.AuthenticateAnyAccount(email, password)
+	}
 	if err != nil {
 		// Log failed login attempt
 		database.DB.LogAction(&database.AuditLogEntry{
@@ -53,27 +66,50 @@ func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 			Success:    false,
 			ErrorMsg:   "Invalid credentials",
 		})
+		s.recordFailedAttempt(r, "password", accountOwnerEmail(email), lockKeys...)
 		s.renderLoginPage(w, r, "Invalid credentials")
 		return
 	}
+	auth.ClearFailures(lockKeys[0])
 
 	// Handle based on account type
 	if authResult.AccountType == auth.AccountTypeUser {
 		// Regular user login
 		user := authResult.User
 
-		// Check if 2FA is enabled for this user
-		if user.TOTPEnabled {
+		if localPasswordDisabled(user) {
+			database.DB.LogAction(&database.AuditLogEntry{
+				UserID:     int64(user.Id),
+				UserEmail:  user.Email,
+				Action:     "LOGIN_FAILED",
+				EntityType: "Session",
+				EntityID:   "",
+				Details:    fmt.Sprintf("{\"email\":\"%s\",\"success\":false,\"reason\":\"sso_required\"}", user.Email),
+				IPAddress:  getClientIP(r),
+				UserAgent:  r.UserAgent(),
+				Success:    false,
+				ErrorMsg:   "Local password disabled for SSO user",
+			})
+			s.renderLoginPage(w, r, "This account signs in with single sign-on")
+			return
+		}
+
+		// Check if 2FA (an authenticator app or a passkey) is enabled for this user
+		if user.TOTPEnabled || hasPasskeys(user.Id) {
 			// Store user ID in temporary cookie and redirect to 2FA verification
-			pendingData := map[string]interface{}{
-				"user_id":    user.Id,
-				"created_at": time.Now().Unix(),
+			pendingValue, err := encodePendingLogin(&pendingLogin{
+				UserID:    user.Id,
+				CreatedAt: time.Now().Unix(),
+				Remember:  remember,
+			})
+			if err != nil {
+				s.renderLoginPage(w, r, "Failed to start two-factor authentication")
+				return
 			}
-			pendingJSON, _ := json.Marshal(pendingData)
 
 			http.SetCookie(w, &http.Cookie{
 				Name:     "totp_pending",
-				Value:    base64.StdEncoding.EncodeToString(pendingJSON),
+				Value:    pendingValue,
 				Path:     "/",
 				Expires:  time.Now().Add(5 * time.Minute),
 				HttpOnly: true,
@@ -85,7 +121,11 @@ func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// No 2FA, create session directly
-		sessionID, err := auth.CreateSession(user.Id)
+		createSession := auth.CreateSession
+		if remember {
+			createSession = auth.CreateRememberedSession
+		}
+		sessionID, err := createSession(user.Id, getClientIP(r), r.UserAgent())
 		if err != nil {
 			s.renderLoginPage(w, r, "Failed to create session")
 			return
@@ -98,31 +138,25 @@ func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 			Action:     "LOGIN_SUCCESS",
 			EntityType: "Session",
 			EntityID:   sessionID,
-			Details:    fmt.Sprintf("{\"email\":\"%s\",\"success\":true}", user.Email),
+			Details:    fmt.Sprintf("{\"email\":\"%s\",\"success\":true,\"remembered\":%t}", user.Email, sessionRemembered(sessionID)),
 			IPAddress:  getClientIP(r),
 			UserAgent:  r.UserAgent(),
 			Success:    true,
 			ErrorMsg:   "",
 		})
 
+		s.checkLoginDevice(r, user)
+
 		// Set cookie
-		http.SetCookie(w, &http.Cookie{
-			Name:     "session",
-			Value:    sessionID,
-			Path:     "/",
-			Expires:  time.Now().Add(24 * time.Hour),
-			HttpOnly: true,
-			SameSite: http.SameSiteStrictMode,
-		})
+		setSessionCookie(w, sessionID, http.SameSiteStrictMode)
 
 		// Redirect
 		redirect := r.URL.Query().Get("redirect")
 		if redirect == "" {
-			if user.IsAdmin() {
-				redirect = "/admin"
-			} else {
-				redirect = "/dashboard"
-			}
+			redirect = homePath(user)
+		}
+		if setup, ok := mfaLoginRedirect(user); ok {
+			redirect = setup
 		}
 
 		http.Redirect(w, r, redirect, http.StatusSeeOther)
@@ -131,8 +165,8 @@ func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 		// Download account login
 		downloadAccount := authResult.DownloadAccount
 
-		// Create session (using email as session identifier)
-		sessionEmail, err := auth.CreateDownloadAccountSession(downloadAccount.Id)
+		// Create session
+		sessionID, err := auth.CreateDownloadAccountSession(downloadAccount.Id, getClientIP(r), r.UserAgent(), database.DownloadAuthPassword)
 		if err != nil {
 			s.renderLoginPage(w, r, "Failed to create session")
 			return
@@ -155,9 +189,9 @@ func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
 		// Set download account session cookie
 		http.SetCookie(w, &http.Cookie{
 			Name:     "download_session",
-			Value:    sessionEmail,
+			Value:    sessionID,
 			Path:     "/",
-			Expires:  time.Now().Add(24 * time.Hour),
+			Expires:  downloadSessionExpiry(),
 			HttpOnly: true,
 			SameSite: http.SameSiteLaxMode,
 		})
@@ -177,6 +211,16 @@ func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
 
 	// Get session cookie
 	cookie, err := r.Cookie("session")
+
+	// Signing out while viewing as another user returns the super admin to their own session
+	if err == nil {
+		if imp, _ := database.DB.GetSessionImpersonation(cookie.Value); imp != nil {
+			s.endImpersonation(w, r, cookie.Value, imp, "logout")
+			http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+			return
+		}
+	}
+
 	if err == nil {
 		// Try to get user from session before deleting it
 		if user, err := auth.GetUserBySession(cookie.Value); err == nil && user != nil {
@@ -216,6 +260,21 @@ func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/login", http.StatusSeeOther)
 }
 
+// rememberDeviceHTML returns the "Remember this device" checkbox of the login
+// form, or nothing if the session policy doesn't allow remembering devices
+func rememberDeviceHTML() string {
+	days := sessionpolicy.LoadPolicy().RememberDays
+	if days == 0 {
+		return ""
+	}
+	return `
+            <div class="form-group">
+                <label style="display: flex; align-items: center; gap: 8px; font-weight: normal; cursor: pointer;">
+                    <input type="checkbox" id="remember" name="remember" value="1"> Remember this device for ` + strconv.Itoa(days) + ` days
+                </label>
+            </div>`
+}
+
 // renderLoginPage renders the login page
 func (s *Server) renderLoginPage(w http.ResponseWriter, r *http.Request, errorMsg string) {
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
@@ -371,11 +430,14 @@ func (s *Server) renderLoginPage(w http.ResponseWriter, r *http.Request, errorMs
             <div class="form-group">
                 <label for="password">Password</label>
                 <input type="password" id="password" name="password" required>
-            </div>
+            </div>` + rememberDeviceHTML() + `
             <button type="submit" class="btn">Login</button>
         </form>
+` + s.getPasskeyLoginHTML(r) + s.getSSOButtonHTML(r) + `
         <div style="text-align: center; margin-top: 15px;">
             <a href="/forgot-password" style="color: ` + s.getPrimaryColor() + `; text-decoration: none; font-size: 14px;">Forgot Password?</a>
+            <span style="color: #ccc; margin: 0 6px;">|</span>
+            <a href="/download/magic-link" style="color: ` + s.getPrimaryColor() + `; text-decoration: none; font-size: 14px;">Download account? Email me a sign-in link</a>
         </div>
         <div class="footer">
             ` + s.config.FooterText + `
@@ -0,0 +1,250 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Frimurare/WulfVault/internal/database"
+	"github.com/Frimurare/WulfVault/internal/storage"
+)
+
+// destructionCertificateExport is the exported form of a certificate, including
+// the verification result at export time
+type destructionCertificateExport struct {
+	*database.DestructionCertificate
+	DestroyedAtISO string `json:"destroyed_at_iso"`
+	Issuer         string `json:"issuer"`
+	Verified       bool   `json:"verified"`
+}
+
+// handleAdminDestructionCertificates lists issued destruction certificates
+func (s *Server) handleAdminDestructionCertificates(w http.ResponseWriter, r *http.Request) {
+	certs, err := database.DB.GetDestructionCertificates(500)
+	if err != nil {
+		log.Printf("Error fetching destruction certificates: %v", err)
+		s.sendError(w, http.StatusInternalServerError, "Failed to fetch destruction certificates")
+		return
+	}
+
+	s.renderAdminDestructionCertificates(w, certs)
+}
+
+// handleAdminDestructionCertificateExport downloads a single certificate as JSON
+// GET /admin/destruction-certificates/export?id=<certificate id>
+func (s *Server) handleAdminDestructionCertificateExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	cert, err := database.DB.GetDestructionCertificate(r.URL.Query().Get("id"))
+	if err != nil {
+		s.sendError(w, http.StatusNotFound, "Certificate not found")
+		return
+	}
+
+	export := destructionCertificateExport{
+		DestructionCertificate: cert,
+		DestroyedAtISO:         time.Unix(cert.DestroyedAt, 0).UTC().Format(time.RFC3339),
+		Issuer:                 s.getPublicURL(),
+		Verified:               storage.VerifyCertificate(cert),
+	}
+
+	filename := fmt.Sprintf("destruction_certificate_%s.json", cert.Id)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(export)
+}
+
+// handleAdminDestructionCertificateVerify verifies an exported certificate against
+// this server's signing key
+// POST /admin/destruction-certificates/verify with the exported JSON as body
+func (s *Server) handleAdminDestructionCertificateVerify(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var cert database.DestructionCertificate
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024)).Decode(&cert); err != nil {
+		s.sendError(w, http.StatusBadRequest, "Invalid certificate JSON")
+		return
+	}
+
+	valid := storage.VerifyCertificate(&cert)
+
+	// A valid signature must also match the certificate on record
+	if valid {
+		stored, err := database.DB.GetDestructionCertificate(cert.Id)
+		valid = err == nil && stored.Signature == cert.Signature
+	}
+
+	s.sendJSON(w, http.StatusOK, map[string]interface{}{
+		"valid":          valid,
+		"certificate_id": cert.Id,
+	})
+}
+
+// renderAdminDestructionCertificates renders the destruction certificate list
+func (s *Server) renderAdminDestructionCertificates(w http.ResponseWriter, certs []*database.DestructionCertificate) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	policy := `<span style="color: #c62828; font-weight: 600;">disabled</span> - permanently deleted files are unlinked without overwriting and no certificate is issued.`
+	if storage.SecureDeleteEnabled() {
+		policy = `<span style="color: #2e7d32; font-weight: 600;">enabled</span> - blobs are overwritten with random data and zeros before unlinking.`
+	}
+
+	html := `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <meta name="author" content="Ulf Holmström">
+    <title>Destruction Certificates - ` + s.config.CompanyName + `</title>
+    ` + s.getFaviconHTML() + `
+    <link rel="stylesheet" href="/static/css/style.css">
+    <style>
+        * { margin: 0; padding: 0; box-sizing: border-box; }
+        body {
+            font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Roboto, sans-serif;
+            background: #f5f5f5;
+        }
+        .container {
+            max-width: 1400px;
+            margin: 40px auto;
+            padding: 0 20px;
+        }
+        h2 {
+            margin-bottom: 20px;
+            color: #333;
+        }
+        .info-box {
+            background: #e3f2fd;
+            border: 1px solid #90caf9;
+            color: #0d47a1;
+            padding: 15px;
+            border-radius: 8px;
+            margin-bottom: 20px;
+        }
+        table {
+            width: 100%;
+            background: white;
+            border-collapse: collapse;
+            border-radius: 8px;
+            overflow: hidden;
+            box-shadow: 0 1px 3px rgba(0,0,0,0.08);
+        }
+        th, td {
+            padding: 12px 16px;
+            text-align: left;
+            border-bottom: 1px solid #eee;
+            font-size: 14px;
+        }
+        th {
+            background: ` + s.getPrimaryColor() + `;
+            color: white;
+            font-weight: 600;
+        }
+        td code {
+            font-size: 12px;
+            color: #555;
+        }
+        .btn {
+            padding: 6px 12px;
+            border-radius: 6px;
+            font-size: 13px;
+            font-weight: 600;
+            text-decoration: none;
+            background: ` + s.getPrimaryColor() + `;
+            color: white;
+        }
+        .empty-state {
+            text-align: center;
+            padding: 60px 20px;
+            color: #999;
+        }
+    </style>
+</head>
+<body>
+    ` + s.getAdminHeaderHTML("") + `
+    <div class="container">
+        <h2>📜 Destruction Certificates</h2>
+
+        <div class="info-box">
+            Secure deletion is ` + policy + `<br>
+            Each certificate is signed by this server. Exported certificates can be verified by posting them to <code>/admin/destruction-certificates/verify</code>.
+        </div>`
+
+	if len(certs) == 0 {
+		html += `
+        <div class="empty-state">
+            <p>No destruction certificates have been issued yet</p>
+        </div>`
+	} else {
+		html += `
+        <table>
+            <thead>
+                <tr>
+                    <th>Destroyed</th>
+                    <th>File</th>
+                    <th>SHA1</th>
+                    <th>Size</th>
+                    <th>Method</th>
+                    <th>By</th>
+                    <th>Signature</th>
+                    <th></th>
+                </tr>
+            </thead>
+            <tbody>`
+
+		for _, c := range certs {
+			verified := `<span style="color: #2e7d32;">✔ Valid</span>`
+			if !storage.VerifyCertificate(c) {
+				verified = `<span style="color: #c62828;">✖ Invalid</span>`
+			}
+
+			html += fmt.Sprintf(`
+                <tr>
+                    <td>%s</td>
+                    <td>%s<br><code>%s</code></td>
+                    <td><code>%s</code></td>
+                    <td>%s</td>
+                    <td>%s (%d passes)</td>
+                    <td>%s</td>
+                    <td>%s</td>
+                    <td><a class="btn" href="/admin/destruction-certificates/export?id=%s">⬇️ Export</a></td>
+                </tr>`,
+				time.Unix(c.DestroyedAt, 0).Format("2006-01-02 15:04:05"),
+				template.HTMLEscapeString(c.FileName), c.FileId,
+				c.FileSHA1,
+				database.FormatFileSize(c.SizeBytes),
+				c.Method, c.Passes,
+				template.HTMLEscapeString(c.DestroyedBy),
+				verified,
+				c.Id)
+		}
+
+		html += `
+            </tbody>
+        </table>`
+	}
+
+	html += `
+    </div>
+</body>
+</html>`
+
+	w.Write([]byte(html))
+}
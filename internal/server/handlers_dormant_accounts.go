@@ -0,0 +1,198 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package server
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Frimurare/WulfVault/internal/cleanup"
+)
+
+// handleAdminDormantAccounts previews what the dormant download account lifecycle
+// would do on its next run, without changing anything
+func (s *Server) handleAdminDormantAccounts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	policy := cleanup.LoadDormancyPolicy()
+	actions, err := cleanup.PlanDormantAccounts(policy, time.Now())
+	if err != nil {
+		log.Printf("Error planning dormant account lifecycle: %v", err)
+		s.sendError(w, http.StatusInternalServerError, "Failed to preview dormant accounts")
+		return
+	}
+
+	s.renderAdminDormantAccounts(w, policy, actions)
+}
+
+// renderAdminDormantAccounts renders the dry-run preview of the dormant account lifecycle
+func (s *Server) renderAdminDormantAccounts(w http.ResponseWriter, policy *cleanup.DormancyPolicy, actions []*cleanup.DormantAction) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	step := func(days int, what string) string {
+		if days == 0 {
+			return what + ` <span style="color: #999;">off</span>`
+		}
+		return fmt.Sprintf("%s after <strong>%d</strong> days", what, days)
+	}
+	policyText := step(policy.WarnDays, "Warn") + " · " + step(policy.DisableDays, "disable") + " · " + step(policy.DeleteDays, "delete")
+
+	html := `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <meta name="author" content="Ulf Holmström">
+    <title>Dormant Download Accounts - ` + s.config.CompanyName + `</title>
+    ` + s.getFaviconHTML() + `
+    <link rel="stylesheet" href="/static/css/style.css">
+    <style>
+        * { margin: 0; padding: 0; box-sizing: border-box; }
+        body {
+            font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Roboto, sans-serif;
+            background: #f5f5f5;
+        }
+        .container {
+            max-width: 1400px;
+            margin: 40px auto;
+            padding: 0 20px;
+        }
+        h2 {
+            margin-bottom: 20px;
+            color: #333;
+        }
+        .info-box {
+            background: #e3f2fd;
+            border: 1px solid #90caf9;
+            color: #0d47a1;
+            padding: 15px;
+            border-radius: 8px;
+            margin-bottom: 20px;
+            line-height: 1.6;
+        }
+        .info-box a {
+            color: #0d47a1;
+        }
+        table {
+            width: 100%;
+            background: white;
+            border-collapse: collapse;
+            border-radius: 8px;
+            overflow: hidden;
+            box-shadow: 0 1px 3px rgba(0,0,0,0.08);
+        }
+        th, td {
+            padding: 12px 16px;
+            text-align: left;
+            border-bottom: 1px solid #eee;
+            font-size: 14px;
+        }
+        th {
+            background: ` + s.getPrimaryColor() + `;
+            color: white;
+            font-weight: 600;
+        }
+        .step {
+            padding: 3px 10px;
+            border-radius: 4px;
+            font-size: 12px;
+            font-weight: 600;
+            color: white;
+        }
+        .step-warn { background: #f59e0b; }
+        .step-disable { background: #6b7280; }
+        .step-delete { background: #dc2626; }
+        .empty-state {
+            text-align: center;
+            padding: 60px 20px;
+            color: #999;
+        }
+    </style>
+</head>
+<body>
+    ` + s.getAdminHeaderHTML("") + `
+    <div class="container">
+        <h2>💤 Dormant Download Accounts</h2>
+
+        <div class="info-box">
+            Lifecycle policy: ` + policyText + `.<br>
+            This is a preview of the next run of the cleanup scheduler (every 6 hours); nothing has been changed.
+            Warned accounts are emailed, deleted accounts are anonymized. Reactivating a disabled account restarts its idle time.
+            Change the policy under <a href="/admin/settings">Settings</a>.
+        </div>`
+
+	if !policy.Enabled() {
+		html += `
+        <div class="empty-state">
+            <p>The dormant account lifecycle is turned off</p>
+        </div>`
+	} else if len(actions) == 0 {
+		html += `
+        <div class="empty-state">
+            <p>No download accounts are due for a lifecycle step</p>
+        </div>`
+	} else {
+		html += `
+        <table>
+            <thead>
+                <tr>
+                    <th>Account</th>
+                    <th>Last used</th>
+                    <th>Idle</th>
+                    <th>Status</th>
+                    <th>Next run</th>
+                </tr>
+            </thead>
+            <tbody>`
+
+		labels := map[string]string{
+			cleanup.DormantWarn:    "Warn by email",
+			cleanup.DormantDisable: "Disable",
+			cleanup.DormantDelete:  "Delete and anonymize",
+		}
+		for _, action := range actions {
+			a := action.Account
+			status := "Active"
+			if !a.IsActive {
+				status = "Disabled"
+			}
+			if a.Warned() {
+				status += ", warned " + time.Unix(a.WarnedAt, 0).Format("2006-01-02")
+			}
+
+			html += fmt.Sprintf(`
+                <tr>
+                    <td>%s<br><span style="color: #666; font-size: 13px;">%s</span></td>
+                    <td>%s</td>
+                    <td>%d days</td>
+                    <td>%s</td>
+                    <td><span class="step step-%s">%s</span></td>
+                </tr>`,
+				template.HTMLEscapeString(a.Name), template.HTMLEscapeString(a.Email),
+				time.Unix(a.LastActivity, 0).Format("2006-01-02"),
+				action.IdleDays,
+				status,
+				action.Step, labels[action.Step])
+		}
+
+		html += `
+            </tbody>
+        </table>`
+	}
+
+	html += `
+    </div>
+</body>
+</html>`
+
+	w.Write([]byte(html))
+}
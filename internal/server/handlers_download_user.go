@@ -6,6 +6,7 @@
 package server
 
 import (
+	"errors"
 	"fmt"
 	"html/template"
 	"log"
@@ -16,6 +17,7 @@ import (
 	"github.com/Frimurare/WulfVault/internal/auth"
 	"github.com/Frimurare/WulfVault/internal/database"
 	"github.com/Frimurare/WulfVault/internal/models"
+	"github.com/Frimurare/WulfVault/internal/passwords"
 )
 
 // requireDownloadAuth is middleware that requires download account authentication
@@ -27,28 +29,31 @@ func (s *Server) requireDownloadAuth(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
-		account, err := s.getDownloadAccountFromSession(r)
-		if err != nil {
-			http.Redirect(w, r, "/login", http.StatusSeeOther)
-			return
+		// An active transfer keeps the session from timing out
+		if s.hasActiveTransfer(cookie.Value) {
+			auth.TouchDownloadAccountSession(cookie.Value)
 		}
 
-		// Check for inactivity timeout (10 minutes), but only if no active transfer
-		// Use email as session identifier for download accounts
-		if !s.hasActiveTransfer(cookie.Value) {
-			timeSinceLastActivity := time.Since(time.Unix(account.LastUsed, 0))
-			if timeSinceLastActivity > auth.InactivityTimeout {
-				// Force logout due to inactivity
-				http.SetCookie(w, &http.Cookie{
-					Name:     "download_session",
-					Value:    "",
-					Path:     "/",
-					MaxAge:   -1,
-					HttpOnly: true,
-				})
+		account, err := auth.GetDownloadAccountBySession(cookie.Value)
+		if err != nil {
+			// Unknown, expired or idle session, or a cookie from before server-side sessions
+			http.SetCookie(w, &http.Cookie{
+				Name:     "download_session",
+				Value:    "",
+				Path:     "/",
+				MaxAge:   -1,
+				HttpOnly: true,
+			})
+			if errors.Is(err, auth.ErrSessionIdle) {
 				http.Redirect(w, r, "/login?timeout=1", http.StatusSeeOther)
-				return
+			} else {
+				http.Redirect(w, r, "/login", http.StatusSeeOther)
 			}
+			return
+		}
+
+		if requireDownloadPasswordChange(w, r, account) {
+			return
 		}
 
 		// Store account in context
@@ -91,7 +96,11 @@ func (s *Server) handleDownloadChangePassword(w http.ResponseWriter, r *http.Req
 	}
 
 	if r.Method == http.MethodGet {
-		s.renderDownloadChangePasswordPage(w, account, "")
+		message := ""
+		if r.URL.Query().Get("expired") == "1" {
+			message = "Your password has expired. Choose a new password to continue."
+		}
+		s.renderDownloadChangePasswordPage(w, account, message)
 		return
 	}
 
@@ -117,13 +126,13 @@ func (s *Server) handleDownloadChangePassword(w http.ResponseWriter, r *http.Req
 	}
 
 	// Validate new password
-	if newPassword == "" || len(newPassword) < 6 {
-		s.renderDownloadChangePasswordPage(w, account, "New password must be at least 6 characters")
+	if newPassword != confirmPassword {
+		s.renderDownloadChangePasswordPage(w, account, "Passwords do not match")
 		return
 	}
 
-	if newPassword != confirmPassword {
-		s.renderDownloadChangePasswordPage(w, account, "Passwords do not match")
+	if err := checkDownloadAccountPassword(newPassword, account.Email, account); err != nil {
+		s.renderDownloadChangePasswordPage(w, account, err.Error())
 		return
 	}
 
@@ -141,14 +150,26 @@ func (s *Server) handleDownloadChangePassword(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	passwords.Record(database.AccountTypeDownloadAccount, account.Id, hashedPassword)
 	log.Printf("Password changed for download account: %s", account.Email)
 
+	// Other browsers signed in with the old password are signed out
+	if cookie, err := r.Cookie("download_session"); err == nil {
+		if _, err := database.DB.DeleteOtherDownloadSessions(account.Id, cookie.Value); err != nil {
+			log.Printf("Failed to revoke sessions of download account %s: %v", account.Email, err)
+		}
+	}
+
 	// Redirect back to dashboard with success message
 	s.renderDownloadChangePasswordPage(w, account, "SUCCESS:Password changed successfully!")
 }
 
 // handleDownloadLogout logs out a download user
 func (s *Server) handleDownloadLogout(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie("download_session"); err == nil {
+		auth.DeleteDownloadAccountSession(cookie.Value)
+	}
+
 	// Clear download session cookie
 	http.SetCookie(w, &http.Cookie{
 		Name:     "download_session",
@@ -161,6 +182,52 @@ func (s *Server) handleDownloadLogout(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/login", http.StatusSeeOther)
 }
 
+// handleDownloadLogoutEverywhere signs a download user out of all browsers,
+// including the current one
+func (s *Server) handleDownloadLogoutEverywhere(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	account, ok := downloadAccountFromContext(r.Context())
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	count, err := auth.DeleteDownloadAccountSessions(account.Id)
+	if err != nil {
+		log.Printf("Failed to sign out download account %s everywhere: %v", account.Email, err)
+		http.Error(w, "Failed to sign out", http.StatusInternalServerError)
+		return
+	}
+
+	database.DB.LogAction(&database.AuditLogEntry{
+		UserID:     int64(account.Id),
+		UserEmail:  account.Email,
+		Action:     database.ActionSessionRevoked,
+		EntityType: database.EntityDownloadAccount,
+		EntityID:   strconv.Itoa(account.Id),
+		Details: database.CreateAuditDetails(map[string]interface{}{
+			"revoked": count,
+			"reason":  "sign_out_everywhere",
+		}),
+		IPAddress: getClientIP(r),
+		UserAgent: r.UserAgent(),
+		Success:   true,
+	})
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     "download_session",
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
 // handleDownloadAccountDelete handles GDPR self-service deletion
 func (s *Server) handleDownloadAccountDeleteSelf(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -470,6 +537,8 @@ func (s *Server) renderDownloadDashboard(w http.ResponseWriter, account *models.
 func (s *Server) renderDownloadChangePasswordPage(w http.ResponseWriter, account *models.DownloadAccount, message string) {
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 
+	policy := passwords.LoadPolicy()
+
 	messageHTML := ""
 	if message != "" {
 		if len(message) > 8 && message[:8] == "SUCCESS:" {
@@ -562,11 +631,12 @@ func (s *Server) renderDownloadChangePasswordPage(w http.ResponseWriter, account
                 </div>
                 <div class="form-group">
                     <label>New Password</label>
-                    <input type="password" name="new_password" required minlength="6">
+                    <input type="password" name="new_password" required minlength="` + strconv.Itoa(policy.MinLength) + `">
+                    <p style="color: #666; font-size: 13px; margin-top: 6px;">` + policy.Requirements() + `</p>
                 </div>
                 <div class="form-group">
                     <label>Confirm New Password</label>
-                    <input type="password" name="confirm_password" required minlength="6">
+                    <input type="password" name="confirm_password" required minlength="` + strconv.Itoa(policy.MinLength) + `">
                 </div>
                 <button type="submit" class="btn btn-primary">Change Password</button>
             </form>
@@ -0,0 +1,331 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package server
+
+import (
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/Frimurare/WulfVault/internal/auth"
+	"github.com/Frimurare/WulfVault/internal/database"
+	"github.com/Frimurare/WulfVault/internal/email"
+	"github.com/Frimurare/WulfVault/internal/models"
+)
+
+// configDownloadEmailVerification turns email verification of download accounts
+// on or off. It is on unless set to "false".
+const configDownloadEmailVerification = "download_email_verification"
+
+// downloadEmailVerificationEnabled reports whether download accounts must verify
+// their email address before downloading
+func downloadEmailVerificationEnabled() bool {
+	value, _ := database.DB.GetConfigValue(configDownloadEmailVerification)
+	return value != "false"
+}
+
+// downloadAccountVerified reports whether a download account may download files
+// as far as email verification is concerned
+func downloadAccountVerified(account *models.DownloadAccount) bool {
+	return account.IsEmailVerified() || !downloadEmailVerificationEnabled()
+}
+
+// sendDownloadVerification emails a new verification code and link to a download
+// account and shows the page where the code is entered
+func (s *Server) sendDownloadVerification(w http.ResponseWriter, r *http.Request, fileInfo *database.FileInfo, account *models.DownloadAccount) {
+	code, token, err := database.DB.CreateDownloadAccountVerification(account.Id, fileInfo.Id)
+	if err != nil {
+		log.Printf("Error creating email verification for %s: %v", account.Email, err)
+		s.renderDownloadAuthPage(w, fileInfo, "Could not start email verification. Please try again.")
+		return
+	}
+
+	verifyLink := s.getPublicURL() + "/download/verify?token=" + url.QueryEscape(token)
+	err = email.SendDownloadVerificationEmail(account.Email, account.Name, code, verifyLink, fileInfo.Name,
+		s.config.CompanyName, int(database.VerificationDuration.Minutes()))
+
+	database.DB.LogAction(&database.AuditLogEntry{
+		UserID:     int64(account.Id),
+		UserEmail:  account.Email,
+		Action:     database.ActionDownloadAccountVerificationSent,
+		EntityType: database.EntityDownloadAccount,
+		EntityID:   strconv.Itoa(account.Id),
+		Details: database.CreateAuditDetails(map[string]interface{}{
+			"file_id":   fileInfo.Id,
+			"file_name": fileInfo.Name,
+		}),
+		IPAddress: getClientIP(r),
+		UserAgent: r.UserAgent(),
+		Success:   err == nil,
+		ErrorMsg:  errorString(err),
+	})
+
+	if err != nil {
+		log.Printf("Error sending verification email to %s: %v", account.Email, err)
+		s.renderDownloadAuthPage(w, fileInfo, "Your email address must be verified before downloading, but the verification email could not be sent. Please contact the person who shared this file.")
+		return
+	}
+
+	log.Printf("Verification code sent to download account %s", account.Email)
+	s.renderDownloadVerificationPage(w, fileInfo, account.Email, "")
+}
+
+// handleDownloadVerificationCode checks a verification code entered on the
+// download page and starts the download once it is correct
+func (s *Server) handleDownloadVerificationCode(w http.ResponseWriter, r *http.Request, fileInfo *database.FileInfo) {
+	emailAddr := r.FormValue("email")
+	code := strings.TrimSpace(r.FormValue("verification_code"))
+
+	lockKeys := []string{loginAccountKey(emailAddr), s.ipLockKey(r)}
+	if until := auth.LockedUntil(lockKeys...); !until.IsZero() {
+		logLockedAttempt(r, emailAddr, "verification_code", until)
+		s.renderDownloadVerificationPage(w, fileInfo, emailAddr, auth.LockoutMessage(until))
+		return
+	}
+
+	account, err := database.DB.GetDownloadAccountByEmail(emailAddr)
+	if err != nil || !account.IsActive {
+		s.renderDownloadAuthPage(w, fileInfo, "Please sign in again")
+		return
+	}
+	if !fileInfo.RecipientAllowed(account.Email) {
+		s.rejectRecipient(w, r, fileInfo, account.Email)
+		return
+	}
+
+	if err := database.DB.CheckDownloadAccountCode(account.Id, code); err != nil {
+		var msg string
+		switch {
+		case errors.Is(err, database.ErrVerificationInvalid):
+			s.recordFailedAttempt(r, "verification_code", account.Email, lockKeys...)
+			msg = "Incorrect verification code"
+		case errors.Is(err, database.ErrVerificationExpired):
+			msg = "The verification code has expired. Sign in again to receive a new one."
+		case errors.Is(err, database.ErrVerificationLocked):
+			msg = "Too many incorrect codes. Sign in again to receive a new one."
+		case errors.Is(err, database.ErrVerificationNotFound):
+			msg = "No verification is pending. Sign in again to receive a code."
+		default:
+			log.Printf("Error checking verification code of %s: %v", account.Email, err)
+			msg = "Could not check the code. Please try again."
+		}
+		s.renderDownloadVerificationPage(w, fileInfo, account.Email, msg)
+		return
+	}
+	auth.ClearFailures(lockKeys[0])
+
+	account, err = s.downloadAccountVerifiedAudit(r, account.Id, fileInfo.Id, "code")
+	if err != nil {
+		s.renderDownloadAuthPage(w, fileInfo, "Please sign in again")
+		return
+	}
+
+	s.startDownloadSession(w, r, fileInfo.Id, account, database.DownloadAuthPassword)
+	s.performDownloadWithRedirect(w, r, fileInfo, account)
+}
+
+// handleDownloadVerifyLink handles the verification link from the email. It
+// signs the account in and returns it to the file it wanted to download.
+func (s *Server) handleDownloadVerifyLink(w http.ResponseWriter, r *http.Request) {
+	accountId, fileId, err := database.DB.CheckDownloadAccountToken(r.URL.Query().Get("token"))
+	if err != nil {
+		if !errors.Is(err, database.ErrVerificationNotFound) && !errors.Is(err, database.ErrVerificationExpired) {
+			log.Printf("Error checking verification link: %v", err)
+		}
+		http.Error(w, "This verification link is invalid or has expired. Open the download link again to get a new one.", http.StatusBadRequest)
+		return
+	}
+
+	account, err := s.downloadAccountVerifiedAudit(r, accountId, fileId, "link")
+	if err != nil || !account.IsActive {
+		http.Error(w, "Account not found", http.StatusNotFound)
+		return
+	}
+
+	if _, err := database.DB.GetFileByID(fileId); err != nil {
+		fileId = ""
+	}
+	s.startDownloadSession(w, r, fileId, account, database.DownloadAuthPassword)
+
+	if fileId == "" {
+		http.Redirect(w, r, "/download/dashboard", http.StatusSeeOther)
+		return
+	}
+	http.Redirect(w, r, "/d/"+fileId, http.StatusSeeOther)
+}
+
+// downloadAccountVerifiedAudit audits a completed email verification and returns
+// the account as it is now stored
+func (s *Server) downloadAccountVerifiedAudit(r *http.Request, accountId int, fileId, method string) (*models.DownloadAccount, error) {
+	account, err := database.DB.GetDownloadAccountByID(accountId)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Download account %s verified its email address (%s)", account.Email, method)
+	database.DB.LogAction(&database.AuditLogEntry{
+		UserID:     int64(account.Id),
+		UserEmail:  account.Email,
+		Action:     database.ActionDownloadAccountEmailVerified,
+		EntityType: database.EntityDownloadAccount,
+		EntityID:   strconv.Itoa(account.Id),
+		Details: database.CreateAuditDetails(map[string]interface{}{
+			"file_id": fileId,
+			"method":  method,
+		}),
+		IPAddress: getClientIP(r),
+		UserAgent: r.UserAgent(),
+		Success:   true,
+	})
+	return account, nil
+}
+
+// errorString returns the message of err, or "" if it is nil
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// renderDownloadVerificationPage shows the form where a download account enters
+// the code it was emailed
+func (s *Server) renderDownloadVerificationPage(w http.ResponseWriter, fileInfo *database.FileInfo, emailAddr, errorMsg string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	errorHTML := ""
+	if errorMsg != "" {
+		errorHTML = `<div class="error">` + template.HTMLEscapeString(errorMsg) + `</div>`
+	}
+
+	html := `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <meta name="author" content="Ulf Holmström">
+    <title>Verify Your Email - ` + s.config.CompanyName + `</title>
+    ` + s.getFaviconHTML() + `
+    <style>
+        * { margin: 0; padding: 0; box-sizing: border-box; }
+        body {
+            font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Roboto, sans-serif;
+            background: linear-gradient(135deg, ` + s.getPrimaryColor() + ` 0%, ` + s.getSecondaryColor() + ` 100%);
+            min-height: 100vh;
+            display: flex;
+            align-items: center;
+            justify-content: center;
+            padding: 20px;
+        }
+        .download-container {
+            background: white;
+            border-radius: 12px;
+            box-shadow: 0 20px 60px rgba(0,0,0,0.3);
+            padding: 40px;
+            max-width: 500px;
+            width: 100%;
+        }
+        .logo {
+            text-align: center;
+            margin-bottom: 30px;
+        }
+        .logo h1 {
+            color: ` + s.getPrimaryColor() + `;
+            font-size: 28px;
+            margin-bottom: 8px;
+        }
+        h3 {
+            color: #333;
+            font-size: 16px;
+            margin-bottom: 16px;
+        }
+        p {
+            color: #666;
+            font-size: 14px;
+            margin-bottom: 16px;
+        }
+        input[type="text"] {
+            width: 100%;
+            padding: 12px;
+            border: 2px solid #e0e0e0;
+            border-radius: 6px;
+            font-size: 24px;
+            letter-spacing: 8px;
+            text-align: center;
+            font-family: monospace;
+            margin-bottom: 16px;
+        }
+        input:focus {
+            outline: none;
+            border-color: ` + s.getPrimaryColor() + `;
+        }
+        .btn {
+            width: 100%;
+            padding: 14px;
+            background: ` + s.getPrimaryColor() + `;
+            color: white;
+            border: none;
+            border-radius: 6px;
+            font-size: 16px;
+            font-weight: 600;
+            cursor: pointer;
+            transition: opacity 0.3s;
+        }
+        .btn:hover {
+            opacity: 0.9;
+        }
+        .error {
+            background: #fee;
+            border: 1px solid #fcc;
+            color: #c33;
+            padding: 12px;
+            border-radius: 6px;
+            margin-bottom: 20px;
+            font-size: 14px;
+        }
+        .info {
+            background: #e3f2fd;
+            border: 1px solid #90caf9;
+            color: #1976d2;
+            padding: 12px;
+            border-radius: 6px;
+            margin-bottom: 20px;
+            font-size: 13px;
+        }
+    </style>
+</head>
+<body>
+    <div class="download-container">
+        <div class="logo">
+            <h1>` + s.config.CompanyName + `</h1>
+        </div>
+
+        <div class="info">
+            📧 We sent a verification code to <strong>` + template.HTMLEscapeString(emailAddr) + `</strong>. Enter it below, or click the link in the email, to download <strong>` + template.HTMLEscapeString(fileInfo.Name) + `</strong>.
+        </div>
+        ` + errorHTML + `
+        <h3>Verify Your Email</h3>
+        <form method="POST" action="/d/` + fileInfo.Id + `">
+            <input type="hidden" name="email" value="` + template.HTMLEscapeString(emailAddr) + `">
+            <input type="text" name="verification_code" inputmode="numeric" autocomplete="one-time-code" pattern="[0-9]{6}" maxlength="6" required autofocus placeholder="000000">
+            <button type="submit" class="btn">Verify &amp; Download</button>
+        </form>
+
+        <p style="margin-top: 20px; font-size: 13px;">The code is valid for ` + strconv.Itoa(int(database.VerificationDuration.Minutes())) + ` minutes. Didn't get it? <a href="/d/` + fileInfo.Id + `">Sign in again</a> to receive a new code.</p>
+
+        <div style="text-align: center; margin-top: 20px; color: #999; font-size: 12px;">
+            ` + s.config.FooterText + `
+        </div>
+    </div>
+</body>
+</html>`
+
+	w.Write([]byte(html))
+}
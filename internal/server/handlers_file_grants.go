@@ -0,0 +1,118 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Frimurare/WulfVault/internal/database"
+)
+
+// A password grant remembers that a client entered the correct password of a
+// protected file. It is an HMAC-signed cookie bound to the file, the client's IP
+// address and user agent, and the file's password hash, so changing the password
+// invalidates every outstanding grant.
+
+// filePasswordGrantDuration is how long a correct file password is remembered
+const filePasswordGrantDuration = time.Hour
+
+// fileGrantKeyConfig is the Configuration key holding the grant signing key
+const fileGrantKeyConfig = "file_password_grant_key"
+
+// filePasswordGrantCookie returns the name of the grant cookie of a file
+func filePasswordGrantCookie(fileId string) string {
+	return "password_verified_" + fileId
+}
+
+// issueFilePasswordGrant sets a grant cookie for a file whose password was entered correctly
+func (s *Server) issueFilePasswordGrant(w http.ResponseWriter, r *http.Request, fileInfo *database.FileInfo) error {
+	expires := time.Now().Add(filePasswordGrantDuration)
+	mac, err := s.signFilePasswordGrant(r, fileInfo, expires.Unix())
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     filePasswordGrantCookie(fileInfo.Id),
+		Value:    strconv.FormatInt(expires.Unix(), 10) + "." + mac,
+		Path:     "/d/" + fileInfo.Id,
+		Expires:  expires,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	return nil
+}
+
+// hasFilePasswordGrant reports whether the request carries a valid grant for a file
+func (s *Server) hasFilePasswordGrant(r *http.Request, fileInfo *database.FileInfo) bool {
+	cookie, err := r.Cookie(filePasswordGrantCookie(fileInfo.Id))
+	if err != nil {
+		return false
+	}
+
+	expiresStr, mac, ok := strings.Cut(cookie.Value, ".")
+	if !ok {
+		return false
+	}
+	expires, err := strconv.ParseInt(expiresStr, 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return false
+	}
+
+	expected, err := s.signFilePasswordGrant(r, fileInfo, expires)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal([]byte(mac), []byte(expected))
+}
+
+// signFilePasswordGrant computes the HMAC-SHA256 signature of a grant
+func (s *Server) signFilePasswordGrant(r *http.Request, fileInfo *database.FileInfo, expires int64) (string, error) {
+	key, err := fileGrantKey()
+	if err != nil {
+		return "", err
+	}
+
+	payload := fmt.Sprintf("%s|%d|%s|%s|%s", fileInfo.Id, expires, s.trustedClientIP(r), r.UserAgent(), fileInfo.PasswordHash)
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// fileGrantKey returns the server's grant signing key, creating it on first use
+func fileGrantKey() ([]byte, error) {
+	return signingKey(fileGrantKeyConfig)
+}
+
+// signingKey returns the HMAC key stored under a Configuration key, creating it
+// on first use
+func signingKey(configKey string) ([]byte, error) {
+	value, err := database.DB.GetConfigValue(configKey)
+	if err != nil {
+		return nil, err
+	}
+	if value != "" {
+		return hex.DecodeString(value)
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := database.DB.SetConfigValue(configKey, hex.EncodeToString(key)); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
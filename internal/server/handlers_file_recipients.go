@@ -0,0 +1,100 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package server
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Frimurare/WulfVault/internal/database"
+	"github.com/Frimurare/WulfVault/internal/email"
+	"github.com/Frimurare/WulfVault/internal/models"
+)
+
+// rejectionAlertInterval is how often the owner of a file is emailed about the
+// same account trying to download it
+const rejectionAlertInterval = time.Hour
+
+var (
+	rejectionAlerts   = make(map[string]time.Time) // fileId|email -> last alert
+	rejectionAlertsMu sync.Mutex
+)
+
+// userMayDownload reports whether a signed-in user may download a file that may be
+// restricted to named recipients. Owners and users who can see all files always may.
+func userMayDownload(user *models.User, fileInfo *database.FileInfo) bool {
+	return fileInfo.RecipientAllowed(user.Email) || user.Id == fileInfo.UserId ||
+		hasPermission(user, models.RolePermViewAllFiles) || hasPermission(user, models.RolePermManageAllFiles)
+}
+
+// rejectRecipient refuses a download by someone who is not an allowed recipient of
+// the file. The attempt is audited and, if the file asks for it, the owner is emailed.
+func (s *Server) rejectRecipient(w http.ResponseWriter, r *http.Request, fileInfo *database.FileInfo, emailAddr string) {
+	log.Printf("Download of %s rejected: %s is not an allowed recipient", fileInfo.Id, emailAddr)
+
+	database.DB.LogAction(&database.AuditLogEntry{
+		UserID:     0,
+		UserEmail:  emailAddr,
+		Action:     database.ActionFileDownloadRejected,
+		EntityType: database.EntityFile,
+		EntityID:   fileInfo.Id,
+		Details: database.CreateAuditDetails(map[string]interface{}{
+			"file_name": fileInfo.Name,
+			"owner_id":  fileInfo.UserId,
+			"reason":    "not_allowed_recipient",
+		}),
+		IPAddress: getClientIP(r),
+		UserAgent: r.UserAgent(),
+		Success:   false,
+		ErrorMsg:  "not an allowed recipient",
+	})
+
+	if fileInfo.NotifyRejections && rejectionAlertDue(fileInfo.Id, emailAddr) {
+		if owner, err := database.DB.GetUserByID(fileInfo.UserId); err == nil {
+			details := []string{
+				"File: " + fileInfo.Name,
+				"Account: " + emailAddr,
+				"IP address: " + getClientIP(r),
+				"Time: " + time.Now().Format("2006-01-02 15:04:05"),
+			}
+			go func() {
+				if err := email.SendSecurityAlert(owner.Email,
+					"Blocked download of "+fileInfo.Name,
+					"Download Blocked",
+					"Someone who is not one of the recipients you named tried to download your file. The download was refused.",
+					details); err != nil {
+					log.Printf("Could not send rejected download notice to %s: %v", owner.Email, err)
+				}
+			}()
+		}
+	}
+
+	s.renderDownloadAuthPage(w, fileInfo, "This file was shared with specific recipients, and "+emailAddr+" is not one of them. Sign in with the email address the file was sent to.")
+}
+
+// rejectionAlertDue reports whether the owner should be emailed about this
+// account trying to download this file, and records that they were
+func rejectionAlertDue(fileId, emailAddr string) bool {
+	key := fileId + "|" + strings.ToLower(emailAddr)
+	now := time.Now()
+
+	rejectionAlertsMu.Lock()
+	defer rejectionAlertsMu.Unlock()
+
+	for k, sent := range rejectionAlerts {
+		if now.Sub(sent) > rejectionAlertInterval {
+			delete(rejectionAlerts, k)
+		}
+	}
+	if _, ok := rejectionAlerts[key]; ok {
+		return false
+	}
+	rejectionAlerts[key] = now
+	return true
+}
@@ -12,7 +12,6 @@ import (
 	"log"
 	"net/http"
 	"os"
-	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -20,6 +19,7 @@ import (
 	"github.com/Frimurare/WulfVault/internal/database"
 	"github.com/Frimurare/WulfVault/internal/email"
 	"github.com/Frimurare/WulfVault/internal/models"
+	"github.com/Frimurare/WulfVault/internal/storage"
 )
 
 // getClientIP extracts the client IP address from the request
@@ -451,6 +451,11 @@ func (s *Server) handleUploadRequestSubmit(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	// Refuse early based on the declared request size, before anything is written to disk
+	if !s.checkUploadSpace(w, r.ContentLength) {
+		return
+	}
+
 	// Parse multipart form (32MB max memory buffer, rest spills to disk)
 	// This prevents loading entire large files into RAM
 	err = r.ParseMultipartForm(32 << 20)
@@ -487,6 +492,11 @@ func (s *Server) handleUploadRequestSubmit(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	// Check free disk space for the actual file size
+	if !s.checkUploadSpace(w, fileSize) {
+		return
+	}
+
 	// Generate file ID
 	fileID, err := generateFileID()
 	if err != nil {
@@ -495,7 +505,11 @@ func (s *Server) handleUploadRequestSubmit(w http.ResponseWriter, r *http.Reques
 	}
 
 	// Save file to disk
-	uploadPath := filepath.Join(s.config.UploadsDir, fileID)
+	uploadPath, err := storage.CreatePath(s.config.UploadsDir, fileID)
+	if err != nil {
+		s.sendError(w, http.StatusInternalServerError, "Failed to save file")
+		return
+	}
 	dst, err := os.Create(uploadPath)
 	if err != nil {
 		s.sendError(w, http.StatusInternalServerError, "Failed to save file")
@@ -541,6 +555,7 @@ func (s *Server) handleUploadRequestSubmit(w http.ResponseWriter, r *http.Reques
 		UnlimitedTime:      false,
 		RequireAuth:        false,
 	}
+	fileInfo.Compression, fileInfo.StoredSizeBytes = compressAtRest(uploadPath, fileInfo.ContentType, fileInfo.Name)
 
 	if err := database.DB.SaveFile(fileInfo); err != nil {
 		os.Remove(uploadPath)
@@ -15,7 +15,6 @@ import (
 	"log"
 	"net/http"
 	"os"
-	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -24,6 +23,8 @@ import (
 	"github.com/Frimurare/WulfVault/internal/database"
 	"github.com/Frimurare/WulfVault/internal/email"
 	"github.com/Frimurare/WulfVault/internal/models"
+	"github.com/Frimurare/WulfVault/internal/passwords"
+	"github.com/Frimurare/WulfVault/internal/storage"
 )
 
 // handleUpload handles file upload
@@ -47,6 +48,11 @@ func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
 		defer s.markTransferInactive(sessionCookie.Value)
 	}
 
+	// Refuse early based on the declared request size, before anything is written to disk
+	if !s.checkUploadSpace(w, r.ContentLength) {
+		return
+	}
+
 	// Parse multipart form (32MB max memory buffer, rest spills to disk)
 	// This prevents loading entire large files into RAM
 	err = r.ParseMultipartForm(32 << 20)
@@ -66,11 +72,24 @@ func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
 	expireDate := r.FormValue("expire_date")
 	downloadsLimit, _ := strconv.Atoi(r.FormValue("downloads_limit"))
 	requireAuth := r.FormValue("require_auth") == "true"
+	allowMagicLink := r.FormValue("allow_magic_link") != "false"
 	unlimitedTime := r.FormValue("unlimited_time") == "true"
 	unlimitedDownloads := r.FormValue("unlimited_downloads") == "true"
 	filePassword := r.FormValue("file_password")
 	sendToEmail := r.FormValue("send_to_email")
 	fileComment := r.FormValue("file_comment")
+	notifyRejections := r.FormValue("notify_rejected_recipients") == "true"
+
+	// Named recipients only make sense when recipients have to sign in
+	allowedRecipients, err := database.NormalizeAllowedRecipients(r.FormValue("allowed_recipients"))
+	if err != nil {
+		s.sendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if allowedRecipients != "" {
+		requireAuth = true
+	}
+
 	// Parse form to get array values
 	if err := r.ParseForm(); err != nil {
 		log.Printf("Warning: Failed to parse form: %v", err)
@@ -106,6 +125,11 @@ func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Check free disk space for the actual file size
+	if !s.checkUploadSpace(w, fileSize) {
+		return
+	}
+
 	// Generate file ID
 	fileID, err := generateFileID()
 	if err != nil {
@@ -114,7 +138,11 @@ func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Save file to disk
-	uploadPath := filepath.Join(s.config.UploadsDir, fileID)
+	uploadPath, err := storage.CreatePath(s.config.UploadsDir, fileID)
+	if err != nil {
+		s.sendError(w, http.StatusInternalServerError, "Failed to save file")
+		return
+	}
 	dst, err := os.Create(uploadPath)
 	if err != nil {
 		s.sendError(w, http.StatusInternalServerError, "Failed to save file")
@@ -157,6 +185,8 @@ func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	expireAt, expireAtString, unlimitedTime = limitExpireAt(user, expireAt, unlimitedTime)
+
 	// Handle downloads limit
 	if unlimitedDownloads {
 		downloadsLimit = 999999 // Set high value for unlimited
@@ -164,13 +194,21 @@ func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
 		downloadsLimit = 10 // Default to 10 if not specified
 	}
 
+	// File passwords are only stored as hashes
+	passwordHash, err := database.HashFilePassword(filePassword)
+	if err != nil {
+		os.Remove(uploadPath)
+		s.sendError(w, http.StatusInternalServerError, "Failed to save file password")
+		return
+	}
+
 	// Save file metadata to database
 	fileInfo := &database.FileInfo{
 		Id:                 fileID,
 		Name:               header.Filename,
 		Size:               database.FormatFileSize(fileSize),
 		SHA1:               sha1Hash,
-		FilePasswordPlain:  filePassword,
+		PasswordHash:       passwordHash,
 		ContentType:        header.Header.Get("Content-Type"),
 		ExpireAtString:     expireAtString,
 		ExpireAt:           expireAt,
@@ -183,7 +221,11 @@ func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
 		UnlimitedDownloads: unlimitedDownloads,
 		UnlimitedTime:      unlimitedTime,
 		RequireAuth:        requireAuth,
+		AllowMagicLink:     allowMagicLink,
+		AllowedRecipients:  allowedRecipients,
+		NotifyRejections:   notifyRejections,
 	}
+	fileInfo.Compression, fileInfo.StoredSizeBytes = compressAtRest(uploadPath, fileInfo.ContentType, fileInfo.Name)
 
 	if err := database.DB.SaveFile(fileInfo); err != nil {
 		os.Remove(uploadPath)
@@ -407,12 +449,14 @@ func (s *Server) handleDownload(w http.ResponseWriter, r *http.Request) {
 	// Check if this is a direct download request (from iframe redirect)
 	isDirect := r.URL.Query().Get("direct") == "1"
 
-	// If direct download and user has session, just download
-	if isDirect && fileInfo.RequireAuth {
+	// If direct download and user has session, just download. Download sessions
+	// are not tied to a file, so a file password still needs a valid grant.
+	if isDirect && fileInfo.RequireAuth && (!fileInfo.HasPassword() || s.hasFilePasswordGrant(r, fileInfo)) {
 		cookie, err := r.Cookie("download_session_" + fileInfo.Id)
 		if err == nil {
-			account, err := database.DB.GetDownloadAccountByEmail(cookie.Value)
-			if err == nil && account.IsActive {
+			account, err := auth.GetDownloadAccountBySession(cookie.Value)
+			if err == nil && downloadAccountVerified(account) && downloadSessionAllowed(cookie.Value, fileInfo) &&
+				fileInfo.RecipientAllowed(account.Email) {
 				s.performDownload(w, r, fileInfo, account)
 				return
 			}
@@ -420,7 +464,7 @@ func (s *Server) handleDownload(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if file password is required
-	if fileInfo.FilePasswordPlain != "" {
+	if fileInfo.HasPassword() {
 		s.handlePasswordProtectedDownload(w, r, fileInfo)
 		return
 	}
@@ -437,9 +481,8 @@ func (s *Server) handleDownload(w http.ResponseWriter, r *http.Request) {
 
 // handlePasswordProtectedDownload handles downloads that require a password
 func (s *Server) handlePasswordProtectedDownload(w http.ResponseWriter, r *http.Request, fileInfo *database.FileInfo) {
-	// Check if password has been verified (via session cookie)
-	cookie, err := r.Cookie("password_verified_" + fileInfo.Id)
-	if err == nil && cookie.Value == "true" {
+	// Check if password has been verified (via a signed grant cookie)
+	if s.hasFilePasswordGrant(r, fileInfo) {
 		// Password already verified, check if also requires auth
 		if fileInfo.RequireAuth {
 			s.handleAuthenticatedDownload(w, r, fileInfo)
@@ -463,21 +506,29 @@ func (s *Server) handlePasswordProtectedDownload(w http.ResponseWriter, r *http.
 			return
 		}
 
+		lockKeys := []string{auth.FileLockKey(fileInfo.Id), s.ipLockKey(r)}
+		if until := auth.LockedUntil(lockKeys...); !until.IsZero() {
+			logLockedAttempt(r, "", "file_password", until)
+			s.renderPasswordPromptPage(w, fileInfo, auth.LockoutMessage(until))
+			return
+		}
+
 		// Verify password
-		if providedPassword != fileInfo.FilePasswordPlain {
+		if !auth.CheckPasswordHash(providedPassword, fileInfo.PasswordHash) {
+			ownerEmail := ""
+			if owner, err := database.DB.GetUserByID(fileInfo.UserId); err == nil {
+				ownerEmail = owner.Email
+			}
+			s.recordFailedAttempt(r, "file_password", ownerEmail, lockKeys...)
 			s.renderPasswordPromptPage(w, fileInfo, "Incorrect password")
 			return
 		}
+		auth.ClearFailures(lockKeys[0])
 
-		// Password correct, set session cookie
-		http.SetCookie(w, &http.Cookie{
-			Name:     "password_verified_" + fileInfo.Id,
-			Value:    "true",
-			Path:     "/d/" + fileInfo.Id,
-			Expires:  time.Now().Add(24 * time.Hour),
-			HttpOnly: true,
-			SameSite: http.SameSiteStrictMode,
-		})
+		// Password correct, remember it with a short-lived grant
+		if err := s.issueFilePasswordGrant(w, r, fileInfo); err != nil {
+			log.Printf("Error issuing password grant for file %s: %v", fileInfo.Id, err)
+		}
 
 		// Check if also requires authentication
 		if fileInfo.RequireAuth {
@@ -500,6 +551,10 @@ func (s *Server) handleAuthenticatedDownload(w http.ResponseWriter, r *http.Requ
 	// NOTE: /d/ route doesn't use requireAuth middleware, so we need to manually check session
 	user, err := s.getUserFromSession(r)
 	if err == nil && user != nil {
+		if !userMayDownload(user, fileInfo) {
+			s.rejectRecipient(w, r, fileInfo, user.Email)
+			return
+		}
 		// User is already logged in as regular user/admin - allow download
 		log.Printf("Regular user %s (%s) authenticated for file download", user.Name, user.Email)
 		s.performDownload(w, r, fileInfo, nil)
@@ -507,25 +562,37 @@ func (s *Server) handleAuthenticatedDownload(w http.ResponseWriter, r *http.Requ
 	}
 
 	// Check if user has download session
+	authMsg := ""
 	cookie, err := r.Cookie("download_session_" + fileInfo.Id)
 	if err == nil {
 		// User has session, check if valid
-		account, err := database.DB.GetDownloadAccountByEmail(cookie.Value)
-		if err == nil && account.IsActive {
-			// Valid session, perform download
-			s.performDownload(w, r, fileInfo, account)
-			return
+		account, err := auth.GetDownloadAccountBySession(cookie.Value)
+		if err == nil && downloadAccountVerified(account) {
+			if !fileInfo.RecipientAllowed(account.Email) {
+				s.rejectRecipient(w, r, fileInfo, account.Email)
+				return
+			}
+			if downloadSessionAllowed(cookie.Value, fileInfo) {
+				// Valid session, perform download
+				s.performDownload(w, r, fileInfo, account)
+				return
+			}
+			authMsg = "This file requires signing in with your password"
 		}
 	}
 
 	// No valid session, show login/create account page
 	if r.Method == http.MethodPost {
+		if r.FormValue("verification_code") != "" {
+			s.handleDownloadVerificationCode(w, r, fileInfo)
+			return
+		}
 		s.handleDownloadAccountCreation(w, r, fileInfo)
 		return
 	}
 
 	// Show download auth page
-	s.renderDownloadAuthPage(w, fileInfo, "")
+	s.renderDownloadAuthPage(w, fileInfo, authMsg)
 }
 
 // handleDownloadAccountCreation handles creation of download account
@@ -544,42 +611,56 @@ func (s *Server) handleDownloadAccountCreation(w http.ResponseWriter, r *http.Re
 		return
 	}
 
+	lockKeys := []string{loginAccountKey(email), s.ipLockKey(r)}
+	if until := auth.LockedUntil(lockKeys...); !until.IsZero() {
+		logLockedAttempt(r, email, "password", until)
+		s.renderDownloadAuthPage(w, fileInfo, auth.LockoutMessage(until))
+		return
+	}
+
 	// First check if this email belongs to a regular user or admin
 	regularUser, err := database.DB.GetUserByEmail(email)
 	if err == nil {
 		// User exists as regular user/admin - verify password
 		if !auth.CheckPasswordHash(password, regularUser.Password) {
+			s.recordFailedAttempt(r, "password", regularUser.Email, lockKeys...)
 			s.renderDownloadAuthPage(w, fileInfo, "Invalid credentials")
 			return
 		}
+		auth.ClearFailures(lockKeys[0])
+
+		if !userMayDownload(regularUser, fileInfo) {
+			s.rejectRecipient(w, r, fileInfo, regularUser.Email)
+			return
+		}
 
 		// Valid regular user - create session and allow download
 		log.Printf("Regular user %s (%s) authenticated for file download", regularUser.Name, regularUser.Email)
 
 		// Create a regular user session
-		sessionToken, err := auth.CreateSession(regularUser.Id)
+		sessionToken, err := auth.CreateSession(regularUser.Id, getClientIP(r), r.UserAgent())
 		if err != nil {
 			log.Printf("Warning: Could not create session for user: %v", err)
 			s.renderDownloadAuthPage(w, fileInfo, "Authentication failed")
 			return
 		}
 
+		s.checkLoginDevice(r, regularUser)
+
 		// Set session cookie
-		http.SetCookie(w, &http.Cookie{
-			Name:     "session",
-			Value:    sessionToken,
-			Path:     "/",
-			Expires:  time.Now().Add(24 * time.Hour),
-			HttpOnly: true,
-			Secure:   false,
-			SameSite: http.SameSiteLaxMode,
-		})
+		setSessionCookie(w, sessionToken, http.SameSiteLaxMode)
 
 		// Redirect to download (browser will re-request with session cookie)
 		http.Redirect(w, r, "/d/"+fileInfo.Id, http.StatusSeeOther)
 		return
 	}
 
+	// Files restricted to named recipients don't let anyone else create an account or sign in
+	if !fileInfo.RecipientAllowed(email) {
+		s.rejectRecipient(w, r, fileInfo, email)
+		return
+	}
+
 	// Not a regular user, check if download account exists
 	account, err := database.DB.GetDownloadAccountByEmail(email)
 	isNewAccount := false
@@ -589,6 +670,10 @@ func (s *Server) handleDownloadAccountCreation(w http.ResponseWriter, r *http.Re
 			s.renderDownloadAuthPage(w, fileInfo, "Name is required for new accounts")
 			return
 		}
+		if err := checkDownloadAccountPassword(password, email, nil); err != nil {
+			s.renderDownloadAuthPage(w, fileInfo, err.Error())
+			return
+		}
 		account, err = createDownloadAccount(name, email, password)
 		if err != nil {
 			s.renderDownloadAuthPage(w, fileInfo, "Failed to create account: "+err.Error())
@@ -613,40 +698,58 @@ func (s *Server) handleDownloadAccountCreation(w http.ResponseWriter, r *http.Re
 	} else {
 		// Verify password for existing download account
 		if !checkDownloadPassword(password, account.Password) {
+			s.recordFailedAttempt(r, "password", account.Email, lockKeys...)
 			s.renderDownloadAuthPage(w, fileInfo, "Invalid credentials")
 			return
 		}
+		auth.ClearFailures(lockKeys[0])
 	}
 
-	// Set file-specific download session cookie
-	http.SetCookie(w, &http.Cookie{
-		Name:     "download_session_" + fileInfo.Id,
-		Value:    email,
-		Path:     "/d/" + fileInfo.Id,
-		Expires:  time.Now().Add(24 * time.Hour),
-		HttpOnly: true,
-		SameSite: http.SameSiteStrictMode,
-	})
+	// Download accounts must prove they own their email address before their first download
+	if !downloadAccountVerified(account) {
+		s.sendDownloadVerification(w, r, fileInfo, account)
+		return
+	}
 
-	// Set global download session for dashboard access (both new and existing accounts)
 	log.Printf("🔐 Setting up global session for download account: %s (new: %v)", email, isNewAccount)
-	sessionEmail, err := auth.CreateDownloadAccountSession(account.Id)
+	s.startDownloadSession(w, r, fileInfo.Id, account, database.DownloadAuthPassword)
+
+	// All download accounts get the redirect page (downloads file + redirects to dashboard)
+	s.performDownloadWithRedirect(w, r, fileInfo, account)
+}
+
+// startDownloadSession signs a download account in: for the file it is downloading,
+// if any, and globally for the download dashboard. Both cookies hold the same
+// server-side session, so logging out ends both.
+func (s *Server) startDownloadSession(w http.ResponseWriter, r *http.Request, fileId string, account *models.DownloadAccount, authMethod string) {
+	sessionID, err := auth.CreateDownloadAccountSession(account.Id, getClientIP(r), r.UserAgent(), authMethod)
 	if err != nil {
-		log.Printf("❌ Warning: Could not create global session: %v", err)
-	} else {
-		log.Printf("✅ Global download_session cookie set for: %s", sessionEmail)
+		log.Printf("❌ Warning: Could not create download session: %v", err)
+		return
+	}
+
+	// Set file-specific download session cookie
+	if fileId != "" {
 		http.SetCookie(w, &http.Cookie{
-			Name:     "download_session",
-			Value:    sessionEmail,
-			Path:     "/",
-			Expires:  time.Now().Add(24 * time.Hour),
+			Name:     "download_session_" + fileId,
+			Value:    sessionID,
+			Path:     "/d/" + fileId,
+			Expires:  downloadSessionExpiry(),
 			HttpOnly: true,
-			SameSite: http.SameSiteLaxMode,
+			SameSite: http.SameSiteStrictMode,
 		})
 	}
 
-	// All download accounts get the redirect page (downloads file + redirects to dashboard)
-	s.performDownloadWithRedirect(w, r, fileInfo, account)
+	// Set global download session for dashboard access (both new and existing accounts)
+	log.Printf("✅ Download session created for: %s", account.Email)
+	http.SetCookie(w, &http.Cookie{
+		Name:     "download_session",
+		Value:    sessionID,
+		Path:     "/",
+		Expires:  downloadSessionExpiry(),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
 }
 
 // performDownload performs the actual file download
@@ -665,12 +768,17 @@ func (s *Server) performDownload(w http.ResponseWriter, r *http.Request, fileInf
 		defer s.markTransferInactive(sessionId)
 	}
 
-	filePath := filepath.Join(s.config.UploadsDir, fileInfo.Id)
-
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		http.Error(w, "File not found on disk", http.StatusNotFound)
+	blob, err := storage.OpenFile(s.config.UploadsDir, fileInfo.Id)
+	if err != nil {
+		if os.IsNotExist(err) {
+			http.Error(w, "File not found on disk", http.StatusNotFound)
+		} else {
+			log.Printf("Error opening file %s: %v", fileInfo.Id, err)
+			http.Error(w, "Failed to read file", http.StatusInternalServerError)
+		}
 		return
 	}
+	defer blob.Close()
 
 	// Update download count
 	if err := database.DB.UpdateFileDownloadCount(fileInfo.Id); err != nil {
@@ -691,6 +799,7 @@ func (s *Server) performDownload(w http.ResponseWriter, r *http.Request, fileInf
 	if account != nil {
 		downloadLog.DownloadAccountId = account.Id
 		downloadLog.Email = account.Email
+		downloadLog.EmailVerifiedAt = account.EmailVerifiedAt
 		// Update account last used
 		database.DB.UpdateDownloadAccountLastUsed(account.Id)
 	}
@@ -738,7 +847,15 @@ func (s *Server) performDownload(w http.ResponseWriter, r *http.Request, fileInf
 	}
 
 	// Serve the file
-	http.ServeFile(w, r, filePath)
+	if fileInfo.Compression != "" {
+		s.serveCompressedBlob(w, r, blob, fileInfo)
+	} else {
+		var modTime time.Time
+		if stat, err := blob.Stat(); err == nil {
+			modTime = stat.ModTime()
+		}
+		http.ServeContent(w, r, "", modTime, blob)
+	}
 
 	// Calculate download duration
 	downloadDuration := time.Since(downloadStartTime)
@@ -798,10 +915,11 @@ func (s *Server) handleAPIFiles(w http.ResponseWriter, r *http.Request) {
 			"downloads_remaining": f.DownloadsRemaining,
 			"download_count":      f.DownloadCount,
 			"require_auth":        f.RequireAuth,
+			"allow_magic_link":    f.AllowMagicLink,
+			"allowed_recipients":  f.RecipientList(),
 			"unlimited_downloads": f.UnlimitedDownloads,
 			"unlimited_time":      f.UnlimitedTime,
-			"has_password":        f.FilePasswordPlain != "",
-			"file_password":       f.FilePasswordPlain,
+			"has_password":        f.HasPassword(),
 		})
 	}
 
@@ -817,6 +935,95 @@ func (s *Server) handleAPIDownload(w http.ResponseWriter, r *http.Request) {
 	s.handleDownload(w, r)
 }
 
+// checkUploadSpace rejects an upload with 507 Insufficient Storage when writing
+// size bytes would eat into the disk reserve on the uploads or data volume
+func (s *Server) checkUploadSpace(w http.ResponseWriter, size int64) bool {
+	err := storage.CheckSpaceForUpload(size, s.config.UploadsDir, s.config.DataDir)
+	if err == nil {
+		return true
+	}
+
+	log.Printf("Upload rejected: %v", err)
+	// Refresh the disk status right away so admins are alerted without waiting for the monitor
+	go storage.CheckDiskSpace(s.config.UploadsDir, s.config.DataDir)
+
+	s.sendError(w, http.StatusInsufficientStorage, "The server does not have enough free disk space to accept this upload. Please try again later or contact an administrator.")
+	return false
+}
+
+// serveCompressedBlob streams a blob that is stored compressed at rest. Clients
+// that accept the stored encoding get the compressed bytes passed through,
+// everyone else gets the content decompressed while streaming.
+func (s *Server) serveCompressedBlob(w http.ResponseWriter, r *http.Request, blob *os.File, fileInfo *database.FileInfo) {
+	w.Header().Set("Accept-Ranges", "none")
+	w.Header().Add("Vary", "Accept-Encoding")
+
+	var body io.Reader = blob
+	if acceptsEncoding(r, fileInfo.Compression) {
+		w.Header().Set("Content-Encoding", fileInfo.Compression)
+		w.Header().Set("Content-Length", strconv.FormatInt(fileInfo.PhysicalSize(), 10))
+	} else {
+		decoded, err := storage.DecodeBlob(blob, fileInfo.Compression)
+		if err != nil {
+			log.Printf("Error opening compressed file %s: %v", fileInfo.Id, err)
+			w.Header().Del("Content-Length")
+			http.Error(w, "Failed to read file", http.StatusInternalServerError)
+			return
+		}
+		defer decoded.Close()
+		body = decoded
+		w.Header().Set("Content-Length", strconv.FormatInt(fileInfo.SizeBytes, 10))
+	}
+
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	if _, err := io.Copy(w, body); err != nil {
+		log.Printf("Error streaming file %s: %v", fileInfo.Id, err)
+	}
+}
+
+// acceptsEncoding reports whether the client's Accept-Encoding header allows
+// the given content coding
+func acceptsEncoding(r *http.Request, encoding string) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(fields[0]), encoding) {
+			continue
+		}
+		for _, param := range fields[1:] {
+			param = strings.ReplaceAll(strings.TrimSpace(param), " ", "")
+			if param == "q=0" || param == "q=0.0" || param == "q=0.00" || param == "q=0.000" {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// compressAtRest compresses a freshly uploaded blob when compression at rest is
+// enabled and the file type benefits from it. It returns the compression applied
+// and the physical size on disk (0 when the blob was stored as-is).
+func compressAtRest(path, contentType, fileName string) (string, int64) {
+	if !storage.CompressionEnabled() || !storage.IsCompressible(contentType, fileName) {
+		return "", 0
+	}
+
+	compression, storedSize, err := storage.CompressFile(path)
+	if err != nil {
+		log.Printf("Warning: Could not compress %s at rest: %v", fileName, err)
+		return "", 0
+	}
+	if compression == "" {
+		return "", 0
+	}
+
+	log.Printf("Compressed %s at rest: %s on disk", fileName, database.FormatFileSize(storedSize))
+	return compression, storedSize
+}
+
 // generateFileID generates a random file ID
 func generateFileID() (string, error) {
 	bytes := make([]byte, 16)
@@ -844,6 +1051,7 @@ func createDownloadAccount(name, email, password string) (*models.DownloadAccoun
 	if err := database.DB.CreateDownloadAccount(account); err != nil {
 		return nil, err
 	}
+	passwords.Record(database.AccountTypeDownloadAccount, account.Id, account.Password)
 
 	return account, nil
 }
@@ -1200,7 +1408,7 @@ func (s *Server) renderDownloadAuthPage(w http.ResponseWriter, fileInfo *databas
         </div>`
 
 	if errorMsg != "" {
-		html += `<div class="error">` + errorMsg + `</div>`
+		html += `<div class="error">` + template.HTMLEscapeString(errorMsg) + `</div>`
 	}
 
 	html += `
@@ -1231,6 +1439,25 @@ func (s *Server) renderDownloadAuthPage(w http.ResponseWriter, fileInfo *databas
                 </button>
             </form>
         </div>
+`
+
+	if fileInfo.AllowMagicLink {
+		html += `
+        <div class="auth-section" style="margin-top: 24px; padding-top: 24px; border-top: 1px solid #e0e0e0;">
+            <h3>Forgot your password?</h3>
+            <p style="font-size: 13px; color: #666; margin-bottom: 12px;">Already have an account? We can email you a single-use link that signs you in without a password.</p>
+            <form method="POST" action="/download/magic-link">
+                <input type="hidden" name="file_id" value="` + fileInfo.Id + `">
+                <div class="form-group">
+                    <label for="magic_email">Email</label>
+                    <input type="email" id="magic_email" name="email" required>
+                </div>
+                <button type="submit" class="btn">📧 Email Me a Sign-In Link</button>
+            </form>
+        </div>`
+	}
+
+	html += `
 
         <div style="text-align: center; margin-top: 20px; color: #999; font-size: 12px;">
             ` + s.config.FooterText + `
@@ -1584,12 +1811,14 @@ func (s *Server) renderSplashPageExpired(w http.ResponseWriter, fileInfo *databa
 
 // performDownloadWithRedirect performs a download and redirects to dashboard (for new accounts)
 func (s *Server) performDownloadWithRedirect(w http.ResponseWriter, r *http.Request, fileInfo *database.FileInfo, account *models.DownloadAccount) {
-	filePath := filepath.Join(s.config.UploadsDir, fileInfo.Id)
-
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+	blob, err := storage.OpenFile(s.config.UploadsDir, fileInfo.Id)
+	if os.IsNotExist(err) {
 		http.Error(w, "File not found on disk", http.StatusNotFound)
 		return
 	}
+	if err == nil {
+		blob.Close()
+	}
 
 	// Update download count
 	if err := database.DB.UpdateFileDownloadCount(fileInfo.Id); err != nil {
@@ -1607,6 +1836,7 @@ func (s *Server) performDownloadWithRedirect(w http.ResponseWriter, r *http.Requ
 		IsAuthenticated:   true,
 		DownloadAccountId: account.Id,
 		Email:             account.Email,
+		EmailVerifiedAt:   account.EmailVerifiedAt,
 	}
 
 	if err := database.DB.CreateDownloadLog(downloadLog); err != nil {
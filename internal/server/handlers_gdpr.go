@@ -12,9 +12,11 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/Frimurare/WulfVault/internal/auth"
 	"github.com/Frimurare/WulfVault/internal/database"
 	"github.com/Frimurare/WulfVault/internal/email"
 	"github.com/Frimurare/WulfVault/internal/models"
+	"github.com/Frimurare/WulfVault/internal/sessionpolicy"
 )
 
 // handleDownloadAccountGDPR shows download account self-service page with GDPR delete option
@@ -93,35 +95,36 @@ func (s *Server) handleDownloadAccountDelete(w http.ResponseWriter, r *http.Requ
 
 // getDownloadAccountFromSession retrieves download account from session cookie
 func (s *Server) getDownloadAccountFromSession(r *http.Request) (*models.DownloadAccount, error) {
-	// Try to get the download_session cookie
 	cookie, err := r.Cookie("download_session")
 	if err != nil {
-		log.Printf("DEBUG: download_session cookie not found: %v. All cookies: %v", err, r.Cookies())
 		return nil, http.ErrNoCookie
 	}
 
-	log.Printf("DEBUG: Found download_session cookie with value: %s", cookie.Value)
-
-	// The cookie value is the email address
-	account, err := database.DB.GetDownloadAccountByEmail(cookie.Value)
+	account, err := auth.GetDownloadAccountBySession(cookie.Value)
 	if err != nil {
-		log.Printf("DEBUG: Failed to get account by email %s: %v", cookie.Value, err)
-		return nil, http.ErrNoCookie
+		return nil, err
 	}
+	return account, nil
+}
 
-	if !account.IsActive {
-		log.Printf("DEBUG: Account %s is not active", cookie.Value)
-		return nil, http.ErrNoCookie
+// downloadSessionLimitsText describes when download account sessions end, in Swedish like the rest of the page
+func downloadSessionLimitsText() string {
+	limits := sessionpolicy.LoadPolicy().Global()
+	if limits.IdleTimeout == 0 {
+		return "Inloggningar avslutas efter " + strconv.Itoa(int(limits.Lifetime.Hours())) + " timmar."
 	}
-
-	log.Printf("DEBUG: Successfully retrieved download account: %s", account.Email)
-	return account, nil
+	return "Inloggningar avslutas efter " + strconv.Itoa(int(limits.IdleTimeout.Minutes())) + " minuters inaktivitet."
 }
 
 // renderDownloadAccountGDPRPage renders the GDPR self-service page
 func (s *Server) renderDownloadAccountGDPRPage(w http.ResponseWriter, account *models.DownloadAccount, errorMsg string) {
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 
+	sessionCount, err := database.DB.CountDownloadSessionsByAccount(account.Id)
+	if err != nil {
+		log.Printf("Failed to count sessions of download account %d: %v", account.Id, err)
+	}
+
 	// Get branding config
 	brandingConfig, _ := database.DB.GetBrandingConfig()
 	logoData := brandingConfig["branding_logo"]
@@ -435,6 +438,14 @@ func (s *Server) renderDownloadAccountGDPRPage(w http.ResponseWriter, account *m
                 <p><strong>Status:</strong> <span style="color: #38a169;">Aktiv</span></p>
             </div>
 
+            <div class="account-info">
+                <h3 style="margin-bottom: 15px; color: #2d3748;">Inloggningar</h3>
+                <p>Du är inloggad i <strong>` + strconv.Itoa(sessionCount) + `</strong> webbläsare. ` + downloadSessionLimitsText() + `</p>
+                <form method="POST" action="/download/logout-everywhere" style="margin-top: 15px;">
+                    <button type="submit" class="btn" style="background: #4a5568; color: white;">Logga ut överallt</button>
+                </form>
+            </div>
+
             <div class="danger-zone">
                 <h2>
                     <svg width="20" height="20" viewBox="0 0 20 20" fill="currentColor">
@@ -0,0 +1,440 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Frimurare/WulfVault/internal/auth"
+	"github.com/Frimurare/WulfVault/internal/database"
+	"github.com/Frimurare/WulfVault/internal/models"
+	"github.com/Frimurare/WulfVault/internal/sessionpolicy"
+)
+
+// impersonatorCookie holds the super admin's own session while they view the app
+// as another user, so that it can be restored when they stop
+const impersonatorCookie = "impersonator_session"
+
+// impersonationMinutes are the durations a super admin can choose from
+var impersonationMinutes = []int{15, 30, 60}
+
+// impersonationBlockedPaths are never available while impersonating, even when
+// changes are allowed: they manage the user's credentials or personal data
+var impersonationBlockedPaths = []string{
+	"/change-password",
+	"/settings/account",
+	"/settings/delete-account",
+	"/settings/api-keys/",
+	"/settings/passkeys/",
+	"/settings/sessions/",
+	"/2fa/",
+	"/api/v1/user/export-data",
+	"/sudo",
+	"/sudo/",
+}
+
+// impersonation is a request made by a super admin viewing the app as a user
+type impersonation struct {
+	*database.Impersonation
+	Admin *models.User
+}
+
+// impersonationBlocked returns why a request is not allowed while impersonating, or ""
+func impersonationBlocked(r *http.Request, imp *database.Impersonation) string {
+	for _, path := range impersonationBlockedPaths {
+		if r.URL.Path == path || strings.HasSuffix(path, "/") && strings.HasPrefix(r.URL.Path, path) {
+			return "Credentials and personal data cannot be managed while viewing as another user"
+		}
+	}
+	if !imp.Writable && r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return "Changes are not allowed while viewing as another user"
+	}
+	return ""
+}
+
+// serveImpersonated serves a request made with a session a super admin started
+// to view the app as a user. Every request is audited for both of them.
+func (s *Server) serveImpersonated(w http.ResponseWriter, r *http.Request, sessionId string, user *models.User, imp *database.Impersonation, next http.HandlerFunc) {
+	admin, err := database.DB.GetUserByID(imp.AdminId)
+	if err != nil || !admin.IsActive || !admin.IsSuperAdmin() {
+		s.endImpersonation(w, r, sessionId, imp, "admin_no_longer_allowed")
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	// The admin's own session keeps idling; once its inactivity timeout has
+	// passed (or it is gone) they are returned to it, which then signs them out
+	var adminSession *database.Session
+	if cookie, err := r.Cookie(impersonatorCookie); err == nil {
+		adminSession, _ = database.DB.GetSession(cookie.Value)
+	}
+	if adminSession == nil || (!adminSession.Remembered &&
+		sessionpolicy.LoadPolicy().For(admin).Idle(sessionLastSeen(adminSession, admin), time.Now())) {
+		s.endImpersonation(w, r, sessionId, imp, "inactivity")
+		http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+		return
+	}
+	database.DB.UpdateUserLastOnline(admin.Id)
+	database.DB.TouchSession(adminSession.Id)
+
+	blocked := impersonationBlocked(r, imp)
+	database.DB.LogAction(&database.AuditLogEntry{
+		UserID:     int64(user.Id),
+		UserEmail:  user.Email,
+		Action:     database.ActionImpersonatedRequest,
+		EntityType: database.EntitySession,
+		EntityID:   auth.SessionHandle(sessionId),
+		Details: database.CreateAuditDetails(map[string]interface{}{
+			"method":      r.Method,
+			"path":        r.URL.Path,
+			"admin_email": admin.Email,
+		}),
+		IPAddress:         getClientIP(r),
+		UserAgent:         r.UserAgent(),
+		Success:           blocked == "",
+		ErrorMsg:          blocked,
+		ImpersonatorID:    int64(admin.Id),
+		ImpersonatorEmail: admin.Email,
+	})
+
+	if blocked != "" {
+		if r.Method == http.MethodGet && !strings.HasPrefix(r.URL.Path, "/api/") {
+			http.Error(w, blocked, http.StatusForbidden)
+		} else {
+			s.sendError(w, http.StatusForbidden, blocked)
+		}
+		return
+	}
+
+	current := &impersonation{Impersonation: imp, Admin: admin}
+	ctx := contextWithImpersonation(contextWithUser(r.Context(), user), current)
+	next(&impersonationBannerWriter{ResponseWriter: w, banner: impersonationBanner(user, current)}, r.WithContext(ctx))
+}
+
+// endImpersonation deletes an impersonation session and gives the super admin
+// their own session back
+func (s *Server) endImpersonation(w http.ResponseWriter, r *http.Request, sessionId string, imp *database.Impersonation, reason string) {
+	auth.DeleteSession(sessionId)
+
+	adminSession := ""
+	if cookie, err := r.Cookie(impersonatorCookie); err == nil {
+		adminSession = cookie.Value
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     impersonatorCookie,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+	if adminSession != "" {
+		setSessionCookie(w, adminSession, http.SameSiteStrictMode)
+	} else {
+		http.SetCookie(w, &http.Cookie{
+			Name:     "session",
+			Value:    "",
+			Path:     "/",
+			MaxAge:   -1,
+			HttpOnly: true,
+		})
+	}
+
+	adminEmail, userEmail := "", ""
+	if admin, err := database.DB.GetUserByID(imp.AdminId); err == nil {
+		adminEmail = admin.Email
+	}
+	if user, err := database.DB.GetUserByID(imp.UserId); err == nil {
+		userEmail = user.Email
+	}
+	database.DB.LogAction(&database.AuditLogEntry{
+		UserID:     int64(imp.AdminId),
+		UserEmail:  adminEmail,
+		Action:     database.ActionImpersonationEnded,
+		EntityType: database.EntityUser,
+		EntityID:   strconv.Itoa(imp.UserId),
+		Details: database.CreateAuditDetails(map[string]interface{}{
+			"email":  userEmail,
+			"reason": reason,
+		}),
+		IPAddress: getClientIP(r),
+		UserAgent: r.UserAgent(),
+		Success:   true,
+	})
+}
+
+// restoreImpersonator gives a super admin their own session back after an
+// impersonation session disappeared. It reports whether there was one to restore.
+func (s *Server) restoreImpersonator(w http.ResponseWriter, r *http.Request) bool {
+	cookie, err := r.Cookie(impersonatorCookie)
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     impersonatorCookie,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+	setSessionCookie(w, cookie.Value, http.SameSiteStrictMode)
+	return true
+}
+
+// handleAdminImpersonate starts viewing the app as a user
+// POST /admin/users/impersonate
+func (s *Server) handleAdminImpersonate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	admin, _ := userFromContext(r.Context())
+	if !admin.IsSuperAdmin() {
+		s.sendError(w, http.StatusForbidden, "Only the super admin can view the app as another user")
+		return
+	}
+	if _, ok := impersonationFromContext(r.Context()); ok {
+		s.sendError(w, http.StatusBadRequest, "Stop viewing as the current user first")
+		return
+	}
+
+	target, err := database.DB.GetUserByID(mustParseInt(r.FormValue("user_id")))
+	if err != nil || target.DeletedAt != 0 {
+		s.sendError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	switch {
+	case target.Id == admin.Id:
+		s.sendError(w, http.StatusBadRequest, "You cannot view the app as yourself")
+		return
+	case target.IsSuperAdmin():
+		s.sendError(w, http.StatusForbidden, "You cannot view the app as the super admin")
+		return
+	case !target.IsActive:
+		s.sendError(w, http.StatusBadRequest, "The user is deactivated")
+		return
+	}
+
+	reason := strings.TrimSpace(r.FormValue("reason"))
+	if reason == "" {
+		s.sendError(w, http.StatusBadRequest, "Enter why you need to view the app as this user")
+		return
+	}
+	if len(reason) > 500 {
+		reason = reason[:500]
+	}
+
+	minutes := impersonationMinutes[1]
+	if m, err := strconv.Atoi(r.FormValue("minutes")); err == nil {
+		for _, allowed := range impersonationMinutes {
+			if m == allowed {
+				minutes = m
+			}
+		}
+	}
+	writable := r.FormValue("allow_changes") == "true"
+
+	sessionId, err := auth.CreateImpersonationSession(admin.Id, target.Id, time.Duration(minutes)*time.Minute, writable, getClientIP(r), r.UserAgent())
+	if err != nil {
+		log.Printf("Failed to create impersonation session for user %d: %v", target.Id, err)
+		s.sendError(w, http.StatusInternalServerError, "Failed to start session")
+		return
+	}
+
+	database.DB.LogAction(&database.AuditLogEntry{
+		UserID:     int64(admin.Id),
+		UserEmail:  admin.Email,
+		Action:     database.ActionImpersonationStarted,
+		EntityType: database.EntityUser,
+		EntityID:   strconv.Itoa(target.Id),
+		Details: database.CreateAuditDetails(map[string]interface{}{
+			"email":         target.Email,
+			"reason":        reason,
+			"minutes":       minutes,
+			"allow_changes": writable,
+			"session":       auth.SessionHandle(sessionId),
+		}),
+		IPAddress: getClientIP(r),
+		UserAgent: r.UserAgent(),
+		Success:   true,
+	})
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     impersonatorCookie,
+		Value:    currentSessionID(r),
+		Path:     "/",
+		Expires:  time.Now().Add(24 * time.Hour),
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     "session",
+		Value:    sessionId,
+		Path:     "/",
+		Expires:  time.Now().Add(time.Duration(minutes) * time.Minute),
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+
+	s.sendJSON(w, http.StatusOK, map[string]interface{}{
+		"success":  true,
+		"redirect": homePath(target),
+	})
+}
+
+// handleImpersonationStop stops viewing the app as a user
+// POST /impersonation/stop
+func (s *Server) handleImpersonationStop(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	imp, err := database.DB.GetSessionImpersonation(currentSessionID(r))
+	if err == nil && imp != nil {
+		s.endImpersonation(w, r, currentSessionID(r), imp, "stopped")
+	} else if !s.restoreImpersonator(w, r) {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+}
+
+// impersonationBanner returns the banner shown at the top of every page while
+// a super admin views the app as a user
+func impersonationBanner(user *models.User, imp *impersonation) string {
+	access := "read-only"
+	if imp.Writable {
+		access = "changes allowed"
+	}
+	return fmt.Sprintf(`
+<div style="position: sticky; top: 0; z-index: 10000; display: flex; align-items: center; justify-content: center; gap: 16px; flex-wrap: wrap; padding: 10px 20px; background: #b71c1c; color: white; font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif; font-size: 14px;">
+    <span>👁️ You are viewing as <strong>%s</strong> (%s) &middot; %s &middot; ends at %s</span>
+    <form method="POST" action="/impersonation/stop" style="margin: 0;">
+        <button type="submit" style="padding: 6px 14px; background: white; color: #b71c1c; border: none; border-radius: 4px; font-weight: 600; cursor: pointer;">Stop Viewing</button>
+    </form>
+</div>`,
+		template.HTMLEscapeString(user.Name), template.HTMLEscapeString(user.Email), access,
+		time.Unix(imp.ValidUntil, 0).Format("15:04"))
+}
+
+// impersonationBannerWriter inserts the impersonation banner after the opening
+// body tag of HTML pages
+type impersonationBannerWriter struct {
+	http.ResponseWriter
+	banner   string
+	inserted bool
+}
+
+func (bw *impersonationBannerWriter) WriteHeader(status int) {
+	if strings.HasPrefix(bw.Header().Get("Content-Type"), "text/html") {
+		bw.Header().Del("Content-Length")
+	}
+	bw.ResponseWriter.WriteHeader(status)
+}
+
+func (bw *impersonationBannerWriter) Write(p []byte) (int, error) {
+	if bw.inserted {
+		return bw.ResponseWriter.Write(p)
+	}
+	contentType := bw.Header().Get("Content-Type")
+	if contentType == "" {
+		contentType = http.DetectContentType(p)
+	}
+	if !strings.HasPrefix(contentType, "text/html") {
+		bw.inserted = true
+		return bw.ResponseWriter.Write(p)
+	}
+
+	start := bytes.Index(p, []byte("<body"))
+	if start < 0 {
+		return bw.ResponseWriter.Write(p)
+	}
+	end := bytes.IndexByte(p[start:], '>')
+	if end < 0 {
+		return bw.ResponseWriter.Write(p)
+	}
+	end += start + 1
+
+	bw.inserted = true
+	bw.Header().Del("Content-Length")
+	page := make([]byte, 0, len(p)+len(bw.banner))
+	page = append(page, p[:end]...)
+	page = append(page, bw.banner...)
+	page = append(page, p[end:]...)
+	if _, err := bw.ResponseWriter.Write(page); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush lets streaming responses pass through the banner writer
+func (bw *impersonationBannerWriter) Flush() {
+	if f, ok := bw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap gives http.ResponseController access to the underlying writer
+func (bw *impersonationBannerWriter) Unwrap() http.ResponseWriter {
+	return bw.ResponseWriter
+}
+
+// renderAdminAccessHistory lists the times a super admin viewed the app as a user,
+// for the user's own settings page
+func renderAdminAccessHistory(userId int) string {
+	entries, err := database.DB.GetAuditLogs(&database.AuditLogFilter{
+		Action:     database.ActionImpersonationStarted,
+		EntityType: database.EntityUser,
+		EntityID:   strconv.Itoa(userId),
+		Limit:      20,
+	})
+	if err != nil {
+		log.Printf("Error fetching impersonations of user %d: %v", userId, err)
+		return `<div class="alert alert-error">Failed to load administrator access</div>`
+	}
+	if len(entries) == 0 {
+		return `<p style="color: #999;">No administrator has viewed the app as you.</p>`
+	}
+
+	rows := ""
+	for _, entry := range entries {
+		var details struct {
+			Reason       string `json:"reason"`
+			Minutes      int    `json:"minutes"`
+			AllowChanges bool   `json:"allow_changes"`
+		}
+		json.Unmarshal([]byte(entry.Details), &details)
+		access := "Read-only"
+		if details.AllowChanges {
+			access = "Changes allowed"
+		}
+		rows += fmt.Sprintf(`
+                    <tr>
+                        <td>%s</td>
+                        <td>%s</td>
+                        <td>%d min, %s</td>
+                        <td>%s</td>
+                    </tr>`,
+			time.Unix(entry.Timestamp, 0).Format("2006-01-02 15:04"),
+			template.HTMLEscapeString(entry.UserEmail),
+			details.Minutes, access,
+			template.HTMLEscapeString(details.Reason))
+	}
+	return `<table class="api-key-table">
+                <thead><tr><th>Started</th><th>Administrator</th><th>Access</th><th>Reason</th></tr></thead>
+                <tbody>` + rows + `
+                </tbody>
+            </table>`
+}
@@ -0,0 +1,374 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Frimurare/WulfVault/internal/auth"
+	"github.com/Frimurare/WulfVault/internal/database"
+	"github.com/Frimurare/WulfVault/internal/directory"
+	"github.com/Frimurare/WulfVault/internal/models"
+)
+
+// authenticateDirectory signs a staff user in against LDAP. handled is false when
+// the login does not belong to the directory (LDAP is off, or the account is the
+// super admin, an OIDC account or a download account) and the local password
+// should be checked instead. Accounts linked to LDAP never fall back to their
+// local password, so disabling a user in the directory takes effect immediately.
+func (s *Server) authenticateDirectory(login, password string, r *http.Request) (result *auth.AuthResult, handled bool, err error) {
+	settings := directory.LoadSettings()
+	if !settings.Configured() {
+		return nil, false, nil
+	}
+
+	// Unlinked local users may sign in with either password; they are linked to
+	// the directory on their first directory login
+	localFallback := false
+	user, err := database.DB.GetUserByEmail(login)
+	if err != nil {
+		user, err = database.DB.GetUserByName(login)
+	}
+	if err == nil {
+		if user.UserLevel == models.UserLevelSuperAdmin {
+			return nil, false, nil
+		}
+		source, _, err := database.DB.GetUserAuthSource(user.Id)
+		if err != nil || (source != database.AuthSourceLDAP && source != database.AuthSourceLocal) {
+			return nil, false, nil
+		}
+		localFallback = source == database.AuthSourceLocal
+	} else if _, err := database.DB.GetDownloadAccountByEmail(login); err == nil {
+		return nil, false, nil
+	}
+
+	entry, err := directory.Connect(settings).Authenticate(login, password)
+	if err != nil {
+		if !errors.Is(err, directory.ErrInvalidCredentials) {
+			log.Printf("LDAP authentication error: %v", err)
+		}
+		return nil, !localFallback, err
+	}
+
+	user, created, err := auth.ResolveExternalUser(settings.Identity(entry), settings.AutoProvision, s.defaultQuotaMB())
+	if err != nil {
+		return nil, true, err
+	}
+
+	if created {
+		database.DB.LogAction(&database.AuditLogEntry{
+			UserID:     0,
+			UserEmail:  "system",
+			Action:     database.ActionUserCreated,
+			EntityType: database.EntityUser,
+			EntityID:   fmt.Sprintf("%d", user.Id),
+			Details: database.CreateAuditDetails(map[string]interface{}{
+				"email":       user.Email,
+				"name":        user.Name,
+				"user_level":  int(user.UserLevel),
+				"quota_mb":    user.StorageQuotaMB,
+				"provisioned": "ldap",
+			}),
+			IPAddress: getClientIP(r),
+			UserAgent: r.UserAgent(),
+			Success:   true,
+		})
+	}
+
+	return &auth.AuthResult{
+		User:        user,
+		AccountType: auth.AccountTypeUser,
+		AccountID:   user.Id,
+		Email:       user.Email,
+	}, true, nil
+}
+
+// handleAdminLDAP saves the LDAP settings
+func (s *Server) handleAdminLDAP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		s.renderAdminSSO(w, "Error: Invalid form data")
+		return
+	}
+
+	enabled := r.FormValue("ldap_enabled") == "on"
+	ldapURL := strings.TrimSpace(r.FormValue("ldap_url"))
+	baseDN := strings.TrimSpace(r.FormValue("ldap_base_dn"))
+
+	if ldapURL != "" {
+		if u, err := url.Parse(ldapURL); err != nil || (u.Scheme != "ldap" && u.Scheme != "ldaps") || u.Host == "" {
+			s.renderAdminSSO(w, "Error: LDAP URL must start with ldap:// or ldaps://")
+			return
+		}
+	}
+	if enabled && (ldapURL == "" || baseDN == "") {
+		s.renderAdminSSO(w, "Error: LDAP URL and base DN are required to enable LDAP")
+		return
+	}
+
+	interval, err := strconv.Atoi(strings.TrimSpace(r.FormValue("ldap_sync_interval_minutes")))
+	if err != nil || interval < 0 {
+		s.renderAdminSSO(w, "Error: Sync interval must be a number of minutes (0 disables scheduled sync)")
+		return
+	}
+
+	mappings := strings.TrimSpace(strings.ReplaceAll(r.FormValue("ldap_group_mappings"), "\r\n", "\n"))
+	if _, err := (&directory.Settings{GroupMappings: mappings}).Mappings(); err != nil {
+		s.renderAdminSSO(w, "Error: Group mappings: "+err.Error())
+		return
+	}
+
+	values := map[string]string{
+		"ldap_url":                   ldapURL,
+		"ldap_bind_dn":               strings.TrimSpace(r.FormValue("ldap_bind_dn")),
+		"ldap_base_dn":               baseDN,
+		"ldap_user_filter":           strings.TrimSpace(r.FormValue("ldap_user_filter")),
+		"ldap_login_attribute":       strings.TrimSpace(r.FormValue("ldap_login_attribute")),
+		"ldap_email_attribute":       strings.TrimSpace(r.FormValue("ldap_email_attribute")),
+		"ldap_name_attribute":        strings.TrimSpace(r.FormValue("ldap_name_attribute")),
+		"ldap_id_attribute":          strings.TrimSpace(r.FormValue("ldap_id_attribute")),
+		"ldap_group_attribute":       strings.TrimSpace(r.FormValue("ldap_group_attribute")),
+		"ldap_admin_group":           strings.TrimSpace(r.FormValue("ldap_admin_group")),
+		"ldap_group_mappings":        mappings,
+		"ldap_sync_interval_minutes": strconv.Itoa(interval),
+	}
+	for key, value := range values {
+		database.DB.SetConfigValue(key, value)
+	}
+
+	for _, key := range []string{"ldap_enabled", "ldap_start_tls", "ldap_insecure_skip_verify", "ldap_auto_provision"} {
+		if r.FormValue(key) == "on" {
+			database.DB.SetConfigValue(key, "true")
+		} else {
+			database.DB.SetConfigValue(key, "false")
+		}
+	}
+
+	// An empty password field keeps the stored password
+	if password := r.FormValue("ldap_bind_password"); password != "" || r.FormValue("ldap_clear_bind_password") == "on" {
+		if err := directory.SaveBindPassword(password); err != nil {
+			log.Printf("Error saving LDAP bind password: %v", err)
+			s.renderAdminSSO(w, "Error: Failed to save bind password")
+			return
+		}
+	}
+
+	user, _ := userFromContext(r.Context())
+	database.DB.LogAction(&database.AuditLogEntry{
+		UserID:     int64(user.Id),
+		UserEmail:  user.Email,
+		Action:     database.ActionSettingsUpdated,
+		EntityType: database.EntitySettings,
+		EntityID:   "ldap",
+		Details: database.CreateAuditDetails(map[string]interface{}{
+			"ldap_enabled":        enabled,
+			"ldap_url":            ldapURL,
+			"ldap_base_dn":        baseDN,
+			"ldap_admin_group":    values["ldap_admin_group"],
+			"ldap_group_mappings": mappings,
+			"ldap_sync_interval":  interval,
+		}),
+		IPAddress: getClientIP(r),
+		UserAgent: r.UserAgent(),
+		Success:   true,
+	})
+
+	s.renderAdminSSO(w, "LDAP settings saved")
+}
+
+// handleAdminLDAPSync runs a directory sync immediately
+func (s *Server) handleAdminLDAPSync(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	settings := directory.LoadSettings()
+	if !settings.Configured() {
+		s.renderAdminSSO(w, "Error: LDAP is not enabled")
+		return
+	}
+
+	report, err := directory.Sync(directory.Connect(settings), settings, s.defaultQuotaMB())
+	if err != nil {
+		s.renderAdminSSO(w, "Error: Sync failed: "+err.Error())
+		return
+	}
+
+	message := "Sync complete: " + report.String()
+	if len(report.Errors) > 0 {
+		message = "Error: Sync completed with errors: " + strings.Join(report.Errors, "; ")
+	}
+	s.renderAdminSSO(w, message)
+}
+
+// getLDAPSettingsHTML renders the LDAP card on the single sign-on page
+func (s *Server) getLDAPSettingsHTML() string {
+	settings := directory.LoadSettings()
+	checked := func(b bool) string {
+		if b {
+			return "checked"
+		}
+		return ""
+	}
+	esc := template.HTMLEscapeString
+
+	passwordHelp := "No bind password stored. Without a bind DN the server is searched anonymously."
+	if settings.BindPassword != "" {
+		passwordHelp = "A bind password is stored. Leave empty to keep it."
+	}
+
+	lastSync := "Never"
+	if v, _ := database.DB.GetConfigValue("ldap_last_sync"); v != "" {
+		if ts, err := strconv.ParseInt(v, 10, 64); err == nil && ts > 0 {
+			result, _ := database.DB.GetConfigValue("ldap_last_sync_result")
+			lastSync = time.Unix(ts, 0).Format("2006-01-02 15:04") + " - " + result
+		}
+	}
+
+	return `
+        <div class="card">
+            <h2>📇 LDAP / Active Directory</h2>
+
+            <div class="info-box">
+                Staff users sign in on the normal login page with their directory user name or email and password.
+                Directory groups can be mapped to teams; a scheduled sync adds and removes team members and deactivates accounts removed from the directory.<br>
+                Last sync: ` + esc(lastSync) + `
+            </div>
+
+            <form method="POST" action="/admin/sso/ldap">
+                <div class="form-group">
+                    <label class="checkbox-label">
+                        <input type="checkbox" name="ldap_enabled" ` + checked(settings.Enabled) + `>
+                        <span>Enable LDAP authentication</span>
+                    </label>
+                </div>
+
+                <h3>Server</h3>
+
+                <div class="form-group">
+                    <label for="ldap_url">Server URL</label>
+                    <input type="text" id="ldap_url" name="ldap_url" value="` + esc(settings.URL) + `" placeholder="ldaps://dc01.example.com:636">
+                </div>
+
+                <div class="form-group">
+                    <label class="checkbox-label">
+                        <input type="checkbox" name="ldap_start_tls" ` + checked(settings.StartTLS) + `>
+                        <span>Use StartTLS (for ldap:// URLs)</span>
+                    </label>
+                    <label class="checkbox-label" style="margin-top: 8px;">
+                        <input type="checkbox" name="ldap_insecure_skip_verify" ` + checked(settings.InsecureSkipVerify) + `>
+                        <span>Skip TLS certificate verification (testing only)</span>
+                    </label>
+                </div>
+
+                <div class="form-group">
+                    <label for="ldap_bind_dn">Bind DN</label>
+                    <input type="text" id="ldap_bind_dn" name="ldap_bind_dn" value="` + esc(settings.BindDN) + `" placeholder="CN=svc-wulfvault,OU=Service Accounts,DC=example,DC=com">
+                    <p class="help-text">Service account used to search for users</p>
+                </div>
+
+                <div class="form-group">
+                    <label for="ldap_bind_password">Bind Password</label>
+                    <input type="password" id="ldap_bind_password" name="ldap_bind_password" autocomplete="new-password">
+                    <p class="help-text">` + passwordHelp + `</p>
+                    <label class="checkbox-label" style="margin-top: 8px; font-weight: normal;">
+                        <input type="checkbox" name="ldap_clear_bind_password">
+                        <span>Remove stored bind password</span>
+                    </label>
+                </div>
+
+                <div class="form-group">
+                    <label for="ldap_base_dn">Base DN</label>
+                    <input type="text" id="ldap_base_dn" name="ldap_base_dn" value="` + esc(settings.BaseDN) + `" placeholder="DC=example,DC=com">
+                </div>
+
+                <div class="form-group">
+                    <label for="ldap_user_filter">User Filter</label>
+                    <input type="text" id="ldap_user_filter" name="ldap_user_filter" value="` + esc(settings.UserFilter) + `">
+                    <p class="help-text">Users outside this filter cannot sign in and are deactivated by the sync. The default matches enabled Active Directory users.</p>
+                </div>
+
+                <h3>Attributes</h3>
+
+                <div class="form-group">
+                    <label for="ldap_login_attribute">Login Attribute</label>
+                    <input type="text" id="ldap_login_attribute" name="ldap_login_attribute" value="` + esc(settings.LoginAttribute) + `">
+                    <p class="help-text"><code>sAMAccountName</code> for Active Directory, <code>uid</code> for OpenLDAP</p>
+                </div>
+
+                <div class="form-group">
+                    <label for="ldap_email_attribute">Email Attribute</label>
+                    <input type="text" id="ldap_email_attribute" name="ldap_email_attribute" value="` + esc(settings.EmailAttribute) + `">
+                    <p class="help-text">Existing accounts are linked by this email address</p>
+                </div>
+
+                <div class="form-group">
+                    <label for="ldap_name_attribute">Name Attribute</label>
+                    <input type="text" id="ldap_name_attribute" name="ldap_name_attribute" value="` + esc(settings.NameAttribute) + `">
+                </div>
+
+                <div class="form-group">
+                    <label for="ldap_id_attribute">Unique ID Attribute</label>
+                    <input type="text" id="ldap_id_attribute" name="ldap_id_attribute" value="` + esc(settings.IDAttribute) + `">
+                    <p class="help-text">Must never change for a user: <code>objectGUID</code> for Active Directory, <code>entryUUID</code> for OpenLDAP</p>
+                </div>
+
+                <div class="form-group">
+                    <label for="ldap_group_attribute">Group Membership Attribute</label>
+                    <input type="text" id="ldap_group_attribute" name="ldap_group_attribute" value="` + esc(settings.GroupAttribute) + `">
+                </div>
+
+                <h3>Roles and Teams</h3>
+
+                <div class="form-group">
+                    <label for="ldap_admin_group">Admin Group</label>
+                    <input type="text" id="ldap_admin_group" name="ldap_admin_group" value="` + esc(settings.AdminGroup) + `">
+                    <p class="help-text">Group DN or CN. Members are made admins, everyone else becomes a regular user. Leave empty to manage roles in WulfVault.</p>
+                </div>
+
+                <div class="form-group">
+                    <label for="ldap_group_mappings">Group to Team Mappings</label>
+                    <textarea id="ldap_group_mappings" name="ldap_group_mappings" rows="5" placeholder="CN=Finance,OU=Groups,DC=example,DC=com = Finance : member&#10;Finance Leads = Finance : owner">` + esc(settings.GroupMappings) + `</textarea>
+                    <p class="help-text">One mapping per line: <code>group = Team Name : role</code>, where role is <code>owner</code>, <code>admin</code> or <code>member</code>. Teams must already exist. The highest role wins when a user is in several mapped groups. Team members added by hand are left alone.</p>
+                </div>
+
+                <h3>Accounts and Sync</h3>
+
+                <div class="form-group">
+                    <label class="checkbox-label">
+                        <input type="checkbox" name="ldap_auto_provision" ` + checked(settings.AutoProvision) + `>
+                        <span>Create accounts for directory users</span>
+                    </label>
+                    <p class="help-text">New users get the default quota of ` + strconv.FormatInt(s.defaultQuotaMB(), 10) + ` MB</p>
+                </div>
+
+                <div class="form-group">
+                    <label for="ldap_sync_interval_minutes">Sync Interval (minutes)</label>
+                    <input type="text" id="ldap_sync_interval_minutes" name="ldap_sync_interval_minutes" value="` + strconv.Itoa(settings.SyncIntervalMinutes) + `">
+                    <p class="help-text">0 disables the scheduled sync</p>
+                </div>
+
+                <button type="submit" class="btn btn-primary">Save LDAP Settings</button>
+            </form>
+
+            <form method="POST" action="/admin/sso/ldap/sync" style="margin-top: 15px;" onsubmit="return confirm('Run a directory sync now? Accounts removed from the directory will be deactivated.');">
+                <button type="submit" class="btn btn-primary">Sync Now</button>
+            </form>
+        </div>`
+}
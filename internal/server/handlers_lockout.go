@@ -0,0 +1,271 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package server
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Frimurare/WulfVault/internal/auth"
+	"github.com/Frimurare/WulfVault/internal/database"
+	"github.com/Frimurare/WulfVault/internal/email"
+)
+
+// loginAccountKey returns the lock key for a login identifier. User names are
+// resolved to the account email so both spellings share one failure count.
+func loginAccountKey(identifier string) string {
+	if _, err := database.DB.GetUserByEmail(identifier); err != nil {
+		if user, err := database.DB.GetUserByName(identifier); err == nil {
+			return auth.AccountLockKey(user.Email)
+		}
+	}
+	return auth.AccountLockKey(identifier)
+}
+
+// ipLockKey returns the lock key for the client address of a request
+func (s *Server) ipLockKey(r *http.Request) string {
+	return auth.IPLockKey(s.trustedClientIP(r))
+}
+
+// trustedClientIP returns the client address of a request for security
+// decisions. Unlike getClientIP it ignores forwarding headers unless they come
+// from a trusted proxy, so clients cannot choose the address themselves.
+func (s *Server) trustedClientIP(r *http.Request) string {
+	return auth.LockoutClientIP(r, s.config.TrustedProxies)
+}
+
+// accountOwnerEmail returns the email of the user or download account behind a
+// login identifier, or "" if there is no such account
+func accountOwnerEmail(identifier string) string {
+	if user, err := database.DB.GetUserByEmail(identifier); err == nil {
+		return user.Email
+	}
+	if user, err := database.DB.GetUserByName(identifier); err == nil {
+		return user.Email
+	}
+	if account, err := database.DB.GetDownloadAccountByEmail(identifier); err == nil {
+		return account.Email
+	}
+	return ""
+}
+
+// logLockedAttempt audits an attempt that was refused because of a lockout
+func logLockedAttempt(r *http.Request, identifier, kind string, until time.Time) {
+	database.DB.LogAction(&database.AuditLogEntry{
+		UserID:     0,
+		UserEmail:  identifier,
+		Action:     database.ActionLoginFailed,
+		EntityType: database.EntitySession,
+		Details: database.CreateAuditDetails(map[string]interface{}{
+			"email":        identifier,
+			"reason":       "locked_out",
+			"attempt":      kind,
+			"locked_until": until.Unix(),
+		}),
+		IPAddress: getClientIP(r),
+		UserAgent: r.UserAgent(),
+		Success:   false,
+		ErrorMsg:  "Locked out after repeated failures",
+	})
+}
+
+// recordFailedAttempt counts a failed attempt against the lock keys. New lockouts
+// are audited; the first lockout of a key notifies ownerEmail (account, second
+// factor and file keys) or the administrators (IP keys).
+func (s *Server) recordFailedAttempt(r *http.Request, kind, ownerEmail string, keys ...string) {
+	ip := getClientIP(r)
+
+	for _, lockout := range auth.RecordFailure(keys...) {
+		database.DB.LogAction(&database.AuditLogEntry{
+			UserID:     0,
+			UserEmail:  "system",
+			Action:     database.ActionLoginLocked,
+			EntityType: database.EntitySession,
+			EntityID:   lockout.Key,
+			Details: database.CreateAuditDetails(map[string]interface{}{
+				"key":          lockout.Key,
+				"attempt":      kind,
+				"failures":     lockout.Failures,
+				"locked_until": lockout.Until.Unix(),
+			}),
+			IPAddress: ip,
+			UserAgent: r.UserAgent(),
+			Success:   true,
+		})
+
+		if !lockout.First {
+			continue
+		}
+
+		details := []string{
+			"Failed attempts: " + strconv.Itoa(lockout.Failures),
+			"Last attempt from IP: " + ip,
+			"Locked until: " + lockout.Until.Format("2006-01-02 15:04:05"),
+		}
+
+		if strings.HasPrefix(lockout.Key, auth.LockKeyIP) {
+			go func() {
+				if err := email.SendAdminAlert(
+					"Login attempts blocked from "+ip,
+					"IP Address Locked Out",
+					"Repeated failed sign-in attempts from "+ip+" have been blocked. An administrator can lift the lock in Manage Users.",
+					details); err != nil {
+					log.Printf("Could not send lockout alert: %v", err)
+				}
+			}()
+			continue
+		}
+
+		if ownerEmail == "" {
+			continue
+		}
+		to := ownerEmail
+		go func() {
+			if err := email.SendSecurityAlert(to,
+				"Repeated failed sign-in attempts",
+				"Failed Sign-in Attempts",
+				failedAttemptMessage(kind),
+				details); err != nil {
+				log.Printf("Could not send lockout notice to %s: %v", to, err)
+			}
+		}()
+	}
+}
+
+// failedAttemptMessage explains a lockout to the owner
+func failedAttemptMessage(kind string) string {
+	switch kind {
+	case "totp":
+		return "Someone entered your password correctly but failed the two-factor verification repeatedly. If this was not you, change your password now."
+	case "file_password":
+		return "Repeated wrong passwords were entered for one of your shared files. Further attempts are temporarily blocked."
+	}
+	return "Repeated wrong passwords were entered for your account. Further attempts are temporarily blocked. If this was not you, consider changing your password."
+}
+
+// handleAdminUnlock lifts a lockout
+func (s *Server) handleAdminUnlock(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var keys []string
+	if key := r.FormValue("key"); key != "" {
+		keys = append(keys, key)
+	}
+	// Unlocking an account also clears its second factor lock
+	if id, err := strconv.Atoi(r.FormValue("user_id")); err == nil {
+		if user, err := database.DB.GetUserByID(id); err == nil {
+			keys = append(keys, auth.AccountLockKey(user.Email), auth.TOTPLockKey(user.Id))
+		}
+	}
+	if len(keys) == 0 {
+		s.sendError(w, http.StatusBadRequest, "Nothing to unlock")
+		return
+	}
+
+	auth.ClearFailures(keys...)
+
+	admin, _ := userFromContext(r.Context())
+	for _, key := range keys {
+		database.DB.LogAction(&database.AuditLogEntry{
+			UserID:     int64(admin.Id),
+			UserEmail:  admin.Email,
+			Action:     database.ActionLoginUnlocked,
+			EntityType: database.EntitySession,
+			EntityID:   key,
+			Details:    database.CreateAuditDetails(map[string]interface{}{"key": key}),
+			IPAddress:  getClientIP(r),
+			UserAgent:  r.UserAgent(),
+			Success:    true,
+		})
+	}
+
+	s.sendJSON(w, http.StatusOK, map[string]interface{}{"success": true})
+}
+
+// activeLockouts returns all current locks by key
+func activeLockouts() map[string]*database.LoginThrottle {
+	locks := map[string]*database.LoginThrottle{}
+	throttles, err := database.DB.GetLockedLoginThrottles(time.Now().Unix())
+	if err != nil {
+		log.Printf("Warning: Failed to fetch lockouts: %v", err)
+		return locks
+	}
+	for _, t := range throttles {
+		locks[t.Key] = t
+	}
+	return locks
+}
+
+// renderLockoutsTable lists every active lock for the Manage Users page
+func renderLockoutsTable(locks map[string]*database.LoginThrottle) string {
+	if len(locks) == 0 {
+		return ""
+	}
+
+	throttles := make([]*database.LoginThrottle, 0, len(locks))
+	for _, t := range locks {
+		throttles = append(throttles, t)
+	}
+	sort.Slice(throttles, func(i, j int) bool { return throttles[i].LockedUntil > throttles[j].LockedUntil })
+
+	html := `
+        <h3>Active Lockouts (` + strconv.Itoa(len(throttles)) + `)</h3>
+        <table>
+            <thead>
+                <tr>
+                    <th>Type</th>
+                    <th>Target</th>
+                    <th>Failed Attempts</th>
+                    <th>Locked Until</th>
+                    <th>Actions</th>
+                </tr>
+            </thead>
+            <tbody>`
+
+	for _, t := range throttles {
+		kind, target := "Account", strings.TrimPrefix(t.Key, auth.LockKeyAccount)
+		switch {
+		case strings.HasPrefix(t.Key, auth.LockKeyTOTP):
+			kind, target = "Two-factor", "User #"+strings.TrimPrefix(t.Key, auth.LockKeyTOTP)
+			if id, err := strconv.Atoi(strings.TrimPrefix(t.Key, auth.LockKeyTOTP)); err == nil {
+				if user, err := database.DB.GetUserByID(id); err == nil {
+					target = user.Email
+				}
+			}
+		case strings.HasPrefix(t.Key, auth.LockKeyFile):
+			kind, target = "File password", strings.TrimPrefix(t.Key, auth.LockKeyFile)
+			if file, err := database.DB.GetFileByID(target); err == nil {
+				target = file.Name + " (" + file.Id + ")"
+			}
+		case strings.HasPrefix(t.Key, auth.LockKeyIP):
+			kind, target = "IP address", strings.TrimPrefix(t.Key, auth.LockKeyIP)
+		}
+
+		html += `
+                <tr>
+                    <td data-label="Type">` + kind + `</td>
+                    <td data-label="Target">` + template.HTMLEscapeString(target) + `</td>
+                    <td data-label="Failed Attempts">` + strconv.Itoa(t.Failures) + `</td>
+                    <td data-label="Locked Until">` + time.Unix(t.LockedUntil, 0).Format("2006-01-02 15:04:05") + `</td>
+                    <td data-label="Actions" class="action-links">
+                        <a href="#" onclick="unlockLogin('key=` + url.QueryEscape(t.Key) + `'); return false;">Unlock</a>
+                    </td>
+                </tr>`
+	}
+
+	return html + `
+            </tbody>
+        </table>`
+}
@@ -0,0 +1,365 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package server
+
+import (
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Frimurare/WulfVault/internal/auth"
+	"github.com/Frimurare/WulfVault/internal/database"
+	"github.com/Frimurare/WulfVault/internal/email"
+)
+
+// downloadSessionAllowed reports whether a download session may download a file.
+// Sessions signed in with an emailed link only count for files that allow it.
+func downloadSessionAllowed(sessionId string, fileInfo *database.FileInfo) bool {
+	return fileInfo.AllowMagicLink || auth.DownloadSessionAuthMethod(sessionId) != database.DownloadAuthMagicLink
+}
+
+// handleDownloadMagicLinkRequest shows the form for requesting a sign-in link, and
+// emails one to the download account when it is submitted
+func (s *Server) handleDownloadMagicLinkRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		s.renderMagicLinkRequestPage(w, "", "")
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		s.renderMagicLinkRequestPage(w, "", "Invalid form data")
+		return
+	}
+
+	emailAddr := strings.TrimSpace(r.FormValue("email"))
+	fileId := r.FormValue("file_id")
+	if emailAddr == "" {
+		s.renderMagicLinkRequestPage(w, fileId, "Email is required")
+		return
+	}
+
+	ipKey := s.ipLockKey(r)
+	if until := auth.LockedUntil(ipKey); !until.IsZero() {
+		logLockedAttempt(r, emailAddr, "magic_link", until)
+		s.renderMagicLinkRequestPage(w, fileId, auth.LockoutMessage(until))
+		return
+	}
+
+	fileName := ""
+	if fileId != "" {
+		fileInfo, err := database.DB.GetFileByID(fileId)
+		if err != nil {
+			fileId = ""
+		} else if !fileInfo.AllowMagicLink {
+			s.renderMagicLinkRequestPage(w, "", "This file can only be downloaded after signing in with your password.")
+			return
+		} else {
+			fileName = fileInfo.Name
+		}
+	}
+
+	if _, err := email.GetActiveProvider(database.DB); err != nil {
+		s.renderMagicLinkRequestPage(w, fileId, "Sign-in links are not available because email is not configured. Please sign in with your password.")
+		return
+	}
+
+	// Always show the same message so the form doesn't reveal which addresses have accounts
+	successMessage := "SUCCESS:If a download account exists for " + emailAddr + ", a sign-in link has been sent to it. The link is valid for " +
+		strconv.Itoa(int(database.MagicLinkDuration.Minutes())) + " minutes."
+
+	account, err := database.DB.GetDownloadAccountByEmail(emailAddr)
+	if err != nil || !account.IsActive || account.DeletedAt > 0 {
+		s.renderMagicLinkRequestPage(w, fileId, successMessage)
+		return
+	}
+
+	entry := &database.AuditLogEntry{
+		UserID:     int64(account.Id),
+		UserEmail:  account.Email,
+		Action:     database.ActionDownloadMagicLinkRequested,
+		EntityType: database.EntityDownloadAccount,
+		EntityID:   strconv.Itoa(account.Id),
+		Details: database.CreateAuditDetails(map[string]interface{}{
+			"file_id": fileId,
+		}),
+		IPAddress: getClientIP(r),
+		UserAgent: r.UserAgent(),
+		Success:   true,
+	}
+
+	recent, err := database.DB.CountRecentDownloadMagicLinks(account.Id, time.Now().Add(-time.Hour))
+	if err == nil && recent >= database.MaxMagicLinksPerHour {
+		entry.Success = false
+		entry.ErrorMsg = "too many sign-in links requested"
+		database.DB.LogAction(entry)
+		s.renderMagicLinkRequestPage(w, fileId, successMessage)
+		return
+	}
+
+	token, err := database.DB.CreateDownloadMagicLink(account.Id, fileId, getClientIP(r))
+	if err == nil {
+		signInLink := s.getPublicURL() + "/download/magic?token=" + url.QueryEscape(token)
+		err = email.SendDownloadMagicLinkEmail(account.Email, account.Name, signInLink, fileName,
+			s.config.CompanyName, int(database.MagicLinkDuration.Minutes()))
+	}
+	if err != nil {
+		log.Printf("Error sending sign-in link to %s: %v", account.Email, err)
+		entry.Success = false
+		entry.ErrorMsg = err.Error()
+	} else {
+		log.Printf("Sign-in link sent to download account %s", account.Email)
+	}
+	database.DB.LogAction(entry)
+
+	s.renderMagicLinkRequestPage(w, fileId, successMessage)
+}
+
+// handleDownloadMagicLink handles a sign-in link from an email. Opening the link
+// asks for confirmation, so that link scanners in mail systems don't use it up.
+func (s *Server) handleDownloadMagicLink(w http.ResponseWriter, r *http.Request) {
+	token := r.FormValue("token")
+
+	if r.Method == http.MethodGet {
+		accountId, _, err := database.DB.CheckDownloadMagicLink(token)
+		if err != nil {
+			s.renderMagicLinkConfirmPage(w, "", "", "This sign-in link is invalid, has already been used or has expired.")
+			return
+		}
+		account, err := database.DB.GetDownloadAccountByID(accountId)
+		if err != nil {
+			s.renderMagicLinkConfirmPage(w, "", "", "Account not found")
+			return
+		}
+		s.renderMagicLinkConfirmPage(w, token, account.Email, "")
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	accountId, fileId, err := database.DB.UseDownloadMagicLink(token)
+	if err != nil {
+		if !errors.Is(err, database.ErrMagicLinkInvalid) {
+			log.Printf("Error using sign-in link: %v", err)
+		}
+		s.renderMagicLinkConfirmPage(w, "", "", "This sign-in link is invalid, has already been used or has expired.")
+		return
+	}
+
+	account, err := database.DB.GetDownloadAccountByID(accountId)
+	if err != nil || !account.IsActive || account.DeletedAt > 0 {
+		s.renderMagicLinkConfirmPage(w, "", "", "This account is disabled")
+		return
+	}
+
+	// The link was delivered to the account's email address, which proves it
+	if !account.IsEmailVerified() {
+		if err := database.DB.MarkDownloadAccountEmailVerified(account.Id); err != nil {
+			log.Printf("Error marking %s verified: %v", account.Email, err)
+		} else if verified, err := s.downloadAccountVerifiedAudit(r, account.Id, fileId, "magic_link"); err == nil {
+			account = verified
+		}
+	}
+
+	// Files that don't accept sign-in links still ask for the password
+	if fileId != "" {
+		if fileInfo, err := database.DB.GetFileByID(fileId); err != nil || !fileInfo.AllowMagicLink || !fileInfo.RecipientAllowed(account.Email) {
+			fileId = ""
+		}
+	}
+
+	log.Printf("Download account %s signed in with a sign-in link", account.Email)
+	database.DB.LogAction(&database.AuditLogEntry{
+		UserID:     int64(account.Id),
+		UserEmail:  account.Email,
+		Action:     database.ActionDownloadMagicLinkUsed,
+		EntityType: database.EntityDownloadAccount,
+		EntityID:   strconv.Itoa(account.Id),
+		Details: database.CreateAuditDetails(map[string]interface{}{
+			"file_id": fileId,
+		}),
+		IPAddress: getClientIP(r),
+		UserAgent: r.UserAgent(),
+		Success:   true,
+	})
+
+	s.startDownloadSession(w, r, fileId, account, database.DownloadAuthMagicLink)
+
+	if fileId == "" {
+		http.Redirect(w, r, "/download/dashboard", http.StatusSeeOther)
+		return
+	}
+	http.Redirect(w, r, "/d/"+fileId, http.StatusSeeOther)
+}
+
+// renderMagicLinkRequestPage renders the form for requesting a sign-in link.
+// Messages starting with "SUCCESS:" are shown as confirmations.
+func (s *Server) renderMagicLinkRequestPage(w http.ResponseWriter, fileId, message string) {
+	messageHTML := ""
+	if strings.HasPrefix(message, "SUCCESS:") {
+		messageHTML = `<div class="success">` + template.HTMLEscapeString(strings.TrimPrefix(message, "SUCCESS:")) + `</div>`
+	} else if message != "" {
+		messageHTML = `<div class="error">` + template.HTMLEscapeString(message) + `</div>`
+	}
+
+	backLink := `<a href="/login">Back to login</a>`
+	if fileId != "" {
+		backLink = `<a href="/d/` + template.HTMLEscapeString(fileId) + `">Back to the download</a>`
+	}
+
+	s.renderMagicLinkPage(w, "Sign In by Email", messageHTML+`
+        <p>Enter the email address of your download account and we'll send you a single-use link that signs you in without a password.</p>
+        <form method="POST" action="/download/magic-link">
+            <input type="hidden" name="file_id" value="`+template.HTMLEscapeString(fileId)+`">
+            <input type="email" name="email" required autofocus placeholder="you@example.com">
+            <button type="submit" class="btn">📧 Email Me a Sign-In Link</button>
+        </form>
+        <p style="margin-top: 20px; font-size: 13px; text-align: center;">`+backLink+`</p>`)
+}
+
+// renderMagicLinkConfirmPage asks the holder of a sign-in link to confirm signing in
+func (s *Server) renderMagicLinkConfirmPage(w http.ResponseWriter, token, emailAddr, errorMsg string) {
+	if errorMsg != "" {
+		s.renderMagicLinkPage(w, "Sign In", `<div class="error">`+template.HTMLEscapeString(errorMsg)+`</div>
+        <p style="font-size: 13px; text-align: center;"><a href="/download/magic-link">Request a new sign-in link</a></p>`)
+		return
+	}
+
+	s.renderMagicLinkPage(w, "Sign In", `
+        <p>Sign in to the download account <strong>`+template.HTMLEscapeString(emailAddr)+`</strong>?</p>
+        <form method="POST" action="/download/magic">
+            <input type="hidden" name="token" value="`+template.HTMLEscapeString(token)+`">
+            <button type="submit" class="btn">Sign In</button>
+        </form>`)
+}
+
+// renderMagicLinkPage renders a page of the sign-in link flow
+func (s *Server) renderMagicLinkPage(w http.ResponseWriter, heading, content string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	html := `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <meta name="author" content="Ulf Holmström">
+    <title>` + heading + ` - ` + s.config.CompanyName + `</title>
+    ` + s.getFaviconHTML() + `
+    <style>
+        * { margin: 0; padding: 0; box-sizing: border-box; }
+        body {
+            font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Roboto, sans-serif;
+            background: linear-gradient(135deg, ` + s.getPrimaryColor() + ` 0%, ` + s.getSecondaryColor() + ` 100%);
+            min-height: 100vh;
+            display: flex;
+            align-items: center;
+            justify-content: center;
+            padding: 20px;
+        }
+        .container {
+            background: white;
+            border-radius: 12px;
+            box-shadow: 0 20px 60px rgba(0,0,0,0.3);
+            padding: 40px;
+            max-width: 500px;
+            width: 100%;
+        }
+        .logo {
+            text-align: center;
+            margin-bottom: 30px;
+        }
+        .logo h1 {
+            color: ` + s.getPrimaryColor() + `;
+            font-size: 28px;
+            margin-bottom: 8px;
+        }
+        h3 {
+            color: #333;
+            font-size: 16px;
+            margin-bottom: 16px;
+        }
+        p {
+            color: #666;
+            font-size: 14px;
+            margin-bottom: 16px;
+        }
+        a {
+            color: ` + s.getPrimaryColor() + `;
+        }
+        input[type="email"] {
+            width: 100%;
+            padding: 12px;
+            border: 2px solid #e0e0e0;
+            border-radius: 6px;
+            font-size: 14px;
+            margin-bottom: 16px;
+        }
+        input:focus {
+            outline: none;
+            border-color: ` + s.getPrimaryColor() + `;
+        }
+        .btn {
+            width: 100%;
+            padding: 14px;
+            background: ` + s.getPrimaryColor() + `;
+            color: white;
+            border: none;
+            border-radius: 6px;
+            font-size: 16px;
+            font-weight: 600;
+            cursor: pointer;
+            transition: opacity 0.3s;
+        }
+        .btn:hover {
+            opacity: 0.9;
+        }
+        .error {
+            background: #fee;
+            border: 1px solid #fcc;
+            color: #c33;
+            padding: 12px;
+            border-radius: 6px;
+            margin-bottom: 20px;
+            font-size: 14px;
+        }
+        .success {
+            background: #e8f5e9;
+            border: 1px solid #a5d6a7;
+            color: #2e7d32;
+            padding: 12px;
+            border-radius: 6px;
+            margin-bottom: 20px;
+            font-size: 14px;
+        }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <div class="logo">
+            <h1>` + s.config.CompanyName + `</h1>
+        </div>
+
+        <h3>` + heading + `</h3>
+        ` + content + `
+
+        <div style="text-align: center; margin-top: 20px; color: #999; font-size: 12px;">
+            ` + s.config.FooterText + `
+        </div>
+    </div>
+</body>
+</html>`
+
+	w.Write([]byte(html))
+}
@@ -0,0 +1,199 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package server
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Frimurare/WulfVault/internal/database"
+	"github.com/Frimurare/WulfVault/internal/mfa"
+	"github.com/Frimurare/WulfVault/internal/models"
+)
+
+// mfaRequired reports whether the role of a user requires two-factor authentication
+func mfaRequired(user *models.User) bool {
+	return mfa.Check(user).Status != mfa.StatusNotRequired
+}
+
+// mfaEnrollmentPaths stay reachable for users who are blocked until they set up
+// two-factor authentication. Paths ending in "/" match as a prefix.
+var mfaEnrollmentPaths = []string{"/settings", "/settings/passkeys", "/settings/passkeys/", "/2fa/setup", "/2fa/enable", "/logout"}
+
+// requireMFAEnrollment blocks users whose grace period for setting up a required
+// second factor is over, except for the enrollment pages. It returns true if the
+// request was handled.
+func (s *Server) requireMFAEnrollment(w http.ResponseWriter, r *http.Request, user *models.User) bool {
+	for _, p := range mfaEnrollmentPaths {
+		if r.URL.Path == p || (strings.HasSuffix(p, "/") && strings.HasPrefix(r.URL.Path, p)) {
+			return false
+		}
+	}
+	if mfa.Check(user).Status != mfa.StatusOverdue {
+		return false
+	}
+
+	if r.Method == http.MethodGet && !strings.HasPrefix(r.URL.Path, "/api/") {
+		http.Redirect(w, r, "/settings?2fa_required=1", http.StatusSeeOther)
+	} else {
+		s.sendError(w, http.StatusForbidden, "Your role requires two-factor authentication. Set it up in Settings to continue")
+	}
+	return true
+}
+
+// mfaLoginRedirect returns the settings page for users who still have to set up
+// a required second factor, so they are taken to the setup at every sign-in
+func mfaLoginRedirect(user *models.User) (string, bool) {
+	if !mfa.Check(user).MustEnroll() {
+		return "", false
+	}
+	return "/settings?2fa_required=1", true
+}
+
+// saveMFARequiredRoles stores which roles require two-factor authentication from
+// the settings form and audits every role that changed
+func saveMFARequiredRoles(r *http.Request, actor *models.User) {
+	selected := map[int]bool{}
+	for _, v := range r.Form["mfa_required_roles"] {
+		if id, err := strconv.Atoi(v); err == nil {
+			selected[id] = true
+		}
+	}
+
+	roles, err := database.DB.GetAllRoles()
+	if err != nil {
+		log.Printf("Error loading roles: %v", err)
+		return
+	}
+	for _, role := range roles {
+		if role.Require2FA == selected[role.Id] {
+			continue
+		}
+		if err := database.DB.SetRoleRequire2FA(role.Id, selected[role.Id]); err != nil {
+			log.Printf("Error saving 2FA requirement of role %s: %v", role.Name, err)
+			continue
+		}
+		database.DB.LogAction(&database.AuditLogEntry{
+			UserID:     int64(actor.Id),
+			UserEmail:  actor.Email,
+			Action:     database.ActionRoleUpdated,
+			EntityType: database.EntityRole,
+			EntityID:   strconv.Itoa(role.Id),
+			Details: database.CreateAuditDetails(map[string]interface{}{
+				"name":        role.Name,
+				"require_2fa": selected[role.Id],
+			}),
+			IPAddress: getClientIP(r),
+			UserAgent: r.UserAgent(),
+			Success:   true,
+		})
+	}
+
+	// Users of roles that no longer require 2FA get a full grace period if it is required again
+	if err := database.DB.ClearMFAGracePeriods(); err != nil {
+		log.Printf("Error clearing 2FA grace periods: %v", err)
+	}
+}
+
+// mfaRoleCheckboxesHTML renders a checkbox per role for the settings form
+func mfaRoleCheckboxesHTML() string {
+	roles, err := database.DB.GetAllRoles()
+	if err != nil {
+		log.Printf("Error loading roles: %v", err)
+		return ""
+	}
+
+	var b strings.Builder
+	for i, role := range roles {
+		checked := ""
+		if role.Require2FA {
+			checked = " checked"
+		}
+		margin := ""
+		if i > 0 {
+			margin = " margin-top: 10px;"
+		}
+		b.WriteString(`
+                    <label style="display: flex; align-items: center; cursor: pointer;` + margin + `">
+                        <input type="checkbox" name="mfa_required_roles" value="` + strconv.Itoa(role.Id) + `"` + checked + ` style="margin-right: 10px; width: 20px; height: 20px; cursor: pointer;">
+                        <span>` + template.HTMLEscapeString(role.Name) + `</span>
+                    </label>`)
+	}
+	return b.String()
+}
+
+// maxMFAPendingRows limits the users listed in the compliance report on the dashboard
+const maxMFAPendingRows = 10
+
+// mfaComplianceHTML renders the two-factor compliance report for the admin
+// dashboard. It is empty while no role requires two-factor authentication.
+func mfaComplianceHTML() string {
+	report, err := mfa.BuildReport()
+	if err != nil {
+		log.Printf("Error building 2FA compliance report: %v", err)
+		return ""
+	}
+	if report.Required == 0 {
+		return ""
+	}
+
+	rows := ""
+	for i, u := range report.Pending {
+		if i == maxMFAPendingRows {
+			rows += `
+                        <tr><td colspan="4" style="padding: 8px 12px; color: #64748b;">… and ` + strconv.Itoa(len(report.Pending)-maxMFAPendingRows) + ` more</td></tr>`
+			break
+		}
+		color := "#f59e0b"
+		if u.Status == mfa.StatusOverdue {
+			color = "#dc2626"
+		}
+		rows += `
+                        <tr style="border-top: 1px solid #e2e8f0;">
+                            <td style="padding: 8px 12px; font-weight: 600; color: #1e293b;">` + template.HTMLEscapeString(u.Name) + `<div style="font-weight: 400; font-size: 12px; color: #64748b;">` + template.HTMLEscapeString(u.Email) + `</div></td>
+                            <td style="padding: 8px 12px; color: #475569;">` + template.HTMLEscapeString(u.RoleName) + `</td>
+                            <td style="padding: 8px 12px; color: ` + color + `; font-weight: 600;">` + u.Status.String() + `</td>
+                            <td style="padding: 8px 12px; color: #475569;">` + u.Deadline.Format("2006-01-02") + `</td>
+                        </tr>`
+	}
+
+	table := `<p class="text-sm text-slate-600 font-medium">Everyone who must use 2FA has set it up.</p>`
+	if rows != "" {
+		table = `
+                <table style="width: 100%; border-collapse: collapse; font-size: 14px; text-align: left;">
+                    <thead>
+                        <tr style="color: #64748b; font-size: 12px; text-transform: uppercase;">
+                            <th style="padding: 8px 12px;">User</th>
+                            <th style="padding: 8px 12px;">Role</th>
+                            <th style="padding: 8px 12px;">Status</th>
+                            <th style="padding: 8px 12px;">Deadline</th>
+                        </tr>
+                    </thead>
+                    <tbody>` + rows + `
+                    </tbody>
+                </table>`
+	}
+
+	exempt := ""
+	if report.Exempt > 0 {
+		exempt = ` · ` + strconv.Itoa(report.Exempt) + ` exempt (SSO)`
+	}
+
+	return `
+        <div class="grid grid-cols-1 md:grid-cols-3 gap-6 mb-16">
+            <div class="glass-card rounded-2xl p-8">
+                <h3 class="text-xs font-bold text-violet-600 uppercase tracking-widest mb-5">Mandatory 2FA Compliance</h3>
+                <div class="stat-number text-5xl font-extrabold mb-3">` + strconv.FormatFloat(report.Compliance(), 'f', 1, 64) + `%</div>
+                <p class="text-sm text-slate-600 font-medium">` + strconv.Itoa(report.Enrolled) + ` enrolled · ` + strconv.Itoa(report.GracePeriod) + ` in grace period · ` + strconv.Itoa(report.Overdue) + ` blocked` + exempt + `</p>
+            </div>
+            <div class="glass-card rounded-2xl p-8 md:col-span-2">
+                <h3 class="text-xs font-bold text-violet-600 uppercase tracking-widest mb-5">Users Without Required 2FA</h3>` + table + `
+            </div>
+        </div>`
+}
@@ -0,0 +1,781 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Frimurare/WulfVault/internal/auth"
+	"github.com/Frimurare/WulfVault/internal/database"
+	"github.com/Frimurare/WulfVault/internal/models"
+	"github.com/Frimurare/WulfVault/internal/passkey"
+)
+
+// passkeyCeremonyCookie holds the ID of the WebAuthn challenge in progress
+const passkeyCeremonyCookie = "passkey_ceremony"
+
+// maxPasskeyResponseSize bounds the authenticator response read from the browser
+const maxPasskeyResponseSize = 64 * 1024
+
+// relyingParty returns the WebAuthn relying party for the configured server URL
+func (s *Server) relyingParty() (*passkey.RelyingParty, error) {
+	return passkey.New(s.config.CompanyName, s.getPublicURL(), s.config.ServerURL)
+}
+
+// setPasskeyCeremony remembers the challenge in progress for the finish request
+func setPasskeyCeremony(w http.ResponseWriter, id string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     passkeyCeremonyCookie,
+		Value:    id,
+		Path:     "/",
+		Expires:  time.Now().Add(5 * time.Minute),
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// takePasskeyCeremony returns the challenge ID and clears the cookie
+func takePasskeyCeremony(w http.ResponseWriter, r *http.Request) string {
+	cookie, err := r.Cookie(passkeyCeremonyCookie)
+	if err != nil {
+		return ""
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     passkeyCeremonyCookie,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+	return cookie.Value
+}
+
+// passkeyRequired reports whether the passkey policy applies to a user
+func passkeyRequired(user *models.User) bool {
+	return passkey.LoadPolicy().RequiredFor(user)
+}
+
+// hasPasskeys reports whether a user has registered at least one passkey
+func hasPasskeys(userId int) bool {
+	count, err := database.DB.CountWebAuthnCredentials(userId)
+	return err == nil && count > 0
+}
+
+// passkeyEnrollmentPaths stay reachable for users who still have to register a required passkey
+var passkeyEnrollmentPaths = []string{"/settings", "/settings/passkeys", "/logout"}
+
+// requirePasskeyEnrollment sends users whose role requires a passkey to the
+// settings page until they have registered one. It returns true if the request
+// was handled.
+func (s *Server) requirePasskeyEnrollment(w http.ResponseWriter, r *http.Request, user *models.User) bool {
+	for _, p := range passkeyEnrollmentPaths {
+		if r.URL.Path == p || strings.HasPrefix(r.URL.Path, p+"/") {
+			return false
+		}
+	}
+	if !passkeyRequired(user) || hasPasskeys(user.Id) {
+		return false
+	}
+
+	if r.Method == http.MethodGet {
+		http.Redirect(w, r, "/settings?passkey_required=1", http.StatusSeeOther)
+	} else {
+		s.sendError(w, http.StatusForbidden, "Register a passkey in Settings to continue")
+	}
+	return true
+}
+
+// pendingLoginUser returns the user who entered a correct password and still
+// has to pass the second factor
+func pendingLoginUser(r *http.Request) (*models.User, error) {
+	cookie, err := r.Cookie("totp_pending")
+	if err != nil {
+		return nil, err
+	}
+
+	pendingData, err := decodePendingLogin(cookie.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	// The password step is only valid for 5 minutes
+	if time.Now().Unix()-pendingData.CreatedAt > 300 {
+		return nil, errPendingLoginExpired
+	}
+
+	user, err := database.DB.GetUserByID(pendingData.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.IsActive {
+		return nil, auth.ErrAccountDisabled
+	}
+	return user, nil
+}
+
+var errPendingLoginExpired = errors.New("login session expired")
+
+// pendingLoginKeyConfig is the Configuration key holding the signing key of
+// the totp_pending cookie
+const pendingLoginKeyConfig = "pending_login_key"
+
+var errPendingLoginSignature = errors.New("invalid login session")
+
+// pendingLogin is the password step of a login, kept in the totp_pending cookie.
+// The cookie is HMAC-signed: it is the only proof that the password was correct.
+type pendingLogin struct {
+	UserID    int   `json:"user_id"`
+	CreatedAt int64 `json:"created_at"`
+	Remember  bool  `json:"remember"`
+}
+
+// encodePendingLogin returns the signed totp_pending cookie value
+func encodePendingLogin(pendingData *pendingLogin) (string, error) {
+	pendingJSON, err := json.Marshal(pendingData)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.StdEncoding.EncodeToString(pendingJSON)
+	mac, err := signPendingLogin(payload)
+	if err != nil {
+		return "", err
+	}
+	return payload + "." + mac, nil
+}
+
+// signPendingLogin computes the HMAC-SHA256 signature of a cookie payload
+func signPendingLogin(payload string) (string, error) {
+	key, err := signingKey(pendingLoginKeyConfig)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+func decodePendingLogin(value string) (*pendingLogin, error) {
+	payload, mac, ok := strings.Cut(value, ".")
+	if !ok {
+		return nil, errPendingLoginSignature
+	}
+	expected, err := signPendingLogin(payload)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal([]byte(mac), []byte(expected)) {
+		return nil, errPendingLoginSignature
+	}
+
+	decodedData, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, err
+	}
+	pendingData := &pendingLogin{}
+	if err := json.Unmarshal(decodedData, pendingData); err != nil {
+		return nil, err
+	}
+	return pendingData, nil
+}
+
+// rememberRequested reports whether the user ticked "Remember this device",
+// either with their password or on a passwordless passkey login
+func rememberRequested(r *http.Request) bool {
+	if r.URL.Query().Get("remember") == "1" {
+		return true
+	}
+	cookie, err := r.Cookie("totp_pending")
+	if err != nil {
+		return false
+	}
+	pendingData, err := decodePendingLogin(cookie.Value)
+	return err == nil && pendingData.Remember
+}
+
+// completeLogin creates the session once every factor has passed, audits the
+// login and returns the page to continue to
+func (s *Server) completeLogin(w http.ResponseWriter, r *http.Request, user *models.User, method string) (string, error) {
+	// The second factor step is over
+	http.SetCookie(w, &http.Cookie{
+		Name:     "totp_pending",
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+
+	createSession := auth.CreateSession
+	if rememberRequested(r) {
+		createSession = auth.CreateRememberedSession
+	}
+	sessionID, err := createSession(user.Id, getClientIP(r), r.UserAgent())
+	if err != nil {
+		return "", err
+	}
+
+	database.DB.LogAction(&database.AuditLogEntry{
+		UserID:     int64(user.Id),
+		UserEmail:  user.Email,
+		Action:     database.ActionLoginSuccess,
+		EntityType: database.EntitySession,
+		EntityID:   sessionID,
+		Details: database.CreateAuditDetails(map[string]interface{}{
+			"email":      user.Email,
+			"success":    true,
+			"method":     method,
+			"remembered": sessionRemembered(sessionID),
+		}),
+		IPAddress: getClientIP(r),
+		UserAgent: r.UserAgent(),
+		Success:   true,
+	})
+
+	s.checkLoginDevice(r, user)
+	setSessionCookie(w, sessionID, http.SameSiteStrictMode)
+
+	return homePath(user), nil
+}
+
+// logPasskeyFailure audits a failed passkey sign-in
+func logPasskeyFailure(r *http.Request, user *models.User, reason string) {
+	entry := &database.AuditLogEntry{
+		Action:     database.ActionLoginFailed,
+		EntityType: database.EntitySession,
+		IPAddress:  getClientIP(r),
+		UserAgent:  r.UserAgent(),
+		Success:    false,
+		ErrorMsg:   reason,
+	}
+	details := map[string]interface{}{"method": "passkey", "reason": reason}
+	if user != nil {
+		entry.UserID = int64(user.Id)
+		entry.UserEmail = user.Email
+		details["email"] = user.Email
+	}
+	entry.Details = database.CreateAuditDetails(details)
+	database.DB.LogAction(entry)
+}
+
+// handlePasskeyList returns the current user's passkeys
+// GET /settings/passkeys
+func (s *Server) handlePasskeyList(w http.ResponseWriter, r *http.Request) {
+	user, ok := userFromContext(r.Context())
+	if !ok {
+		s.sendError(w, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+
+	creds, err := database.DB.GetWebAuthnCredentials(user.Id)
+	if err != nil {
+		log.Printf("Error fetching passkeys for user %d: %v", user.Id, err)
+		s.sendError(w, http.StatusInternalServerError, "Failed to fetch passkeys")
+		return
+	}
+
+	list := make([]map[string]interface{}, 0, len(creds))
+	for _, c := range creds {
+		list = append(list, map[string]interface{}{
+			"id":         c.Id,
+			"name":       c.Name,
+			"synced":     c.BackupEligible,
+			"created_at": c.CreatedAt,
+			"last_used":  c.LastUsedAt,
+		})
+	}
+
+	s.sendJSON(w, http.StatusOK, map[string]interface{}{
+		"passkeys": list,
+		"required": passkeyRequired(user),
+	})
+}
+
+// handlePasskeyRegisterBegin returns the options for navigator.credentials.create()
+// POST /settings/passkeys/register/begin
+func (s *Server) handlePasskeyRegisterBegin(w http.ResponseWriter, r *http.Request) {
+	user, ok := userFromContext(r.Context())
+	if !ok {
+		s.sendError(w, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+	if r.Method != http.MethodPost {
+		s.sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	rp, err := s.relyingParty()
+	if err != nil {
+		s.sendError(w, http.StatusInternalServerError, "Passkeys are unavailable: "+err.Error())
+		return
+	}
+
+	options, ceremonyID, err := rp.BeginRegistration(user)
+	if err != nil {
+		log.Printf("Passkey registration for user %d failed to start: %v", user.Id, err)
+		s.sendError(w, http.StatusInternalServerError, "Failed to start passkey registration")
+		return
+	}
+
+	setPasskeyCeremony(w, ceremonyID)
+	s.sendJSON(w, http.StatusOK, options)
+}
+
+// handlePasskeyRegisterFinish verifies and stores a new passkey
+// POST /settings/passkeys/register/finish?name=<name>
+func (s *Server) handlePasskeyRegisterFinish(w http.ResponseWriter, r *http.Request) {
+	user, ok := userFromContext(r.Context())
+	if !ok {
+		s.sendError(w, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+	if r.Method != http.MethodPost {
+		s.sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	name := strings.TrimSpace(r.URL.Query().Get("name"))
+	if name == "" {
+		name = "Passkey"
+	}
+	if len(name) > 100 {
+		s.sendError(w, http.StatusBadRequest, "Name is too long")
+		return
+	}
+
+	rp, err := s.relyingParty()
+	if err != nil {
+		s.sendError(w, http.StatusInternalServerError, "Passkeys are unavailable: "+err.Error())
+		return
+	}
+
+	cred, err := rp.FinishRegistration(user, takePasskeyCeremony(w, r), name, io.LimitReader(r.Body, maxPasskeyResponseSize))
+	if err != nil {
+		log.Printf("Passkey registration for user %d failed: %v", user.Id, err)
+		s.sendError(w, http.StatusBadRequest, "Passkey registration failed: "+err.Error())
+		return
+	}
+
+	database.DB.LogAction(&database.AuditLogEntry{
+		UserID:     int64(user.Id),
+		UserEmail:  user.Email,
+		Action:     database.ActionPasskeyRegistered,
+		EntityType: database.EntityPasskey,
+		EntityID:   strconv.Itoa(cred.Id),
+		Details: database.CreateAuditDetails(map[string]interface{}{
+			"name":        cred.Name,
+			"attestation": cred.AttestationType,
+			"transports":  cred.Transports,
+			"synced":      cred.BackupEligible,
+		}),
+		IPAddress: getClientIP(r),
+		UserAgent: r.UserAgent(),
+		Success:   true,
+	})
+
+	s.sendJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"id":      cred.Id,
+	})
+}
+
+// handlePasskeyRename renames one of the current user's passkeys
+// POST /settings/passkeys/rename
+func (s *Server) handlePasskeyRename(w http.ResponseWriter, r *http.Request) {
+	user, ok := userFromContext(r.Context())
+	if !ok {
+		s.sendError(w, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+	if r.Method != http.MethodPost {
+		s.sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	id, _ := strconv.Atoi(r.FormValue("id"))
+	name := strings.TrimSpace(r.FormValue("name"))
+	if name == "" || len(name) > 100 {
+		s.sendError(w, http.StatusBadRequest, "Name must be 1-100 characters")
+		return
+	}
+
+	if err := database.DB.RenameWebAuthnCredential(id, user.Id, name); err != nil {
+		s.sendError(w, http.StatusNotFound, "Passkey not found")
+		return
+	}
+
+	database.DB.LogAction(&database.AuditLogEntry{
+		UserID:     int64(user.Id),
+		UserEmail:  user.Email,
+		Action:     database.ActionPasskeyRenamed,
+		EntityType: database.EntityPasskey,
+		EntityID:   strconv.Itoa(id),
+		Details:    database.CreateAuditDetails(map[string]interface{}{"name": name}),
+		IPAddress:  getClientIP(r),
+		UserAgent:  r.UserAgent(),
+		Success:    true,
+	})
+
+	s.sendJSON(w, http.StatusOK, map[string]interface{}{"success": true})
+}
+
+// handlePasskeyDelete removes one of the current user's passkeys
+// POST /settings/passkeys/delete
+func (s *Server) handlePasskeyDelete(w http.ResponseWriter, r *http.Request) {
+	user, ok := userFromContext(r.Context())
+	if !ok {
+		s.sendError(w, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+	if r.Method != http.MethodPost {
+		s.sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	id, _ := strconv.Atoi(r.FormValue("id"))
+
+	// Users whose role requires a passkey cannot remove their last one
+	if passkeyRequired(user) {
+		if count, _ := database.DB.CountWebAuthnCredentials(user.Id); count <= 1 {
+			s.sendError(w, http.StatusBadRequest, "Your role requires a passkey. Add another passkey before removing this one.")
+			return
+		}
+	}
+
+	// Users whose role requires 2FA must keep a second factor
+	if !user.TOTPEnabled && mfaRequired(user) {
+		if count, _ := database.DB.CountWebAuthnCredentials(user.Id); count <= 1 {
+			s.sendError(w, http.StatusBadRequest, "Your role requires two-factor authentication. Enable 2FA or add another passkey before removing this one.")
+			return
+		}
+	}
+
+	if err := database.DB.DeleteWebAuthnCredential(id, user.Id); err != nil {
+		s.sendError(w, http.StatusNotFound, "Passkey not found")
+		return
+	}
+
+	database.DB.LogAction(&database.AuditLogEntry{
+		UserID:     int64(user.Id),
+		UserEmail:  user.Email,
+		Action:     database.ActionPasskeyRemoved,
+		EntityType: database.EntityPasskey,
+		EntityID:   strconv.Itoa(id),
+		Details:    database.CreateAuditDetails(map[string]interface{}{"user_id": user.Id}),
+		IPAddress:  getClientIP(r),
+		UserAgent:  r.UserAgent(),
+		Success:    true,
+	})
+
+	s.sendJSON(w, http.StatusOK, map[string]interface{}{"success": true})
+}
+
+// handleAdminResetPasskeys removes all passkeys of a user who lost their authenticators
+// POST /admin/users/passkeys/reset
+func (s *Server) handleAdminResetPasskeys(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	admin, _ := userFromContext(r.Context())
+	id, _ := strconv.Atoi(r.FormValue("user_id"))
+	user, err := database.DB.GetUserByID(id)
+	if err != nil {
+		s.sendError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if user.IsSuperAdmin() && !admin.IsSuperAdmin() {
+		s.sendError(w, http.StatusForbidden, "Only the super admin can reset their own passkeys")
+		return
+	}
+
+	removed, err := database.DB.DeleteWebAuthnCredentials(user.Id)
+	if err != nil {
+		s.sendError(w, http.StatusInternalServerError, "Failed to reset passkeys")
+		return
+	}
+
+	database.DB.LogAction(&database.AuditLogEntry{
+		UserID:     int64(admin.Id),
+		UserEmail:  admin.Email,
+		Action:     database.ActionPasskeyRemoved,
+		EntityType: database.EntityUser,
+		EntityID:   strconv.Itoa(user.Id),
+		Details: database.CreateAuditDetails(map[string]interface{}{
+			"email":   user.Email,
+			"removed": removed,
+			"reason":  "admin_reset",
+		}),
+		IPAddress: getClientIP(r),
+		UserAgent: r.UserAgent(),
+		Success:   true,
+	})
+	revokeSessionsAfterCredentialChange(r, admin, user, "passkeys_reset")
+
+	s.sendJSON(w, http.StatusOK, map[string]interface{}{"success": true, "removed": removed})
+}
+
+// handle2FAPasskeyBegin returns the options for a passkey second factor
+// POST /2fa/passkey/begin
+func (s *Server) handle2FAPasskeyBegin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	user, err := pendingLoginUser(r)
+	if err != nil {
+		s.sendError(w, http.StatusUnauthorized, "Sign in with your password first")
+		return
+	}
+
+	rp, err := s.relyingParty()
+	if err != nil {
+		s.sendError(w, http.StatusInternalServerError, "Passkeys are unavailable: "+err.Error())
+		return
+	}
+
+	options, ceremonyID, err := rp.BeginLogin(user)
+	if err != nil {
+		s.sendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	setPasskeyCeremony(w, ceremonyID)
+	s.sendJSON(w, http.StatusOK, options)
+}
+
+// handle2FAPasskeyFinish verifies the passkey second factor and signs the user in
+// POST /2fa/passkey/finish
+func (s *Server) handle2FAPasskeyFinish(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	user, err := pendingLoginUser(r)
+	if err != nil {
+		s.sendError(w, http.StatusUnauthorized, "Sign in with your password first")
+		return
+	}
+
+	lockKeys := []string{auth.TOTPLockKey(user.Id), s.ipLockKey(r)}
+	if until := auth.LockedUntil(lockKeys...); !until.IsZero() {
+		logLockedAttempt(r, user.Email, "totp", until)
+		s.sendError(w, http.StatusTooManyRequests, auth.LockoutMessage(until))
+		return
+	}
+
+	rp, err := s.relyingParty()
+	if err != nil {
+		s.sendError(w, http.StatusInternalServerError, "Passkeys are unavailable: "+err.Error())
+		return
+	}
+
+	if _, err := rp.FinishLogin(user, takePasskeyCeremony(w, r), io.LimitReader(r.Body, maxPasskeyResponseSize)); err != nil {
+		logPasskeyFailure(r, user, err.Error())
+		s.recordFailedAttempt(r, "totp", user.Email, lockKeys...)
+		s.sendError(w, http.StatusUnauthorized, "Passkey verification failed")
+		return
+	}
+	auth.ClearFailures(lockKeys[0])
+
+	redirect, err := s.completeLogin(w, r, user, "passkey")
+	if err != nil {
+		s.sendError(w, http.StatusInternalServerError, "Failed to create session")
+		return
+	}
+
+	s.sendJSON(w, http.StatusOK, map[string]interface{}{"success": true, "redirect": redirect})
+}
+
+// handlePasskeyLoginBegin starts a passwordless login
+// POST /auth/passkey/begin
+func (s *Server) handlePasskeyLoginBegin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	rp, err := s.relyingParty()
+	if err != nil {
+		s.sendError(w, http.StatusInternalServerError, "Passkeys are unavailable: "+err.Error())
+		return
+	}
+
+	options, ceremonyID, err := rp.BeginDiscoverableLogin()
+	if err != nil {
+		s.sendError(w, http.StatusInternalServerError, "Failed to start passkey sign-in")
+		return
+	}
+
+	setPasskeyCeremony(w, ceremonyID)
+	s.sendJSON(w, http.StatusOK, options)
+}
+
+// handlePasskeyLoginFinish completes a passwordless login. A verified passkey
+// replaces both the password and the second factor.
+// POST /auth/passkey/finish?redirect=<path>&remember=1
+func (s *Server) handlePasskeyLoginFinish(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	ipKey := s.ipLockKey(r)
+	if until := auth.LockedUntil(ipKey); !until.IsZero() {
+		logLockedAttempt(r, "", "passkey", until)
+		s.sendError(w, http.StatusTooManyRequests, auth.LockoutMessage(until))
+		return
+	}
+
+	rp, err := s.relyingParty()
+	if err != nil {
+		s.sendError(w, http.StatusInternalServerError, "Passkeys are unavailable: "+err.Error())
+		return
+	}
+
+	user, _, err := rp.FinishDiscoverableLogin(takePasskeyCeremony(w, r), io.LimitReader(r.Body, maxPasskeyResponseSize))
+	if err != nil {
+		logPasskeyFailure(r, nil, err.Error())
+		s.recordFailedAttempt(r, "passkey", "", ipKey)
+		s.sendError(w, http.StatusUnauthorized, "Passkey sign-in failed")
+		return
+	}
+
+	if !user.IsActive {
+		logPasskeyFailure(r, user, "account disabled")
+		s.sendError(w, http.StatusForbidden, "This account is disabled")
+		return
+	}
+	if localPasswordDisabled(user) {
+		logPasskeyFailure(r, user, "sso_required")
+		s.sendError(w, http.StatusForbidden, "This account signs in with single sign-on")
+		return
+	}
+
+	redirect, err := s.completeLogin(w, r, user, "passkey_passwordless")
+	if err != nil {
+		s.sendError(w, http.StatusInternalServerError, "Failed to create session")
+		return
+	}
+	if target := safeRedirect(r.URL.Query().Get("redirect")); target != "" {
+		redirect = target
+	}
+
+	s.sendJSON(w, http.StatusOK, map[string]interface{}{"success": true, "redirect": redirect})
+}
+
+// passkeyScript returns the browser helpers that translate between the JSON
+// options and responses used by the server and the WebAuthn API
+func passkeyScript() string {
+	return `
+        function b64urlToBuffer(value) {
+            value = value.replace(/-/g, '+').replace(/_/g, '/');
+            while (value.length % 4) value += '=';
+            return Uint8Array.from(atob(value), c => c.charCodeAt(0)).buffer;
+        }
+
+        function bufferToB64url(buffer) {
+            let binary = '';
+            new Uint8Array(buffer).forEach(b => binary += String.fromCharCode(b));
+            return btoa(binary).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '');
+        }
+
+        async function passkeyRequest(url, body) {
+            const response = await fetch(url, { method: 'POST', credentials: 'same-origin', body: body });
+            const data = await response.json();
+            if (!response.ok) throw new Error(data.error || 'Request failed');
+            return data;
+        }
+
+        async function passkeyCreate(options) {
+            const publicKey = options.publicKey;
+            publicKey.challenge = b64urlToBuffer(publicKey.challenge);
+            publicKey.user.id = b64urlToBuffer(publicKey.user.id);
+            (publicKey.excludeCredentials || []).forEach(c => c.id = b64urlToBuffer(c.id));
+
+            const credential = await navigator.credentials.create({ publicKey: publicKey });
+            return JSON.stringify({
+                id: credential.id,
+                rawId: bufferToB64url(credential.rawId),
+                type: credential.type,
+                authenticatorAttachment: credential.authenticatorAttachment,
+                response: {
+                    clientDataJSON: bufferToB64url(credential.response.clientDataJSON),
+                    attestationObject: bufferToB64url(credential.response.attestationObject),
+                    transports: credential.response.getTransports ? credential.response.getTransports() : []
+                }
+            });
+        }
+
+        async function passkeyGet(options) {
+            const publicKey = options.publicKey;
+            publicKey.challenge = b64urlToBuffer(publicKey.challenge);
+            (publicKey.allowCredentials || []).forEach(c => c.id = b64urlToBuffer(c.id));
+
+            const credential = await navigator.credentials.get({ publicKey: publicKey });
+            return JSON.stringify({
+                id: credential.id,
+                rawId: bufferToB64url(credential.rawId),
+                type: credential.type,
+                authenticatorAttachment: credential.authenticatorAttachment,
+                response: {
+                    clientDataJSON: bufferToB64url(credential.response.clientDataJSON),
+                    authenticatorData: bufferToB64url(credential.response.authenticatorData),
+                    signature: bufferToB64url(credential.response.signature),
+                    userHandle: credential.response.userHandle ? bufferToB64url(credential.response.userHandle) : null
+                }
+            });
+        }`
+}
+
+// getPasskeyLoginHTML returns the passwordless "Sign in with a passkey" button for the login page
+func (s *Server) getPasskeyLoginHTML(r *http.Request) string {
+	finishURL := "/auth/passkey/finish"
+	if redirect := safeRedirect(r.URL.Query().Get("redirect")); redirect != "" {
+		finishURL += "?redirect=" + url.QueryEscape(redirect)
+	}
+
+	return fmt.Sprintf(`
+        <div id="passkey-login" style="display: none;">
+            <div style="text-align: center; margin: 20px 0 10px; color: #999; font-size: 13px;">or</div>
+            <button type="button" class="btn" onclick="passkeyLogin()" style="background: white; color: %[1]s; border: 2px solid %[1]s;">🔑 Sign in with a passkey</button>
+        </div>
+        <script>%[2]s
+
+        if (window.PublicKeyCredential) {
+            document.getElementById('passkey-login').style.display = 'block';
+        }
+
+        async function passkeyLogin() {
+            try {
+                const options = await passkeyRequest('/auth/passkey/begin');
+                let finishURL = '%[3]s';
+                const remember = document.getElementById('remember');
+                if (remember && remember.checked) {
+                    finishURL += (finishURL.includes('?') ? '&' : '?') + 'remember=1';
+                }
+                const result = await passkeyRequest(finishURL, await passkeyGet(options));
+                window.location.href = result.redirect;
+            } catch (error) {
+                if (error.name !== 'NotAllowedError') alert(error.message);
+            }
+        }
+        </script>`, s.getPrimaryColor(), passkeyScript(), finishURL)
+}
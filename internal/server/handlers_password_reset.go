@@ -8,10 +8,13 @@ package server
 import (
 	"log"
 	"net/http"
+	"strconv"
 
 	"github.com/Frimurare/WulfVault/internal/auth"
 	"github.com/Frimurare/WulfVault/internal/database"
 	"github.com/Frimurare/WulfVault/internal/email"
+	"github.com/Frimurare/WulfVault/internal/models"
+	"github.com/Frimurare/WulfVault/internal/passwords"
 )
 
 // handleForgotPassword shows the forgot password page or handles the request
@@ -69,6 +72,9 @@ func (s *Server) handleForgotPassword(w http.ResponseWriter, r *http.Request) {
 			s.renderForgotPasswordPage(w, successMessage)
 			return
 		}
+		if accountType == database.AccountTypeUser {
+			logPasswordReset(r, user, database.ActionPasswordResetRequested)
+		}
 
 		// Send email asynchronously
 		go func() {
@@ -124,13 +130,34 @@ func (s *Server) handleResetPassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if len(password) < 6 {
-		s.renderResetPasswordPage(w, token, "Password must be at least 6 characters")
+	if password != confirmPassword {
+		s.renderResetPasswordPage(w, token, "Passwords do not match")
 		return
 	}
 
-	if password != confirmPassword {
-		s.renderResetPasswordPage(w, token, "Passwords do not match")
+	resetToken, err := database.DB.GetPasswordResetToken(token)
+	if err != nil {
+		s.renderResetPasswordPage(w, "", "Invalid or expired reset link")
+		return
+	}
+
+	// Enforce the password policy for the account being reset
+	accountType, accountId := resetToken.AccountType, 0
+	if accountType == database.AccountTypeUser {
+		user, _ := database.DB.GetUserByEmail(resetToken.Email)
+		err = checkUserPassword(password, resetToken.Email, user)
+		if user != nil {
+			accountId = user.Id
+		}
+	} else {
+		account, _ := database.DB.GetDownloadAccountByEmail(resetToken.Email)
+		err = checkDownloadAccountPassword(password, resetToken.Email, account)
+		if account != nil {
+			accountId = account.Id
+		}
+	}
+	if err != nil {
+		s.renderResetPasswordPage(w, token, err.Error())
 		return
 	}
 
@@ -149,12 +176,38 @@ func (s *Server) handleResetPassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if accountId != 0 {
+		passwords.Record(accountType, accountId, hashedPassword)
+	}
+	if accountType == database.AccountTypeUser {
+		if user, err := database.DB.GetUserByEmail(resetToken.Email); err == nil {
+			logPasswordReset(r, user, database.ActionPasswordResetCompleted)
+		}
+	}
+
 	log.Printf("Password reset successful for token: %s", token)
 
 	// Show success page
 	s.renderPasswordResetSuccessPage(w)
 }
 
+// logPasswordReset audits a password reset of a user, which shows in their security activity
+func logPasswordReset(r *http.Request, user *models.User, action string) {
+	database.DB.LogAction(&database.AuditLogEntry{
+		UserID:     int64(user.Id),
+		UserEmail:  user.Email,
+		Action:     action,
+		EntityType: database.EntityUser,
+		EntityID:   strconv.Itoa(user.Id),
+		Details: database.CreateAuditDetails(map[string]interface{}{
+			"email": user.Email,
+		}),
+		IPAddress: getClientIP(r),
+		UserAgent: r.UserAgent(),
+		Success:   true,
+	})
+}
+
 // renderForgotPasswordPage renders the forgot password form
 func (s *Server) renderForgotPasswordPage(w http.ResponseWriter, message string) {
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
@@ -323,6 +376,34 @@ func (s *Server) renderForgotPasswordPage(w http.ResponseWriter, message string)
 func (s *Server) renderResetPasswordPage(w http.ResponseWriter, token, errorMsg string) {
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 
+	policy := passwords.LoadPolicy()
+	minLength := strconv.Itoa(policy.MinLength)
+	policyTips := ""
+	if policy.RequireUpper {
+		policyTips += `
+            <p>• Minst en versal</p>`
+	}
+	if policy.RequireLower {
+		policyTips += `
+            <p>• Minst en gemen</p>`
+	}
+	if policy.RequireDigit {
+		policyTips += `
+            <p>• Minst en siffra</p>`
+	}
+	if policy.RequireSymbol {
+		policyTips += `
+            <p>• Minst ett specialtecken</p>`
+	}
+	if policy.HistoryCount > 0 {
+		policyTips += `
+            <p>• Inte något av dina ` + strconv.Itoa(policy.HistoryCount) + ` senaste lösenord</p>`
+	}
+	if policy.BreachList != "" {
+		policyTips += `
+            <p>• Lösenord som förekommit i dataintrång godkänns inte</p>`
+	}
+
 	errorHTML := ""
 	if errorMsg != "" {
 		errorHTML = `<div class="error-message">` + errorMsg + `</div>`
@@ -512,8 +593,8 @@ func (s *Server) renderResetPasswordPage(w http.ResponseWriter, token, errorMsg
             const password = document.getElementById('password').value;
             const confirmPassword = document.getElementById('confirm_password').value;
 
-            if (password.length < 6) {
-                alert('Lösenordet måste vara minst 6 tecken långt');
+            if (password.length < ` + minLength + `) {
+                alert('Lösenordet måste vara minst ` + minLength + ` tecken långt');
                 return false;
             }
 
@@ -537,7 +618,7 @@ func (s *Server) renderResetPasswordPage(w http.ResponseWriter, token, errorMsg
 
         <div class="info-box">
             <p><strong>Tips:</strong></p>
-            <p>• Minst 6 tecken</p>
+            <p>• Minst ` + minLength + ` tecken</p>` + policyTips + `
             <p>• Håll in ögat-ikonen för att se lösenordet</p>
             <p>• Se till att båda fälten matchar</p>
         </div>
@@ -545,7 +626,7 @@ func (s *Server) renderResetPasswordPage(w http.ResponseWriter, token, errorMsg
         <form method="POST" action="/reset-password?token=` + token + `" onsubmit="return validateForm()">
             <div class="form-group">
                 <label for="password">Nytt Lösenord</label>
-                <input type="password" id="password" name="password" required minlength="6" autofocus>
+                <input type="password" id="password" name="password" required minlength="` + minLength + `" autofocus>
                 <span class="password-toggle" id="password_icon"
                       onmousedown="togglePassword('password')"
                       onmouseup="togglePassword('password')"
@@ -553,7 +634,7 @@ func (s *Server) renderResetPasswordPage(w http.ResponseWriter, token, errorMsg
             </div>
             <div class="form-group">
                 <label for="confirm_password">Bekräfta Nytt Lösenord</label>
-                <input type="password" id="confirm_password" name="confirm_password" required minlength="6">
+                <input type="password" id="confirm_password" name="confirm_password" required minlength="` + minLength + `">
                 <span class="password-toggle" id="confirm_password_icon"
                       onmousedown="togglePassword('confirm_password')"
                       onmouseup="togglePassword('confirm_password')"
@@ -0,0 +1,89 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/Frimurare/WulfVault/internal/database"
+	"github.com/Frimurare/WulfVault/internal/models"
+	"github.com/Frimurare/WulfVault/internal/passwords"
+)
+
+// checkUserPassword validates a new password of a user against the password policy.
+// user is nil when the account is being created.
+func checkUserPassword(password, email string, user *models.User) error {
+	account := &passwords.Account{Type: database.AccountTypeUser, Email: email}
+	if user != nil {
+		account.Id = user.Id
+		account.CurrentHash = user.Password
+	}
+	return passwords.LoadPolicy().Check(password, account)
+}
+
+// checkDownloadAccountPassword validates a new password of a download account
+// against the password policy. account is nil when the account is being created.
+func checkDownloadAccountPassword(password, email string, account *models.DownloadAccount) error {
+	target := &passwords.Account{Type: database.AccountTypeDownloadAccount, Email: email}
+	if account != nil {
+		target.Id = account.Id
+		target.CurrentHash = account.Password
+	}
+	return passwords.LoadPolicy().Check(password, target)
+}
+
+// passwordExpired reports whether a user's local password is older than the
+// maximum password age. Users who sign in through OIDC or LDAP are exempt:
+// their password is managed by the identity provider.
+func passwordExpired(user *models.User) bool {
+	policy := passwords.LoadPolicy()
+	if policy.MaxAgeDays <= 0 {
+		return false
+	}
+	source, _, err := database.DB.GetUserAuthSource(user.Id)
+	if err != nil || source != database.AuthSourceLocal {
+		return false
+	}
+	return policy.Expired(database.AccountTypeUser, user.Id)
+}
+
+// passwordChangePaths stay reachable for users whose password has expired
+var passwordChangePaths = []string{"/settings", "/change-password", "/logout"}
+
+// requirePasswordChange sends users with an expired password to the settings
+// page until they have changed it. It returns true if the request was handled.
+func (s *Server) requirePasswordChange(w http.ResponseWriter, r *http.Request, user *models.User) bool {
+	for _, p := range passwordChangePaths {
+		if r.URL.Path == p || strings.HasPrefix(r.URL.Path, p+"/") {
+			return false
+		}
+	}
+	if !passwordExpired(user) {
+		return false
+	}
+
+	if r.Method == http.MethodGet {
+		http.Redirect(w, r, "/settings?password_expired=1", http.StatusSeeOther)
+	} else {
+		s.sendError(w, http.StatusForbidden, "Your password has expired. Change it in Settings to continue")
+	}
+	return true
+}
+
+// requireDownloadPasswordChange sends download accounts with an expired
+// password to the change password page. It returns true if the request was handled.
+func requireDownloadPasswordChange(w http.ResponseWriter, r *http.Request, account *models.DownloadAccount) bool {
+	if r.URL.Path == "/download/change-password" || r.URL.Path == "/download/logout" {
+		return false
+	}
+	if !passwords.LoadPolicy().Expired(database.AccountTypeDownloadAccount, account.Id) {
+		return false
+	}
+
+	http.Redirect(w, r, "/download/change-password?expired=1", http.StatusSeeOther)
+	return true
+}
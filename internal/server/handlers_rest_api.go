@@ -16,6 +16,8 @@ import (
 
 	"github.com/Frimurare/WulfVault/internal/database"
 	"github.com/Frimurare/WulfVault/internal/models"
+	"github.com/Frimurare/WulfVault/internal/passwords"
+	"github.com/Frimurare/WulfVault/internal/storage"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -306,11 +308,13 @@ func (s *Server) handleAPIGetUser(w http.ResponseWriter, r *http.Request) {
 	user.Password = ""
 	user.TOTPSecret = ""
 	user.BackupCodes = ""
+	roleId, _ := database.DB.GetUserRoleId(user)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success": true,
 		"user":    user,
+		"roleId":  roleId,
 	})
 }
 
@@ -326,8 +330,8 @@ func (s *Server) handleAPICreateUser(w http.ResponseWriter, r *http.Request) {
 		Name           string `json:"name"`
 		Email          string `json:"email"`
 		Password       string `json:"password"`
-		UserLevel      int    `json:"userLevel"`
-		Permissions    int    `json:"permissions"`
+		RoleId         int    `json:"roleId"`
+		UserLevel      int    `json:"userLevel"` // deprecated, use roleId
 		StorageQuotaMB int64  `json:"storageQuotaMB"`
 		IsActive       bool   `json:"isActive"`
 	}
@@ -343,6 +347,28 @@ func (s *Server) handleAPICreateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := checkUserPassword(req.Password, req.Email, nil); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.RoleId == 0 {
+		req.RoleId = legacyRoleId(req.UserLevel)
+	}
+	if req.RoleId == 0 {
+		req.RoleId = models.RoleIdUser
+	}
+	role, err := database.DB.GetRole(req.RoleId)
+	if err != nil {
+		http.Error(w, "Role not found", http.StatusBadRequest)
+		return
+	}
+	currentUser, _ := userFromContext(r.Context())
+	if !canGrant(currentUser, role.Permissions) {
+		http.Error(w, "You cannot assign a role with permissions you don't have", http.StatusForbidden)
+		return
+	}
+
 	// Hash password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
@@ -354,16 +380,17 @@ func (s *Server) handleAPICreateUser(w http.ResponseWriter, r *http.Request) {
 	if req.StorageQuotaMB == 0 {
 		req.StorageQuotaMB = 10240 // 10GB default
 	}
-	if req.UserLevel == 0 {
-		req.UserLevel = int(models.UserLevelUser)
+	userLevel := models.UserLevelUser
+	if role.IsAdministrative() {
+		userLevel = models.UserLevelAdmin
 	}
 
 	user := &models.User{
 		Name:           req.Name,
 		Email:          req.Email,
 		Password:       string(hashedPassword),
-		UserLevel:      models.UserRank(req.UserLevel),
-		Permissions:    models.UserPermission(req.Permissions),
+		UserLevel:      userLevel,
+		Permissions:    models.UserPermissionNone,
 		StorageQuotaMB: req.StorageQuotaMB,
 		IsActive:       req.IsActive,
 		CreatedAt:      time.Now().Unix(),
@@ -374,16 +401,19 @@ func (s *Server) handleAPICreateUser(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Error creating user (email may already exist)", http.StatusInternalServerError)
 		return
 	}
+	passwords.Record(database.AccountTypeUser, user.Id, user.Password)
+	if err := database.DB.SetUserRole(user, role); err != nil {
+		log.Printf("Error assigning role %d to user %d: %v", role.Id, user.Id, err)
+	}
 
 	// Log the action
-	currentUser, _ := userFromContext(r.Context())
 	database.DB.LogAction(&database.AuditLogEntry{
 		UserID:     int64(currentUser.Id),
 		UserEmail:  currentUser.Email,
 		Action:     "USER_CREATED",
 		EntityType: "User",
 		EntityID:   fmt.Sprintf("%d", user.Id),
-		Details:    fmt.Sprintf("{\"email\":\"%s\",\"name\":\"%s\",\"user_level\":%d}", user.Email, user.Name, user.UserLevel),
+		Details:    fmt.Sprintf("{\"email\":\"%s\",\"name\":\"%s\",\"user_level\":%d,\"role_id\":%d}", user.Email, user.Name, user.UserLevel, role.Id),
 		IPAddress:  getClientIP(r),
 		UserAgent:  r.UserAgent(),
 		Success:    true,
@@ -397,6 +427,7 @@ func (s *Server) handleAPICreateUser(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success": true,
 		"user":    user,
+		"roleId":  role.Id,
 	})
 }
 
@@ -420,8 +451,8 @@ func (s *Server) handleAPIUpdateUser(w http.ResponseWriter, r *http.Request) {
 		Name           string `json:"name"`
 		Email          string `json:"email"`
 		Password       string `json:"password,omitempty"`
-		UserLevel      int    `json:"userLevel"`
-		Permissions    int    `json:"permissions"`
+		RoleId         int    `json:"roleId"`
+		UserLevel      int    `json:"userLevel"` // deprecated, use roleId
 		StorageQuotaMB int64  `json:"storageQuotaMB"`
 		IsActive       bool   `json:"isActive"`
 	}
@@ -437,16 +468,42 @@ func (s *Server) handleAPIUpdateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	currentUser, _ := userFromContext(r.Context())
+	if !canManageUser(currentUser, user) {
+		http.Error(w, "You cannot change a user whose role has permissions you don't have", http.StatusForbidden)
+		return
+	}
+
+	// The super admin always has every permission, and nobody changes their own role
+	if req.RoleId == 0 {
+		req.RoleId = legacyRoleId(req.UserLevel)
+	}
+	if req.RoleId != 0 && !user.IsSuperAdmin() {
+		currentRoleId, _ := database.DB.GetUserRoleId(user)
+		if req.RoleId != currentRoleId {
+			if user.Id == currentUser.Id {
+				http.Error(w, "You cannot change your own role", http.StatusForbidden)
+				return
+			}
+			if err := assignRole(r, currentUser, user, req.RoleId); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
 	// Update fields
 	user.Name = req.Name
 	user.Email = req.Email
-	user.UserLevel = models.UserRank(req.UserLevel)
-	user.Permissions = models.UserPermission(req.Permissions)
 	user.StorageQuotaMB = req.StorageQuotaMB
 	user.IsActive = req.IsActive
 
 	// Update password if provided
 	if req.Password != "" {
+		if err := checkUserPassword(req.Password, user.Email, user); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 		if err != nil {
 			http.Error(w, "Error hashing password", http.StatusInternalServerError)
@@ -460,9 +517,11 @@ func (s *Server) handleAPIUpdateUser(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Error updating user", http.StatusInternalServerError)
 		return
 	}
+	if req.Password != "" {
+		passwords.Record(database.AccountTypeUser, user.Id, user.Password)
+	}
 
 	// Log the action
-	currentUser, _ := userFromContext(r.Context())
 	database.DB.LogAction(&database.AuditLogEntry{
 		UserID:     int64(currentUser.Id),
 		UserEmail:  currentUser.Email,
@@ -480,11 +539,13 @@ func (s *Server) handleAPIUpdateUser(w http.ResponseWriter, r *http.Request) {
 	user.Password = ""
 	user.TOTPSecret = ""
 	user.BackupCodes = ""
+	roleId, _ := database.DB.GetUserRoleId(user)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success": true,
 		"user":    user,
+		"roleId":  roleId,
 	})
 }
 
@@ -518,6 +579,10 @@ func (s *Server) handleAPIDeleteUser(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "User not found", http.StatusNotFound)
 		return
 	}
+	if !canManageUser(currentUser, deletedUser) {
+		http.Error(w, "You cannot delete a user whose role has permissions you don't have", http.StatusForbidden)
+		return
+	}
 
 	if err := database.DB.DeleteUser(userId, currentUser.Id); err != nil {
 		log.Printf("Error deleting user: %v", err)
@@ -687,7 +752,7 @@ func (s *Server) handleAPIUpdateFile(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check permissions
-	if file.UserId != user.Id && !user.HasPermissionEditOtherUploads() {
+	if file.UserId != user.Id && !hasPermission(user, models.RolePermManageAllFiles) {
 		http.Error(w, "Forbidden", http.StatusForbidden)
 		return
 	}
@@ -699,6 +764,10 @@ func (s *Server) handleAPIUpdateFile(w http.ResponseWriter, r *http.Request) {
 		UnlimitedDownloads bool   `json:"unlimitedDownloads"`
 		UnlimitedTime      bool   `json:"unlimitedTime"`
 		Password           string `json:"password,omitempty"`
+		AllowMagicLink     *bool  `json:"allowMagicLink,omitempty"`
+
+		AllowedRecipients        *[]string `json:"allowedRecipients,omitempty"`
+		NotifyRejectedRecipients *bool     `json:"notifyRejectedRecipients,omitempty"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -706,6 +775,21 @@ func (s *Server) handleAPIUpdateFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	req.ExpireAt, req.ExpireAtString, req.UnlimitedTime = limitExpireAt(user, req.ExpireAt, req.UnlimitedTime)
+
+	allowedRecipients := file.AllowedRecipients
+	if req.AllowedRecipients != nil {
+		allowedRecipients, err = database.NormalizeAllowedRecipients(strings.Join(*req.AllowedRecipients, ","))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	notifyRejections := file.NotifyRejections
+	if req.NotifyRejectedRecipients != nil {
+		notifyRejections = *req.NotifyRejectedRecipients
+	}
+
 	// Update file settings
 	if err := database.DB.UpdateFileSettings(fileId, req.DownloadsRemaining, req.ExpireAt,
 		req.ExpireAtString, req.UnlimitedDownloads, req.UnlimitedTime); err != nil {
@@ -714,6 +798,29 @@ func (s *Server) handleAPIUpdateFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Update sign-in link policy if provided
+	if req.AllowMagicLink != nil {
+		if err := database.DB.UpdateFileAllowMagicLink(fileId, *req.AllowMagicLink); err != nil {
+			log.Printf("Error updating sign-in link policy: %v", err)
+			http.Error(w, "Error updating file", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Update allowed recipients; naming recipients requires them to sign in
+	if err := database.DB.UpdateFileRecipients(fileId, allowedRecipients, notifyRejections); err != nil {
+		log.Printf("Error updating allowed recipients: %v", err)
+		http.Error(w, "Error updating file", http.StatusInternalServerError)
+		return
+	}
+	if allowedRecipients != "" && !file.RequireAuth {
+		if err := database.DB.UpdateFileRequireAuth(fileId, true); err != nil {
+			log.Printf("Error updating require auth: %v", err)
+			http.Error(w, "Error updating file", http.StatusInternalServerError)
+			return
+		}
+	}
+
 	// Update password if provided
 	if req.Password != "" {
 		if err := database.DB.UpdateFilePassword(fileId, req.Password); err != nil {
@@ -757,7 +864,7 @@ func (s *Server) handleAPIDeleteFile(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check permissions
-	if file.UserId != user.Id && !user.HasPermissionEditOtherUploads() {
+	if file.UserId != user.Id && !hasPermission(user, models.RolePermManageAllFiles) {
 		http.Error(w, "Forbidden", http.StatusForbidden)
 		return
 	}
@@ -799,7 +906,7 @@ func (s *Server) handleAPIGetFile(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check permissions
-	if file.UserId != user.Id && !user.IsAdmin() {
+	if file.UserId != user.Id && !hasPermission(user, models.RolePermViewAllFiles) {
 		http.Error(w, "Forbidden", http.StatusForbidden)
 		return
 	}
@@ -851,7 +958,7 @@ func (s *Server) handleAPIGetFileDownloads(w http.ResponseWriter, r *http.Reques
 	}
 
 	// Check permissions
-	if file.UserId != user.Id && !user.IsAdmin() {
+	if file.UserId != user.Id && !hasPermission(user, models.RolePermViewAllFiles) {
 		http.Error(w, "Forbidden", http.StatusForbidden)
 		return
 	}
@@ -911,7 +1018,7 @@ func (s *Server) handleAPISetFilePassword(w http.ResponseWriter, r *http.Request
 	}
 
 	// Check permissions
-	if file.UserId != user.Id && !user.HasPermissionEditOtherUploads() {
+	if file.UserId != user.Id && !hasPermission(user, models.RolePermManageAllFiles) {
 		http.Error(w, "Forbidden", http.StatusForbidden)
 		return
 	}
@@ -995,6 +1102,11 @@ func (s *Server) handleAPICreateDownloadAccount(w http.ResponseWriter, r *http.R
 		return
 	}
 
+	if err := checkDownloadAccountPassword(req.Password, req.Email, nil); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Hash password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
@@ -1015,6 +1127,7 @@ func (s *Server) handleAPICreateDownloadAccount(w http.ResponseWriter, r *http.R
 		http.Error(w, "Error creating account", http.StatusInternalServerError)
 		return
 	}
+	passwords.Record(database.AccountTypeDownloadAccount, account.Id, account.Password)
 
 	// Log the action
 	user, _ := userFromContext(r.Context())
@@ -1078,6 +1191,10 @@ func (s *Server) handleAPIUpdateDownloadAccount(w http.ResponseWriter, r *http.R
 	account.IsActive = req.IsActive
 
 	if req.Password != "" {
+		if err := checkDownloadAccountPassword(req.Password, account.Email, account); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 		if err != nil {
 			http.Error(w, "Error hashing password", http.StatusInternalServerError)
@@ -1091,6 +1208,9 @@ func (s *Server) handleAPIUpdateDownloadAccount(w http.ResponseWriter, r *http.R
 		http.Error(w, "Error updating account", http.StatusInternalServerError)
 		return
 	}
+	if req.Password != "" {
+		passwords.Record(database.AccountTypeDownloadAccount, account.Id, account.Password)
+	}
 
 	account.Password = ""
 
@@ -1226,7 +1346,7 @@ func (s *Server) handleAPIGetFileRequests(w http.ResponseWriter, r *http.Request
 	var requests []*models.FileRequest
 	var err error
 
-	if user.IsAdmin() {
+	if hasPermission(user, models.RolePermViewAllFiles) {
 		requests, err = database.DB.GetAllFileRequests()
 	} else {
 		requests, err = database.DB.GetFileRequestsByUser(user.Id)
@@ -1255,6 +1375,10 @@ func (s *Server) handleAPICreateFileRequest(w http.ResponseWriter, r *http.Reque
 	}
 
 	user, _ := userFromContext(r.Context())
+	if !hasPermission(user, models.RolePermCreateFileRequests) {
+		s.sendError(w, http.StatusForbidden, "Your role does not allow creating upload requests")
+		return
+	}
 
 	var req struct {
 		Title            string `json:"title"`
@@ -1322,7 +1446,7 @@ func (s *Server) handleAPIUpdateFileRequest(w http.ResponseWriter, r *http.Reque
 	}
 
 	// Check permissions
-	if fileRequest.UserId != user.Id && !user.IsAdmin() {
+	if fileRequest.UserId != user.Id && !hasPermission(user, models.RolePermManageAllFiles) {
 		http.Error(w, "Forbidden", http.StatusForbidden)
 		return
 	}
@@ -1385,7 +1509,7 @@ func (s *Server) handleAPIDeleteFileRequest(w http.ResponseWriter, r *http.Reque
 	}
 
 	// Check permissions
-	if fileRequest.UserId != user.Id && !user.IsAdmin() {
+	if fileRequest.UserId != user.Id && !hasPermission(user, models.RolePermManageAllFiles) {
 		http.Error(w, "Forbidden", http.StatusForbidden)
 		return
 	}
@@ -1570,6 +1694,18 @@ func (s *Server) handleAPIPermanentDeleteFile(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	user, _ := userFromContext(r.Context())
+
+	// Delete from disk (overwritten first when secure deletion is enabled)
+	cert, err := storage.RemoveBlob(s.config.UploadsDir, fileInfo, user.Email)
+	if err != nil {
+		log.Printf("Error deleting file from disk: %v", err)
+		if storage.SecureDeleteEnabled() {
+			http.Error(w, "Secure deletion failed, file kept in trash", http.StatusInternalServerError)
+			return
+		}
+	}
+
 	// Permanently delete file
 	if err := database.DB.PermanentDeleteFile(fileId); err != nil {
 		log.Printf("Error permanently deleting file: %v", err)
@@ -1577,8 +1713,11 @@ func (s *Server) handleAPIPermanentDeleteFile(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	if cert != nil {
+		storage.AuditDestruction(cert, int64(user.Id), user.Email, getClientIP(r), r.UserAgent())
+	}
+
 	// Log the action
-	user, _ := userFromContext(r.Context())
 	database.DB.LogAction(&database.AuditLogEntry{
 		UserID:     int64(user.Id),
 		UserEmail:  user.Email,
@@ -1591,11 +1730,16 @@ func (s *Server) handleAPIPermanentDeleteFile(w http.ResponseWriter, r *http.Req
 		Success:    true,
 	})
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	response := map[string]interface{}{
 		"success": true,
 		"message": "File permanently deleted",
-	})
+	}
+	if cert != nil {
+		response["certificate_id"] = cert.Id
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
 }
 
 // ===========================
@@ -1615,10 +1759,11 @@ func (s *Server) handleAPIGetStats(w http.ResponseWriter, r *http.Request) {
 	deletedFiles, _ := database.DB.GetDeletedFiles()
 	teams, _ := database.DB.GetAllTeams()
 
-	// Calculate total storage
-	var totalStorage int64
+	// Calculate total storage (logical) and space used on disk (physical)
+	var totalStorage, physicalStorage int64
 	for _, file := range files {
 		totalStorage += file.SizeBytes
+		physicalStorage += file.PhysicalSize()
 	}
 
 	// Count active users
@@ -1639,13 +1784,14 @@ func (s *Server) handleAPIGetStats(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success": true,
 		"stats": map[string]interface{}{
-			"userCount":         len(users),
-			"activeUserCount":   activeUsers,
-			"fileCount":         len(files),
-			"deletedFileCount":  len(deletedFiles),
-			"teamCount":         len(teams),
-			"totalStorageBytes": totalStorage,
-			"totalDownloads":    totalDownloads,
+			"userCount":            len(users),
+			"activeUserCount":      activeUsers,
+			"fileCount":            len(files),
+			"deletedFileCount":     len(deletedFiles),
+			"teamCount":            len(teams),
+			"totalStorageBytes":    totalStorage,
+			"physicalStorageBytes": physicalStorage,
+			"totalDownloads":       totalDownloads,
 		},
 	})
 }
@@ -0,0 +1,761 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Frimurare/WulfVault/internal/database"
+	"github.com/Frimurare/WulfVault/internal/models"
+)
+
+// maxRoleNameLength limits role names so they fit in the admin UI
+const maxRoleNameLength = 64
+
+// roleOf returns the role of a user. If it cannot be loaded the user gets no permissions.
+func roleOf(user *models.User) *models.Role {
+	role, err := database.DB.GetUserRole(user)
+	if err != nil {
+		log.Printf("Warning: failed to load role of user %d: %v", user.Id, err)
+		return &models.Role{}
+	}
+	return role
+}
+
+// hasPermission reports whether the role of a user grants the permission(s)
+func hasPermission(user *models.User, permission models.RolePermission) bool {
+	return roleOf(user).HasPermission(permission)
+}
+
+// requirePermission only lets authenticated users through whose role grants the permission
+func (s *Server) requirePermission(permission models.RolePermission, next http.HandlerFunc) http.HandlerFunc {
+	return s.requireAuth(func(w http.ResponseWriter, r *http.Request) {
+		user, _ := userFromContext(r.Context())
+		if !hasPermission(user, permission) {
+			if r.Method == http.MethodGet && !strings.HasPrefix(r.URL.Path, "/api/") {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+			} else {
+				s.sendError(w, http.StatusForbidden, "Your role does not allow this")
+			}
+			return
+		}
+		next(w, r)
+	})
+}
+
+// homePath returns the page users land on after signing in
+func homePath(user *models.User) string {
+	if user.IsAdmin() && hasPermission(user, models.RolePermViewDashboard) {
+		return "/admin"
+	}
+	return "/dashboard"
+}
+
+// limitExpireAt applies the maximum file expiry of a user's role to an expiry
+// timestamp. Files of users with a limited role cannot be kept forever.
+func limitExpireAt(user *models.User, expireAt int64, unlimitedTime bool) (int64, string, bool) {
+	role := roleOf(user)
+	if role.MaxExpiryDays > 0 {
+		latest := time.Now().AddDate(0, 0, role.MaxExpiryDays)
+		if unlimitedTime || expireAt <= 0 || expireAt > latest.Unix() {
+			return latest.Unix(), latest.Format("2006-01-02 15:04"), false
+		}
+	}
+	if expireAt <= 0 {
+		return expireAt, "", unlimitedTime
+	}
+	return expireAt, time.Unix(expireAt, 0).Format("2006-01-02 15:04"), unlimitedTime
+}
+
+// canGrant reports whether actor holds all the permissions, and so may hand them
+// out. Nobody can give others more than they have themselves.
+func canGrant(actor *models.User, permissions models.RolePermission) bool {
+	return roleOf(actor).HasPermission(permissions)
+}
+
+// canManageUser reports whether actor may change or delete the target user.
+// Only the super admin manages the super admin, and users whose role has
+// permissions the actor lacks are off limits.
+func canManageUser(actor, target *models.User) bool {
+	if target.IsSuperAdmin() {
+		return actor.IsSuperAdmin()
+	}
+	return canGrant(actor, roleOf(target).Permissions)
+}
+
+// assignRole gives a user a role after checking that the actor may grant it, and
+// records the change in the audit log
+func assignRole(r *http.Request, actor, user *models.User, roleId int) error {
+	role, err := database.DB.GetRole(roleId)
+	if err != nil {
+		return err
+	}
+	if !canGrant(actor, role.Permissions) {
+		return fmt.Errorf("you cannot assign the %s role because it has permissions you don't have", role.Name)
+	}
+
+	previousId, err := database.DB.GetUserRoleId(user)
+	if err != nil {
+		return err
+	}
+	if err := database.DB.SetUserRole(user, role); err != nil {
+		return err
+	}
+	if previousId == role.Id {
+		return nil
+	}
+
+	database.DB.LogAction(&database.AuditLogEntry{
+		UserID:     int64(actor.Id),
+		UserEmail:  actor.Email,
+		Action:     database.ActionUserRoleChanged,
+		EntityType: database.EntityUser,
+		EntityID:   strconv.Itoa(user.Id),
+		Details: database.CreateAuditDetails(map[string]interface{}{
+			"email":            user.Email,
+			"role":             role.Name,
+			"role_id":          role.Id,
+			"previous_role_id": previousId,
+		}),
+		IPAddress: getClientIP(r),
+		UserAgent: r.UserAgent(),
+		Success:   true,
+	})
+	return nil
+}
+
+// legacyRoleId maps the user levels of older API clients to the built-in roles.
+// It returns 0 for levels that don't map to a role.
+func legacyRoleId(level int) int {
+	switch models.UserRank(level) {
+	case models.UserLevelAdmin:
+		return models.RoleIdAdministrator
+	case models.UserLevelUser:
+		return models.RoleIdUser
+	}
+	return 0
+}
+
+// validateRole checks a role before it is stored
+func validateRole(actor *models.User, role *models.Role) error {
+	role.Name = strings.TrimSpace(role.Name)
+	role.Description = strings.TrimSpace(role.Description)
+	if role.Name == "" {
+		return errors.New("Role name is required")
+	}
+	if len(role.Name) > maxRoleNameLength {
+		return fmt.Errorf("Role name must be at most %d characters", maxRoleNameLength)
+	}
+	if role.MaxExpiryDays < 0 {
+		return errors.New("Maximum expiry cannot be negative")
+	}
+	if !canGrant(actor, role.Permissions) {
+		return errors.New("You cannot grant permissions you don't have yourself")
+	}
+	if existing, err := database.DB.GetRoleByName(role.Name); err == nil && existing.Id != role.Id {
+		return errors.New("A role with this name already exists")
+	}
+	return nil
+}
+
+// logRoleAction records a change to a role in the audit log
+func logRoleAction(r *http.Request, actor *models.User, action string, role *models.Role) {
+	database.DB.LogAction(&database.AuditLogEntry{
+		UserID:     int64(actor.Id),
+		UserEmail:  actor.Email,
+		Action:     action,
+		EntityType: database.EntityRole,
+		EntityID:   strconv.Itoa(role.Id),
+		Details: database.CreateAuditDetails(map[string]interface{}{
+			"name":            role.Name,
+			"permissions":     strings.Join(role.PermissionNames(), ","),
+			"max_expiry_days": role.MaxExpiryDays,
+		}),
+		IPAddress: getClientIP(r),
+		UserAgent: r.UserAgent(),
+		Success:   true,
+	})
+}
+
+// roleJSON is the REST representation of a role
+func roleJSON(role *models.Role, userCount int) map[string]interface{} {
+	return map[string]interface{}{
+		"id":            role.Id,
+		"name":          role.Name,
+		"description":   role.Description,
+		"permissions":   role.PermissionNames(),
+		"maxExpiryDays": role.MaxExpiryDays,
+		"isBuiltin":     role.IsBuiltin,
+		"require2fa":    role.Require2FA,
+		"userCount":     userCount,
+		"createdAt":     role.CreatedAt,
+	}
+}
+
+// handleAdminRoles lists the roles
+func (s *Server) handleAdminRoles(w http.ResponseWriter, r *http.Request) {
+	roles, err := database.DB.GetAllRoles()
+	if err != nil {
+		log.Printf("Error fetching roles: %v", err)
+		http.Error(w, "Failed to fetch roles", http.StatusInternalServerError)
+		return
+	}
+	counts, err := database.DB.CountUsersByRole()
+	if err != nil {
+		log.Printf("Error counting users per role: %v", err)
+		counts = map[int]int{}
+	}
+
+	s.renderAdminRoles(w, roles, counts)
+}
+
+// roleFromForm reads the role fields of the role form
+func roleFromForm(r *http.Request, role *models.Role) {
+	role.Name = r.FormValue("name")
+	role.Description = r.FormValue("description")
+	role.MaxExpiryDays, _ = strconv.Atoi(r.FormValue("max_expiry_days"))
+	role.Permissions, _ = models.ParseRolePermissions(r.Form["permissions"])
+}
+
+// handleAdminRoleCreate shows the role form and creates a role
+func (s *Server) handleAdminRoleCreate(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		s.renderAdminRoleForm(w, nil, "")
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		s.renderAdminRoleForm(w, nil, "Invalid form data")
+		return
+	}
+
+	actor, _ := userFromContext(r.Context())
+	role := &models.Role{}
+	roleFromForm(r, role)
+	if err := validateRole(actor, role); err != nil {
+		s.renderAdminRoleForm(w, role, err.Error())
+		return
+	}
+	if err := database.DB.CreateRole(role); err != nil {
+		log.Printf("Error creating role: %v", err)
+		s.renderAdminRoleForm(w, role, "Failed to create role")
+		return
+	}
+
+	logRoleAction(r, actor, database.ActionRoleCreated, role)
+	http.Redirect(w, r, "/admin/roles", http.StatusSeeOther)
+}
+
+// handleAdminRoleEdit shows the role form for an existing role and updates it
+func (s *Server) handleAdminRoleEdit(w http.ResponseWriter, r *http.Request) {
+	roleId, _ := strconv.Atoi(r.URL.Query().Get("id"))
+	role, err := database.DB.GetRole(roleId)
+	if err != nil {
+		http.Error(w, "Role not found", http.StatusNotFound)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		s.renderAdminRoleForm(w, role, "")
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if role.Id == models.RoleIdAdministrator {
+		s.renderAdminRoleForm(w, role, "The Administrator role cannot be changed")
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		s.renderAdminRoleForm(w, role, "Invalid form data")
+		return
+	}
+
+	actor, _ := userFromContext(r.Context())
+	if !canGrant(actor, role.Permissions) {
+		s.renderAdminRoleForm(w, role, "You cannot change a role that has permissions you don't have")
+		return
+	}
+	roleFromForm(r, role)
+	if err := validateRole(actor, role); err != nil {
+		s.renderAdminRoleForm(w, role, err.Error())
+		return
+	}
+	if err := database.DB.UpdateRole(role); err != nil {
+		log.Printf("Error updating role %d: %v", role.Id, err)
+		s.renderAdminRoleForm(w, role, "Failed to update role")
+		return
+	}
+
+	logRoleAction(r, actor, database.ActionRoleUpdated, role)
+	http.Redirect(w, r, "/admin/roles", http.StatusSeeOther)
+}
+
+// handleAdminRoleDelete deletes a custom role that is no longer assigned
+func (s *Server) handleAdminRoleDelete(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	roleId, _ := strconv.Atoi(r.FormValue("id"))
+	role, err := database.DB.GetRole(roleId)
+	if err != nil {
+		s.sendError(w, http.StatusNotFound, "Role not found")
+		return
+	}
+
+	actor, _ := userFromContext(r.Context())
+	if !canGrant(actor, role.Permissions) {
+		s.sendError(w, http.StatusForbidden, "You cannot delete a role that has permissions you don't have")
+		return
+	}
+	if err := database.DB.DeleteRole(role.Id); err != nil {
+		if errors.Is(err, database.ErrRoleInUse) {
+			s.sendError(w, http.StatusConflict, "The role is still assigned to users. Assign them another role first.")
+			return
+		}
+		s.sendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	logRoleAction(r, actor, database.ActionRoleDeleted, role)
+	s.sendJSON(w, http.StatusOK, map[string]string{"message": "Role deleted"})
+}
+
+// handleRESTRoleRoutes routes /api/v1/roles and /api/v1/roles/{id}
+func (s *Server) handleRESTRoleRoutes(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/roles"), "/")
+	actor, _ := userFromContext(r.Context())
+
+	if path == "" {
+		switch r.Method {
+		case http.MethodGet:
+			roles, err := database.DB.GetAllRoles()
+			if err != nil {
+				s.sendError(w, http.StatusInternalServerError, "Failed to fetch roles")
+				return
+			}
+			counts, _ := database.DB.CountUsersByRole()
+			list := []map[string]interface{}{}
+			for _, role := range roles {
+				list = append(list, roleJSON(role, counts[role.Id]))
+			}
+			available := []string{}
+			for _, p := range models.RolePermissions {
+				available = append(available, p.Name)
+			}
+			s.sendJSON(w, http.StatusOK, map[string]interface{}{
+				"success":     true,
+				"roles":       list,
+				"permissions": available,
+			})
+		case http.MethodPost:
+			role := &models.Role{}
+			if !s.decodeRoleRequest(w, r, role) {
+				return
+			}
+			if err := validateRole(actor, role); err != nil {
+				s.sendError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			if err := database.DB.CreateRole(role); err != nil {
+				log.Printf("Error creating role: %v", err)
+				s.sendError(w, http.StatusInternalServerError, "Failed to create role")
+				return
+			}
+			logRoleAction(r, actor, database.ActionRoleCreated, role)
+			s.sendJSON(w, http.StatusCreated, map[string]interface{}{"success": true, "role": roleJSON(role, 0)})
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	roleId, err := strconv.Atoi(path)
+	if err != nil {
+		s.sendError(w, http.StatusBadRequest, "Invalid role ID")
+		return
+	}
+	role, err := database.DB.GetRole(roleId)
+	if err != nil {
+		s.sendError(w, http.StatusNotFound, "Role not found")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		counts, _ := database.DB.CountUsersByRole()
+		s.sendJSON(w, http.StatusOK, map[string]interface{}{"success": true, "role": roleJSON(role, counts[role.Id])})
+
+	case http.MethodPut:
+		if role.Id == models.RoleIdAdministrator {
+			s.sendError(w, http.StatusBadRequest, "The Administrator role cannot be changed")
+			return
+		}
+		if !canGrant(actor, role.Permissions) {
+			s.sendError(w, http.StatusForbidden, "You cannot change a role that has permissions you don't have")
+			return
+		}
+		if !s.decodeRoleRequest(w, r, role) {
+			return
+		}
+		if err := validateRole(actor, role); err != nil {
+			s.sendError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err := database.DB.UpdateRole(role); err != nil {
+			log.Printf("Error updating role %d: %v", role.Id, err)
+			s.sendError(w, http.StatusInternalServerError, "Failed to update role")
+			return
+		}
+		logRoleAction(r, actor, database.ActionRoleUpdated, role)
+		counts, _ := database.DB.CountUsersByRole()
+		s.sendJSON(w, http.StatusOK, map[string]interface{}{"success": true, "role": roleJSON(role, counts[role.Id])})
+
+	case http.MethodDelete:
+		if !canGrant(actor, role.Permissions) {
+			s.sendError(w, http.StatusForbidden, "You cannot delete a role that has permissions you don't have")
+			return
+		}
+		if err := database.DB.DeleteRole(role.Id); err != nil {
+			if errors.Is(err, database.ErrRoleInUse) {
+				s.sendError(w, http.StatusConflict, "The role is still assigned to users")
+				return
+			}
+			s.sendError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		logRoleAction(r, actor, database.ActionRoleDeleted, role)
+		s.sendJSON(w, http.StatusOK, map[string]interface{}{"success": true, "message": "Role deleted"})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// decodeRoleRequest reads a role from a REST request body into role.
+// It returns false after sending an error response.
+func (s *Server) decodeRoleRequest(w http.ResponseWriter, r *http.Request, role *models.Role) bool {
+	var req struct {
+		Name          string   `json:"name"`
+		Description   string   `json:"description"`
+		Permissions   []string `json:"permissions"`
+		MaxExpiryDays int      `json:"maxExpiryDays"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.sendError(w, http.StatusBadRequest, "Invalid request")
+		return false
+	}
+	permissions, ok := models.ParseRolePermissions(req.Permissions)
+	if !ok {
+		s.sendError(w, http.StatusBadRequest, "Unknown permission")
+		return false
+	}
+
+	role.Name = req.Name
+	role.Description = req.Description
+	role.Permissions = permissions
+	role.MaxExpiryDays = req.MaxExpiryDays
+	return true
+}
+
+// roleOptionsHTML renders the <option> elements of a role select
+func roleOptionsHTML(selectedId int) string {
+	roles, err := database.DB.GetAllRoles()
+	if err != nil {
+		log.Printf("Error fetching roles: %v", err)
+		return ""
+	}
+	options := ""
+	for _, role := range roles {
+		selected := ""
+		if role.Id == selectedId {
+			selected = " selected"
+		}
+		options += fmt.Sprintf(`
+            <option value="%d"%s>%s</option>`, role.Id, selected, template.HTMLEscapeString(role.Name))
+	}
+	return options
+}
+
+// renderAdminRoles renders the role list
+func (s *Server) renderAdminRoles(w http.ResponseWriter, roles []*models.Role, counts map[int]int) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	html := `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <meta name="author" content="Ulf Holmström">
+    <title>Roles - ` + s.config.CompanyName + `</title>
+    ` + s.getFaviconHTML() + `
+    <link rel="stylesheet" href="/static/css/style.css">
+    <style>
+        * { margin: 0; padding: 0; box-sizing: border-box; }
+        body {
+            font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Roboto, sans-serif;
+            background: #f5f5f5;
+        }
+        .container {
+            max-width: 1400px;
+            margin: 40px auto;
+            padding: 0 20px;
+        }
+        .page-header {
+            display: flex;
+            justify-content: space-between;
+            align-items: center;
+            margin-bottom: 20px;
+        }
+        h2 {
+            color: #333;
+        }
+        table {
+            width: 100%;
+            background: white;
+            border-collapse: collapse;
+            border-radius: 8px;
+            overflow: hidden;
+            box-shadow: 0 1px 3px rgba(0,0,0,0.08);
+        }
+        th, td {
+            padding: 12px 16px;
+            text-align: left;
+            border-bottom: 1px solid #eee;
+            font-size: 14px;
+            vertical-align: top;
+        }
+        th {
+            background: ` + s.getPrimaryColor() + `;
+            color: white;
+            font-weight: 600;
+        }
+        .permission {
+            display: inline-block;
+            background: #e3f2fd;
+            color: #0d47a1;
+            padding: 2px 8px;
+            border-radius: 10px;
+            font-size: 12px;
+            margin: 2px 2px 2px 0;
+        }
+        .builtin {
+            font-size: 12px;
+            color: #999;
+        }
+        .btn {
+            padding: 6px 12px;
+            border-radius: 6px;
+            font-size: 13px;
+            font-weight: 600;
+            text-decoration: none;
+            background: ` + s.getPrimaryColor() + `;
+            color: white;
+            border: none;
+            cursor: pointer;
+        }
+        .btn-danger {
+            background: #f44336;
+        }
+    </style>
+</head>
+<body>
+    ` + s.getAdminHeaderHTML("") + `
+    <div class="container">
+        <div class="page-header">
+            <h2>🔐 Roles</h2>
+            <a class="btn" href="/admin/roles/create">+ Create Role</a>
+        </div>
+
+        <table>
+            <thead>
+                <tr>
+                    <th>Role</th>
+                    <th>Permissions</th>
+                    <th>Max Expiry</th>
+                    <th>Users</th>
+                    <th></th>
+                </tr>
+            </thead>
+            <tbody>`
+
+	for _, role := range roles {
+		permissions := ""
+		for _, p := range models.RolePermissions {
+			if role.HasPermission(p.Permission) {
+				permissions += `<span class="permission">` + p.Description + `</span>`
+			}
+		}
+		if permissions == "" {
+			permissions = `<span class="builtin">None</span>`
+		}
+
+		maxExpiry := "Unlimited"
+		if role.MaxExpiryDays > 0 {
+			maxExpiry = fmt.Sprintf("%d days", role.MaxExpiryDays)
+		}
+
+		name := template.HTMLEscapeString(role.Name)
+		if role.IsBuiltin {
+			name += ` <span class="builtin">(built in)</span>`
+		}
+		if role.Require2FA {
+			name += ` <span class="permission">2FA required</span>`
+		}
+
+		actions := ""
+		if role.Id != models.RoleIdAdministrator {
+			actions = fmt.Sprintf(`<a class="btn" href="/admin/roles/edit?id=%d">Edit</a>`, role.Id)
+		}
+		if !role.IsBuiltin {
+			actions += fmt.Sprintf(` <button class="btn btn-danger" onclick="deleteRole(%d)">Delete</button>`, role.Id)
+		}
+
+		html += fmt.Sprintf(`
+                <tr>
+                    <td><strong>%s</strong><br><span class="builtin">%s</span></td>
+                    <td>%s</td>
+                    <td>%s</td>
+                    <td>%d</td>
+                    <td style="white-space: nowrap;">%s</td>
+                </tr>`,
+			name, template.HTMLEscapeString(role.Description), permissions, maxExpiry, counts[role.Id], actions)
+	}
+
+	html += `
+            </tbody>
+        </table>
+    </div>
+
+    <script>
+        function deleteRole(id) {
+            if (!confirm('Delete this role?')) {
+                return;
+            }
+            fetch('/admin/roles/delete', {
+                method: 'POST',
+                headers: {'Content-Type': 'application/x-www-form-urlencoded'},
+                body: 'id=' + id
+            })
+            .then(response => response.json())
+            .then(data => {
+                if (data.error) {
+                    alert(data.error);
+                } else {
+                    window.location.reload();
+                }
+            })
+            .catch(() => alert('Failed to delete role'));
+        }
+    </script>
+</body>
+</html>`
+
+	w.Write([]byte(html))
+}
+
+// renderAdminRoleForm renders the form to create or edit a role
+func (s *Server) renderAdminRoleForm(w http.ResponseWriter, role *models.Role, errorMsg string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	isEdit := role != nil && role.Id != 0
+	title := "Create Role"
+	action := "/admin/roles/create"
+	if isEdit {
+		title = "Edit Role"
+		action = fmt.Sprintf("/admin/roles/edit?id=%d", role.Id)
+	}
+	if role == nil {
+		role = &models.Role{Permissions: models.RolePermBasic}
+	}
+	readonly := ""
+	if role.Id == models.RoleIdAdministrator {
+		readonly = " disabled"
+	}
+
+	html := `<!DOCTYPE html>
+<html>
+<head>
+    <meta name="author" content="Ulf Holmström">
+    <title>` + title + `</title>
+    ` + s.getFaviconHTML() + `
+    <style>
+        * { margin: 0; padding: 0; box-sizing: border-box; }
+        body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Roboto, sans-serif; background: #f5f5f5; }
+        .container { max-width: 600px; margin: 40px auto; padding: 20px; background: white; border-radius: 12px; box-shadow: 0 2px 8px rgba(0,0,0,0.1); }
+        h2 { margin-bottom: 24px; color: #333; }
+        input[type=text], input[type=number] { width: 100%; padding: 8px; margin: 8px 0; }
+        .permission { display: flex; align-items: center; gap: 8px; margin: 6px 0; cursor: pointer; }
+        .help-text { font-size: 13px; color: #666; margin-bottom: 12px; }
+        button { padding: 10px 20px; background: ` + s.getPrimaryColor() + `; color: white; border: none; cursor: pointer; border-radius: 6px; }
+        .error { background: #fee; padding: 10px; margin: 10px 0; border-radius: 4px; color: #c33; }
+    </style>
+</head>
+<body>
+    ` + s.getAdminHeaderHTML("") + `
+    <div class="container">
+        <h2>` + title + `</h2>`
+
+	if errorMsg != "" {
+		html += `<div class="error">` + template.HTMLEscapeString(errorMsg) + `</div>`
+	}
+
+	html += `
+    <form method="POST" action="` + action + `">
+        <label>Name:</label>
+        <input type="text" name="name" value="` + template.HTMLEscapeString(role.Name) + `" maxlength="` + strconv.Itoa(maxRoleNameLength) + `" required` + readonly + `>
+
+        <label>Description:</label>
+        <input type="text" name="description" value="` + template.HTMLEscapeString(role.Description) + `"` + readonly + `>
+
+        <label>Maximum File Expiry (Days):</label>
+        <input type="number" name="max_expiry_days" value="` + strconv.Itoa(role.MaxExpiryDays) + `" min="0"` + readonly + `>
+        <p class="help-text">Longest expiry members can choose for their files. 0 = unlimited, including files that never expire.</p>
+
+        <label>Permissions:</label>`
+
+	for _, p := range models.RolePermissions {
+		checked := ""
+		if role.HasPermission(p.Permission) {
+			checked = " checked"
+		}
+		html += `
+        <label class="permission">
+            <input type="checkbox" name="permissions" value="` + p.Name + `"` + checked + readonly + `>
+            <span>` + p.Description + `</span>
+        </label>`
+	}
+
+	html += `
+        <p class="help-text">Members of roles with any permission beyond uploading, sharing and upload requests are administrators and see the admin area.</p>
+        <br>`
+	if readonly == "" {
+		html += `
+        <button type="submit">Save</button>`
+	}
+	html += `
+        <a href="/admin/roles">Back</a>
+    </form>
+    </div>
+</body>
+</html>`
+
+	w.Write([]byte(html))
+}
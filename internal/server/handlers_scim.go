@@ -0,0 +1,355 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package server
+
+import (
+	"encoding/json"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Frimurare/WulfVault/internal/database"
+	"github.com/Frimurare/WulfVault/internal/scim"
+)
+
+// scimMaxBodyBytes limits SCIM request bodies; large groups are sent as PATCH operations
+const scimMaxBodyBytes = 1 << 20
+
+// scimBaseURL returns the absolute URL of the SCIM root
+func (s *Server) scimBaseURL() string {
+	return strings.TrimSuffix(s.getPublicURL(), "/") + "/scim/v2"
+}
+
+// handleSCIM serves the SCIM 2.0 endpoints under /scim/v2/ for an identity
+// provider, authenticated with the SCIM bearer token
+func (s *Server) handleSCIM(w http.ResponseWriter, r *http.Request) {
+	settings := scim.LoadSettings()
+
+	header := r.Header.Get("Authorization")
+	token := ""
+	if len(header) > 7 && strings.EqualFold(header[:7], "bearer ") {
+		token = strings.TrimSpace(header[7:])
+	}
+	if !settings.Authenticate(token) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="WulfVault SCIM"`)
+		s.sendSCIMError(w, &scim.Error{Status: http.StatusUnauthorized, Detail: "invalid or missing SCIM token"})
+		return
+	}
+
+	var body []byte
+	if r.Method == http.MethodPost || r.Method == http.MethodPut || r.Method == http.MethodPatch {
+		var err error
+		body, err = io.ReadAll(http.MaxBytesReader(w, r.Body, scimMaxBodyBytes))
+		if err != nil {
+			s.sendSCIMError(w, &scim.Error{Status: http.StatusRequestEntityTooLarge, Detail: "request body too large"})
+			return
+		}
+	}
+
+	service := &scim.Service{Settings: settings, BaseURL: s.scimBaseURL(), DefaultQuotaMB: s.defaultQuotaMB()}
+
+	// Path is /scim/v2/{resource}[/{id}]
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/scim/v2"), "/"), "/")
+	resource, id := parts[0], ""
+	if len(parts) == 2 {
+		id = parts[1]
+	} else if len(parts) > 2 {
+		s.sendSCIMError(w, &scim.Error{Status: http.StatusNotFound, Detail: "unknown endpoint"})
+		return
+	}
+
+	switch resource {
+	case "Users":
+		s.serveSCIMUsers(w, r, service, id, body)
+	case "Groups":
+		s.serveSCIMGroups(w, r, service, id, body)
+	case "ServiceProviderConfig":
+		s.sendSCIM(w, http.StatusOK, scimServiceProviderConfig(service.BaseURL))
+	case "ResourceTypes":
+		s.sendSCIM(w, http.StatusOK, scimResourceTypes(service.BaseURL))
+	default:
+		s.sendSCIMError(w, &scim.Error{Status: http.StatusNotFound, Detail: "unknown endpoint"})
+	}
+}
+
+// serveSCIMUsers dispatches a request for /Users or /Users/{id}
+func (s *Server) serveSCIMUsers(w http.ResponseWriter, r *http.Request, service *scim.Service, id string, body []byte) {
+	switch {
+	case r.Method == http.MethodGet && id == "":
+		filter, startIndex, count := scimListParams(r)
+		list, serr := service.ListUsers(filter, startIndex, count)
+		s.sendSCIMResult(w, http.StatusOK, list, serr)
+	case r.Method == http.MethodGet:
+		user, serr := service.GetUser(id)
+		s.sendSCIMResult(w, http.StatusOK, user, serr)
+	case r.Method == http.MethodPost && id == "":
+		user, serr := service.CreateUser(body)
+		s.sendSCIMResult(w, http.StatusCreated, user, serr)
+	case r.Method == http.MethodPut && id != "":
+		user, serr := service.ReplaceUser(id, body)
+		s.sendSCIMResult(w, http.StatusOK, user, serr)
+	case r.Method == http.MethodPatch && id != "":
+		user, serr := service.PatchUser(id, body)
+		s.sendSCIMResult(w, http.StatusOK, user, serr)
+	case r.Method == http.MethodDelete && id != "":
+		s.sendSCIMResult(w, http.StatusNoContent, nil, service.DeleteUser(id))
+	default:
+		s.sendSCIMError(w, &scim.Error{Status: http.StatusMethodNotAllowed, Detail: "method not allowed"})
+	}
+}
+
+// serveSCIMGroups dispatches a request for /Groups or /Groups/{id}
+func (s *Server) serveSCIMGroups(w http.ResponseWriter, r *http.Request, service *scim.Service, id string, body []byte) {
+	switch {
+	case r.Method == http.MethodGet && id == "":
+		filter, startIndex, count := scimListParams(r)
+		list, serr := service.ListGroups(filter, startIndex, count)
+		s.sendSCIMResult(w, http.StatusOK, list, serr)
+	case r.Method == http.MethodGet:
+		group, serr := service.GetGroup(id)
+		s.sendSCIMResult(w, http.StatusOK, group, serr)
+	case r.Method == http.MethodPost && id == "":
+		group, serr := service.CreateGroup(body)
+		s.sendSCIMResult(w, http.StatusCreated, group, serr)
+	case r.Method == http.MethodPut && id != "":
+		group, serr := service.ReplaceGroup(id, body)
+		s.sendSCIMResult(w, http.StatusOK, group, serr)
+	case r.Method == http.MethodPatch && id != "":
+		group, serr := service.PatchGroup(id, body)
+		s.sendSCIMResult(w, http.StatusOK, group, serr)
+	case r.Method == http.MethodDelete && id != "":
+		s.sendSCIMResult(w, http.StatusNoContent, nil, service.DeleteGroup(id))
+	default:
+		s.sendSCIMError(w, &scim.Error{Status: http.StatusMethodNotAllowed, Detail: "method not allowed"})
+	}
+}
+
+// scimMaxResults is the largest page returned by a list request
+const scimMaxResults = 1000
+
+// scimListParams reads the filter and pagination of a list request
+func scimListParams(r *http.Request) (filter string, startIndex, count int) {
+	query := r.URL.Query()
+	startIndex, _ = strconv.Atoi(query.Get("startIndex"))
+	count = scimMaxResults
+	if n, err := strconv.Atoi(query.Get("count")); err == nil && n >= 0 && n < scimMaxResults {
+		count = n
+	}
+	return query.Get("filter"), startIndex, count
+}
+
+// sendSCIMResult sends a resource, or the error if there is one
+func (s *Server) sendSCIMResult(w http.ResponseWriter, status int, data interface{}, serr *scim.Error) {
+	switch {
+	case serr != nil:
+		s.sendSCIMError(w, serr)
+	case status == http.StatusNoContent:
+		w.WriteHeader(status)
+	default:
+		s.sendSCIM(w, status, data)
+	}
+}
+
+// sendSCIM sends a SCIM JSON response
+func (s *Server) sendSCIM(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/scim+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
+
+// sendSCIMError sends a SCIM error response
+func (s *Server) sendSCIMError(w http.ResponseWriter, serr *scim.Error) {
+	s.sendSCIM(w, serr.Status, serr.Body())
+}
+
+// scimServiceProviderConfig describes the supported SCIM features (RFC 7643 section 5)
+func scimServiceProviderConfig(baseURL string) map[string]interface{} {
+	supported := func(b bool) map[string]bool { return map[string]bool{"supported": b} }
+	return map[string]interface{}{
+		"schemas":          []string{scim.SchemaServiceConfig},
+		"documentationUri": "https://github.com/Frimurare/WulfVault/blob/main/docs/SCIM.md",
+		"patch":            supported(true),
+		"bulk":             map[string]interface{}{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":           map[string]interface{}{"supported": true, "maxResults": scimMaxResults},
+		"changePassword":   supported(false),
+		"sort":             supported(false),
+		"etag":             supported(false),
+		"authenticationSchemes": []map[string]interface{}{{
+			"type":        "oauthbearertoken",
+			"name":        "Bearer Token",
+			"description": "SCIM token generated under Admin > Single Sign-On",
+			"primary":     true,
+		}},
+		"meta": map[string]string{"resourceType": "ServiceProviderConfig", "location": baseURL + "/ServiceProviderConfig"},
+	}
+}
+
+// scimResourceTypes lists the resource types served
+func scimResourceTypes(baseURL string) map[string]interface{} {
+	resourceType := func(name, endpoint, schema string) map[string]interface{} {
+		return map[string]interface{}{
+			"schemas":  []string{scim.SchemaResourceType},
+			"id":       name,
+			"name":     name,
+			"endpoint": endpoint,
+			"schema":   schema,
+			"meta":     map[string]string{"resourceType": "ResourceType", "location": baseURL + "/ResourceTypes/" + name},
+		}
+	}
+	return map[string]interface{}{
+		"schemas":      []string{scim.SchemaListResponse},
+		"totalResults": 2,
+		"startIndex":   1,
+		"itemsPerPage": 2,
+		"Resources": []interface{}{
+			resourceType("User", "/Users", scim.SchemaUser),
+			resourceType("Group", "/Groups", scim.SchemaGroup),
+		},
+	}
+}
+
+// handleAdminSCIM saves the SCIM settings
+func (s *Server) handleAdminSCIM(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		s.renderAdminSSO(w, "Error: Invalid form data")
+		return
+	}
+
+	settings := scim.LoadSettings()
+	settings.Enabled = r.FormValue("scim_enabled") == "on"
+	settings.FilePolicy = r.FormValue("scim_deprovision_files")
+	settings.TransferTo = r.FormValue("scim_transfer_files_to")
+	if err := settings.Save(); err != nil {
+		s.renderAdminSSO(w, "Error: SCIM settings not saved: "+err.Error())
+		return
+	}
+
+	user, _ := userFromContext(r.Context())
+	database.DB.LogAction(&database.AuditLogEntry{
+		UserID:     int64(user.Id),
+		UserEmail:  user.Email,
+		Action:     database.ActionSettingsUpdated,
+		EntityType: database.EntitySettings,
+		EntityID:   "scim",
+		Details: database.CreateAuditDetails(map[string]interface{}{
+			"scim_enabled":           settings.Enabled,
+			"scim_deprovision_files": settings.FilePolicy,
+			"scim_transfer_files_to": settings.TransferTo,
+		}),
+		IPAddress: getClientIP(r),
+		UserAgent: r.UserAgent(),
+		Success:   true,
+	})
+
+	s.renderAdminSSO(w, "SCIM settings saved")
+}
+
+// handleAdminSCIMToken generates a new SCIM bearer token, replacing the previous one
+func (s *Server) handleAdminSCIMToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, _ := userFromContext(r.Context())
+	token, err := scim.GenerateToken(user.Id)
+	if err != nil {
+		log.Printf("Error generating SCIM token: %v", err)
+		s.renderAdminSSO(w, "Error: Failed to generate SCIM token")
+		return
+	}
+
+	database.DB.LogAction(&database.AuditLogEntry{
+		UserID:     int64(user.Id),
+		UserEmail:  user.Email,
+		Action:     database.ActionSettingsUpdated,
+		EntityType: database.EntitySettings,
+		EntityID:   "scim",
+		Details: database.CreateAuditDetails(map[string]interface{}{
+			"scim_token": "generated",
+		}),
+		IPAddress: getClientIP(r),
+		UserAgent: r.UserAgent(),
+		Success:   true,
+	})
+
+	s.renderAdminSSO(w, "SCIM token generated. Copy it now, it will not be shown again: "+token)
+}
+
+// getSCIMSettingsHTML renders the SCIM card on the single sign-on page
+func (s *Server) getSCIMSettingsHTML() string {
+	settings := scim.LoadSettings()
+	esc := template.HTMLEscapeString
+	checked := ""
+	if settings.Enabled {
+		checked = "checked"
+	}
+	selected := func(policy string) string {
+		if settings.FilePolicy == policy {
+			return "selected"
+		}
+		return ""
+	}
+
+	tokenHelp := "No token has been generated yet."
+	if settings.TokenHash != "" {
+		tokenHelp = "A token is stored. Generating a new one revokes it."
+		if owner, err := database.DB.GetUserByID(settings.TokenOwner); err == nil {
+			tokenHelp = "A token generated by " + esc(owner.Email) + " is stored. Generating a new one revokes it."
+		}
+	}
+
+	return `
+        <div class="card">
+            <h2>🔄 SCIM Provisioning</h2>
+
+            <div class="info-box">
+                Identity providers such as Entra ID and Okta can create, update and deactivate users and teams over SCIM 2.0.<br>
+                SCIM base URL: <code>` + esc(s.scimBaseURL()) + `</code><br>
+                Users are matched by email and sign in through SSO. Groups map to teams; members added over SCIM get the member role.
+                The super admin can never be changed over SCIM.
+            </div>
+
+            <form method="POST" action="/admin/sso/scim">
+                <div class="form-group">
+                    <label class="checkbox-label">
+                        <input type="checkbox" name="scim_enabled" ` + checked + `>
+                        <span>Enable SCIM provisioning</span>
+                    </label>
+                </div>
+
+                <div class="form-group">
+                    <label for="scim_deprovision_files">Files of Deprovisioned Users</label>
+                    <select id="scim_deprovision_files" name="scim_deprovision_files">
+                        <option value="hold" ` + selected(scim.FilesHold) + `>Hold with the deleted user</option>
+                        <option value="transfer" ` + selected(scim.FilesTransfer) + `>Transfer to another user</option>
+                    </select>
+                    <p class="help-text">Deprovisioned users are deleted and anonymized. Held files stay available to admins under All Files.</p>
+                </div>
+
+                <div class="form-group">
+                    <label for="scim_transfer_files_to">Transfer Files To</label>
+                    <input type="email" id="scim_transfer_files_to" name="scim_transfer_files_to" value="` + esc(settings.TransferTo) + `" placeholder="records@example.com">
+                    <p class="help-text">Email of an active user. If this user is gone, files are held instead.</p>
+                </div>
+
+                <button type="submit" class="btn btn-primary">Save SCIM Settings</button>
+            </form>
+
+            <form method="POST" action="/admin/sso/scim/token" style="margin-top: 15px;" onsubmit="return confirm('Generate a new SCIM token? The identity provider must be updated with it.');">
+                <p class="help-text" style="margin-bottom: 10px;">` + tokenHelp + `</p>
+                <button type="submit" class="btn btn-primary">Generate Token</button>
+            </form>
+        </div>`
+}
@@ -0,0 +1,188 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Frimurare/WulfVault/internal/auth"
+	"github.com/Frimurare/WulfVault/internal/database"
+	"github.com/Frimurare/WulfVault/internal/loginalerts"
+	"github.com/Frimurare/WulfVault/internal/models"
+)
+
+// securityActivityPageSize is how many events the security activity list loads at a time
+const securityActivityPageSize = 25
+
+// securityActivityLabels names the audit log actions shown to users as their
+// security activity
+var securityActivityLabels = map[string]string{
+	database.ActionLoginSuccess:           "Signed in",
+	database.ActionLoginFailed:            "Failed sign-in",
+	database.ActionLoginLocked:            "Sign-in locked",
+	database.ActionNewDeviceLogin:         "Sign-in from a new device",
+	database.ActionLogout:                 "Signed out",
+	database.ActionSessionRevoked:         "Session signed out",
+	database.ActionPasswordChanged:        "Password changed",
+	database.ActionPasswordResetRequested: "Password reset requested",
+	database.ActionPasswordResetCompleted: "Password reset",
+	database.Action2FAEnabled:             "Two-factor authentication enabled",
+	database.Action2FADisabled:            "Two-factor authentication disabled",
+	database.ActionPasskeyRegistered:      "Passkey added",
+	database.ActionPasskeyRemoved:         "Passkey removed",
+	database.ActionSudoGranted:            "Identity confirmed",
+	database.ActionSudoFailed:             "Identity confirmation failed",
+	database.ActionAPIKeyCreated:          "API key created",
+	database.ActionAPIKeyRevoked:          "API key revoked",
+	database.ActionAPIKeyUsed:             "API key used",
+}
+
+// securityActivityFilter returns the audit log filter for a user's own security activity
+func securityActivityFilter(user *models.User) *database.AuditLogFilter {
+	actions := make([]string, 0, len(securityActivityLabels))
+	for action := range securityActivityLabels {
+		actions = append(actions, action)
+	}
+	return &database.AuditLogFilter{
+		UserID:       int64(user.Id),
+		AccountEmail: user.Email,
+		Actions:      actions,
+	}
+}
+
+// securityActivityDetail picks the detail of an event worth showing, such as the
+// sign-in method or the name of an API key
+func securityActivityDetail(entry *database.AuditLogEntry) string {
+	var details map[string]interface{}
+	if err := json.Unmarshal([]byte(entry.Details), &details); err != nil {
+		return ""
+	}
+	if entry.Action == database.ActionNewDeviceLogin {
+		if country, _ := details["country"].(string); country != "" {
+			return "Country: " + country
+		}
+		return ""
+	}
+	for _, key := range []string{"method", "reason", "name", "attempt"} {
+		if value, ok := details[key].(string); ok && value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// handleSecurityActivity returns the current user's security activity from the audit log
+// GET /settings/security-activity?offset=<n>
+func (s *Server) handleSecurityActivity(w http.ResponseWriter, r *http.Request) {
+	user, ok := userFromContext(r.Context())
+	if !ok {
+		s.sendError(w, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	if offset < 0 {
+		offset = 0
+	}
+
+	filter := securityActivityFilter(user)
+	total, err := database.DB.GetAuditLogCount(filter)
+	if err != nil {
+		log.Printf("Error counting security activity of user %d: %v", user.Id, err)
+		s.sendError(w, http.StatusInternalServerError, "Failed to fetch security activity")
+		return
+	}
+	filter.Limit = securityActivityPageSize
+	filter.Offset = offset
+	entries, err := database.DB.GetAuditLogs(filter)
+	if err != nil {
+		log.Printf("Error fetching security activity of user %d: %v", user.Id, err)
+		s.sendError(w, http.StatusInternalServerError, "Failed to fetch security activity")
+		return
+	}
+
+	events := make([]map[string]interface{}, 0, len(entries))
+	for _, entry := range entries {
+		event := map[string]interface{}{
+			"timestamp":  entry.Timestamp,
+			"action":     entry.Action,
+			"label":      securityActivityLabels[entry.Action],
+			"detail":     securityActivityDetail(entry),
+			"device":     auth.ParseDevice(entry.UserAgent),
+			"ip_address": entry.IPAddress,
+			"success":    entry.Success,
+		}
+		if entry.ImpersonatorEmail != "" {
+			event["impersonated_by"] = entry.ImpersonatorEmail
+		}
+		events = append(events, event)
+	}
+
+	s.sendJSON(w, http.StatusOK, map[string]interface{}{
+		"events": events,
+		"total":  total,
+		"more":   offset+len(events) < total,
+	})
+}
+
+// checkLoginDevice records the device of a successful sign-in. A sign-in from a
+// device or country the user hasn't signed in from before is audited and, when
+// login alerts are on, emailed to the user.
+func (s *Server) checkLoginDevice(r *http.Request, user *models.User) {
+	// Forwarding headers only count from a trusted proxy, or anyone signing in
+	// with stolen credentials could claim the user's usual address
+	ip := s.trustedClientIP(r)
+	policy := loginalerts.LoadPolicy()
+	login, err := policy.Check(user.Id, ip, r.UserAgent(), time.Now())
+	if err != nil {
+		log.Printf("Warning: failed to check sign-in device of user %d: %v", user.Id, err)
+		return
+	}
+	if !login.New() {
+		return
+	}
+
+	database.DB.LogAction(&database.AuditLogEntry{
+		UserID:     int64(user.Id),
+		UserEmail:  user.Email,
+		Action:     database.ActionNewDeviceLogin,
+		EntityType: database.EntitySession,
+		Details: database.CreateAuditDetails(map[string]interface{}{
+			"device":      login.Device,
+			"country":     login.Country,
+			"new_device":  login.NewDevice,
+			"new_country": login.NewCountry,
+			"alerted":     policy.Enabled,
+		}),
+		IPAddress: ip,
+		UserAgent: r.UserAgent(),
+		Success:   true,
+	})
+
+	if policy.Enabled {
+		go func() {
+			if err := loginalerts.Notify(user, login, time.Now()); err != nil {
+				log.Printf("Could not send sign-in alert to %s: %v", user.Email, err)
+			}
+		}()
+	}
+}
+
+// saveLoginAlertPolicy saves the sign-in alert settings from the settings form
+func saveLoginAlertPolicy(r *http.Request) {
+	policy := &loginalerts.Policy{
+		Enabled:   r.FormValue("login_alerts_enabled") == "on",
+		CountryDB: strings.TrimSpace(r.FormValue("login_alerts_country_db")),
+	}
+	if err := policy.Save(); err != nil {
+		log.Printf("Error saving sign-in alert settings: %v", err)
+	}
+}
@@ -0,0 +1,433 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package server
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Frimurare/WulfVault/internal/auth"
+	"github.com/Frimurare/WulfVault/internal/database"
+	"github.com/Frimurare/WulfVault/internal/models"
+	"github.com/Frimurare/WulfVault/internal/sessionpolicy"
+)
+
+// currentSessionID returns the ID of the session the request was made with
+func currentSessionID(r *http.Request) string {
+	cookie, err := r.Cookie("session")
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// setSessionCookie sets the session cookie so that it expires with the session.
+// A session that can't be read gets a cookie for the browser session only.
+func setSessionCookie(w http.ResponseWriter, sessionId string, sameSite http.SameSite) {
+	cookie := &http.Cookie{
+		Name:     "session",
+		Value:    sessionId,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: sameSite,
+	}
+	if sess, err := database.DB.GetSession(sessionId); err == nil {
+		cookie.Expires = time.Unix(sess.ValidUntil, 0)
+	}
+	http.SetCookie(w, cookie)
+}
+
+// downloadSessionExpiry returns when the cookie of a new download account session expires
+func downloadSessionExpiry() time.Time {
+	return time.Now().Add(sessionpolicy.LoadPolicy().Global().Lifetime)
+}
+
+// sessionRemembered reports whether a session was started with "Remember this device"
+func sessionRemembered(sessionId string) bool {
+	sess, err := database.DB.GetSession(sessionId)
+	return err == nil && sess.Remembered
+}
+
+// sessionLastSeen returns when a session was last used. Sessions from before
+// activity was tracked per session fall back to the user's last activity.
+func sessionLastSeen(sess *database.Session, user *models.User) int64 {
+	if sess.LastSeen == 0 {
+		return user.LastOnline
+	}
+	return sess.LastSeen
+}
+
+// sessionList describes a user's sessions for the browser. Session IDs are
+// secrets, so sessions are identified by their handle.
+func sessionList(sessions []*database.Session, currentID string) []map[string]interface{} {
+	list := make([]map[string]interface{}, 0, len(sessions))
+	for _, sess := range sessions {
+		entry := map[string]interface{}{
+			"id":          auth.SessionHandle(sess.Id),
+			"device":      sess.Device,
+			"ip_address":  sess.IPAddress,
+			"user_agent":  sess.UserAgent,
+			"created_at":  sess.CreatedAt,
+			"last_seen":   sess.LastSeen,
+			"valid_until": sess.ValidUntil,
+			"current":     sess.Id == currentID,
+			"remembered":  sess.Remembered,
+		}
+		// Sessions of a super admin viewing the app as the user are shown as theirs
+		if sess.ImpersonatorId != 0 {
+			entry["impersonated_by"] = "super admin"
+			if admin, err := database.DB.GetUserByID(sess.ImpersonatorId); err == nil {
+				entry["impersonated_by"] = admin.Email
+			}
+		}
+		list = append(list, entry)
+	}
+	return list
+}
+
+// findSession returns the session of a user with the given handle
+func findSession(userId int, handle string) (*database.Session, error) {
+	sessions, err := database.DB.GetSessionsByUser(userId)
+	if err != nil {
+		return nil, err
+	}
+	for _, sess := range sessions {
+		if auth.SessionHandle(sess.Id) == handle {
+			return sess, nil
+		}
+	}
+	return nil, nil
+}
+
+// logSessionRevoked audits revoked sessions of a user. The actor is the user
+// themselves or an admin.
+func logSessionRevoked(r *http.Request, actor, user *models.User, details map[string]interface{}) {
+	details["email"] = user.Email
+	database.DB.LogAction(&database.AuditLogEntry{
+		UserID:     int64(actor.Id),
+		UserEmail:  actor.Email,
+		Action:     database.ActionSessionRevoked,
+		EntityType: database.EntityUser,
+		EntityID:   strconv.Itoa(user.Id),
+		Details:    database.CreateAuditDetails(details),
+		IPAddress:  getClientIP(r),
+		UserAgent:  r.UserAgent(),
+		Success:    true,
+	})
+}
+
+// revokeSessionsAfterCredentialChange signs a user out after their password or
+// second factor changed. A user changing their own credentials keeps the
+// session they made the change from.
+func revokeSessionsAfterCredentialChange(r *http.Request, actor, user *models.User, reason string) {
+	var removed int64
+	var err error
+	if actor.Id == user.Id {
+		removed, err = database.DB.DeleteOtherSessions(user.Id, currentSessionID(r))
+	} else {
+		removed, err = database.DB.DeleteSessionsByUser(user.Id)
+	}
+	if err != nil {
+		log.Printf("Failed to revoke sessions of user %d after %s: %v", user.Id, reason, err)
+		return
+	}
+	if removed > 0 {
+		logSessionRevoked(r, actor, user, map[string]interface{}{
+			"revoked": removed,
+			"reason":  reason,
+		})
+	}
+}
+
+// handleSessionsList returns the current user's sessions
+// GET /settings/sessions
+func (s *Server) handleSessionsList(w http.ResponseWriter, r *http.Request) {
+	user, ok := userFromContext(r.Context())
+	if !ok {
+		s.sendError(w, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+
+	sessions, err := database.DB.GetSessionsByUser(user.Id)
+	if err != nil {
+		log.Printf("Error fetching sessions for user %d: %v", user.Id, err)
+		s.sendError(w, http.StatusInternalServerError, "Failed to fetch sessions")
+		return
+	}
+
+	s.sendJSON(w, http.StatusOK, map[string]interface{}{
+		"sessions": sessionList(sessions, currentSessionID(r)),
+	})
+}
+
+// handleSessionRevoke signs out one of the current user's sessions
+// POST /settings/sessions/revoke
+func (s *Server) handleSessionRevoke(w http.ResponseWriter, r *http.Request) {
+	user, ok := userFromContext(r.Context())
+	if !ok {
+		s.sendError(w, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+	if r.Method != http.MethodPost {
+		s.sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	sess, err := findSession(user.Id, r.FormValue("id"))
+	if err != nil {
+		s.sendError(w, http.StatusInternalServerError, "Failed to fetch sessions")
+		return
+	}
+	if sess == nil {
+		s.sendError(w, http.StatusNotFound, "Session not found")
+		return
+	}
+	if sess.Id == currentSessionID(r) {
+		s.sendError(w, http.StatusBadRequest, "Use Logout to end the current session")
+		return
+	}
+
+	if err := database.DB.DeleteUserSession(user.Id, sess.Id); err != nil {
+		s.sendError(w, http.StatusInternalServerError, "Failed to revoke session")
+		return
+	}
+
+	logSessionRevoked(r, user, user, map[string]interface{}{
+		"session": auth.SessionHandle(sess.Id),
+		"device":  sess.Device,
+		"ip":      sess.IPAddress,
+	})
+
+	s.sendJSON(w, http.StatusOK, map[string]interface{}{"success": true})
+}
+
+// handleSessionsRevokeOthers signs out all sessions of the current user except this one
+// POST /settings/sessions/revoke-others
+func (s *Server) handleSessionsRevokeOthers(w http.ResponseWriter, r *http.Request) {
+	user, ok := userFromContext(r.Context())
+	if !ok {
+		s.sendError(w, http.StatusUnauthorized, "Not authenticated")
+		return
+	}
+	if r.Method != http.MethodPost {
+		s.sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	removed, err := database.DB.DeleteOtherSessions(user.Id, currentSessionID(r))
+	if err != nil {
+		s.sendError(w, http.StatusInternalServerError, "Failed to revoke sessions")
+		return
+	}
+
+	if removed > 0 {
+		logSessionRevoked(r, user, user, map[string]interface{}{
+			"revoked": removed,
+			"reason":  "sign_out_others",
+		})
+	}
+
+	s.sendJSON(w, http.StatusOK, map[string]interface{}{"success": true, "revoked": removed})
+}
+
+// adminSessionTarget returns the user whose sessions an admin wants to manage
+func (s *Server) adminSessionTarget(w http.ResponseWriter, r *http.Request) (*models.User, *models.User, bool) {
+	admin, _ := userFromContext(r.Context())
+	id, _ := strconv.Atoi(r.FormValue("user_id"))
+	user, err := database.DB.GetUserByID(id)
+	if err != nil {
+		s.sendError(w, http.StatusNotFound, "User not found")
+		return nil, nil, false
+	}
+	if user.IsSuperAdmin() && !admin.IsSuperAdmin() {
+		s.sendError(w, http.StatusForbidden, "Only the super admin can manage their own sessions")
+		return nil, nil, false
+	}
+	return admin, user, true
+}
+
+// handleAdminUserSessions lists the sessions of a user
+// GET /admin/users/sessions?user_id=<id>
+func (s *Server) handleAdminUserSessions(w http.ResponseWriter, r *http.Request) {
+	_, user, ok := s.adminSessionTarget(w, r)
+	if !ok {
+		return
+	}
+
+	sessions, err := database.DB.GetSessionsByUser(user.Id)
+	if err != nil {
+		log.Printf("Error fetching sessions for user %d: %v", user.Id, err)
+		s.sendError(w, http.StatusInternalServerError, "Failed to fetch sessions")
+		return
+	}
+
+	s.sendJSON(w, http.StatusOK, map[string]interface{}{
+		"user":     map[string]interface{}{"id": user.Id, "name": user.Name, "email": user.Email},
+		"sessions": sessionList(sessions, currentSessionID(r)),
+	})
+}
+
+// handleAdminSessionRevoke signs out one session of a user, or all of them when no session is given
+// POST /admin/users/sessions/revoke
+func (s *Server) handleAdminSessionRevoke(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	admin, user, ok := s.adminSessionTarget(w, r)
+	if !ok {
+		return
+	}
+
+	handle := r.FormValue("id")
+	if handle == "" {
+		removed, err := database.DB.DeleteSessionsByUser(user.Id)
+		if err != nil {
+			s.sendError(w, http.StatusInternalServerError, "Failed to revoke sessions")
+			return
+		}
+		logSessionRevoked(r, admin, user, map[string]interface{}{
+			"revoked": removed,
+			"reason":  "admin_revoke_all",
+		})
+		s.sendJSON(w, http.StatusOK, map[string]interface{}{"success": true, "revoked": removed})
+		return
+	}
+
+	sess, err := findSession(user.Id, handle)
+	if err != nil {
+		s.sendError(w, http.StatusInternalServerError, "Failed to fetch sessions")
+		return
+	}
+	if sess == nil {
+		s.sendError(w, http.StatusNotFound, "Session not found")
+		return
+	}
+
+	if err := database.DB.DeleteUserSession(user.Id, sess.Id); err != nil {
+		s.sendError(w, http.StatusInternalServerError, "Failed to revoke session")
+		return
+	}
+
+	logSessionRevoked(r, admin, user, map[string]interface{}{
+		"session": auth.SessionHandle(sess.Id),
+		"device":  sess.Device,
+		"ip":      sess.IPAddress,
+		"reason":  "admin_revoke",
+	})
+
+	s.sendJSON(w, http.StatusOK, map[string]interface{}{"success": true, "revoked": 1})
+}
+
+// saveSessionPolicy saves the global session limits and the overrides of each
+// role from the settings form. Changed roles are audited like other role changes.
+// Limits apply to sessions created afterwards, idle timeouts right away.
+func saveSessionPolicy(r *http.Request, actor *models.User) {
+	policy := sessionpolicy.LoadPolicy()
+	if n, err := strconv.Atoi(r.FormValue("session_lifetime_hours")); err == nil {
+		policy.LifetimeHours = n
+	}
+	if n, err := strconv.Atoi(r.FormValue("session_idle_minutes")); err == nil {
+		policy.IdleMinutes = n
+	}
+	if n, err := strconv.Atoi(r.FormValue("session_remember_days")); err == nil {
+		policy.RememberDays = n
+	}
+	if err := policy.Save(); err != nil {
+		log.Printf("Error saving session policy: %v", err)
+	}
+
+	roles, err := database.DB.GetAllRoles()
+	if err != nil {
+		log.Printf("Error loading roles: %v", err)
+		return
+	}
+	for _, role := range roles {
+		lifetime := roleSessionLimit(r, "session_role_lifetime_", role.Id, sessionpolicy.MaxLifetimeHours)
+		idle := roleSessionLimit(r, "session_role_idle_", role.Id, sessionpolicy.MaxIdleMinutes)
+		if lifetime == role.SessionLifetimeHours && idle == role.SessionIdleMinutes {
+			continue
+		}
+		if err := database.DB.SetRoleSessionLimits(role.Id, lifetime, idle); err != nil {
+			log.Printf("Error saving session limits of role %s: %v", role.Name, err)
+			continue
+		}
+		database.DB.LogAction(&database.AuditLogEntry{
+			UserID:     int64(actor.Id),
+			UserEmail:  actor.Email,
+			Action:     database.ActionRoleUpdated,
+			EntityType: database.EntityRole,
+			EntityID:   strconv.Itoa(role.Id),
+			Details: database.CreateAuditDetails(map[string]interface{}{
+				"name":                   role.Name,
+				"session_lifetime_hours": lifetime,
+				"session_idle_minutes":   idle,
+			}),
+			IPAddress: getClientIP(r),
+			UserAgent: r.UserAgent(),
+			Success:   true,
+		})
+	}
+}
+
+// roleSessionLimit reads a session limit override of a role from the settings
+// form. Empty and invalid values mean the global setting (0).
+func roleSessionLimit(r *http.Request, prefix string, roleId, max int) int {
+	n, err := strconv.Atoi(strings.TrimSpace(r.FormValue(prefix + strconv.Itoa(roleId))))
+	if err != nil || n < 0 {
+		return 0
+	}
+	if n > max {
+		return max
+	}
+	return n
+}
+
+// sessionRoleLimitsHTML renders the session limit overrides of each role for the settings form
+func sessionRoleLimitsHTML() string {
+	roles, err := database.DB.GetAllRoles()
+	if err != nil {
+		log.Printf("Error loading roles: %v", err)
+		return ""
+	}
+
+	value := func(n int) string {
+		if n == 0 {
+			return ""
+		}
+		return strconv.Itoa(n)
+	}
+
+	var b strings.Builder
+	b.WriteString(`
+                    <table style="width: 100%; border-collapse: collapse; margin-top: 5px;">
+                        <thead>
+                            <tr style="text-align: left; color: #666; font-size: 13px;">
+                                <th style="padding: 6px 8px 6px 0;">Role</th>
+                                <th style="padding: 6px 8px;">Lifetime (hours)</th>
+                                <th style="padding: 6px 8px;">Idle timeout (minutes)</th>
+                            </tr>
+                        </thead>
+                        <tbody>`)
+	for _, role := range roles {
+		id := strconv.Itoa(role.Id)
+		b.WriteString(`
+                            <tr>
+                                <td style="padding: 6px 8px 6px 0;">` + template.HTMLEscapeString(role.Name) + `</td>
+                                <td style="padding: 6px 8px;"><input type="number" name="session_role_lifetime_` + id + `" value="` + value(role.SessionLifetimeHours) + `" min="0" max="` + strconv.Itoa(sessionpolicy.MaxLifetimeHours) + `" placeholder="Global"></td>
+                                <td style="padding: 6px 8px;"><input type="number" name="session_role_idle_` + id + `" value="` + value(role.SessionIdleMinutes) + `" min="0" max="` + strconv.Itoa(sessionpolicy.MaxIdleMinutes) + `" placeholder="Global"></td>
+                            </tr>`)
+	}
+	b.WriteString(`
+                        </tbody>
+                    </table>`)
+	return b.String()
+}
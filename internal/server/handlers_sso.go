@@ -0,0 +1,673 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Frimurare/WulfVault/internal/auth"
+	"github.com/Frimurare/WulfVault/internal/database"
+	"github.com/Frimurare/WulfVault/internal/models"
+	"github.com/Frimurare/WulfVault/internal/oidc"
+)
+
+// oidcRedirectURI returns the callback URL registered at the IdP
+func (s *Server) oidcRedirectURI() string {
+	return strings.TrimSuffix(s.getPublicURL(), "/") + "/auth/oidc/callback"
+}
+
+// defaultQuotaMB returns the storage quota for newly provisioned users
+func (s *Server) defaultQuotaMB() int64 {
+	if v, err := database.DB.GetConfigValue("default_quota_mb"); err == nil && v != "" {
+		if mb, err := strconv.ParseInt(v, 10, 64); err == nil && mb > 0 {
+			return mb
+		}
+	}
+	return s.config.DefaultQuotaMB
+}
+
+// localPasswordDisabled reports whether a user must sign in through SSO.
+// The super admin can always use the local password as a break-glass account.
+func localPasswordDisabled(user *models.User) bool {
+	if user.UserLevel == models.UserLevelSuperAdmin {
+		return false
+	}
+
+	settings := oidc.LoadSettings()
+	if !settings.Configured() || !settings.DisableLocalPasswords {
+		return false
+	}
+
+	source, _, err := database.DB.GetUserAuthSource(user.Id)
+	return err == nil && source == database.AuthSourceOIDC
+}
+
+// safeRedirect only allows local redirect targets after login
+func safeRedirect(target string) string {
+	if target == "" || !strings.HasPrefix(target, "/") || strings.HasPrefix(target, "//") || strings.HasPrefix(target, "/\\") {
+		return ""
+	}
+	return target
+}
+
+// oidcStateCookie binds an SSO login to the browser that started it. It holds a
+// hash of the login state, and the callback is refused unless it matches, so a
+// callback URL taken from someone else's login cannot sign a victim into that
+// account.
+const oidcStateCookie = "oidc_state"
+
+// setOIDCStateCookie remembers the state of a login started by this browser
+func (s *Server) setOIDCStateCookie(w http.ResponseWriter, r *http.Request, state string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    hashOIDCState(state),
+		Path:     "/auth/oidc/",
+		MaxAge:   int(oidc.AuthRequestTTL.Seconds()),
+		HttpOnly: true,
+		// Plain HTTP deployments would never get the cookie back if it were Secure
+		Secure: r.TLS != nil || strings.HasPrefix(strings.ToLower(s.config.ServerURL), "https://"),
+		// Lax so the cookie is sent on the redirect back from the IdP
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// clearOIDCStateCookie removes the state cookie once the callback is handled
+func clearOIDCStateCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    "",
+		Path:     "/auth/oidc/",
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+}
+
+// oidcStateMatches reports whether the callback state belongs to a login
+// started by this browser
+func oidcStateMatches(r *http.Request, state string) bool {
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || state == "" {
+		return false
+	}
+	return hmac.Equal([]byte(cookie.Value), []byte(hashOIDCState(state)))
+}
+
+// hashOIDCState returns the value stored in the state cookie
+func hashOIDCState(state string) string {
+	sum := sha256.Sum256([]byte(state))
+	return hex.EncodeToString(sum[:])
+}
+
+// getSSOButtonHTML returns the "Sign in with SSO" button for the login page
+func (s *Server) getSSOButtonHTML(r *http.Request) string {
+	settings := oidc.LoadSettings()
+	if !settings.Configured() {
+		return ""
+	}
+
+	href := "/auth/oidc/login"
+	if redirect := safeRedirect(r.URL.Query().Get("redirect")); redirect != "" {
+		href += "?redirect=" + url.QueryEscape(redirect)
+	}
+
+	return `
+        <div style="text-align: center; margin: 20px 0 10px; color: #999; font-size: 13px;">or</div>
+        <a href="` + template.HTMLEscapeString(href) + `" class="btn" style="display: block; text-align: center; text-decoration: none; background: white; color: ` + s.getPrimaryColor() + `; border: 2px solid ` + s.getPrimaryColor() + `;">` + template.HTMLEscapeString(settings.ButtonLabel) + `</a>`
+}
+
+// handleOIDCLogin starts an OIDC authorization code login
+// GET /auth/oidc/login?redirect=<path>
+func (s *Server) handleOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	settings := oidc.LoadSettings()
+	if !settings.Configured() {
+		s.renderLoginPage(w, r, "Single sign-on is not enabled")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+	defer cancel()
+
+	provider, err := oidc.Discover(ctx, settings.Issuer)
+	if err != nil {
+		log.Printf("OIDC discovery failed: %v", err)
+		s.renderLoginPage(w, r, "Single sign-on is currently unavailable")
+		return
+	}
+
+	authReq, err := oidc.NewAuthRequest(safeRedirect(r.URL.Query().Get("redirect")))
+	if err != nil {
+		s.renderLoginPage(w, r, "Failed to start single sign-on")
+		return
+	}
+
+	s.setOIDCStateCookie(w, r, authReq.State)
+	http.Redirect(w, r, oidc.AuthCodeURL(provider, settings, s.oidcRedirectURI(), authReq), http.StatusFound)
+}
+
+// handleOIDCCallback completes an OIDC login and creates a session
+// GET /auth/oidc/callback?code=...&state=...
+func (s *Server) handleOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	settings := oidc.LoadSettings()
+	if !settings.Configured() {
+		s.renderLoginPage(w, r, "Single sign-on is not enabled")
+		return
+	}
+
+	query := r.URL.Query()
+	stateMatches := oidcStateMatches(r, query.Get("state"))
+	clearOIDCStateCookie(w)
+
+	if idpErr := query.Get("error"); idpErr != "" {
+		log.Printf("OIDC login rejected by identity provider: %s %s", idpErr, query.Get("error_description"))
+		s.oidcLoginFailed(w, r, "", "idp_error: "+idpErr)
+		return
+	}
+
+	if !stateMatches {
+		s.oidcLoginFailed(w, r, "", "login state does not belong to this browser")
+		return
+	}
+
+	authReq, err := oidc.TakeAuthRequest(query.Get("state"))
+	if err != nil {
+		s.oidcLoginFailed(w, r, "", err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	provider, err := oidc.Discover(ctx, settings.Issuer)
+	if err != nil {
+		s.oidcLoginFailed(w, r, "", err.Error())
+		return
+	}
+
+	tokens, err := oidc.Exchange(ctx, provider, settings, s.oidcRedirectURI(), query.Get("code"), authReq.CodeVerifier)
+	if err != nil {
+		s.oidcLoginFailed(w, r, "", err.Error())
+		return
+	}
+
+	claims, err := oidc.VerifyIDToken(ctx, provider, settings, tokens.IDToken, authReq.Nonce)
+	if err != nil {
+		s.oidcLoginFailed(w, r, "", err.Error())
+		return
+	}
+
+	// Some IdPs only put profile claims in the userinfo response
+	if _, ok := claims[settings.EmailClaim]; !ok {
+		if info, err := oidc.Userinfo(ctx, provider, tokens.AccessToken); err == nil && info["sub"] == claims["sub"] {
+			for k, v := range info {
+				if _, exists := claims[k]; !exists {
+					claims[k] = v
+				}
+			}
+		}
+	}
+
+	identity, err := oidc.MapClaims(settings, claims)
+	if err != nil {
+		s.oidcLoginFailed(w, r, "", err.Error())
+		return
+	}
+
+	user, created, err := auth.ResolveExternalUser(identity, settings.AutoProvision, s.defaultQuotaMB())
+	if err != nil {
+		s.oidcLoginFailed(w, r, identity.Email, err.Error())
+		return
+	}
+
+	if created {
+		database.DB.LogAction(&database.AuditLogEntry{
+			UserID:     0,
+			UserEmail:  "system",
+			Action:     database.ActionUserCreated,
+			EntityType: database.EntityUser,
+			EntityID:   fmt.Sprintf("%d", user.Id),
+			Details: database.CreateAuditDetails(map[string]interface{}{
+				"email":       user.Email,
+				"name":        user.Name,
+				"user_level":  int(user.UserLevel),
+				"quota_mb":    user.StorageQuotaMB,
+				"provisioned": "oidc",
+			}),
+			IPAddress: getClientIP(r),
+			UserAgent: r.UserAgent(),
+			Success:   true,
+		})
+	}
+
+	// Second factors are enforced by the identity provider
+	sessionID, err := auth.CreateSession(user.Id, getClientIP(r), r.UserAgent())
+	if err != nil {
+		s.renderLoginPage(w, r, "Failed to create session")
+		return
+	}
+
+	database.DB.LogAction(&database.AuditLogEntry{
+		UserID:     int64(user.Id),
+		UserEmail:  user.Email,
+		Action:     database.ActionLoginSuccess,
+		EntityType: database.EntitySession,
+		EntityID:   sessionID,
+		Details: database.CreateAuditDetails(map[string]interface{}{
+			"email":   user.Email,
+			"success": true,
+			"method":  "oidc",
+			"subject": identity.Subject,
+		}),
+		IPAddress: getClientIP(r),
+		UserAgent: r.UserAgent(),
+		Success:   true,
+	})
+
+	s.checkLoginDevice(r, user)
+
+	// Lax so the cookie is sent on the redirect back from the IdP
+	setSessionCookie(w, sessionID, http.SameSiteLaxMode)
+
+	redirect := authReq.Redirect
+	if redirect == "" {
+		redirect = homePath(user)
+	}
+
+	http.Redirect(w, r, redirect, http.StatusSeeOther)
+}
+
+// oidcLoginFailed logs a failed SSO login and shows the login page
+func (s *Server) oidcLoginFailed(w http.ResponseWriter, r *http.Request, email, reason string) {
+	log.Printf("OIDC login failed for %q: %s", email, reason)
+
+	database.DB.LogAction(&database.AuditLogEntry{
+		UserID:     0,
+		UserEmail:  email,
+		Action:     database.ActionLoginFailed,
+		EntityType: database.EntitySession,
+		Details: database.CreateAuditDetails(map[string]interface{}{
+			"email":   email,
+			"success": false,
+			"method":  "oidc",
+			"reason":  reason,
+		}),
+		IPAddress: getClientIP(r),
+		UserAgent: r.UserAgent(),
+		Success:   false,
+		ErrorMsg:  reason,
+	})
+
+	message := "Single sign-on failed"
+	if reason == auth.ErrNoLocalAccount.Error() {
+		message = "No account exists for your identity. Contact an administrator."
+	}
+	s.renderLoginPage(w, r, message)
+}
+
+// handleAdminSSO shows and saves the single sign-on configuration
+func (s *Server) handleAdminSSO(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		s.renderAdminSSO(w, "")
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		s.renderAdminSSO(w, "Error: Invalid form data")
+		return
+	}
+
+	enabled := r.FormValue("oidc_enabled") == "on"
+	issuer := strings.TrimSuffix(strings.TrimSpace(r.FormValue("oidc_issuer")), "/")
+	clientID := strings.TrimSpace(r.FormValue("oidc_client_id"))
+
+	if issuer != "" {
+		if u, err := url.Parse(issuer); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			s.renderAdminSSO(w, "Error: Issuer must be an http(s) URL")
+			return
+		}
+	}
+	if enabled && (issuer == "" || clientID == "") {
+		s.renderAdminSSO(w, "Error: Issuer and client ID are required to enable single sign-on")
+		return
+	}
+
+	values := map[string]string{
+		"oidc_issuer":       issuer,
+		"oidc_client_id":    clientID,
+		"oidc_scopes":       strings.TrimSpace(r.FormValue("oidc_scopes")),
+		"oidc_email_claim":  strings.TrimSpace(r.FormValue("oidc_email_claim")),
+		"oidc_name_claim":   strings.TrimSpace(r.FormValue("oidc_name_claim")),
+		"oidc_groups_claim": strings.TrimSpace(r.FormValue("oidc_groups_claim")),
+		"oidc_admin_group":  strings.TrimSpace(r.FormValue("oidc_admin_group")),
+		"oidc_button_label": strings.TrimSpace(r.FormValue("oidc_button_label")),
+	}
+	for key, value := range values {
+		database.DB.SetConfigValue(key, value)
+	}
+
+	for _, key := range []string{"oidc_enabled", "oidc_auto_provision", "oidc_disable_local_passwords", "oidc_trust_emails"} {
+		if r.FormValue(key) == "on" {
+			database.DB.SetConfigValue(key, "true")
+		} else {
+			database.DB.SetConfigValue(key, "false")
+		}
+	}
+
+	// An empty secret field keeps the stored secret
+	if secret := r.FormValue("oidc_client_secret"); secret != "" || r.FormValue("oidc_clear_secret") == "on" {
+		if err := oidc.SaveClientSecret(secret); err != nil {
+			log.Printf("Error saving OIDC client secret: %v", err)
+			s.renderAdminSSO(w, "Error: Failed to save client secret")
+			return
+		}
+	}
+
+	user, _ := userFromContext(r.Context())
+	database.DB.LogAction(&database.AuditLogEntry{
+		UserID:     int64(user.Id),
+		UserEmail:  user.Email,
+		Action:     database.ActionSettingsUpdated,
+		EntityType: database.EntitySettings,
+		EntityID:   "sso",
+		Details: database.CreateAuditDetails(map[string]interface{}{
+			"oidc_enabled":                 enabled,
+			"oidc_issuer":                  issuer,
+			"oidc_client_id":               clientID,
+			"oidc_admin_group":             values["oidc_admin_group"],
+			"oidc_disable_local_passwords": r.FormValue("oidc_disable_local_passwords") == "on",
+			"oidc_trust_emails":            r.FormValue("oidc_trust_emails") == "on",
+		}),
+		IPAddress: getClientIP(r),
+		UserAgent: r.UserAgent(),
+		Success:   true,
+	})
+
+	// Verify the issuer right away so misconfiguration shows up here and not at login
+	if enabled {
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+		if _, err := oidc.Discover(ctx, issuer); err != nil {
+			s.renderAdminSSO(w, "Error: Settings saved, but discovery failed: "+err.Error())
+			return
+		}
+	}
+
+	s.renderAdminSSO(w, "Single sign-on settings saved")
+}
+
+// renderAdminSSO renders the single sign-on settings page
+func (s *Server) renderAdminSSO(w http.ResponseWriter, message string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	settings := oidc.LoadSettings()
+	checked := func(b bool) string {
+		if b {
+			return "checked"
+		}
+		return ""
+	}
+	esc := template.HTMLEscapeString
+
+	secretHelp := "No client secret stored. Leave empty for public clients (PKCE only)."
+	if settings.ClientSecret != "" {
+		secretHelp = "A client secret is stored. Leave empty to keep it."
+	}
+
+	html := `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <meta name="author" content="Ulf Holmström">
+    <title>Single Sign-On - ` + s.config.CompanyName + `</title>
+    ` + s.getFaviconHTML() + `
+    <link rel="stylesheet" href="/static/css/style.css">
+    <style>
+        * { margin: 0; padding: 0; box-sizing: border-box; }
+        body {
+            font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Roboto, sans-serif;
+            background: #f5f5f5;
+        }
+        .container {
+            max-width: 900px;
+            margin: 40px auto;
+            padding: 0 20px;
+        }
+        .card {
+            background: white;
+            border-radius: 12px;
+            padding: 30px;
+            box-shadow: 0 2px 8px rgba(0,0,0,0.1);
+            margin-bottom: 20px;
+        }
+        .card h2 {
+            color: #333;
+            margin-bottom: 20px;
+            font-size: 20px;
+        }
+        .card h3 {
+            color: #333;
+            margin: 30px 0 15px;
+            font-size: 16px;
+        }
+        .form-group {
+            margin-bottom: 20px;
+        }
+        label {
+            display: block;
+            margin-bottom: 8px;
+            color: #333;
+            font-weight: 500;
+            font-size: 14px;
+        }
+        input[type="text"], input[type="url"], input[type="password"], textarea {
+            width: 100%;
+            padding: 12px;
+            border: 2px solid #e0e0e0;
+            border-radius: 6px;
+            font-size: 14px;
+        }
+        input:focus {
+            outline: none;
+            border-color: ` + s.getPrimaryColor() + `;
+        }
+        .checkbox-label {
+            display: flex;
+            align-items: center;
+            cursor: pointer;
+        }
+        .checkbox-label input {
+            margin-right: 10px;
+            width: 20px;
+            height: 20px;
+        }
+        .help-text {
+            color: #666;
+            font-size: 12px;
+            margin-top: 4px;
+        }
+        .btn {
+            padding: 12px 24px;
+            border: none;
+            border-radius: 6px;
+            font-size: 14px;
+            font-weight: 600;
+            cursor: pointer;
+        }
+        .btn-primary {
+            background: ` + s.getPrimaryColor() + `;
+            color: white;
+        }
+        .success {
+            background: #d4edda;
+            border: 1px solid #c3e6cb;
+            color: #155724;
+            padding: 12px;
+            border-radius: 6px;
+            margin-bottom: 20px;
+        }
+        .error {
+            background: #f8d7da;
+            border: 1px solid #f5c6cb;
+            color: #721c24;
+            padding: 12px;
+            border-radius: 6px;
+            margin-bottom: 20px;
+        }
+        .info-box {
+            background: #e3f2fd;
+            border: 1px solid #90caf9;
+            color: #0d47a1;
+            padding: 15px;
+            border-radius: 8px;
+            margin-bottom: 20px;
+            font-size: 14px;
+        }
+        .info-box code {
+            word-break: break-all;
+        }
+    </style>
+</head>
+<body>
+    ` + s.getAdminHeaderHTML("") + `
+    <div class="container">`
+
+	if message != "" {
+		if strings.HasPrefix(message, "Error") {
+			html += `<div class="error">` + esc(message) + `</div>`
+		} else {
+			html += `<div class="success">` + esc(message) + `</div>`
+		}
+	}
+
+	html += `
+        <div class="card">
+            <h2>🔑 Single Sign-On (OpenID Connect)</h2>
+
+            <div class="info-box">
+                Register WulfVault at your identity provider as a web application using the authorization code flow with PKCE.<br>
+                Redirect URI: <code>` + esc(s.oidcRedirectURI()) + `</code>
+            </div>
+
+            <form method="POST" action="/admin/sso">
+                <div class="form-group">
+                    <label class="checkbox-label">
+                        <input type="checkbox" name="oidc_enabled" ` + checked(settings.Enabled) + `>
+                        <span>Enable single sign-on for staff accounts</span>
+                    </label>
+                </div>
+
+                <h3>Identity Provider</h3>
+
+                <div class="form-group">
+                    <label for="oidc_issuer">Issuer URL</label>
+                    <input type="url" id="oidc_issuer" name="oidc_issuer" value="` + esc(settings.Issuer) + `" placeholder="https://login.example.com/realms/staff">
+                    <p class="help-text">Endpoints are discovered from <code>/.well-known/openid-configuration</code> under this URL</p>
+                </div>
+
+                <div class="form-group">
+                    <label for="oidc_client_id">Client ID</label>
+                    <input type="text" id="oidc_client_id" name="oidc_client_id" value="` + esc(settings.ClientID) + `">
+                </div>
+
+                <div class="form-group">
+                    <label for="oidc_client_secret">Client Secret</label>
+                    <input type="password" id="oidc_client_secret" name="oidc_client_secret" autocomplete="new-password">
+                    <p class="help-text">` + secretHelp + `</p>
+                    <label class="checkbox-label" style="margin-top: 8px; font-weight: normal;">
+                        <input type="checkbox" name="oidc_clear_secret">
+                        <span>Remove stored client secret</span>
+                    </label>
+                </div>
+
+                <div class="form-group">
+                    <label for="oidc_scopes">Scopes</label>
+                    <input type="text" id="oidc_scopes" name="oidc_scopes" value="` + esc(settings.Scopes) + `">
+                    <p class="help-text">Space separated. Must include <code>openid</code>. Default: ` + oidc.DefaultScopes + `</p>
+                </div>
+
+                <div class="form-group">
+                    <label for="oidc_button_label">Login Button Label</label>
+                    <input type="text" id="oidc_button_label" name="oidc_button_label" value="` + esc(settings.ButtonLabel) + `">
+                </div>
+
+                <h3>Claim Mapping</h3>
+
+                <div class="form-group">
+                    <label for="oidc_email_claim">Email Claim</label>
+                    <input type="text" id="oidc_email_claim" name="oidc_email_claim" value="` + esc(settings.EmailClaim) + `">
+                    <p class="help-text">Existing accounts are linked by this email address on first SSO login</p>
+                </div>
+
+                <div class="form-group">
+                    <label for="oidc_name_claim">Name Claim</label>
+                    <input type="text" id="oidc_name_claim" name="oidc_name_claim" value="` + esc(settings.NameClaim) + `">
+                </div>
+
+                <div class="form-group">
+                    <label for="oidc_groups_claim">Groups Claim</label>
+                    <input type="text" id="oidc_groups_claim" name="oidc_groups_claim" value="` + esc(settings.GroupsClaim) + `">
+                    <p class="help-text">Use dots for nested claims, e.g. <code>realm_access.roles</code></p>
+                </div>
+
+                <div class="form-group">
+                    <label for="oidc_admin_group">Admin Group</label>
+                    <input type="text" id="oidc_admin_group" name="oidc_admin_group" value="` + esc(settings.AdminGroup) + `">
+                    <p class="help-text">Members of this group are made admins, everyone else becomes a regular user; synced on every login. Leave empty to manage roles in WulfVault.</p>
+                </div>
+
+                <h3>Accounts</h3>
+
+                <div class="form-group">
+                    <label class="checkbox-label">
+                        <input type="checkbox" name="oidc_auto_provision" ` + checked(settings.AutoProvision) + `>
+                        <span>Create accounts on first login</span>
+                    </label>
+                    <p class="help-text">New users get the default quota of ` + strconv.FormatInt(s.defaultQuotaMB(), 10) + ` MB</p>
+                </div>
+
+                <div class="form-group">
+                    <label class="checkbox-label">
+                        <input type="checkbox" name="oidc_disable_local_passwords" ` + checked(settings.DisableLocalPasswords) + `>
+                        <span>Disable local passwords for SSO users</span>
+                    </label>
+                    <p class="help-text">Users linked to the identity provider can only sign in through SSO. The super admin can always sign in with the local password as a break-glass account.</p>
+                </div>
+
+                <div class="form-group">
+                    <label class="checkbox-label">
+                        <input type="checkbox" name="oidc_trust_emails" ` + checked(settings.TrustEmails) + `>
+                        <span>Trust email addresses from the provider</span>
+                    </label>
+                    <p class="help-text">Existing accounts are only linked on first SSO login when the provider marks the email address as verified. Turn this on for providers that don't send <code>email_verified</code> but never let users choose their own address.</p>
+                </div>
+
+                <button type="submit" class="btn btn-primary">Save Settings</button>
+            </form>
+        </div>
+` + s.getLDAPSettingsHTML() + `
+` + s.getSCIMSettingsHTML() + `
+    </div>
+</body>
+</html>`
+
+	w.Write([]byte(html))
+}
@@ -0,0 +1,601 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Frimurare/WulfVault/internal/auth"
+	"github.com/Frimurare/WulfVault/internal/database"
+	"github.com/Frimurare/WulfVault/internal/models"
+	"github.com/Frimurare/WulfVault/internal/sudo"
+	"github.com/Frimurare/WulfVault/internal/totp"
+)
+
+// sudoRequiredHeader marks responses that ask the user to confirm their identity
+// first. The page header script sends the browser to /sudo when it sees it.
+const sudoRequiredHeader = "X-Sudo-Required"
+
+var errSudoWrongPassword = errors.New("invalid password")
+
+// requireSudo only lets a sensitive action through if the user authenticated
+// recently, by signing in or by confirming their identity at /sudo. It wraps a
+// handler behind requireAuth or requirePermission. Only changes are protected
+// unless methods lists the methods to protect.
+//
+// Requests made with an API key are not affected: creating a key is itself a
+// sensitive action, and a REST client cannot confirm an identity interactively.
+func (s *Server) requireSudo(action string, next http.HandlerFunc, methods ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !sudoMethod(r, methods) {
+			next(w, r)
+			return
+		}
+		policy := sudo.LoadPolicy()
+		if !policy.Requires(action) {
+			next(w, r)
+			return
+		}
+		if _, ok := apiKeyFromContext(r.Context()); ok {
+			next(w, r)
+			return
+		}
+		// A super admin viewing the app as a user can't confirm the user's identity
+		if _, ok := impersonationFromContext(r.Context()); ok {
+			s.sendError(w, http.StatusForbidden, "This action is not available while viewing as another user")
+			return
+		}
+
+		createdAt, sudoAt, err := database.DB.GetSessionAuthTimes(currentSessionID(r))
+		if err == nil && policy.Elevated(createdAt, sudoAt, time.Now()) {
+			next(w, r)
+			return
+		}
+
+		w.Header().Set(sudoRequiredHeader, "1")
+		target := "/sudo?redirect=" + url.QueryEscape(sudoReturnPath(r))
+		if r.Header.Get("Sec-Fetch-Mode") == "navigate" || strings.Contains(r.Header.Get("Accept"), "text/html") {
+			http.Redirect(w, r, target, http.StatusSeeOther)
+			return
+		}
+		s.sendJSON(w, http.StatusForbidden, map[string]interface{}{
+			"error":         "Confirm your identity to continue",
+			"sudo_required": true,
+			"sudo_url":      target,
+		})
+	}
+}
+
+// sudoMethod reports whether requireSudo applies to the request's method
+func sudoMethod(r *http.Request, methods []string) bool {
+	if len(methods) == 0 {
+		return r.Method != http.MethodGet && r.Method != http.MethodHead
+	}
+	for _, method := range methods {
+		if r.Method == method {
+			return true
+		}
+	}
+	return false
+}
+
+// sudoReturnPath returns the page the user made a sensitive request from, so
+// they can repeat it once they have confirmed their identity
+func sudoReturnPath(r *http.Request) string {
+	if referer, err := url.Parse(r.Referer()); err == nil && referer.Host == r.Host {
+		if path := safeRedirect(referer.RequestURI()); path != "" {
+			return path
+		}
+	}
+	if r.Method == http.MethodGet {
+		return r.URL.RequestURI()
+	}
+	return "/dashboard"
+}
+
+// sudoPasswordRequired reports whether a user confirms their identity with a
+// password. Users signing in through SSO have no password of their own.
+func sudoPasswordRequired(user *models.User) bool {
+	if user.UserLevel == models.UserLevelSuperAdmin {
+		return true
+	}
+	source, _, err := database.DB.GetUserAuthSource(user.Id)
+	return err != nil || source != database.AuthSourceOIDC
+}
+
+// checkSudoPassword verifies the password of the signed-in user against the
+// directory or the local password, as at login
+func (s *Server) checkSudoPassword(r *http.Request, user *models.User, password string) error {
+	if !sudoPasswordRequired(user) {
+		return nil
+	}
+	if password == "" {
+		return errSudoWrongPassword
+	}
+	result, handled, err := s.authenticateDirectory(user.Email, password, r)
+	if !handled {
+		_, err = auth.AuthenticateUser(user.Email, password)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if result.User == nil || result.User.Id != user.Id {
+		return errSudoWrongPassword
+	}
+	return nil
+}
+
+// logSudo audits a granted or refused elevation
+func logSudo(r *http.Request, user *models.User, method string, err error) {
+	details := map[string]interface{}{"method": method}
+	entry := &database.AuditLogEntry{
+		UserID:     int64(user.Id),
+		UserEmail:  user.Email,
+		Action:     database.ActionSudoGranted,
+		EntityType: database.EntitySession,
+		EntityID:   auth.SessionHandle(currentSessionID(r)),
+		IPAddress:  getClientIP(r),
+		UserAgent:  r.UserAgent(),
+		Success:    err == nil,
+	}
+	if err != nil {
+		entry.Action = database.ActionSudoFailed
+		entry.ErrorMsg = err.Error()
+	} else {
+		details["duration_minutes"] = sudo.LoadPolicy().DurationMinutes
+	}
+	entry.Details = database.CreateAuditDetails(details)
+	database.DB.LogAction(entry)
+}
+
+// grantSudo elevates the current session
+func grantSudo(r *http.Request, user *models.User, method string) error {
+	if err := database.DB.SetSessionSudo(currentSessionID(r)); err != nil {
+		return err
+	}
+	logSudo(r, user, method, nil)
+	return nil
+}
+
+// sudoLockKeys returns the lockout keys a confirmation counts against: the
+// password keys of the login form, and the second-factor key when a code is used
+func (s *Server) sudoLockKeys(r *http.Request, user *models.User, secondFactor bool) []string {
+	keys := []string{loginAccountKey(user.Email), s.ipLockKey(r)}
+	if secondFactor {
+		keys = append(keys, auth.TOTPLockKey(user.Id))
+	}
+	return keys
+}
+
+// clearSudoFailures forgets the failed attempts of a user who confirmed their
+// identity. Failures counted against their address stay, as at login.
+func clearSudoFailures(user *models.User) {
+	auth.ClearFailures(loginAccountKey(user.Email))
+	auth.ClearFailures(auth.TOTPLockKey(user.Id))
+}
+
+// handleSudo shows and checks the identity confirmation form
+// GET/POST /sudo?redirect=<path>
+func (s *Server) handleSudo(w http.ResponseWriter, r *http.Request) {
+	user, ok := userFromContext(r.Context())
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		s.renderSudoPage(w, r, user, "")
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	code := strings.TrimSpace(r.FormValue("code"))
+	useBackup := r.FormValue("use_backup") == "1"
+	passkeyOnly := passkeyRequired(user) && hasPasskeys(user.Id)
+
+	method := "password"
+	if user.TOTPEnabled {
+		method = "totp"
+		if useBackup {
+			method = "backup_code"
+		}
+	}
+
+	lockKeys := s.sudoLockKeys(r, user, user.TOTPEnabled)
+	if until := auth.LockedUntil(lockKeys...); !until.IsZero() {
+		logLockedAttempt(r, user.Email, "sudo", until)
+		s.renderSudoPage(w, r, user, auth.LockoutMessage(until))
+		return
+	}
+
+	if passkeyOnly || (!user.TOTPEnabled && hasPasskeys(user.Id)) {
+		s.renderSudoPage(w, r, user, "Use your passkey to confirm your identity")
+		return
+	}
+	if !user.TOTPEnabled && !sudoPasswordRequired(user) {
+		s.renderSudoPage(w, r, user, "Sign in again to confirm your identity")
+		return
+	}
+
+	if err := s.checkSudoPassword(r, user, r.FormValue("password")); err != nil {
+		logSudo(r, user, method, errSudoWrongPassword)
+		s.recordFailedAttempt(r, "password", user.Email, lockKeys[:2]...)
+		s.renderSudoPage(w, r, user, "Invalid password")
+		return
+	}
+
+	if user.TOTPEnabled {
+		var valid bool
+		if useBackup {
+			valid, _ = database.DB.ValidateBackupCode(user.Id, code)
+		} else {
+			valid = totp.ValidateCode(code, user.TOTPSecret)
+		}
+		if !valid {
+			logSudo(r, user, method, errors.New("invalid verification code"))
+			s.recordFailedAttempt(r, "totp", user.Email, lockKeys[1:]...)
+			s.renderSudoPage(w, r, user, "Invalid verification code")
+			return
+		}
+	}
+	clearSudoFailures(user)
+
+	if err := grantSudo(r, user, method); err != nil {
+		s.renderSudoPage(w, r, user, "Failed to confirm your identity")
+		return
+	}
+
+	redirect := safeRedirect(r.URL.Query().Get("redirect"))
+	if redirect == "" {
+		redirect = homePath(user)
+	}
+	http.Redirect(w, r, redirect, http.StatusSeeOther)
+}
+
+// handleSudoPasskeyBegin returns the options for confirming the identity with a passkey
+// POST /sudo/passkey/begin
+func (s *Server) handleSudoPasskeyBegin(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromContext(r.Context())
+	if r.Method != http.MethodPost {
+		s.sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	rp, err := s.relyingParty()
+	if err != nil {
+		s.sendError(w, http.StatusInternalServerError, "Passkeys are unavailable: "+err.Error())
+		return
+	}
+
+	options, ceremonyID, err := rp.BeginLogin(user)
+	if err != nil {
+		s.sendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	setPasskeyCeremony(w, ceremonyID)
+	s.sendJSON(w, http.StatusOK, options)
+}
+
+// handleSudoPasskeyFinish checks the password and passkey and elevates the session.
+// The body is {"password": "...", "credential": "<authenticator response>"}.
+// POST /sudo/passkey/finish
+func (s *Server) handleSudoPasskeyFinish(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromContext(r.Context())
+	if r.Method != http.MethodPost {
+		s.sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req struct {
+		Password   string `json:"password"`
+		Credential string `json:"credential"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxPasskeyResponseSize)).Decode(&req); err != nil {
+		s.sendError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	lockKeys := s.sudoLockKeys(r, user, true)
+	if until := auth.LockedUntil(lockKeys...); !until.IsZero() {
+		logLockedAttempt(r, user.Email, "sudo", until)
+		s.sendError(w, http.StatusTooManyRequests, auth.LockoutMessage(until))
+		return
+	}
+
+	if err := s.checkSudoPassword(r, user, req.Password); err != nil {
+		logSudo(r, user, "passkey", errSudoWrongPassword)
+		s.recordFailedAttempt(r, "password", user.Email, lockKeys[:2]...)
+		s.sendError(w, http.StatusUnauthorized, "Invalid password")
+		return
+	}
+
+	rp, err := s.relyingParty()
+	if err != nil {
+		s.sendError(w, http.StatusInternalServerError, "Passkeys are unavailable: "+err.Error())
+		return
+	}
+	if _, err := rp.FinishLogin(user, takePasskeyCeremony(w, r), strings.NewReader(req.Credential)); err != nil {
+		logSudo(r, user, "passkey", err)
+		s.recordFailedAttempt(r, "totp", user.Email, lockKeys[1:]...)
+		s.sendError(w, http.StatusUnauthorized, "Passkey verification failed")
+		return
+	}
+	clearSudoFailures(user)
+
+	if err := grantSudo(r, user, "passkey"); err != nil {
+		s.sendError(w, http.StatusInternalServerError, "Failed to confirm your identity")
+		return
+	}
+
+	redirect := safeRedirect(r.URL.Query().Get("redirect"))
+	if redirect == "" {
+		redirect = homePath(user)
+	}
+	s.sendJSON(w, http.StatusOK, map[string]interface{}{"success": true, "redirect": redirect})
+}
+
+// renderSudoPage renders the identity confirmation form
+func (s *Server) renderSudoPage(w http.ResponseWriter, r *http.Request, user *models.User, errorMsg string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	redirect := safeRedirect(r.URL.Query().Get("redirect"))
+	query := ""
+	if redirect != "" {
+		query = "?redirect=" + url.QueryEscape(redirect)
+	}
+	minutes := sudo.LoadPolicy().DurationMinutes
+
+	// Offer the factors the user has; a required passkey rules out codes
+	showPassword := sudoPasswordRequired(user)
+	showPasskey := hasPasskeys(user.Id)
+	showTOTP := user.TOTPEnabled && !(showPasskey && passkeyRequired(user))
+
+	html := `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <meta name="author" content="Ulf Holmström">
+    <title>Confirm Your Identity - ` + s.config.CompanyName + `</title>
+    ` + s.getFaviconHTML() + `
+    <style>
+        * { margin: 0; padding: 0; box-sizing: border-box; }
+        body {
+            font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Roboto, sans-serif;
+            background: linear-gradient(135deg, ` + s.getPrimaryColor() + ` 0%, ` + s.getSecondaryColor() + ` 100%);
+            min-height: 100vh;
+            display: flex;
+            align-items: center;
+            justify-content: center;
+            padding: 20px;
+        }
+        .verify-container {
+            background: white;
+            border-radius: 12px;
+            box-shadow: 0 20px 60px rgba(0,0,0,0.3);
+            padding: 40px;
+            max-width: 420px;
+            width: 100%;
+        }
+        .logo {
+            text-align: center;
+            margin-bottom: 24px;
+        }
+        .logo h1 {
+            color: ` + s.getPrimaryColor() + `;
+            font-size: 28px;
+            margin-bottom: 8px;
+        }
+        .logo p {
+            color: #666;
+            font-size: 14px;
+        }
+        .form-group {
+            margin-bottom: 20px;
+        }
+        label {
+            display: block;
+            margin-bottom: 8px;
+            color: #333;
+            font-weight: 500;
+        }
+        input[type="text"], input[type="password"] {
+            width: 100%;
+            padding: 12px;
+            border: 2px solid #e0e0e0;
+            border-radius: 6px;
+            font-size: 16px;
+        }
+        input:focus {
+            outline: none;
+            border-color: ` + s.getPrimaryColor() + `;
+        }
+        .btn {
+            display: block;
+            width: 100%;
+            padding: 14px;
+            background: ` + s.getPrimaryColor() + `;
+            color: white;
+            border: none;
+            border-radius: 6px;
+            font-size: 16px;
+            font-weight: 600;
+            cursor: pointer;
+            text-align: center;
+            text-decoration: none;
+        }
+        .btn:hover {
+            opacity: 0.9;
+        }
+        .error {
+            background: #fee;
+            border: 1px solid #fcc;
+            color: #c33;
+            padding: 12px;
+            border-radius: 6px;
+            margin-bottom: 20px;
+            font-size: 14px;
+        }
+        .help-text {
+            text-align: center;
+            margin-top: 15px;
+            color: #666;
+            font-size: 13px;
+        }
+        .help-text a {
+            color: ` + s.getPrimaryColor() + `;
+        }
+    </style>
+</head>
+<body>
+    <div class="verify-container">
+        <div class="logo">
+            <h1>` + template.HTMLEscapeString(s.config.CompanyName) + `</h1>
+            <p>Confirm your identity to continue</p>
+        </div>
+        <p style="color: #555; font-size: 14px; margin-bottom: 20px;">You are about to make a sensitive change. ` +
+		fmt.Sprintf("Once you have confirmed your identity you won't be asked again for %d minutes.", minutes) + `</p>`
+
+	if errorMsg != "" {
+		html += `<div class="error">` + template.HTMLEscapeString(errorMsg) + `</div>`
+	}
+
+	switch {
+	case showPasskey:
+		html += `
+        <form onsubmit="confirmWithPasskey(event)">`
+		if showPassword {
+			html += `
+            <div class="form-group">
+                <label for="passkey-password">Password</label>
+                <input type="password" id="passkey-password" required autofocus autocomplete="current-password">
+            </div>`
+		}
+		html += `
+            <button type="submit" class="btn" id="passkey-btn">🔑 Confirm with your passkey</button>
+        </form>
+        <script>` + passkeyScript() + `
+
+        async function confirmWithPasskey(event) {
+            event.preventDefault();
+            const button = document.getElementById('passkey-btn');
+            const password = document.getElementById('passkey-password');
+            button.disabled = true;
+            try {
+                const options = await passkeyRequest('/sudo/passkey/begin');
+                const credential = await passkeyGet(options);
+                const result = await passkeyRequest('/sudo/passkey/finish` + query + `', JSON.stringify({
+                    password: password ? password.value : '',
+                    credential: credential
+                }));
+                window.location.href = result.redirect;
+            } catch (error) {
+                button.disabled = false;
+                if (error.name !== 'NotAllowedError') alert(error.message);
+            }
+        }
+        </script>`
+		if showTOTP {
+			html += `
+        <div class="help-text" style="margin: 20px 0;">or</div>`
+		}
+	case !showPassword && !showTOTP:
+		html += `
+        <a class="btn" href="/auth/oidc/login` + query + `">Sign in again with single sign-on</a>`
+	}
+
+	if showTOTP || (showPassword && !showPasskey) {
+		html += `
+        <form method="POST" action="/sudo` + query + `">`
+		if showPassword {
+			html += `
+            <div class="form-group">
+                <label for="password">Password</label>
+                <input type="password" id="password" name="password" required autocomplete="current-password">
+            </div>`
+		}
+		if showTOTP {
+			html += `
+            <div class="form-group">
+                <label for="code">Code from your authenticator app or a backup code</label>
+                <input type="text" id="code" name="code" maxlength="16" required autocomplete="one-time-code">
+            </div>
+            <div class="form-group">
+                <label style="font-weight: normal;"><input type="checkbox" name="use_backup" value="1"> This is a backup code</label>
+            </div>`
+		}
+		html += `
+            <button type="submit" class="btn">Confirm</button>
+        </form>`
+	}
+
+	back := redirect
+	if back == "" {
+		back = homePath(user)
+	}
+	html += `
+        <div class="help-text"><a href="` + template.HTMLEscapeString(back) + `">Cancel</a></div>
+    </div>
+</body>
+</html>`
+
+	w.Write([]byte(html))
+}
+
+// saveSudoPolicy stores the re-authentication settings from the settings form
+func saveSudoPolicy(r *http.Request) {
+	policy := sudo.LoadPolicy()
+	policy.Actions = map[string]bool{}
+	for _, key := range r.Form["sudo_actions"] {
+		policy.Actions[key] = true
+	}
+	if n, err := strconv.Atoi(r.FormValue("sudo_duration_minutes")); err == nil {
+		policy.DurationMinutes = n
+	}
+	if err := policy.Save(); err != nil {
+		log.Printf("Error saving re-authentication policy: %v", err)
+	}
+}
+
+// sudoActionCheckboxesHTML renders a checkbox per sensitive action for the settings form
+func sudoActionCheckboxesHTML(policy *sudo.Policy) string {
+	var b strings.Builder
+	for i, action := range sudo.Actions {
+		checked := ""
+		if policy.Requires(action.Key) {
+			checked = " checked"
+		}
+		margin := ""
+		if i > 0 {
+			margin = " margin-top: 10px;"
+		}
+		description := ""
+		if action.Description != "" {
+			description = ` <span style="color: #888; font-size: 13px; margin-left: 6px;">` + template.HTMLEscapeString(action.Description) + `</span>`
+		}
+		b.WriteString(`
+                    <label style="display: flex; align-items: center; cursor: pointer;` + margin + `">
+                        <input type="checkbox" name="sudo_actions" value="` + action.Key + `"` + checked + ` style="margin-right: 10px; width: 20px; height: 20px; cursor: pointer;">
+                        <span>` + template.HTMLEscapeString(action.Label) + description + `</span>
+                    </label>`)
+	}
+	return b.String()
+}
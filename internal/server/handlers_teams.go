@@ -230,8 +230,8 @@ func (s *Server) handleAPITeamMembers(w http.ResponseWriter, r *http.Request) {
 
 	user, _ := userFromContext(r.Context())
 
-	// Check if user is admin or team member
-	if !user.IsAdmin() {
+	// Check if user manages teams or is a team member
+	if !hasPermission(user, models.RolePermManageTeams) {
 		isMember, err := database.DB.IsTeamMember(teamId, user.Id)
 		if err != nil || !isMember {
 			http.Error(w, "Access denied", http.StatusForbidden)
@@ -273,9 +273,9 @@ func (s *Server) handleAPITeamAddMember(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Check permission: admin OR team owner/admin
+	// Check permission: team manager OR team owner/admin
 	canManage := false
-	if user.IsAdmin() {
+	if hasPermission(user, models.RolePermManageTeams) {
 		canManage = true
 	} else {
 		member, err := database.DB.GetTeamMember(req.TeamId, user.Id)
@@ -369,9 +369,9 @@ func (s *Server) handleAPITeamRemoveMember(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	// Check permission: admin OR team owner/admin
+	// Check permission: team manager OR team owner/admin
 	canManage := false
-	if user.IsAdmin() {
+	if hasPermission(user, models.RolePermManageTeams) {
 		canManage = true
 	} else {
 		member, err := database.DB.GetTeamMember(req.TeamId, user.Id)
@@ -451,7 +451,7 @@ func (s *Server) handleAPIShareFileToTeam(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	if file.UserId != user.Id && !user.HasPermissionEditOtherUploads() {
+	if file.UserId != user.Id && !hasPermission(user, models.RolePermManageAllFiles) {
 		http.Error(w, "You don't own this file", http.StatusForbidden)
 		return
 	}
@@ -488,8 +488,8 @@ func (s *Server) handleAPIUnshareFileFromTeam(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	// Check if user is team member or admin
-	if !user.IsAdmin() {
+	// Check if user is team member or manages teams
+	if !hasPermission(user, models.RolePermManageTeams) {
 		isMember, err := database.DB.IsTeamMember(req.TeamId, user.Id)
 		if err != nil || !isMember {
 			http.Error(w, "Access denied", http.StatusForbidden)
@@ -534,8 +534,8 @@ func (s *Server) handleUserTeams(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		// Verify user is team member or admin
-		if !user.IsAdmin() {
+		// Verify user is team member or manages teams
+		if !hasPermission(user, models.RolePermManageTeams) {
 			isMember, err := database.DB.IsTeamMember(teamId, user.Id)
 			if err != nil || !isMember {
 				http.Error(w, "Access denied", http.StatusForbidden)
@@ -576,8 +576,8 @@ func (s *Server) handleAPITeamFiles(w http.ResponseWriter, r *http.Request) {
 
 	user, _ := userFromContext(r.Context())
 
-	// Check if user is team member or admin
-	if !user.IsAdmin() {
+	// Check if user is team member or manages teams
+	if !hasPermission(user, models.RolePermManageTeams) {
 		isMember, err := database.DB.IsTeamMember(teamId, user.Id)
 		if err != nil || !isMember {
 			http.Error(w, "Access denied", http.StatusForbidden)
@@ -659,7 +659,7 @@ func (s *Server) handleAPIFileTeams(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Only file owner can see teams
-	if file.UserId != user.Id && !user.IsAdmin() {
+	if file.UserId != user.Id && !hasPermission(user, models.RolePermViewAllFiles) {
 		http.Error(w, "Access denied", http.StatusForbidden)
 		return
 	}
@@ -13,6 +13,7 @@ import (
 	"net/http"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/Frimurare/WulfVault/internal/database"
@@ -82,7 +83,19 @@ func (s *Server) handleFileEdit(w http.ResponseWriter, r *http.Request) {
 	teamIDStr := r.FormValue("team_id")
 	fileComment := r.FormValue("file_comment")
 	requireAuth := r.FormValue("require_auth") == "true"
+	allowMagicLink := r.FormValue("allow_magic_link") != "false"
 	filePassword := r.FormValue("file_password")
+	keepPassword := r.FormValue("keep_file_password") == "true"
+	notifyRejections := r.FormValue("notify_rejected_recipients") == "true"
+
+	allowedRecipients, err := database.NormalizeAllowedRecipients(r.FormValue("allowed_recipients"))
+	if err != nil {
+		s.sendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if allowedRecipients != "" {
+		requireAuth = true
+	}
 
 	// Get file to verify ownership
 	fileInfo, err := database.DB.GetFileByID(fileID)
@@ -91,13 +104,14 @@ func (s *Server) handleFileEdit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check ownership (unless admin)
-	if fileInfo.UserId != user.Id && !user.IsAdmin() {
+	// Check ownership (unless the user's role covers all files)
+	if fileInfo.UserId != user.Id && !hasPermission(user, models.RolePermManageAllFiles) {
 		s.sendError(w, http.StatusForbidden, "Not authorized to edit this file")
 		return
 	}
 
-	// Update expiration
+	// Update expiration, within the limit of the user's role
+	expirationDays = roleOf(user).LimitExpiryDays(expirationDays)
 	var newExpireAt int64
 	var newExpireAtString string
 	unlimitedTime := expirationDays == 0
@@ -130,11 +144,20 @@ func (s *Server) handleFileEdit(w http.ResponseWriter, r *http.Request) {
 		log.Printf("Warning: Failed to update require auth: %v", err)
 		// Don't fail the request, just log the error
 	}
+	if err := database.DB.UpdateFileAllowMagicLink(fileID, allowMagicLink); err != nil {
+		log.Printf("Warning: Failed to update sign-in link policy: %v", err)
+	}
+	if err := database.DB.UpdateFileRecipients(fileID, allowedRecipients, notifyRejections); err != nil {
+		log.Printf("Warning: Failed to update allowed recipients: %v", err)
+	}
 
-	// Update password (empty string will clear the password)
-	if err := database.DB.UpdateFilePassword(fileID, filePassword); err != nil {
-		log.Printf("Warning: Failed to update file password: %v", err)
-		// Don't fail the request, just log the error
+	// Update password (empty string will clear the password). Setting a
+	// password invalidates outstanding password grants, so keep it unless changed.
+	if !keepPassword {
+		if err := database.DB.UpdateFilePassword(fileID, filePassword); err != nil {
+			log.Printf("Warning: Failed to update file password: %v", err)
+			// Don't fail the request, just log the error
+		}
 	}
 
 	// Share to team if team_id is provided
@@ -185,8 +208,8 @@ func (s *Server) handleFileDownloadHistory(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	// Check ownership (unless admin)
-	if fileInfo.UserId != user.Id && !user.IsAdmin() {
+	// Check ownership (unless the user's role covers all files)
+	if fileInfo.UserId != user.Id && !hasPermission(user, models.RolePermViewAllFiles) {
 		s.sendError(w, http.StatusForbidden, "Not authorized to view this file's download history")
 		return
 	}
@@ -237,8 +260,8 @@ func (s *Server) handleFileDelete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check ownership (unless admin)
-	if fileInfo.UserId != user.Id && !user.IsAdmin() {
+	// Check ownership (unless the user's role covers all files)
+	if fileInfo.UserId != user.Id && !hasPermission(user, models.RolePermManageAllFiles) {
 		s.sendError(w, http.StatusForbidden, "Not authorized to delete this file")
 		return
 	}
@@ -311,8 +334,8 @@ func (s *Server) handleFileEmail(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check ownership (unless admin)
-	if fileInfo.UserId != user.Id && !user.IsAdmin() {
+	// Check ownership (unless the user's role covers all files)
+	if fileInfo.UserId != user.Id && !hasPermission(user, models.RolePermManageAllFiles) {
 		s.sendError(w, http.StatusForbidden, "Not authorized to share this file")
 		return
 	}
@@ -979,6 +1002,22 @@ func (s *Server) renderUserDashboard(w http.ResponseWriter, userModel interface{
                             <input type="checkbox" id="requireAuth" name="require_auth" checked>
                             🔒 Require recipient authentication (email + password)
                         </label>
+                        <label style="display: block; margin-top: 8px; margin-left: 24px; font-weight: normal;">
+                            <input type="checkbox" id="allowMagicLink" name="allow_magic_link" checked>
+                            📧 Recipients may sign in with an emailed link instead of their password
+                        </label>
+                    </div>
+
+                    <div class="form-group">
+                        <label for="allowedRecipients">👥 Only these recipients may download (optional)</label>
+                        <textarea id="allowedRecipients" name="allowed_recipients" rows="2" placeholder="anna@example.com, @partner.com"></textarea>
+                        <p style="font-size: 12px; color: #999; margin-top: 4px;">
+                            Email addresses or @domains, separated by commas. Leave empty to allow anyone who signs in. Requires recipient authentication.
+                        </p>
+                        <label style="display: block; margin-top: 8px; font-weight: normal;">
+                            <input type="checkbox" id="notifyRejectedRecipients" name="notify_rejected_recipients">
+                            📨 Email me when someone else tries to download
+                        </label>
                     </div>
 
                     <div class="form-group">
@@ -1158,9 +1197,13 @@ func (s *Server) renderUserDashboard(w http.ResponseWriter, userModel interface{
 			if f.RequireAuth {
 				authBadge = `<span style="background: #2196f3; color: white; padding: 2px 8px; border-radius: 4px; font-size: 12px; margin-left: 8px;">🔒 Auth Required</span>`
 			}
+			if f.AllowedRecipients != "" {
+				authBadge += fmt.Sprintf(`<span style="background: #6366f1; color: white; padding: 2px 8px; border-radius: 4px; font-size: 12px; margin-left: 8px;" title="%s">👥 Named Recipients</span>`,
+					template.HTMLEscapeString(strings.Join(f.RecipientList(), ", ")))
+			}
 
 			passwordBadge := ""
-			if f.FilePasswordPlain != "" {
+			if f.HasPassword() {
 				passwordBadge = `<span style="background: #9c27b0; color: white; padding: 2px 8px; border-radius: 4px; font-size: 12px; margin-left: 8px;">🔐 Password Protected</span>`
 			}
 
@@ -1193,10 +1236,19 @@ func (s *Server) renderUserDashboard(w http.ResponseWriter, userModel interface{
 				fileType = "both" // Own file shared with team
 			}
 
-			passwordDisplay := ""
-			if f.FilePasswordPlain != "" {
-				passwordDisplay = fmt.Sprintf(`<p style="margin-top: 8px;"><strong>🔐 Password:</strong> <span id="password-%s" style="cursor: pointer; color: #9c27b0; text-decoration: underline;" onclick="togglePasswordVisibility('%s', '%s')">👁️ Show</span></p>`,
-					f.Id, f.Id, template.JSEscapeString(f.FilePasswordPlain))
+			// Integrity status is only shown to the file owner
+			integrityDisplay := ""
+			if f.UserId == user.Id {
+				switch f.IntegrityStatus {
+				case database.IntegrityStatusOK:
+					integrityDisplay = fmt.Sprintf(`<p style="color: #2e7d32;">🛡️ Integrity: verified %s</p>`, time.Unix(f.LastVerifiedAt, 0).Format("2006-01-02 15:04"))
+				case database.IntegrityStatusMismatch:
+					integrityDisplay = fmt.Sprintf(`<p style="color: #c62828; font-weight: 600;">⚠️ Integrity: content does not match the original upload (checked %s). Contact an administrator.</p>`, time.Unix(f.LastVerifiedAt, 0).Format("2006-01-02 15:04"))
+				case database.IntegrityStatusMissing:
+					integrityDisplay = fmt.Sprintf(`<p style="color: #c62828; font-weight: 600;">⚠️ Integrity: stored file is missing (checked %s). Contact an administrator.</p>`, time.Unix(f.LastVerifiedAt, 0).Format("2006-01-02 15:04"))
+				default:
+					integrityDisplay = `<p style="color: #999;">🛡️ Integrity: not yet verified</p>`
+				}
 			}
 
 			commentDisplay := ""
@@ -1254,7 +1306,7 @@ func (s *Server) renderUserDashboard(w http.ResponseWriter, userModel interface{
                             <button class="btn btn-primary" onclick="showEmailModal('%s', '%s', '%s')" title="Send file link via email" style="background: #007bff; flex: 0 0 auto;">
                                 📧 Email
                             </button>
-                            <button class="btn btn-secondary" onclick="showEditModal('%s', '%s', %d, %d, %t, %t, '%s', %t, '%s')" title="Edit file settings" style="flex: 0 0 auto;">
+                            <button class="btn btn-secondary" onclick="showEditModal('%s', '%s', %d, %d, %t, %t, '%s', %t, %t, %t, '%s', %t)" title="Edit file settings" style="flex: 0 0 auto;">
                                 ✏️ Edit
                             </button>
                             <button class="btn btn-danger" onclick="deleteFile('%s', '%s')" style="flex: 0 0 auto;">
@@ -1262,10 +1314,10 @@ func (s *Server) renderUserDashboard(w http.ResponseWriter, userModel interface{
                             </button>
                         </div>
                     </div>
-                </li>`, fileType, dataTeamsAttr, template.HTMLEscapeString(f.Name), fileExt, f.SizeBytes, f.UploadDate, f.DownloadCount, template.HTMLEscapeString(f.Name), template.HTMLEscapeString(f.Name), authBadge, passwordBadge, teamBadges, commentDisplay, f.Size, f.DownloadCount, expiryInfo, statusColor, status, passwordDisplay,
+                </li>`, fileType, dataTeamsAttr, template.HTMLEscapeString(f.Name), fileExt, f.SizeBytes, f.UploadDate, f.DownloadCount, template.HTMLEscapeString(f.Name), template.HTMLEscapeString(f.Name), authBadge, passwordBadge, teamBadges, commentDisplay, f.Size, f.DownloadCount, expiryInfo, statusColor, status, integrityDisplay,
 				splashURL, splashURL, splashURLEscaped,
 				directURL, directURL, directURLEscaped,
-				f.Id, template.JSEscapeString(f.Name), f.Id, template.JSEscapeString(f.Name), template.JSEscapeString(splashURL), f.Id, template.JSEscapeString(f.Name), f.DownloadsRemaining, f.ExpireAt, f.UnlimitedDownloads, f.UnlimitedTime, template.JSEscapeString(f.Comment), f.RequireAuth, template.JSEscapeString(f.FilePasswordPlain), f.Id, template.JSEscapeString(f.Name))
+				f.Id, template.JSEscapeString(f.Name), f.Id, template.JSEscapeString(f.Name), template.JSEscapeString(splashURL), f.Id, template.JSEscapeString(f.Name), f.DownloadsRemaining, f.ExpireAt, f.UnlimitedDownloads, f.UnlimitedTime, template.JSEscapeString(f.Comment), f.RequireAuth, f.HasPassword(), f.AllowMagicLink, template.JSEscapeString(strings.Join(f.RecipientList(), ", ")), f.NotifyRejections, f.Id, template.JSEscapeString(f.Name))
 		}
 		html += `
             </ul>`
@@ -1345,6 +1397,20 @@ func (s *Server) renderUserDashboard(w http.ResponseWriter, userModel interface{
                     🔒 Require authentication to download
                 </label>
                 <p style="font-size: 12px; color: #999; margin-top: 4px; margin-left: 24px;">If enabled, only logged-in users can download this file</p>
+                <label style="display: block; margin-top: 8px; margin-left: 24px;">
+                    <input type="checkbox" id="editAllowMagicLink">
+                    📧 Recipients may sign in with an emailed link instead of their password
+                </label>
+            </div>
+
+            <div style="margin-bottom: 20px;">
+                <label style="display: block; margin-bottom: 8px; color: #555; font-weight: 500;">👥 Only these recipients may download:</label>
+                <textarea id="editAllowedRecipients" rows="2" placeholder="anna@example.com, @partner.com" style="width: 100%; padding: 10px; border: 2px solid #e0e0e0; border-radius: 8px; font-family: inherit; resize: vertical;"></textarea>
+                <p style="font-size: 12px; color: #999; margin-top: 4px;">Email addresses or @domains. Leave empty to allow anyone who signs in.</p>
+                <label style="display: block; margin-top: 8px;">
+                    <input type="checkbox" id="editNotifyRejected">
+                    📨 Email me when someone else tries to download
+                </label>
             </div>
 
             <div style="margin-bottom: 20px;">
@@ -1509,10 +1575,11 @@ func (s *Server) renderUserDashboard(w http.ResponseWriter, userModel interface{
                             const downloader = log.email || 'Anonymous';
                             const ip = log.ipAddress || 'N/A';
                             const authBadge = log.isAuthenticated ? ' <span style="background: #2196f3; color: white; padding: 2px 6px; border-radius: 3px; font-size: 11px;">🔒 Auth</span>' : '';
+                            const verifiedBadge = log.emailVerifiedAt ? '<div style="color: #16a34a; font-size: 12px; margin-top: 4px;">✓ Email verified ' + new Date(log.emailVerifiedAt * 1000).toLocaleString('sv-SE') + '</div>' : '';
 
                             html += '<tr style="border-bottom: 1px solid #eee;">';
                             html += '<td style="padding: 12px;">' + dateStr + '</td>';
-                            html += '<td style="padding: 12px;">' + downloader + authBadge + '</td>';
+                            html += '<td style="padding: 12px;">' + downloader + authBadge + verifiedBadge + '</td>';
                             html += '<td style="padding: 12px; font-family: monospace; font-size: 12px;">' + ip + '</td>';
                             html += '</tr>';
                         });
@@ -1572,17 +1639,6 @@ func (s *Server) renderUserDashboard(w http.ResponseWriter, userModel interface{
             }
         }
 
-        function togglePasswordVisibility(fileId, password) {
-            const element = document.getElementById('password-' + fileId);
-            if (element.textContent === '👁️ Show') {
-                element.textContent = password;
-                element.style.fontFamily = 'monospace';
-            } else {
-                element.textContent = '👁️ Show';
-                element.style.fontFamily = 'inherit';
-            }
-        }
-
         // Email Modal Functions
         function showEmailModal(fileId, fileName, fileUrl) {
             document.getElementById('emailFileId').value = fileId;
@@ -1634,7 +1690,7 @@ func (s *Server) renderUserDashboard(w http.ResponseWriter, userModel interface{
         }
 
         // Edit File Modal Functions
-        function showEditModal(fileId, fileName, downloadsRemaining, expireAt, unlimitedDownloads, unlimitedTime, fileComment, requireAuth, filePassword) {
+        function showEditModal(fileId, fileName, downloadsRemaining, expireAt, unlimitedDownloads, unlimitedTime, fileComment, requireAuth, hasPassword, allowMagicLink, allowedRecipients, notifyRejected) {
             // Store file info
             const fileIdInput = document.getElementById('editFileId');
             if (!fileIdInput) {
@@ -1654,11 +1710,17 @@ func (s *Server) renderUserDashboard(w http.ResponseWriter, userModel interface{
 
             // Set require auth checkbox
             document.getElementById('editRequireAuth').checked = requireAuth;
+            document.getElementById('editAllowMagicLink').checked = allowMagicLink;
+            document.getElementById('editAllowedRecipients').value = allowedRecipients || '';
+            document.getElementById('editNotifyRejected').checked = notifyRejected;
 
-            // Set password protection
-            const hasPassword = filePassword && filePassword.length > 0;
+            // Set password protection. The current password is never shown;
+            // leaving the field empty keeps it.
+            const editPasswordInput = document.getElementById('editFilePassword');
             document.getElementById('editEnablePassword').checked = hasPassword;
-            document.getElementById('editFilePassword').value = filePassword || '';
+            editPasswordInput.dataset.hasPassword = hasPassword ? 'true' : 'false';
+            editPasswordInput.placeholder = hasPassword ? 'Leave empty to keep the current password' : 'Enter password';
+            editPasswordInput.value = '';
             toggleEditPasswordField();
 
             // Calculate days until expiration
@@ -1826,7 +1888,7 @@ func (s *Server) renderUserDashboard(w http.ResponseWriter, userModel interface{
 
             if (checkbox.checked) {
                 container.style.display = 'block';
-                passwordInput.required = true;
+                passwordInput.required = passwordInput.dataset.hasPassword !== 'true';
             } else {
                 container.style.display = 'none';
                 passwordInput.required = false;
@@ -1841,8 +1903,12 @@ func (s *Server) renderUserDashboard(w http.ResponseWriter, userModel interface{
             const teamId = document.getElementById('editTeamSelect').value;
             const fileComment = document.getElementById('editFileComment').value;
             const requireAuth = document.getElementById('editRequireAuth').checked;
+            const allowMagicLink = document.getElementById('editAllowMagicLink').checked;
+            const allowedRecipients = document.getElementById('editAllowedRecipients').value;
+            const notifyRejected = document.getElementById('editNotifyRejected').checked;
             const enablePassword = document.getElementById('editEnablePassword').checked;
             const filePassword = document.getElementById('editFilePassword').value;
+            const keepPassword = enablePassword && filePassword === '' && document.getElementById('editFilePassword').dataset.hasPassword === 'true';
 
             if (!fileId || fileId === '') {
                 alert('Error: File ID is missing. Please close and reopen the edit dialog.');
@@ -1850,7 +1916,7 @@ func (s *Server) renderUserDashboard(w http.ResponseWriter, userModel interface{
             }
 
             // Validate password if enabled
-            if (enablePassword && (!filePassword || filePassword.trim() === '')) {
+            if (enablePassword && !keepPassword && (!filePassword || filePassword.trim() === '')) {
                 alert('Please enter a password or uncheck the password protection option.');
                 return;
             }
@@ -1871,9 +1937,14 @@ func (s *Server) renderUserDashboard(w http.ResponseWriter, userModel interface{
             formData.append('downloads_limit', downloadsLimit);
             formData.append('file_comment', fileComment);
             formData.append('require_auth', requireAuth ? 'true' : 'false');
+            formData.append('allow_magic_link', allowMagicLink ? 'true' : 'false');
+            formData.append('allowed_recipients', allowedRecipients);
+            formData.append('notify_rejected_recipients', notifyRejected ? 'true' : 'false');
 
             // Only send password if checkbox is enabled
-            if (enablePassword) {
+            if (keepPassword) {
+                formData.append('keep_file_password', 'true');
+            } else if (enablePassword) {
                 formData.append('file_password', filePassword);
             } else {
                 formData.append('file_password', ''); // Clear password
@@ -12,7 +12,9 @@ import (
 
 	"github.com/Frimurare/WulfVault/internal/auth"
 	"github.com/Frimurare/WulfVault/internal/database"
+	"github.com/Frimurare/WulfVault/internal/mfa"
 	"github.com/Frimurare/WulfVault/internal/models"
+	"github.com/Frimurare/WulfVault/internal/passwords"
 )
 
 // handleUserSettings displays user settings including 2FA
@@ -56,6 +58,39 @@ func (s *Server) renderUserSettingsPage(w http.ResponseWriter, user *models.User
 			</button>`
 	}
 
+	// Users whose role requires a passkey are sent here until they register one
+	passkeyNotice := ""
+	if passkeyRequired(user) && !hasPasskeys(user.Id) {
+		passkeyNotice = `
+            <div class="alert alert-error">Your role requires a passkey. Add one below to continue using ` + s.config.CompanyName + `.</div>`
+	}
+
+	// Users whose password has expired are sent here until they change it
+	passwordPolicy := passwords.LoadPolicy()
+	passwordNotice := ""
+	if passwordExpired(user) {
+		passwordNotice = `
+            <div class="alert alert-error">Your password is older than ` + strconv.Itoa(passwordPolicy.MaxAgeDays) + ` days and has expired. Change it to continue.</div>`
+	}
+
+	// Users whose role requires 2FA are sent here at every sign-in until they set it up
+	mfaNotice := ""
+	if enforcement := mfa.Check(user); enforcement.Status == mfa.StatusOverdue {
+		mfaNotice = `
+            <div class="alert alert-error">Your role requires two-factor authentication and the grace period has ended. Enable 2FA below or add a passkey to continue using ` + s.config.CompanyName + `.</div>`
+	} else if enforcement.Status == mfa.StatusGracePeriod {
+		mfaNotice = `
+            <div class="alert alert-error">Your role requires two-factor authentication. Enable 2FA below or add a passkey within ` + strconv.Itoa(enforcement.DaysLeft()) + ` day(s), by ` + enforcement.Deadline.Format("2006-01-02 15:04") + `. After that you can only sign in to set it up.</div>`
+	}
+
+	adminPermissions := ""
+	if user.IsAdmin() {
+		adminPermissions = `
+                <label><input type="checkbox" name="permissions" value="manage_users"> Manage users &amp; download accounts</label>
+                <label><input type="checkbox" name="permissions" value="manage_logs"> Read audit logs</label>
+                <label><input type="checkbox" name="permissions" value="api_mod"> Change branding &amp; server settings</label>`
+	}
+
 	html := `<!DOCTYPE html>
 <html lang="en">
 <head>
@@ -211,6 +246,37 @@ func (s *Server) renderUserSettingsPage(w http.ResponseWriter, user *models.User
             color: #721c24;
             border: 1px solid #f5c6cb;
         }
+        .form-group select {
+            width: 100%;
+            padding: 12px;
+            border: 2px solid #e0e0e0;
+            border-radius: 6px;
+            font-size: 16px;
+        }
+        .permission-list label {
+            display: block;
+            font-weight: normal;
+            margin-bottom: 6px;
+        }
+        .permission-list input {
+            width: auto;
+            margin-right: 8px;
+        }
+        .api-key-table {
+            width: 100%;
+            border-collapse: collapse;
+            margin-top: 15px;
+            font-size: 14px;
+        }
+        .api-key-table th, .api-key-table td {
+            text-align: left;
+            padding: 10px 8px;
+            border-bottom: 1px solid #eee;
+        }
+        .api-key-table code {
+            font-size: 12px;
+            color: #555;
+        }
         .secret-text {
             font-family: monospace;
             background: #f5f5f5;
@@ -325,7 +391,7 @@ func (s *Server) renderUserSettingsPage(w http.ResponseWriter, user *models.User
         </div>
 
         <div class="card">
-            <h2>Security Settings</h2>
+            <h2>Security Settings</h2>` + passwordNotice + mfaNotice + `
 
             <div class="setting-item">
                 <div class="setting-info">
@@ -350,6 +416,89 @@ func (s *Server) renderUserSettingsPage(w http.ResponseWriter, user *models.User
             </div>
         </div>
 
+        <div class="card">
+            <h2>Passkeys</h2>` + passkeyNotice + `
+
+            <div class="setting-item">
+                <div class="setting-info">
+                    <h3>Passkeys &amp; Security Keys</h3>
+                    <p>Sign in with your fingerprint, face, device PIN or a hardware security key. Passkeys work as a second factor after your password, or on their own from the login page.</p>
+                </div>
+                <div>
+                    <button onclick="addPasskey()" style="background: ` + s.getPrimaryColor() + `; color: white; padding: 10px 20px; border: none; border-radius: 6px; cursor: pointer; font-size: 14px; font-weight: 600;">
+                        Add Passkey
+                    </button>
+                </div>
+            </div>
+
+            <div id="passkeysList"><p style="color: #999;">Loading...</p></div>
+        </div>
+
+        <div class="card">
+            <h2>Your Sessions</h2>
+
+            <div class="setting-item">
+                <div class="setting-info">
+                    <h3>Signed-in Devices</h3>
+                    <p>Browsers where you are currently signed in. Sign out any session you don't recognise and change your password.</p>
+                </div>
+                <div>
+                    <button onclick="revokeOtherSessions()" style="background: #f44336; color: white; padding: 10px 20px; border: none; border-radius: 6px; cursor: pointer; font-size: 14px; font-weight: 600;">
+                        Sign Out All Other Sessions
+                    </button>
+                </div>
+            </div>
+
+            <div id="sessionsList"><p style="color: #999;">Loading...</p></div>
+        </div>
+
+        <div class="card">
+            <h2>Administrator Access</h2>
+
+            <div class="setting-item">
+                <div class="setting-info">
+                    <h3>Viewed As You</h3>
+                    <p>Times an administrator viewed ` + s.config.CompanyName + ` as you to help with a problem. Every page they opened is recorded in the audit log.</p>
+                </div>
+            </div>
+
+            ` + renderAdminAccessHistory(user.Id) + `
+        </div>
+
+        <div class="card">
+            <h2>Security Activity</h2>
+
+            <div class="setting-item">
+                <div class="setting-info">
+                    <h3>Recent Events</h3>
+                    <p>Sign-ins, password and two-factor changes and API key use on your account. You are emailed when your account is signed in to from a new device or country. If you don't recognise something, change your password and sign out your other sessions.</p>
+                </div>
+            </div>
+
+            <div id="securityActivityList"><p style="color: #999;">Loading...</p></div>
+            <div style="text-align: center; margin-top: 15px;">
+                <button id="securityActivityMore" class="btn" style="display: none; background: #e0e0e0; color: #333; padding: 8px 16px;" onclick="loadSecurityActivity(true)">Show More</button>
+            </div>
+        </div>
+
+        <div class="card">
+            <h2>API Keys</h2>
+
+            <div class="setting-item">
+                <div class="setting-info">
+                    <h3>REST API Access</h3>
+                    <p>Use API keys with <code>Authorization: Bearer &lt;key&gt;</code> to call <code>/api/v1/</code> from scripts and CI</p>
+                </div>
+                <div>
+                    <button onclick="openCreateApiKey()" style="background: ` + s.getPrimaryColor() + `; color: white; padding: 10px 20px; border: none; border-radius: 6px; cursor: pointer; font-size: 14px; font-weight: 600;">
+                        Create API Key
+                    </button>
+                </div>
+            </div>
+
+            <div id="apiKeysList"><p style="color: #999;">Loading...</p></div>
+        </div>
+
         <div class="card">
             <h2>GDPR & Privacy</h2>
 
@@ -384,6 +533,7 @@ func (s *Server) renderUserSettingsPage(w http.ResponseWriter, user *models.User
         <div class="modal-content">
             <span class="close-btn" onclick="closeModal('changePasswordModal')">&times;</span>
             <h3>Change Password</h3>
+            <p style="color: #666; font-size: 13px; margin-bottom: 15px;">` + passwordPolicy.Requirements() + `</p>
             <div id="changePasswordMessage"></div>
             <div class="form-group">
                 <label for="current-password">Current Password</label>
@@ -402,6 +552,39 @@ func (s *Server) renderUserSettingsPage(w http.ResponseWriter, user *models.User
         </div>
     </div>
 
+    <!-- Create API Key Modal -->
+    <div id="createApiKeyModal" class="modal">
+        <div class="modal-content">
+            <span class="close-btn" onclick="closeModal('createApiKeyModal')">&times;</span>
+            <h3>Create API Key</h3>
+            <div id="createApiKeyContent">
+                <div id="createApiKeyMessage"></div>
+                <div class="form-group">
+                    <label for="api-key-name">Name</label>
+                    <input type="text" id="api-key-name" maxlength="100" placeholder="e.g. CI pipeline">
+                </div>
+                <div class="form-group">
+                    <label for="api-key-expiry">Expires</label>
+                    <select id="api-key-expiry">
+                        <option value="30">In 30 days</option>
+                        <option value="90" selected>In 90 days</option>
+                        <option value="365">In 1 year</option>
+                        <option value="0">Never</option>
+                    </select>
+                </div>
+                <div class="form-group permission-list">
+                    <label>Permissions</label>
+                    <label><input type="checkbox" name="permissions" value="view" checked> View files</label>
+                    <label><input type="checkbox" name="permissions" value="upload" checked> Upload files</label>
+                    <label><input type="checkbox" name="permissions" value="edit"> Edit files &amp; file requests</label>
+                    <label><input type="checkbox" name="permissions" value="delete"> Delete files</label>` + adminPermissions + `
+                </div>
+                <button onclick="confirmCreateApiKey()" class="btn btn-primary">Create Key</button>
+                <button onclick="closeModal('createApiKeyModal')" class="btn btn-secondary" style="margin-left: 10px;">Cancel</button>
+            </div>
+        </div>
+    </div>
+
     <!-- Enable 2FA Modal -->
     <div id="enable2FAModal" class="modal">
         <div class="modal-content">
@@ -460,11 +643,6 @@ func (s *Server) renderUserSettingsPage(w http.ResponseWriter, user *models.User
                 return;
             }
 
-            if (newPassword.length < 8) {
-                messageDiv.innerHTML = '<div class="alert alert-error">New password must be at least 8 characters</div>';
-                return;
-            }
-
             if (newPassword !== confirmPassword) {
                 messageDiv.innerHTML = '<div class="alert alert-error">New passwords do not match</div>';
                 return;
@@ -637,6 +815,311 @@ func (s *Server) renderUserSettingsPage(w http.ResponseWriter, user *models.User
             }
         }
 
+        function escapeHTML(text) {
+            const div = document.createElement('div');
+            div.textContent = text;
+            return div.innerHTML;
+        }
+
+        function formatUnix(ts) {
+            return ts ? new Date(ts * 1000).toLocaleString() : 'Never';
+        }
+
+        async function loadApiKeys() {
+            const container = document.getElementById('apiKeysList');
+            try {
+                const response = await fetch('/settings/api-keys', { credentials: 'same-origin' });
+                const data = await response.json();
+
+                if (!data.keys || data.keys.length === 0) {
+                    container.innerHTML = '<p style="color: #999; margin-top: 15px;">You have no API keys</p>';
+                    return;
+                }
+
+                let rows = '';
+                data.keys.forEach(k => {
+                    const expiry = k.expiry ? formatUnix(k.expiry) + (k.expired ? ' <span style="color: #f44336; font-weight: 600;">(expired)</span>' : '') : 'Never';
+                    rows += '<tr>' +
+                        '<td>' + escapeHTML(k.name) + '<br><code>' + escapeHTML(k.prefix) + '_…</code></td>' +
+                        '<td>' + escapeHTML((k.permissions || []).join(', ')) + '</td>' +
+                        '<td>' + formatUnix(k.created_at) + '</td>' +
+                        '<td>' + formatUnix(k.last_used) + '</td>' +
+                        '<td>' + expiry + '</td>' +
+                        '<td><button class="btn" style="background: #f44336; color: white; padding: 6px 12px;" onclick="revokeApiKey(\'' + k.id + '\')">Revoke</button></td>' +
+                        '</tr>';
+                });
+
+                container.innerHTML = '<table class="api-key-table"><thead><tr>' +
+                    '<th>Name</th><th>Permissions</th><th>Created</th><th>Last Used</th><th>Expires</th><th></th>' +
+                    '</tr></thead><tbody>' + rows + '</tbody></table>';
+            } catch (error) {
+                container.innerHTML = '<div class="alert alert-error">Failed to load API keys</div>';
+            }
+        }
+
+        function openCreateApiKey() {
+            document.getElementById('createApiKeyMessage').innerHTML = '';
+            document.getElementById('api-key-name').value = '';
+            document.getElementById('createApiKeyModal').style.display = 'flex';
+        }
+
+        async function confirmCreateApiKey() {
+            const messageDiv = document.getElementById('createApiKeyMessage');
+            const formData = new FormData();
+            formData.append('name', document.getElementById('api-key-name').value);
+            formData.append('expiry_days', document.getElementById('api-key-expiry').value);
+            document.querySelectorAll('#createApiKeyModal input[name="permissions"]:checked').forEach(cb => {
+                formData.append('permissions', cb.value);
+            });
+
+            try {
+                const response = await fetch('/settings/api-keys/create', {
+                    method: 'POST',
+                    body: new URLSearchParams(formData),
+                    credentials: 'same-origin'
+                });
+                const data = await response.json();
+
+                if (!data.success) {
+                    messageDiv.innerHTML = '<div class="alert alert-error">' + escapeHTML(data.error || 'Failed to create API key') + '</div>';
+                    return;
+                }
+
+                document.getElementById('createApiKeyContent').innerHTML =
+                    '<div class="alert alert-success">API key created. Copy it now - it will not be shown again.</div>' +
+                    '<div class="secret-text">' + escapeHTML(data.key.token) + '</div>' +
+                    '<button onclick="location.reload()" class="btn btn-primary">Done</button>';
+                loadApiKeys();
+            } catch (error) {
+                messageDiv.innerHTML = '<div class="alert alert-error">Error: ' + escapeHTML(error.message) + '</div>';
+            }
+        }
+
+        async function revokeApiKey(id) {
+            if (!confirm('Revoke this API key? Scripts using it will stop working immediately.')) {
+                return;
+            }
+
+            try {
+                const response = await fetch('/settings/api-keys/revoke', {
+                    method: 'POST',
+                    body: new URLSearchParams({ id: id }),
+                    credentials: 'same-origin'
+                });
+                const data = await response.json();
+
+                if (data.success) {
+                    loadApiKeys();
+                } else {
+                    alert(data.error || 'Failed to revoke API key');
+                }
+            } catch (error) {
+                alert('Error: ' + error.message);
+            }
+        }
+
+        async function loadSessions() {
+            const container = document.getElementById('sessionsList');
+            try {
+                const response = await fetch('/settings/sessions', { credentials: 'same-origin' });
+                const data = await response.json();
+
+                let rows = '';
+                (data.sessions || []).forEach(sess => {
+                    const action = sess.current
+                        ? '<span style="color: #4caf50; font-weight: 600;">This session</span>'
+                        : '<button class="btn" style="background: #f44336; color: white; padding: 6px 12px;" onclick="revokeSession(\'' + sess.id + '\')">Sign Out</button>';
+                    const viewer = sess.impersonated_by
+                        ? '<br><span style="color: #b71c1c; font-size: 12px;">Administrator view by ' + escapeHTML(sess.impersonated_by) + '</span>'
+                        : sess.remembered
+                        ? '<br><span style="color: #666; font-size: 12px;">Remembered device until ' + formatUnix(sess.valid_until) + '</span>'
+                        : '';
+                    rows += '<tr>' +
+                        '<td title="' + escapeHTML(sess.user_agent) + '">' + escapeHTML(sess.device || 'Unknown device') + viewer + '</td>' +
+                        '<td><code>' + escapeHTML(sess.ip_address || 'N/A') + '</code></td>' +
+                        '<td>' + formatUnix(sess.created_at) + '</td>' +
+                        '<td>' + formatUnix(sess.last_seen) + '</td>' +
+                        '<td>' + action + '</td>' +
+                        '</tr>';
+                });
+
+                container.innerHTML = '<table class="api-key-table"><thead><tr>' +
+                    '<th>Device</th><th>IP Address</th><th>Signed In</th><th>Last Active</th><th></th>' +
+                    '</tr></thead><tbody>' + rows + '</tbody></table>';
+            } catch (error) {
+                container.innerHTML = '<div class="alert alert-error">Failed to load sessions</div>';
+            }
+        }
+
+        async function revokeSession(id) {
+            if (!confirm('Sign out this session?')) {
+                return;
+            }
+
+            try {
+                const response = await fetch('/settings/sessions/revoke', {
+                    method: 'POST',
+                    body: new URLSearchParams({ id: id }),
+                    credentials: 'same-origin'
+                });
+                const data = await response.json();
+
+                if (data.success) {
+                    loadSessions();
+                } else {
+                    alert(data.error || 'Failed to sign out session');
+                }
+            } catch (error) {
+                alert('Error: ' + error.message);
+            }
+        }
+
+        async function revokeOtherSessions() {
+            if (!confirm('Sign out all other sessions? You stay signed in on this device.')) {
+                return;
+            }
+
+            try {
+                const response = await fetch('/settings/sessions/revoke-others', {
+                    method: 'POST',
+                    credentials: 'same-origin'
+                });
+                const data = await response.json();
+
+                if (data.success) {
+                    loadSessions();
+                } else {
+                    alert(data.error || 'Failed to sign out sessions');
+                }
+            } catch (error) {
+                alert('Error: ' + error.message);
+            }
+        }
+
+        ` + passkeyScript() + `
+
+        async function loadPasskeys() {
+            const container = document.getElementById('passkeysList');
+            try {
+                const response = await fetch('/settings/passkeys', { credentials: 'same-origin' });
+                const data = await response.json();
+
+                if (!data.passkeys || data.passkeys.length === 0) {
+                    container.innerHTML = '<p style="color: #999; margin-top: 15px;">You have no passkeys</p>';
+                    return;
+                }
+
+                let rows = '';
+                data.passkeys.forEach(p => {
+                    rows += '<tr>' +
+                        '<td>' + escapeHTML(p.name) + (p.synced ? ' <span style="color: #999; font-size: 12px;">(synced)</span>' : '') + '</td>' +
+                        '<td>' + formatUnix(p.created_at) + '</td>' +
+                        '<td>' + formatUnix(p.last_used) + '</td>' +
+                        '<td><button class="btn" style="background: #2196F3; color: white; padding: 6px 12px;" onclick="renamePasskey(' + p.id + ')">Rename</button> ' +
+                        '<button class="btn" style="background: #f44336; color: white; padding: 6px 12px;" onclick="deletePasskey(' + p.id + ')">Remove</button></td>' +
+                        '</tr>';
+                });
+
+                container.innerHTML = '<table class="api-key-table"><thead><tr>' +
+                    '<th>Name</th><th>Added</th><th>Last Used</th><th></th>' +
+                    '</tr></thead><tbody>' + rows + '</tbody></table>';
+            } catch (error) {
+                container.innerHTML = '<div class="alert alert-error">Failed to load passkeys</div>';
+            }
+        }
+
+        async function addPasskey() {
+            if (!window.PublicKeyCredential) {
+                alert('This browser does not support passkeys');
+                return;
+            }
+            const name = prompt('Name this passkey (e.g. "Work laptop" or "YubiKey"):', 'Passkey');
+            if (name === null) return;
+
+            try {
+                const options = await passkeyRequest('/settings/passkeys/register/begin');
+                await passkeyRequest('/settings/passkeys/register/finish?name=' + encodeURIComponent(name), await passkeyCreate(options));
+                location.reload();
+            } catch (error) {
+                if (error.name !== 'NotAllowedError') alert(error.message);
+            }
+        }
+
+        async function renamePasskey(id) {
+            const name = prompt('New name for this passkey:');
+            if (!name) return;
+
+            try {
+                await passkeyRequest('/settings/passkeys/rename', new URLSearchParams({ id: id, name: name }));
+                loadPasskeys();
+            } catch (error) {
+                alert(error.message);
+            }
+        }
+
+        async function deletePasskey(id) {
+            if (!confirm('Remove this passkey? You will no longer be able to sign in with it.')) {
+                return;
+            }
+
+            try {
+                await passkeyRequest('/settings/passkeys/delete', new URLSearchParams({ id: id }));
+                loadPasskeys();
+            } catch (error) {
+                alert(error.message);
+            }
+        }
+
+        let securityActivityRows = '';
+        let securityActivityOffset = 0;
+
+        async function loadSecurityActivity(more) {
+            const container = document.getElementById('securityActivityList');
+            const moreButton = document.getElementById('securityActivityMore');
+            if (!more) {
+                securityActivityRows = '';
+                securityActivityOffset = 0;
+            }
+            try {
+                const response = await fetch('/settings/security-activity?offset=' + securityActivityOffset, { credentials: 'same-origin' });
+                const data = await response.json();
+                if (!response.ok) {
+                    throw new Error(data.error || 'Failed to load security activity');
+                }
+
+                (data.events || []).forEach(event => {
+                    const status = event.success
+                        ? escapeHTML(event.label || event.action)
+                        : '<span style="color: #f44336; font-weight: 600;">' + escapeHTML(event.label || event.action) + '</span>';
+                    const detail = event.detail ? '<br><span style="color: #666; font-size: 12px;">' + escapeHTML(event.detail) + '</span>' : '';
+                    const viewer = event.impersonated_by
+                        ? '<br><span style="color: #b71c1c; font-size: 12px;">By administrator ' + escapeHTML(event.impersonated_by) + '</span>'
+                        : '';
+                    securityActivityRows += '<tr>' +
+                        '<td>' + formatUnix(event.timestamp) + '</td>' +
+                        '<td>' + status + detail + viewer + '</td>' +
+                        '<td>' + escapeHTML(event.device) + '</td>' +
+                        '<td><code>' + escapeHTML(event.ip_address || 'N/A') + '</code></td>' +
+                        '</tr>';
+                });
+                securityActivityOffset += (data.events || []).length;
+
+                container.innerHTML = securityActivityRows
+                    ? '<table class="api-key-table"><thead><tr>' +
+                      '<th>Time</th><th>Event</th><th>Device</th><th>IP Address</th>' +
+                      '</tr></thead><tbody>' + securityActivityRows + '</tbody></table>'
+                    : '<p style="color: #999;">No security activity yet.</p>';
+                moreButton.style.display = data.more ? 'inline-block' : 'none';
+            } catch (error) {
+                container.innerHTML = '<div class="alert alert-error">Failed to load security activity</div>';
+            }
+        }
+
+        loadApiKeys();
+        loadPasskeys();
+        loadSessions();
+        loadSecurityActivity(false);
+
         // Close modal when clicking outside
         window.onclick = function(event) {
             if (event.target.classList.contains('modal')) {
@@ -689,31 +1172,37 @@ func (s *Server) handleChangePassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if len(newPassword) < 8 {
+	if currentPassword == newPassword {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": false,
-			"error":   "New password must be at least 8 characters",
+			"error":   "New password must be different from current password",
 		})
 		return
 	}
 
-	if currentPassword == newPassword {
+	// Verify current password
+	_, err = auth.AuthenticateUser(user.Email, currentPassword)
+	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": false,
-			"error":   "New password must be different from current password",
+			"error":   "Current password is incorrect",
 		})
 		return
 	}
 
-	// Verify current password
-	_, err = auth.AuthenticateUser(user.Email, currentPassword)
-	if err != nil {
+	// Enforce the password policy
+	if err := passwords.LoadPolicy().Check(newPassword, &passwords.Account{
+		Type:        database.AccountTypeUser,
+		Id:          user.Id,
+		Email:       user.Email,
+		CurrentHash: user.Password,
+	}); err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"success": false,
-			"error":   "Current password is incorrect",
+			"error":   err.Error(),
 		})
 		return
 	}
@@ -739,6 +1228,11 @@ func (s *Server) handleChangePassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	passwords.Record(database.AccountTypeUser, user.Id, hashedPassword)
+
+	// Sign out everywhere else
+	revokeSessionsAfterCredentialChange(r, user, user, "password_changed")
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success": true,
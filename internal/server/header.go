@@ -376,28 +376,45 @@ func (s *Server) getHeaderHTML(user *models.User, forAdmin bool) string {
 
 	// Different navigation based on user type and page context
 	if user.IsAdmin() && forAdmin {
-		// Full admin navigation
-		headerHTML += `
-            <a href="/admin">Admin Dashboard</a>
-            <a href="/dashboard">My Files</a>
-            <a href="/admin/users">Users</a>
-            <a href="/admin/teams">Teams</a>
-            <div class="dropdown">
-                <a class="dropdown-toggle">Files</a>
-                <div class="dropdown-content">
-                    <a href="/admin/files">All Files</a>
-                    <a href="/admin/trash">Trash</a>
-                </div>
-            </div>
+		// Admin navigation, limited to what the user's role allows.
+		// Pages rendered without a signed-in user show every link.
+		role := &models.Role{Permissions: models.RolePermAll}
+		if user.Id != 0 {
+			role = roleOf(user)
+		}
+		link := func(permission models.RolePermission, href, label string) string {
+			if !role.HasPermission(permission) {
+				return ""
+			}
+			return `
+            <a href="` + href + `">` + label + `</a>`
+		}
+		dropdown := func(label, links string) string {
+			if links == "" {
+				return ""
+			}
+			return `
             <div class="dropdown">
-                <a class="dropdown-toggle">Server</a>
-                <div class="dropdown-content">
-                    <a href="/admin/settings">Server Settings</a>
-                    <a href="/admin/branding">Branding</a>
-                    <a href="/admin/email-settings">Email</a>
-                    <a href="/admin/audit-logs">Audit Logs</a>
+                <a class="dropdown-toggle">` + label + `</a>
+                <div class="dropdown-content">` + links + `
                 </div>
-            </div>
+            </div>`
+		}
+
+		headerHTML += link(models.RolePermViewDashboard, "/admin", "Admin Dashboard") + `
+            <a href="/dashboard">My Files</a>` +
+			link(models.RolePermManageUsers, "/admin/users", "Users") +
+			link(models.RolePermManageTeams, "/admin/teams", "Teams") +
+			dropdown("Files",
+				link(models.RolePermViewAllFiles, "/admin/files", "All Files")+
+					link(models.RolePermManageAllFiles, "/admin/trash", "Trash")) +
+			dropdown("Server",
+				link(models.RolePermManageSettings, "/admin/settings", "Server Settings")+
+					link(models.RolePermManageBranding, "/admin/branding", "Branding")+
+					link(models.RolePermManageEmail, "/admin/email-settings", "Email")+
+					link(models.RolePermManageSettings, "/admin/sso", "Single Sign-On")+
+					link(models.RolePermManageRoles, "/admin/roles", "Roles")+
+					link(models.RolePermViewAuditLogs, "/admin/audit-logs", "Audit Logs")) + `
             <a href="/settings">My Account</a>
             <a href="/logout" style="margin-left: auto;">Logout</a>
             <span>v` + s.config.Version + `</span>`
@@ -416,6 +433,20 @@ func (s *Server) getHeaderHTML(user *models.User, forAdmin bool) string {
     </div>
     <div class="mobile-nav-overlay"></div>
     <script>
+        // Sensitive actions need a recent authentication; the server marks
+        // refused requests and the user confirms their identity first
+        (function() {
+            const originalFetch = window.fetch;
+            window.fetch = async function(...args) {
+                const response = await originalFetch.apply(this, args);
+                if (response.status === 403 && response.headers.get('X-Sudo-Required')) {
+                    window.location.href = '/sudo?redirect=' + encodeURIComponent(window.location.pathname + window.location.search);
+                    return new Promise(() => {});
+                }
+                return response;
+            };
+        })();
+
         // Mobile navigation toggle
         document.addEventListener('DOMContentLoaded', function() {
             const hamburger = document.querySelector('.hamburger');
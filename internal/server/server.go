@@ -17,6 +17,9 @@ import (
 	"github.com/Frimurare/WulfVault/internal/config"
 	"github.com/Frimurare/WulfVault/internal/database"
 	"github.com/Frimurare/WulfVault/internal/models"
+	"github.com/Frimurare/WulfVault/internal/sessionpolicy"
+	"github.com/Frimurare/WulfVault/internal/storage"
+	"github.com/Frimurare/WulfVault/internal/sudo"
 )
 
 type Server struct {
@@ -51,6 +54,10 @@ func (s *Server) Start() error {
 	mux.HandleFunc("/", s.handleHome)
 	mux.HandleFunc("/login", s.handleLogin)
 	mux.HandleFunc("/logout", s.handleLogout)
+	mux.HandleFunc("/auth/oidc/login", s.handleOIDCLogin)
+	mux.HandleFunc("/auth/oidc/callback", s.handleOIDCCallback)
+	mux.HandleFunc("/auth/passkey/begin", s.handlePasskeyLoginBegin)
+	mux.HandleFunc("/auth/passkey/finish", s.handlePasskeyLoginFinish)
 	mux.HandleFunc("/forgot-password", s.handleForgotPassword)
 	mux.HandleFunc("/reset-password", s.handleResetPassword)
 	mux.HandleFunc("/s/", s.handleSplashPage)
@@ -59,10 +66,17 @@ func (s *Server) Start() error {
 
 	// 2FA routes
 	mux.HandleFunc("/2fa/verify", s.handle2FAVerify)
+	mux.HandleFunc("/2fa/passkey/begin", s.handle2FAPasskeyBegin)
+	mux.HandleFunc("/2fa/passkey/finish", s.handle2FAPasskeyFinish)
 	mux.HandleFunc("/2fa/setup", s.requireAuth(s.handle2FASetup))
 	mux.HandleFunc("/2fa/enable", s.requireAuth(s.handle2FAEnable))
-	mux.HandleFunc("/2fa/disable", s.requireAuth(s.handle2FADisable))
-	mux.HandleFunc("/2fa/regenerate-backup-codes", s.requireAuth(s.handle2FARegenerateBackupCodes))
+	mux.HandleFunc("/2fa/disable", s.requireAuth(s.requireSudo(sudo.ActionAccountSecurity, s.handle2FADisable)))
+	mux.HandleFunc("/2fa/regenerate-backup-codes", s.requireAuth(s.requireSudo(sudo.ActionAccountSecurity, s.handle2FARegenerateBackupCodes)))
+
+	// Confirming the identity before sensitive actions
+	mux.HandleFunc("/sudo", s.requireAuth(s.handleSudo))
+	mux.HandleFunc("/sudo/passkey/begin", s.requireAuth(s.handleSudoPasskeyBegin))
+	mux.HandleFunc("/sudo/passkey/finish", s.requireAuth(s.handleSudoPasskeyFinish))
 
 	// Public file request routes
 	mux.HandleFunc("/upload-request/", s.handleUploadRequest)
@@ -76,7 +90,11 @@ func (s *Server) Start() error {
 	mux.HandleFunc("/download/change-password", s.requireDownloadAuth(s.handleDownloadChangePassword))
 	mux.HandleFunc("/download/account-settings", s.requireDownloadAuth(s.handleDownloadAccountSettings))
 	mux.HandleFunc("/download/delete-account", s.requireDownloadAuth(s.handleDownloadAccountDeleteSelf))
+	mux.HandleFunc("/download/verify", s.handleDownloadVerifyLink)
+	mux.HandleFunc("/download/magic-link", s.handleDownloadMagicLinkRequest)
+	mux.HandleFunc("/download/magic", s.handleDownloadMagicLink)
 	mux.HandleFunc("/download/logout", s.handleDownloadLogout)
+	mux.HandleFunc("/download/logout-everywhere", s.requireDownloadAuth(s.handleDownloadLogoutEverywhere))
 	mux.HandleFunc("/download/deleted-success", s.handleDownloadDeletedSuccess)
 
 	// User routes (require authentication)
@@ -84,45 +102,76 @@ func (s *Server) Start() error {
 	mux.HandleFunc("/settings", s.requireAuth(s.handleUserSettings))
 	mux.HandleFunc("/settings/delete-account", s.requireAuth(s.handleUserAccountDelete))
 	mux.HandleFunc("/settings/account", s.requireAuth(s.handleUserAccountSettings))
+	mux.HandleFunc("/settings/api-keys", s.requireAuth(s.handleAPIKeysList))
+	mux.HandleFunc("/settings/api-keys/create", s.requireAuth(s.requireSudo(sudo.ActionAccountSecurity, s.handleAPIKeyCreate)))
+	mux.HandleFunc("/settings/api-keys/revoke", s.requireAuth(s.handleAPIKeyRevoke))
+	mux.HandleFunc("/settings/passkeys", s.requireAuth(s.handlePasskeyList))
+	mux.HandleFunc("/settings/passkeys/register/begin", s.requireAuth(s.handlePasskeyRegisterBegin))
+	mux.HandleFunc("/settings/passkeys/register/finish", s.requireAuth(s.handlePasskeyRegisterFinish))
+	mux.HandleFunc("/settings/passkeys/rename", s.requireAuth(s.handlePasskeyRename))
+	mux.HandleFunc("/settings/passkeys/delete", s.requireAuth(s.requireSudo(sudo.ActionAccountSecurity, s.handlePasskeyDelete)))
+	mux.HandleFunc("/settings/sessions", s.requireAuth(s.handleSessionsList))
+	mux.HandleFunc("/settings/sessions/revoke", s.requireAuth(s.handleSessionRevoke))
+	mux.HandleFunc("/settings/sessions/revoke-others", s.requireAuth(s.handleSessionsRevokeOthers))
+	mux.HandleFunc("/settings/security-activity", s.requireAuth(s.handleSecurityActivity))
 	mux.HandleFunc("/change-password", s.requireAuth(s.handleChangePassword))
 
 	// GDPR API routes (require authentication)
 	mux.HandleFunc("/api/v1/user/export-data", s.requireAuth(s.handleUserDataExport))
-	mux.HandleFunc("/upload", s.requireAuth(s.handleUpload))
+	mux.HandleFunc("/upload", s.requirePermission(models.RolePermUpload, s.handleUpload))
 	mux.HandleFunc("/files", s.requireAuth(s.handleUserFiles))
 	mux.HandleFunc("/file/delete", s.requireAuth(s.handleFileDelete))
 	mux.HandleFunc("/file/edit", s.requireAuth(s.handleFileEdit))
 	mux.HandleFunc("/file/downloads", s.requireAuth(s.handleFileDownloadHistory))
-	mux.HandleFunc("/file/email", s.requireAuth(s.handleFileEmail))
-	mux.HandleFunc("/file-request/create", s.requireAuth(s.handleFileRequestCreate))
+	mux.HandleFunc("/file/email", s.requirePermission(models.RolePermShareExternally, s.handleFileEmail))
+	mux.HandleFunc("/file-request/create", s.requirePermission(models.RolePermCreateFileRequests, s.handleFileRequestCreate))
 	mux.HandleFunc("/file-request/list", s.requireAuth(s.handleFileRequestList))
 	mux.HandleFunc("/file-request/delete", s.requireAuth(s.handleFileRequestDelete))
 
 	// Teams routes (require authentication)
 	mux.HandleFunc("/teams", s.requireAuth(s.handleUserTeams))
 
-	// Admin routes (require admin authentication)
-	mux.HandleFunc("/admin", s.requireAdmin(s.handleAdminDashboard))
-	mux.HandleFunc("/admin/users", s.requireAdmin(s.handleAdminUsers))
-	mux.HandleFunc("/admin/users/create", s.requireAdmin(s.handleAdminUserCreate))
-	mux.HandleFunc("/admin/users/edit", s.requireAdmin(s.handleAdminUserEdit))
-	mux.HandleFunc("/admin/users/delete", s.requireAdmin(s.handleAdminUserDelete))
-	mux.HandleFunc("/admin/download-accounts/toggle", s.requireAdmin(s.handleAdminToggleDownloadAccount))
-	mux.HandleFunc("/admin/download-accounts/create", s.requireAdmin(s.handleAdminCreateDownloadAccount))
-	mux.HandleFunc("/admin/download-accounts/edit", s.requireAdmin(s.handleAdminEditDownloadAccount))
-	mux.HandleFunc("/admin/download-accounts/delete", s.requireAdmin(s.handleAdminDeleteDownloadAccount))
-	mux.HandleFunc("/admin/files", s.requireAdmin(s.handleAdminFiles))
-	mux.HandleFunc("/admin/trash", s.requireAdmin(s.handleAdminTrash))
-	mux.HandleFunc("/admin/trash/restore", s.requireAdmin(s.handleAdminRestoreFile))
-	mux.HandleFunc("/admin/trash/delete", s.requireAdmin(s.handleAdminPermanentDelete))
-	mux.HandleFunc("/admin/branding", s.requireAdmin(s.handleAdminBranding))
-	mux.HandleFunc("/admin/settings", s.requireAdmin(s.handleAdminSettings))
-	mux.HandleFunc("/admin/email-settings", s.requireAdmin(s.handleEmailSettings))
-	mux.HandleFunc("/admin/teams", s.requireAdmin(s.handleAdminTeams))
-	mux.HandleFunc("/admin/reboot", s.requireAdmin(s.handleAdminReboot))
-	mux.HandleFunc("/admin/audit-logs", s.requireAdmin(s.handleAdminAuditLogs))
-	mux.HandleFunc("/api/v1/admin/audit-logs", s.requireAdmin(s.handleAPIGetAuditLogs))
-	mux.HandleFunc("/api/v1/admin/audit-logs/export", s.requireAdmin(s.handleAPIExportAuditLogs))
+	// Admin routes (require the matching permission of the user's role)
+	mux.HandleFunc("/admin", s.requirePermission(models.RolePermViewDashboard, s.handleAdminDashboard))
+	mux.HandleFunc("/admin/users", s.requirePermission(models.RolePermManageUsers, s.handleAdminUsers))
+	mux.HandleFunc("/admin/users/create", s.requirePermission(models.RolePermManageUsers, s.handleAdminUserCreate))
+	mux.HandleFunc("/admin/users/edit", s.requirePermission(models.RolePermManageUsers, s.handleAdminUserEdit))
+	mux.HandleFunc("/admin/users/delete", s.requirePermission(models.RolePermManageUsers, s.requireSudo(sudo.ActionDeleteUsers, s.handleAdminUserDelete)))
+	mux.HandleFunc("/admin/users/unlock", s.requirePermission(models.RolePermManageUsers, s.handleAdminUnlock))
+	mux.HandleFunc("/admin/users/passkeys/reset", s.requirePermission(models.RolePermManageUsers, s.requireSudo(sudo.ActionAccountSecurity, s.handleAdminResetPasskeys)))
+	mux.HandleFunc("/admin/users/sessions", s.requirePermission(models.RolePermManageUsers, s.handleAdminUserSessions))
+	mux.HandleFunc("/admin/users/sessions/revoke", s.requirePermission(models.RolePermManageUsers, s.handleAdminSessionRevoke))
+	mux.HandleFunc("/admin/users/impersonate", s.requirePermission(models.RolePermManageUsers, s.requireSudo(sudo.ActionImpersonate, s.handleAdminImpersonate)))
+	mux.HandleFunc("/impersonation/stop", s.handleImpersonationStop)
+	mux.HandleFunc("/admin/download-accounts/toggle", s.requirePermission(models.RolePermManageUsers, s.handleAdminToggleDownloadAccount))
+	mux.HandleFunc("/admin/download-accounts/create", s.requirePermission(models.RolePermManageUsers, s.handleAdminCreateDownloadAccount))
+	mux.HandleFunc("/admin/download-accounts/edit", s.requirePermission(models.RolePermManageUsers, s.handleAdminEditDownloadAccount))
+	mux.HandleFunc("/admin/download-accounts/delete", s.requirePermission(models.RolePermManageUsers, s.requireSudo(sudo.ActionDeleteUsers, s.handleAdminDeleteDownloadAccount)))
+	mux.HandleFunc("/admin/download-accounts/lifecycle", s.requirePermission(models.RolePermManageUsers, s.handleAdminDormantAccounts))
+	mux.HandleFunc("/admin/files", s.requirePermission(models.RolePermViewAllFiles, s.handleAdminFiles))
+	mux.HandleFunc("/admin/trash", s.requirePermission(models.RolePermManageAllFiles, s.handleAdminTrash))
+	mux.HandleFunc("/admin/trash/restore", s.requirePermission(models.RolePermManageAllFiles, s.handleAdminRestoreFile))
+	mux.HandleFunc("/admin/trash/delete", s.requirePermission(models.RolePermManageAllFiles, s.requireSudo(sudo.ActionPurgeFiles, s.handleAdminPermanentDelete)))
+	mux.HandleFunc("/admin/destruction-certificates", s.requirePermission(models.RolePermManageAllFiles, s.handleAdminDestructionCertificates))
+	mux.HandleFunc("/admin/destruction-certificates/export", s.requirePermission(models.RolePermManageAllFiles, s.handleAdminDestructionCertificateExport))
+	mux.HandleFunc("/admin/destruction-certificates/verify", s.requirePermission(models.RolePermManageAllFiles, s.handleAdminDestructionCertificateVerify))
+	mux.HandleFunc("/admin/branding", s.requirePermission(models.RolePermManageBranding, s.handleAdminBranding))
+	mux.HandleFunc("/admin/settings", s.requirePermission(models.RolePermManageSettings, s.requireSudo(sudo.ActionServerSettings, s.handleAdminSettings)))
+	mux.HandleFunc("/admin/email-settings", s.requirePermission(models.RolePermManageEmail, s.handleEmailSettings))
+	mux.HandleFunc("/admin/sso", s.requirePermission(models.RolePermManageSettings, s.requireSudo(sudo.ActionServerSettings, s.handleAdminSSO)))
+	mux.HandleFunc("/admin/sso/ldap", s.requirePermission(models.RolePermManageSettings, s.requireSudo(sudo.ActionServerSettings, s.handleAdminLDAP)))
+	mux.HandleFunc("/admin/sso/ldap/sync", s.requirePermission(models.RolePermManageSettings, s.requireSudo(sudo.ActionServerSettings, s.handleAdminLDAPSync)))
+	mux.HandleFunc("/admin/sso/scim", s.requirePermission(models.RolePermManageSettings, s.requireSudo(sudo.ActionServerSettings, s.handleAdminSCIM)))
+	mux.HandleFunc("/admin/sso/scim/token", s.requirePermission(models.RolePermManageSettings, s.requireSudo(sudo.ActionServerSettings, s.handleAdminSCIMToken)))
+	mux.HandleFunc("/admin/teams", s.requirePermission(models.RolePermManageTeams, s.handleAdminTeams))
+	mux.HandleFunc("/admin/reboot", s.requirePermission(models.RolePermManageSettings, s.requireSudo(sudo.ActionReboot, s.handleAdminReboot)))
+	mux.HandleFunc("/admin/roles", s.requirePermission(models.RolePermManageRoles, s.handleAdminRoles))
+	mux.HandleFunc("/admin/roles/create", s.requirePermission(models.RolePermManageRoles, s.requireSudo(sudo.ActionRoles, s.handleAdminRoleCreate)))
+	mux.HandleFunc("/admin/roles/edit", s.requirePermission(models.RolePermManageRoles, s.requireSudo(sudo.ActionRoles, s.handleAdminRoleEdit)))
+	mux.HandleFunc("/admin/roles/delete", s.requirePermission(models.RolePermManageRoles, s.requireSudo(sudo.ActionRoles, s.handleAdminRoleDelete)))
+	mux.HandleFunc("/admin/audit-logs", s.requirePermission(models.RolePermViewAuditLogs, s.handleAdminAuditLogs))
+	mux.HandleFunc("/api/v1/admin/audit-logs", s.requirePermission(models.RolePermViewAuditLogs, s.handleAPIGetAuditLogs))
+	mux.HandleFunc("/api/v1/admin/audit-logs/export", s.requirePermission(models.RolePermViewAuditLogs, s.handleAPIExportAuditLogs))
 
 	// Teams API routes (require authentication)
 	mux.HandleFunc("/api/teams/my", s.requireAuth(s.handleAPIMyTeams))
@@ -135,45 +184,52 @@ func (s *Server) Start() error {
 	mux.HandleFunc("/api/teams/unshare-file", s.requireAuth(s.handleAPIUnshareFileFromTeam))
 
 	// Teams Admin API routes (require admin)
-	mux.HandleFunc("/api/admin/teams/create", s.requireAdmin(s.handleAPITeamCreate))
-	mux.HandleFunc("/api/admin/teams/update", s.requireAdmin(s.handleAPITeamUpdate))
-	mux.HandleFunc("/api/admin/teams/delete", s.requireAdmin(s.handleAPITeamDelete))
-	mux.HandleFunc("/api/admin/users/list", s.requireAdmin(s.handleAPIUsersList))
+	mux.HandleFunc("/api/admin/teams/create", s.requirePermission(models.RolePermManageTeams, s.handleAPITeamCreate))
+	mux.HandleFunc("/api/admin/teams/update", s.requirePermission(models.RolePermManageTeams, s.handleAPITeamUpdate))
+	mux.HandleFunc("/api/admin/teams/delete", s.requirePermission(models.RolePermManageTeams, s.handleAPITeamDelete))
+	mux.HandleFunc("/api/admin/users/list", s.requirePermission(models.RolePermManageTeams, s.handleAPIUsersList))
 
 	// Email API routes
-	mux.HandleFunc("/api/email/configure", s.requireAuth(s.requireAdmin(s.handleEmailConfigure)))
-	mux.HandleFunc("/api/email/activate", s.requireAuth(s.requireAdmin(s.handleEmailActivate)))
-	mux.HandleFunc("/api/email/test", s.requireAuth(s.requireAdmin(s.handleEmailTest)))
-	mux.HandleFunc("/api/email/send-splash-link", s.requireAuth(s.handleSendSplashLink))
+	mux.HandleFunc("/api/email/configure", s.requirePermission(models.RolePermManageEmail, s.requireSudo(sudo.ActionEmailSettings, s.handleEmailConfigure)))
+	mux.HandleFunc("/api/email/activate", s.requirePermission(models.RolePermManageEmail, s.requireSudo(sudo.ActionEmailSettings, s.handleEmailActivate)))
+	mux.HandleFunc("/api/email/test", s.requirePermission(models.RolePermManageEmail, s.handleEmailTest))
+	mux.HandleFunc("/api/email/send-splash-link", s.requirePermission(models.RolePermShareExternally, s.handleSendSplashLink))
 
 	// API routes (legacy)
-	mux.HandleFunc("/api/v1/upload", s.requireAuth(s.handleAPIUpload))
+	mux.HandleFunc("/api/v1/upload", s.requirePermission(models.RolePermUpload, s.handleAPIUpload))
 	mux.HandleFunc("/api/v1/files", s.requireAuth(s.handleAPIFiles))
 	mux.HandleFunc("/api/v1/download/", s.handleAPIDownload)
 
+	// SCIM 2.0 provisioning (SCIM bearer token)
+	mux.HandleFunc("/scim/v2/", s.handleSCIM)
+
 	// User Management REST API (Admin only)
-	mux.HandleFunc("/api/v1/users/", s.requireAdmin(s.handleRESTUserRoutes))
-	mux.HandleFunc("/api/v1/users", s.requireAdmin(s.handleRESTUserRoutes))
+	mux.HandleFunc("/api/v1/users/", s.requirePermission(models.RolePermManageUsers, s.requireSudo(sudo.ActionDeleteUsers, s.handleRESTUserRoutes, http.MethodDelete)))
+	mux.HandleFunc("/api/v1/users", s.requirePermission(models.RolePermManageUsers, s.requireSudo(sudo.ActionDeleteUsers, s.handleRESTUserRoutes, http.MethodDelete)))
 
 	// File Management REST API
 	mux.HandleFunc("/api/v1/files/", s.requireAuth(s.handleRESTFileRoutes))
 
 	// Download Accounts REST API (Admin only)
-	mux.HandleFunc("/api/v1/download-accounts/", s.requireAdmin(s.handleRESTDownloadAccountRoutes))
-	mux.HandleFunc("/api/v1/download-accounts", s.requireAdmin(s.handleRESTDownloadAccountRoutes))
+	mux.HandleFunc("/api/v1/download-accounts/", s.requirePermission(models.RolePermManageUsers, s.requireSudo(sudo.ActionDeleteUsers, s.handleRESTDownloadAccountRoutes, http.MethodDelete)))
+	mux.HandleFunc("/api/v1/download-accounts", s.requirePermission(models.RolePermManageUsers, s.requireSudo(sudo.ActionDeleteUsers, s.handleRESTDownloadAccountRoutes, http.MethodDelete)))
 
 	// File Requests REST API
 	mux.HandleFunc("/api/v1/file-requests/", s.requireAuth(s.handleRESTFileRequestRoutes))
 	mux.HandleFunc("/api/v1/file-requests", s.requireAuth(s.handleRESTFileRequestRoutes))
 
+	// Roles REST API
+	mux.HandleFunc("/api/v1/roles/", s.requirePermission(models.RolePermManageRoles, s.requireSudo(sudo.ActionRoles, s.handleRESTRoleRoutes)))
+	mux.HandleFunc("/api/v1/roles", s.requirePermission(models.RolePermManageRoles, s.requireSudo(sudo.ActionRoles, s.handleRESTRoleRoutes)))
+
 	// Trash Management REST API (Admin only)
-	mux.HandleFunc("/api/v1/trash/", s.requireAdmin(s.handleRESTTrashRoutes))
-	mux.HandleFunc("/api/v1/trash", s.requireAdmin(s.handleRESTTrashRoutes))
+	mux.HandleFunc("/api/v1/trash/", s.requirePermission(models.RolePermManageAllFiles, s.requireSudo(sudo.ActionPurgeFiles, s.handleRESTTrashRoutes, http.MethodDelete)))
+	mux.HandleFunc("/api/v1/trash", s.requirePermission(models.RolePermManageAllFiles, s.requireSudo(sudo.ActionPurgeFiles, s.handleRESTTrashRoutes, http.MethodDelete)))
 
 	// Admin/System REST API
-	mux.HandleFunc("/api/v1/admin/stats", s.requireAdmin(s.handleAPIGetStats))
-	mux.HandleFunc("/api/v1/admin/branding", s.requireAdmin(s.handleRESTBrandingRoutes))
-	mux.HandleFunc("/api/v1/admin/settings", s.requireAdmin(s.handleRESTSettingsRoutes))
+	mux.HandleFunc("/api/v1/admin/stats", s.requirePermission(models.RolePermViewDashboard, s.handleAPIGetStats))
+	mux.HandleFunc("/api/v1/admin/branding", s.requirePermission(models.RolePermManageBranding, s.handleRESTBrandingRoutes))
+	mux.HandleFunc("/api/v1/admin/settings", s.requirePermission(models.RolePermManageSettings, s.requireSudo(sudo.ActionServerSettings, s.handleRESTSettingsRoutes)))
 
 	// Static files
 	fs := http.FileServer(http.Dir("web/static"))
@@ -214,22 +270,50 @@ func (s *Server) loggingMiddleware(next http.Handler) http.Handler {
 // Middleware: Require authentication
 func (s *Server) requireAuth(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		// REST clients authenticate with an API key instead of the session cookie
+		if token, ok := bearerToken(r); ok {
+			s.serveWithAPIKey(w, r, token, next)
+			return
+		}
+
 		cookie, err := r.Cookie("session")
 		if err != nil {
 			http.Redirect(w, r, "/login?redirect="+r.URL.Path, http.StatusSeeOther)
 			return
 		}
 
+		// A super admin viewing the app as a user returns to their own session when it ends
+		imp, _ := database.DB.GetSessionImpersonation(cookie.Value)
+		if imp != nil && time.Now().Unix() > imp.ValidUntil {
+			s.endImpersonation(w, r, cookie.Value, imp, "expired")
+			http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+			return
+		}
+
+		// Read the session before looking up the user marks it as used
+		session, _ := database.DB.GetSession(cookie.Value)
+
 		user, err := s.getUserFromSession(r)
 		if err != nil {
+			if s.restoreImpersonator(w, r) {
+				http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+				return
+			}
 			http.Redirect(w, r, "/login?redirect="+r.URL.Path, http.StatusSeeOther)
 			return
 		}
 
-		// Check for inactivity timeout (10 minutes), but only if no active transfer
-		if !s.hasActiveTransfer(cookie.Value) {
-			timeSinceLastActivity := time.Since(time.Unix(user.LastOnline, 0))
-			if timeSinceLastActivity > auth.InactivityTimeout {
+		// The user's own inactivity timeout and enrollment requirements do not apply
+		// to a super admin viewing the app as them
+		if imp != nil {
+			s.serveImpersonated(w, r, cookie.Value, user, imp, next)
+			return
+		}
+
+		// Check for the inactivity timeout of the user's role, but only if no active
+		// transfer. Each session idles on its own; remembered devices don't time out.
+		if session != nil && !session.Remembered && !s.hasActiveTransfer(cookie.Value) {
+			if sessionpolicy.LoadPolicy().For(user).Idle(sessionLastSeen(session, user), time.Now()) {
 				// Force logout due to inactivity
 				auth.DeleteSession(cookie.Value)
 				http.SetCookie(w, &http.Cookie{
@@ -244,45 +328,22 @@ func (s *Server) requireAuth(next http.HandlerFunc) http.HandlerFunc {
 			}
 		}
 
-		// Store user in context (simple approach: we'll pass it via request context)
-		r = r.WithContext(contextWithUser(r.Context(), user))
-		next(w, r)
-	}
-}
-
-// Middleware: Require admin authentication
-func (s *Server) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		cookie, err := r.Cookie("session")
-		if err != nil {
-			http.Error(w, "Forbidden", http.StatusForbidden)
+		// Users whose role requires a passkey must register one first
+		if s.requirePasskeyEnrollment(w, r, user) {
 			return
 		}
 
-		user, err := s.getUserFromSession(r)
-		if err != nil || !user.IsAdmin() {
-			http.Error(w, "Forbidden", http.StatusForbidden)
+		// Users whose role requires 2FA are blocked once their grace period is over
+		if s.requireMFAEnrollment(w, r, user) {
 			return
 		}
 
-		// Check for inactivity timeout (10 minutes), but only if no active transfer
-		if !s.hasActiveTransfer(cookie.Value) {
-			timeSinceLastActivity := time.Since(time.Unix(user.LastOnline, 0))
-			if timeSinceLastActivity > auth.InactivityTimeout {
-				// Force logout due to inactivity
-				auth.DeleteSession(cookie.Value)
-				http.SetCookie(w, &http.Cookie{
-					Name:     "session",
-					Value:    "",
-					Path:     "/",
-					MaxAge:   -1,
-					HttpOnly: true,
-				})
-				http.Redirect(w, r, "/login?timeout=1", http.StatusSeeOther)
-				return
-			}
+		// Users whose password has expired must change it first
+		if s.requirePasswordChange(w, r, user) {
+			return
 		}
 
+		// Store user in context (simple approach: we'll pass it via request context)
 		r = r.WithContext(contextWithUser(r.Context(), user))
 		next(w, r)
 	}
@@ -379,12 +440,28 @@ func (s *Server) getPublicURL() string {
 	return serverURL + ":" + port
 }
 
-// handleHealth is a health check endpoint
+// handleHealth is a health check endpoint. Anyone only learns whether disk space
+// is low; the volumes and their free space are shown to users who may view the dashboard.
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	status := "healthy"
+	diskLevel, volumes := storage.DiskStatus()
+	if diskLevel != storage.DiskStatusOK {
+		status = "degraded"
+	}
+
+	disk := map[string]interface{}{"status": storage.DiskStatusOK}
+	if user, err := s.getUserFromSession(r); err == nil && hasPermission(user, models.RolePermViewDashboard) {
+		disk["status"] = diskLevel
+		disk["volumes"] = volumes
+	} else if diskLevel != storage.DiskStatusOK {
+		disk["status"] = storage.DiskStatusLow
+	}
+
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{
-		"status":  "healthy",
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  status,
 		"version": s.config.Version,
+		"disk":    disk,
 	})
 }
 
@@ -399,11 +476,7 @@ func (s *Server) handleHome(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Logged in, redirect to dashboard
-	if user.IsAdmin() {
-		http.Redirect(w, r, "/admin", http.StatusSeeOther)
-	} else {
-		http.Redirect(w, r, "/dashboard", http.StatusSeeOther)
-	}
+	http.Redirect(w, r, homePath(user), http.StatusSeeOther)
 }
 
 // renderTemplate is a helper to render templates (we'll implement simple HTML for now)
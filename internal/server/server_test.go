@@ -0,0 +1,687 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Frimurare/WulfVault/internal/auth"
+	"github.com/Frimurare/WulfVault/internal/config"
+	"github.com/Frimurare/WulfVault/internal/database"
+	"github.com/Frimurare/WulfVault/internal/loginalerts"
+	"github.com/Frimurare/WulfVault/internal/models"
+	"github.com/Frimurare/WulfVault/internal/oidc"
+	"github.com/Frimurare/WulfVault/internal/storage"
+)
+
+func newTestServer(t *testing.T) *Server {
+	dir := t.TempDir()
+	if err := database.Initialize(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.DB.Close() })
+
+	cfg, err := config.LoadOrCreate(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.UploadsDir = t.TempDir()
+	return New(cfg)
+}
+
+// responseCookie returns a cookie set by a response, or nil
+func responseCookie(rec *httptest.ResponseRecorder, name string) *http.Cookie {
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == name {
+			return cookie
+		}
+	}
+	return nil
+}
+
+func TestOIDCCallbackRequiresStateCookie(t *testing.T) {
+	s := newTestServer(t)
+
+	// The IdP only needs to be discoverable; its token endpoint rejects every code
+	var idp *httptest.Server
+	idp = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/.well-known/openid-configuration" {
+			http.Error(w, "invalid_grant", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.URL,
+			"authorization_endpoint": idp.URL + "/authorize",
+			"token_endpoint":         idp.URL + "/token",
+			"jwks_uri":               idp.URL + "/jwks",
+		})
+	}))
+	defer idp.Close()
+
+	database.DB.SetConfigValue("oidc_enabled", "true")
+	database.DB.SetConfigValue("oidc_issuer", idp.URL)
+	database.DB.SetConfigValue("oidc_client_id", "wulfvault")
+
+	startLogin := func() (string, *http.Cookie) {
+		rec := httptest.NewRecorder()
+		s.handleOIDCLogin(rec, httptest.NewRequest(http.MethodGet, "/auth/oidc/login", nil))
+		if rec.Code != http.StatusFound {
+			t.Fatalf("login start: status %d", rec.Code)
+		}
+		loc, err := url.Parse(rec.Header().Get("Location"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cookie := responseCookie(rec, oidcStateCookie)
+		if cookie == nil || !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode {
+			t.Fatalf("login start set no HttpOnly, Lax state cookie: %+v", cookie)
+		}
+		return loc.Query().Get("state"), cookie
+	}
+
+	callback := func(state string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/auth/oidc/callback?code=attacker-code&state="+url.QueryEscape(state), nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		s.handleOIDCCallback(rec, req)
+		return rec
+	}
+
+	// A callback URL from someone else's login is refused before the state is used
+	state, cookie := startLogin()
+	_, otherCookie := startLogin()
+	for name, c := range map[string]*http.Cookie{"missing": nil, "mismatched": otherCookie} {
+		rec := callback(state, c)
+		if responseCookie(rec, "session") != nil {
+			t.Errorf("%s state cookie: session created", name)
+		}
+		if cleared := responseCookie(rec, oidcStateCookie); cleared == nil || cleared.MaxAge >= 0 {
+			t.Errorf("%s state cookie: state cookie not cleared", name)
+		}
+	}
+	if _, err := oidc.TakeAuthRequest(state); err != nil {
+		t.Errorf("rejected callbacks consumed the login state: %v", err)
+	}
+
+	// The browser that started the login gets past the check to the code exchange
+	state, cookie = startLogin()
+	rec := callback(state, cookie)
+	if responseCookie(rec, "session") != nil {
+		t.Error("session created although the token exchange failed")
+	}
+	if _, err := oidc.TakeAuthRequest(state); err == nil {
+		t.Error("matching state cookie did not reach the code exchange")
+	}
+}
+
+func TestPendingLoginCookieIsSigned(t *testing.T) {
+	s := newTestServer(t)
+
+	victim := &models.User{Name: "Victim", Email: "victim@example.com", UserLevel: models.UserLevelUser, IsActive: true}
+	if err := database.DB.CreateUser(victim); err != nil {
+		t.Fatal(err)
+	}
+	other := &models.User{Name: "Other", Email: "other@example.com", UserLevel: models.UserLevelUser, IsActive: true}
+	if err := database.DB.CreateUser(other); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().Unix()
+	valid, err := encodePendingLogin(&pendingLogin{UserID: other.Id, CreatedAt: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, mac, _ := strings.Cut(valid, ".")
+	forgedJSON, _ := json.Marshal(&pendingLogin{UserID: victim.Id, CreatedAt: now})
+	forged := base64.StdEncoding.EncodeToString(forgedJSON)
+
+	passkeyBegin := func(value string) int {
+		req := httptest.NewRequest(http.MethodPost, "/2fa/passkey/begin", nil)
+		req.AddCookie(&http.Cookie{Name: "totp_pending", Value: value})
+		rec := httptest.NewRecorder()
+		s.handle2FAPasskeyBegin(rec, req)
+		return rec.Code
+	}
+
+	// Without a valid signature the password step counts as not done
+	for name, value := range map[string]string{
+		"unsigned":      forged,
+		"bad signature": forged + ".00",
+		"other's mac":   forged + "." + mac,
+	} {
+		if code := passkeyBegin(value); code != http.StatusUnauthorized {
+			t.Errorf("%s cookie: passkey step started with status %d", name, code)
+		}
+	}
+
+	if code := passkeyBegin(valid); code == http.StatusUnauthorized {
+		t.Error("signed cookie rejected by the passkey step")
+	}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(&http.Cookie{Name: "totp_pending", Value: valid})
+	user, err := pendingLoginUser(req)
+	if err != nil || user.Id != other.Id {
+		t.Fatalf("signed cookie rejected: %v", err)
+	}
+}
+
+func TestIdleTimeoutPerSession(t *testing.T) {
+	s := newTestServer(t)
+
+	user := &models.User{Name: "Anna", Email: "anna@example.com", UserLevel: models.UserLevelUser, IsActive: true}
+	if err := database.DB.CreateUser(user); err != nil {
+		t.Fatal(err)
+	}
+	idle, err := auth.CreateSession(user.Id, "198.51.100.7", "laptop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	active, err := auth.CreateSession(user.Id, "203.0.113.4", "phone")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The laptop was last used an hour ago; the phone is in use right now
+	if _, err := database.DB.Exec("UPDATE Sessions SET LastSeen = ? WHERE Id = ?", time.Now().Add(-time.Hour).Unix(), idle); err != nil {
+		t.Fatal(err)
+	}
+	database.DB.UpdateUserLastOnline(user.Id)
+
+	handler := s.requireAuth(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	get := func(sessionId string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/dashboard", nil)
+		req.AddCookie(&http.Cookie{Name: "session", Value: sessionId})
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec
+	}
+
+	if rec := get(active); rec.Code != http.StatusNoContent {
+		t.Fatalf("active session: status %d, location %q", rec.Code, rec.Header().Get("Location"))
+	}
+	if rec := get(idle); rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/login?timeout=1" {
+		t.Errorf("idle session kept alive by another device: status %d, location %q", rec.Code, rec.Header().Get("Location"))
+	}
+	if _, err := database.DB.GetSession(idle); err == nil {
+		t.Error("idle session was not deleted")
+	}
+	if rec := get(active); rec.Code != http.StatusNoContent {
+		t.Errorf("active session signed out with the idle one: status %d", rec.Code)
+	}
+}
+
+func TestDirectDownloadRequiresFilePassword(t *testing.T) {
+	s := newTestServer(t)
+	database.DB.SetConfigValue(configDownloadEmailVerification, "false")
+
+	owner := &models.User{Name: "Owner", Email: "owner@example.com", UserLevel: models.UserLevelUser, IsActive: true}
+	if err := database.DB.CreateUser(owner); err != nil {
+		t.Fatal(err)
+	}
+	passwordHash, err := database.HashFilePassword("file-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := &database.FileInfo{
+		Id: "0123abcd0123abcd", Name: "report.pdf", SizeBytes: 6, ContentType: "application/pdf",
+		PasswordHash: passwordHash, RequireAuth: true, UnlimitedDownloads: true, UnlimitedTime: true,
+		UserId: owner.Id, UploadDate: time.Now().Unix(),
+	}
+	if err := database.DB.SaveFile(file); err != nil {
+		t.Fatal(err)
+	}
+	path, err := storage.CreatePath(s.config.UploadsDir, file.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// An account made for some other file signs in and presents its own session for this one
+	account, err := auth.CreateDownloadAccount("attacker@example.com", "Attacker123!")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessionId, err := auth.CreateDownloadAccountSession(account.Id, "198.51.100.7", "test", database.DownloadAuthPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	downloadFrom := func(remoteAddr string, grant *http.Cookie) string {
+		req := httptest.NewRequest(http.MethodGet, "/d/"+file.Id+"?direct=1", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-For", "198.51.100.7")
+		req.AddCookie(&http.Cookie{Name: "download_session_" + file.Id, Value: sessionId})
+		if grant != nil {
+			req.AddCookie(grant)
+		}
+		rec := httptest.NewRecorder()
+		s.handleDownload(rec, req)
+		body, _ := io.ReadAll(rec.Body)
+		return string(body)
+	}
+	download := func(grant *http.Cookie) string {
+		return downloadFrom("198.51.100.7:4321", grant)
+	}
+
+	if body := download(nil); body == "secret" {
+		t.Fatal("direct download skipped the file password")
+	}
+
+	// With a grant from entering the password the direct download works
+	rec := httptest.NewRecorder()
+	grantReq := httptest.NewRequest(http.MethodPost, "/d/"+file.Id, nil)
+	grantReq.RemoteAddr = "198.51.100.7:4321"
+	if err := s.issueFilePasswordGrant(rec, grantReq, file); err != nil {
+		t.Fatal(err)
+	}
+	grant := responseCookie(rec, filePasswordGrantCookie(file.Id))
+	if body := download(grant); body != "secret" {
+		t.Fatalf("direct download with a password grant failed: %q", body)
+	}
+
+	// A stolen grant is bound to the client address, which a header cannot fake
+	if body := downloadFrom("203.0.113.9:4321", grant); body == "secret" {
+		t.Error("grant accepted from another address with a forged X-Forwarded-For")
+	}
+
+	// Changing the password invalidates the grant
+	if err := database.DB.UpdateFilePassword(file.Id, "new-secret"); err != nil {
+		t.Fatal(err)
+	}
+	if body := download(grant); body == "secret" {
+		t.Error("grant still valid after the password changed")
+	}
+}
+
+func TestLoginDeviceIgnoresForgedAddress(t *testing.T) {
+	s := newTestServer(t)
+
+	user := &models.User{Name: "Anna", Email: "anna@example.com", UserLevel: models.UserLevelUser, IsActive: true}
+	if err := database.DB.CreateUser(user); err != nil {
+		t.Fatal(err)
+	}
+	// Sign-ins are audited either way; don't try to email the alerts
+	database.DB.SetConfigValue(loginalerts.ConfigEnabled, "false")
+
+	signIn := func(remoteAddr string) {
+		req := httptest.NewRequest(http.MethodPost, "/login", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:128.0) Gecko/20100101 Firefox/128.0")
+		req.Header.Set("X-Forwarded-For", "198.51.100.7")
+		s.checkLoginDevice(req, user)
+	}
+
+	// The usual address, then an attacker claiming it in a header
+	signIn("198.51.100.7:4321")
+	signIn("203.0.113.9:4321")
+
+	n, err := database.DB.GetAuditLogCount(&database.AuditLogFilter{Action: database.ActionNewDeviceLogin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("got %d new-device sign-ins, want 1", n)
+	}
+}
+
+func TestSecurityActivityExcludesDownloadAccounts(t *testing.T) {
+	s := newTestServer(t)
+
+	user := &models.User{Name: "Anna", Email: "anna@example.com", UserLevel: models.UserLevelUser, IsActive: true}
+	if err := database.DB.CreateUser(user); err != nil {
+		t.Fatal(err)
+	}
+	account, err := auth.CreateDownloadAccount("recipient@example.com", "Recipient123!")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.Id != user.Id {
+		database.DB.Exec("UPDATE DownloadAccounts SET Id = ? WHERE Id = ?", user.Id, account.Id)
+		account.Id = user.Id
+	}
+
+	database.DB.LogAction(&database.AuditLogEntry{
+		UserID: int64(user.Id), UserEmail: user.Email, Action: database.ActionLoginSuccess,
+		EntityType: database.EntitySession, IPAddress: "198.51.100.7", Success: true,
+	})
+	database.DB.LogAction(&database.AuditLogEntry{
+		UserID: int64(account.Id), UserEmail: account.Email, Action: database.ActionSessionRevoked,
+		EntityType: database.EntityDownloadAccount, IPAddress: "203.0.113.9", Success: true,
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/settings/security-activity", nil)
+	req = req.WithContext(contextWithUser(req.Context(), user))
+	rec := httptest.NewRecorder()
+	s.handleSecurityActivity(rec, req)
+
+	var result struct {
+		Events []struct {
+			Action    string `json:"action"`
+			IPAddress string `json:"ip_address"`
+		} `json:"events"`
+		Total int `json:"total"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Total != 1 || len(result.Events) != 1 || result.Events[0].Action != database.ActionLoginSuccess {
+		t.Errorf("got %d events (%+v), want only the user's own sign-in", result.Total, result.Events)
+	}
+}
+
+func TestRoleAntiEscalation(t *testing.T) {
+	newTestServer(t)
+
+	manager := &models.Role{Name: "User Manager", Permissions: models.RolePermBasic | models.RolePermManageUsers | models.RolePermManageRoles}
+	if err := database.DB.CreateRole(manager); err != nil {
+		t.Fatal(err)
+	}
+	newUser := func(name string, level models.UserRank, roleId int) *models.User {
+		user := &models.User{Name: name, Email: strings.ToLower(name) + "@example.com", UserLevel: level, IsActive: true}
+		if err := database.DB.CreateUser(user); err != nil {
+			t.Fatal(err)
+		}
+		role, err := database.DB.GetRole(roleId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := database.DB.SetUserRole(user, role); err != nil {
+			t.Fatal(err)
+		}
+		return user
+	}
+	owner := newUser("Owner", models.UserLevelSuperAdmin, models.RoleIdAdministrator)
+	admin := newUser("Admin", models.UserLevelAdmin, models.RoleIdAdministrator)
+	lead := newUser("Lead", models.UserLevelAdmin, manager.Id)
+	staff := newUser("Staff", models.UserLevelUser, models.RoleIdUser)
+
+	grants := []struct {
+		name        string
+		actor       *models.User
+		permissions models.RolePermission
+		want        bool
+	}{
+		{"own permissions", lead, models.RolePermManageUsers | models.RolePermUpload, true},
+		{"permission the actor lacks", lead, models.RolePermManageSettings, false},
+		{"mixed with one the actor lacks", lead, models.RolePermManageUsers | models.RolePermViewAuditLogs, false},
+		{"no permissions", staff, models.RolePermNone, true},
+		{"regular user granting admin", staff, models.RolePermManageUsers, false},
+		{"administrator grants all", admin, models.RolePermAll, true},
+		{"super admin grants all", owner, models.RolePermAll, true},
+	}
+	for _, tt := range grants {
+		if got := canGrant(tt.actor, tt.permissions); got != tt.want {
+			t.Errorf("canGrant %s: got %v, want %v", tt.name, got, tt.want)
+		}
+
+		role := &models.Role{Name: "Role " + tt.name, Permissions: tt.permissions}
+		if err := validateRole(tt.actor, role); (err == nil) != tt.want {
+			t.Errorf("validateRole %s: got %v, want allowed %v", tt.name, err, tt.want)
+		}
+	}
+
+	manage := []struct {
+		name   string
+		actor  *models.User
+		target *models.User
+		want   bool
+	}{
+		{"lower role", lead, staff, true},
+		{"same role", lead, lead, true},
+		{"role that outranks the actor", lead, admin, false},
+		{"administrator edits manager", admin, lead, true},
+		{"administrator edits super admin", admin, owner, false},
+		{"manager edits super admin", lead, owner, false},
+		{"super admin edits itself", owner, owner, true},
+		{"super admin edits administrator", owner, admin, true},
+	}
+	for _, tt := range manage {
+		if got := canManageUser(tt.actor, tt.target); got != tt.want {
+			t.Errorf("canManageUser %s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	assign := []struct {
+		name   string
+		actor  *models.User
+		target *models.User
+		roleId int
+		want   bool
+	}{
+		{"role the actor can grant", lead, staff, manager.Id, true},
+		{"role with permissions the actor lacks", lead, staff, models.RoleIdAdministrator, false},
+		{"administrator promotes", admin, staff, models.RoleIdAdministrator, true},
+	}
+	for _, tt := range assign {
+		req := httptest.NewRequest(http.MethodPost, "/admin/users/edit", nil)
+		before, _ := database.DB.GetUserRoleId(tt.target)
+		err := assignRole(req, tt.actor, tt.target, tt.roleId)
+		if (err == nil) != tt.want {
+			t.Errorf("assignRole %s: got %v, want allowed %v", tt.name, err, tt.want)
+		}
+		after, _ := database.DB.GetUserRoleId(tt.target)
+		if !tt.want && after != before {
+			t.Errorf("assignRole %s: role changed to %d although refused", tt.name, after)
+		}
+	}
+
+	// Nobody changes their own role, not even to a lesser one
+	s := &Server{}
+	body := `{"name":"Lead","email":"lead@example.com","roleId":2,"isActive":true}`
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/users/"+strconv.Itoa(lead.Id), strings.NewReader(body))
+	req = req.WithContext(contextWithUser(req.Context(), lead))
+	rec := httptest.NewRecorder()
+	s.handleAPIUpdateUser(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("changing own role: got status %d, want %d", rec.Code, http.StatusForbidden)
+	}
+	if roleId, _ := database.DB.GetUserRoleId(lead); roleId != manager.Id {
+		t.Errorf("own role changed to %d", roleId)
+	}
+}
+
+func TestDownloadEmailVerification(t *testing.T) {
+	s := newTestServer(t)
+
+	owner := &models.User{Name: "Owner", Email: "owner@example.com", UserLevel: models.UserLevelUser, IsActive: true}
+	if err := database.DB.CreateUser(owner); err != nil {
+		t.Fatal(err)
+	}
+	file := &database.FileInfo{
+		Id: "4567cdef4567cdef", Name: "report.pdf", SizeBytes: 6, ContentType: "application/pdf",
+		RequireAuth: true, UnlimitedDownloads: true, UnlimitedTime: true,
+		UserId: owner.Id, UploadDate: time.Now().Unix(),
+	}
+	if err := database.DB.SaveFile(file); err != nil {
+		t.Fatal(err)
+	}
+	path, err := storage.CreatePath(s.config.UploadsDir, file.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	account, err := auth.CreateDownloadAccount("recipient@example.com", "Recipient123!")
+	if err != nil {
+		t.Fatal(err)
+	}
+	verified := func(accountId int) bool {
+		account, err := database.DB.GetDownloadAccountByID(accountId)
+		return err == nil && account.IsEmailVerified()
+	}
+	expire := func(accountId int) {
+		database.DB.Exec("UPDATE DownloadAccountVerifications SET ExpiresAt = ? WHERE AccountId = ?", time.Now().Add(-time.Minute).Unix(), accountId)
+	}
+	request := func(method, target string, form url.Values, session string) *httptest.ResponseRecorder {
+		var body io.Reader
+		if form != nil {
+			body = strings.NewReader(form.Encode())
+		}
+		req := httptest.NewRequest(method, target, body)
+		if form != nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		if session != "" {
+			req.AddCookie(&http.Cookie{Name: "download_session_" + file.Id, Value: session})
+		}
+		rec := httptest.NewRecorder()
+		if strings.HasPrefix(target, "/download/verify") {
+			s.handleDownloadVerifyLink(rec, req)
+		} else {
+			s.handleDownload(rec, req)
+		}
+		return rec
+	}
+
+	// An unverified account gets nothing, with a session or by signing in
+	sessionId, err := auth.CreateDownloadAccountSession(account.Id, "198.51.100.7", "test", database.DownloadAuthPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, target := range []string{"/d/" + file.Id, "/d/" + file.Id + "?direct=1"} {
+		if rec := request(http.MethodGet, target, nil, sessionId); rec.Body.String() == "secret" {
+			t.Errorf("%s: unverified account downloaded the file", target)
+		}
+	}
+	rec := request(http.MethodPost, "/d/"+file.Id, url.Values{"email": {account.Email}, "password": {"Recipient123!"}}, "")
+	if rec.Body.String() == "secret" || responseCookie(rec, "download_session_"+file.Id) != nil {
+		t.Fatal("unverified account signed in for the download")
+	}
+
+	submitCode := func(code string) *httptest.ResponseRecorder {
+		return request(http.MethodPost, "/d/"+file.Id, url.Values{"email": {account.Email}, "verification_code": {code}}, "")
+	}
+
+	// An expired code is refused
+	code, _, err := database.DB.CreateDownloadAccountVerification(account.Id, file.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expire(account.Id)
+	if rec := submitCode(code); !strings.Contains(rec.Body.String(), "has expired") || verified(account.Id) {
+		t.Fatal("expired code accepted")
+	}
+
+	// A wrong code is refused, the right one verifies and signs in
+	code, _, err = database.DB.CreateDownloadAccountVerification(account.Id, file.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec := submitCode("12345"); !strings.Contains(rec.Body.String(), "Incorrect verification code") || verified(account.Id) {
+		t.Fatal("wrong code accepted")
+	}
+	rec = submitCode(code)
+	session := responseCookie(rec, "download_session_"+file.Id)
+	if !verified(account.Id) || session == nil {
+		t.Fatal("correct code did not verify and sign in")
+	}
+
+	// A code works only once
+	rec = submitCode(code)
+	if !strings.Contains(rec.Body.String(), "No verification is pending") || responseCookie(rec, "download_session_"+file.Id) != nil {
+		t.Error("verification code reused")
+	}
+
+	if rec := request(http.MethodGet, "/d/"+file.Id, nil, session.Value); rec.Body.String() != "secret" {
+		t.Errorf("verified account could not download: %q", rec.Body.String())
+	}
+
+	// The emailed link follows the same rules
+	other, err := auth.CreateDownloadAccount("other@example.com", "Other12345!")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, token, err := database.DB.CreateDownloadAccountVerification(other.Id, file.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expire(other.Id)
+	if rec := request(http.MethodGet, "/download/verify?token="+token, nil, ""); rec.Code != http.StatusBadRequest || verified(other.Id) {
+		t.Fatalf("expired link: got status %d", rec.Code)
+	}
+
+	_, token, err = database.DB.CreateDownloadAccountVerification(other.Id, file.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec = request(http.MethodGet, "/download/verify?token="+token, nil, "")
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/d/"+file.Id || !verified(other.Id) {
+		t.Fatalf("verification link: got status %d to %q", rec.Code, rec.Header().Get("Location"))
+	}
+	if rec := request(http.MethodGet, "/download/verify?token="+token, nil, ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("verification link reused: got status %d", rec.Code)
+	}
+}
+
+func TestHealthHidesDiskFigures(t *testing.T) {
+	s := newTestServer(t)
+	storage.CheckDiskSpace(s.config.UploadsDir, t.TempDir())
+
+	newSession := func(name string, level models.UserRank) string {
+		user := &models.User{Name: name, Email: strings.ToLower(name) + "@example.com", UserLevel: level, IsActive: true}
+		if err := database.DB.CreateUser(user); err != nil {
+			t.Fatal(err)
+		}
+		sessionId, err := auth.CreateSession(user.Id, "198.51.100.7", "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sessionId
+	}
+
+	tests := []struct {
+		name    string
+		session string
+		figures bool
+	}{
+		{"anonymous", "", false},
+		{"regular user", newSession("Staff", models.UserLevelUser), false},
+		{"administrator", newSession("Admin", models.UserLevelAdmin), true},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/health", nil)
+		if tt.session != "" {
+			req.AddCookie(&http.Cookie{Name: "session", Value: tt.session})
+		}
+		rec := httptest.NewRecorder()
+		s.handleHealth(rec, req)
+
+		var result struct {
+			Status string `json:"status"`
+			Disk   struct {
+				Status  string                 `json:"status"`
+				Volumes []storage.VolumeStatus `json:"volumes"`
+			} `json:"disk"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&result); err != nil {
+			t.Fatal(err)
+		}
+		if got := len(result.Disk.Volumes) > 0; got != tt.figures {
+			t.Errorf("%s: disk figures shown %v, want %v", tt.name, got, tt.figures)
+		}
+		if !tt.figures && result.Disk.Status != storage.DiskStatusOK && result.Disk.Status != storage.DiskStatusLow {
+			t.Errorf("%s: disk status %q, want ok or low", tt.name, result.Disk.Status)
+		}
+	}
+}
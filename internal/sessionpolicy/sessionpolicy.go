@@ -0,0 +1,173 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+// Package sessionpolicy decides how long sign-ins last. Sessions end a fixed
+// time after signing in (the lifetime) and after a period without use (the idle
+// timeout). Both are set globally and can be overridden per role. Users can
+// optionally have a device remembered, which gives the session its own, longer
+// lifetime and no idle timeout.
+package sessionpolicy
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/Frimurare/WulfVault/internal/database"
+	"github.com/Frimurare/WulfVault/internal/models"
+)
+
+// Configuration keys of the global policy. The overrides of a role are stored on the role itself.
+const (
+	ConfigLifetimeHours = "session_lifetime_hours"
+	ConfigIdleMinutes   = "session_idle_minutes"
+	ConfigRememberDays  = "session_remember_days"
+)
+
+// Defaults and bounds
+const (
+	DefaultLifetimeHours = 24
+	DefaultIdleMinutes   = 10
+	DefaultRememberDays  = 0
+	MaxLifetimeHours     = 720
+	MaxIdleMinutes       = 1440
+	MaxRememberDays      = 365
+)
+
+// Policy says how long sessions last
+type Policy struct {
+	LifetimeHours int
+	IdleMinutes   int // 0 = sessions don't expire when idle
+	RememberDays  int // 0 = "Remember this device" is not offered
+}
+
+// Limits are the lifetime and idle timeout that apply to a session
+type Limits struct {
+	Lifetime    time.Duration
+	IdleTimeout time.Duration // 0 = no idle timeout
+}
+
+// Idle reports whether a session last used at lastSeen has gone idle at now
+func (l Limits) Idle(lastSeen int64, now time.Time) bool {
+	return l.IdleTimeout > 0 && now.Sub(time.Unix(lastSeen, 0)) > l.IdleTimeout
+}
+
+// LoadPolicy reads the policy from the Configuration table, applying defaults for unset values
+func LoadPolicy() *Policy {
+	get := func(key string, fallback int) int {
+		value, err := database.DB.GetConfigValue(key)
+		if err != nil || value == "" {
+			return fallback
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fallback
+		}
+		return n
+	}
+	p := &Policy{
+		LifetimeHours: get(ConfigLifetimeHours, DefaultLifetimeHours),
+		IdleMinutes:   get(ConfigIdleMinutes, DefaultIdleMinutes),
+		RememberDays:  get(ConfigRememberDays, DefaultRememberDays),
+	}
+	p.clamp()
+	return p
+}
+
+// Save stores the policy
+func (p *Policy) Save() error {
+	p.clamp()
+	if err := database.DB.SetConfigValue(ConfigLifetimeHours, strconv.Itoa(p.LifetimeHours)); err != nil {
+		return err
+	}
+	if err := database.DB.SetConfigValue(ConfigIdleMinutes, strconv.Itoa(p.IdleMinutes)); err != nil {
+		return err
+	}
+	return database.DB.SetConfigValue(ConfigRememberDays, strconv.Itoa(p.RememberDays))
+}
+
+// AdoptConfigLifetime takes over the session timeout of the configuration file
+// as the global lifetime, unless one was set in the admin settings
+func AdoptConfigLifetime(hours int) error {
+	if hours <= 0 || hours == DefaultLifetimeHours {
+		return nil
+	}
+	if value, err := database.DB.GetConfigValue(ConfigLifetimeHours); err == nil && value != "" {
+		return nil
+	}
+	return database.DB.SetConfigValue(ConfigLifetimeHours, strconv.Itoa(clamp(hours, 1, MaxLifetimeHours, DefaultLifetimeHours)))
+}
+
+// Global returns the limits of users without role overrides and of download accounts
+func (p *Policy) Global() Limits {
+	return Limits{
+		Lifetime:    time.Duration(p.LifetimeHours) * time.Hour,
+		IdleTimeout: time.Duration(p.IdleMinutes) * time.Minute,
+	}
+}
+
+// ForRole returns the limits of the members of a role
+func (p *Policy) ForRole(role *models.Role) Limits {
+	limits := p.Global()
+	if role == nil {
+		return limits
+	}
+	if role.SessionLifetimeHours > 0 {
+		limits.Lifetime = time.Duration(role.SessionLifetimeHours) * time.Hour
+	}
+	if role.SessionIdleMinutes > 0 {
+		limits.IdleTimeout = time.Duration(role.SessionIdleMinutes) * time.Minute
+	}
+	return limits
+}
+
+// For returns the limits of a user's sessions
+func (p *Policy) For(user *models.User) Limits {
+	return p.ForRole(userRole(user))
+}
+
+// RememberForRole returns the lifetime of a remembered session of a member of a
+// role, 0 if members can't have their device remembered. Roles with their own
+// limits don't get remembered sessions, as those would bypass the limits.
+func (p *Policy) RememberForRole(role *models.Role) time.Duration {
+	if p.RememberDays == 0 {
+		return 0
+	}
+	if role != nil && (role.SessionLifetimeHours > 0 || role.SessionIdleMinutes > 0) {
+		return 0
+	}
+	return time.Duration(p.RememberDays) * 24 * time.Hour
+}
+
+// RememberFor returns the lifetime of a remembered session of a user, 0 if the
+// user can't have their device remembered
+func (p *Policy) RememberFor(user *models.User) time.Duration {
+	return p.RememberForRole(userRole(user))
+}
+
+func userRole(user *models.User) *models.Role {
+	role, err := database.DB.GetUserRole(user)
+	if err != nil {
+		log.Printf("Warning: failed to load role of user %d: %v", user.Id, err)
+		return nil
+	}
+	return role
+}
+
+func (p *Policy) clamp() {
+	p.LifetimeHours = clamp(p.LifetimeHours, 1, MaxLifetimeHours, DefaultLifetimeHours)
+	p.IdleMinutes = clamp(p.IdleMinutes, 0, MaxIdleMinutes, DefaultIdleMinutes)
+	p.RememberDays = clamp(p.RememberDays, 0, MaxRememberDays, DefaultRememberDays)
+}
+
+func clamp(n, min, max, fallback int) int {
+	if n < min {
+		return fallback
+	}
+	if n > max {
+		return max
+	}
+	return n
+}
@@ -0,0 +1,93 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package sessionpolicy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Frimurare/WulfVault/internal/database"
+	"github.com/Frimurare/WulfVault/internal/models"
+)
+
+func TestLimits(t *testing.T) {
+	now := time.Now()
+	ago := func(d time.Duration) int64 { return now.Add(-d).Unix() }
+
+	limits := Limits{Lifetime: 24 * time.Hour, IdleTimeout: 10 * time.Minute}
+	if limits.Idle(ago(5*time.Minute), now) {
+		t.Error("session used 5 minutes ago is idle")
+	}
+	if !limits.Idle(ago(11*time.Minute), now) {
+		t.Error("session used 11 minutes ago is not idle")
+	}
+	if (Limits{Lifetime: time.Hour}).Idle(ago(48*time.Hour), now) {
+		t.Error("session without idle timeout is idle")
+	}
+
+	policy := &Policy{LifetimeHours: 24, IdleMinutes: 10, RememberDays: 30}
+	admins := &models.Role{SessionLifetimeHours: 8, SessionIdleMinutes: 5}
+	staff := &models.Role{}
+	if got := policy.ForRole(admins); got.Lifetime != 8*time.Hour || got.IdleTimeout != 5*time.Minute {
+		t.Errorf("role overrides not applied: %+v", got)
+	}
+	if got := policy.ForRole(staff); got != policy.Global() {
+		t.Errorf("role without overrides: got %+v, want %+v", got, policy.Global())
+	}
+	if got := policy.RememberForRole(staff); got != 30*24*time.Hour {
+		t.Errorf("remember lifetime: got %v", got)
+	}
+	if got := policy.RememberForRole(admins); got != 0 {
+		t.Errorf("role with its own limits can be remembered for %v", got)
+	}
+	if got := (&Policy{LifetimeHours: 24}).RememberForRole(staff); got != 0 {
+		t.Errorf("remember disabled, got %v", got)
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	if err := database.Initialize(t.TempDir()); err != nil {
+		t.Fatalf("initialize database: %v", err)
+	}
+	t.Cleanup(func() { database.DB.Close() })
+
+	policy := LoadPolicy()
+	if policy.LifetimeHours != DefaultLifetimeHours || policy.IdleMinutes != DefaultIdleMinutes || policy.RememberDays != 0 {
+		t.Errorf("defaults: got %+v", policy)
+	}
+
+	// The configuration file's timeout is taken over once, not over a saved setting
+	if err := AdoptConfigLifetime(12); err != nil {
+		t.Fatal(err)
+	}
+	if policy = LoadPolicy(); policy.LifetimeHours != 12 {
+		t.Errorf("config lifetime not adopted: got %d", policy.LifetimeHours)
+	}
+	if err := (&Policy{LifetimeHours: 2000, IdleMinutes: 0, RememberDays: 14}).Save(); err != nil {
+		t.Fatal(err)
+	}
+	if err := AdoptConfigLifetime(12); err != nil {
+		t.Fatal(err)
+	}
+	policy = LoadPolicy()
+	if policy.LifetimeHours != MaxLifetimeHours || policy.IdleMinutes != 0 || policy.RememberDays != 14 {
+		t.Errorf("saved policy: got %+v", policy)
+	}
+
+	user := &models.User{Name: "Alice", Email: "alice@example.com", Password: "x", UserLevel: models.UserLevelUser, IsActive: true}
+	if err := database.DB.CreateUser(user); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.DB.SetRoleSessionLimits(models.RoleIdUser, 4, 15); err != nil {
+		t.Fatal(err)
+	}
+	if got := policy.For(user); got.Lifetime != 4*time.Hour || got.IdleTimeout != 15*time.Minute {
+		t.Errorf("limits of user: got %+v", got)
+	}
+	if got := policy.RememberFor(user); got != 0 {
+		t.Errorf("user with role limits can be remembered for %v", got)
+	}
+}
@@ -0,0 +1,168 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package storage
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Frimurare/WulfVault/internal/database"
+)
+
+// CompressionGzip marks a blob that is stored gzip-compressed on disk
+const CompressionGzip = "gzip"
+
+// minCompressionSaving is the fraction of space a compressed blob must save
+// to be kept; otherwise the original is stored as-is
+const minCompressionSaving = 0.10
+
+// compressibleExtensions lists file types that usually compress well even when
+// uploaded with a generic content type
+var compressibleExtensions = map[string]bool{
+	".txt": true, ".log": true, ".csv": true, ".tsv": true, ".json": true,
+	".xml": true, ".sql": true, ".md": true, ".html": true, ".htm": true,
+	".yaml": true, ".yml": true, ".ini": true, ".conf": true, ".svg": true,
+	".js": true, ".css": true, ".bmp": true, ".tar": true, ".doc": true,
+	".xls": true, ".ppt": true, ".rtf": true, ".ndjson": true,
+}
+
+// CompressionEnabled reports whether compression at rest is turned on in settings
+func CompressionEnabled() bool {
+	value, err := database.DB.GetConfigValue("compression_at_rest")
+	return err == nil && value == "true"
+}
+
+// IsCompressible reports whether a file is worth compressing at rest.
+// Already-compressed formats (images, audio, video, archives, office XML)
+// are skipped.
+func IsCompressible(contentType, fileName string) bool {
+	contentType = strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+
+	switch {
+	case strings.HasPrefix(contentType, "text/"):
+		return true
+	case contentType == "image/svg+xml", contentType == "image/bmp":
+		return true
+	case strings.HasPrefix(contentType, "image/"),
+		strings.HasPrefix(contentType, "audio/"),
+		strings.HasPrefix(contentType, "video/"):
+		return false
+	case contentType == "application/json",
+		contentType == "application/xml",
+		contentType == "application/javascript",
+		contentType == "application/sql",
+		contentType == "application/x-ndjson",
+		contentType == "application/x-yaml",
+		contentType == "application/x-tar",
+		contentType == "application/msword",
+		contentType == "application/vnd.ms-excel",
+		contentType == "application/rtf":
+		return true
+	}
+
+	return compressibleExtensions[strings.ToLower(filepath.Ext(fileName))]
+}
+
+// CompressFile gzip-compresses a blob in place. The compressed copy is only
+// kept when it saves a meaningful amount of space. It returns the compression
+// applied ("" if the file was left as-is) and the resulting size on disk.
+func CompressFile(path string) (string, int64, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return "", 0, err
+	}
+
+	tmpPath := path + ".gz.tmp"
+	dst, err := os.Create(tmpPath)
+	if err != nil {
+		return "", info.Size(), err
+	}
+
+	gz := gzip.NewWriter(dst)
+	if _, err := io.Copy(gz, src); err != nil {
+		gz.Close()
+		dst.Close()
+		os.Remove(tmpPath)
+		return "", info.Size(), err
+	}
+	if err := gz.Close(); err != nil {
+		dst.Close()
+		os.Remove(tmpPath)
+		return "", info.Size(), err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(tmpPath)
+		return "", info.Size(), err
+	}
+
+	tmpInfo, err := os.Stat(tmpPath)
+	if err != nil {
+		os.Remove(tmpPath)
+		return "", info.Size(), err
+	}
+
+	if float64(tmpInfo.Size()) > float64(info.Size())*(1-minCompressionSaving) {
+		os.Remove(tmpPath)
+		return "", info.Size(), nil
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return "", info.Size(), err
+	}
+
+	return CompressionGzip, tmpInfo.Size(), nil
+}
+
+// OpenBlob opens a stored blob and returns a reader over its original
+// (decompressed) content
+func OpenBlob(uploadsDir, fileID, compression string) (io.ReadCloser, error) {
+	f, err := OpenFile(uploadsDir, fileID)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := DecodeBlob(f, compression)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return body, nil
+}
+
+// DecodeBlob returns a reader over the original content of an opened blob.
+// Closing the reader closes the file.
+func DecodeBlob(f *os.File, compression string) (io.ReadCloser, error) {
+	if compression != CompressionGzip {
+		return f, nil
+	}
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	return &gzipBlob{Reader: gz, file: f}, nil
+}
+
+// gzipBlob closes both the gzip reader and the underlying file
+type gzipBlob struct {
+	*gzip.Reader
+	file *os.File
+}
+
+func (b *gzipBlob) Close() error {
+	b.Reader.Close()
+	return b.file.Close()
+}
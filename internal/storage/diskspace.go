@@ -0,0 +1,203 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Frimurare/WulfVault/internal/database"
+	"github.com/Frimurare/WulfVault/internal/email"
+)
+
+const (
+	// DefaultDiskReserveMB is the free space always kept on each volume
+	DefaultDiskReserveMB = 1024
+	// DefaultDiskAlertMB is the free space below which administrators are alerted
+	DefaultDiskAlertMB = 5120
+)
+
+// Disk space levels reported by the monitor
+const (
+	DiskStatusOK       = "ok"
+	DiskStatusLow      = "low"
+	DiskStatusCritical = "critical"
+)
+
+// ErrInsufficientSpace is returned when accepting an upload would eat into the reserve
+var ErrInsufficientSpace = errors.New("insufficient disk space")
+
+// VolumeStatus describes the free space on one monitored volume
+type VolumeStatus struct {
+	Name       string `json:"name"`
+	Path       string `json:"-"`
+	FreeBytes  uint64 `json:"free_bytes"`
+	TotalBytes uint64 `json:"total_bytes"`
+	Status     string `json:"status"`
+}
+
+var (
+	diskMutex     sync.RWMutex
+	diskVolumes   []VolumeStatus
+	diskLastLevel = DiskStatusOK
+)
+
+// DiskSettings returns the configured reserve and alert thresholds in bytes
+func DiskSettings() (reserve uint64, alert uint64) {
+	reserveMB := DefaultDiskReserveMB
+	alertMB := DefaultDiskAlertMB
+
+	if v, err := database.DB.GetConfigValue("disk_reserve_mb"); err == nil && v != "" {
+		if mb, err := strconv.Atoi(v); err == nil && mb >= 0 {
+			reserveMB = mb
+		}
+	}
+	if v, err := database.DB.GetConfigValue("disk_alert_mb"); err == nil && v != "" {
+		if mb, err := strconv.Atoi(v); err == nil && mb >= 0 {
+			alertMB = mb
+		}
+	}
+	if alertMB < reserveMB {
+		alertMB = reserveMB
+	}
+
+	return uint64(reserveMB) * 1024 * 1024, uint64(alertMB) * 1024 * 1024
+}
+
+// CheckSpaceForUpload verifies that every volume can take size more bytes
+// without dropping below the configured reserve
+func CheckSpaceForUpload(size int64, dirs ...string) error {
+	if size < 0 {
+		size = 0
+	}
+	reserve, _ := DiskSettings()
+
+	for _, dir := range dirs {
+		free, _, err := volumeUsage(dir)
+		if err != nil {
+			// Cannot determine free space, do not block uploads
+			continue
+		}
+		if free < reserve || free-reserve < uint64(size) {
+			return fmt.Errorf("%w on %s: %s free, %s reserved", ErrInsufficientSpace, dir,
+				database.FormatFileSize(int64(free)), database.FormatFileSize(int64(reserve)))
+		}
+	}
+
+	return nil
+}
+
+// CheckDiskSpace refreshes the status of the uploads and data volumes and
+// alerts administrators when the overall level gets worse
+func CheckDiskSpace(uploadsDir, dataDir string) {
+	reserve, alert := DiskSettings()
+
+	var volumes []VolumeStatus
+	level := DiskStatusOK
+	for _, v := range []struct{ name, path string }{{"uploads", uploadsDir}, {"data", dataDir}} {
+		free, total, err := volumeUsage(v.path)
+		if err != nil {
+			continue
+		}
+
+		status := DiskStatusOK
+		if free < reserve {
+			status = DiskStatusCritical
+		} else if free < alert {
+			status = DiskStatusLow
+		}
+		if levelRank(status) > levelRank(level) {
+			level = status
+		}
+
+		volumes = append(volumes, VolumeStatus{Name: v.name, Path: v.path, FreeBytes: free, TotalBytes: total, Status: status})
+	}
+
+	diskMutex.Lock()
+	previous := diskLastLevel
+	diskVolumes = volumes
+	diskLastLevel = level
+	diskMutex.Unlock()
+
+	if level == previous {
+		return
+	}
+
+	if levelRank(level) < levelRank(previous) {
+		log.Printf("Disk space recovered: %s -> %s", previous, level)
+		return
+	}
+
+	log.Printf("⚠️  Disk space %s on monitored volumes", level)
+
+	details := []string{}
+	for _, v := range volumes {
+		details = append(details, fmt.Sprintf("%s volume (%s): %s free of %s [%s]", v.Name, v.Path,
+			database.FormatFileSize(int64(v.FreeBytes)), database.FormatFileSize(int64(v.TotalBytes)), v.Status))
+	}
+	details = append(details, "Upload reserve: "+database.FormatFileSize(int64(reserve)))
+
+	message := "Free disk space is running low. Uploads will be refused once the reserve is reached."
+	if level == DiskStatusCritical {
+		message = "Free disk space has reached the reserve. New uploads are being refused until space is freed."
+	}
+
+	database.DB.LogAction(&database.AuditLogEntry{
+		UserID:     0,
+		UserEmail:  "system",
+		Action:     database.ActionDiskSpaceLow,
+		EntityType: database.EntitySystem,
+		EntityID:   "disk",
+		Details: database.CreateAuditDetails(map[string]interface{}{
+			"level":   level,
+			"volumes": volumes,
+		}),
+		Success: true,
+	})
+
+	if err := email.SendAdminAlert("Disk space "+level+" on WulfVault server", "Disk Space "+level, message, details); err != nil {
+		log.Printf("Could not send disk space alert email: %v", err)
+	}
+}
+
+// DiskStatus returns the overall level and per-volume status from the last check
+func DiskStatus() (string, []VolumeStatus) {
+	diskMutex.RLock()
+	defer diskMutex.RUnlock()
+	return diskLastLevel, append([]VolumeStatus(nil), diskVolumes...)
+}
+
+// StartDiskSpaceMonitor periodically checks free space on the uploads and data volumes
+func StartDiskSpaceMonitor(uploadsDir, dataDir string, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		// Run immediately on start
+		CheckDiskSpace(uploadsDir, dataDir)
+
+		// Then run on schedule
+		for range ticker.C {
+			CheckDiskSpace(uploadsDir, dataDir)
+		}
+	}()
+
+	log.Printf("Disk space monitor started (interval: %v)", interval)
+}
+
+func levelRank(level string) int {
+	switch level {
+	case DiskStatusCritical:
+		return 2
+	case DiskStatusLow:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,15 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+//go:build windows
+
+package storage
+
+import "errors"
+
+// volumeUsage is not implemented on Windows; the disk-space guard is skipped
+func volumeUsage(path string) (free uint64, total uint64, err error) {
+	return 0, 0, errors.New("disk usage not supported on this platform")
+}
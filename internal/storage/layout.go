@@ -0,0 +1,184 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package storage
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/Frimurare/WulfVault/internal/database"
+)
+
+// LayoutSharded is stored in the Configuration table once all blobs have been
+// moved from the flat uploads directory into the sharded layout
+const LayoutSharded = "sharded"
+
+// layoutConfigKey is the Configuration key holding the current uploads layout
+const layoutConfigKey = "uploads_layout"
+
+// migrationBatchSize is the number of directory entries read per batch during migration
+const migrationBatchSize = 1000
+
+// isShardable reports whether a file ID can be placed in the sharded layout.
+// Only hex IDs of at least four characters are sharded, anything else stays flat.
+func isShardable(fileID string) bool {
+	if len(fileID) < 4 {
+		return false
+	}
+	for _, c := range fileID {
+		if !((c >= '0' && c <= '9') || (c >= 'a' && c <= 'f')) {
+			return false
+		}
+	}
+	return true
+}
+
+// shardedPath returns the sharded location of a blob: <uploadsDir>/ab/cd/<id>
+func shardedPath(uploadsDir, fileID string) string {
+	return filepath.Join(uploadsDir, fileID[0:2], fileID[2:4], fileID)
+}
+
+// legacyPath returns the flat location used before sharding: <uploadsDir>/<id>
+func legacyPath(uploadsDir, fileID string) string {
+	return filepath.Join(uploadsDir, fileID)
+}
+
+// FilePath resolves the on-disk location of an existing blob.
+// The sharded location is checked first, then the legacy flat location, so
+// files are found while the migration is still running. If neither exists the
+// sharded location is returned.
+func FilePath(uploadsDir, fileID string) string {
+	if !isShardable(fileID) {
+		return legacyPath(uploadsDir, fileID)
+	}
+
+	sharded := shardedPath(uploadsDir, fileID)
+	if _, err := os.Stat(sharded); err == nil {
+		return sharded
+	}
+
+	legacy := legacyPath(uploadsDir, fileID)
+	if _, err := os.Stat(legacy); err == nil {
+		return legacy
+	}
+
+	return sharded
+}
+
+// OpenFile opens an existing blob. FilePath checks where the blob is before it
+// is opened, so a migration moving it in between makes the open fail; in that
+// case the other location is tried before giving up.
+func OpenFile(uploadsDir, fileID string) (*os.File, error) {
+	path := FilePath(uploadsDir, fileID)
+	f, err := os.Open(path)
+	if err == nil || !os.IsNotExist(err) || !isShardable(fileID) {
+		return f, err
+	}
+
+	other := shardedPath(uploadsDir, fileID)
+	if path == other {
+		other = legacyPath(uploadsDir, fileID)
+	}
+	if f, otherErr := os.Open(other); otherErr == nil {
+		return f, nil
+	}
+	return nil, err
+}
+
+// CreatePath returns the location a new blob should be written to, creating
+// the shard directories if needed
+func CreatePath(uploadsDir, fileID string) (string, error) {
+	if !isShardable(fileID) {
+		return legacyPath(uploadsDir, fileID), nil
+	}
+
+	path := shardedPath(uploadsDir, fileID)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// MigrateToSharded moves blobs from the flat uploads directory into the sharded
+// layout. Each file is moved with an atomic rename, so the migration can run
+// while the server is serving requests and can be interrupted and resumed at
+// any point. Once a full pass finds nothing left to move, the layout is
+// recorded in the Configuration table and later starts skip the scan.
+func MigrateToSharded(uploadsDir string) error {
+	if layout, err := database.DB.GetConfigValue(layoutConfigKey); err == nil && layout == LayoutSharded {
+		return nil
+	}
+
+	total := 0
+	for {
+		// Renaming entries while reading the directory may cause some to be
+		// skipped, so keep scanning until a pass moves nothing
+		moved, err := migrationPass(uploadsDir)
+		if err != nil {
+			return err
+		}
+		total += moved
+		if moved == 0 {
+			break
+		}
+		log.Printf("Uploads layout migration: %d files moved so far", total)
+	}
+
+	if err := database.DB.SetConfigValue(layoutConfigKey, LayoutSharded); err != nil {
+		return err
+	}
+
+	log.Printf("Uploads layout migration complete: %d files moved to sharded layout", total)
+	return nil
+}
+
+// migrationPass scans the uploads directory once and moves every flat blob
+func migrationPass(uploadsDir string) (int, error) {
+	dir, err := os.Open(uploadsDir)
+	if err != nil {
+		return 0, err
+	}
+	defer dir.Close()
+
+	moved := 0
+	for {
+		entries, err := dir.ReadDir(migrationBatchSize)
+		for _, entry := range entries {
+			name := entry.Name()
+			if !entry.Type().IsRegular() || !isShardable(name) {
+				continue
+			}
+
+			target, cerr := CreatePath(uploadsDir, name)
+			if cerr != nil {
+				return moved, cerr
+			}
+
+			// Never overwrite a blob that already exists in the sharded layout
+			if _, serr := os.Stat(target); serr == nil {
+				log.Printf("Warning: Uploads layout migration skipped %s, sharded copy already exists", name)
+				continue
+			}
+
+			if rerr := os.Rename(legacyPath(uploadsDir, name), target); rerr != nil {
+				if os.IsNotExist(rerr) {
+					continue // Deleted or moved concurrently
+				}
+				return moved, rerr
+			}
+			moved++
+		}
+
+		if err == io.EOF {
+			return moved, nil
+		}
+		if err != nil {
+			return moved, err
+		}
+	}
+}
@@ -0,0 +1,227 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/Frimurare/WulfVault/internal/database"
+)
+
+// Destruction methods recorded on certificates.
+// Blobs are not encrypted at rest, so crypto-shredding is not available and
+// secure deletion overwrites the content before unlinking it.
+const (
+	DestructionMethodOverwrite = "overwrite-random-zero"
+	DestructionMethodUnlink    = "unlink"
+)
+
+// overwritePasses is the number of overwrite passes: random data, then zeros
+const overwritePasses = 2
+
+// certificateKeyConfig is the Configuration key holding the certificate signing key
+const certificateKeyConfig = "destruction_certificate_key"
+
+// SecureDeleteEnabled reports whether the secure deletion policy is turned on
+func SecureDeleteEnabled() bool {
+	value, err := database.DB.GetConfigValue("secure_delete_enabled")
+	return err == nil && value == "true"
+}
+
+// RemoveBlob deletes a file's blob from disk according to the deletion policy.
+// With secure deletion enabled, the blob is overwritten before it is unlinked
+// and a signed destruction certificate is stored and returned. Otherwise the
+// blob is simply removed and no certificate is issued.
+func RemoveBlob(uploadsDir string, file *database.FileInfo, destroyedBy string) (*database.DestructionCertificate, error) {
+	path := FilePath(uploadsDir, file.Id)
+
+	if !SecureDeleteEnabled() {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	method := DestructionMethodOverwrite
+	passes := overwritePasses
+	overwritten, err := overwriteFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+		// Nothing left on disk to overwrite, still certify that the content is gone
+		method = DestructionMethodUnlink
+		passes = 0
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if _, err := os.Stat(path); err == nil {
+		return nil, fmt.Errorf("blob %s still present after deletion", file.Id)
+	}
+
+	certId, err := generateCertificateID()
+	if err != nil {
+		return nil, err
+	}
+
+	cert := &database.DestructionCertificate{
+		Id:               certId,
+		FileId:           file.Id,
+		FileName:         file.Name,
+		FileSHA1:         file.SHA1,
+		SizeBytes:        file.SizeBytes,
+		OwnerId:          file.UserId,
+		Method:           method,
+		Passes:           passes,
+		BytesOverwritten: overwritten,
+		DestroyedAt:      time.Now().Unix(),
+		DestroyedBy:      destroyedBy,
+	}
+
+	signature, err := signCertificate(cert)
+	if err != nil {
+		return nil, err
+	}
+	cert.Signature = signature
+
+	if err := database.DB.SaveDestructionCertificate(cert); err != nil {
+		return nil, err
+	}
+
+	return cert, nil
+}
+
+// AuditDestruction writes the audit entry that accompanies a destruction certificate
+func AuditDestruction(cert *database.DestructionCertificate, userID int64, userEmail, ipAddress, userAgent string) {
+	database.DB.LogAction(&database.AuditLogEntry{
+		UserID:     userID,
+		UserEmail:  userEmail,
+		Action:     database.ActionFileDestroyed,
+		EntityType: database.EntityFile,
+		EntityID:   cert.FileId,
+		Details: database.CreateAuditDetails(map[string]interface{}{
+			"certificate_id":    cert.Id,
+			"file_name":         cert.FileName,
+			"file_sha1":         cert.FileSHA1,
+			"method":            cert.Method,
+			"passes":            cert.Passes,
+			"bytes_overwritten": cert.BytesOverwritten,
+			"signature":         cert.Signature,
+		}),
+		IPAddress: ipAddress,
+		UserAgent: userAgent,
+		Success:   true,
+	})
+}
+
+// VerifyCertificate checks that a certificate was issued by this server and has not been altered
+func VerifyCertificate(cert *database.DestructionCertificate) bool {
+	expected, err := signCertificate(cert)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal([]byte(expected), []byte(cert.Signature))
+}
+
+// overwriteFile overwrites a file in place with random data and then zeros,
+// syncing each pass to disk. It returns the number of bytes overwritten per pass.
+func overwriteFile(path string) (int64, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	size := info.Size()
+
+	sources := []io.Reader{rand.Reader, zeroReader{}}
+	for pass := 0; pass < overwritePasses; pass++ {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return 0, err
+		}
+		if _, err := io.CopyN(f, sources[pass%len(sources)], size); err != nil {
+			return 0, err
+		}
+		if err := f.Sync(); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := f.Truncate(0); err != nil {
+		log.Printf("Warning: Could not truncate %s after overwrite: %v", path, err)
+	}
+
+	return size, nil
+}
+
+// zeroReader is an io.Reader that yields zero bytes
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+// signCertificate computes the HMAC-SHA256 signature over a certificate's fields
+func signCertificate(cert *database.DestructionCertificate) (string, error) {
+	key, err := certificateKey()
+	if err != nil {
+		return "", err
+	}
+
+	payload := fmt.Sprintf("%s|%s|%s|%s|%d|%d|%s|%d|%d|%d|%s",
+		cert.Id, cert.FileId, cert.FileName, cert.FileSHA1, cert.SizeBytes, cert.OwnerId,
+		cert.Method, cert.Passes, cert.BytesOverwritten, cert.DestroyedAt, cert.DestroyedBy)
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// certificateKey returns the server's certificate signing key, creating it on first use
+func certificateKey() ([]byte, error) {
+	value, err := database.DB.GetConfigValue(certificateKeyConfig)
+	if err != nil {
+		return nil, err
+	}
+	if value != "" {
+		return hex.DecodeString(value)
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := database.DB.SetConfigValue(certificateKeyConfig, hex.EncodeToString(key)); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// generateCertificateID generates a random certificate ID
+func generateCertificateID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
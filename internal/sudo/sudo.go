@@ -0,0 +1,165 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+// Package sudo decides which sensitive actions need a recent authentication.
+// Before such an action a signed-in user re-enters their password and second
+// factor, which elevates their session for a few minutes ("sudo mode"). A
+// session that was just signed in to counts as elevated as well.
+package sudo
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Frimurare/WulfVault/internal/database"
+)
+
+// Configuration keys of the policy
+const (
+	ConfigActions         = "sudo_actions"
+	ConfigDurationMinutes = "sudo_duration_minutes"
+)
+
+// Defaults and bounds
+const (
+	DefaultDurationMinutes = 5
+	MaxDurationMinutes     = 60
+)
+
+// Sensitive actions that can require a recent authentication
+const (
+	ActionDeleteUsers     = "delete_users"
+	ActionImpersonate     = "impersonate"
+	ActionRoles           = "roles"
+	ActionServerSettings  = "server_settings"
+	ActionEmailSettings   = "email_settings"
+	ActionAccountSecurity = "account_security"
+	ActionPurgeFiles      = "purge_files"
+	ActionReboot          = "reboot"
+)
+
+// Action is a sensitive action as shown in the settings
+type Action struct {
+	Key         string
+	Label       string
+	Description string
+}
+
+// Actions lists the sensitive actions in the order they are shown
+var Actions = []Action{
+	{ActionDeleteUsers, "Deleting users and download accounts", "Manage Users and the users and download accounts REST API"},
+	{ActionImpersonate, "Viewing the app as another user", "View as User in Manage Users"},
+	{ActionRoles, "Changing roles", "Creating, editing and deleting roles"},
+	{ActionServerSettings, "Changing server settings", "System settings, single sign-on, LDAP and SCIM"},
+	{ActionEmailSettings, "Changing email provider settings", "Including API keys and SMTP passwords"},
+	{ActionAccountSecurity, "Weakening account security", "Disabling 2FA, new backup codes, removing passkeys and creating API keys"},
+	{ActionPurgeFiles, "Permanently deleting files", "Emptying files from the trash"},
+	{ActionReboot, "Restarting the server", ""},
+}
+
+// Policy says which actions need a recent authentication and for how long an
+// authentication counts as recent
+type Policy struct {
+	Actions         map[string]bool
+	DurationMinutes int
+}
+
+// LoadPolicy reads the policy from the Configuration table. Every action
+// requires a recent authentication until the policy is changed.
+func LoadPolicy() *Policy {
+	p := &Policy{Actions: map[string]bool{}, DurationMinutes: DefaultDurationMinutes}
+
+	value, err := database.DB.GetConfigValue(ConfigActions)
+	if err != nil || value == "" {
+		for _, action := range Actions {
+			p.Actions[action.Key] = true
+		}
+	} else {
+		p.Actions = parseActions(value)
+	}
+
+	if value, err := database.DB.GetConfigValue(ConfigDurationMinutes); err == nil && value != "" {
+		if n, err := strconv.Atoi(value); err == nil {
+			p.DurationMinutes = n
+		}
+	}
+	p.DurationMinutes = clampDuration(p.DurationMinutes)
+	return p
+}
+
+// Save stores the policy
+func (p *Policy) Save() error {
+	if err := database.DB.SetConfigValue(ConfigActions, formatActions(p.Actions)); err != nil {
+		return err
+	}
+	return database.DB.SetConfigValue(ConfigDurationMinutes, strconv.Itoa(clampDuration(p.DurationMinutes)))
+}
+
+// Requires reports whether an action needs a recent authentication
+func (p *Policy) Requires(action string) bool {
+	return p.Actions[action]
+}
+
+// Duration returns how long an authentication counts as recent
+func (p *Policy) Duration() time.Duration {
+	return time.Duration(p.DurationMinutes) * time.Minute
+}
+
+// Elevated reports whether a session authenticated recently enough at now.
+// signedInAt is when the session was created, reauthAt when the user last
+// confirmed their identity in it (0 if never).
+func (p *Policy) Elevated(signedInAt, reauthAt int64, now time.Time) bool {
+	last := signedInAt
+	if reauthAt > last {
+		last = reauthAt
+	}
+	return last > 0 && now.Before(time.Unix(last, 0).Add(p.Duration()))
+}
+
+// ExpiresAt returns when the elevation of a session ends
+func (p *Policy) ExpiresAt(signedInAt, reauthAt int64) time.Time {
+	last := signedInAt
+	if reauthAt > last {
+		last = reauthAt
+	}
+	return time.Unix(last, 0).Add(p.Duration())
+}
+
+// parseActions reads the stored list of actions. "none" stands for an empty list,
+// which an empty value can't, as that means the policy was never saved.
+func parseActions(value string) map[string]bool {
+	actions := map[string]bool{}
+	for _, key := range strings.Split(value, ",") {
+		key = strings.TrimSpace(key)
+		if key != "" && key != "none" {
+			actions[key] = true
+		}
+	}
+	return actions
+}
+
+func formatActions(actions map[string]bool) string {
+	var keys []string
+	for _, action := range Actions {
+		if actions[action.Key] {
+			keys = append(keys, action.Key)
+		}
+	}
+	if len(keys) == 0 {
+		return "none"
+	}
+	return strings.Join(keys, ",")
+}
+
+func clampDuration(minutes int) int {
+	if minutes < 1 {
+		return DefaultDurationMinutes
+	}
+	if minutes > MaxDurationMinutes {
+		return MaxDurationMinutes
+	}
+	return minutes
+}
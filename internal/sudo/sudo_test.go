@@ -0,0 +1,75 @@
+// WulfVault - Secure File Transfer System
+// Copyright (c) 2025 Ulf Holmström (Frimurare)
+// Licensed under the GNU Affero General Public License v3.0 (AGPL-3.0)
+// You must retain this notice in any copy or derivative work.
+
+package sudo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Frimurare/WulfVault/internal/database"
+)
+
+func TestElevated(t *testing.T) {
+	policy := &Policy{DurationMinutes: 5}
+	now := time.Now()
+	ago := func(d time.Duration) int64 { return now.Add(-d).Unix() }
+
+	tests := []struct {
+		name       string
+		signedInAt int64
+		reauthAt   int64
+		want       bool
+	}{
+		{"just signed in", ago(time.Minute), 0, true},
+		{"signed in long ago", ago(time.Hour), 0, false},
+		{"confirmed recently", ago(time.Hour), ago(2 * time.Minute), true},
+		{"confirmed too long ago", ago(time.Hour), ago(6 * time.Minute), false},
+		{"unknown sign-in time", 0, 0, false},
+	}
+	for _, tt := range tests {
+		if got := policy.Elevated(tt.signedInAt, tt.reauthAt, now); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	if err := database.Initialize(t.TempDir()); err != nil {
+		t.Fatalf("initialize database: %v", err)
+	}
+	t.Cleanup(func() { database.DB.Close() })
+
+	// Every action is protected until the policy is saved
+	policy := LoadPolicy()
+	for _, action := range Actions {
+		if !policy.Requires(action.Key) {
+			t.Errorf("default policy does not require %s", action.Key)
+		}
+	}
+	if policy.DurationMinutes != DefaultDurationMinutes {
+		t.Errorf("default duration: got %d", policy.DurationMinutes)
+	}
+
+	saved := &Policy{Actions: map[string]bool{ActionReboot: true, ActionRoles: true}, DurationMinutes: 500}
+	if err := saved.Save(); err != nil {
+		t.Fatal(err)
+	}
+	policy = LoadPolicy()
+	if !policy.Requires(ActionReboot) || !policy.Requires(ActionRoles) || policy.Requires(ActionDeleteUsers) {
+		t.Errorf("saved actions not loaded: %v", policy.Actions)
+	}
+	if policy.DurationMinutes != MaxDurationMinutes {
+		t.Errorf("duration not clamped: got %d", policy.DurationMinutes)
+	}
+
+	// An empty selection stays empty instead of falling back to the default
+	if err := (&Policy{Actions: map[string]bool{}, DurationMinutes: 5}).Save(); err != nil {
+		t.Fatal(err)
+	}
+	if policy = LoadPolicy(); len(policy.Actions) != 0 {
+		t.Errorf("no actions saved, got %v", policy.Actions)
+	}
+}
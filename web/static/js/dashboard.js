@@ -157,6 +157,14 @@ if (uploadForm) {
         formData.set('unlimited_time', document.getElementById('unlimitedTime').checked ? 'true' : 'false');
         formData.set('unlimited_downloads', document.getElementById('unlimitedDownloads').checked ? 'true' : 'false');
         formData.set('require_auth', document.getElementById('requireAuth').checked ? 'true' : 'false');
+        const allowMagicLinkEl = document.getElementById('allowMagicLink');
+        if (allowMagicLinkEl) {
+            formData.set('allow_magic_link', allowMagicLinkEl.checked ? 'true' : 'false');
+        }
+        const notifyRejectedEl = document.getElementById('notifyRejectedRecipients');
+        if (notifyRejectedEl) {
+            formData.set('notify_rejected_recipients', notifyRejectedEl.checked ? 'true' : 'false');
+        }
 
         // Handle password field - only include if checkbox is checked
         const enablePasswordCheckbox = document.getElementById('enablePassword');